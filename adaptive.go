@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Adaptive Timeout Invoker
+//
+// MAX_EXEC_MILLIS has to be set high enough for the slowest invocations that
+// are expected, which lets a hung invocation hold an invoker for a long time
+// when the function is usually fast. When ADAPTIVE_TIMEOUT is set, the
+// adaptive timeout invoker bounds each invocation by a timeout derived from the
+// recent latencies instead: the p99 latency of the last ADAPTIVE_WINDOW
+// invocations multiplied by ADAPTIVE_TIMEOUT_MULTIPLIER, clamped between
+// MIN_EXEC_MILLIS and MAX_EXEC_MILLIS.
+//
+// The timeout starts at MAX_EXEC_MILLIS and is recomputed every
+// ADAPTIVE_UPDATE_INTERVAL invocations, and each change is logged. Invocations
+// that time out are recorded with the timeout as their latency, so that the
+// timeout grows again if the function becomes slower.
+
+type adaptiveTimeoutInvoker struct {
+	invoker    fnrun.Invoker
+	multiplier float64
+	min        time.Duration
+	max        time.Duration
+	interval   int
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+	recorded  int
+	timeout   time.Duration
+}
+
+func newAdaptiveTimeoutInvoker(invoker fnrun.Invoker, window int, multiplier float64, min time.Duration, max time.Duration, interval int) (*adaptiveTimeoutInvoker, error) {
+	if window <= 0 {
+		return nil, configErrorf("ADAPTIVE_WINDOW", "ADAPTIVE_WINDOW must be greater than zero")
+	}
+	if multiplier <= 0 {
+		return nil, configErrorf("ADAPTIVE_TIMEOUT_MULTIPLIER", "ADAPTIVE_TIMEOUT_MULTIPLIER must be greater than zero")
+	}
+	if interval <= 0 {
+		return nil, configErrorf("ADAPTIVE_UPDATE_INTERVAL", "ADAPTIVE_UPDATE_INTERVAL must be greater than zero")
+	}
+	if max <= 0 {
+		return nil, configErrorf("MAX_EXEC_MILLIS", "MAX_EXEC_MILLIS must be greater than zero when ADAPTIVE_TIMEOUT is set")
+	}
+	if min <= 0 || min > max {
+		return nil, configErrorf("MIN_EXEC_MILLIS", "MIN_EXEC_MILLIS must be greater than zero and at most MAX_EXEC_MILLIS")
+	}
+
+	return &adaptiveTimeoutInvoker{
+		invoker:    invoker,
+		multiplier: multiplier,
+		min:        min,
+		max:        max,
+		interval:   interval,
+		latencies:  make([]time.Duration, 0, window),
+		timeout:    max,
+	}, nil
+}
+
+func (ai *adaptiveTimeoutInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	timeout := ai.currentTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := ai.invoker.Invoke(ctx, input)
+	latency := time.Since(start)
+	if latency > timeout {
+		latency = timeout
+	}
+	ai.record(latency)
+	return result, err
+}
+
+func (ai *adaptiveTimeoutInvoker) currentTimeout() time.Duration {
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+	return ai.timeout
+}
+
+// record adds latency to the window and recomputes the timeout once every
+// interval invocations.
+func (ai *adaptiveTimeoutInvoker) record(latency time.Duration) {
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+
+	if len(ai.latencies) < cap(ai.latencies) {
+		ai.latencies = append(ai.latencies, latency)
+	} else {
+		ai.latencies[ai.next] = latency
+		ai.next = (ai.next + 1) % len(ai.latencies)
+	}
+
+	ai.recorded++
+	if ai.recorded < ai.interval {
+		return
+	}
+	ai.recorded = 0
+
+	sorted := append([]time.Duration(nil), ai.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	timeout := time.Duration(float64(latencyPercentile(sorted, 0.99)) * ai.multiplier).Round(time.Millisecond)
+	if timeout < ai.min {
+		timeout = ai.min
+	}
+	if timeout > ai.max {
+		timeout = ai.max
+	}
+	if timeout != ai.timeout {
+		log.Printf("adaptive timeout changed from %v to %v", ai.timeout, timeout)
+		ai.timeout = timeout
+	}
+}
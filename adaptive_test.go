@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// newTestAdaptiveTimeoutInvoker returns an adaptive timeout invoker of
+// invoker, failing the test if it cannot be created.
+func newTestAdaptiveTimeoutInvoker(t *testing.T, invoker fnrun.Invoker, window int, multiplier float64, min time.Duration, max time.Duration, interval int) *adaptiveTimeoutInvoker {
+	t.Helper()
+	ai, err := newAdaptiveTimeoutInvoker(invoker, window, multiplier, min, max, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ai
+}
+
+func TestAdaptiveTimeoutFollowsP99Latency(t *testing.T) {
+	out := captureLog(t)
+	ai := newTestAdaptiveTimeoutInvoker(t, nil, 100, 3, 10*time.Millisecond, time.Second, 100)
+
+	for i := 1; i < 100; i++ {
+		ai.record(time.Duration(i) * time.Millisecond)
+	}
+	if timeout := ai.currentTimeout(); timeout != time.Second {
+		t.Errorf("expected MAX_EXEC_MILLIS until the first update, got %v", timeout)
+	}
+
+	ai.record(100 * time.Millisecond)
+	if timeout := ai.currentTimeout(); timeout != 297*time.Millisecond {
+		t.Errorf("expected 3 times the p99 latency of 99ms, got %v", timeout)
+	}
+	if !strings.Contains(out.String(), "adaptive timeout changed from 1s to 297ms") {
+		t.Errorf("expected the change to be logged, got %q", out.String())
+	}
+}
+
+func TestAdaptiveTimeoutIsClamped(t *testing.T) {
+	tests := []struct {
+		name    string
+		latency time.Duration
+		want    time.Duration
+	}{
+		{"fast", time.Millisecond, 10 * time.Millisecond},
+		{"slow", 500 * time.Millisecond, time.Second},
+		{"within bounds", 50 * time.Millisecond, 150 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ai := newTestAdaptiveTimeoutInvoker(t, nil, 10, 3, 10*time.Millisecond, time.Second, 10)
+			for i := 0; i < 10; i++ {
+				ai.record(tt.latency)
+			}
+			if timeout := ai.currentTimeout(); timeout != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, timeout)
+			}
+		})
+	}
+}
+
+func TestAdaptiveTimeoutUsesTheLatestWindow(t *testing.T) {
+	ai := newTestAdaptiveTimeoutInvoker(t, nil, 10, 2, time.Millisecond, time.Second, 5)
+
+	for i := 0; i < 10; i++ {
+		ai.record(100 * time.Millisecond)
+	}
+	if timeout := ai.currentTimeout(); timeout != 200*time.Millisecond {
+		t.Fatalf("expected 200ms, got %v", timeout)
+	}
+
+	// Half of the window is still slow after five fast invocations, and none
+	// of it after ten.
+	for i := 0; i < 5; i++ {
+		ai.record(10 * time.Millisecond)
+	}
+	if timeout := ai.currentTimeout(); timeout != 200*time.Millisecond {
+		t.Errorf("expected 200ms while the window holds slow latencies, got %v", timeout)
+	}
+	for i := 0; i < 5; i++ {
+		ai.record(10 * time.Millisecond)
+	}
+	if timeout := ai.currentTimeout(); timeout != 20*time.Millisecond {
+		t.Errorf("expected 20ms once the slow latencies left the window, got %v", timeout)
+	}
+}
+
+func TestAdaptiveTimeoutInvokerBoundsInvocations(t *testing.T) {
+	hang := false
+	ai := newTestAdaptiveTimeoutInvoker(t, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if hang {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &fnrun.Result{Status: 200}, nil
+	}), 1, 2, 10*time.Millisecond, time.Second, 1)
+
+	if _, err := ai.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+		t.Fatal(err)
+	}
+	if timeout := ai.currentTimeout(); timeout != 10*time.Millisecond {
+		t.Fatalf("expected the timeout to drop to MIN_EXEC_MILLIS, got %v", timeout)
+	}
+
+	// A timed out invocation is recorded with the timeout as its latency, so
+	// the timeout doubles after each one.
+	hang = true
+	for _, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		start := time.Now()
+		_, err := ai.Invoke(context.Background(), &fnrun.Input{})
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expected the invocation to time out, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("expected the invocation to be cut at the adaptive timeout, took %v", elapsed)
+		}
+		if timeout := ai.currentTimeout(); timeout != want {
+			t.Errorf("expected the timeout to grow to %v, got %v", want, timeout)
+		}
+	}
+}
+
+func TestNewAdaptiveTimeoutInvokerConfigErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		window     int
+		multiplier float64
+		min        time.Duration
+		max        time.Duration
+		interval   int
+		wantName   string
+	}{
+		{"window", 0, 3, time.Millisecond, time.Second, 100, "ADAPTIVE_WINDOW"},
+		{"multiplier", 1000, 0, time.Millisecond, time.Second, 100, "ADAPTIVE_TIMEOUT_MULTIPLIER"},
+		{"interval", 1000, 3, time.Millisecond, time.Second, 0, "ADAPTIVE_UPDATE_INTERVAL"},
+		{"no max", 1000, 3, time.Millisecond, 0, 100, "MAX_EXEC_MILLIS"},
+		{"no min", 1000, 3, 0, time.Second, 100, "MIN_EXEC_MILLIS"},
+		{"min above max", 1000, 3, 2 * time.Second, time.Second, 100, "MIN_EXEC_MILLIS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newAdaptiveTimeoutInvoker(nil, tt.window, tt.multiplier, tt.min, tt.max, tt.interval)
+			checkConfigError(t, err, tt.wantName, tt.wantName)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// errPaused is returned to the event source when it attempts to invoke the
+// function while processing has been paused through the admin endpoints.
+var errPaused = errors.New("runner is paused")
+
+// -----------------------------------------------------------------------------
+// Pause Invoker
+//
+// The pause invoker lets an operator stop event processing without stopping
+// the runner, such as during maintenance of a database the function depends
+// on. While paused, new invocations fail immediately with errPaused, which the
+// HTTP source reports as 503; invocations that were already in flight when the
+// runner was paused are left to complete.
+
+type pauseInvoker struct {
+	invoker fnrun.Invoker
+	paused  int32
+}
+
+func (pi *pauseInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	result, _, err := pi.InvokeAckable(ctx, input)
+	return result, err
+}
+
+// InvokeAckable is like Invoke but also returns the nack directive reported by
+// the underlying invoker, if any.
+func (pi *pauseInvoker) InvokeAckable(ctx context.Context, input *fnrun.Input) (*fnrun.Result, *runner.NackDirective, error) {
+	if atomic.LoadInt32(&pi.paused) == 1 {
+		return nil, nil, errPaused
+	}
+	return invokeAckable(ctx, pi.invoker, input)
+}
+
+func (pi *pauseInvoker) setPaused(paused bool) {
+	var value int32
+	if paused {
+		value = 1
+	}
+	if atomic.SwapInt32(&pi.paused, value) != value {
+		if paused {
+			log.Printf("event processing paused by admin request")
+		} else {
+			log.Printf("event processing resumed by admin request")
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Admin Server
+//
+// The admin server is served on ADMIN_ADDR and exposes endpoints for
+// operational control of the runner. Every request must carry ADMIN_TOKEN as a
+// bearer token.
+//
+//   POST /admin/pause   stops new invocations
+//   POST /admin/resume  allows new invocations again
+
+func newAdminHandler(token string, pause *pauseInvoker) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/pause", adminEndpoint(token, func() { pause.setPaused(true) }))
+	mux.HandleFunc("/admin/resume", adminEndpoint(token, func() { pause.setPaused(false) }))
+	return mux
+}
+
+// adminEndpoint returns a handler that authenticates a POST request before
+// performing action.
+func adminEndpoint(token string, action func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		bearer := strings.TrimPrefix(header, "Bearer ")
+		if bearer == header || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		action()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
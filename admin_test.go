@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// sendAdminRequest sends a request with method to path on the admin server
+// at url, authenticating with token unless it is empty.
+func sendAdminRequest(t *testing.T, url string, method string, path string, token string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAdminPauseBlocksNewInvocationsAndLetsInFlightOnesComplete(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	pause := &pauseInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if string(input.Data) == "slow" {
+			started <- struct{}{}
+			<-release
+		}
+		return &fnrun.Result{Status: 200, Data: input.Data}, nil
+	})}
+	admin := httptest.NewServer(newAdminHandler("secret", pause))
+	defer admin.Close()
+
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 0, 0, nil, nil, nil, nil, nil, 1, nil)
+	runHTTPSource(t, addr, source, pause)
+
+	post := func(body string) (int, string) {
+		t.Helper()
+		resp, err := http.Post("http://"+addr+"/", "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(data)
+	}
+
+	type response struct {
+		status int
+		body   string
+	}
+	inFlight := make(chan response, 1)
+	go func() {
+		status, body := post("slow")
+		inFlight <- response{status, body}
+	}()
+	<-started
+
+	if status := sendAdminRequest(t, admin.URL, http.MethodPost, "/admin/pause", "secret"); status != http.StatusNoContent {
+		t.Fatalf("expected pause to return 204, got %d", status)
+	}
+	if status, body := post("fast"); status != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while paused, got %d: %s", status, body)
+	}
+
+	close(release)
+	if r := <-inFlight; r.status != http.StatusOK || r.body != "slow" {
+		t.Errorf("expected the in-flight invocation to complete, got %d: %s", r.status, r.body)
+	}
+
+	if status := sendAdminRequest(t, admin.URL, http.MethodPost, "/admin/resume", "secret"); status != http.StatusNoContent {
+		t.Fatalf("expected resume to return 204, got %d", status)
+	}
+	if status, body := post("fast"); status != http.StatusOK || body != "fast" {
+		t.Errorf("expected 200 after resuming, got %d: %s", status, body)
+	}
+}
+
+func TestAdminEndpointsRequireTheTokenAndPost(t *testing.T) {
+	pause := &pauseInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 200}, nil
+	})}
+	admin := httptest.NewServer(newAdminHandler("secret", pause))
+	defer admin.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		want   int
+	}{
+		{"no token", http.MethodPost, "", http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "guess", http.StatusUnauthorized},
+		{"GET", http.MethodGet, "secret", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := sendAdminRequest(t, admin.URL, tt.method, "/admin/pause", tt.token); status != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, status)
+			}
+		})
+	}
+
+	if _, err := pause.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+		t.Errorf("expected rejected requests not to pause the runner, got %v", err)
+	}
+}
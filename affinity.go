@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// cpuAffinityEnvName is the environment variable in which the trampoline is
+// passed the CPU to which the function process is pinned.
+const cpuAffinityEnvName = "FUNCTION_CPU_AFFINITY"
+
+// maxCPUID is one more than the largest CPU ID that can be pinned, which is
+// the size of the CPU set of sched_setaffinity(2) in glibc.
+const maxCPUID = 1024
+
+// -----------------------------------------------------------------------------
+// CPU affinity
+//
+// When CPU_AFFINITY lists CPU IDs, each function process is pinned to one of
+// them, taking the CPUs in turn as processes are started, so the invokers of a
+// pool are spread evenly across the CPUs. A replacement process takes the next
+// CPU in turn rather than the one of the process it replaces.
+//
+// As with resource limits, the affinity cannot be set on a child process
+// before it executes, so the process is started through the rlimit trampoline,
+// which pins itself to the CPU and then executes the function command. The
+// process, and every thread it starts, therefore runs only on that CPU.
+
+type cpuAffinity struct {
+	cpus []int
+	next uint64
+}
+
+// parseCPUAffinity parses a comma-separated list of CPU IDs. It returns nil if
+// the list is empty.
+func parseCPUAffinity(list string) (*cpuAffinity, error) {
+	var cpus []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		cpu, err := strconv.Atoi(field)
+		if err != nil || cpu < 0 || cpu >= maxCPUID {
+			return nil, fmt.Errorf("invalid CPU ID %q", field)
+		}
+		cpus = append(cpus, cpu)
+	}
+	if len(cpus) == 0 {
+		return nil, nil
+	}
+	return &cpuAffinity{cpus: cpus}, nil
+}
+
+func getCPUAffinity() (*cpuAffinity, error) {
+	// env: CPU_AFFINITY list "" "Comma-separated CPU IDs across which function processes are pinned in turn; Linux only."
+	affinity, err := parseCPUAffinity(os.Getenv("CPU_AFFINITY"))
+	if err != nil {
+		return nil, configErrorf("CPU_AFFINITY", "Invalid CPU_AFFINITY: %v", err)
+	}
+	if affinity != nil && !cpuAffinitySupported {
+		return nil, configErrorf("CPU_AFFINITY", "CPU_AFFINITY is not supported on this platform")
+	}
+	return affinity, nil
+}
+
+// nextCPU returns the CPU to which the next process is pinned.
+func (a *cpuAffinity) nextCPU() int {
+	n := atomic.AddUint64(&a.next, 1) - 1
+	return a.cpus[n%uint64(len(a.cpus))]
+}
@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const cpuAffinitySupported = true
+
+// setCPUAffinity pins the calling thread to cpu. Threads and processes started
+// by the thread afterwards, including the image it executes, inherit the
+// affinity.
+func setCPUAffinity(cpu int) error {
+	var set [maxCPUID / 64]uint64
+	set[cpu/64] = 1 << (uint(cpu) % 64)
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, uintptr(len(set)*8), uintptr(unsafe.Pointer(&set[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+var cpusAllowedListPattern = regexp.MustCompile(`(?m)^Cpus_allowed_list:\s*(\S+)$`)
+
+// cpusAllowedList returns the Cpus_allowed_list of a /proc/<pid>/status file.
+func cpusAllowedList(t *testing.T, status []byte) string {
+	t.Helper()
+	match := cpusAllowedListPattern.FindSubmatch(status)
+	if match == nil {
+		t.Fatalf("expected a Cpus_allowed_list in %s", status)
+	}
+	return string(match[1])
+}
+
+// lastAllowedCPU returns the highest CPU on which the test may run, so that
+// a process pinned to it has a mask that differs from the default when the
+// machine has more than one CPU.
+func lastAllowedCPU(t *testing.T) int {
+	t.Helper()
+	status, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		t.Skipf("could not read the status of the test process: %v", err)
+	}
+	list := cpusAllowedList(t, status)
+	last := list[strings.LastIndexAny(list, ",-")+1:]
+	cpu, err := strconv.Atoi(last)
+	if err != nil {
+		t.Fatalf("could not parse Cpus_allowed_list %q: %v", list, err)
+	}
+	return cpu
+}
+
+func TestFunctionProcessesArePinnedToTheirCPU(t *testing.T) {
+	cpu := lastAllowedCPU(t)
+	cmd := testFunctionCmd("proc-status")
+	if err := wrapCmdWithRlimits(cmd, rlimits{}); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := newSizedInvokerPool(newCmdInvokerFactory(cmd, time.Second, &cpuAffinity{cpus: []int{cpu}}), "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	for i := 0; i < 2; i++ {
+		result, err := pool.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if list := cpusAllowedList(t, result.Data); list != strconv.Itoa(cpu) {
+			t.Errorf("expected the function process to be pinned to CPU %d, got %s", cpu, list)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+const cpuAffinitySupported = false
+
+func setCPUAffinity(cpu int) error {
+	return errors.New("CPU affinity is not supported on this platform")
+}
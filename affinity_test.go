@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestParseCPUAffinity(t *testing.T) {
+	affinity, err := parseCPUAffinity(" 0, 2 ,5,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []int{0, 2, 5}
+	if len(affinity.cpus) != len(want) {
+		t.Fatalf("expected CPUs %v, got %v", want, affinity.cpus)
+	}
+	for i := range want {
+		if affinity.cpus[i] != want[i] {
+			t.Errorf("expected CPUs %v, got %v", want, affinity.cpus)
+		}
+	}
+
+	if affinity, err := parseCPUAffinity(" , "); err != nil || affinity != nil {
+		t.Errorf("expected no affinity for an empty list, got %v, %v", affinity, err)
+	}
+	for _, list := range []string{"a", "-1", "1024", "0,1.5"} {
+		if _, err := parseCPUAffinity(list); err == nil {
+			t.Errorf("expected an error for %q", list)
+		}
+	}
+}
+
+func TestCPUAffinityDistributesProcessesRoundRobin(t *testing.T) {
+	affinity := &cpuAffinity{cpus: []int{3, 1, 2}}
+	want := []int{3, 1, 2, 3, 1, 2, 3}
+	for i, cpu := range want {
+		if got := affinity.nextCPU(); got != cpu {
+			t.Errorf("process %d: expected CPU %d, got %d", i, cpu, got)
+		}
+	}
+}
+
+func TestInvalidCPUAffinityIsAConfigError(t *testing.T) {
+	t.Setenv("CPU_AFFINITY", "0,x")
+	_, err := getCPUAffinity()
+	var configErr *runner.ConfigError
+	if !errors.As(err, &configErr) || configErr.Name != "CPU_AFFINITY" {
+		t.Errorf("expected a CPU_AFFINITY config error, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Result Aggregator
+//
+// The result aggregator collects results before they are delivered to the sink
+// and calls the sink once with a result whose data is a JSON array of the
+// collected results. The aggregate is delivered when size results have been
+// collected or when timeout has elapsed since the first result was added to it.
+// Each caller waits until the aggregate containing its result has been
+// delivered and receives the outcome of that delivery, so a sink failure is
+// reported for every result in the aggregate.
+
+type aggregateResponse struct {
+	result *fnrun.Result
+	err    error
+}
+
+type aggregateRequest struct {
+	ctx      context.Context
+	result   *fnrun.Result
+	response chan aggregateResponse
+}
+
+type resultAggregator struct {
+	sink       eventSinkTransformer
+	size       int
+	timeout    time.Duration
+	mu         sync.Mutex
+	pending    []*aggregateRequest
+	generation uint64
+}
+
+func newAggregatingSink(sink eventSinkTransformer, size int, timeout time.Duration) eventSinkTransformer {
+	ra := &resultAggregator{sink: sink, size: size, timeout: timeout}
+	return ra.deliver
+}
+
+func (ra *resultAggregator) deliver(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+	req := &aggregateRequest{ctx: ctx, result: result, response: make(chan aggregateResponse, 1)}
+
+	ra.mu.Lock()
+	ra.pending = append(ra.pending, req)
+	if len(ra.pending) == 1 {
+		generation := ra.generation
+		time.AfterFunc(ra.timeout, func() { ra.flush(generation) })
+	}
+	var aggregate []*aggregateRequest
+	if len(ra.pending) >= ra.size {
+		aggregate = ra.take()
+	}
+	ra.mu.Unlock()
+
+	if aggregate != nil {
+		ra.dispatch(aggregate)
+	}
+
+	select {
+	case response := <-req.response:
+		return response.result, response.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// take removes and returns the pending aggregate. The caller must hold ra.mu.
+func (ra *resultAggregator) take() []*aggregateRequest {
+	aggregate := ra.pending
+	ra.pending = nil
+	ra.generation++
+	return aggregate
+}
+
+// flush dispatches the pending aggregate if it is still the aggregate
+// identified by generation.
+func (ra *resultAggregator) flush(generation uint64) {
+	ra.mu.Lock()
+	if generation != ra.generation || len(ra.pending) == 0 {
+		ra.mu.Unlock()
+		return
+	}
+	aggregate := ra.take()
+	ra.mu.Unlock()
+
+	ra.dispatch(aggregate)
+}
+
+func (ra *resultAggregator) dispatch(aggregate []*aggregateRequest) {
+	results := make([]*fnrun.Result, len(aggregate))
+	for i, req := range aggregate {
+		results[i] = req.result
+	}
+
+	response := aggregateResponse{}
+	if combined, err := combineResults(results); err != nil {
+		response.err = err
+	} else {
+		response.result, response.err = ra.sink(aggregate[0].ctx, combined)
+	}
+
+	for _, req := range aggregate {
+		req.response <- response
+	}
+}
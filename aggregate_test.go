@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// aggregateRecorder is a sink that records the number of results in each
+// aggregate it receives.
+type aggregateRecorder struct {
+	mu    sync.Mutex
+	sizes []int
+	err   error
+}
+
+func (ar *aggregateRecorder) sink(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(result.Data, &elements); err != nil {
+		return result, err
+	}
+	ar.mu.Lock()
+	ar.sizes = append(ar.sizes, len(elements))
+	ar.mu.Unlock()
+	return result, ar.err
+}
+
+func deliverConcurrently(sink eventSinkTransformer, n int) []error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = sink(context.Background(), &fnrun.Result{Data: []byte(strconv.Itoa(i))})
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestAggregatingSinkDeliversFullAggregates(t *testing.T) {
+	recorder := &aggregateRecorder{}
+	sink := newAggregatingSink(recorder.sink, 5, time.Minute)
+
+	for i, err := range deliverConcurrently(sink, 10) {
+		if err != nil {
+			t.Errorf("result %d: unexpected error: %v", i, err)
+		}
+	}
+
+	if len(recorder.sizes) != 2 || recorder.sizes[0] != 5 || recorder.sizes[1] != 5 {
+		t.Errorf("expected the sink to be called twice with 5 results, got %v", recorder.sizes)
+	}
+}
+
+func TestAggregatingSinkDeliversPartialAggregatesAfterTheTimeout(t *testing.T) {
+	recorder := &aggregateRecorder{}
+	sink := newAggregatingSink(recorder.sink, 5, 20*time.Millisecond)
+
+	start := time.Now()
+	deliverConcurrently(sink, 3)
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("expected the partial aggregate to wait for the timeout, took %v", elapsed)
+	}
+	if len(recorder.sizes) != 1 || recorder.sizes[0] != 3 {
+		t.Errorf("expected one aggregate of 3 results, got %v", recorder.sizes)
+	}
+}
+
+func TestAggregatingSinkReportsFailuresToEveryResult(t *testing.T) {
+	recorder := &aggregateRecorder{err: errors.New("sink failed")}
+	sink := newAggregatingSink(recorder.sink, 3, time.Minute)
+
+	for i, err := range deliverConcurrently(sink, 3) {
+		if err != recorder.err {
+			t.Errorf("result %d: expected the sink error, got %v", i, err)
+		}
+	}
+}
+
+// windowedPipeline returns a pipeline that echoes its inputs to the sink of
+// recorder through the sink window configured by the environment.
+func windowedPipeline(t *testing.T, recorder *aggregateRecorder) fnrun.Invoker {
+	t.Helper()
+	t.Setenv("MAX_FUNCTION_COUNT", "20")
+	t.Setenv("RESULT_AGGREGATE_SIZE", "")
+	echo := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 200, Data: input.Data}, nil
+	})
+	pipeline, closer, err := getPipeline(echo, recorder.sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closer.Close() })
+	return pipeline
+}
+
+func invokeConcurrently(t *testing.T, invoker fnrun.Invoker, n int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := invoker.Invoke(context.Background(), &fnrun.Input{Data: []byte(strconv.Itoa(i))}); err != nil {
+				t.Errorf("input %d: unexpected error: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSinkWindowFlushesFullWindows(t *testing.T) {
+	t.Setenv("SINK_WINDOW_MILLIS", "50")
+	t.Setenv("SINK_WINDOW_SIZE", "10")
+	recorder := &aggregateRecorder{}
+	invokeConcurrently(t, windowedPipeline(t, recorder), 20)
+
+	if len(recorder.sizes) != 2 || recorder.sizes[0] != 10 || recorder.sizes[1] != 10 {
+		t.Errorf("expected the sink to be called twice with 10 results, got %v", recorder.sizes)
+	}
+}
+
+func TestSinkWindowFlushesAfterTheWindow(t *testing.T) {
+	t.Setenv("SINK_WINDOW_MILLIS", "50")
+	t.Setenv("SINK_WINDOW_SIZE", "")
+	recorder := &aggregateRecorder{}
+	pipeline := windowedPipeline(t, recorder)
+
+	start := time.Now()
+	invokeConcurrently(t, pipeline, 5)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the results to wait for the window, took %v", elapsed)
+	}
+	if len(recorder.sizes) != 1 || recorder.sizes[0] != 5 {
+		t.Errorf("expected one window of 5 results, got %v", recorder.sizes)
+	}
+}
+
+func TestSinkWindowCannotBeCombinedWithAggregates(t *testing.T) {
+	t.Setenv("SINK_WINDOW_MILLIS", "50")
+	t.Setenv("RESULT_AGGREGATE_SIZE", "5")
+	recorder := &aggregateRecorder{}
+
+	_, _, err := getPipeline(invokerFunc(nil), recorder.sink)
+	var configErr *runner.ConfigError
+	if !errors.As(err, &configErr) || configErr.Name != "SINK_WINDOW_MILLIS" {
+		t.Errorf("expected a SINK_WINDOW_MILLIS config error, got %v", err)
+	}
+}
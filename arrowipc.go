@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Arrow IPC Sink
+//
+// The Arrow IPC sink writes results to a file in the Arrow IPC stream format
+// for analytical workloads that consume columnar data. The data of each result
+// must be a JSON array of objects, which is appended to the stream as a record
+// batch with a row for each object; an empty array writes nothing.
+//
+// The schema of the stream is inferred from the first result. It has a column
+// for each key of its objects, in sorted order, typed by the values of the key:
+// int64 when they are all integers, float64 for other numbers, bool, and utf8
+// for strings or when they are all null. Nested objects and arrays, and keys
+// with values of mixed kinds, are stored as JSON in utf8 columns. Every column
+// is nullable, and a key missing from an object is null. A result whose
+// objects have a key that is not in the schema, or a value that does not fit
+// the type of its column, fails.
+//
+// When ARROW_ROTATE_BYTES is set, the file is closed once it has grown to that
+// size and renamed with the time of the rotation inserted before its extension,
+// and the next result starts a new file at ARROW_IPC_PATH with the same schema.
+// A file left at ARROW_IPC_PATH by a previous run is rotated at startup, since
+// a stream cannot be appended to once it has been closed.
+
+const (
+	arrowColumnInt64   = "int64"
+	arrowColumnFloat64 = "float64"
+	arrowColumnBool    = "bool"
+	arrowColumnString  = "utf8"
+	arrowColumnJSON    = "json"
+)
+
+type arrowIPCSink struct {
+	path        string
+	rotateBytes int64
+	now         func() time.Time
+	mem         memory.Allocator
+
+	mu      sync.Mutex
+	schema  *arrow.Schema
+	kinds   []string
+	file    *os.File
+	counter *countingWriter
+	writer  *ipc.Writer
+}
+
+func newArrowIPCSink(path string, rotateBytes int64) (eventSinkTransformer, error) {
+	if path == "" {
+		return nil, configErrorf("ARROW_IPC_PATH", "ARROW_IPC_PATH is required for the arrow-ipc sink")
+	}
+
+	s := &arrowIPCSink{path: path, rotateBytes: rotateBytes, now: time.Now, mem: memory.NewGoAllocator()}
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+		if err := os.Rename(path, s.rotatedPath()); err != nil {
+			return nil, err
+		}
+	}
+	return s.write, nil
+}
+
+func (s *arrowIPCSink) write(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+	rows, err := decodeArrowRows(result.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return result, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.schema == nil {
+		s.schema, s.kinds = inferArrowSchema(rows)
+	}
+	record, err := s.buildRecord(rows)
+	if err != nil {
+		return nil, err
+	}
+	defer record.Release()
+
+	if s.writer == nil {
+		if err := s.open(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.writer.Write(record); err != nil {
+		return nil, fmt.Errorf("could not write to %s: %v", s.path, err)
+	}
+	if s.rotateBytes > 0 && s.counter.n >= s.rotateBytes {
+		if err := s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *arrowIPCSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.counter = &countingWriter{w: file}
+	s.writer = ipc.NewWriter(s.counter, ipc.WithSchema(s.schema), ipc.WithAllocator(s.mem))
+	return nil
+}
+
+// rotate closes the current file and moves it aside.
+func (s *arrowIPCSink) rotate() error {
+	err := s.writer.Close()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.writer, s.file, s.counter = nil, nil, nil
+	if err != nil {
+		return fmt.Errorf("could not close %s: %v", s.path, err)
+	}
+	return os.Rename(s.path, s.rotatedPath())
+}
+
+func (s *arrowIPCSink) rotatedPath() string {
+	ext := filepath.Ext(s.path)
+	stamp := s.now().UTC().Format("20060102T150405.000000000Z")
+	return strings.TrimSuffix(s.path, ext) + "-" + stamp + ext
+}
+
+func (s *arrowIPCSink) buildRecord(rows []map[string]interface{}) (arrow.Record, error) {
+	builder := array.NewRecordBuilder(s.mem, s.schema)
+	defer builder.Release()
+
+	for n, row := range rows {
+		for key := range row {
+			if !s.schema.HasField(key) {
+				return nil, fmt.Errorf("element %d of the result has key %s, which is not in the schema of %s", n, key, s.path)
+			}
+		}
+		for i, field := range s.schema.Fields() {
+			name := field.Name
+			if err := appendArrowValue(builder.Field(i), s.kinds[i], row[name]); err != nil {
+				return nil, fmt.Errorf("element %d of the result: key %s: %v", n, name, err)
+			}
+		}
+	}
+	return builder.NewRecord(), nil
+}
+
+// decodeArrowRows decodes a JSON array of objects, keeping numbers as
+// json.Number so that integers can be told apart from other numbers.
+func decodeArrowRows(data []byte) ([]map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var rows []map[string]interface{}
+	if err := decoder.Decode(&rows); err != nil {
+		return nil, fmt.Errorf("the result is not a JSON array of objects: %v", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("the result is not a JSON array of objects: unexpected data after the array")
+	}
+	return rows, nil
+}
+
+// inferArrowSchema returns the schema of rows and the kind of each of its
+// columns, in the same order.
+func inferArrowSchema(rows []map[string]interface{}) (*arrow.Schema, []string) {
+	kinds := make(map[string]string)
+	for _, row := range rows {
+		for key, value := range row {
+			kind := arrowColumnKind(value)
+			switch {
+			case kind == "":
+				if _, ok := kinds[key]; !ok {
+					kinds[key] = ""
+				}
+			case kinds[key] == "" || kinds[key] == kind:
+				kinds[key] = kind
+			case kinds[key] == arrowColumnInt64 && kind == arrowColumnFloat64:
+				kinds[key] = arrowColumnFloat64
+			case kinds[key] == arrowColumnFloat64 && kind == arrowColumnInt64:
+			default:
+				kinds[key] = arrowColumnJSON
+			}
+		}
+	}
+
+	names := make([]string, 0, len(kinds))
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]arrow.Field, len(names))
+	columnKinds := make([]string, len(names))
+	for i, name := range names {
+		kind := kinds[name]
+		if kind == "" {
+			kind = arrowColumnString
+		}
+		columnKinds[i] = kind
+		fields[i] = arrow.Field{Name: name, Type: arrowDataType(kind), Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil), columnKinds
+}
+
+// arrowColumnKind returns the kind of column that holds value, or an empty
+// string for null.
+func arrowColumnKind(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return arrowColumnInt64
+		}
+		return arrowColumnFloat64
+	case bool:
+		return arrowColumnBool
+	case string:
+		return arrowColumnString
+	default:
+		return arrowColumnJSON
+	}
+}
+
+func arrowDataType(kind string) arrow.DataType {
+	switch kind {
+	case arrowColumnInt64:
+		return arrow.PrimitiveTypes.Int64
+	case arrowColumnFloat64:
+		return arrow.PrimitiveTypes.Float64
+	case arrowColumnBool:
+		return arrow.FixedWidthTypes.Boolean
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+func appendArrowValue(builder array.Builder, kind string, value interface{}) error {
+	if value == nil {
+		builder.AppendNull()
+		return nil
+	}
+
+	switch kind {
+	case arrowColumnInt64:
+		if number, ok := value.(json.Number); ok {
+			if n, err := number.Int64(); err == nil {
+				builder.(*array.Int64Builder).Append(n)
+				return nil
+			}
+		}
+	case arrowColumnFloat64:
+		if number, ok := value.(json.Number); ok {
+			if f, err := number.Float64(); err == nil {
+				builder.(*array.Float64Builder).Append(f)
+				return nil
+			}
+		}
+	case arrowColumnBool:
+		if b, ok := value.(bool); ok {
+			builder.(*array.BooleanBuilder).Append(b)
+			return nil
+		}
+	case arrowColumnString:
+		if str, ok := value.(string); ok {
+			builder.(*array.StringBuilder).Append(str)
+			return nil
+		}
+	case arrowColumnJSON:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		builder.(*array.StringBuilder).Append(string(encoded))
+		return nil
+	}
+	return fmt.Errorf("%v does not fit a %s column", value, kind)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
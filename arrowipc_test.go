@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/tessellator/fnrun"
+)
+
+// readArrowIPCFile reads the Arrow IPC stream at path, calling visit, if it
+// is not nil, with each record batch. It returns the schema of the stream and
+// the number of rows of each of its record batches.
+func readArrowIPCFile(t *testing.T, path string, visit func(arrow.Record)) (*arrow.Schema, []int64) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, err := ipc.NewReader(file)
+	if err != nil {
+		t.Fatalf("expected %s to be an Arrow IPC stream: %v", path, err)
+	}
+	defer reader.Release()
+
+	var rows []int64
+	for reader.Next() {
+		record := reader.Record()
+		rows = append(rows, record.NumRows())
+		if visit != nil {
+			visit(record)
+		}
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatalf("could not read %s: %v", path, err)
+	}
+	return reader.Schema(), rows
+}
+
+func TestArrowIPCSinkWritesReadableStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.arrow")
+	sink, err := newArrowIPCSink(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		data := fmt.Sprintf(`[{"id": %d, "score": 1.5, "ok": true, "name": "n%d", "tags": ["a"]}, {"id": %d, "score": 2, "ok": false, "name": null, "tags": {"b": 1}}]`, 2*i, i, 2*i+1)
+		if _, err := sink(context.Background(), &fnrun.Result{Status: 200, Data: []byte(data)}); err != nil {
+			t.Fatalf("result %d: %v", i, err)
+		}
+	}
+	if _, err := sink(context.Background(), &fnrun.Result{Status: 200, Data: []byte(`[]`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	var first arrow.Record
+	schema, rows := readArrowIPCFile(t, path, func(record arrow.Record) {
+		column := record.Column(0).(*array.Int64)
+		for i := 0; i < column.Len(); i++ {
+			ids = append(ids, column.Value(i))
+		}
+		if first == nil {
+			first = record
+			first.Retain()
+		}
+	})
+	if first != nil {
+		defer first.Release()
+	}
+
+	want := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "ok", Type: arrow.FixedWidthTypes.Boolean, Nullable: true},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "tags", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	if !schema.Equal(want) {
+		t.Fatalf("expected the schema %v, got %v", want, schema)
+	}
+	if len(rows) != 100 {
+		t.Fatalf("expected 100 record batches, got %d", len(rows))
+	}
+	for i, n := range rows {
+		if n != 2 {
+			t.Fatalf("expected record batch %d to have 2 rows, got %d", i, n)
+		}
+	}
+	for i, id := range ids {
+		if id != int64(i) {
+			t.Fatalf("expected row %d to have id %d, got %d", i, i, id)
+		}
+	}
+
+	name := first.Column(1).(*array.String)
+	if name.Value(0) != "n0" || !name.IsNull(1) {
+		t.Errorf("expected the names n0 and null, got %v", name)
+	}
+	if score := first.Column(3).(*array.Float64); score.Value(0) != 1.5 || score.Value(1) != 2 {
+		t.Errorf("expected the scores 1.5 and 2, got %v", score)
+	}
+	if ok := first.Column(2).(*array.Boolean); !ok.Value(0) || ok.Value(1) {
+		t.Errorf("expected the flags true and false, got %v", ok)
+	}
+	if tags := first.Column(4).(*array.String); tags.Value(0) != `["a"]` || tags.Value(1) != `{"b":1}` {
+		t.Errorf("expected the tags to be stored as JSON, got %v", tags)
+	}
+}
+
+func TestArrowIPCSinkRotatesFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "results.arrow")
+	if err := ioutil.WriteFile(path, []byte("left by a previous run"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := &arrowIPCSink{path: path, rotateBytes: 1, mem: memory.NewGoAllocator(), now: func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}}
+	if err := os.Rename(path, s.rotatedPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.write(context.Background(), &fnrun.Result{Data: []byte(`[{"id": 1}, {"id": 2}]`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be rotated after each result, got %v", path, err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "results-*.arrow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("expected 4 rotated files, got %v", files)
+	}
+	if data, err := ioutil.ReadFile(files[0]); err != nil || string(data) != "left by a previous run" {
+		t.Errorf("expected the oldest file to be the previous one, got %q: %v", data, err)
+	}
+	for _, file := range files[1:] {
+		if !strings.HasPrefix(filepath.Base(file), "results-20240102T0304") {
+			t.Errorf("expected the rotation time in the name of %s", file)
+		}
+		schema, rows := readArrowIPCFile(t, file, nil)
+		if schema.NumFields() != 1 || schema.Field(0).Name != "id" {
+			t.Errorf("expected %s to have the schema of the first result, got %v", file, schema)
+		}
+		if len(rows) != 1 || rows[0] != 2 {
+			t.Errorf("expected %s to hold one record batch of 2 rows, got %v", file, rows)
+		}
+	}
+}
+
+func TestNewArrowIPCSinkRotatesExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "results.arrow")
+	if err := ioutil.WriteFile(path, []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newArrowIPCSink(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the existing file to be moved aside, got %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "results-*.arrow")); len(files) != 1 {
+		t.Errorf("expected one rotated file, got %v", files)
+	}
+}
+
+func TestArrowIPCSinkRejectsNonConformingResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"not an array", `{"id": 1}`, "not a JSON array of objects"},
+		{"trailing data", `[{"id": 1}] [{"id": 2}]`, "unexpected data after the array"},
+		{"unknown key", `[{"id": 1, "extra": true}]`, "key extra, which is not in the schema"},
+		{"wrong type", `[{"id": "one"}]`, "key id: one does not fit a int64 column"},
+		{"float in an integer column", `[{"id": 1.5}]`, "does not fit a int64 column"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, err := newArrowIPCSink(filepath.Join(t.TempDir(), "results.arrow"), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sink(context.Background(), &fnrun.Result{Data: []byte(`[{"id": 1}]`)}); err != nil {
+				t.Fatal(err)
+			}
+			_, err = sink(context.Background(), &fnrun.Result{Data: []byte(tt.data)})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewArrowIPCSinkRequiresPath(t *testing.T) {
+	_, err := newArrowIPCSink("", 0)
+	checkConfigError(t, err, "ARROW_IPC_PATH", "ARROW_IPC_PATH is required")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Delivery Attempt Envelope
+//
+// When DELIVERY_ENVELOPE is set, each result is wrapped in an envelope before
+// it is delivered to the sink so that downstream consumers can tell how many
+// times the delivery was attempted:
+//
+//	{"body": ..., "attempts": 2, "firstAttemptAt": "...", "lastAttemptAt": "...", "correlationId": "..."}
+//
+// A failed delivery is retried up to DELIVERY_RETRY_COUNT times, waiting
+// DELIVERY_RETRY_BACKOFF_MILLIS between attempts, and the envelope is rebuilt
+// for each attempt with the attempt count and time. The body is embedded as in
+// the standard envelope format, and the correlation ID is read from the
+// x-correlation-id metadata.
+
+type deliveryEnvelope struct {
+	Body           json.RawMessage `json:"body"`
+	Attempts       int             `json:"attempts"`
+	FirstAttemptAt time.Time       `json:"firstAttemptAt"`
+	LastAttemptAt  time.Time       `json:"lastAttemptAt"`
+	CorrelationID  string          `json:"correlationId,omitempty"`
+}
+
+func newDeliveryEnvelopeSink(sink eventSinkTransformer, retries int, backoff time.Duration, now func() time.Time) eventSinkTransformer {
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		body, err := runner.EnvelopeBody(result.Data)
+		if err != nil {
+			return result, err
+		}
+		envelope := deliveryEnvelope{Body: body}
+		if metadata, ok := runner.MetadataFromContext(ctx); ok {
+			envelope.CorrelationID = metadata[correlationIDKey]
+		}
+
+		for {
+			envelope.Attempts++
+			envelope.LastAttemptAt = now().UTC()
+			if envelope.Attempts == 1 {
+				envelope.FirstAttemptAt = envelope.LastAttemptAt
+			}
+			data, err := json.Marshal(envelope)
+			if err != nil {
+				return result, err
+			}
+
+			// The envelope only wraps the result for delivery, so the result
+			// itself is returned to the source.
+			_, err = sink(ctx, &fnrun.Result{Status: result.Status, Data: data, Env: result.Env})
+			if err == nil || envelope.Attempts > retries {
+				return result, err
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return result, err
+			}
+			stats.recordRetry()
+		}
+	}
+}
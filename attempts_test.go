@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// envelopeRecorder is a sink that records the delivery envelopes it receives
+// and fails the first failures of them.
+type envelopeRecorder struct {
+	failures  int
+	envelopes []deliveryEnvelope
+}
+
+func (er *envelopeRecorder) deliver(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+	var envelope deliveryEnvelope
+	if err := json.Unmarshal(result.Data, &envelope); err != nil {
+		return nil, err
+	}
+	er.envelopes = append(er.envelopes, envelope)
+	if len(er.envelopes) <= er.failures {
+		return nil, errors.New("delivery failed")
+	}
+	return &fnrun.Result{Status: 202, Data: []byte("transformed")}, nil
+}
+
+// testClock returns a clock that advances by a second each time it is read.
+func testClock() func() time.Time {
+	var ticks int64
+	start := time.Date(2024, 3, 4, 5, 6, 7, 0, time.FixedZone("CET", 3600))
+	return func() time.Time {
+		return start.Add(time.Duration(atomic.AddInt64(&ticks, 1)-1) * time.Second)
+	}
+}
+
+func TestDeliveryEnvelopeCountsAttempts(t *testing.T) {
+	s := useRunStats(t)
+	recorder := &envelopeRecorder{failures: 2}
+	sink := newDeliveryEnvelopeSink(recorder.deliver, 3, time.Millisecond, testClock())
+
+	ctx := runner.WithMetadata(context.Background(), map[string]string{correlationIDKey: "req-1"})
+	result := &fnrun.Result{Status: 200, Data: []byte(`{"total":3}`), Env: map[string]string{"a": "b"}}
+	got, err := sink(ctx, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != result {
+		t.Errorf("expected the result to be returned to the source, got %+v", got)
+	}
+
+	if len(recorder.envelopes) != 3 {
+		t.Fatalf("expected 3 delivery attempts, got %d", len(recorder.envelopes))
+	}
+	first := time.Date(2024, 3, 4, 4, 6, 7, 0, time.UTC)
+	for i, envelope := range recorder.envelopes {
+		if envelope.Attempts != i+1 {
+			t.Errorf("expected attempt %d to be counted, got %d", i+1, envelope.Attempts)
+		}
+		if !envelope.FirstAttemptAt.Equal(first) || envelope.FirstAttemptAt.Location() != time.UTC {
+			t.Errorf("expected the first attempt at %v in UTC, got %v", first, envelope.FirstAttemptAt)
+		}
+		if want := first.Add(time.Duration(i) * time.Second); !envelope.LastAttemptAt.Equal(want) {
+			t.Errorf("expected attempt %d at %v, got %v", i+1, want, envelope.LastAttemptAt)
+		}
+		if envelope.CorrelationID != "req-1" {
+			t.Errorf("expected the correlation ID req-1, got %q", envelope.CorrelationID)
+		}
+		if string(envelope.Body) != `{"total":3}` {
+			t.Errorf("expected the result data as the body, got %s", envelope.Body)
+		}
+	}
+	if s.retries != 2 {
+		t.Errorf("expected 2 retries to be recorded, got %d", s.retries)
+	}
+}
+
+func TestDeliveryEnvelopeEmbedsTheBody(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`[1,2]`, `[1,2]`},
+		{`not json`, `"not json"`},
+		{``, `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			var delivered []byte
+			sink := newDeliveryEnvelopeSink(func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+				delivered = result.Data
+				return result, nil
+			}, 0, 0, testClock())
+			if _, err := sink(context.Background(), &fnrun.Result{Data: []byte(tt.data)}); err != nil {
+				t.Fatal(err)
+			}
+
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(delivered, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if string(fields["body"]) != tt.want {
+				t.Errorf("expected the body %s, got %s", tt.want, fields["body"])
+			}
+			if _, ok := fields["correlationId"]; ok {
+				t.Errorf("expected no correlation ID without metadata, got %s", delivered)
+			}
+		})
+	}
+}
+
+func TestDeliveryEnvelopeGivesUpAfterRetries(t *testing.T) {
+	useRunStats(t)
+	recorder := &envelopeRecorder{failures: 10}
+	sink := newDeliveryEnvelopeSink(recorder.deliver, 2, time.Millisecond, testClock())
+
+	result := &fnrun.Result{Status: 200, Data: []byte(`{}`)}
+	got, err := sink(context.Background(), result)
+	if err == nil || err.Error() != "delivery failed" {
+		t.Errorf("expected the last delivery error, got %v", err)
+	}
+	if got != result {
+		t.Errorf("expected the result to be returned, got %+v", got)
+	}
+	if len(recorder.envelopes) != 3 {
+		t.Errorf("expected the delivery and 2 retries, got %d attempts", len(recorder.envelopes))
+	}
+}
+
+func TestDeliveryEnvelopeStopsRetryingWhenCancelled(t *testing.T) {
+	useRunStats(t)
+	recorder := &envelopeRecorder{failures: 10}
+	sink := newDeliveryEnvelopeSink(recorder.deliver, 5, time.Hour, testClock())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := sink(ctx, &fnrun.Result{Data: []byte(`{}`)}); err == nil {
+		t.Error("expected the delivery error")
+	}
+	if len(recorder.envelopes) != 1 {
+		t.Errorf("expected no retry after the context was cancelled, got %d attempts", len(recorder.envelopes))
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// -----------------------------------------------------------------------------
+// Baggage
+//
+// Sources may attach W3C baggage (e.g., a tenant ID or environment name) to the
+// context of an invocation. The baggage is passed to the function in the
+// BAGGAGE key of the execution context env, in the format of the W3C baggage
+// header, and each member is recorded as a baggage.<key> attribute of the sink
+// span so that it can be correlated with the delivery of the result.
+
+const baggageEnvKey = "BAGGAGE"
+
+// withBaggageEnv returns a copy of ctx whose execution context env carries the
+// baggage of ctx. Any env already on the context is preserved. The context is
+// returned unchanged if it carries no baggage.
+func withBaggageEnv(ctx context.Context) context.Context {
+	bag := baggage.FromContext(ctx)
+	if bag.Len() == 0 {
+		return ctx
+	}
+
+	return withExtraEnv(ctx, baggageEnvKey, bag.String())
+}
+
+// baggageAttributes returns a span attribute for each member of the baggage of
+// ctx.
+func baggageAttributes(ctx context.Context) []attribute.KeyValue {
+	members := baggage.FromContext(ctx).Members()
+	attrs := make([]attribute.KeyValue, 0, len(members))
+	for _, member := range members {
+		attrs = append(attrs, attribute.String("baggage."+member.Key(), member.Value()))
+	}
+	return attrs
+}
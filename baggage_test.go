@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+func contextWithBaggage(t *testing.T, ctx context.Context, header string) context.Context {
+	t.Helper()
+	bag, err := baggage.Parse(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+func TestSinkInvokerPropagatesBaggage(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var env map[string]string
+	si := &sinkInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			env, _ = fnrun.Env(ctx)
+			return &fnrun.Result{Status: 200, Data: input.Data}, nil
+		}),
+		sink: func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			return result, nil
+		},
+	}
+
+	ctx := fnrun.WithEnv(context.Background(), map[string]string{"EXISTING": "kept"})
+	ctx = contextWithBaggage(t, ctx, "tenant=acme,environment=staging")
+	if _, err := si.Invoke(ctx, &fnrun.Input{Data: []byte("x")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bag, err := baggage.Parse(env[baggageEnvKey])
+	if err != nil {
+		t.Fatalf("expected the function env to carry the baggage header, got %q: %v", env[baggageEnvKey], err)
+	}
+	if bag.Member("tenant").Value() != "acme" || bag.Member("environment").Value() != "staging" {
+		t.Errorf("expected the baggage of the context, got %q", env[baggageEnvKey])
+	}
+	if env["EXISTING"] != "kept" {
+		t.Errorf("expected the existing env to be preserved, got %v", env)
+	}
+
+	span := endedSpan(t, recorder)
+	if span.Name() != "deliver to sink" {
+		t.Fatalf("expected the sink span, got %q", span.Name())
+	}
+	attrs := spanAttributes(span)
+	if got := attrs["baggage.tenant"].AsString(); got != "acme" {
+		t.Errorf("expected baggage.tenant to be acme, got %q", got)
+	}
+	if got := attrs["baggage.environment"].AsString(); got != "staging" {
+		t.Errorf("expected baggage.environment to be staging, got %q", got)
+	}
+}
+
+func TestSinkInvokerWithoutBaggage(t *testing.T) {
+	var env map[string]string
+	si := &sinkInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		env, _ = fnrun.Env(ctx)
+		return &fnrun.Result{Status: 200}, nil
+	})}
+
+	if _, err := si.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := env[baggageEnvKey]; ok {
+		t.Errorf("expected no %s env without baggage, got %v", baggageEnvKey, env)
+	}
+}
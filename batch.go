@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// errInvalidBatchInput is returned when an input cannot be included in a batch
+// because its data is not valid JSON.
+var errInvalidBatchInput = errors.New("batched input data must be valid JSON")
+
+// -----------------------------------------------------------------------------
+// Batch Invoker
+//
+// The batch invoker groups concurrent invocations into a single invocation of
+// the underlying invoker. The data of each input in the batch becomes an
+// element of a JSON array, and the function is expected to return a JSON array
+// with one element per input. Each element of the batch is an object whose
+// data is the input data and whose env and metadata are those of its caller;
+// only the env and metadata shared by every caller are passed with the batch
+// itself. Each caller receives a result whose data is the corresponding element
+// of the function result; the status and env of the batch result are shared.
+//
+// A batch is dispatched when it is full or when maxWait has elapsed since the
+// first input was added to it. The batch is not bound to the context of any
+// one caller: it runs until the earliest deadline among its callers, and a
+// caller whose context is done fails on its own without affecting the others.
+
+type batchResponse struct {
+	result *fnrun.Result
+	err    error
+}
+
+// batchElement is an element of the batch passed to the function.
+type batchElement struct {
+	Data     json.RawMessage   `json:"data"`
+	Env      map[string]string `json:"env,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type batchRequest struct {
+	ctx      context.Context
+	input    *fnrun.Input
+	response chan batchResponse
+}
+
+type batchInvoker struct {
+	invoker    fnrun.Invoker
+	size       int
+	maxWait    time.Duration
+	mu         sync.Mutex
+	pending    []*batchRequest
+	generation uint64
+}
+
+func newBatchInvoker(invoker fnrun.Invoker, size int, maxWait time.Duration) *batchInvoker {
+	return &batchInvoker{invoker: invoker, size: size, maxWait: maxWait}
+}
+
+func (bi *batchInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	if !json.Valid(input.Data) {
+		return nil, errInvalidBatchInput
+	}
+
+	req := &batchRequest{ctx: ctx, input: input, response: make(chan batchResponse, 1)}
+
+	bi.mu.Lock()
+	bi.pending = append(bi.pending, req)
+	if len(bi.pending) == 1 {
+		generation := bi.generation
+		time.AfterFunc(bi.maxWait, func() { bi.flush(generation) })
+	}
+	var batch []*batchRequest
+	if len(bi.pending) >= bi.size {
+		batch = bi.take()
+	}
+	bi.mu.Unlock()
+
+	if batch != nil {
+		go bi.dispatch(batch)
+	}
+
+	select {
+	case response := <-req.response:
+		return response.result, response.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// take removes and returns the pending batch. The caller must hold bi.mu.
+func (bi *batchInvoker) take() []*batchRequest {
+	batch := bi.pending
+	bi.pending = nil
+	bi.generation++
+	return batch
+}
+
+// flush dispatches the pending batch if it is still the batch identified by
+// generation.
+func (bi *batchInvoker) flush(generation uint64) {
+	bi.mu.Lock()
+	if generation != bi.generation || len(bi.pending) == 0 {
+		bi.mu.Unlock()
+		return
+	}
+	batch := bi.take()
+	bi.mu.Unlock()
+
+	bi.dispatch(batch)
+}
+
+func (bi *batchInvoker) dispatch(batch []*batchRequest) {
+	// Callers that have already given up are left out of the batch.
+	live := batch[:0]
+	for _, req := range batch {
+		if req.ctx.Err() == nil {
+			live = append(live, req)
+		}
+	}
+	batch = live
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := batchContext(batch)
+	defer cancel()
+
+	elements := make([]batchElement, len(batch))
+	for i, req := range batch {
+		env, _ := fnrun.Env(req.ctx)
+		metadata, _ := runner.MetadataFromContext(req.ctx)
+		elements[i] = batchElement{Data: req.input.Data, Env: env, Metadata: metadata}
+	}
+
+	results, err := bi.invokeBatch(ctx, elements)
+	for i, req := range batch {
+		if err != nil {
+			req.response <- batchResponse{err: err}
+		} else {
+			req.response <- batchResponse{result: results[i]}
+		}
+	}
+}
+
+// batchContext returns a context for invoking batch that is detached from the
+// contexts of its callers. Its deadline is the earliest deadline among them,
+// and its env and metadata are the entries shared by all of them.
+func batchContext(batch []*batchRequest) (context.Context, context.CancelFunc) {
+	envs := make([]map[string]string, len(batch))
+	metadata := make([]map[string]string, len(batch))
+	var deadline time.Time
+	for i, req := range batch {
+		envs[i], _ = fnrun.Env(req.ctx)
+		metadata[i], _ = runner.MetadataFromContext(req.ctx)
+		if d, ok := req.ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+	}
+
+	ctx := context.Background()
+	if env := sharedEntries(envs); env != nil {
+		ctx = fnrun.WithEnv(ctx, env)
+	}
+	if shared := sharedEntries(metadata); shared != nil {
+		ctx = runner.WithMetadata(ctx, shared)
+	}
+	if deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline)
+}
+
+// sharedEntries returns the entries that have the same value in every map of
+// maps, or nil if there are none.
+func sharedEntries(maps []map[string]string) map[string]string {
+	var shared map[string]string
+	for key, value := range maps[0] {
+		found := true
+		for _, m := range maps[1:] {
+			if v, ok := m[key]; !ok || v != value {
+				found = false
+				break
+			}
+		}
+		if found {
+			if shared == nil {
+				shared = make(map[string]string)
+			}
+			shared[key] = value
+		}
+	}
+	return shared
+}
+
+func (bi *batchInvoker) invokeBatch(ctx context.Context, elements []batchElement) ([]*fnrun.Result, error) {
+	data, err := json.Marshal(elements)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := bi.invoker.Invoke(ctx, &fnrun.Input{Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	var resultElements []json.RawMessage
+	if err := json.Unmarshal(result.Data, &resultElements); err != nil {
+		return nil, fmt.Errorf("batch result is not a JSON array: %v", err)
+	}
+
+	if len(resultElements) != len(elements) {
+		return nil, fmt.Errorf("batch result has %d elements but batch has %d inputs", len(resultElements), len(elements))
+	}
+
+	results := make([]*fnrun.Result, len(resultElements))
+	for i, element := range resultElements {
+		results[i] = &fnrun.Result{Status: result.Status, Data: element, Env: result.Env}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// batchRecorder is a function that records the batches it is invoked with and
+// responds with the data of each element wrapped in an object.
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]batchElement
+}
+
+func (br *batchRecorder) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	var elements []batchElement
+	if err := json.Unmarshal(input.Data, &elements); err != nil {
+		return nil, err
+	}
+	br.mu.Lock()
+	br.batches = append(br.batches, elements)
+	br.mu.Unlock()
+
+	results := make([]map[string]json.RawMessage, len(elements))
+	for i, element := range elements {
+		results[i] = map[string]json.RawMessage{"echo": element.Data}
+	}
+	data, err := json.Marshal(results)
+	return &fnrun.Result{Status: 200, Data: data, Env: map[string]string{"batch": "true"}}, err
+}
+
+func (br *batchRecorder) batchSizes() []int {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	sizes := make([]int, len(br.batches))
+	for i, batch := range br.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+func TestBatchInvokerAssemblesFullBatchesAndSplitsResults(t *testing.T) {
+	recorder := &batchRecorder{}
+	bi := newBatchInvoker(recorder, 3, time.Hour)
+
+	var wg sync.WaitGroup
+	results := make([]*fnrun.Result, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := bi.Invoke(context.Background(), &fnrun.Input{Data: []byte(fmt.Sprint(i))})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+
+	if sizes := recorder.batchSizes(); len(sizes) != 1 || sizes[0] != 3 {
+		t.Errorf("expected a single batch of 3, got %v", sizes)
+	}
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		if want := fmt.Sprintf(`{"echo":%d}`, i); string(result.Data) != want {
+			t.Errorf("expected result %d to be %s, got %s", i, want, result.Data)
+		}
+		if result.Status != 200 || result.Env["batch"] != "true" {
+			t.Errorf("expected the status and env of the batch, got %+v", result)
+		}
+	}
+}
+
+func TestBatchInvokerFlushesPartialBatchAfterMaxWait(t *testing.T) {
+	recorder := &batchRecorder{}
+	bi := newBatchInvoker(recorder, 10, 20*time.Millisecond)
+
+	start := time.Now()
+	result, err := bi.Invoke(context.Background(), &fnrun.Input{Data: []byte(`"only"`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("expected the batch to wait for maxWait, took %v", elapsed)
+	}
+	if string(result.Data) != `{"echo":"only"}` {
+		t.Errorf("unexpected result %s", result.Data)
+	}
+	if sizes := recorder.batchSizes(); len(sizes) != 1 || sizes[0] != 1 {
+		t.Errorf("expected a single batch of 1, got %v", sizes)
+	}
+}
+
+func TestBatchInvokerRejectsInvalidJSON(t *testing.T) {
+	bi := newBatchInvoker(&batchRecorder{}, 2, time.Millisecond)
+	if _, err := bi.Invoke(context.Background(), &fnrun.Input{Data: []byte("not json")}); err != errInvalidBatchInput {
+		t.Errorf("expected errInvalidBatchInput, got %v", err)
+	}
+}
+
+func TestBatchInvokerFailsWhenResultDoesNotMatchBatch(t *testing.T) {
+	tests := map[string]string{
+		"not an array":     `{"a":1}`,
+		"wrong length":     `[1,2]`,
+		"empty result set": `[]`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			function := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+				return &fnrun.Result{Data: []byte(data)}, nil
+			})
+			bi := newBatchInvoker(function, 1, time.Hour)
+			if _, err := bi.Invoke(context.Background(), &fnrun.Input{Data: []byte("1")}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestBatchInvokerIsolatesCallersSharingABatch(t *testing.T) {
+	started := make(chan context.Context, 1)
+	release := make(chan struct{})
+	function := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		started <- ctx
+		<-release
+		return &fnrun.Result{Status: 200, Data: []byte(`["a","b"]`)}, nil
+	})
+	bi := newBatchInvoker(function, 2, time.Hour)
+
+	short, cancelShort := context.WithTimeout(context.Background(), time.Minute)
+	long, cancelLong := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelLong()
+
+	shortErr := make(chan error, 1)
+	go func() {
+		_, err := bi.Invoke(short, &fnrun.Input{Data: []byte("1")})
+		shortErr <- err
+	}()
+	// The callers are added to the batch in order, so that the short caller
+	// receives the first element of the result.
+	for {
+		bi.mu.Lock()
+		n := len(bi.pending)
+		bi.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	type response struct {
+		result *fnrun.Result
+		err    error
+	}
+	longResponse := make(chan response, 1)
+	go func() {
+		result, err := bi.Invoke(long, &fnrun.Input{Data: []byte("2")})
+		longResponse <- response{result, err}
+	}()
+
+	ctx := <-started
+	deadline, ok := ctx.Deadline()
+	if want, _ := short.Deadline(); !ok || !deadline.Equal(want) {
+		t.Errorf("expected the batch to run until the earliest deadline %v, got %v", want, deadline)
+	}
+
+	cancelShort()
+	if err := <-shortErr; err != context.Canceled {
+		t.Errorf("expected the cancelled caller to fail, got %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("expected the batch to continue after one caller was cancelled, got %v", ctx.Err())
+	}
+
+	close(release)
+	got := <-longResponse
+	if got.err != nil || string(got.result.Data) != `"b"` {
+		t.Errorf("expected the other caller to receive its result, got %+v: %v", got.result, got.err)
+	}
+}
+
+func TestBatchInvokerCarriesEnvAndMetadataPerElement(t *testing.T) {
+	recorder := &batchRecorder{}
+	var batchEnv map[string]string
+	var batchMetadata map[string]string
+	function := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		batchEnv, _ = fnrun.Env(ctx)
+		batchMetadata, _ = runner.MetadataFromContext(ctx)
+		return recorder.Invoke(ctx, input)
+	})
+	bi := newBatchInvoker(function, 2, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := fnrun.WithEnv(context.Background(), map[string]string{
+				idempotencyKeyEnvKey: fmt.Sprint("key-", i),
+				"region":             "eu",
+			})
+			ctx = runner.WithMetadata(ctx, map[string]string{"x-request": fmt.Sprint(i), "x-source": "http"})
+			if _, err := bi.Invoke(ctx, &fnrun.Input{Data: []byte(fmt.Sprint(i))}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(recorder.batches) != 1 || len(recorder.batches[0]) != 2 {
+		t.Fatalf("expected a single batch of 2, got %v", recorder.batchSizes())
+	}
+	for _, element := range recorder.batches[0] {
+		i := string(element.Data)
+		if element.Env[idempotencyKeyEnvKey] != "key-"+i || element.Metadata["x-request"] != i {
+			t.Errorf("expected the env and metadata of caller %s with its element, got %+v", i, element)
+		}
+	}
+	if len(batchEnv) != 1 || batchEnv["region"] != "eu" {
+		t.Errorf("expected only the shared env with the batch, got %v", batchEnv)
+	}
+	if len(batchMetadata) != 1 || batchMetadata["x-source"] != "http" {
+		t.Errorf("expected only the shared metadata with the batch, got %v", batchMetadata)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"container/list"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// -----------------------------------------------------------------------------
+// Caller Limiter
+//
+// The caller limiter bounds the number of concurrent requests the HTTP source
+// handles for any one caller. A caller is identified by the value of the
+// request header named by idHeader, such as a tenant ID, or by the remote IP
+// address when no header is configured or the header is absent. The limiter
+// tracks at most maxCallers callers; when a new caller would exceed that, the
+// least recently seen caller is forgotten, and its in-flight requests no longer
+// count toward its limit.
+
+type callerSlots struct {
+	caller string
+	slots  chan struct{}
+}
+
+type callerLimiter struct {
+	limit      int
+	maxCallers int
+	idHeader   string
+	mu         sync.Mutex
+	callers    map[string]*list.Element
+	lru        *list.List
+}
+
+func newCallerLimiter(limit int, maxCallers int, idHeader string) *callerLimiter {
+	if maxCallers < 1 {
+		maxCallers = 1
+	}
+
+	return &callerLimiter{
+		limit:      limit,
+		maxCallers: maxCallers,
+		idHeader:   idHeader,
+		callers:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// callerID returns the ID of the caller that sent r.
+func (cl *callerLimiter) callerID(r *http.Request) string {
+	if cl.idHeader != "" {
+		if id := r.Header.Get(cl.idHeader); id != "" {
+			return id
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// acquire takes a slot for the caller of r. It reports false without blocking
+// if the caller already has limit requests in flight; otherwise, the returned
+// function must be called to release the slot.
+func (cl *callerLimiter) acquire(r *http.Request) (func(), bool) {
+	slots := cl.slotsFor(cl.callerID(r))
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	default:
+		return nil, false
+	}
+}
+
+func (cl *callerLimiter) slotsFor(caller string) chan struct{} {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if element, ok := cl.callers[caller]; ok {
+		cl.lru.MoveToFront(element)
+		return element.Value.(*callerSlots).slots
+	}
+
+	for cl.lru.Len() >= cl.maxCallers {
+		evicted := cl.lru.Remove(cl.lru.Back()).(*callerSlots)
+		delete(cl.callers, evicted.caller)
+	}
+
+	slots := make(chan struct{}, cl.limit)
+	cl.callers[caller] = cl.lru.PushFront(&callerSlots{caller: caller, slots: slots})
+	return slots
+}
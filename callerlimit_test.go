@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func postAsTenant(t *testing.T, addr string, tenant string, body string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Tenant", tenant)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestHTTPSourceLimitsConcurrentRequestsPerCaller(t *testing.T) {
+	addr := freeAddr(t)
+	callers := newCallerLimiter(1, 10, "X-Tenant")
+	source := newHTTPSource(addr, false, time.Second, 0, 0, callers, nil, nil, nil, nil, 1, nil)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	stop := runHTTPSource(t, addr, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if string(input.Data) == "block" {
+			started <- struct{}{}
+			<-release
+		}
+		return &fnrun.Result{Status: 200}, nil
+	}))
+	defer stop()
+
+	blocked := make(chan int, 1)
+	go func() { blocked <- postAsTenant(t, addr, "a", "block") }()
+	<-started
+
+	if status := postAsTenant(t, addr, "a", "x"); status != http.StatusTooManyRequests {
+		t.Errorf("expected a request above the limit of the caller to receive 429, got %d", status)
+	}
+	if status := postAsTenant(t, addr, "b", "x"); status != http.StatusOK {
+		t.Errorf("expected another caller to be unaffected, got %d", status)
+	}
+
+	close(release)
+	if status := <-blocked; status != http.StatusOK {
+		t.Errorf("expected the request within the limit to succeed, got %d", status)
+	}
+	if status := postAsTenant(t, addr, "a", "x"); status != http.StatusOK {
+		t.Errorf("expected the caller to be admitted once its request completed, got %d", status)
+	}
+}
+
+func TestCallerLimiterIdentifiesCallers(t *testing.T) {
+	cl := newCallerLimiter(1, 10, "X-Tenant")
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if id := cl.callerID(req); id != "192.0.2.1" {
+		t.Errorf("expected the remote IP without a header, got %q", id)
+	}
+	req.Header.Set("X-Tenant", "acme")
+	if id := cl.callerID(req); id != "acme" {
+		t.Errorf("expected the tenant header, got %q", id)
+	}
+}
+
+func TestCallerLimiterForgetsTheLeastRecentlySeenCaller(t *testing.T) {
+	cl := newCallerLimiter(1, 2, "X-Tenant")
+	request := func(tenant string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("X-Tenant", tenant)
+		return req
+	}
+
+	if _, ok := cl.acquire(request("a")); !ok {
+		t.Fatal("expected the first request of a to be admitted")
+	}
+	if _, ok := cl.acquire(request("b")); !ok {
+		t.Fatal("expected the first request of b to be admitted")
+	}
+	if _, ok := cl.acquire(request("a")); ok {
+		t.Fatal("expected a to be at its limit")
+	}
+
+	// a was seen more recently than b, so c evicts b.
+	if _, ok := cl.acquire(request("c")); !ok {
+		t.Fatal("expected the first request of c to be admitted")
+	}
+	if _, ok := cl.acquire(request("a")); ok {
+		t.Error("expected a to still be tracked at its limit")
+	}
+	if _, ok := cl.acquire(request("b")); !ok {
+		t.Error("expected the in-flight request of the evicted caller b to no longer count")
+	}
+	if len(cl.callers) != 2 || cl.lru.Len() != 2 {
+		t.Errorf("expected at most 2 callers to be tracked, got %d", len(cl.callers))
+	}
+}
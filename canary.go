@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tessellator/fnrun"
+)
+
+var canaryDiscrepancies = newCounter(
+	"fnrunner_canary_discrepancies_total",
+	"Number of inputs for which the canary analysis found that the results of the two pools differ.",
+)
+
+// canaryAnalyzer compares the results of the primary and canary pools for the
+// same input and returns an error describing any discrepancy.
+type canaryAnalyzer func(ctx context.Context, primary *fnrun.Result, canary *fnrun.Result) error
+
+func getCanaryAnalyzer() (analyzer canaryAnalyzer, err error) {
+	// env: CANARY_ANALYSIS_PLUGIN_PATH string "" "Plugin containing the analysis that compares the results of the A and B pools, which are both invoked with every input when set."
+	path := os.Getenv("CANARY_ANALYSIS_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	defer tracePluginLoad("load canary analysis plugin", "CANARY_ANALYSIS_PLUGIN_PATH", "CANARY_ANALYSIS_PLUGIN_SYMBOL")(&err)
+
+	// env: CANARY_ANALYSIS_PLUGIN_SYMBOL string "" "Symbol of the canary analysis function in CANARY_ANALYSIS_PLUGIN_PATH."
+	symbolName := os.Getenv("CANARY_ANALYSIS_PLUGIN_SYMBOL")
+	if symbolName == "" {
+		return nil, configErrorf("CANARY_ANALYSIS_PLUGIN_SYMBOL", "CANARY_ANALYSIS_PLUGIN_SYMBOL is required when a CANARY_ANALYSIS_PLUGIN_PATH is provided")
+	}
+
+	symAnalyzer, err := lookupPluginSymbol(path, symbolName)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := symAnalyzer.(func(context.Context, *fnrun.Result, *fnrun.Result) error)
+	if !ok {
+		return nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
+	}
+
+	return fn, nil
+}
+
+// -----------------------------------------------------------------------------
+// Canary Router
+//
+// The canary router replaces the weighted router when a canary analysis plugin
+// is provided. Instead of splitting traffic, it invokes both pools with every
+// input at the same time and passes the two results to the analysis plugin.
+// The A pool is the primary: its result and error are returned, so only the
+// primary result is delivered to the sink, and the canary result is discarded
+// after the analysis. TRAFFIC_WEIGHT_B is ignored.
+//
+// A discrepancy reported by the plugin is logged as a warning together with the
+// fields in which the two results differ. A failed canary invocation is also
+// logged, and no analysis is made if either invocation failed.
+
+type canaryRouter struct {
+	*weightedRouter
+	analyzer canaryAnalyzer
+}
+
+func newCanaryRouter(primary closableInvoker, canary closableInvoker, analyzer canaryAnalyzer) *canaryRouter {
+	return &canaryRouter{
+		weightedRouter: newWeightedRouter(primary, canary, 0),
+		analyzer:       analyzer,
+	}
+}
+
+// capacity returns the capacity of the smaller pool, since every input is sent
+// to both pools.
+func (cr *canaryRouter) capacity() (slots int, prioritySlots int) {
+	slotsA, prioritySlotsA := totalCapacity(cr.a)
+	slotsB, prioritySlotsB := totalCapacity(cr.b)
+	if slotsB < slotsA {
+		slotsA = slotsB
+	}
+	if prioritySlotsB < prioritySlotsA {
+		prioritySlotsA = prioritySlotsB
+	}
+	return slotsA, prioritySlotsA
+}
+
+func (cr *canaryRouter) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	var canaryResult *fnrun.Result
+	var canaryErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		canaryResult, canaryErr = cr.b.Invoke(ctx, input)
+	}()
+
+	result, err := cr.a.Invoke(ctx, input)
+	wg.Wait()
+
+	if canaryErr != nil {
+		log.Printf("WARNING: canary invocation failed: %v", canaryErr)
+	}
+	if err != nil || canaryErr != nil || result == nil || canaryResult == nil {
+		return result, err
+	}
+
+	if analysisErr := cr.analyzer(ctx, result, canaryResult); analysisErr != nil {
+		canaryDiscrepancies.inc()
+		log.Printf("WARNING: canary result differs from primary result: %v\n%s", analysisErr, diffResults(result, canaryResult))
+	}
+
+	return result, err
+}
+
+// diffResults describes the fields in which the primary and canary results
+// differ, one per line.
+func diffResults(primary *fnrun.Result, canary *fnrun.Result) string {
+	var lines []string
+	if primary.Status != canary.Status {
+		lines = append(lines, fmt.Sprintf("status: primary=%d canary=%d", primary.Status, canary.Status))
+	}
+	if string(primary.Data) != string(canary.Data) {
+		lines = append(lines, fmt.Sprintf("data: primary=%q canary=%q", primary.Data, canary.Data))
+	}
+
+	keys := make(map[string]struct{}, len(primary.Env)+len(canary.Env))
+	for k := range primary.Env {
+		keys[k] = struct{}{}
+	}
+	for k := range canary.Env {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		primaryValue, inPrimary := primary.Env[k]
+		canaryValue, inCanary := canary.Env[k]
+		switch {
+		case !inPrimary:
+			lines = append(lines, fmt.Sprintf("env %s: primary=<unset> canary=%q", k, canaryValue))
+		case !inCanary:
+			lines = append(lines, fmt.Sprintf("env %s: primary=%q canary=<unset>", k, primaryValue))
+		case primaryValue != canaryValue:
+			lines = append(lines, fmt.Sprintf("env %s: primary=%q canary=%q", k, primaryValue, canaryValue))
+		}
+	}
+
+	if len(lines) == 0 {
+		return "results are identical"
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// resultInvoker is a closableInvoker that returns a copy of its result, or
+// its error.
+type resultInvoker struct {
+	result fnrun.Result
+	err    error
+}
+
+func (ri *resultInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	if ri.err != nil {
+		return nil, ri.err
+	}
+	result := ri.result
+	return &result, nil
+}
+
+func (ri *resultInvoker) Close() error {
+	return nil
+}
+
+// captureLog redirects the standard logger to the returned buffer for the
+// duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &out
+}
+
+// loadCompareAnalyzer loads the Compare analysis of the test plugin.
+func loadCompareAnalyzer(t *testing.T) canaryAnalyzer {
+	t.Helper()
+	t.Setenv("CANARY_ANALYSIS_PLUGIN_PATH", buildTestPlugin(t, "source"))
+	t.Setenv("CANARY_ANALYSIS_PLUGIN_SYMBOL", "Compare")
+	analyzer, err := getCanaryAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return analyzer
+}
+
+func TestCanaryRouterLogsDiscrepancies(t *testing.T) {
+	analyzer := loadCompareAnalyzer(t)
+	primary := &resultInvoker{result: fnrun.Result{Status: 200, Data: []byte("v1"), Env: map[string]string{"x-version": "1"}}}
+	canary := &resultInvoker{result: fnrun.Result{Status: 500, Data: []byte("v2")}}
+	router := newCanaryRouter(primary, canary, analyzer)
+	logs := captureLog(t)
+	before := atomic.LoadUint64(&canaryDiscrepancies.value)
+
+	result, err := router.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != 200 || string(result.Data) != "v1" {
+		t.Errorf("expected the primary result, got %d %q", result.Status, result.Data)
+	}
+
+	for _, want := range []string{
+		"WARNING: canary result differs from primary result: results differ",
+		"status: primary=200 canary=500",
+		`data: primary="v1" canary="v2"`,
+		`env x-version: primary="1" canary=<unset>`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected the log to contain %q, got %q", want, logs.String())
+		}
+	}
+	if n := atomic.LoadUint64(&canaryDiscrepancies.value) - before; n != 1 {
+		t.Errorf("expected 1 discrepancy to be counted, got %d", n)
+	}
+}
+
+func TestCanaryRouterLogsNothingForEquivalentResults(t *testing.T) {
+	analyzer := loadCompareAnalyzer(t)
+	primary := &resultInvoker{result: fnrun.Result{Status: 200, Data: []byte("same")}}
+	canary := &resultInvoker{result: fnrun.Result{Status: 200, Data: []byte("same")}}
+	router := newCanaryRouter(primary, canary, analyzer)
+	logs := captureLog(t)
+
+	if _, err := router.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("expected nothing to be logged, got %q", logs.String())
+	}
+}
+
+func TestCanaryRouterSkipsTheAnalysisWhenTheCanaryFails(t *testing.T) {
+	analyzed := false
+	analyzer := func(ctx context.Context, primary *fnrun.Result, canary *fnrun.Result) error {
+		analyzed = true
+		return nil
+	}
+	primary := &resultInvoker{result: fnrun.Result{Status: 200}}
+	canary := &resultInvoker{err: errors.New("crashed")}
+	router := newCanaryRouter(primary, canary, analyzer)
+	logs := captureLog(t)
+
+	result, err := router.Invoke(context.Background(), &fnrun.Input{})
+	if err != nil || result.Status != 200 {
+		t.Errorf("expected the primary result, got %v, %v", result, err)
+	}
+	if analyzed {
+		t.Error("expected no analysis without a canary result")
+	}
+	if !strings.Contains(logs.String(), "canary invocation failed: crashed") {
+		t.Errorf("expected the canary failure to be logged, got %q", logs.String())
+	}
+}
+
+func TestCanaryAnalyzerRequiresASymbol(t *testing.T) {
+	t.Setenv("CANARY_ANALYSIS_PLUGIN_PATH", "analysis.so")
+	t.Setenv("CANARY_ANALYSIS_PLUGIN_SYMBOL", "")
+	_, err := getCanaryAnalyzer()
+	var configErr *runner.ConfigError
+	if !errors.As(err, &configErr) || configErr.Name != "CANARY_ANALYSIS_PLUGIN_SYMBOL" {
+		t.Errorf("expected a CANARY_ANALYSIS_PLUGIN_SYMBOL config error, got %v", err)
+	}
+}
+
+func TestDiffResultsOfIdenticalResults(t *testing.T) {
+	result := &fnrun.Result{Status: 200, Data: []byte("x"), Env: map[string]string{"k": "v"}}
+	if diff := diffResults(result, result); diff != "results are identical" {
+		t.Errorf("expected identical results, got %q", diff)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// correlationIDHeader is the HTTP header that carries the correlation ID of an
+// event between runners.
+const correlationIDHeader = "X-Correlation-ID"
+
+// -----------------------------------------------------------------------------
+// Chained Runner Sink
+//
+// The chained runner sink forwards each result to the HTTP source of another
+// runner, so that the output of one function becomes the input of the next
+// without changing either function. The data of the result is posted as the
+// request body, along with the correlation ID of the event, if any, in the
+// X-Correlation-ID header. A response with a status other than 2xx fails the
+// delivery.
+
+func newChainedRunnerSink(url string, timeout time.Duration) eventSinkTransformer {
+	client := &http.Client{Timeout: timeout}
+
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(result.Data))
+		if err != nil {
+			return result, err
+		}
+		if metadata, ok := runner.MetadataFromContext(ctx); ok && metadata[correlationIDKey] != "" {
+			req.Header.Set(correlationIDHeader, metadata[correlationIDKey])
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return result, err
+		}
+		defer resp.Body.Close()
+		io.Copy(ioutil.Discard, resp.Body)
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return result, fmt.Errorf("chained runner responded with status %d", resp.StatusCode)
+		}
+		return result, nil
+	}
+}
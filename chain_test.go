@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// forwardedRequest is a request received by a simulated downstream runner.
+type forwardedRequest struct {
+	method        string
+	body          string
+	correlationID string
+}
+
+// downstreamRunner records the requests that it receives and responds to each
+// with status.
+type downstreamRunner struct {
+	mu       sync.Mutex
+	status   int
+	requests []forwardedRequest
+}
+
+func (d *downstreamRunner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requests = append(d.requests, forwardedRequest{r.Method, string(body), r.Header.Get(correlationIDHeader)})
+	w.WriteHeader(d.status)
+}
+
+func TestChainedRunnerSinkForwardsResults(t *testing.T) {
+	downstream := &downstreamRunner{status: http.StatusOK}
+	server := httptest.NewServer(downstream)
+	defer server.Close()
+	sink := newChainedRunnerSink(server.URL, time.Second)
+
+	ctx := runner.WithMetadata(context.Background(), map[string]string{correlationIDKey: "abc-123"})
+	result := &fnrun.Result{Status: 200, Data: []byte(`{"stage": 1}`)}
+	returned, err := sink(ctx, result)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if returned != result {
+		t.Error("expected the result to be returned unchanged")
+	}
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("second")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []forwardedRequest{
+		{http.MethodPost, `{"stage": 1}`, "abc-123"},
+		{http.MethodPost, "second", ""},
+	}
+	if len(downstream.requests) != len(want) {
+		t.Fatalf("expected %d forwarded requests, got %v", len(want), downstream.requests)
+	}
+	for i := range want {
+		if downstream.requests[i] != want[i] {
+			t.Errorf("expected request %d to be %+v, got %+v", i, want[i], downstream.requests[i])
+		}
+	}
+}
+
+func TestChainedRunnerSinkFailsOnErrorResponses(t *testing.T) {
+	server := httptest.NewServer(&downstreamRunner{status: http.StatusServiceUnavailable})
+	defer server.Close()
+
+	_, err := newChainedRunnerSink(server.URL, time.Second)(context.Background(), &fnrun.Result{Data: []byte("x")})
+	if err == nil {
+		t.Fatal("expected a non-2xx response to fail the delivery")
+	}
+}
+
+func TestChainedRunnerSinkTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := newChainedRunnerSink(server.URL, 100*time.Millisecond)(context.Background(), &fnrun.Result{Data: []byte("x")})
+	if err == nil {
+		t.Fatal("expected the delivery to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the delivery to time out after about 100ms, took %v", elapsed)
+	}
+}
+
+func TestChainedRunnerKeepsTheCorrelationID(t *testing.T) {
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 0, 0, nil, nil, nil, nil, nil, 1, nil)
+	received := make(chan string, 1)
+	stop := runHTTPSource(t, addr, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		metadata, _ := runner.MetadataFromContext(ctx)
+		received <- metadata[correlationIDKey] + ":" + string(input.Data)
+		return &fnrun.Result{Status: 200}, nil
+	}))
+	defer stop()
+
+	ctx := runner.WithMetadata(context.Background(), map[string]string{correlationIDKey: "abc-123"})
+	if _, err := newChainedRunnerSink("http://"+addr+"/", time.Second)(ctx, &fnrun.Result{Data: []byte("stage 1 output")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := <-received; got != "abc-123:stage 1 output" {
+		t.Errorf("expected the downstream runner to be invoked with the output and correlation ID, got %q", got)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Chaos Invoker
+//
+// The chaos invoker injects faults in front of the function for resilience
+// testing. Before each invocation it waits for a random delay of up to
+// maxDelay and fails the invocation with runner.ErrChaosInjected with the
+// probability errorRate; otherwise the invocation proceeds as usual.
+//
+// Faults are drawn from a single random source, so a given seed always
+// produces the same sequence of faults. The sequence is assigned to
+// invocations in the order they arrive, which is only reproducible when the
+// source invokes one event at a time.
+
+type chaosInvoker struct {
+	invoker   fnrun.Invoker
+	errorRate float64
+	maxDelay  time.Duration
+	mu        sync.Mutex
+	rand      *rand.Rand
+}
+
+func newChaosInvoker(invoker fnrun.Invoker, errorRate float64, maxDelay time.Duration, seed int64) *chaosInvoker {
+	return &chaosInvoker{
+		invoker:   invoker,
+		errorRate: errorRate,
+		maxDelay:  maxDelay,
+		rand:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// next returns the delay and whether to fail the next invocation.
+func (ci *chaosInvoker) next() (time.Duration, bool) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	var delay time.Duration
+	if ci.maxDelay > 0 {
+		delay = time.Duration(ci.rand.Int63n(int64(ci.maxDelay) + 1))
+	}
+	return delay, ci.rand.Float64() < ci.errorRate
+}
+
+func (ci *chaosInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	delay, fail := ci.next()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	if fail {
+		return nil, runner.ErrChaosInjected
+	}
+	return ci.invoker.Invoke(ctx, input)
+}
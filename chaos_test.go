@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// chaosOutcomes invokes a chaos invoker with the given settings count times
+// and reports which invocations failed with an injected error.
+func chaosOutcomes(t *testing.T, errorRate float64, seed int64, count int) []bool {
+	t.Helper()
+	calls := 0
+	invoker := newChaosInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		calls++
+		return &fnrun.Result{Status: 200}, nil
+	}), errorRate, 0, seed)
+
+	failed := make([]bool, count)
+	injected := 0
+	for i := range failed {
+		_, err := invoker.Invoke(context.Background(), &fnrun.Input{})
+		if err != nil && !errors.Is(err, runner.ErrChaosInjected) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		failed[i] = err != nil
+		if failed[i] {
+			injected++
+		}
+	}
+	if calls != count-injected {
+		t.Errorf("expected the function to be invoked %d times, got %d", count-injected, calls)
+	}
+	return failed
+}
+
+func countTrue(values []bool) int {
+	count := 0
+	for _, v := range values {
+		if v {
+			count++
+		}
+	}
+	return count
+}
+
+func TestChaosInvokerInjectsErrorsAtTheErrorRate(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		if injected := countTrue(chaosOutcomes(t, 0.5, seed, 100)); injected < 35 || injected > 65 {
+			t.Errorf("expected about 50 errors with seed %d, got %d", seed, injected)
+		}
+	}
+
+	if injected := countTrue(chaosOutcomes(t, 0, 1, 100)); injected != 0 {
+		t.Errorf("expected no errors at a rate of 0, got %d", injected)
+	}
+	if injected := countTrue(chaosOutcomes(t, 1, 1, 100)); injected != 100 {
+		t.Errorf("expected every invocation to fail at a rate of 1, got %d", injected)
+	}
+}
+
+func TestChaosInvokerIsDeterministicForASeed(t *testing.T) {
+	first := chaosOutcomes(t, 0.5, 7, 100)
+	if second := chaosOutcomes(t, 0.5, 7, 100); !reflect.DeepEqual(first, second) {
+		t.Error("expected the same seed to inject the same errors")
+	}
+	if other := chaosOutcomes(t, 0.5, 8, 100); reflect.DeepEqual(first, other) {
+		t.Error("expected another seed to inject different errors")
+	}
+}
+
+func TestChaosInvokerDelaysInvocations(t *testing.T) {
+	maxDelay := 20 * time.Millisecond
+	invoker := newChaosInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 200}, nil
+	}), 0, maxDelay, 3)
+
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		if _, err := invoker.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// The delays are uniform in [0, maxDelay], so 20 of them average about
+	// 10 times maxDelay.
+	elapsed := time.Since(start)
+	if elapsed < 4*maxDelay || elapsed > 20*maxDelay+time.Second {
+		t.Errorf("expected the invocations to be delayed by about %v in total, took %v", 10*maxDelay, elapsed)
+	}
+}
+
+func TestChaosInvokerStopsDelayingWhenCancelled(t *testing.T) {
+	invoker := newChaosInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		t.Error("expected the function not to be invoked")
+		return nil, nil
+	}), 0, time.Hour, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := invoker.Invoke(ctx, &fnrun.Input{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func getCheckpointStore() (runner.CheckpointStore, error) {
+	// env: CHECKPOINT_PLUGIN_PATH string "" "Plugin containing the checkpoint store used by checkpointing sources."
+	path := os.Getenv("CHECKPOINT_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil
+	}
+
+	// env: CHECKPOINT_PLUGIN_SYMBOL string "" "Symbol of the checkpoint store in CHECKPOINT_PLUGIN_PATH."
+	symbolName := os.Getenv("CHECKPOINT_PLUGIN_SYMBOL")
+	if symbolName == "" {
+		return nil, configErrorf("CHECKPOINT_PLUGIN_SYMBOL", "CHECKPOINT_PLUGIN_SYMBOL is required when a CHECKPOINT_PLUGIN_PATH is provided")
+	}
+
+	symStore, err := lookupPluginSymbol(path, symbolName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch store := symStore.(type) {
+	case runner.CheckpointStore:
+		return store, nil
+	case *runner.CheckpointStore:
+		return *store, nil
+	default:
+		return nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Checkpointer
+//
+// The checkpointer periodically saves the latest checkpoint reported by the
+// source. A final save is performed when the checkpointer is stopped so that
+// progress made after the last tick is not lost.
+
+type checkpointer struct {
+	store       runner.CheckpointStore
+	checkpoint  *runner.Checkpoint
+	interval    time.Duration
+	savedAt     uint64
+	stopChan    chan struct{}
+	stoppedChan chan struct{}
+}
+
+func newCheckpointer(store runner.CheckpointStore, checkpoint *runner.Checkpoint, interval time.Duration) *checkpointer {
+	return &checkpointer{
+		store:       store,
+		checkpoint:  checkpoint,
+		interval:    interval,
+		stopChan:    make(chan struct{}),
+		stoppedChan: make(chan struct{}),
+	}
+}
+
+func (c *checkpointer) run() {
+	defer close(c.stoppedChan)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.save()
+		case <-c.stopChan:
+			c.save()
+			return
+		}
+	}
+}
+
+func (c *checkpointer) stop() {
+	close(c.stopChan)
+	<-c.stoppedChan
+}
+
+func (c *checkpointer) save() {
+	version := c.checkpoint.Version()
+	if version == c.savedAt {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+	defer cancel()
+
+	if err := c.store.Save(ctx, c.checkpoint.Data()); err != nil {
+		log.Printf("could not save checkpoint: %v", err)
+		return
+	}
+	c.savedAt = version
+}
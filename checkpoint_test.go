@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// memoryCheckpointStore is a runner.CheckpointStore that keeps the checkpoint
+// in memory.
+type memoryCheckpointStore struct {
+	mu    sync.Mutex
+	data  []byte
+	saves int
+}
+
+func (s *memoryCheckpointStore) Save(ctx context.Context, checkpoint []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = append([]byte(nil), checkpoint...)
+	s.saves++
+	return nil
+}
+
+func (s *memoryCheckpointStore) Load(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data, nil
+}
+
+func (s *memoryCheckpointStore) saveCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
+
+func TestCheckpointSaveLoadCycle(t *testing.T) {
+	store := &memoryCheckpointStore{}
+
+	// The first run of a source starts without a checkpoint and records its
+	// progress.
+	data, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := runner.WithCheckpoint(context.Background(), runner.NewCheckpoint(data))
+	checkpoint, ok := runner.CheckpointFromContext(ctx)
+	if !ok {
+		t.Fatal("expected the checkpoint to be in the context")
+	}
+	if checkpoint.Data() != nil {
+		t.Errorf("expected no initial checkpoint, got %q", checkpoint.Data())
+	}
+
+	c := newCheckpointer(store, checkpoint, time.Hour)
+	go c.run()
+	checkpoint.Set([]byte("offset=1"))
+	checkpoint.Set([]byte("offset=2"))
+	c.stop()
+
+	// The next run resumes from the last checkpoint.
+	data, err = store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(runner.NewCheckpoint(data).Data()) != "offset=2" {
+		t.Errorf("expected to resume from offset=2, got %q", data)
+	}
+}
+
+func TestCheckpointerSavesPeriodically(t *testing.T) {
+	store := &memoryCheckpointStore{}
+	checkpoint := runner.NewCheckpoint(nil)
+	c := newCheckpointer(store, checkpoint, 10*time.Millisecond)
+	go c.run()
+	defer c.stop()
+
+	checkpoint.Set([]byte("offset=1"))
+	deadline := time.Now().Add(5 * time.Second)
+	for store.saveCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if data, _ := store.Load(context.Background()); string(data) != "offset=1" {
+		t.Errorf("expected offset=1 to be saved, got %q", data)
+	}
+}
+
+func TestCheckpointerSkipsUnchangedCheckpoints(t *testing.T) {
+	store := &memoryCheckpointStore{}
+	checkpoint := runner.NewCheckpoint([]byte("offset=1"))
+	c := newCheckpointer(store, checkpoint, time.Millisecond)
+	go c.run()
+	time.Sleep(20 * time.Millisecond)
+	c.stop()
+
+	if saves := store.saveCount(); saves != 0 {
+		t.Errorf("expected no saves without progress, got %d", saves)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/tessellator/fnrun"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	lz4Magic  = []byte{0x04, 0x22, 0x4d, 0x18}
+)
+
+// detectCompression returns the compression format of data based on its magic
+// bytes, or an empty string if it is not recognized.
+func detectCompression(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(data, zstdMagic):
+		return "zstd"
+	case bytes.HasPrefix(data, lz4Magic):
+		return "lz4"
+	default:
+		return ""
+	}
+}
+
+func decompress(format string, data []byte) ([]byte, error) {
+	var r io.Reader
+	switch format {
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case "lz4":
+		r = lz4.NewReader(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("Unknown compression format %s", format)
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+// -----------------------------------------------------------------------------
+// Decompression Invoker
+//
+// The decompression invoker decompresses input data before passing it to the
+// underlying invoker. When the format is "auto", the format of each input is
+// detected from its magic bytes, and inputs in an unrecognized format are
+// passed through unchanged.
+
+type decompressionInvoker struct {
+	invoker fnrun.Invoker
+	format  string
+}
+
+func newDecompressionInvoker(invoker fnrun.Invoker, format string) (*decompressionInvoker, error) {
+	switch format {
+	case "auto", "gzip", "zstd", "lz4":
+		return &decompressionInvoker{invoker: invoker, format: format}, nil
+	default:
+		return nil, configErrorf("INPUT_COMPRESSION", "Unknown INPUT_COMPRESSION %s", format)
+	}
+}
+
+func (di *decompressionInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	format := di.format
+	if format == "auto" {
+		format = detectCompression(input.Data)
+		if format == "" {
+			return di.invoker.Invoke(ctx, input)
+		}
+	}
+
+	data, err := decompress(format, input.Data)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress input: %v", err)
+	}
+
+	return di.invoker.Invoke(ctx, &fnrun.Input{Data: data})
+}
+
+// compressingSink returns a sink that gzip-compresses result data at the given
+// level before passing the result to sink. The result returned to the source is
+// not affected.
+func compressingSink(sink eventSinkTransformer, level int) (eventSinkTransformer, error) {
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		return nil, configErrorf("OUTPUT_COMPRESSION_LEVEL", "OUTPUT_COMPRESSION_LEVEL must be between %d and %d", gzip.BestSpeed, gzip.BestCompression)
+	}
+
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		var buf bytes.Buffer
+		gw, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := gw.Write(result.Data); err != nil {
+			return nil, err
+		}
+		if err := gw.Close(); err != nil {
+			return nil, err
+		}
+
+		compressed := *result
+		compressed.Data = buf.Bytes()
+		if _, err := sink(ctx, &compressed); err != nil {
+			return result, err
+		}
+		return result, nil
+	}, nil
+}
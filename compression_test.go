@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/tessellator/fnrun"
+)
+
+const compressionTestPayload = `{"message":"hello, compressed world"}`
+
+func compressTestPayload(t *testing.T, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	switch format {
+	case "gzip":
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(compressionTestPayload))
+		w.Close()
+	case "zstd":
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(compressionTestPayload))
+		w.Close()
+	case "lz4":
+		w := lz4.NewWriter(&buf)
+		w.Write([]byte(compressionTestPayload))
+		w.Close()
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressionInvokerDecompressesInputs(t *testing.T) {
+	tests := []struct {
+		format     string
+		compressed string
+	}{
+		{"gzip", "gzip"},
+		{"zstd", "zstd"},
+		{"lz4", "lz4"},
+		{"auto", "gzip"},
+		{"auto", "zstd"},
+		{"auto", "lz4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.compressed, func(t *testing.T) {
+			var received []byte
+			di, err := newDecompressionInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+				received = input.Data
+				return &fnrun.Result{}, nil
+			}), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := di.Invoke(context.Background(), &fnrun.Input{Data: compressTestPayload(t, tt.compressed)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(received) != compressionTestPayload {
+				t.Errorf("expected the function to receive %q, got %q", compressionTestPayload, received)
+			}
+		})
+	}
+}
+
+func TestDecompressionInvokerPassesThroughUnrecognizedInputsInAutoMode(t *testing.T) {
+	di, err := newDecompressionInvoker(echoInvoker{}, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := di.Invoke(context.Background(), &fnrun.Input{Data: []byte(compressionTestPayload)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(result.Data) != compressionTestPayload {
+		t.Errorf("expected the input to be passed through, got %q", result.Data)
+	}
+}
+
+func TestDecompressionInvokerRejectsInvalidInputs(t *testing.T) {
+	di, err := newDecompressionInvoker(echoInvoker{}, "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := di.Invoke(context.Background(), &fnrun.Input{Data: []byte("plain")}); err == nil {
+		t.Error("expected an error for an input that is not gzip-compressed")
+	}
+
+	if _, err := newDecompressionInvoker(echoInvoker{}, "brotli"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestCompressingSinkDeliversGzipCompressedResults(t *testing.T) {
+	var delivered []byte
+	sink, err := compressingSink(func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		delivered = result.Data
+		return result, nil
+	}, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := &fnrun.Result{Status: 200, Data: []byte(compressionTestPayload)}
+	returned, err := sink(context.Background(), original)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(returned.Data) != compressionTestPayload {
+		t.Errorf("expected the result returned to the source to be unchanged, got %q", returned.Data)
+	}
+
+	if detectCompression(delivered) != "gzip" {
+		t.Fatalf("expected the sink to receive gzip data, got %q", delivered)
+	}
+	decompressed, err := decompress("gzip", delivered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decompressed) != compressionTestPayload {
+		t.Errorf("expected %q after decompression, got %q", compressionTestPayload, decompressed)
+	}
+}
+
+func TestCompressingSinkRejectsInvalidLevels(t *testing.T) {
+	discardSink := func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		return result, nil
+	}
+	for _, level := range []int{0, 10} {
+		if _, err := compressingSink(discardSink, level); err == nil {
+			t.Errorf("expected an error for level %d", level)
+		}
+	}
+}
+
+func TestOutputCompressionOnlySupportsGzip(t *testing.T) {
+	t.Setenv("OUTPUT_COMPRESSION", "zstd")
+	sink := func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		return result, nil
+	}
+	if _, _, err := getPipeline(echoInvoker{}, sink); err == nil {
+		t.Error("expected an error for an unsupported OUTPUT_COMPRESSION")
+	}
+}
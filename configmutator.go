@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Config Mutator
+//
+// Some deployment environments, such as service meshes and sidecar injectors,
+// need to adjust the configuration of the runner without changing its
+// environment. CONFIG_MUTATOR_PLUGIN_PATH names a plugin exporting a function
+// of type func(*runner.RunConfig) (*runner.RunConfig, error), which is passed
+// the configuration once secret references have been resolved and plugins
+// discovered, and before any pool, source, sink or other plugin is created.
+//
+// The configuration it returns is written back to the environment, from which
+// the runner reads its settings as usual, and the names of the variables it
+// changed are logged. A mutator that fails prevents the runner from starting.
+
+type runConfigField struct {
+	name         string
+	defaultValue int
+	intValue     func(*runner.RunConfig) *int
+	stringValue  func(*runner.RunConfig) *string
+}
+
+var runConfigFields = []runConfigField{
+	{name: "MAX_FUNCTION_COUNT", defaultValue: 8, intValue: func(c *runner.RunConfig) *int { return &c.MaxFunctionCount }},
+	{name: "MAX_WAIT_MILLIS", defaultValue: 500, intValue: func(c *runner.RunConfig) *int { return &c.MaxWaitMillis }},
+	{name: "MAX_EXEC_MILLIS", defaultValue: 30000, intValue: func(c *runner.RunConfig) *int { return &c.MaxExecMillis }},
+	{name: "FUNCTION_COMMAND", stringValue: func(c *runner.RunConfig) *string { return &c.FunctionCommand }},
+	{name: "SOURCE_TYPE", stringValue: func(c *runner.RunConfig) *string { return &c.SourceType }},
+	{name: "SINK_TYPE", stringValue: func(c *runner.RunConfig) *string { return &c.SinkType }},
+}
+
+// applyConfigMutator runs the config mutator plugin, if one is configured, and
+// applies the configuration it returns.
+func applyConfigMutator() (err error) {
+	// env: CONFIG_MUTATOR_PLUGIN_PATH string "" "Plugin containing a function that modifies the configuration of the runner before it starts."
+	path := os.Getenv("CONFIG_MUTATOR_PLUGIN_PATH")
+	if path == "" {
+		return nil
+	}
+	defer tracePluginLoad("load config mutator plugin", "CONFIG_MUTATOR_PLUGIN_PATH", "CONFIG_MUTATOR_PLUGIN_SYMBOL")(&err)
+
+	// env: CONFIG_MUTATOR_PLUGIN_SYMBOL string "" "Symbol of the config mutator in CONFIG_MUTATOR_PLUGIN_PATH."
+	symbolName := os.Getenv("CONFIG_MUTATOR_PLUGIN_SYMBOL")
+	if symbolName == "" {
+		return configErrorf("CONFIG_MUTATOR_PLUGIN_SYMBOL", "CONFIG_MUTATOR_PLUGIN_SYMBOL is required when a CONFIG_MUTATOR_PLUGIN_PATH is provided")
+	}
+
+	symMutator, err := lookupPluginSymbol(path, symbolName)
+	if err != nil {
+		return err
+	}
+	mutate, ok := symMutator.(func(*runner.RunConfig) (*runner.RunConfig, error))
+	if !ok {
+		return pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
+	}
+
+	return mutateRunConfig(symbolName, mutate)
+}
+
+// mutateRunConfig passes the configuration held by the environment to the
+// mutator named name and applies the configuration it returns.
+func mutateRunConfig(name string, mutate func(*runner.RunConfig) (*runner.RunConfig, error)) error {
+	original, err := readRunConfig()
+	if err != nil {
+		return err
+	}
+	config, err := readRunConfig()
+	if err != nil {
+		return err
+	}
+	mutated, err := mutate(config)
+	if err != nil {
+		return fmt.Errorf("config mutator %s failed: %w", name, err)
+	}
+	if mutated == nil {
+		return fmt.Errorf("config mutator %s returned no configuration", name)
+	}
+
+	changed, err := writeRunConfig(original, mutated)
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		log.Printf("config mutator %s changed %s", name, strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// readRunConfig returns the configuration held by the environment.
+func readRunConfig() (*runner.RunConfig, error) {
+	config := &runner.RunConfig{Env: make(map[string]string)}
+	for _, kv := range os.Environ() {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			config.Env[parts[0]] = parts[1]
+		}
+	}
+
+	for _, field := range runConfigFields {
+		value := config.Env[field.name]
+		if field.stringValue != nil {
+			*field.stringValue(config) = value
+			continue
+		}
+		n := field.defaultValue
+		if value != "" {
+			var err error
+			if n, err = strconv.Atoi(value); err != nil {
+				return nil, configErrorf(field.name, "Invalid %s: %v", field.name, err)
+			}
+		}
+		*field.intValue(config) = n
+	}
+	return config, nil
+}
+
+// writeRunConfig writes the differences between the original and mutated
+// configurations to the environment and returns the names of the variables
+// that changed.
+func writeRunConfig(original *runner.RunConfig, mutated *runner.RunConfig) ([]string, error) {
+	values := make(map[string]string, len(mutated.Env))
+	for name, value := range mutated.Env {
+		values[name] = value
+	}
+	// The fields take precedence over Env.
+	for _, field := range runConfigFields {
+		var before, after string
+		if field.stringValue != nil {
+			before, after = *field.stringValue(original), *field.stringValue(mutated)
+		} else {
+			before, after = strconv.Itoa(*field.intValue(original)), strconv.Itoa(*field.intValue(mutated))
+		}
+		if before != after {
+			values[field.name] = after
+		}
+	}
+
+	var changed []string
+	for name := range original.Env {
+		if _, ok := values[name]; !ok {
+			if err := os.Unsetenv(name); err != nil {
+				return nil, err
+			}
+			changed = append(changed, name)
+		}
+	}
+	for name, value := range values {
+		if current, ok := original.Env[name]; ok && current == value {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return nil, err
+		}
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func doubleMaxFunctionCount(config *runner.RunConfig) (*runner.RunConfig, error) {
+	config.MaxFunctionCount *= 2
+	return config, nil
+}
+
+func TestConfigMutatorDoublesMaxFunctionCount(t *testing.T) {
+	t.Setenv("MAX_FUNCTION_COUNT", "3")
+	t.Setenv("INVOKER_TYPE", "echo")
+
+	if err := mutateRunConfig("Double", doubleMaxFunctionCount); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := os.Getenv("MAX_FUNCTION_COUNT"); got != "6" {
+		t.Errorf("expected MAX_FUNCTION_COUNT to be 6, got %s", got)
+	}
+
+	pool, err := getInvokerPool("")
+	if err != nil {
+		t.Fatalf("could not create the pool: %v", err)
+	}
+	defer pool.Close()
+	if got := cap(pool.slots); got != 6 {
+		t.Errorf("expected a pool of 6 invokers, got %d", got)
+	}
+}
+
+func TestConfigMutatorUsesDefaults(t *testing.T) {
+	t.Setenv("MAX_FUNCTION_COUNT", "")
+
+	var seen int
+	err := mutateRunConfig("Inspect", func(config *runner.RunConfig) (*runner.RunConfig, error) {
+		seen = config.MaxFunctionCount
+		return config, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if seen != 8 {
+		t.Errorf("expected the default MAX_FUNCTION_COUNT of 8, got %d", seen)
+	}
+}
+
+func TestConfigMutatorWritesEnvChanges(t *testing.T) {
+	t.Setenv("MUTATOR_TEST_REMOVED", "value")
+	t.Setenv("MUTATOR_TEST_ADDED", "")
+	os.Unsetenv("MUTATOR_TEST_ADDED")
+
+	err := mutateRunConfig("Env", func(config *runner.RunConfig) (*runner.RunConfig, error) {
+		delete(config.Env, "MUTATOR_TEST_REMOVED")
+		config.Env["MUTATOR_TEST_ADDED"] = "added"
+		return config, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := os.LookupEnv("MUTATOR_TEST_REMOVED"); ok {
+		t.Error("expected MUTATOR_TEST_REMOVED to be unset")
+	}
+	if got := os.Getenv("MUTATOR_TEST_ADDED"); got != "added" {
+		t.Errorf("expected MUTATOR_TEST_ADDED to be added, got %q", got)
+	}
+}
+
+func TestConfigMutatorFailurePreventsStartup(t *testing.T) {
+	t.Setenv("MAX_FUNCTION_COUNT", "3")
+
+	err := mutateRunConfig("Fail", func(config *runner.RunConfig) (*runner.RunConfig, error) {
+		config.MaxFunctionCount = 100
+		return nil, errors.New("refused")
+	})
+	if err == nil {
+		t.Fatal("expected the failure of the mutator to be returned")
+	}
+	if got := os.Getenv("MAX_FUNCTION_COUNT"); got != "3" {
+		t.Errorf("expected MAX_FUNCTION_COUNT to be unchanged, got %s", got)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys read from the configuration server, relative to CONFIG_SERVER_PREFIX.
+const (
+	maxFunctionCountKey = "max_function_count"
+	maxWaitMillisKey    = "max_wait_millis"
+	maxExecMillisKey    = "max_exec_millis"
+)
+
+// -----------------------------------------------------------------------------
+// Configuration server
+//
+// A configuration server holds pool settings that can be changed while the
+// runner is running. The runner polls the keys under CONFIG_SERVER_PREFIX in
+// etcd or Consul and, when their values differ from the settings of the pool,
+// reconfigures the pool with all of the new values at once. A key that is
+// missing leaves the corresponding setting unchanged, and an update containing
+// an invalid value is rejected in its entirety.
+//
+// Only the invoker pool is reconfigured; the concurrency limiter in front of it
+// keeps the limit computed from MAX_FUNCTION_COUNT at startup.
+
+type configBackend interface {
+	// Values returns the values stored under the prefix, keyed by their name
+	// relative to the prefix.
+	Values(ctx context.Context) (map[string]string, error)
+}
+
+func getConfigBackend() (configBackend, error) {
+	// env: CONFIG_SERVER_PREFIX string fnrun/ "Key prefix of the settings on the configuration server."
+	prefix := getStringEnv("CONFIG_SERVER_PREFIX", "fnrun/")
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	// env: CONFIG_SERVER string "" "Configuration server from which pool settings are reloaded: etcd or consul."
+	switch backend := os.Getenv("CONFIG_SERVER"); backend {
+	case "":
+		return nil, nil
+	case "etcd":
+		return &etcdConfigBackend{
+			client: client,
+			// env: CONFIG_SERVER_ADDR string http://127.0.0.1:2379 "Address of the configuration server; the default for consul is http://127.0.0.1:8500."
+			addr:   strings.TrimSuffix(getStringEnv("CONFIG_SERVER_ADDR", "http://127.0.0.1:2379"), "/"),
+			prefix: prefix,
+		}, nil
+	case "consul":
+		return &consulConfigBackend{
+			client: client,
+			addr:   strings.TrimSuffix(getStringEnv("CONFIG_SERVER_ADDR", "http://127.0.0.1:8500"), "/"),
+			prefix: prefix,
+			// env: CONSUL_HTTP_TOKEN string "" "ACL token sent to the Consul configuration server."
+			token: os.Getenv("CONSUL_HTTP_TOKEN"),
+		}, nil
+	default:
+		return nil, configErrorf("CONFIG_SERVER", "Unknown CONFIG_SERVER %s", backend)
+	}
+}
+
+// etcdConfigBackend reads keys through the JSON gateway of the etcd v3 API.
+type etcdConfigBackend struct {
+	client *http.Client
+	addr   string
+	prefix string
+}
+
+type etcdRangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end"`
+}
+
+type etcdRangeResponse struct {
+	Kvs []struct {
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+	} `json:"kvs"`
+}
+
+// etcdPrefixEnd returns the end of the key range that contains every key
+// starting with prefix.
+func etcdPrefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// Every key is in the range.
+	return []byte{0}
+}
+
+func (e *etcdConfigBackend) Values(ctx context.Context) (map[string]string, error) {
+	body, err := json.Marshal(etcdRangeRequest{Key: []byte(e.prefix), RangeEnd: etcdPrefixEnd(e.prefix)})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.addr+"/v3/kv/range", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not read configuration from etcd: %s", resp.Status)
+	}
+
+	var response etcdRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(response.Kvs))
+	for _, kv := range response.Kvs {
+		values[strings.TrimPrefix(string(kv.Key), e.prefix)] = string(kv.Value)
+	}
+	return values, nil
+}
+
+// consulConfigBackend reads keys through the Consul KV HTTP API.
+type consulConfigBackend struct {
+	client *http.Client
+	addr   string
+	prefix string
+	token  string
+}
+
+type consulKVPair struct {
+	Key   string
+	Value []byte
+}
+
+func (c *consulConfigBackend) Values(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.addr+"/v1/kv/"+c.prefix+"?recurse", nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// Consul responds with 404 when no key has the prefix.
+		return map[string]string{}, nil
+	default:
+		return nil, fmt.Errorf("could not read configuration from consul: %s", resp.Status)
+	}
+
+	var pairs []consulKVPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		values[strings.TrimPrefix(pair.Key, c.prefix)] = string(pair.Value)
+	}
+	return values, nil
+}
+
+// parsePoolSettings returns current with the settings present in values
+// applied.
+func parsePoolSettings(values map[string]string, current poolSettings) (poolSettings, error) {
+	settings := current
+
+	if str, ok := values[maxFunctionCountKey]; ok {
+		count, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil || count < 1 {
+			return current, fmt.Errorf("invalid %s %q", maxFunctionCountKey, str)
+		}
+		settings.maxCount = count
+	}
+
+	millis := map[string]*time.Duration{
+		maxWaitMillisKey: &settings.maxWait,
+		maxExecMillisKey: &settings.maxExec,
+	}
+	for key, duration := range millis {
+		str, ok := values[key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil || n < 0 {
+			return current, fmt.Errorf("invalid %s %q", key, str)
+		}
+		*duration = time.Duration(n) * time.Millisecond
+	}
+
+	return settings, nil
+}
+
+// describeSettingsChange returns a description of the settings that differ
+// between from and to.
+func describeSettingsChange(from, to poolSettings) string {
+	var changes []string
+	if from.maxCount != to.maxCount {
+		changes = append(changes, fmt.Sprintf("%s %d -> %d", maxFunctionCountKey, from.maxCount, to.maxCount))
+	}
+	if from.maxWait != to.maxWait {
+		changes = append(changes, fmt.Sprintf("%s %d -> %d", maxWaitMillisKey, from.maxWait.Milliseconds(), to.maxWait.Milliseconds()))
+	}
+	if from.maxExec != to.maxExec {
+		changes = append(changes, fmt.Sprintf("%s %d -> %d", maxExecMillisKey, from.maxExec.Milliseconds(), to.maxExec.Milliseconds()))
+	}
+	return strings.Join(changes, ", ")
+}
+
+func watchConfigServer(ctx context.Context, backend configBackend, pool *invokerPool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		values, err := backend.Values(ctx)
+		if err != nil {
+			log.Printf("could not read configuration server: %v", err)
+		} else {
+			current := pool.settings()
+			settings, err := parsePoolSettings(values, current)
+			switch {
+			case err != nil:
+				log.Printf("ignoring configuration server update: %v", err)
+			case settings != current:
+				if err := pool.reconfigure(settings); err != nil {
+					log.Printf("could not apply configuration server update: %v", err)
+				} else {
+					log.Printf("applied configuration server update: %s", describeSettingsChange(current, settings))
+				}
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeEtcd serves the range requests of the etcd JSON gateway from a set of
+// keys that can be changed while it runs.
+type fakeEtcd struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (f *fakeEtcd) set(key string, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[key] = value
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req etcdRangeRequest
+	if r.URL.Path != "/v3/kv/range" || json.NewDecoder(r.Body).Decode(&req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var response etcdRangeResponse
+	for key, value := range f.values {
+		if key >= string(req.Key) && key < string(req.RangeEnd) {
+			response.Kvs = append(response.Kvs, struct {
+				Key   []byte `json:"key"`
+				Value []byte `json:"value"`
+			}{[]byte(key), []byte(value)})
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func waitForPoolSettings(t *testing.T, pool *invokerPool, want poolSettings) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.settings() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the pool settings to become %+v, got %+v", want, pool.settings())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchConfigServerReconfiguresThePool(t *testing.T) {
+	etcd := &fakeEtcd{values: map[string]string{"other/max_function_count": "9"}}
+	server := httptest.NewServer(etcd)
+	defer server.Close()
+	t.Setenv("CONFIG_SERVER", "etcd")
+	t.Setenv("CONFIG_SERVER_ADDR", server.URL+"/")
+	backend, err := getConfigBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("MAX_WAIT_MILLIS", "500")
+	t.Setenv("MAX_EXEC_MILLIS", "30000")
+	pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo"), time.Second, nil)
+	})
+	defer pool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchConfigServer(ctx, backend, pool, 10*time.Millisecond)
+
+	etcd.set("fnrun/max_function_count", "3")
+	etcd.set("fnrun/max_wait_millis", "250")
+	etcd.set("fnrun/max_exec_millis", "1000")
+	waitForPoolSettings(t, pool, poolSettings{maxCount: 3, maxWait: 250 * time.Millisecond, maxExec: time.Second})
+
+	// An update with an invalid value is rejected in its entirety.
+	etcd.set("fnrun/max_function_count", "4")
+	etcd.set("fnrun/max_exec_millis", "soon")
+	time.Sleep(100 * time.Millisecond)
+	if got := pool.settings(); got.maxCount != 3 {
+		t.Errorf("expected an invalid update to be ignored, got %+v", got)
+	}
+
+	etcd.set("fnrun/max_exec_millis", "2000")
+	waitForPoolSettings(t, pool, poolSettings{maxCount: 4, maxWait: 250 * time.Millisecond, maxExec: 2 * time.Second})
+}
+
+func TestConsulConfigBackend(t *testing.T) {
+	var found int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if atomic.LoadInt32(&found) == 0 || r.URL.Path != "/v1/kv/fnrun/" || r.URL.RawQuery != "recurse" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]consulKVPair{
+			{Key: "fnrun/max_wait_millis", Value: []byte("100")},
+			{Key: "fnrun/max_function_count", Value: []byte("2")},
+		})
+	}))
+	defer server.Close()
+	t.Setenv("CONFIG_SERVER", "consul")
+	t.Setenv("CONFIG_SERVER_ADDR", server.URL)
+	t.Setenv("CONSUL_HTTP_TOKEN", "token")
+	backend, err := getConfigBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := backend.Values(context.Background())
+	if err != nil || len(values) != 0 {
+		t.Errorf("expected no values when consul has no keys under the prefix, got %v and %v", values, err)
+	}
+
+	atomic.StoreInt32(&found, 1)
+	values, err = backend.Values(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{maxWaitMillisKey: "100", maxFunctionCountKey: "2"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+}
+
+func TestParsePoolSettings(t *testing.T) {
+	current := poolSettings{maxCount: 2, maxWait: time.Second, maxExec: time.Minute}
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    poolSettings
+		wantErr bool
+	}{
+		{"no values", map[string]string{}, current, false},
+		{"some values", map[string]string{maxWaitMillisKey: " 20 "}, poolSettings{2, 20 * time.Millisecond, time.Minute}, false},
+		{"zero function count", map[string]string{maxFunctionCountKey: "0"}, current, true},
+		{"negative duration", map[string]string{maxExecMillisKey: "-1"}, current, true},
+		{"invalid with valid", map[string]string{maxFunctionCountKey: "5", maxWaitMillisKey: "x"}, current, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parsePoolSettings(test.values, current)
+			if (err != nil) != test.wantErr {
+				t.Errorf("expected an error: %v, got %v", test.wantErr, err)
+			}
+			if got != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestGetConfigBackendRejectsUnknownServers(t *testing.T) {
+	t.Setenv("CONFIG_SERVER", "zookeeper")
+	if _, err := getConfigBackend(); err == nil {
+		t.Error("expected an error for an unknown configuration server")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+//go:generate go run ./internal/genconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Formats of the --print-config output.
+const (
+	configOutputText = "text"
+	configOutputJSON = "json"
+)
+
+// -----------------------------------------------------------------------------
+// Configuration Reference
+//
+// The runner is configured entirely with environment variables. configVars
+// lists every variable the runner reads, with its type, default value and
+// purpose, and is printed by the --print-config flag. It is generated into
+// config_generated.go from the comments of the form
+//
+//	// env: NAME type default "description"
+//
+// next to the code that reads each variable; a variable added to the runner
+// must be documented with such a comment, and go generate run again.
+//
+// The invoker pool settings marked as suffixable may be overridden for the B
+// pool of a traffic split, the error handler pool or a function version by
+// setting the variable with _B, _ERROR_HANDLER or the version suffix appended.
+
+type configVar struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     string `json:"default"`
+	Description string `json:"description"`
+}
+
+// printConfig writes the table of configuration variables to w in the given
+// format.
+func printConfig(w io.Writer, format string) error {
+	switch format {
+	case "", configOutputText:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tTYPE\tDEFAULT\tDESCRIPTION")
+		for _, v := range configVars {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.Name, v.Type, v.Default, v.Description)
+		}
+		return tw.Flush()
+	case configOutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(configVars)
+	default:
+		return fmt.Errorf("unknown output format %s", format)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// envNamesInSource returns the names of the environment variables read by
+// literal name in the non-test sources of the package.
+func envNamesInSource(t *testing.T) []string {
+	t.Helper()
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern := regexp.MustCompile(`Env\("([A-Z0-9_]+)"`)
+	seen := make(map[string]bool)
+	var names []string
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range pattern.FindAllSubmatch(src, -1) {
+			if name := string(match[1]); !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		t.Fatal("expected the sources to read environment variables")
+	}
+	return names
+}
+
+func TestPrintConfigTextListsEveryVariable(t *testing.T) {
+	var out bytes.Buffer
+	if err := printConfig(&out, configOutputText); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	if !strings.HasPrefix(lines[0], "NAME") {
+		t.Errorf("expected a header line, got %q", lines[0])
+	}
+	listed := make(map[string]bool)
+	for _, line := range lines[1:] {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			listed[fields[0]] = true
+		}
+	}
+	for _, name := range envNamesInSource(t) {
+		if !listed[name] {
+			t.Errorf("expected %s to be listed", name)
+		}
+	}
+}
+
+func TestPrintConfigJSONListsEveryVariable(t *testing.T) {
+	var out bytes.Buffer
+	if err := printConfig(&out, configOutputJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var vars []configVar
+	if err := json.Unmarshal(out.Bytes(), &vars); err != nil {
+		t.Fatalf("expected a JSON array of variables: %v", err)
+	}
+	listed := make(map[string]configVar)
+	for _, v := range vars {
+		listed[v.Name] = v
+	}
+	for _, name := range envNamesInSource(t) {
+		v, ok := listed[name]
+		if !ok {
+			t.Errorf("expected %s to be listed", name)
+		} else if v.Type == "" || v.Description == "" {
+			t.Errorf("expected %s to have a type and a description, got %+v", name, v)
+		}
+	}
+
+	batchSize := listed["BATCH_SIZE"]
+	if batchSize.Type != "int" || batchSize.Default != "1" {
+		t.Errorf("expected BATCH_SIZE to be an int defaulting to 1, got %+v", batchSize)
+	}
+}
+
+func TestPrintConfigRejectsUnknownFormat(t *testing.T) {
+	if err := printConfig(ioutil.Discard, "yaml"); err == nil {
+		t.Error("expected an error for an unknown output format")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const (
+	contentTypeKey    = "content-type"
+	contentTypeEnvKey = "FNRUN_CONTENT_TYPE"
+
+	contentTypeJSON   = "application/json"
+	contentTypeBinary = "application/octet-stream"
+)
+
+// errInvalidJSONInput is returned when an input declared as JSON cannot be
+// parsed as JSON.
+var errInvalidJSONInput = errors.New("input declared as application/json is not valid JSON")
+
+// -----------------------------------------------------------------------------
+// Content Type Invoker
+//
+// The content type invoker enforces the content type declared by the source in
+// the content-type metadata of each input. Inputs declared as
+// application/octet-stream are passed to the function as opaque bytes, and
+// inputs declared as application/json must be valid JSON. The function is told
+// which it received in the FNRUN_CONTENT_TYPE env of the execution context, so
+// that it can decode the input accordingly. Parameters of the media type, such
+// as the charset, are ignored. An input with any other content type, or with
+// none, is rejected with runner.ErrUnsupportedContentType without being
+// invoked.
+
+type contentTypeInvoker struct {
+	invoker fnrun.Invoker
+}
+
+func (ci *contentTypeInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	metadata, _ := runner.MetadataFromContext(ctx)
+	value := metadata[contentTypeKey]
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", runner.ErrUnsupportedContentType, value)
+	}
+
+	switch mediaType {
+	case contentTypeJSON:
+		if !json.Valid(input.Data) {
+			return nil, errInvalidJSONInput
+		}
+	case contentTypeBinary:
+	default:
+		return nil, fmt.Errorf("%w: %s", runner.ErrUnsupportedContentType, mediaType)
+	}
+
+	return ci.invoker.Invoke(withExtraEnv(ctx, contentTypeEnvKey, mediaType), input)
+}
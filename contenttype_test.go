@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// contentTypeEnvInvoker responds with the FNRUN_CONTENT_TYPE env of the
+// invocation.
+var contentTypeEnvInvoker = invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	env, _ := fnrun.Env(ctx)
+	return &fnrun.Result{Status: 200, Data: []byte(env[contentTypeEnvKey])}, nil
+})
+
+func invokeWithContentType(contentType string, data string) (*fnrun.Result, error) {
+	ctx := context.Background()
+	if contentType != "" {
+		ctx = runner.WithMetadata(ctx, map[string]string{contentTypeKey: contentType})
+	}
+	ci := &contentTypeInvoker{invoker: contentTypeEnvInvoker}
+	return ci.Invoke(ctx, &fnrun.Input{Data: []byte(data)})
+}
+
+func TestContentTypeInvokerRoutesKnownContentTypes(t *testing.T) {
+	tests := []struct {
+		contentType string
+		data        string
+		want        string
+	}{
+		{"application/json", `{"id": 1}`, contentTypeJSON},
+		{"application/json; charset=utf-8", `[1, 2]`, contentTypeJSON},
+		{"application/octet-stream", "\x00\xff", contentTypeBinary},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			result, err := invokeWithContentType(tt.contentType, tt.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(result.Data) != tt.want {
+				t.Errorf("expected the function to be told %s, got %q", tt.want, result.Data)
+			}
+		})
+	}
+}
+
+func TestContentTypeInvokerRejectsUnsupportedContentTypes(t *testing.T) {
+	for _, contentType := range []string{"text/plain", "", "not a media type;"} {
+		t.Run(contentType, func(t *testing.T) {
+			_, err := invokeWithContentType(contentType, "x")
+			if !errors.Is(err, runner.ErrUnsupportedContentType) {
+				t.Errorf("expected ErrUnsupportedContentType, got %v", err)
+			}
+		})
+	}
+}
+
+func TestContentTypeInvokerRejectsInvalidJSON(t *testing.T) {
+	if _, err := invokeWithContentType(contentTypeJSON, "{"); err != errInvalidJSONInput {
+		t.Errorf("expected errInvalidJSONInput, got %v", err)
+	}
+}
+
+func TestHTTPSourceRespondsToContentTypeErrors(t *testing.T) {
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 0, 0, nil, nil, nil, nil, nil, 1, nil)
+	runHTTPSource(t, addr, source, &contentTypeInvoker{invoker: contentTypeEnvInvoker})
+
+	tests := []struct {
+		contentType string
+		body        string
+		want        int
+	}{
+		{"application/json", `{"id": 1}`, http.StatusOK},
+		{"application/octet-stream", "x", http.StatusOK},
+		{"text/plain", "x", http.StatusUnsupportedMediaType},
+		{"application/json", "{", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post("http://"+addr+"/", tt.contentType, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %q: expected status %d, got %d", tt.contentType, tt.body, tt.want, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// CORS
+//
+// The CORS policy lets browser clients on other origins call the HTTP source.
+// It is configured with a comma-separated list of allowed origins, or * to
+// allow any origin. A request from an allowed origin is answered with an
+// Access-Control-Allow-Origin header. A preflight OPTIONS request is answered
+// directly, without invoking the function: with a 204 response that allows
+// POST requests with Content-Type and Authorization headers if its origin is
+// allowed, and with a 403 response otherwise. Requests without an Origin
+// header are unaffected.
+
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+}
+
+// newCORSPolicy parses a list of allowed origins. It returns nil if the list
+// is empty.
+func newCORSPolicy(list string) *corsPolicy {
+	policy := &corsPolicy{origins: make(map[string]bool)}
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimSpace(origin)
+		switch origin {
+		case "":
+		case "*":
+			policy.anyOrigin = true
+		default:
+			policy.origins[origin] = true
+		}
+	}
+	if !policy.anyOrigin && len(policy.origins) == 0 {
+		return nil
+	}
+	return policy
+}
+
+// wrap returns a handler that applies the policy to the requests handled by
+// next.
+func (cp *corsPolicy) wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next(w, r)
+			return
+		}
+
+		allowed := cp.anyOrigin || cp.origins[origin]
+		if allowed {
+			if cp.anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+			}
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next(w, r)
+	}
+}
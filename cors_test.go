@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// runCORSSource runs the HTTP source with the CORS policy for origins and an
+// invoker that responds with ok, and returns its address.
+func runCORSSource(t *testing.T, origins string) string {
+	t.Helper()
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 0, 0, nil, newCORSPolicy(origins), nil, nil, nil, 1, nil)
+	runHTTPSource(t, addr, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 200, Data: []byte("ok")}, nil
+	}))
+	return addr
+}
+
+// sendCORSRequest sends a request with the given method and Origin header to
+// the HTTP source at addr. A preflight request also asks to POST.
+func sendCORSRequest(t *testing.T, addr string, method string, origin string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, "http://"+addr+"/", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestCORSPreflightFromAnAllowedOrigin(t *testing.T) {
+	addr := runCORSSource(t, "https://app.example.com, https://admin.example.com")
+
+	resp := sendCORSRequest(t, addr, http.MethodOptions, "https://admin.example.com")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", resp.StatusCode)
+	}
+	headers := map[string]string{
+		"Access-Control-Allow-Origin":  "https://admin.example.com",
+		"Access-Control-Allow-Methods": "POST, OPTIONS",
+		"Access-Control-Allow-Headers": "Content-Type, Authorization",
+		"Vary":                         "Origin",
+	}
+	for name, want := range headers {
+		if got := resp.Header.Get(name); got != want {
+			t.Errorf("expected %s to be %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestCORSPreflightFromAnotherOriginIsForbidden(t *testing.T) {
+	addr := runCORSSource(t, "https://app.example.com")
+
+	resp := sendCORSRequest(t, addr, http.MethodOptions, "https://evil.example.com")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", resp.StatusCode)
+	}
+	if origin := resp.Header.Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("expected no Access-Control-Allow-Origin, got %q", origin)
+	}
+}
+
+func TestCORSAllowsAnyOrigin(t *testing.T) {
+	addr := runCORSSource(t, "*")
+
+	resp := sendCORSRequest(t, addr, http.MethodOptions, "https://anywhere.example.com")
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("expected the preflight to be allowed for any origin, got %d %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestCORSHeadersOnInvocations(t *testing.T) {
+	addr := runCORSSource(t, "https://app.example.com")
+
+	resp := sendCORSRequest(t, addr, http.MethodPost, "https://app.example.com")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("expected the invocation to allow its origin, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	resp = sendCORSRequest(t, addr, http.MethodPost, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected a request without an origin to be unaffected, got %d %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestNewCORSPolicyOfAnEmptyList(t *testing.T) {
+	if policy := newCORSPolicy(" , "); policy != nil {
+		t.Errorf("expected no policy, got %+v", policy)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const (
+	deadlineKey    = "x-deadline"
+	deadlineEnvKey = "FNRUN_DEADLINE_MS"
+)
+
+// -----------------------------------------------------------------------------
+// Deadline Invoker
+//
+// A source may know how long an event can be processed before it is handed to
+// another consumer, such as when an SQS visibility timeout expires. The source
+// passes this to the runner as an RFC 3339 timestamp in the x-deadline
+// metadata. The deadline invoker bounds the invocation by that deadline, or by
+// the maximum execution time if it is sooner, and tells the function how many
+// milliseconds remain in the FNRUN_DEADLINE_MS env of the execution context. An
+// event whose deadline has already passed fails without being invoked.
+
+type deadlineInvoker struct {
+	invoker fnrun.Invoker
+	maxExec time.Duration
+	now     func() time.Time
+}
+
+func (di *deadlineInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	metadata, _ := runner.MetadataFromContext(ctx)
+	value, ok := metadata[deadlineKey]
+	if !ok {
+		return di.invoker.Invoke(ctx, input)
+	}
+
+	deadline, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		log.Printf("ignoring invalid %s metadata %q: %v", deadlineKey, value, err)
+		return di.invoker.Invoke(ctx, input)
+	}
+
+	remaining := deadline.Sub(di.now())
+	if remaining <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+	if di.maxExec > 0 && remaining > di.maxExec {
+		remaining = di.maxExec
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, remaining)
+	defer cancel()
+
+	return di.invoker.Invoke(withExtraEnv(ctx, deadlineEnvKey, strconv.FormatInt(int64(remaining/time.Millisecond), 10)), input)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func withDeadlineMetadata(deadline string) context.Context {
+	return runner.WithMetadata(context.Background(), map[string]string{deadlineKey: deadline})
+}
+
+func TestDeadlineInvokerBoundsInvocations(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name         string
+		deadline     string
+		maxExec      time.Duration
+		wantDeadline time.Time
+		wantEnv      string
+	}{
+		{"deadline", now.Add(1500 * time.Millisecond).Format(time.RFC3339Nano), time.Minute, now.Add(1500 * time.Millisecond), "1500"},
+		{"clamped to max exec", now.Add(time.Hour).Format(time.RFC3339), time.Minute, now.Add(time.Minute), "60000"},
+		{"no max exec", now.Add(time.Hour).Format(time.RFC3339), 0, now.Add(time.Hour), "3600000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			di := &deadlineInvoker{
+				maxExec: tt.maxExec,
+				now:     func() time.Time { return now },
+				invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+					// The context deadline is relative to the real clock, so
+					// only the remaining time is compared.
+					deadline, ok := ctx.Deadline()
+					if !ok {
+						t.Fatal("expected the context to have a deadline")
+					}
+					if remaining, want := time.Until(deadline), tt.wantDeadline.Sub(now); remaining > want || remaining < want-time.Second {
+						t.Errorf("expected about %v to remain, got %v", want, remaining)
+					}
+					if env, _ := fnrun.Env(ctx); env[deadlineEnvKey] != tt.wantEnv {
+						t.Errorf("expected %s=%s, got %q", deadlineEnvKey, tt.wantEnv, env[deadlineEnvKey])
+					}
+					return &fnrun.Result{Status: 200}, nil
+				}),
+			}
+			if _, err := di.Invoke(withDeadlineMetadata(tt.deadline), &fnrun.Input{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeadlineInvokerIgnoresMissingAndInvalidDeadlines(t *testing.T) {
+	di := &deadlineInvoker{
+		maxExec: time.Minute,
+		now:     time.Now,
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			if _, ok := ctx.Deadline(); ok {
+				t.Error("expected the context to have no deadline")
+			}
+			if env, _ := fnrun.Env(ctx); env[deadlineEnvKey] != "" {
+				t.Errorf("expected no %s, got %q", deadlineEnvKey, env[deadlineEnvKey])
+			}
+			return &fnrun.Result{Status: 200}, nil
+		}),
+	}
+
+	for _, ctx := range []context.Context{context.Background(), withDeadlineMetadata("tomorrow")} {
+		if _, err := di.Invoke(ctx, &fnrun.Input{}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestDeadlineInvokerFailsPastDeadlines(t *testing.T) {
+	di := &deadlineInvoker{
+		maxExec: time.Minute,
+		now:     time.Now,
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			t.Error("expected the function not to be invoked")
+			return nil, nil
+		}),
+	}
+
+	_, err := di.Invoke(withDeadlineMetadata(time.Now().Add(-time.Second).Format(time.RFC3339Nano)), &fnrun.Input{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+}
+
+func TestDeadlineInvokerPassesTheDeadlineToTheFunctionProcess(t *testing.T) {
+	pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("env"), time.Second, nil)
+	})
+	defer pool.Close()
+	di := &deadlineInvoker{invoker: pool, maxExec: time.Minute, now: time.Now}
+
+	result, err := di.Invoke(withDeadlineMetadata(time.Now().Add(5*time.Second).Format(time.RFC3339Nano)), &fnrun.Input{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var env map[string]string
+	if err := json.Unmarshal(result.Data, &env); err != nil {
+		t.Fatal(err)
+	}
+	if ms, err := strconv.Atoi(env[deadlineEnvKey]); err != nil || ms <= 4000 || ms > 5000 {
+		t.Errorf("expected about 5000 in %s, got %q", deadlineEnvKey, env[deadlineEnvKey])
+	}
+}
+
+func TestDeadlineInvokerCancelsTheFunctionProcessAtTheDeadline(t *testing.T) {
+	pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo", "FNRUN_TEST_SLEEP_MS=3000"), time.Second, nil)
+	})
+	defer pool.Close()
+	di := &deadlineInvoker{invoker: pool, maxExec: time.Minute, now: time.Now}
+
+	start := time.Now()
+	_, err := di.Invoke(withDeadlineMetadata(start.Add(300*time.Millisecond).Format(time.RFC3339Nano)), &fnrun.Input{Data: []byte("x")})
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatal("expected the invocation to be cancelled at the deadline")
+	}
+	if elapsed < 250*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Errorf("expected the invocation to be cancelled after about 300ms, took %v", elapsed)
+	}
+}
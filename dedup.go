@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+const dedupKeyPrefix = "fnrun:dedup:"
+
+// seenSet records which inputs have already been processed.
+type seenSet interface {
+	// Add adds key to the set with the provided TTL. It returns false if the key
+	// was already present.
+	Add(ctx context.Context, key string, ttl time.Duration) (bool, error)
+
+	// Remove removes key from the set.
+	Remove(ctx context.Context, key string) error
+}
+
+// -----------------------------------------------------------------------------
+// Dedup Invoker
+//
+// The dedup invoker skips inputs that have already been processed. Before an
+// input is invoked, a hash of its data is added to the seen set; if the hash
+// was already present, the input is a duplicate and an empty result is returned
+// without invoking the function. If the invocation (including sink delivery)
+// fails, the hash is removed so that a redelivery of the input is processed.
+// Inputs for which the dedup feature flag is off bypass the seen set.
+
+type dedupInvoker struct {
+	invoker fnrun.Invoker
+	seen    seenSet
+	ttl     time.Duration
+	flags   featureFlags
+}
+
+func (di *dedupInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	if !di.flags.enabled(ctx, featureDedup) {
+		return di.invoker.Invoke(ctx, input)
+	}
+
+	sum := sha256.Sum256(input.Data)
+	key := dedupKeyPrefix + hex.EncodeToString(sum[:])
+
+	added, err := di.seen.Add(ctx, key, di.ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !added {
+		return &fnrun.Result{}, nil
+	}
+
+	result, err := di.invoker.Invoke(ctx, input)
+	if err != nil {
+		if removeErr := di.seen.Remove(context.Background(), key); removeErr != nil {
+			log.Printf("could not remove dedup key: %v", removeErr)
+		}
+	}
+
+	return result, err
+}
+
+// -----------------------------------------------------------------------------
+// Redis seen set
+
+type redisSeenSet struct {
+	client *redisClient
+}
+
+func newRedisSeenSet(addr string) *redisSeenSet {
+	return &redisSeenSet{client: newRedisClient(addr)}
+}
+
+func (r *redisSeenSet) Add(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	reply, err := r.client.do(ctx, "SET", key, "1", "NX", "EX", strconv.FormatInt(seconds, 10))
+	if err != nil {
+		return false, err
+	}
+
+	return reply != nil, nil
+}
+
+func (r *redisSeenSet) Remove(ctx context.Context, key string) error {
+	_, err := r.client.do(ctx, "DEL", key)
+	return err
+}
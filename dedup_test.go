@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// memorySeenSet is a seenSet that ignores TTLs.
+type memorySeenSet struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (s *memorySeenSet) Add(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[key] {
+		return false, nil
+	}
+	s.keys[key] = true
+	return true, nil
+}
+
+func (s *memorySeenSet) Remove(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+func TestDedupInvokerSkipsDuplicateInputs(t *testing.T) {
+	var invocations int
+	di := &dedupInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			invocations++
+			return &fnrun.Result{Status: 200, Data: input.Data}, nil
+		}),
+		seen: &memorySeenSet{keys: map[string]bool{}},
+		ttl:  time.Minute,
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := di.Invoke(context.Background(), &fnrun.Input{Data: []byte("same")}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if invocations != 1 {
+		t.Errorf("expected the function to be invoked once, got %d", invocations)
+	}
+
+	if _, err := di.Invoke(context.Background(), &fnrun.Input{Data: []byte("other")}); err != nil {
+		t.Fatal(err)
+	}
+	if invocations != 2 {
+		t.Errorf("expected a different input to be invoked, got %d invocations", invocations)
+	}
+}
+
+func TestDedupInvokerProcessesRedeliveryAfterFailure(t *testing.T) {
+	var invocations int
+	di := &dedupInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			invocations++
+			if invocations == 1 {
+				return nil, errors.New("sink failed")
+			}
+			return &fnrun.Result{}, nil
+		}),
+		seen: &memorySeenSet{keys: map[string]bool{}},
+		ttl:  time.Minute,
+	}
+
+	if _, err := di.Invoke(context.Background(), &fnrun.Input{Data: []byte("event")}); err == nil {
+		t.Fatal("expected the first invocation to fail")
+	}
+	if _, err := di.Invoke(context.Background(), &fnrun.Input{Data: []byte("event")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if invocations != 2 {
+		t.Errorf("expected the redelivery to be invoked, got %d invocations", invocations)
+	}
+}
+
+// serveFakeRedis serves the Redis protocol on a local port, answering each
+// command with handle, and returns the address of the server.
+func serveFakeRedis(t *testing.T, handle func(args []string) string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					args, err := readFakeRedisCommand(reader)
+					if err != nil {
+						return
+					}
+					io.WriteString(conn, handle(args))
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func readFakeRedisCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestRedisSeenSet(t *testing.T) {
+	var mu sync.Mutex
+	keys := map[string]string{}
+	var commands [][]string
+	addr := serveFakeRedis(t, func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		commands = append(commands, args)
+		switch args[0] {
+		case "SET":
+			if _, ok := keys[args[1]]; ok {
+				return "$-1\r\n"
+			}
+			keys[args[1]] = args[2]
+			return "+OK\r\n"
+		case "DEL":
+			delete(keys, args[1])
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+
+	seen := newRedisSeenSet(addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if added, err := seen.Add(ctx, "key", 90*time.Second); err != nil || !added {
+		t.Fatalf("expected the key to be added, got %v, %v", added, err)
+	}
+	if added, err := seen.Add(ctx, "key", 90*time.Second); err != nil || added {
+		t.Fatalf("expected the key to be present, got %v, %v", added, err)
+	}
+	if err := seen.Remove(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if added, err := seen.Add(ctx, "key", time.Millisecond); err != nil || !added {
+		t.Fatalf("expected the key to be added after removal, got %v, %v", added, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(commands[0], " "); got != "SET key 1 NX EX 90" {
+		t.Errorf("unexpected command %q", got)
+	}
+	if got := strings.Join(commands[3], " "); got != "SET key 1 NX EX 1" {
+		t.Errorf("expected the TTL to be at least a second, got %q", got)
+	}
+}
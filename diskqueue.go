@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// errDiskQueueFull is returned to the source when an event cannot be spooled
+// because the disk queue has reached its maximum size.
+var errDiskQueueFull = errors.New("disk queue is full")
+
+const (
+	diskQueueLogName         = "queue.log"
+	diskQueuePosName         = "queue.pos"
+	diskQueueMinBackoff      = 100 * time.Millisecond
+	diskQueueMaxBackoff      = 30 * time.Second
+	diskQueueRecordHeader    = 4
+	diskQueueMinCompactBytes = 1 << 20
+)
+
+// -----------------------------------------------------------------------------
+// Disk Queue
+//
+// The disk queue spools events to an append-only log file before they are
+// processed so that events are not lost when the function or sink is
+// unavailable. A drainer goroutine reads events from the log and passes them to
+// the underlying invoker, retrying a failed event up to DISK_QUEUE_MAX_ATTEMPTS
+// times before delivering its input to the dead-letter sink, if one is
+// configured, and moving on to the next event.
+//
+// Processing is fire-and-forget from the point of view of the source: Invoke
+// returns an empty result with no status as soon as the event has been synced
+// to disk, and the result of the function is only delivered to the sink. The
+// disk queue is therefore not suited to sources that reply to their caller
+// with the result of the function, such as the HTTP source.
+//
+// The offset of the next unprocessed event is persisted atomically in a
+// separate file. Events left in the queue when the runner stops are replayed
+// the next time it starts. Once every event has been processed, the log is
+// truncated. A queue that never empties is compacted instead: once the
+// processed prefix of the log is at least as large as the unprocessed events
+// that follow it, the unprocessed events are copied to a new log that replaces
+// the old one. The position file is reset before the new log is moved into
+// place, so a crash in between replays processed events rather than losing
+// unprocessed ones. The maximum size of the queue applies to the unprocessed
+// events only.
+//
+// An event that cannot be read from the log is retried with a backoff, since
+// skipping it would lose the position of the events that follow it.
+//
+// The input data and metadata of each event are persisted; other context
+// values attached by the source are not available when the event is processed.
+
+type diskQueueRecord struct {
+	Data     []byte            `json:"data,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type diskQueue struct {
+	invoker        fnrun.Invoker
+	dir            string
+	maxBytes       int64
+	maxAttempts    int
+	deadLetterSink eventSinkTransformer
+	mu             sync.Mutex
+	file           *os.File
+	// written is the end of the records written to the log and size is the
+	// end of those that have been synced to disk, which are the only ones
+	// that the drainer reads.
+	written int64
+	size    int64
+	readPos int64
+	// compacted is the number of bytes removed from the front of the log since
+	// it was opened, so that offsets taken before a truncation or compaction
+	// can be adjusted.
+	compacted    int64
+	compactBytes int64
+	available    chan struct{}
+	cancel       context.CancelFunc
+	stopped      chan struct{}
+}
+
+func openDiskQueue(invoker fnrun.Invoker, dir string, maxBytes int64, maxAttempts int, deadLetterSink eventSinkTransformer) (*diskQueue, error) {
+	if maxAttempts <= 0 {
+		return nil, configErrorf("DISK_QUEUE_MAX_ATTEMPTS", "DISK_QUEUE_MAX_ATTEMPTS must be greater than zero")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, diskQueueLogName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &diskQueue{
+		invoker:        invoker,
+		dir:            dir,
+		maxBytes:       maxBytes,
+		maxAttempts:    maxAttempts,
+		deadLetterSink: deadLetterSink,
+		file:           file,
+		compactBytes:   diskQueueMinCompactBytes,
+		available:      make(chan struct{}, 1),
+		stopped:        make(chan struct{}),
+	}
+
+	if err := q.recover(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// recover loads the read position and discards any partially written record
+// at the end of the log.
+func (q *diskQueue) recover() error {
+	// A new log left behind by an interrupted compaction is incomplete.
+	if err := os.Remove(filepath.Join(q.dir, diskQueueLogName+".tmp")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(q.dir, diskQueuePosName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		q.readPos, err = strconv.ParseInt(strings.TrimSpace(string(contents)), 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	info, err := q.file.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+
+	pos := q.readPos
+	for pos < end {
+		_, next, err := q.readRecord(pos, end)
+		if err != nil {
+			break
+		}
+		pos = next
+	}
+
+	if pos > end {
+		pos = end
+	}
+	if err := q.file.Truncate(pos); err != nil {
+		return err
+	}
+	q.size = pos
+	q.written = pos
+	if q.readPos > q.size {
+		q.readPos = q.size
+	}
+
+	return nil
+}
+
+// start begins draining the queue in the background.
+func (q *diskQueue) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	go q.drain(ctx)
+}
+
+// waitReplayed blocks until every event that was in the queue when it was
+// opened has been processed.
+func (q *diskQueue) waitReplayed(ctx context.Context) error {
+	q.mu.Lock()
+	target := q.compacted + q.size
+	q.mu.Unlock()
+
+	for {
+		q.mu.Lock()
+		done := q.compacted+q.readPos >= target
+		q.mu.Unlock()
+		if done {
+			return nil
+		}
+
+		select {
+		case <-time.After(diskQueueMinBackoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// close stops the drainer and closes the log file. Events that have not been
+// processed remain in the queue.
+func (q *diskQueue) close() error {
+	if q.cancel != nil {
+		q.cancel()
+		<-q.stopped
+	}
+	return q.file.Close()
+}
+
+// Invoke spools the event to the log and returns an empty result once it has
+// been synced to disk.
+func (q *diskQueue) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	entry := diskQueueRecord{Data: input.Data}
+	if metadata, ok := runner.MetadataFromContext(ctx); ok {
+		entry.Metadata = metadata
+	}
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	record := make([]byte, diskQueueRecordHeader+len(payload))
+	binary.BigEndian.PutUint32(record, uint32(len(payload)))
+	copy(record[diskQueueRecordHeader:], payload)
+
+	q.mu.Lock()
+	if q.maxBytes > 0 && q.written-q.readPos+int64(len(record)) > q.maxBytes {
+		q.mu.Unlock()
+		return nil, errDiskQueueFull
+	}
+	if _, err := q.file.WriteAt(record, q.written); err != nil {
+		q.mu.Unlock()
+		return nil, err
+	}
+	q.written += int64(len(record))
+	end, file, compacted := q.written, q.file, q.compacted
+	q.mu.Unlock()
+
+	// Records are written in order while holding q.mu, so once this sync
+	// returns every record up to end is on disk. Syncing without the lock lets
+	// concurrent invocations share a sync rather than wait for one each.
+	err = file.Sync()
+
+	q.mu.Lock()
+	// A compaction in the meantime has synced the record to the new log and
+	// closed the old one.
+	if q.compacted != compacted {
+		err = nil
+	}
+	end -= q.compacted - compacted
+	if err == nil && end > q.size {
+		q.size = end
+	}
+	q.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case q.available <- struct{}{}:
+	default:
+	}
+
+	return &fnrun.Result{}, nil
+}
+
+func (q *diskQueue) drain(ctx context.Context) {
+	defer close(q.stopped)
+
+	backoff := diskQueueMinBackoff
+	attempts := 0
+	for {
+		q.mu.Lock()
+		pos, end := q.readPos, q.size
+		q.mu.Unlock()
+
+		if pos >= end {
+			select {
+			case <-q.available:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		payload, next, err := q.readRecord(pos, end)
+		if err != nil {
+			log.Printf("could not read from disk queue; retrying in %v: %v", backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff *= 2
+			if backoff > diskQueueMaxBackoff {
+				backoff = diskQueueMaxBackoff
+			}
+			continue
+		}
+		var entry diskQueueRecord
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			log.Printf("could not decode disk queue record; skipping it: %v", err)
+			if err := q.advance(next); err != nil {
+				log.Printf("could not persist disk queue position: %v", err)
+			}
+			continue
+		}
+
+		invokeCtx := ctx
+		if entry.Metadata != nil {
+			invokeCtx = runner.WithMetadata(ctx, entry.Metadata)
+		}
+		if _, err := q.invoker.Invoke(invokeCtx, &fnrun.Input{Data: entry.Data}); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			attempts++
+			if attempts >= q.maxAttempts {
+				log.Printf("queued invocation failed %d times; giving up: %v", attempts, err)
+				q.deadLetter(invokeCtx, entry.Data)
+				attempts = 0
+				backoff = diskQueueMinBackoff
+				if err := q.advance(next); err != nil {
+					log.Printf("could not persist disk queue position: %v", err)
+				}
+				continue
+			}
+			log.Printf("queued invocation failed; retrying in %v: %v", backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff *= 2
+			if backoff > diskQueueMaxBackoff {
+				backoff = diskQueueMaxBackoff
+			}
+			continue
+		}
+		attempts = 0
+		backoff = diskQueueMinBackoff
+
+		if err := q.advance(next); err != nil {
+			log.Printf("could not persist disk queue position: %v", err)
+		}
+	}
+}
+
+func (q *diskQueue) readRecord(pos int64, end int64) ([]byte, int64, error) {
+	if end-pos < diskQueueRecordHeader {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	header := make([]byte, diskQueueRecordHeader)
+	if _, err := q.file.ReadAt(header, pos); err != nil {
+		return nil, 0, err
+	}
+
+	length := int64(binary.BigEndian.Uint32(header))
+	next := pos + diskQueueRecordHeader + length
+	if next > end {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	data := make([]byte, length)
+	if _, err := q.file.ReadAt(data, pos+diskQueueRecordHeader); err != nil {
+		return nil, 0, err
+	}
+
+	return data, next, nil
+}
+
+// deadLetter delivers the input of an event that could not be processed to the
+// dead-letter sink. Without a dead-letter sink, the event is dropped.
+func (q *diskQueue) deadLetter(ctx context.Context, data []byte) {
+	if q.deadLetterSink == nil {
+		log.Printf("no dead-letter sink is configured; dropping the queued event")
+		return
+	}
+	result := &fnrun.Result{Status: http.StatusServiceUnavailable, Data: data}
+	if _, err := deliverToDeadLetterSink(ctx, q.deadLetterSink, result); err != nil {
+		log.Printf("could not dead-letter the queued event: %v", err)
+	}
+}
+
+// advance moves the read position past a processed event. When the queue is
+// empty, the log is truncated, and when the processed prefix of the log is
+// large, the log is compacted.
+func (q *diskQueue) advance(pos int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Records that have been written but not yet synced are past q.size, and
+	// must not be truncated away.
+	if pos >= q.size && q.written == q.size {
+		if err := q.file.Truncate(0); err != nil {
+			return err
+		}
+		q.compacted += pos
+		q.size = 0
+		q.written = 0
+		pos = 0
+	}
+
+	q.readPos = pos
+	if pos >= q.compactBytes && pos >= q.written-pos {
+		if err := q.compact(); err != nil {
+			log.Printf("could not compact the disk queue: %v", err)
+		} else {
+			return nil
+		}
+	}
+	return q.writePos(q.readPos)
+}
+
+// compact replaces the log with a new log holding only the records past the
+// read position, including those not yet synced. The caller must hold q.mu.
+func (q *diskQueue) compact() error {
+	path := filepath.Join(q.dir, diskQueueLogName)
+	file, err := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, io.NewSectionReader(q.file, q.readPos, q.written-q.readPos)); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	// The position is reset before the new log is moved into place, so that a
+	// crash in between replays the old log from the start rather than reading
+	// the new log from the old position.
+	if err := q.writePos(0); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	q.file.Close()
+	q.file = file
+	q.compacted += q.readPos
+	q.written -= q.readPos
+	q.size = q.written
+	q.readPos = 0
+	return nil
+}
+
+// writePos atomically replaces the position file. The caller must hold q.mu.
+func (q *diskQueue) writePos(pos int64) error {
+	return writeFileAtomic(filepath.Join(q.dir, diskQueuePosName), []byte(strconv.FormatInt(pos, 10)))
+}
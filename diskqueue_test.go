@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// flakySink records the inputs that reach it and fails while it is down.
+type flakySink struct {
+	mu       sync.Mutex
+	down     bool
+	inputs   []string
+	metadata []map[string]string
+}
+
+func (s *flakySink) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return nil, errors.New("sink is unavailable")
+	}
+	s.inputs = append(s.inputs, string(input.Data))
+	metadata, _ := runner.MetadataFromContext(ctx)
+	s.metadata = append(s.metadata, metadata)
+	return &fnrun.Result{}, nil
+}
+
+func (s *flakySink) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *flakySink) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.inputs...)
+}
+
+func waitForInputs(t *testing.T, sink *flakySink, count int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if received := sink.received(); len(received) >= count {
+			return received
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d inputs, got %v", count, sink.received())
+	return nil
+}
+
+func TestDiskQueueSpoolsDuringSinkOutageAndReplaysOnRestart(t *testing.T) {
+	dir := t.TempDir()
+	sink := &flakySink{down: true}
+
+	queue, err := openDiskQueue(sink, dir, 0, 1000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.start()
+	for i := 0; i < 3; i++ {
+		ctx := runner.WithMetadata(context.Background(), map[string]string{"n": fmt.Sprint(i)})
+		result, err := queue.Invoke(ctx, &fnrun.Input{Data: []byte(fmt.Sprint("event-", i))})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Status != 0 || len(result.Data) != 0 {
+			t.Errorf("expected an empty result, got %+v", result)
+		}
+	}
+	if err := queue.close(); err != nil {
+		t.Fatal(err)
+	}
+	if received := sink.received(); len(received) != 0 {
+		t.Fatalf("expected no deliveries during the outage, got %v", received)
+	}
+
+	sink.setDown(false)
+	queue, err = openDiskQueue(sink, dir, 0, 1000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.close()
+	queue.start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := queue.waitReplayed(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	received := waitForInputs(t, sink, 3)
+	for i, input := range received {
+		if want := fmt.Sprint("event-", i); input != want {
+			t.Errorf("expected input %d to be %q, got %q", i, want, input)
+		}
+		if sink.metadata[i]["n"] != fmt.Sprint(i) {
+			t.Errorf("expected the metadata of input %d to be restored, got %v", i, sink.metadata[i])
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(dir, diskQueueLogName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("expected the log to be truncated, got %d bytes", info.Size())
+	}
+}
+
+func TestDiskQueueDeadLettersAfterMaxAttempts(t *testing.T) {
+	sink := &flakySink{down: true}
+	deadLettered := make(chan *fnrun.Result, 1)
+	deadLetterSink := func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		deadLettered <- result
+		return result, nil
+	}
+
+	queue, err := openDiskQueue(sink, t.TempDir(), 0, 2, deadLetterSink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.close()
+	queue.start()
+
+	if _, err := queue.Invoke(context.Background(), &fnrun.Input{Data: []byte("poison")}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case result := <-deadLettered:
+		if string(result.Data) != "poison" {
+			t.Errorf("expected the input to be dead-lettered, got %q", result.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event to be dead-lettered")
+	}
+
+	sink.setDown(false)
+	if _, err := queue.Invoke(context.Background(), &fnrun.Input{Data: []byte("next")}); err != nil {
+		t.Fatal(err)
+	}
+	if received := waitForInputs(t, sink, 1); received[0] != "next" {
+		t.Errorf("expected the next event to be processed, got %v", received)
+	}
+}
+
+func TestDiskQueueRejectsEventsWhenFull(t *testing.T) {
+	queue, err := openDiskQueue(&flakySink{down: true}, t.TempDir(), 64, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.close()
+
+	if _, err := queue.Invoke(context.Background(), &fnrun.Input{Data: []byte("small")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := queue.Invoke(context.Background(), &fnrun.Input{Data: make([]byte, 64)}); err != errDiskQueueFull {
+		t.Errorf("expected errDiskQueueFull, got %v", err)
+	}
+}
+
+func TestDiskQueueDiscardsPartialRecordOnRecovery(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := openDiskQueue(&flakySink{down: true}, dir, 0, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Invoke(context.Background(), &fnrun.Input{Data: []byte("whole")}); err != nil {
+		t.Fatal(err)
+	}
+	queue.close()
+
+	path := filepath.Join(dir, diskQueueLogName)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{0, 0, 0, 100, '{'})
+	file.Close()
+
+	sink := &flakySink{}
+	queue, err = openDiskQueue(sink, dir, 0, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.close()
+	queue.start()
+
+	if received := waitForInputs(t, sink, 1); len(received) != 1 || received[0] != "whole" {
+		t.Errorf("expected only the whole record to be replayed, got %v", received)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state")
+
+	for _, contents := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(contents)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents {
+			t.Errorf("expected %q, got %q", contents, data)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left, got %d entries", len(entries))
+	}
+}
+
+// gatedSink reports each input that reaches it on seen and completes it only
+// once it is released.
+type gatedSink struct {
+	seen    chan string
+	release chan struct{}
+}
+
+func (s *gatedSink) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	s.seen <- string(input.Data)
+	select {
+	case <-s.release:
+		return &fnrun.Result{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestDiskQueueLimitsPendingEventsAndCompactsTheLog(t *testing.T) {
+	payload, err := json.Marshal(diskQueueRecord{Data: []byte("event-0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordSize := int64(diskQueueRecordHeader + len(payload))
+
+	dir := t.TempDir()
+	sink := &gatedSink{seen: make(chan string), release: make(chan struct{})}
+	queue, err := openDiskQueue(sink, dir, 2*recordSize, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.compactBytes = 1
+	defer queue.close()
+	queue.start()
+
+	invoke := func(i int) error {
+		_, err := queue.Invoke(context.Background(), &fnrun.Input{Data: []byte(fmt.Sprint("event-", i))})
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if err := invoke(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The queue never empties, since the next event is always pending while
+	// one is being processed.
+	for i := 2; i < 10; i++ {
+		if got, want := <-sink.seen, fmt.Sprint("event-", i-2); got != want {
+			t.Fatalf("expected %s to be processed, got %s", want, got)
+		}
+		if err := invoke(i); err != errDiskQueueFull {
+			t.Fatalf("expected errDiskQueueFull with 2 pending events, got %v", err)
+		}
+		sink.release <- struct{}{}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			err := invoke(i)
+			if err == nil {
+				break
+			}
+			if err != errDiskQueueFull || time.Now().After(deadline) {
+				t.Fatalf("expected event %d to be accepted once an event was processed, got %v", i, err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		info, err := os.Stat(filepath.Join(dir, diskQueueLogName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 2*recordSize {
+			t.Errorf("expected the log to be compacted to the pending events, got %d bytes", info.Size())
+		}
+	}
+
+	for i := 8; i < 10; i++ {
+		if got, want := <-sink.seen, fmt.Sprint("event-", i); got != want {
+			t.Fatalf("expected %s to be processed, got %s", want, got)
+		}
+		sink.release <- struct{}{}
+	}
+}
+
+func TestDiskQueueReplaysCompactedLogOnRestart(t *testing.T) {
+	dir := t.TempDir()
+	sink := &gatedSink{seen: make(chan string), release: make(chan struct{})}
+	queue, err := openDiskQueue(sink, dir, 0, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.compactBytes = 1
+	queue.start()
+	for i := 0; i < 3; i++ {
+		if _, err := queue.Invoke(context.Background(), &fnrun.Input{Data: []byte(fmt.Sprint("event-", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-sink.seen
+	sink.release <- struct{}{}
+	<-sink.seen
+	sink.release <- struct{}{}
+	<-sink.seen
+	if err := queue.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := &flakySink{}
+	queue, err = openDiskQueue(replayed, dir, 0, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.close()
+	queue.start()
+	if received := waitForInputs(t, replayed, 1); len(received) != 1 || received[0] != "event-2" {
+		t.Errorf("expected only the unprocessed event to be replayed, got %v", received)
+	}
+}
+
+func TestDiskQueueRetriesEventsThatCannotBeRead(t *testing.T) {
+	out := captureLog(t)
+	dir := t.TempDir()
+	sink := &flakySink{}
+	queue, err := openDiskQueue(sink, dir, 0, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Invoke(context.Background(), &fnrun.Input{Data: []byte("event")}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, diskQueueLogName)
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	queue.start()
+
+	// The record cannot be read until the log is restored after the first
+	// retry.
+	time.Sleep(2 * diskQueueMinBackoff)
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if received := waitForInputs(t, sink, 1); received[0] != "event" {
+		t.Errorf("expected the event to be delivered once it could be read, got %v", received)
+	}
+
+	if err := queue.close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "could not read from disk queue; retrying") {
+		t.Errorf("expected the read error to be logged, got %q", out.String())
+	}
+}
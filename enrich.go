@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime/debug"
+
+	"github.com/tessellator/fnrun"
+)
+
+// Keys of the runner metadata added to the env of each result.
+const (
+	runnerVersionKey = "x-runner-version"
+	runnerEnvKey     = "x-runner-env"
+	invokerPIDKey    = "x-invoker-pid"
+	nodeIDKey        = "x-node-id"
+)
+
+// -----------------------------------------------------------------------------
+// Enrichment Invoker
+//
+// The enrichment invoker adds metadata describing the runner to the env of each
+// result before it is delivered to the sink, so that functions need not know
+// where they ran. The runner version is the module version recorded in the
+// build info, the environment is the value of RUNNER_ENV, and the node ID is
+// the value of NODE_ID or, if that is unset, the host name. The PID of the
+// function process that produced the result is added by the invoker of that
+// process, since it is not known at this layer; results of invokers without a
+// process, such as plugins, do not have one.
+
+type enrichInvoker struct {
+	invoker fnrun.Invoker
+	fields  map[string]string
+}
+
+func newEnrichInvoker(invoker fnrun.Invoker) *enrichInvoker {
+	fields := make(map[string]string, 3)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fields[runnerVersionKey] = info.Main.Version
+	}
+	// env: RUNNER_ENV string "" "Environment name added to the env of each result as x-runner-env."
+	if env := os.Getenv("RUNNER_ENV"); env != "" {
+		fields[runnerEnvKey] = env
+	}
+	// env: NODE_ID string "" "Node ID added to the env of each result as x-node-id; the host name is used when unset."
+	nodeID := os.Getenv("NODE_ID")
+	if nodeID == "" {
+		nodeID, _ = os.Hostname()
+	}
+	if nodeID != "" {
+		fields[nodeIDKey] = nodeID
+	}
+
+	return &enrichInvoker{invoker: invoker, fields: fields}
+}
+
+func (ei *enrichInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	result, err := ei.invoker.Invoke(ctx, input)
+	if result == nil {
+		return result, err
+	}
+
+	return withResultEnv(result, ei.fields), err
+}
+
+// withResultEnv returns a copy of result whose env also contains fields. The
+// env of result is not modified, since it may be shared with other results.
+func withResultEnv(result *fnrun.Result, fields map[string]string) *fnrun.Result {
+	env := make(map[string]string, len(result.Env)+len(fields))
+	for k, v := range result.Env {
+		env[k] = v
+	}
+	for k, v := range fields {
+		env[k] = v
+	}
+
+	enriched := *result
+	enriched.Env = env
+	return &enriched
+}
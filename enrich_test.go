@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestEnrichInvokerAddsRunnerMetadata(t *testing.T) {
+	t.Setenv("RUNNER_ENV", "staging")
+	t.Setenv("NODE_ID", "node-7")
+	pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo"), time.Second, nil)
+	})
+	defer pool.Close()
+
+	result, err := newEnrichInvoker(pool).Invoke(context.Background(), &fnrun.Input{Data: []byte("x")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, key := range []string{runnerVersionKey, runnerEnvKey, invokerPIDKey, nodeIDKey} {
+		if _, ok := result.Env[key]; !ok {
+			t.Errorf("expected the result to carry %s, got %v", key, result.Env)
+		}
+	}
+	if env := result.Env[runnerEnvKey]; env != "staging" {
+		t.Errorf("expected %s to be staging, got %q", runnerEnvKey, env)
+	}
+	if nodeID := result.Env[nodeIDKey]; nodeID != "node-7" {
+		t.Errorf("expected %s to be node-7, got %q", nodeIDKey, nodeID)
+	}
+	if pid, err := strconv.Atoi(result.Env[invokerPIDKey]); err != nil || pid <= 0 || pid == os.Getpid() {
+		t.Errorf("expected %s to be the PID of the function process, got %q", invokerPIDKey, result.Env[invokerPIDKey])
+	}
+}
+
+func TestEnrichInvokerDefaultsNodeIDToTheHostName(t *testing.T) {
+	t.Setenv("NODE_ID", "")
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("could not read the host name: %v", err)
+	}
+
+	result, err := newEnrichInvoker(echoInvoker{}).Invoke(context.Background(), &fnrun.Input{Data: []byte("x")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if nodeID := result.Env[nodeIDKey]; nodeID != hostname {
+		t.Errorf("expected %s to be %s, got %q", nodeIDKey, hostname, nodeID)
+	}
+}
+
+func TestEnrichInvokerDoesNotModifyTheResultEnv(t *testing.T) {
+	t.Setenv("NODE_ID", "node-7")
+	original := &fnrun.Result{Status: 200, Env: map[string]string{"x-custom": "kept"}}
+	invoker := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return original, nil
+	})
+
+	result, err := newEnrichInvoker(invoker).Invoke(context.Background(), &fnrun.Input{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Env["x-custom"] != "kept" || result.Env[nodeIDKey] != "node-7" {
+		t.Errorf("expected the env of the result and the runner metadata, got %v", result.Env)
+	}
+	if _, ok := original.Env[nodeIDKey]; ok {
+		t.Error("expected the env of the original result to be left unmodified")
+	}
+}
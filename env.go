@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// getFunctionEnv returns the environment to pass to function processes.
+//
+// By default the runner's whole environment is passed through. When
+// FUNCTION_ENV_ALLOWLIST (a comma-separated list of name prefixes) or
+// FUNCTION_ENV_REGEX (a regular expression matched against names) is set, only
+// variables whose names match at least one of them are included.
+func getFunctionEnv() ([]string, error) {
+	var prefixes []string
+	// env: FUNCTION_ENV_ALLOWLIST list "" "Comma-separated name prefixes of the variables passed to function processes."
+	if allowlist := os.Getenv("FUNCTION_ENV_ALLOWLIST"); allowlist != "" {
+		prefixes = strings.Split(allowlist, ",")
+	}
+
+	var pattern *regexp.Regexp
+	// env: FUNCTION_ENV_REGEX string "" "Regular expression matching the names of the variables passed to function processes."
+	if expr := os.Getenv("FUNCTION_ENV_REGEX"); expr != "" {
+		var err error
+		pattern, err = regexp.Compile(expr)
+		if err != nil {
+			return nil, configErrorf("FUNCTION_ENV_REGEX", "FUNCTION_ENV_REGEX is not a valid regular expression: %v", err)
+		}
+	}
+
+	environ := os.Environ()
+	if prefixes == nil && pattern == nil {
+		return environ, nil
+	}
+
+	env := []string{}
+	for _, kv := range environ {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if matchesAnyPrefix(name, prefixes) || (pattern != nil && pattern.MatchString(name)) {
+			env = append(env, kv)
+		}
+	}
+
+	return env, nil
+}
+
+func matchesAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetFunctionEnvFiltersVariables(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist string
+		regex     string
+		included  []string
+		excluded  []string
+	}{
+		{
+			name:     "regex",
+			regex:    "^APP_",
+			included: []string{"APP_NAME", "APP_MODE"},
+			excluded: []string{"OTHER_APP_NAME", "SECRET"},
+		},
+		{
+			name:      "allowlist or regex",
+			allowlist: "OTHER_",
+			regex:     "^APP_",
+			included:  []string{"APP_NAME", "APP_MODE", "OTHER_APP_NAME"},
+			excluded:  []string{"SECRET"},
+		},
+		{
+			name:      "allowlist",
+			allowlist: "APP_N,SEC",
+			included:  []string{"APP_NAME", "SECRET"},
+			excluded:  []string{"APP_MODE", "OTHER_APP_NAME"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"APP_NAME", "APP_MODE", "OTHER_APP_NAME", "SECRET"} {
+				t.Setenv(name, "value")
+			}
+			t.Setenv("FUNCTION_ENV_ALLOWLIST", tt.allowlist)
+			t.Setenv("FUNCTION_ENV_REGEX", tt.regex)
+
+			env, err := getFunctionEnv()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			names := make(map[string]bool)
+			for _, kv := range env {
+				names[strings.SplitN(kv, "=", 2)[0]] = true
+			}
+			for _, name := range tt.included {
+				if !names[name] {
+					t.Errorf("expected %s to be included", name)
+				}
+			}
+			for _, name := range tt.excluded {
+				if names[name] {
+					t.Errorf("expected %s to be excluded", name)
+				}
+			}
+		})
+	}
+}
+
+func TestGetFunctionEnvPassesEverythingWithoutFilters(t *testing.T) {
+	t.Setenv("FUNCTION_ENV_ALLOWLIST", "")
+	t.Setenv("FUNCTION_ENV_REGEX", "")
+	t.Setenv("SECRET", "value")
+
+	env, err := getFunctionEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range env {
+		if kv == "SECRET=value" {
+			return
+		}
+	}
+	t.Error("expected every variable to be passed without filters")
+}
+
+func TestGetFunctionEnvRejectsInvalidRegex(t *testing.T) {
+	t.Setenv("FUNCTION_ENV_REGEX", "^APP_(")
+	if _, err := getFunctionEnv(); err == nil || !strings.Contains(err.Error(), "FUNCTION_ENV_REGEX") {
+		t.Errorf("expected a FUNCTION_ENV_REGEX error, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const correlationIDKey = "x-correlation-id"
+
+// -----------------------------------------------------------------------------
+// Envelope Invoker
+//
+// The envelope invoker is used in place of the sink invoker when results are
+// delivered to the sink in the standard envelope format. The sink receives the
+// envelope as the result data; the source still receives the unwrapped result.
+// The correlation ID and function version are read from the x-correlation-id
+// and x-function-version metadata keys.
+
+type envelopeInvoker struct {
+	invoker        fnrun.Invoker
+	sink           eventSinkTransformer
+	defaultVersion string
+	now            func() time.Time
+}
+
+func (ei *envelopeInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	inputSize.observe(float64(len(input.Data)))
+	start := ei.now()
+	result, err := ei.invoker.Invoke(withBaggageEnv(ctx), input)
+	if err != nil {
+		return result, err
+	}
+	if result != nil {
+		resultSize.observe(float64(len(result.Data)))
+	}
+	if ei.sink == nil || result == nil {
+		return result, nil
+	}
+	end := ei.now()
+
+	meta := runner.InvocationMeta{
+		ProcessedAt:     end,
+		Duration:        end.Sub(start),
+		FunctionVersion: ei.defaultVersion,
+	}
+	if metadata, ok := runner.MetadataFromContext(ctx); ok {
+		meta.CorrelationID = metadata[correlationIDKey]
+		if version := metadata[functionVersionKey]; version != "" {
+			meta.FunctionVersion = version
+		}
+	}
+
+	data, err := runner.WrapResult(result, meta)
+	if err != nil {
+		return result, err
+	}
+
+	observeSourceToSinkLatency(ctx)
+	// The sink receives the envelope rather than the result, so its output is
+	// not returned in place of the result.
+	if _, err := deliverToSink(ctx, ei.sink, &fnrun.Result{Status: result.Status, Data: data, Env: result.Env}); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
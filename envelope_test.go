@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestEnvelopeInvokerDeliversTheEnvelopeToTheSink(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	times := []time.Time{start, start.Add(1500 * time.Millisecond)}
+	var delivered *fnrun.Result
+	ei := &envelopeInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return &fnrun.Result{Status: 200, Data: []byte(`{"ok":true}`)}, nil
+		}),
+		sink: func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			delivered = result
+			return result, nil
+		},
+		defaultVersion: "v1",
+		now: func() time.Time {
+			now := times[0]
+			times = times[1:]
+			return now
+		},
+	}
+
+	ctx := runner.WithMetadata(context.Background(), map[string]string{
+		correlationIDKey:   "abc-123",
+		functionVersionKey: "v2",
+	})
+	result, err := ei.Invoke(ctx, &fnrun.Input{Data: []byte("in")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(result.Data) != `{"ok":true}` {
+		t.Errorf("expected the source to receive the unwrapped result, got %s", result.Data)
+	}
+	if delivered == nil {
+		t.Fatal("expected the envelope to be delivered to the sink")
+	}
+
+	var envelope runner.ResultEnvelope
+	if err := json.Unmarshal(delivered.Data, &envelope); err != nil {
+		t.Fatalf("expected the sink to receive an envelope, got %s: %v", delivered.Data, err)
+	}
+	if envelope.CorrelationID != "abc-123" {
+		t.Errorf("expected correlation ID abc-123, got %q", envelope.CorrelationID)
+	}
+	if !envelope.ProcessedAt.Equal(start.Add(1500 * time.Millisecond)) {
+		t.Errorf("expected the result to be processed at %v, got %v", start.Add(1500*time.Millisecond), envelope.ProcessedAt)
+	}
+	if envelope.DurationMs != 1500 {
+		t.Errorf("expected a duration of 1500ms, got %d", envelope.DurationMs)
+	}
+	if envelope.FunctionVersion != "v2" {
+		t.Errorf("expected the function version from the metadata, got %q", envelope.FunctionVersion)
+	}
+	if string(envelope.Body) != `{"ok":true}` {
+		t.Errorf("expected the JSON result to be embedded as is, got %s", envelope.Body)
+	}
+	if envelope.Error != nil {
+		t.Errorf("expected no error, got %q", *envelope.Error)
+	}
+}
+
+func TestWrapResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  *fnrun.Result
+		meta    runner.InvocationMeta
+		body    string
+		errText string
+		version string
+	}{
+		{
+			name:   "text body",
+			result: &fnrun.Result{Status: 200, Data: []byte("hello")},
+			body:   `"hello"`,
+		},
+		{
+			name:   "empty body",
+			result: &fnrun.Result{Status: 204},
+			body:   "null",
+		},
+		{
+			name:    "error status",
+			result:  &fnrun.Result{Status: 503, Data: []byte(`{"retry":true}`)},
+			meta:    runner.InvocationMeta{FunctionVersion: "v1"},
+			body:    `{"retry":true}`,
+			errText: "function returned status 503",
+			version: "v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := runner.WrapResult(tt.result, tt.meta)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var envelope runner.ResultEnvelope
+			if err := json.Unmarshal(data, &envelope); err != nil {
+				t.Fatal(err)
+			}
+			if string(envelope.Body) != tt.body {
+				t.Errorf("expected body %s, got %s", tt.body, envelope.Body)
+			}
+			switch {
+			case tt.errText == "" && envelope.Error != nil:
+				t.Errorf("expected no error, got %q", *envelope.Error)
+			case tt.errText != "" && (envelope.Error == nil || *envelope.Error != tt.errText):
+				t.Errorf("expected error %q, got %v", tt.errText, envelope.Error)
+			}
+			if envelope.FunctionVersion != tt.version {
+				t.Errorf("expected function version %q, got %q", tt.version, envelope.FunctionVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Sink Error Budget
+//
+// The error budget tracker counts successful and failed deliveries to the sink
+// over a sliding window of one-minute buckets. When the proportion of failures
+// in the window exceeds the budget, the budget is exhausted: a CRITICAL message
+// is logged and, if an alert sink is configured, the status of the budget is
+// delivered to it as JSON. The alert is raised once per exhaustion; the budget
+// is only exhausted again after the error rate has returned within it.
+
+type errorBudgetStatus struct {
+	BudgetPercent    float64   `json:"budget_percent"`
+	ErrorRatePercent float64   `json:"error_rate_percent"`
+	Successes        int       `json:"successes"`
+	Failures         int       `json:"failures"`
+	WindowMinutes    int       `json:"window_minutes"`
+	ExhaustedAt      time.Time `json:"exhausted_at"`
+}
+
+type errorBudgetBucket struct {
+	minute    int64
+	successes int
+	failures  int
+}
+
+type errorBudgetTracker struct {
+	budget    float64
+	alertSink eventSinkTransformer
+	now       func() time.Time
+	mu        sync.Mutex
+	buckets   []errorBudgetBucket
+	exhausted bool
+}
+
+func newErrorBudgetTracker(budgetPercent float64, windowMinutes int, alertSink eventSinkTransformer) *errorBudgetTracker {
+	if windowMinutes < 1 {
+		windowMinutes = 1
+	}
+
+	return &errorBudgetTracker{
+		budget:    budgetPercent,
+		alertSink: alertSink,
+		now:       time.Now,
+		buckets:   make([]errorBudgetBucket, windowMinutes),
+	}
+}
+
+func getAlertSink() (eventSinkTransformer, error) {
+	// env: ALERT_SINK_PLUGIN_PATH string "" "Plugin containing the sink that receives sink error budget alerts."
+	path := os.Getenv("ALERT_SINK_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil
+	}
+
+	// env: ALERT_SINK_PLUGIN_SYMBOL string "" "Symbol of the alert sink in ALERT_SINK_PLUGIN_PATH."
+	return loadEventSink(path, os.Getenv("ALERT_SINK_PLUGIN_SYMBOL"))
+}
+
+// trackErrorBudget returns a sink that delivers results to sink and records the
+// outcome of each delivery with the tracker.
+func trackErrorBudget(sink eventSinkTransformer, tracker *errorBudgetTracker) eventSinkTransformer {
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		transformed, err := sink(ctx, result)
+		tracker.record(err != nil)
+		return transformed, err
+	}
+}
+
+func (t *errorBudgetTracker) record(failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	minute := now.Unix() / 60
+	bucket := &t.buckets[minute%int64(len(t.buckets))]
+	if bucket.minute != minute {
+		*bucket = errorBudgetBucket{minute: minute}
+	}
+	if failed {
+		bucket.failures++
+	} else {
+		bucket.successes++
+	}
+
+	status := errorBudgetStatus{
+		BudgetPercent: t.budget,
+		WindowMinutes: len(t.buckets),
+		ExhaustedAt:   now.UTC(),
+	}
+	oldest := minute - int64(len(t.buckets))
+	for _, bucket := range t.buckets {
+		if bucket.minute > oldest {
+			status.Successes += bucket.successes
+			status.Failures += bucket.failures
+		}
+	}
+	status.ErrorRatePercent = 100 * float64(status.Failures) / float64(status.Successes+status.Failures)
+
+	if status.ErrorRatePercent <= t.budget {
+		t.exhausted = false
+		return
+	}
+	if t.exhausted {
+		return
+	}
+	t.exhausted = true
+
+	log.Printf("CRITICAL: sink error budget exhausted: %.3f%% of %d deliveries failed in the last %d minute(s), exceeding the budget of %.3f%%",
+		status.ErrorRatePercent, status.Successes+status.Failures, status.WindowMinutes, t.budget)
+	if t.alertSink != nil {
+		go t.alert(status)
+	}
+}
+
+// alert delivers the status of an exhausted budget to the alert sink.
+func (t *errorBudgetTracker) alert(status errorBudgetStatus) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.Printf("could not encode error budget status: %v", err)
+		return
+	}
+
+	if _, err := t.alertSink(context.Background(), &fnrun.Result{Data: data}); err != nil {
+		log.Printf("could not deliver error budget alert: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// newTestErrorBudgetTracker returns a tracker whose clock is controlled by the
+// returned function, and a channel that receives the statuses delivered to the
+// alert sink.
+func newTestErrorBudgetTracker(budgetPercent float64, windowMinutes int) (*errorBudgetTracker, func(time.Duration), chan errorBudgetStatus) {
+	alerts := make(chan errorBudgetStatus, 10)
+	tracker := newErrorBudgetTracker(budgetPercent, windowMinutes, func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		var status errorBudgetStatus
+		if err := json.Unmarshal(result.Data, &status); err != nil {
+			return result, err
+		}
+		alerts <- status
+		return result, nil
+	})
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+	return tracker, func(d time.Duration) { now = now.Add(d) }, alerts
+}
+
+func recordDeliveries(tracker *errorBudgetTracker, successes int, failures int) {
+	for i := 0; i < successes; i++ {
+		tracker.record(false)
+	}
+	for i := 0; i < failures; i++ {
+		tracker.record(true)
+	}
+}
+
+func expectAlerts(t *testing.T, alerts chan errorBudgetStatus, n int) []errorBudgetStatus {
+	t.Helper()
+	var received []errorBudgetStatus
+	for len(received) < n {
+		select {
+		case status := <-alerts:
+			received = append(received, status)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d alert(s), got %d", n, len(received))
+		}
+	}
+	select {
+	case status := <-alerts:
+		t.Fatalf("expected %d alert(s), got another: %+v", n, status)
+	case <-time.After(50 * time.Millisecond):
+	}
+	return received
+}
+
+func TestErrorBudgetAlertsOncePerExhaustion(t *testing.T) {
+	tracker, _, alerts := newTestErrorBudgetTracker(10, 5)
+
+	// 1 failure in 10 deliveries is within a budget of 10%.
+	recordDeliveries(tracker, 9, 1)
+	expectAlerts(t, alerts, 0)
+
+	recordDeliveries(tracker, 0, 5)
+	status := expectAlerts(t, alerts, 1)[0]
+	if status.Successes != 9 || status.Failures != 2 || status.BudgetPercent != 10 || status.WindowMinutes != 5 {
+		t.Errorf("expected the status at the time of exhaustion, got %+v", status)
+	}
+
+	// The budget is exhausted again only after the error rate has returned
+	// within it.
+	recordDeliveries(tracker, 100, 0)
+	expectAlerts(t, alerts, 0)
+	recordDeliveries(tracker, 0, 10)
+	expectAlerts(t, alerts, 1)
+}
+
+func TestErrorBudgetForgetsDeliveriesOutsideTheWindow(t *testing.T) {
+	tracker, advance, alerts := newTestErrorBudgetTracker(10, 2)
+	recordDeliveries(tracker, 0, 1)
+	expectAlerts(t, alerts, 1)
+
+	advance(2 * time.Minute)
+	recordDeliveries(tracker, 1, 0)
+	tracker.mu.Lock()
+	exhausted := tracker.exhausted
+	tracker.mu.Unlock()
+	if exhausted {
+		t.Error("expected the failure outside the window to be forgotten")
+	}
+}
+
+func TestTrackErrorBudgetRecordsSinkOutcomes(t *testing.T) {
+	tracker, _, alerts := newTestErrorBudgetTracker(50, 1)
+	errFailed := errors.New("failed")
+	sink := trackErrorBudget(func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		if string(result.Data) == "fail" {
+			return result, errFailed
+		}
+		return result, nil
+	}, tracker)
+
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("ok")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("fail")}); err != errFailed {
+		t.Fatalf("expected the error of the sink, got %v", err)
+	}
+	expectAlerts(t, alerts, 0)
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("fail")}); err != errFailed {
+		t.Fatalf("expected the error of the sink, got %v", err)
+	}
+	expectAlerts(t, alerts, 1)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/tessellator/fnrun"
+)
+
+// errorHandlerInput is the input provided to the error handler function.
+type errorHandlerInput struct {
+	Input  []byte `json:"input"`
+	Status int    `json:"status"`
+	Data   []byte `json:"data"`
+}
+
+// -----------------------------------------------------------------------------
+// Error Handler Invoker
+//
+// When the primary function returns a result with an error status, the error
+// handler invoker runs a secondary function with the original input and the
+// error result. The result of the error handler is sent only to the dead-letter
+// sink; the primary result is returned unchanged.
+
+type errorHandlerInvoker struct {
+	invoker        fnrun.Invoker
+	handler        fnrun.Invoker
+	deadLetterSink eventSinkTransformer
+}
+
+func (ei *errorHandlerInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	result, err := ei.invoker.Invoke(ctx, input)
+	if err != nil || result == nil || !isErrorStatus(result.Status) {
+		return result, err
+	}
+
+	data, marshalErr := json.Marshal(errorHandlerInput{Input: input.Data, Status: result.Status, Data: result.Data})
+	if marshalErr != nil {
+		log.Printf("could not encode error handler input: %v", marshalErr)
+		return result, err
+	}
+
+	handlerResult, handlerErr := ei.handler.Invoke(ctx, &fnrun.Input{Data: data})
+	if handlerErr != nil {
+		log.Printf("error handler invocation failed: %v", handlerErr)
+		return result, err
+	}
+
+	if ei.deadLetterSink != nil {
+		if _, sinkErr := deliverToDeadLetterSink(ctx, ei.deadLetterSink, handlerResult); sinkErr != nil {
+			log.Printf("dead-letter sink failed: %v", sinkErr)
+		}
+	}
+
+	return result, err
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestErrorHandlerInvokerHandlesErrorResults(t *testing.T) {
+	primary := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if string(input.Data) == "bad" {
+			return &fnrun.Result{Status: 422, Data: []byte("invalid input")}, nil
+		}
+		return &fnrun.Result{Status: 200, Data: input.Data}, nil
+	})
+
+	var handled []errorHandlerInput
+	handler := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		var handlerInput errorHandlerInput
+		if err := json.Unmarshal(input.Data, &handlerInput); err != nil {
+			t.Fatalf("could not decode handler input: %v", err)
+		}
+		handled = append(handled, handlerInput)
+		return &fnrun.Result{Status: 200, Data: []byte("notified")}, nil
+	})
+
+	var deadLettered []string
+	deadLetterSink := func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		deadLettered = append(deadLettered, string(result.Data))
+		return result, nil
+	}
+
+	ei := &errorHandlerInvoker{invoker: primary, handler: handler, deadLetterSink: deadLetterSink}
+
+	result, err := ei.Invoke(context.Background(), &fnrun.Input{Data: []byte("good")})
+	if err != nil || result.Status != 200 {
+		t.Fatalf("unexpected result %+v, %v", result, err)
+	}
+	if len(handled) != 0 {
+		t.Fatalf("expected successful results not to be handled, got %v", handled)
+	}
+
+	result, err = ei.Invoke(context.Background(), &fnrun.Input{Data: []byte("bad")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != 422 || string(result.Data) != "invalid input" {
+		t.Errorf("expected the primary result to be returned unchanged, got %+v", result)
+	}
+	if len(handled) != 1 {
+		t.Fatalf("expected the error handler to be invoked once, got %d", len(handled))
+	}
+	if h := handled[0]; string(h.Input) != "bad" || h.Status != 422 || string(h.Data) != "invalid input" {
+		t.Errorf("expected the handler to receive the input and error, got %+v", h)
+	}
+	if len(deadLettered) != 1 || deadLettered[0] != "notified" {
+		t.Errorf("expected the handler result to be dead-lettered, got %v", deadLettered)
+	}
+}
+
+func TestErrorHandlerInvokerIgnoresInfrastructureErrors(t *testing.T) {
+	var handled bool
+	ei := &errorHandlerInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return nil, errors.New("process exited")
+		}),
+		handler: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			handled = true
+			return &fnrun.Result{}, nil
+		}),
+	}
+
+	if _, err := ei.Invoke(context.Background(), &fnrun.Input{}); err == nil {
+		t.Error("expected the primary error to be returned")
+	}
+	if handled {
+		t.Error("expected the error handler not to be invoked")
+	}
+}
+
+func TestErrorHandlerInvokerIgnoresMissingResults(t *testing.T) {
+	ei := &errorHandlerInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return nil, nil
+		}),
+		handler: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			t.Error("expected the error handler not to be invoked")
+			return &fnrun.Result{}, nil
+		}),
+	}
+
+	if result, err := ei.Invoke(context.Background(), &fnrun.Input{}); result != nil || err != nil {
+		t.Errorf("expected no result and no error, got %+v, %v", result, err)
+	}
+}
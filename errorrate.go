@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Error rate monitor
+//
+// When ERROR_RATE_THRESHOLD is set, the error rate monitor tracks the outcome
+// of invocations over a rolling window. When the proportion of failed
+// invocations exceeds the pause threshold, calls to Invoke block until the
+// error rate in the window drops below the resume threshold. Because no new
+// invocations are made while the monitor is paused, this typically happens as
+// failures age out of the window.
+
+type errorRateBucket struct {
+	second int64
+	total  int
+	errors int
+}
+
+type errorRateMonitor struct {
+	invoker         fnrun.Invoker
+	pauseThreshold  float64
+	resumeThreshold float64
+	minInvocations  int
+	mu              sync.Mutex
+	buckets         []errorRateBucket
+	paused          bool
+	resumed         chan struct{}
+}
+
+func newErrorRateMonitor(invoker fnrun.Invoker, window time.Duration, pauseThreshold float64, resumeThreshold float64, minInvocations int) *errorRateMonitor {
+	seconds := int(window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return &errorRateMonitor{
+		invoker:         invoker,
+		pauseThreshold:  pauseThreshold,
+		resumeThreshold: resumeThreshold,
+		minInvocations:  minInvocations,
+		buckets:         make([]errorRateBucket, seconds),
+	}
+}
+
+func (m *errorRateMonitor) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	result, err := m.invoker.Invoke(ctx, input)
+	m.record(err != nil)
+	return result, err
+}
+
+// wait blocks while the monitor is paused.
+func (m *errorRateMonitor) wait(ctx context.Context) error {
+	for {
+		m.mu.Lock()
+		m.evaluate(time.Now())
+		if !m.paused {
+			m.mu.Unlock()
+			return nil
+		}
+		resumed := m.resumed
+		m.mu.Unlock()
+
+		select {
+		case <-resumed:
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *errorRateMonitor) record(failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	second := now.Unix()
+	bucket := &m.buckets[second%int64(len(m.buckets))]
+	if bucket.second != second {
+		*bucket = errorRateBucket{second: second}
+	}
+
+	bucket.total++
+	if failed {
+		bucket.errors++
+	}
+
+	m.evaluate(now)
+}
+
+// evaluate updates the paused state of the monitor. The caller must hold m.mu.
+func (m *errorRateMonitor) evaluate(now time.Time) {
+	oldest := now.Unix() - int64(len(m.buckets))
+	total, errors := 0, 0
+	for _, bucket := range m.buckets {
+		if bucket.second > oldest {
+			total += bucket.total
+			errors += bucket.errors
+		}
+	}
+
+	rate := 0.0
+	if total > 0 {
+		rate = float64(errors) / float64(total)
+	}
+
+	if !m.paused && total >= m.minInvocations && rate > m.pauseThreshold {
+		m.paused = true
+		m.resumed = make(chan struct{})
+		log.Printf("ALERT: error rate %.2f exceeded %.2f over %d invocations; pausing source", rate, m.pauseThreshold, total)
+	} else if m.paused && rate < m.resumeThreshold {
+		m.paused = false
+		close(m.resumed)
+		log.Printf("error rate %.2f dropped below %.2f; resuming source", rate, m.resumeThreshold)
+	}
+}
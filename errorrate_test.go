@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestErrorRateMonitorPausesAboveThreshold(t *testing.T) {
+	fail := true
+	m := newErrorRateMonitor(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if fail {
+			return nil, errors.New("failed")
+		}
+		return &fnrun.Result{}, nil
+	}), time.Minute, 0.5, 0.1, 4)
+
+	for i := 0; i < 4; i++ {
+		m.Invoke(context.Background(), &fnrun.Input{})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	fail = false
+	if _, err := m.Invoke(ctx, &fnrun.Input{}); err != context.DeadlineExceeded {
+		t.Errorf("expected the invocation to block while paused, got %v", err)
+	}
+}
+
+func TestErrorRateMonitorWaitsForMinimumInvocations(t *testing.T) {
+	m := newErrorRateMonitor(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return nil, errors.New("failed")
+	}), time.Minute, 0.5, 0.1, 10)
+
+	for i := 0; i < 9; i++ {
+		m.Invoke(context.Background(), &fnrun.Input{})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := m.Invoke(ctx, &fnrun.Input{}); err == nil || err == context.DeadlineExceeded {
+		t.Errorf("expected the invocation to be made, got %v", err)
+	}
+}
+
+func TestErrorRateMonitorResumesWhenFailuresAgeOut(t *testing.T) {
+	m := newErrorRateMonitor(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return nil, errors.New("failed")
+	}), time.Second, 0.5, 0.1, 2)
+
+	for i := 0; i < 2; i++ {
+		m.Invoke(context.Background(), &fnrun.Input{})
+	}
+
+	m.mu.Lock()
+	paused := m.paused
+	m.mu.Unlock()
+	if !paused {
+		t.Fatal("expected the monitor to be paused")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.wait(ctx); err != nil {
+		t.Errorf("expected the monitor to resume, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestConfigErrorsNameTheVariable(t *testing.T) {
+	t.Setenv("SOURCE_TYPE", "plugin")
+	t.Setenv("SOURCE_PLUGIN_PATH", "")
+
+	_, err := getEventSource(nil)
+	var configErr *runner.ConfigError
+	if !errors.As(fmt.Errorf("startup failed: %w", err), &configErr) {
+		t.Fatalf("expected a ConfigError, got %v", err)
+	}
+	if configErr.Name != "SOURCE_PLUGIN_PATH" || configErr.Error() != configErr.Unwrap().Error() {
+		t.Errorf("expected a ConfigError for SOURCE_PLUGIN_PATH with the message of the wrapped error, got %+v", configErr)
+	}
+}
+
+func TestPluginLoadErrorsNameThePlugin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.so")
+	t.Setenv("PLUGIN_ABI_CHECK", "false")
+	defer func() {
+		pluginsMu.Lock()
+		delete(plugins, path)
+		pluginsMu.Unlock()
+	}()
+
+	_, err := lookupPluginSymbol(path, "Source")
+	var loadErr *runner.PluginLoadError
+	if !errors.As(err, &loadErr) {
+		t.Fatalf("expected a PluginLoadError, got %v", err)
+	}
+	if loadErr.Path != path || loadErr.Unwrap() == nil {
+		t.Errorf("expected a PluginLoadError for %s wrapping the cause, got %+v", path, loadErr)
+	}
+}
+
+func TestInvocationErrorsRecordTheDuration(t *testing.T) {
+	failed := errors.New("function failed")
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return nil, failed
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	_, err = pool.Invoke(context.Background(), &fnrun.Input{})
+	var invocationErr *runner.InvocationError
+	if !errors.As(err, &invocationErr) {
+		t.Fatalf("expected an InvocationError, got %v", err)
+	}
+	if !errors.Is(err, failed) || invocationErr.Duration <= 0 {
+		t.Errorf("expected an InvocationError wrapping the failure with its duration, got %+v", invocationErr)
+	}
+}
+
+func TestSinkErrorsRecordTheDuration(t *testing.T) {
+	failed := errors.New("sink failed")
+	si := &sinkInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return &fnrun.Result{}, nil
+		}),
+		sink: func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			return nil, failed
+		},
+	}
+
+	_, err := si.Invoke(context.Background(), &fnrun.Input{})
+	var sinkErr *runner.SinkError
+	if !errors.As(err, &sinkErr) {
+		t.Fatalf("expected a SinkError, got %v", err)
+	}
+	if !errors.Is(err, failed) || sinkErr.Duration <= 0 || sinkErr.Error() != failed.Error() {
+		t.Errorf("expected a SinkError wrapping the failure with its duration, got %+v", sinkErr)
+	}
+}
+
+func TestPoolExhaustedErrorsRecordTheWait(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	t.Setenv("MAX_WAIT_MILLIS", "20")
+	t.Setenv("WAIT_JITTER_MILLIS", "0")
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		<-release
+		return &fnrun.Result{}, nil
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go pool.Invoke(context.Background(), &fnrun.Input{})
+	waitForBusyPool(t, pool)
+
+	_, err = pool.Invoke(context.Background(), &fnrun.Input{})
+	var exhaustedErr *runner.PoolExhaustedError
+	if !errors.As(err, &exhaustedErr) {
+		t.Fatalf("expected a PoolExhaustedError, got %v", err)
+	}
+	if !errors.Is(err, fnrun.ErrAvailabilityTimeout) || exhaustedErr.Waited < 20*time.Millisecond {
+		t.Errorf("expected a PoolExhaustedError wrapping the timeout with the time waited, got %+v", exhaustedErr)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Input Extraction Invoker
+//
+// Sources often deliver an event wrapped in an envelope, such as
+// {"event": {"data": ...}, "metadata": {...}}. The input extraction invoker
+// decodes each input as JSON and replaces it with the value at the JSON path
+// INPUT_BODY_JSONPATH, so that the function receives only the event. An input
+// without a value at that path fails.
+//
+// INPUT_METADATA_JSONPATH_MAP is a JSON object mapping metadata keys to JSON
+// paths in the envelope, such as {"x-correlation-id": "$.metadata.id"}, and
+// promotes the values at those paths to the metadata of the input. Paths
+// without a value are skipped. Either variable may be set without the other.
+//
+// A string value is used as it is, and any other value as its JSON encoding.
+
+type extractedField struct {
+	key  string
+	path []jsonPathStep
+}
+
+type inputExtractionInvoker struct {
+	invoker  fnrun.Invoker
+	body     []jsonPathStep
+	metadata []extractedField
+}
+
+func newInputExtractionInvoker(invoker fnrun.Invoker, bodySpec string, metadataSpec string) (*inputExtractionInvoker, error) {
+	ei := &inputExtractionInvoker{invoker: invoker}
+	if bodySpec != "" {
+		path, err := parseJSONPath(bodySpec)
+		if err != nil {
+			return nil, &runner.ConfigError{Name: "INPUT_BODY_JSONPATH", Err: err}
+		}
+		ei.body = path
+	}
+
+	if metadataSpec != "" {
+		var paths map[string]string
+		if err := json.Unmarshal([]byte(metadataSpec), &paths); err != nil {
+			return nil, configErrorf("INPUT_METADATA_JSONPATH_MAP", "INPUT_METADATA_JSONPATH_MAP must be a JSON object of metadata keys to JSON paths: %v", err)
+		}
+		for key, pathSpec := range paths {
+			path, err := parseJSONPath(pathSpec)
+			if err != nil {
+				return nil, configErrorf("INPUT_METADATA_JSONPATH_MAP", "Invalid JSON path for metadata %s: %v", key, err)
+			}
+			ei.metadata = append(ei.metadata, extractedField{key: key, path: path})
+		}
+		sort.Slice(ei.metadata, func(i, j int) bool { return ei.metadata[i].key < ei.metadata[j].key })
+	}
+	return ei, nil
+}
+
+func (ei *inputExtractionInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	decoder := json.NewDecoder(bytes.NewReader(input.Data))
+	decoder.UseNumber()
+	var envelope interface{}
+	if err := decoder.Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("input is not a JSON envelope: %v", err)
+	}
+
+	if len(ei.metadata) > 0 {
+		existing, _ := runner.MetadataFromContext(ctx)
+		metadata := make(map[string]string, len(existing)+len(ei.metadata))
+		for k, v := range existing {
+			metadata[k] = v
+		}
+		for _, field := range ei.metadata {
+			if value := lookupJSONPath(envelope, field.path); value != nil {
+				encoded, err := encodeExtractedValue(value)
+				if err != nil {
+					return nil, err
+				}
+				metadata[field.key] = string(encoded)
+			}
+		}
+		ctx = runner.WithMetadata(ctx, metadata)
+	}
+
+	if ei.body != nil {
+		value := lookupJSONPath(envelope, ei.body)
+		if value == nil {
+			return nil, fmt.Errorf("input has no value at INPUT_BODY_JSONPATH")
+		}
+		data, err := encodeExtractedValue(value)
+		if err != nil {
+			return nil, err
+		}
+		input = &fnrun.Input{Data: data}
+	}
+
+	return ei.invoker.Invoke(ctx, input)
+}
+
+func encodeExtractedValue(value interface{}) ([]byte, error) {
+	if str, ok := value.(string); ok {
+		return []byte(str), nil
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// extractInput invokes an input extraction invoker for bodySpec and
+// metadataSpec with data, under the metadata existing, and returns the input
+// and metadata that the function received.
+func extractInput(t *testing.T, bodySpec string, metadataSpec string, existing map[string]string, data string) (string, map[string]string, error) {
+	t.Helper()
+	var received string
+	var metadata map[string]string
+	invoker, err := newInputExtractionInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		received = string(input.Data)
+		metadata, _ = runner.MetadataFromContext(ctx)
+		return &fnrun.Result{Status: 200}, nil
+	}), bodySpec, metadataSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if existing != nil {
+		ctx = runner.WithMetadata(ctx, existing)
+	}
+	_, err = invoker.Invoke(ctx, &fnrun.Input{Data: []byte(data)})
+	return received, metadata, err
+}
+
+const testEnvelope = `{
+	"event": {"data": {"id": 12345678901234567890, "items": ["a", "b"]}, "name": "created"},
+	"metadata": {"id": "abc-123", "attempt": 2, "tags": {"env": "prod"}}
+}`
+
+func TestInputExtractionInvokerPassesOnlyTheInnerData(t *testing.T) {
+	received, _, err := extractInput(t, "$.event.data", "", nil, testEnvelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, received, `{"id": 12345678901234567890, "items": ["a", "b"]}`)
+	if !strings.Contains(received, "12345678901234567890") {
+		t.Errorf("expected large numbers to be kept exactly, got %s", received)
+	}
+}
+
+func TestInputExtractionInvokerExtractsValues(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"$.event.name", "created"},
+		{"$.event.data.items[1]", "b"},
+		{"$.event.data.items", `["a","b"]`},
+		{"$.metadata.attempt", "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			received, _, err := extractInput(t, tt.path, "", nil, testEnvelope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if received != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, received)
+			}
+		})
+	}
+}
+
+func TestInputExtractionInvokerPromotesMetadata(t *testing.T) {
+	received, metadata, err := extractInput(t,
+		"$.event.data.items[0]",
+		`{"x-correlation-id": "$.metadata.id", "x-attempt": "$.metadata.attempt", "x-tags": "$.metadata.tags", "x-missing": "$.metadata.none"}`,
+		map[string]string{"x-source": "queue", "x-attempt": "0"},
+		testEnvelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received != "a" {
+		t.Errorf("expected the body a, got %s", received)
+	}
+
+	want := map[string]string{
+		"x-source":         "queue",
+		"x-correlation-id": "abc-123",
+		"x-attempt":        "2",
+		"x-tags":           `{"env":"prod"}`,
+	}
+	if len(metadata) != len(want) {
+		t.Errorf("expected the metadata %v, got %v", want, metadata)
+	}
+	for key, value := range want {
+		if metadata[key] != value {
+			t.Errorf("expected %s to be %q, got %q", key, value, metadata[key])
+		}
+	}
+}
+
+func TestInputExtractionInvokerLeavesTheBodyWithoutBodyPath(t *testing.T) {
+	received, metadata, err := extractInput(t, "", `{"x-correlation-id": "$.metadata.id"}`, nil, testEnvelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received != testEnvelope {
+		t.Errorf("expected the envelope to be passed unchanged, got %s", received)
+	}
+	if metadata["x-correlation-id"] != "abc-123" {
+		t.Errorf("expected the correlation ID to be promoted, got %v", metadata)
+	}
+}
+
+func TestInputExtractionInvokerRejectsInputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"not JSON", "event", "input is not a JSON envelope"},
+		{"missing body", `{"event": {}}`, "input has no value at INPUT_BODY_JSONPATH"},
+		{"not an object", `["event"]`, "input has no value at INPUT_BODY_JSONPATH"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, _, err := extractInput(t, "$.event.data", "", nil, tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+			if received != "" {
+				t.Errorf("expected the function not to be invoked, got %s", received)
+			}
+		})
+	}
+}
+
+func TestNewInputExtractionInvokerConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		metadata string
+		wantName string
+		wantErr  string
+	}{
+		{"body without $", "event.data", "", "INPUT_BODY_JSONPATH", "must start with $"},
+		{"body index", "$.items[x]", "", "INPUT_BODY_JSONPATH", "invalid index"},
+		{"metadata not an object", "", `["$.id"]`, "INPUT_METADATA_JSONPATH_MAP", "must be a JSON object"},
+		{"metadata path", "", `{"x-id": "id"}`, "INPUT_METADATA_JSONPATH_MAP", "Invalid JSON path for metadata x-id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newInputExtractionInvoker(nil, tt.body, tt.metadata)
+			checkConfigError(t, err, tt.wantName, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+var sinkFailures = newCounterVec(
+	"fnrunner_sink_failures_total",
+	"Number of results that a sink of an independent fan-out failed to deliver.",
+	"sink",
+)
+
+// sinkErrors combines the errors returned by several sinks.
+type sinkErrors []error
+
+func (errs sinkErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Delivery semantics determine how many of the sinks of a fan-out must succeed
+// for the delivery to succeed.
+const (
+	deliverToAll    = "all"
+	deliverToAny    = "any"
+	deliverToQuorum = "quorum"
+)
+
+// requiredSuccesses returns the number of the n sinks of a fan-out that must
+// succeed under the given delivery semantics.
+func requiredSuccesses(semantics string, n int) (int, error) {
+	switch semantics {
+	case deliverToAll:
+		return n, nil
+	case deliverToAny:
+		return 1, nil
+	case deliverToQuorum:
+		return n/2 + 1, nil
+	default:
+		return 0, configErrorf("SINK_DELIVERY_SEMANTICS", "Unknown SINK_DELIVERY_SEMANTICS %s", semantics)
+	}
+}
+
+// fanoutSinks returns a sink that sends the result to every sink concurrently
+// and waits for all of them to complete. Each sink receives the same result,
+// which is also the result returned by the fanout sink. Every failure is
+// logged; if fewer than required sinks succeed, the returned error combines
+// all of the failures.
+func fanoutSinks(sinks []eventSinkTransformer, required int) eventSinkTransformer {
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		errs := make([]error, len(sinks))
+
+		var wg sync.WaitGroup
+		for i, sink := range sinks {
+			wg.Add(1)
+			go func(i int, sink eventSinkTransformer) {
+				defer wg.Done()
+				_, errs[i] = sink(ctx, result)
+			}(i, sink)
+		}
+		wg.Wait()
+
+		var failures sinkErrors
+		for i, err := range errs {
+			if err != nil {
+				log.Printf("sink %d failed: %v", i, err)
+				failures = append(failures, err)
+			}
+		}
+
+		if len(sinks)-len(failures) < required {
+			return result, failures
+		}
+		return result, nil
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Independent Sinks
+//
+// When SINK_INDEPENDENT_ERRORS is set, each sink of a fan-out handles its own
+// failures, so that one failing sink does not affect the others. Sink N,
+// counting from zero in SINK_PLUGIN_PATH, is retried up to SINK_<N>_RETRY_COUNT
+// times, waiting SINK_<N>_RETRY_BACKOFF_MILLIS between attempts. A result that
+// the sink still fails to deliver is counted and logged, and is delivered to
+// the dead-letter sink named by SINK_<N>_DEAD_LETTER_PLUGIN_PATH and
+// SINK_<N>_DEAD_LETTER_PLUGIN_SYMBOL, if one is configured. A result that
+// reaches the dead-letter sink counts as delivered for the delivery semantics
+// of the fan-out.
+
+// getIndependentSink wraps the sink at index i of a fan-out in the error
+// handling configured for it.
+func getIndependentSink(i int, sink eventSinkTransformer) (eventSinkTransformer, error) {
+	prefix := fmt.Sprintf("SINK_%d_", i)
+	// env: SINK_<N>_RETRY_COUNT int 0 "Number of times a failed delivery to the Nth sink is retried when SINK_INDEPENDENT_ERRORS is set."
+	retries := getIntEnv(prefix+"RETRY_COUNT", 0)
+	// env: SINK_<N>_RETRY_BACKOFF_MILLIS int 100 "Delay between retries of a delivery to the Nth sink when SINK_INDEPENDENT_ERRORS is set."
+	backoff := time.Duration(getIntEnv(prefix+"RETRY_BACKOFF_MILLIS", 100)) * time.Millisecond
+
+	var deadLetterSink eventSinkTransformer
+	// env: SINK_<N>_DEAD_LETTER_PLUGIN_PATH string "" "Plugin containing the dead letter sink of the Nth sink when SINK_INDEPENDENT_ERRORS is set."
+	if path := os.Getenv(prefix + "DEAD_LETTER_PLUGIN_PATH"); path != "" {
+		// env: SINK_<N>_DEAD_LETTER_PLUGIN_SYMBOL string "" "Symbol of the dead letter sink of the Nth sink."
+		symbolEnv := prefix + "DEAD_LETTER_PLUGIN_SYMBOL"
+		if os.Getenv(symbolEnv) == "" && !strings.HasPrefix(path, builtinSinkPrefix) {
+			return nil, configErrorf(symbolEnv, "%s is required when a %sDEAD_LETTER_PLUGIN_PATH is provided", symbolEnv, prefix)
+		}
+		var err error
+		if deadLetterSink, err = loadEventSink(path, os.Getenv(symbolEnv)); err != nil {
+			return nil, err
+		}
+	}
+
+	label := strconv.Itoa(i)
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		transformed, err := sink(ctx, result)
+		for attempt := 0; err != nil && attempt < retries; attempt++ {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return result, err
+			}
+			stats.recordRetry()
+			transformed, err = sink(ctx, result)
+		}
+		if err == nil {
+			return transformed, nil
+		}
+
+		sinkFailures.inc(label)
+		if deadLetterSink == nil {
+			return result, err
+		}
+		log.Printf("sink %d failed, delivering to its dead-letter sink: %v", i, err)
+		return deliverToDeadLetterSink(ctx, deadLetterSink, result)
+	}, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func sleepingSink(d time.Duration) eventSinkTransformer {
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		time.Sleep(d)
+		return result, nil
+	}
+}
+
+func TestFanoutSinksDeliverInParallel(t *testing.T) {
+	sink := fanoutSinks([]eventSinkTransformer{
+		sleepingSink(20 * time.Millisecond),
+		sleepingSink(20 * time.Millisecond),
+		sleepingSink(200 * time.Millisecond),
+	}, 3)
+
+	start := time.Now()
+	if _, err := sink(context.Background(), &fnrun.Result{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 200*time.Millisecond {
+		t.Errorf("expected the fan-out to wait for the slowest sink, took %v", elapsed)
+	}
+	if elapsed >= 240*time.Millisecond {
+		t.Errorf("expected the fan-out to take about as long as the slowest sink, took %v", elapsed)
+	}
+}
+
+func TestFanoutSinksCombineFailures(t *testing.T) {
+	failing := func(message string) eventSinkTransformer {
+		return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			return result, errors.New(message)
+		}
+	}
+	var delivered *fnrun.Result
+	sink := fanoutSinks([]eventSinkTransformer{
+		failing("first failed"),
+		func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			delivered = result
+			return result, nil
+		},
+		failing("third failed"),
+	}, 3)
+
+	original := &fnrun.Result{Data: []byte("x")}
+	result, err := sink(context.Background(), original)
+	if err == nil || err.Error() != "first failed; third failed" {
+		t.Errorf("expected the combined failures, got %v", err)
+	}
+	if result != original || delivered != original {
+		t.Error("expected every sink and the caller to see the same result")
+	}
+}
+
+func TestFanoutDeliverySemantics(t *testing.T) {
+	sinks := []eventSinkTransformer{
+		sleepingSink(0),
+		func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			return result, errors.New("second failed")
+		},
+		sleepingSink(0),
+	}
+
+	tests := []struct {
+		semantics string
+		wantErr   bool
+	}{
+		{deliverToAll, true},
+		{deliverToAny, false},
+		{deliverToQuorum, false},
+	}
+	for _, test := range tests {
+		t.Run(test.semantics, func(t *testing.T) {
+			required, err := requiredSuccesses(test.semantics, len(sinks))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = fanoutSinks(sinks, required)(context.Background(), &fnrun.Result{})
+			if (err != nil) != test.wantErr {
+				t.Errorf("expected an error: %v, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRequiredSuccesses(t *testing.T) {
+	tests := []struct {
+		semantics string
+		n         int
+		want      int
+	}{
+		{deliverToAll, 3, 3},
+		{deliverToAny, 3, 1},
+		{deliverToQuorum, 3, 2},
+		{deliverToQuorum, 4, 3},
+		{deliverToQuorum, 1, 1},
+	}
+	for _, test := range tests {
+		got, err := requiredSuccesses(test.semantics, test.n)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", test.semantics, err)
+		}
+		if got != test.want {
+			t.Errorf("expected %s of %d sinks to require %d successes, got %d", test.semantics, test.n, test.want, got)
+		}
+	}
+
+	if _, err := requiredSuccesses("most", 3); err == nil {
+		t.Error("expected an error for unknown delivery semantics")
+	}
+}
+
+// flakySinkCalls returns a sink that fails its first failures deliveries, and
+// a pointer to the number of times it was called.
+func flakySinkCalls(failures int) (eventSinkTransformer, *int32) {
+	var calls int32
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		if atomic.AddInt32(&calls, 1) <= int32(failures) {
+			return result, errors.New("sink failed")
+		}
+		return result, nil
+	}, &calls
+}
+
+func sinkFailureCount(label string) uint64 {
+	sinkFailures.mu.Lock()
+	defer sinkFailures.mu.Unlock()
+	return sinkFailures.values[label]
+}
+
+func TestIndependentSinksDoNotAffectEachOther(t *testing.T) {
+	t.Setenv("SINK_0_RETRY_COUNT", "")
+	t.Setenv("SINK_0_DEAD_LETTER_PLUGIN_PATH", "")
+	t.Setenv("SINK_1_RETRY_COUNT", "")
+	t.Setenv("SINK_1_DEAD_LETTER_PLUGIN_PATH", "")
+
+	failing, failingCalls := flakySinkCalls(1000)
+	var routed routedElements
+	sinks := []eventSinkTransformer{failing, routed.sink("working", nil)}
+	for i := range sinks {
+		var err error
+		if sinks[i], err = getIndependentSink(i, sinks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	required, err := requiredSuccesses(deliverToAny, len(sinks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := fanoutSinks(sinks, required)
+
+	before := sinkFailureCount("0")
+	for i := 0; i < 3; i++ {
+		if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("x")}); err != nil {
+			t.Errorf("expected the delivery to succeed while one sink works, got %v", err)
+		}
+	}
+	if got := len(routed.data["working"]); got != 3 {
+		t.Errorf("expected the working sink to receive every result, got %d", got)
+	}
+	if got := atomic.LoadInt32(failingCalls); got != 3 {
+		t.Errorf("expected the failing sink to be called once per result, got %d", got)
+	}
+	if got := sinkFailureCount("0") - before; got != 3 {
+		t.Errorf("expected 3 failures to be counted for sink 0, got %d", got)
+	}
+}
+
+func TestIndependentSinkRetries(t *testing.T) {
+	t.Setenv("SINK_0_RETRY_COUNT", "2")
+	t.Setenv("SINK_0_RETRY_BACKOFF_MILLIS", "1")
+	t.Setenv("SINK_0_DEAD_LETTER_PLUGIN_PATH", "")
+
+	for _, tt := range []struct {
+		failures  int
+		wantCalls int32
+		wantErr   bool
+	}{
+		{0, 1, false},
+		{2, 3, false},
+		{5, 3, true},
+	} {
+		flaky, calls := flakySinkCalls(tt.failures)
+		sink, err := getIndependentSink(0, flaky)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = sink(context.Background(), &fnrun.Result{})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("with %d failures, expected an error: %v, got %v", tt.failures, tt.wantErr, err)
+		}
+		if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+			t.Errorf("with %d failures, expected %d calls, got %d", tt.failures, tt.wantCalls, got)
+		}
+	}
+}
+
+func TestIndependentSinkDeliversToItsDeadLetterSink(t *testing.T) {
+	path := buildTestPlugin(t, "source")
+	t.Setenv("SINK_1_RETRY_COUNT", "")
+	t.Setenv("SINK_1_DEAD_LETTER_PLUGIN_PATH", path)
+	t.Setenv("SINK_1_DEAD_LETTER_PLUGIN_SYMBOL", "Discard")
+
+	failing, _ := flakySinkCalls(1000)
+	sink, err := getIndependentSink(1, failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sink(context.Background(), &fnrun.Result{}); err != nil {
+		t.Errorf("expected the dead-letter sink to take the result, got %v", err)
+	}
+}
+
+func TestIndependentSinkRequiresADeadLetterSymbol(t *testing.T) {
+	t.Setenv("SINK_0_DEAD_LETTER_PLUGIN_PATH", "dead-letter.so")
+	t.Setenv("SINK_0_DEAD_LETTER_PLUGIN_SYMBOL", "")
+
+	_, err := getIndependentSink(0, nil)
+	var configErr *runner.ConfigError
+	if !errors.As(err, &configErr) || configErr.Name != "SINK_0_DEAD_LETTER_PLUGIN_SYMBOL" {
+		t.Errorf("expected a SINK_0_DEAD_LETTER_PLUGIN_SYMBOL config error, got %v", err)
+	}
+}
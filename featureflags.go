@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"os"
+)
+
+// Features that can be switched per invocation by a feature flag plugin.
+const (
+	featureRetry = "retry"
+	featureDedup = "dedup"
+)
+
+// featureFlags reports whether a pipeline feature is enabled for the
+// invocation with the given context. It is called for every invocation that
+// reaches a feature, so it should be fast.
+type featureFlags func(ctx context.Context, feature string) bool
+
+func getFeatureFlags() (flags featureFlags, err error) {
+	// env: FEATURE_FLAG_PLUGIN_PATH string "" "Plugin containing the feature flag provider."
+	path := os.Getenv("FEATURE_FLAG_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	defer tracePluginLoad("load feature flag plugin", "FEATURE_FLAG_PLUGIN_PATH", "FEATURE_FLAG_PLUGIN_SYMBOL")(&err)
+
+	// env: FEATURE_FLAG_PLUGIN_SYMBOL string "" "Symbol of the feature flag provider in FEATURE_FLAG_PLUGIN_PATH."
+	symbolName := os.Getenv("FEATURE_FLAG_PLUGIN_SYMBOL")
+	if symbolName == "" {
+		return nil, configErrorf("FEATURE_FLAG_PLUGIN_SYMBOL", "FEATURE_FLAG_PLUGIN_SYMBOL is required when a FEATURE_FLAG_PLUGIN_PATH is provided")
+	}
+
+	symFlags, err := lookupPluginSymbol(path, symbolName)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := symFlags.(func(context.Context, string) bool)
+	if !ok {
+		return nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
+	}
+
+	return fn, nil
+}
+
+// enabled reports whether feature is enabled for the invocation with the given
+// context. Every feature is enabled when no feature flag plugin is configured.
+func (flags featureFlags) enabled(ctx context.Context, feature string) bool {
+	return flags == nil || flags(ctx, feature)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// alternatingFlags loads the feature flag provider of the test plugin, which
+// enables each feature on every other call. Other tests may have called it, so
+// the tests do not depend on whether the next call enables a feature.
+func alternatingFlags(t *testing.T) featureFlags {
+	t.Helper()
+	t.Setenv("FEATURE_FLAG_PLUGIN_PATH", buildTestPlugin(t, "source"))
+	t.Setenv("FEATURE_FLAG_PLUGIN_SYMBOL", "Alternate")
+	flags, err := getFeatureFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return flags
+}
+
+func TestFeatureFlagsSwitchRetriesPerInvocation(t *testing.T) {
+	var calls int
+	ri := &retryInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			calls++
+			return &fnrun.Result{Status: 429}, nil
+		}),
+		codes:   map[int]bool{429: true},
+		retries: 1,
+		backoff: time.Millisecond,
+		flags:   alternatingFlags(t),
+	}
+
+	// An invocation is retried once when retries are enabled, and invoked only
+	// once when they are disabled.
+	var perInvocation []int
+	for i := 0; i < 2; i++ {
+		calls = 0
+		if _, err := ri.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		perInvocation = append(perInvocation, calls)
+	}
+	sort.Ints(perInvocation)
+	if perInvocation[0] != 1 || perInvocation[1] != 2 {
+		t.Errorf("expected retries to be enabled for one of two invocations, got %v calls", perInvocation)
+	}
+}
+
+func TestFeatureFlagsSwitchDedupPerInvocation(t *testing.T) {
+	var invoked []bool
+	di := &dedupInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return &fnrun.Result{Status: 200}, nil
+		}),
+		seen:  &memorySeenSet{keys: make(map[string]bool)},
+		ttl:   time.Minute,
+		flags: alternatingFlags(t),
+	}
+
+	// Of four copies of an input, dedup is enabled for two. The first of those
+	// is processed and the second is skipped; the other two bypass dedup.
+	for i := 0; i < 4; i++ {
+		result, err := di.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		invoked = append(invoked, result.Status == 200)
+	}
+	var skipped int
+	for _, ok := range invoked {
+		if !ok {
+			skipped++
+		}
+	}
+	if skipped != 1 || !invoked[0] || !invoked[1] {
+		t.Errorf("expected only the second copy with dedup enabled to be skipped, got %v", invoked)
+	}
+}
+
+func TestFeatureFlagsEnableEveryFeatureWithoutAPlugin(t *testing.T) {
+	var flags featureFlags
+	if !flags.enabled(context.Background(), featureRetry) || !flags.enabled(context.Background(), featureDedup) {
+		t.Error("expected every feature to be enabled without a feature flag plugin")
+	}
+}
+
+func TestFeatureFlagsRequireASymbol(t *testing.T) {
+	t.Setenv("FEATURE_FLAG_PLUGIN_PATH", "flags.so")
+	_, err := getFeatureFlags()
+	var configErr *runner.ConfigError
+	if !errors.As(err, &configErr) || configErr.Name != "FEATURE_FLAG_PLUGIN_SYMBOL" {
+		t.Errorf("expected a ConfigError for FEATURE_FLAG_PLUGIN_SYMBOL, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/tessellator/fnrun"
+)
+
+var resultsFiltered = newCounter(
+	"fnrunner_results_filtered_total",
+	"Number of results dropped by the result filter instead of being delivered to the sink.",
+)
+
+// resultFilter reports whether a result should be delivered to the sink.
+type resultFilter func(ctx context.Context, result *fnrun.Result) bool
+
+func getResultFilter() (filter resultFilter, err error) {
+	// env: RESULT_FILTER_PLUGIN_PATH string "" "Plugin containing the filter that decides which results reach the sink."
+	path := os.Getenv("RESULT_FILTER_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	defer tracePluginLoad("load result filter plugin", "RESULT_FILTER_PLUGIN_PATH", "RESULT_FILTER_PLUGIN_SYMBOL")(&err)
+
+	// env: RESULT_FILTER_PLUGIN_SYMBOL string "" "Symbol of the result filter in RESULT_FILTER_PLUGIN_PATH."
+	symbolName := os.Getenv("RESULT_FILTER_PLUGIN_SYMBOL")
+	if symbolName == "" {
+		return nil, configErrorf("RESULT_FILTER_PLUGIN_SYMBOL", "RESULT_FILTER_PLUGIN_SYMBOL is required when a RESULT_FILTER_PLUGIN_PATH is provided")
+	}
+
+	symFilter, err := lookupPluginSymbol(path, symbolName)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := symFilter.(func(context.Context, *fnrun.Result) bool)
+	if !ok {
+		return nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
+	}
+
+	return fn, nil
+}
+
+// getDiscardSink loads the sink named by DISCARD_SINK_PLUGIN_PATH and
+// DISCARD_SINK_PLUGIN_SYMBOL, which receives the results dropped by the result
+// filter.
+func getDiscardSink() (sink eventSinkTransformer, err error) {
+	// env: DISCARD_SINK_PLUGIN_PATH string "" "Plugin containing the sink that receives results dropped by the result filter."
+	path := os.Getenv("DISCARD_SINK_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	defer tracePluginLoad("load discard sink plugin", "DISCARD_SINK_PLUGIN_PATH", "DISCARD_SINK_PLUGIN_SYMBOL")(&err)
+
+	// env: DISCARD_SINK_PLUGIN_SYMBOL string "" "Symbol of the discard sink in DISCARD_SINK_PLUGIN_PATH."
+	return loadEventSink(path, os.Getenv("DISCARD_SINK_PLUGIN_SYMBOL"))
+}
+
+// filterResults returns a sink that delivers the results accepted by filter to
+// sink. Other results are counted and delivered to the discard sink, if there
+// is one, or dropped; either way the primary sink is not called.
+func filterResults(sink eventSinkTransformer, filter resultFilter, discardSink eventSinkTransformer) eventSinkTransformer {
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		if filter(ctx, result) {
+			return sink(ctx, result)
+		}
+
+		resultsFiltered.inc()
+		if discardSink == nil {
+			return result, nil
+		}
+		return discardSink(ctx, result)
+	}
+}
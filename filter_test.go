@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func dropEmpty(ctx context.Context, result *fnrun.Result) bool {
+	return len(result.Data) > 0
+}
+
+func TestFilterResultsDropsRejectedResults(t *testing.T) {
+	var routed routedElements
+	sink := filterResults(routed.sink("primary", nil), dropEmpty, nil)
+
+	before := atomic.LoadUint64(&resultsFiltered.value)
+	for _, data := range []string{"a", "", "b", ""} {
+		result := &fnrun.Result{Data: []byte(data)}
+		returned, err := sink(context.Background(), result)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if returned != result {
+			t.Error("expected the result to be returned")
+		}
+	}
+
+	if got := routed.data["primary"]; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("expected only the non-empty results to reach the sink, got %q", got)
+	}
+	if filtered := atomic.LoadUint64(&resultsFiltered.value) - before; filtered != 2 {
+		t.Errorf("expected 2 filtered results to be counted, got %d", filtered)
+	}
+}
+
+func TestFilterResultsDeliversRejectedResultsToTheDiscardSink(t *testing.T) {
+	errDiscard := errors.New("discard sink failed")
+	var routed routedElements
+	sink := filterResults(routed.sink("primary", nil), dropEmpty, routed.sink("discard", errDiscard))
+
+	if _, err := sink(context.Background(), &fnrun.Result{}); err != errDiscard {
+		t.Errorf("expected the error of the discard sink, got %v", err)
+	}
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("a")}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(routed.data["discard"]) != 1 || len(routed.data["primary"]) != 1 {
+		t.Errorf("expected one result for each sink, got %v", routed.data)
+	}
+}
+
+func TestResultFilterPluginKeepsEmptyResultsFromTheSink(t *testing.T) {
+	t.Setenv("RESULT_FILTER_PLUGIN_PATH", buildTestPlugin(t, "source"))
+	t.Setenv("RESULT_FILTER_PLUGIN_SYMBOL", "DropEmpty")
+	t.Setenv("DISCARD_SINK_PLUGIN_PATH", "")
+
+	var calls int32
+	sink := func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		atomic.AddInt32(&calls, 1)
+		return result, nil
+	}
+	echo := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 200, Data: input.Data}, nil
+	})
+	pipeline, closer, err := getPipeline(echo, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+
+	if _, err := pipeline.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 0 {
+		t.Errorf("expected the sink not to be called for an empty result, got %d calls", got)
+	}
+	if _, err := pipeline.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("expected the sink to be called for a non-empty result, got %d calls", got)
+	}
+}
+
+func TestGetResultFilterErrors(t *testing.T) {
+	path := buildTestPlugin(t, "source")
+	tests := []struct {
+		path     string
+		symbol   string
+		wantName string
+	}{
+		{"filter.so", "", "RESULT_FILTER_PLUGIN_SYMBOL"},
+		{path, "Normalize", ""},
+		{path, "Missing", ""},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("RESULT_FILTER_PLUGIN_PATH", tt.path)
+		t.Setenv("RESULT_FILTER_PLUGIN_SYMBOL", tt.symbol)
+
+		_, err := getResultFilter()
+		if err == nil {
+			t.Errorf("expected an error for symbol %q", tt.symbol)
+			continue
+		}
+		var configErr *runner.ConfigError
+		if tt.wantName != "" && (!errors.As(err, &configErr) || configErr.Name != tt.wantName) {
+			t.Errorf("expected a %s config error, got %v", tt.wantName, err)
+		}
+	}
+
+	t.Setenv("RESULT_FILTER_PLUGIN_PATH", "")
+	if filter, err := getResultFilter(); filter != nil || err != nil {
+		t.Errorf("expected no filter, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun/fnrun/protobufs"
+	"github.com/tessellator/protoio"
+)
+
+// testFunctionEnv selects the behavior of the test binary when it is run as a
+// function process by testFunctionCmd.
+const testFunctionEnv = "FNRUN_TEST_FUNCTION"
+
+func TestMain(m *testing.M) {
+	// Function processes with resource limits are started through the rlimit
+	// trampoline of the test binary.
+	if len(os.Args) > 2 && os.Args[1] == rlimitExecArg {
+		if err := runRlimitTrampoline(os.Args[2:]); err != nil {
+			os.Exit(1)
+		}
+	}
+	if behavior := os.Getenv(testFunctionEnv); behavior != "" {
+		runTestFunction(behavior)
+		os.Exit(0)
+	}
+	code := m.Run()
+	removeTestPlugins()
+	os.Exit(code)
+}
+
+// testFunctionCmd returns a command that runs the test binary as a function
+// process with the given behavior:
+//
+//   - echo responds with the input.
+//   - args responds with the arguments of the process, separated by spaces.
+//   - prefix responds with the input prefixed by the arguments of the process.
+//   - env responds with the execution context env as a JSON object.
+//   - proc-status responds with the content of /proc/self/status.
+//   - alloc allocates and touches the number of bytes given in the input.
+//   - shared-mem responds with as many bytes of the shared memory region as
+//     the input has, and then writes the input to the region after them.
+//
+// Every behavior first sleeps for FNRUN_TEST_SLEEP_MS, and ignores SIGTERM if
+// FNRUN_TEST_IGNORE_SIGTERM is set.
+func testFunctionCmd(behavior string, env ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(append(os.Environ(), testFunctionEnv+"="+behavior), env...)
+	return cmd
+}
+
+func runTestFunction(behavior string) {
+	if os.Getenv("FNRUN_TEST_IGNORE_SIGTERM") != "" {
+		signal.Ignore(syscall.SIGTERM)
+	}
+	sleep, _ := strconv.Atoi(os.Getenv("FNRUN_TEST_SLEEP_MS"))
+
+	for {
+		event := protobufs.Event{}
+		execCtx := protobufs.ExecutionContext{}
+		if err := protoio.Read(os.Stdin, &event); err != nil {
+			return
+		}
+		if err := protoio.Read(os.Stdin, &execCtx); err != nil {
+			return
+		}
+		time.Sleep(time.Duration(sleep) * time.Millisecond)
+
+		result := protobufs.Result{Status: 200, Data: event.GetData()}
+		switch behavior {
+		case "args":
+			result.Data = []byte(strings.Join(os.Args[1:], " "))
+		case "prefix":
+			result.Data = append([]byte(strings.Join(os.Args[1:], " ")), event.GetData()...)
+		case "env":
+			env := make(map[string]string)
+			for _, v := range execCtx.GetEnvVars() {
+				env[v.GetName()] = v.GetValue()
+			}
+			result.Data, _ = json.Marshal(env)
+		case "proc-status":
+			result.Data, _ = ioutil.ReadFile("/proc/self/status")
+		case "alloc":
+			n, _ := strconv.Atoi(string(event.GetData()))
+			buf := make([]byte, n)
+			for i := 0; i < len(buf); i += 4096 {
+				buf[i] = 1
+			}
+		case "shared-mem":
+			result.Data = []byte(accessSharedMemory(event.GetData()))
+		}
+		protoio.Write(os.Stdout, &result)
+	}
+}
+
+// accessSharedMemory maps the shared memory region named by
+// FNRUN_SHARED_MEM_PATH, reads len(data) bytes from its start and writes data
+// after them. It returns the bytes read, or a description of the failure.
+func accessSharedMemory(data []byte) string {
+	file, err := os.OpenFile(os.Getenv(sharedMemoryEnvName), os.O_RDWR, 0)
+	if err != nil {
+		return err.Error()
+	}
+	defer file.Close()
+	region, err := mapSharedMemory(file, 2*len(data))
+	if err != nil {
+		return err.Error()
+	}
+	defer unmapSharedMemory(region)
+
+	read := string(region[:len(data)])
+	copy(region[len(data):], data)
+	return read
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Sink Ring
+//
+// The sink ring partitions results across several sinks, such as one for each
+// partition of a topic. Each sink owns a range of the ring whose size is its
+// weight, and a result is delivered to the sink that owns the point at the
+// FNV-1a hash of its correlation ID modulo the total weight. Results with the
+// same correlation ID are therefore always delivered to the same sink, in
+// order; results without one all go to the same sink.
+//
+// The ring is configured as a comma-separated list of name:weight entries, in
+// the order in which the sinks own the ring. The weight may be omitted and
+// defaults to 1. Each sink is loaded as it is for the output router, and backs
+// off separately when SINK_BACKOFF_THRESHOLD is set.
+
+type ringSegment struct {
+	end  uint64
+	sink eventSinkTransformer
+}
+
+func getSinkRing(spec string) (eventSinkTransformer, error) {
+	backoff, err := getSinkBackoff()
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []ringSegment
+	var total uint64
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, weight := entry, uint64(1)
+		if i := strings.LastIndex(entry, ":"); i >= 0 {
+			var err error
+			name = entry[:i]
+			weight, err = strconv.ParseUint(entry[i+1:], 10, 64)
+			if err != nil || weight == 0 {
+				return nil, configErrorf("SINK_RING", "Invalid weight in SINK_RING entry %s", entry)
+			}
+		}
+
+		sink, err := loadNamedSink(name, "SINK_RING")
+		if err != nil {
+			return nil, err
+		}
+
+		total += weight
+		segments = append(segments, ringSegment{end: total, sink: backoff.wrap(name, sink)})
+	}
+
+	if len(segments) == 0 {
+		return nil, configErrorf("SINK_RING", "SINK_RING does not name any sinks")
+	}
+
+	return newSinkRing(segments, total), nil
+}
+
+func newSinkRing(segments []ringSegment, total uint64) eventSinkTransformer {
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		correlationID := ""
+		if metadata, ok := runner.MetadataFromContext(ctx); ok {
+			correlationID = metadata[correlationIDKey]
+		}
+
+		hash := fnv.New64a()
+		hash.Write([]byte(correlationID))
+		point := hash.Sum64() % total
+
+		i := sort.Search(len(segments), func(i int) bool { return point < segments[i].end })
+		return segments[i].sink(ctx, result)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// deliverWithCorrelationID delivers a result whose data is id to sink, with id
+// as the correlation ID of the delivery.
+func deliverWithCorrelationID(t *testing.T, sink eventSinkTransformer, id string) {
+	t.Helper()
+	ctx := runner.WithMetadata(context.Background(), map[string]string{correlationIDKey: id})
+	if _, err := sink(ctx, &fnrun.Result{Status: 200, Data: []byte(id)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSinkRingMapsACorrelationIDToTheSameSink(t *testing.T) {
+	var routed routedElements
+	sink := newSinkRing([]ringSegment{
+		{end: 1, sink: routed.sink("a", nil)},
+		{end: 2, sink: routed.sink("b", nil)},
+		{end: 3, sink: routed.sink("c", nil)},
+	}, 3)
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 100; i++ {
+			deliverWithCorrelationID(t, sink, fmt.Sprintf("id-%d", i))
+		}
+	}
+
+	owners := make(map[string]string)
+	for name, ids := range routed.data {
+		for _, id := range ids {
+			if owner, ok := owners[id]; ok && owner != name {
+				t.Fatalf("expected %s to always be delivered to %s, got %s", id, owner, name)
+			}
+			owners[id] = name
+		}
+	}
+	if len(owners) != 100 {
+		t.Errorf("expected 100 correlation IDs to be delivered, got %d", len(owners))
+	}
+	if len(routed.data) != 3 {
+		t.Errorf("expected results to be spread across all sinks, got %d sinks", len(routed.data))
+	}
+}
+
+func TestSinkRingDistributesResultsByWeight(t *testing.T) {
+	var routed routedElements
+	sink := newSinkRing([]ringSegment{
+		{end: 1, sink: routed.sink("light", nil)},
+		{end: 4, sink: routed.sink("heavy", nil)},
+	}, 4)
+
+	const count = 4000
+	for i := 0; i < count; i++ {
+		deliverWithCorrelationID(t, sink, fmt.Sprintf("order-%d", i))
+	}
+
+	share := float64(len(routed.data["heavy"])) / count
+	if math.Abs(share-0.75) > 0.05 {
+		t.Errorf("expected the heavy sink to get about 75%% of the results, got %.1f%%", share*100)
+	}
+}
+
+func TestSinkRingDeliversResultsWithoutACorrelationIDToOneSink(t *testing.T) {
+	var routed routedElements
+	sink := newSinkRing([]ringSegment{
+		{end: 1, sink: routed.sink("a", nil)},
+		{end: 2, sink: routed.sink("b", nil)},
+	}, 2)
+
+	for i := 0; i < 10; i++ {
+		if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("x")}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(routed.data) != 1 {
+		t.Errorf("expected every result to go to the same sink, got %v", routed.data)
+	}
+}
+
+func TestSinkRingReturnsTheErrorOfTheSink(t *testing.T) {
+	errSink := errors.New("sink failed")
+	var routed routedElements
+	sink := newSinkRing([]ringSegment{{end: 1, sink: routed.sink("a", errSink)}}, 1)
+
+	if _, err := sink(context.Background(), &fnrun.Result{}); err != errSink {
+		t.Errorf("expected the sink error, got %v", err)
+	}
+}
+
+func TestGetSinkRingLoadsEachSink(t *testing.T) {
+	path := buildTestPlugin(t, "source")
+	t.Setenv("SINK_BACKOFF_THRESHOLD", "")
+	for _, name := range []string{"A", "B"} {
+		t.Setenv("SINK_PLUGIN_PATH_"+name, path)
+		t.Setenv("SINK_PLUGIN_SYMBOL_"+name, "Discard")
+	}
+
+	sink, err := getSinkRing("a:2, b")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("x")}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGetSinkRingErrors(t *testing.T) {
+	t.Setenv("SINK_BACKOFF_THRESHOLD", "")
+	t.Setenv("SINK_PLUGIN_PATH_MISSING", "")
+	t.Setenv("SINK_PLUGIN_SYMBOL_MISSING", "")
+
+	for _, spec := range []string{"a:heavy", "a:0", "a:-1", " , ", "missing"} {
+		_, err := getSinkRing(spec)
+		var configErr *runner.ConfigError
+		if !errors.As(err, &configErr) || configErr.Name != "SINK_RING" {
+			t.Errorf("expected a SINK_RING config error for %q, got %v", spec, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// getHealthTLSConfig returns the TLS configuration for the servers that expose
+// the readiness probe and metrics, or nil if they serve plain HTTP. TLS is
+// enabled when HEALTH_TLS_CERT and HEALTH_TLS_KEY name a certificate and key.
+// If HEALTH_TLS_CA names a CA bundle as well, clients must present a
+// certificate signed by one of its CAs.
+func getHealthTLSConfig() (*tls.Config, error) {
+	// env: HEALTH_TLS_CERT string "" "Certificate with which the health and metrics endpoints are served over HTTPS."
+	// env: HEALTH_TLS_KEY string "" "Private key of HEALTH_TLS_CERT."
+	certPath, keyPath := os.Getenv("HEALTH_TLS_CERT"), os.Getenv("HEALTH_TLS_KEY")
+	if certPath == "" && keyPath == "" {
+		return nil, nil
+	}
+	if certPath == "" {
+		return nil, configErrorf("HEALTH_TLS_CERT", "HEALTH_TLS_CERT is required when a HEALTH_TLS_KEY is provided")
+	}
+	if keyPath == "" {
+		return nil, configErrorf("HEALTH_TLS_KEY", "HEALTH_TLS_KEY is required when a HEALTH_TLS_CERT is provided")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, configErrorf("HEALTH_TLS_CERT", "could not load the health TLS certificate: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	// env: HEALTH_TLS_CA string "" "CA bundle used to verify client certificates on the health and metrics endpoints."
+	if caPath := os.Getenv("HEALTH_TLS_CA"); caPath != "" {
+		ca, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, configErrorf("HEALTH_TLS_CA", "could not read HEALTH_TLS_CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, configErrorf("HEALTH_TLS_CA", "HEALTH_TLS_CA contains no certificates")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// listenAndServe serves HTTPS with tlsConfig if it is not nil, and plain HTTP
+// otherwise.
+func listenAndServe(server *http.Server, tlsConfig *tls.Config) error {
+	if tlsConfig == nil {
+		return server.ListenAndServe()
+	}
+	server.TLSConfig = tlsConfig
+	return server.ListenAndServeTLS("", "")
+}
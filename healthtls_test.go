@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// testCertificate is a certificate and key generated for a test, along with
+// the files in which they are written in PEM form.
+type testCertificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	tls      tls.Certificate
+	certPath string
+	keyPath  string
+}
+
+// newTestCertificate generates a certificate for 127.0.0.1 that may also sign
+// other certificates. It is signed by parent, or self-signed if parent is nil.
+func newTestCertificate(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certPath, keyPath := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certPath, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCertificate{cert: cert, key: key, tls: pair, certPath: certPath, keyPath: keyPath}
+}
+
+// runHealthTLSServer serves the readiness probe of an HTTP source configured
+// from the HEALTH_TLS_* environment and returns its address.
+func runHealthTLSServer(t *testing.T) string {
+	t.Helper()
+	tlsConfig, err := getHealthTLSConfig()
+	if err != nil || tlsConfig == nil {
+		t.Fatalf("expected a TLS configuration, got %v, %v", tlsConfig, err)
+	}
+	addr := freeAddr(t)
+	stop := runHTTPSource(t, addr, newHTTPSource(addr, false, time.Second, 0, 0, nil, nil, nil, nil, nil, 1, tlsConfig), nil)
+	t.Cleanup(func() { stop() })
+	return addr
+}
+
+func tlsClient(server *testCertificate, client *testCertificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(server.cert)
+	config := &tls.Config{RootCAs: roots}
+	if client != nil {
+		config.Certificates = []tls.Certificate{client.tls}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}, Timeout: 5 * time.Second}
+}
+
+func TestHealthEndpointsServeHTTPS(t *testing.T) {
+	server := newTestCertificate(t, "server", nil)
+	t.Setenv("HEALTH_TLS_CERT", server.certPath)
+	t.Setenv("HEALTH_TLS_KEY", server.keyPath)
+	t.Setenv("HEALTH_TLS_CA", "")
+	addr := runHealthTLSServer(t)
+
+	resp, err := tlsClient(server, nil).Get("https://" + addr + "/readyz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 over HTTPS, got %d", resp.StatusCode)
+	}
+
+	// The TLS server answers a plaintext request with an error instead of
+	// serving it.
+	resp, err = http.Get("http://" + addr + "/readyz")
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected the plaintext request to be rejected, got %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestHealthEndpointsRequireClientCertificatesWithCA(t *testing.T) {
+	server := newTestCertificate(t, "server", nil)
+	trusted := newTestCertificate(t, "trusted", server)
+	untrusted := newTestCertificate(t, "untrusted", nil)
+	t.Setenv("HEALTH_TLS_CERT", server.certPath)
+	t.Setenv("HEALTH_TLS_KEY", server.keyPath)
+	t.Setenv("HEALTH_TLS_CA", server.certPath)
+	addr := runHealthTLSServer(t)
+
+	resp, err := tlsClient(server, trusted).Get("https://" + addr + "/readyz")
+	if err != nil {
+		t.Fatalf("unexpected error with a trusted client certificate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode)
+	}
+
+	for name, client := range map[string]*testCertificate{"no": nil, "an untrusted": untrusted} {
+		if resp, err := tlsClient(server, client).Get("https://" + addr + "/readyz"); err == nil {
+			resp.Body.Close()
+			t.Errorf("expected a request with %s client certificate to fail, got %d", name, resp.StatusCode)
+		}
+	}
+}
+
+func TestGetHealthTLSConfigErrors(t *testing.T) {
+	server := newTestCertificate(t, "server", nil)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := ioutil.WriteFile(empty, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+
+	tests := []struct {
+		name     string
+		cert     string
+		key      string
+		ca       string
+		wantName string
+	}{
+		{"certificate without key", server.certPath, "", "", "HEALTH_TLS_KEY"},
+		{"key without certificate", "", server.keyPath, "", "HEALTH_TLS_CERT"},
+		{"missing certificate", missing, server.keyPath, "", "HEALTH_TLS_CERT"},
+		{"mismatched key", server.keyPath, server.certPath, "", "HEALTH_TLS_CERT"},
+		{"missing CA", server.certPath, server.keyPath, missing, "HEALTH_TLS_CA"},
+		{"CA without certificates", server.certPath, server.keyPath, empty, "HEALTH_TLS_CA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HEALTH_TLS_CERT", tt.cert)
+			t.Setenv("HEALTH_TLS_KEY", tt.key)
+			t.Setenv("HEALTH_TLS_CA", tt.ca)
+
+			_, err := getHealthTLSConfig()
+			var configErr *runner.ConfigError
+			if !errors.As(err, &configErr) || configErr.Name != tt.wantName {
+				t.Errorf("expected a %s config error, got %v", tt.wantName, err)
+			}
+		})
+	}
+}
+
+func TestGetHealthTLSConfigWithoutCertificate(t *testing.T) {
+	t.Setenv("HEALTH_TLS_CERT", "")
+	t.Setenv("HEALTH_TLS_KEY", "")
+
+	if config, err := getHealthTLSConfig(); config != nil || err != nil {
+		t.Errorf("expected no TLS configuration, got %v, %v", config, err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/tessellator/fnrun"
+)
+
+var heapLimitExceeded = newCounter(
+	"fnrunner_invocation_heap_limit_exceeded_total",
+	"Number of invocations during which the runner's heap grew by more than MAX_INVOCATION_HEAP_BYTES.",
+)
+
+// -----------------------------------------------------------------------------
+// Heap Limit Invoker
+//
+// The heap limit invoker detects leaks in the runner's own middleware and
+// sinks. The heap of the function process cannot be observed, so this is a
+// soft limit: the growth of the runner's heap across each invocation is
+// measured, and an invocation during which it grew by more than the limit is
+// logged and counted. After gcAfter consecutive such invocations, a garbage
+// collection is forced.
+//
+// Reading the heap size stops the world briefly, and the measured growth
+// includes allocations made by concurrent invocations, so the limit should be
+// set well above the expected size of a single invocation.
+
+type heapLimitInvoker struct {
+	invoker     fnrun.Invoker
+	limit       uint64
+	gcAfter     int64
+	consecutive int64
+}
+
+func (hi *heapLimitInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	before := heapAlloc()
+	result, err := hi.invoker.Invoke(ctx, input)
+	after := heapAlloc()
+
+	if after <= before || after-before <= hi.limit {
+		atomic.StoreInt64(&hi.consecutive, 0)
+		return result, err
+	}
+
+	heapLimitExceeded.inc()
+	consecutive := atomic.AddInt64(&hi.consecutive, 1)
+	log.Printf("WARNING: heap grew by %d bytes during an invocation, exceeding MAX_INVOCATION_HEAP_BYTES", after-before)
+
+	if hi.gcAfter > 0 && consecutive >= hi.gcAfter {
+		atomic.StoreInt64(&hi.consecutive, 0)
+		log.Printf("heap limit exceeded by %d consecutive invocations; forcing garbage collection", consecutive)
+		runtime.GC()
+	}
+
+	return result, err
+}
+
+func heapAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
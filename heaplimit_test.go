@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"runtime/debug"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestHeapLimitInvokerCountsInvocationsThatExceedTheLimit(t *testing.T) {
+	// Garbage collection is disabled so that the collection of unrelated
+	// garbage during an invocation cannot offset its allocations.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	allocating := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		buf := make([]byte, len(input.Data)<<20)
+		for i := range buf {
+			buf[i] = 1
+		}
+		return &fnrun.Result{Status: 200, Data: buf[:1]}, nil
+	})
+	hi := &heapLimitInvoker{invoker: allocating, limit: 1 << 20, gcAfter: 2}
+
+	before := atomic.LoadUint64(&heapLimitExceeded.value)
+	if _, err := hi.Invoke(context.Background(), &fnrun.Input{Data: []byte("xxxxxxxx")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadUint64(&heapLimitExceeded.value) - before; got != 1 {
+		t.Errorf("expected the counter to increment once for an 8 MiB invocation, got %d", got)
+	}
+	if got := atomic.LoadInt64(&hi.consecutive); got != 1 {
+		t.Errorf("expected one consecutive invocation over the limit, got %d", got)
+	}
+
+	// The second consecutive invocation over the limit forces a garbage
+	// collection and starts counting again.
+	if _, err := hi.Invoke(context.Background(), &fnrun.Input{Data: []byte("xxxxxxxx")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadUint64(&heapLimitExceeded.value) - before; got != 2 {
+		t.Errorf("expected the counter to increment for each invocation over the limit, got %d", got)
+	}
+	if got := atomic.LoadInt64(&hi.consecutive); got != 0 {
+		t.Errorf("expected the consecutive count to be reset after a forced collection, got %d", got)
+	}
+}
+
+func TestHeapLimitInvokerIgnoresInvocationsUnderTheLimit(t *testing.T) {
+	hi := &heapLimitInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return &fnrun.Result{Status: 200, Data: input.Data}, nil
+		}),
+		limit:       64 << 20,
+		consecutive: 3,
+	}
+
+	before := atomic.LoadUint64(&heapLimitExceeded.value)
+	if _, err := hi.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadUint64(&heapLimitExceeded.value) - before; got != 0 {
+		t.Errorf("expected the counter not to increment, got %d", got)
+	}
+	if got := atomic.LoadInt64(&hi.consecutive); got != 0 {
+		t.Errorf("expected an invocation under the limit to reset the consecutive count, got %d", got)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tessellator/executil"
+)
+
+// -----------------------------------------------------------------------------
+// Function binary watcher
+//
+// The function binary watcher polls the executable of FUNCTION_COMMAND and
+// reloads the invoker pool when the file changes, so that a new version of the
+// function can be deployed by replacing the binary without restarting the
+// runner. A change is only acted on once the file has stopped changing for a
+// full poll interval, so that a binary that is still being written is not
+// started.
+//
+// The new binary replaces the function processes rather than the runner:
+// syscall.Exec replaces the image of the calling process, which is the runner
+// itself, while the function runs in child processes started by the pool.
+// Reloading the pool waits for invocations in flight and then starts the new
+// binary in fresh child processes, which is the in-place replacement that
+// re-exec would give a single process, without dropping the runner's sources,
+// sinks and listeners.
+
+type binaryState struct {
+	size    int64
+	modTime time.Time
+}
+
+func statBinary(path string) (binaryState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return binaryState{}, err
+	}
+	return binaryState{size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// getFunctionBinaryPath returns the path of the executable run for the
+// function.
+func getFunctionBinaryPath() (string, error) {
+	cmdStr, err := getFunctionCommand("")
+	if err != nil {
+		return "", err
+	}
+
+	cmd, err := executil.ParseCmd(cmdStr)
+	if err != nil {
+		return "", err
+	}
+
+	return cmd.Path, nil
+}
+
+func watchFunctionBinary(ctx context.Context, pool *invokerPool, path string, interval time.Duration) {
+	current, err := statBinary(path)
+	if err != nil {
+		log.Printf("could not watch function binary: %v", err)
+		return
+	}
+	pending := current
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		state, err := statBinary(path)
+		if err != nil {
+			// The binary may be briefly missing while it is being replaced.
+			continue
+		}
+
+		if state != pending {
+			pending = state
+			continue
+		}
+		if state == current {
+			continue
+		}
+
+		log.Printf("function binary %s changed; reloading function processes", path)
+		if err := pool.reload(); err != nil {
+			log.Printf("could not reload function processes: %v", err)
+			continue
+		}
+		current = state
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// writeFunctionBinary replaces the executable at path with a script that runs
+// the test binary as a function responding with version.
+func writeFunctionBinary(t *testing.T, path string, version string) {
+	t.Helper()
+	script := fmt.Sprintf("#!/bin/sh\n%s=args exec %q %s\n", testFunctionEnv, os.Args[0], version)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchFunctionBinaryReloadsChangedBinaries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "function")
+	writeFunctionBinary(t, path, "v1")
+	pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(exec.Command(path), time.Second, nil)
+	})
+	defer pool.Close()
+
+	invoke := func() string {
+		result, err := pool.Invoke(context.Background(), &fnrun.Input{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return string(result.Data)
+	}
+	if version := invoke(); version != "v1" {
+		t.Fatalf("expected the original binary to be used, got %q", version)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchFunctionBinary(ctx, pool, path, 10*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	writeFunctionBinary(t, path, "v2-new")
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		version := invoke()
+		if version == "v2-new" {
+			break
+		}
+		if version != "v1" {
+			t.Fatalf("expected the original or the new binary, got %q", version)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the new binary to be used after it replaced the old one")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if version := invoke(); version != "v2-new" {
+		t.Errorf("expected subsequent invocations to use the new binary, got %q", version)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// HTTP Poll Source
+//
+// The HTTP poll source requests a URL every interval and invokes the function
+// with each event in the JSON response. The events are the elements of the
+// array selected by a JSON path, which is the whole response by default, and
+// each one is passed to the function encoded as JSON.
+//
+// The URL is requested once when the source starts and then once per interval.
+// A failed request, or a response without an array at the path, is logged and
+// retried at the next interval. The events of a response are invoked in order,
+// and the next request is made only once all of them have been invoked, so an
+// interval shorter than the time taken to process a response polls as fast as
+// the function allows.
+
+func newHTTPPollSource(url string, interval time.Duration, pathSpec string) (eventSource, error) {
+	if url == "" {
+		return nil, configErrorf("POLL_URL", "POLL_URL is required for the http-poll source")
+	}
+	if interval <= 0 {
+		return nil, configErrorf("POLL_INTERVAL_MILLIS", "POLL_INTERVAL_MILLIS must be greater than zero")
+	}
+	path, err := parseJSONPath(pathSpec)
+	if err != nil {
+		return nil, &runner.ConfigError{Name: "POLL_RESULTS_JSONPATH", Err: err}
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			events, err := pollHTTP(ctx, client, url, path)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("could not poll %s: %v", url, err)
+			}
+			for _, event := range events {
+				if ctx.Err() != nil {
+					return nil
+				}
+				if _, err := invoker.Invoke(ctx, &fnrun.Input{Data: event}); err != nil {
+					log.Printf("invocation of polled event failed: %v", err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}, nil
+}
+
+// pollHTTP requests url and returns the elements of the array at path in the
+// response, each encoded as JSON.
+func pollHTTP(ctx context.Context, client *http.Client, url string, path []jsonPathStep) ([][]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("invalid JSON response: %v", err)
+	}
+	array, ok := lookupJSONPath(document, path).([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the response has no array at the results path")
+	}
+
+	events := make([][]byte, 0, len(array))
+	for _, element := range array {
+		event, err := json.Marshal(element)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
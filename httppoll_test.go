@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// pollRecorder records the inputs of the invocations made by the http-poll
+// source and signals each one on invoked.
+type pollRecorder struct {
+	mu      sync.Mutex
+	inputs  []string
+	invoked chan struct{}
+}
+
+func newPollRecorder() *pollRecorder {
+	return &pollRecorder{invoked: make(chan struct{}, 100)}
+}
+
+func (pr *pollRecorder) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	pr.mu.Lock()
+	pr.inputs = append(pr.inputs, string(input.Data))
+	pr.mu.Unlock()
+	pr.invoked <- struct{}{}
+	return &fnrun.Result{Status: 200}, nil
+}
+
+// wait waits for n invocations.
+func (pr *pollRecorder) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-pr.invoked:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d invocations, got %d", n, i)
+		}
+	}
+}
+
+// runPollSource runs source with invoker until the test ends.
+func runPollSource(t *testing.T, source eventSource, invoker fnrun.Invoker) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- source(ctx, invoker) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errc; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestHTTPPollSourceDispatchesEachElement(t *testing.T) {
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		w.Write([]byte(`[{"id": 1}, {"id": 2}, "three"]`))
+	}))
+	defer server.Close()
+
+	source, err := newHTTPPollSource(server.URL, time.Hour, "$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := newPollRecorder()
+	runPollSource(t, source, recorder)
+	recorder.wait(t, 3)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	want := []string{`{"id":1}`, `{"id":2}`, `"three"`}
+	if len(recorder.inputs) != len(want) {
+		t.Fatalf("expected %d invocations, got %v", len(want), recorder.inputs)
+	}
+	for i := range want {
+		if recorder.inputs[i] != want[i] {
+			t.Errorf("expected invocation %d with %s, got %s", i, want[i], recorder.inputs[i])
+		}
+	}
+	if accept != "application/json" {
+		t.Errorf("expected the request to accept JSON, got %q", accept)
+	}
+}
+
+func TestHTTPPollSourceSelectsTheResultsPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"events": [1, 2]}, "next": null}`))
+	}))
+	defer server.Close()
+
+	source, err := newHTTPPollSource(server.URL, time.Hour, "$.data.events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := newPollRecorder()
+	runPollSource(t, source, recorder)
+	recorder.wait(t, 2)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.inputs) != 2 || recorder.inputs[0] != "1" || recorder.inputs[1] != "2" {
+		t.Errorf("expected the elements of data.events, got %v", recorder.inputs)
+	}
+}
+
+func TestHTTPPollSourcePollsEveryInterval(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		polls++
+		poll := polls
+		mu.Unlock()
+		if poll == 1 {
+			// A failed poll is skipped until the next interval.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`["event"]`))
+	}))
+	defer server.Close()
+
+	source, err := newHTTPPollSource(server.URL, 20*time.Millisecond, "$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := newPollRecorder()
+	runPollSource(t, source, recorder)
+	recorder.wait(t, 3)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if polls < 4 {
+		t.Errorf("expected the failed poll to be followed by 3 polls, got %d polls", polls)
+	}
+}
+
+func TestHTTPPollSourceConfiguration(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		interval time.Duration
+		path     string
+		wantErr  string
+	}{
+		{"missing URL", "", time.Second, "$", "POLL_URL"},
+		{"zero interval", "http://example.com", 0, "$", "POLL_INTERVAL_MILLIS"},
+		{"invalid path", "http://example.com", time.Second, "data.events", "POLL_RESULTS_JSONPATH"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newHTTPPollSource(tt.url, tt.interval, tt.path)
+			var configErr *runner.ConfigError
+			if !errors.As(err, &configErr) || configErr.Name != tt.wantErr {
+				t.Errorf("expected a %s config error, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
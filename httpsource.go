@@ -0,0 +1,369 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// errBodyTooLarge is the response to a request whose body exceeds the limit of
+// the HTTP source.
+var errBodyTooLarge = errors.New("request body too large")
+
+// -----------------------------------------------------------------------------
+// HTTP Source
+//
+// The HTTP source invokes the function with the body of each request it
+// receives and responds with the status and data of the result. A readiness
+// probe is served at /readyz, and the runner metrics, including the number of
+// requests in flight, are served at /metrics.
+//
+// If maxConns is greater than zero, requests that arrive while maxConns
+// requests are already in flight receive a 429 response immediately. If a
+// caller limiter is configured, so do requests from a caller that already has
+// the maximum number of requests in flight.
+//
+// The readiness probe also fails with a JSON description of the saturation
+// when more than the saturationThreshold fraction of the invokers in the pool
+// are in use, so that load balancers route new requests to other instances.
+//
+// The X-Correlation-ID header of a request, such as one forwarded by another
+// runner, is passed to the invocation as its correlation ID, and the
+// Content-Type header as its content-type metadata. A request whose content
+// type is rejected receives a 415 response, and one whose body does not match
+// its JSON content type a 400 response.
+//
+// Requests whose body is larger than maxBodyBytes receive a 413 response
+// without being invoked, unless maxBodyBytes is zero.
+//
+// If an authenticator is configured, a request that does not authenticate
+// receives a 401 response, and the identity of the caller of the others is
+// passed to the invocation as its x-caller-id metadata.
+//
+// If a response cache is configured, a request with an idempotency key that
+// has already been answered receives the cached response without being
+// invoked, and the key is passed to the invocation as its x-idempotency-key
+// metadata.
+//
+// If a CORS policy is configured, it is applied to the invocation endpoint so
+// that browser clients on other origins can call it.
+//
+// The response is gzip-compressed if the request accepts the gzip encoding.
+//
+// If a TLS configuration is provided, the source serves HTTPS.
+//
+// When the source is cancelled, it stops accepting work. If drainNew is set,
+// the server keeps running until in-flight requests complete, responding 503
+// to new requests and to the readiness probe so that load balancers stop
+// routing to the runner; the listener is then closed. Otherwise, the listener
+// is closed immediately. In either case, the source waits at most
+// drainTimeout for in-flight requests before returning.
+
+type httpSource struct {
+	addr         string
+	drainNew     bool
+	drainTimeout time.Duration
+	maxConns     int64
+	maxBodyBytes int64
+	callers      *callerLimiter
+	cors         *corsPolicy
+	auth         requestAuthenticator
+	responses    *responseCache
+	pool         interface{}
+	threshold    float64
+	tlsConfig    *tls.Config
+	invoker      fnrun.Invoker
+	active       int64
+	mu           sync.RWMutex
+	draining     bool
+	wg           sync.WaitGroup
+}
+
+func newHTTPSource(addr string, drainNew bool, drainTimeout time.Duration, maxConns int, maxBodyBytes int64, callers *callerLimiter, cors *corsPolicy, auth requestAuthenticator, responses *responseCache, pool interface{}, saturationThreshold float64, tlsConfig *tls.Config) eventSource {
+	hs := &httpSource{
+		addr:         addr,
+		drainNew:     drainNew,
+		drainTimeout: drainTimeout,
+		maxConns:     int64(maxConns),
+		maxBodyBytes: maxBodyBytes,
+		callers:      callers,
+		cors:         cors,
+		auth:         auth,
+		responses:    responses,
+		pool:         pool,
+		threshold:    saturationThreshold,
+		tlsConfig:    tlsConfig,
+	}
+	newGaugeFunc("fnrunner_source_connections", "Number of HTTP source requests currently in flight.", atomicGaugeValue(&hs.active))
+
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		hs.invoker = invoker
+		return hs.run(ctx)
+	}
+}
+
+func (hs *httpSource) run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", hs.serveReady)
+	mux.HandleFunc("/metrics", serveMetrics)
+	if hs.cors != nil {
+		mux.HandleFunc("/", hs.cors.wrap(hs.serveInvoke))
+	} else {
+		mux.HandleFunc("/", hs.serveInvoke)
+	}
+	server := &http.Server{Addr: hs.addr, Handler: mux}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- listenAndServe(server, hs.tlsConfig)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	hs.mu.Lock()
+	hs.draining = true
+	hs.mu.Unlock()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), hs.drainTimeout)
+	defer cancel()
+
+	if hs.drainNew {
+		server.SetKeepAlivesEnabled(false)
+
+		done := make(chan struct{})
+		go func() {
+			hs.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-shutdownCtx.Done():
+		}
+	}
+
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
+
+func (hs *httpSource) serveReady(w http.ResponseWriter, r *http.Request) {
+	hs.mu.RLock()
+	draining := hs.draining
+	hs.mu.RUnlock()
+
+	if draining {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	active, capacity := totalUtilization(hs.pool)
+	if capacity > 0 {
+		if utilization := float64(active) / float64(capacity); utilization > hs.threshold {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(poolSaturation{
+				Status:      "saturated",
+				Active:      active,
+				Capacity:    capacity,
+				Utilization: utilization,
+				Threshold:   hs.threshold,
+			})
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// poolSaturation is the body of the readiness probe response when the pool is
+// saturated.
+type poolSaturation struct {
+	Status      string  `json:"status"`
+	Active      int     `json:"active"`
+	Capacity    int     `json:"capacity"`
+	Utilization float64 `json:"utilization"`
+	Threshold   float64 `json:"threshold"`
+}
+
+func (hs *httpSource) serveInvoke(w http.ResponseWriter, r *http.Request) {
+	hs.mu.RLock()
+	if hs.draining {
+		hs.mu.RUnlock()
+		http.Error(w, errShuttingDown.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	hs.wg.Add(1)
+	hs.mu.RUnlock()
+	defer hs.wg.Done()
+
+	callerID := ""
+	if hs.auth != nil {
+		var err error
+		if callerID, err = hs.auth(r); err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, errUnauthorized.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	active := atomic.AddInt64(&hs.active, 1)
+	defer atomic.AddInt64(&hs.active, -1)
+	if hs.maxConns > 0 && active > hs.maxConns {
+		http.Error(w, "too many concurrent requests", http.StatusTooManyRequests)
+		return
+	}
+	if hs.callers != nil {
+		release, ok := hs.callers.acquire(r)
+		if !ok {
+			http.Error(w, "too many concurrent requests from caller", http.StatusTooManyRequests)
+			return
+		}
+		defer release()
+	}
+
+	if hs.maxBodyBytes > 0 {
+		if r.ContentLength > hs.maxBodyBytes {
+			http.Error(w, errBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, hs.maxBodyBytes)
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		// A MaxBytesReader fails once it has returned maxBodyBytes bytes.
+		if hs.maxBodyBytes > 0 && int64(len(data)) == hs.maxBodyBytes {
+			http.Error(w, errBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	metadata := make(map[string]string, 4)
+	if callerID != "" {
+		metadata[callerIDKey] = callerID
+	}
+	cacheKey := ""
+	if hs.responses != nil {
+		if key := r.Header.Get(hs.responses.header); key != "" {
+			metadata[idempotencyKeyKey] = key
+			cacheKey = callerID + "\x00" + key
+		}
+	}
+	if id := r.Header.Get(correlationIDHeader); id != "" {
+		metadata[correlationIDKey] = id
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		metadata[contentTypeKey] = contentType
+	}
+	if len(metadata) > 0 {
+		ctx = runner.WithMetadata(ctx, metadata)
+	}
+
+	if cacheKey != "" {
+		cached, err := hs.responses.claim(ctx, cacheKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if cached != nil {
+			writeHTTPResult(w, r, cached.status, cached.data)
+			return
+		}
+	}
+
+	result, err := hs.invoker.Invoke(ctx, &fnrun.Input{Data: data})
+	if err != nil {
+		if cacheKey != "" {
+			hs.responses.release(cacheKey)
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, errShuttingDown) || errors.Is(err, errPaused) {
+			status = http.StatusServiceUnavailable
+		} else if errors.Is(err, runner.ErrUnsupportedContentType) {
+			status = http.StatusUnsupportedMediaType
+		} else if errors.Is(err, errInvalidJSONInput) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	status := result.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if cacheKey != "" {
+		hs.responses.store(cacheKey, status, result.Data)
+	}
+	writeHTTPResult(w, r, status, result.Data)
+}
+
+// writeHTTPResult writes the status and data of a result as the response to r,
+// compressing the data if r accepts the gzip encoding.
+func writeHTTPResult(w http.ResponseWriter, r *http.Request, status int, data []byte) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if len(data) == 0 || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		w.WriteHeader(status)
+		if _, err := w.Write(data); err != nil {
+			log.Printf("could not write HTTP response: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	gw := gzip.NewWriter(w)
+	if _, err := gw.Write(data); err != nil {
+		log.Printf("could not write HTTP response: %v", err)
+		return
+	}
+	if err := gw.Close(); err != nil {
+		log.Printf("could not write HTTP response: %v", err)
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header accepts gzip, either by
+// name or with *, with a non-zero quality.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				accepted = err == nil && q > 0
+			}
+		}
+		if accepted {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// freeAddr returns a local address on which nothing is listening.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// runHTTPSource runs source, which listens on addr, with invoker and waits
+// for it to accept requests. The returned function cancels the source and
+// returns the error that it returns.
+func runHTTPSource(t *testing.T, addr string, source eventSource, invoker fnrun.Invoker) func() error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- source(ctx, invoker) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get("http://" + addr + "/readyz")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("expected the HTTP source to listen on %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Cleanup(cancel)
+	return func() error {
+		cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(10 * time.Second):
+			t.Fatal("expected the HTTP source to return")
+			return nil
+		}
+	}
+}
+
+func TestHTTPSourceDrainsInFlightRequestsAndRefusesNewOnes(t *testing.T) {
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, true, 5*time.Second, 0, 0, nil, nil, nil, nil, nil, 1, nil)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	stop := runHTTPSource(t, addr, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		close(started)
+		<-release
+		return &fnrun.Result{Status: 200, Data: []byte("done")}, nil
+	}))
+
+	inFlight := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Post("http://"+addr+"/", "text/plain", strings.NewReader("x"))
+		if err != nil {
+			t.Errorf("expected the in-flight request to complete, got %v", err)
+		}
+		inFlight <- resp
+	}()
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- stop() }()
+
+	// New requests are refused while the in-flight one is in progress.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Post("http://"+addr+"/", "text/plain", strings.NewReader("y"))
+		if err != nil {
+			t.Fatalf("expected the server to keep running while draining, got %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected new requests to receive 503 while draining, got %d", resp.StatusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, err := http.Get("http://" + addr + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the readiness probe to fail while draining, got %d", resp.StatusCode)
+	}
+
+	close(release)
+	if resp := <-inFlight; resp != nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected the in-flight request to succeed, got %d", resp.StatusCode)
+		}
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHTTPSourceLimitsConcurrentRequests(t *testing.T) {
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 2, 0, nil, nil, nil, nil, nil, 1, nil)
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	stop := runHTTPSource(t, addr, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		started <- struct{}{}
+		<-release
+		return &fnrun.Result{Status: 200}, nil
+	}))
+	defer stop()
+
+	statuses := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			resp, err := http.Post("http://"+addr+"/", "text/plain", strings.NewReader("x"))
+			if err != nil {
+				t.Error(err)
+				statuses <- 0
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	<-started
+	<-started
+
+	metrics := readMetrics(t, addr)
+	if !strings.Contains(metrics, "fnrunner_source_connections 2\n") {
+		t.Errorf("expected the gauge to count 2 connections, got:\n%s", metrics)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := http.Post("http://"+addr+"/", "text/plain", strings.NewReader("y"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("expected a request above the limit to receive 429, got %d", resp.StatusCode)
+		}
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if status := <-statuses; status != http.StatusOK {
+			t.Errorf("expected the requests within the limit to succeed, got %d", status)
+		}
+	}
+}
+
+func readMetrics(t *testing.T, addr string) string {
+	t.Helper()
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestHTTPSourceReadinessFailsWhenThePoolIsSaturated(t *testing.T) {
+	pool, _ := newTestCmdPool(t, 2, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo", "FNRUN_TEST_SLEEP_MS=500"), time.Second, nil)
+	})
+	defer pool.Close()
+
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 0, 0, nil, nil, nil, nil, pool, 0.5, nil)
+	stop := runHTTPSource(t, addr, source, pool)
+	defer stop()
+
+	readiness := func() (int, poolSaturation) {
+		resp, err := http.Get("http://" + addr + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var saturation poolSaturation
+		if resp.StatusCode != http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&saturation); err != nil {
+				t.Fatalf("expected a JSON description of the saturation: %v", err)
+			}
+		}
+		return resp.StatusCode, saturation
+	}
+
+	done := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			resp, err := http.Post("http://"+addr+"/", "text/plain", strings.NewReader("x"))
+			if err != nil {
+				t.Error(err)
+				done <- 0
+				return
+			}
+			resp.Body.Close()
+			done <- resp.StatusCode
+		}()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if active, _ := pool.utilization(); active == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected both invokers to be busy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	status, saturation := readiness()
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("expected the saturated pool to fail the readiness probe, got %d", status)
+	}
+	want := poolSaturation{Status: "saturated", Active: 2, Capacity: 2, Utilization: 1, Threshold: 0.5}
+	if saturation != want {
+		t.Errorf("expected %+v, got %+v", want, saturation)
+	}
+
+	for i := 0; i < 2; i++ {
+		if status := <-done; status != http.StatusOK {
+			t.Errorf("expected the invocations to succeed, got %d", status)
+		}
+	}
+	if status, _ := readiness(); status != http.StatusOK {
+		t.Errorf("expected the idle pool to pass the readiness probe, got %d", status)
+	}
+}
+
+func TestHTTPSourceRejectsBodiesOverTheLimit(t *testing.T) {
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 0, 10, nil, nil, nil, nil, nil, 1, nil)
+	var invocations int64
+	runHTTPSource(t, addr, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		atomic.AddInt64(&invocations, 1)
+		return &fnrun.Result{Status: 200, Data: input.Data}, nil
+	}))
+
+	post := func(body io.Reader) int {
+		resp, err := http.Post("http://"+addr+"/", "text/plain", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := post(strings.NewReader("0123456789")); status != http.StatusOK {
+		t.Errorf("expected a body at the limit to be accepted, got status %d", status)
+	}
+	if status := post(strings.NewReader("0123456789a")); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 for a body over the limit, got %d", status)
+	}
+	// A reader of unknown length is sent chunked, without a Content-Length.
+	chunked := ioutil.NopCloser(strings.NewReader("0123456789abc"))
+	if status := post(chunked); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 for a chunked body over the limit, got %d", status)
+	}
+	if n := atomic.LoadInt64(&invocations); n != 1 {
+		t.Errorf("expected only the body within the limit to be invoked, got %d invocations", n)
+	}
+}
+
+func TestHTTPSourceCompressesResponsesForGzipClients(t *testing.T) {
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 0, 0, nil, nil, nil, nil, nil, 1, nil)
+	runHTTPSource(t, addr, source, echoInvoker{})
+
+	// The transport would otherwise ask for gzip itself and decompress the
+	// response transparently.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	post := func(acceptEncoding string, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	body := strings.Repeat("a large result body ", 500)
+	resp := post("deflate, gzip", body)
+	defer resp.Body.Close()
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "gzip" {
+		t.Fatalf("expected a gzip-encoded response, got %q", encoding)
+	}
+	gr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != body {
+		t.Errorf("expected the decompressed response to match the result, got %d bytes", len(data))
+	}
+
+	for _, acceptEncoding := range []string{"", "gzip;q=0", "br"} {
+		resp := post(acceptEncoding, "plain")
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Header.Get("Content-Encoding") != "" || string(data) != "plain" {
+			t.Errorf("%q: expected an uncompressed response, got %q %q", acceptEncoding, resp.Header.Get("Content-Encoding"), data)
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"gzip":              true,
+		"GZIP":              true,
+		"deflate, gzip;q=1": true,
+		"*":                 true,
+		"gzip;q=0.5":        true,
+		"gzip;q=0":          false,
+		"gzip;q=x":          false,
+		"deflate":           false,
+		"":                  false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("%q: expected %v, got %v", header, want, got)
+		}
+	}
+}
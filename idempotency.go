@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const (
+	idempotencyKeyKey    = "x-idempotency-key"
+	idempotencyKeyEnvKey = "IDEMPOTENCY_KEY"
+)
+
+// -----------------------------------------------------------------------------
+// Idempotency Key Invoker
+//
+// The idempotency key invoker passes an idempotency key to the function in the
+// IDEMPOTENCY_KEY env of the execution context, so that a function with side
+// effects can recognize an event it has already handled. The key is the
+// x-idempotency-key metadata provided by the source. Without it, the key is
+// the hex-encoded SHA-256 hash of the input data, so that a redelivered event
+// gets the same key as long as its data is unchanged.
+
+type idempotencyKeyInvoker struct {
+	invoker fnrun.Invoker
+}
+
+func (ii *idempotencyKeyInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	metadata, _ := runner.MetadataFromContext(ctx)
+	key := metadata[idempotencyKeyKey]
+	if key == "" {
+		sum := sha256.Sum256(input.Data)
+		key = hex.EncodeToString(sum[:])
+	}
+
+	return ii.invoker.Invoke(withExtraEnv(ctx, idempotencyKeyEnvKey, key), input)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// functionIdempotencyKey invokes a function process that responds with its
+// env through the idempotency key invoker and returns its IDEMPOTENCY_KEY.
+func functionIdempotencyKey(t *testing.T, ctx context.Context, data string) string {
+	t.Helper()
+	pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("env"), time.Second, nil)
+	})
+	defer pool.Close()
+
+	ii := &idempotencyKeyInvoker{invoker: pool}
+	result, err := ii.Invoke(ctx, &fnrun.Input{Data: []byte(data)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var env map[string]string
+	if err := json.Unmarshal(result.Data, &env); err != nil {
+		t.Fatalf("expected the env of the function as JSON: %v", err)
+	}
+	return env[idempotencyKeyEnvKey]
+}
+
+func TestIdempotencyKeyIsPassedFromMetadata(t *testing.T) {
+	ctx := runner.WithMetadata(context.Background(), map[string]string{idempotencyKeyKey: "order-42"})
+	if key := functionIdempotencyKey(t, ctx, "hi"); key != "order-42" {
+		t.Errorf("expected IDEMPOTENCY_KEY to be order-42, got %q", key)
+	}
+}
+
+func TestIdempotencyKeyDefaultsToTheHashOfTheInput(t *testing.T) {
+	sum := sha256.Sum256([]byte("hi"))
+	want := hex.EncodeToString(sum[:])
+
+	for i := 0; i < 2; i++ {
+		if key := functionIdempotencyKey(t, context.Background(), "hi"); key != want {
+			t.Errorf("expected IDEMPOTENCY_KEY to be %s, got %q", want, key)
+		}
+	}
+	if key := functionIdempotencyKey(t, context.Background(), "other"); key == want {
+		t.Error("expected different inputs to get different keys")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// Idle Invoker Cleanup
+//
+// The idle reaper periodically stops function processes that have not handled
+// an invocation for the idle timeout, so that a runner does not keep a full
+// pool of processes running after traffic drops. The processes that have been
+// idle longest are stopped first, and at least minCount processes are kept
+// running across all pools. The pool still holds an invoker for each stopped
+// process, and a new process is started when that invoker is next used.
+
+type idleProcess struct {
+	process *trackedProcess
+	since   time.Time
+}
+
+func reapIdleInvokers(ctx context.Context, invoker interface{}, interval time.Duration, timeout time.Duration, minCount int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		processes := allFunctionProcesses(invoker)
+		excess := len(processes) - minCount
+		if excess <= 0 {
+			continue
+		}
+
+		cutoff := time.Now().Add(-timeout)
+		var idle []idleProcess
+		for _, process := range processes {
+			if since, ok := process.owner.idleSince(process); ok && since.Before(cutoff) {
+				idle = append(idle, idleProcess{process: process, since: since})
+			}
+		}
+		sort.Slice(idle, func(i, j int) bool { return idle[i].since.Before(idle[j].since) })
+
+		for _, candidate := range idle {
+			if excess == 0 {
+				break
+			}
+			if candidate.process.owner.stopIfIdle(candidate.process, cutoff) {
+				log.Printf("stopped function process %d after it was idle for %v", candidate.process.cmd.Process.Pid, time.Since(candidate.since).Round(time.Millisecond))
+				excess--
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// waitForProcessCount waits for pool to have count function processes.
+func waitForProcessCount(t *testing.T, pool *invokerPool, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(allFunctionProcesses(pool)) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d function processes, got %d", count, len(allFunctionProcesses(pool)))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReapIdleInvokersStopsIdleProcessesDownToTheMinimum(t *testing.T) {
+	pool, _ := newTestCmdPool(t, 3, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo", "FNRUN_TEST_SLEEP_MS=100"), time.Second, nil)
+	})
+	defer pool.Close()
+
+	// Concurrent invocations make the pool start a process for each invoker.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	waitForProcessCount(t, pool, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reapIdleInvokers(ctx, pool, 20*time.Millisecond, 300*time.Millisecond, 1)
+
+	time.Sleep(100 * time.Millisecond)
+	if count := len(allFunctionProcesses(pool)); count != 3 {
+		t.Fatalf("expected no process to be stopped before the idle timeout, got %d processes", count)
+	}
+	waitForProcessCount(t, pool, 1)
+
+	// Invokers whose process was stopped start a new one when they are used.
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if count := len(allFunctionProcesses(pool)); count < 2 {
+		t.Errorf("expected stopped processes to be restarted, got %d processes", count)
+	}
+}
+
+func TestReapIdleInvokersKeepsBusyProcesses(t *testing.T) {
+	pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo", "FNRUN_TEST_SLEEP_MS=500"), time.Second, nil)
+	})
+	defer pool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reapIdleInvokers(ctx, pool, 10*time.Millisecond, 50*time.Millisecond, 0)
+
+	if _, err := pool.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")}); err != nil {
+		t.Errorf("expected the invocation to complete, got %v", err)
+	}
+	waitForProcessCount(t, pool, 0)
+}
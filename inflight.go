@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const (
+	inflightOpStart = "start"
+	inflightOpDone  = "done"
+
+	// inflightCompactBytes is the size above which the log is rewritten to
+	// contain only the invocations that are still in flight.
+	inflightCompactBytes = 64 << 20
+)
+
+// -----------------------------------------------------------------------------
+// In-flight Log
+//
+// The in-flight log is a write-ahead log of the invocations in progress. The
+// start of each invocation is recorded, with its input and metadata, before it
+// is passed on, and its completion is recorded once the invocation has
+// returned, which is after the result has been delivered to the sink. Every
+// record is synced to disk before the log proceeds.
+//
+// An invocation that has started but not completed when the log is opened was
+// in flight when the previous run of the runner crashed, so its acknowledgement
+// never reached the source. Such invocations are replayed before the source
+// starts. An invocation that fails is still complete: the source was told of
+// the failure and is responsible for redelivering the event.
+//
+// The log is truncated whenever no invocations are in flight, and rewritten to
+// contain only the invocations in flight when it grows beyond 64 MiB.
+
+type inflightRecord struct {
+	Op       string            `json:"op"`
+	ID       uint64            `json:"id"`
+	Data     []byte            `json:"data,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type inflightLog struct {
+	invoker   fnrun.Invoker
+	path      string
+	mu        sync.Mutex
+	file      *os.File
+	size      int64
+	nextID    uint64
+	pending   map[uint64]inflightRecord
+	recovered []inflightRecord
+}
+
+func openInflightLog(invoker fnrun.Invoker, path string) (*inflightLog, error) {
+	recovered, err := readInflightLog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &inflightLog{
+		invoker:   invoker,
+		path:      path,
+		pending:   make(map[uint64]inflightRecord),
+		recovered: recovered,
+	}
+	for _, record := range recovered {
+		l.pending[record.ID] = record
+		l.nextID = record.ID + 1
+	}
+
+	// Rewriting the log keeps the recovered invocations, so that they are
+	// replayed again if the runner crashes before they complete.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.compact(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// readInflightLog returns the invocations in the log at path that started but
+// did not complete, in the order they started. A partially written record at
+// the end of the log is ignored.
+func readInflightLog(path string) ([]inflightRecord, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	started := make(map[uint64]inflightRecord)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var record inflightRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			break
+		}
+
+		switch record.Op {
+		case inflightOpStart:
+			started[record.ID] = record
+		case inflightOpDone:
+			delete(started, record.ID)
+		}
+	}
+
+	records := make([]inflightRecord, 0, len(started))
+	for _, record := range started {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records, nil
+}
+
+// replay invokes each invocation that was in flight when the previous run
+// crashed.
+func (l *inflightLog) replay(ctx context.Context) {
+	if len(l.recovered) == 0 {
+		return
+	}
+
+	log.Printf("replaying %d invocation(s) left in flight by the previous run", len(l.recovered))
+	for _, record := range l.recovered {
+		invokeCtx := ctx
+		if len(record.Metadata) > 0 {
+			invokeCtx = runner.WithMetadata(ctx, record.Metadata)
+		}
+		if _, err := l.invoker.Invoke(invokeCtx, &fnrun.Input{Data: record.Data}); err != nil {
+			log.Printf("replayed invocation failed: %v", err)
+		}
+		if err := l.complete(record.ID); err != nil {
+			log.Printf("could not record completed invocation in the in-flight log: %v", err)
+		}
+	}
+	l.recovered = nil
+}
+
+func (l *inflightLog) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	record := inflightRecord{Op: inflightOpStart, Data: input.Data}
+	if metadata, ok := runner.MetadataFromContext(ctx); ok {
+		record.Metadata = metadata
+	}
+
+	id, err := l.start(record)
+	if err != nil {
+		return nil, err
+	}
+
+	result, invokeErr := l.invoker.Invoke(ctx, input)
+
+	if err := l.complete(id); err != nil {
+		log.Printf("could not record completed invocation in the in-flight log: %v", err)
+	}
+	return result, invokeErr
+}
+
+func (l *inflightLog) start(record inflightRecord) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record.ID = l.nextID
+	if err := l.append(record); err != nil {
+		return 0, err
+	}
+	l.nextID++
+	l.pending[record.ID] = record
+	return record.ID, nil
+}
+
+func (l *inflightLog) complete(id uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.pending, id)
+	if len(l.pending) == 0 {
+		if err := l.file.Truncate(0); err != nil {
+			return err
+		}
+		l.size = 0
+		return nil
+	}
+
+	if err := l.append(inflightRecord{Op: inflightOpDone, ID: id}); err != nil {
+		return err
+	}
+	if l.size > inflightCompactBytes {
+		return l.compact()
+	}
+	return nil
+}
+
+// append writes a record to the log and syncs it. The caller must hold l.mu.
+func (l *inflightLog) append(record inflightRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if _, err := l.file.Write(line); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.size += int64(len(line))
+	return nil
+}
+
+// compact rewrites the log so that it contains only the start records of the
+// invocations in flight. The caller must hold l.mu.
+func (l *inflightLog) compact() error {
+	records := make([]inflightRecord, 0, len(l.pending))
+	for _, record := range l.pending {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	var contents []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		contents = append(append(contents, line...), '\n')
+	}
+	if err := writeFileAtomic(l.path, contents); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+	l.size = int64(len(contents))
+	return nil
+}
+
+func (l *inflightLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestInflightLogReplaysInvocationsLeftInFlightByACrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inflight.log")
+
+	// The first run crashes while the invocation of "lost" is in flight: the
+	// invocation does not return until the test ends and the log is never
+	// closed.
+	started := make(chan struct{})
+	crash := make(chan struct{})
+	defer close(crash)
+	hung := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if string(input.Data) == "lost" {
+			close(started)
+			<-crash
+		}
+		return &fnrun.Result{Status: 200}, nil
+	})
+	crashed, err := openInflightLog(hung, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crashed.Invoke(context.Background(), &fnrun.Input{Data: []byte("completed")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := runner.WithMetadata(context.Background(), map[string]string{correlationIDKey: "abc"})
+	go crashed.Invoke(ctx, &fnrun.Input{Data: []byte("lost")})
+	<-started
+
+	// A record torn by the crash is ignored.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"start","id":99,"da`)
+	file.Close()
+
+	var mu sync.Mutex
+	var replayed []string
+	var metadata map[string]string
+	recorder := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		replayed = append(replayed, string(input.Data))
+		metadata, _ = runner.MetadataFromContext(ctx)
+		return &fnrun.Result{Status: 200}, nil
+	})
+	restarted, err := openInflightLog(recorder, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.close()
+	restarted.replay(context.Background())
+
+	if len(replayed) != 1 || replayed[0] != "lost" {
+		t.Fatalf("expected only the invocation in flight to be replayed, got %v", replayed)
+	}
+	if metadata[correlationIDKey] != "abc" {
+		t.Errorf("expected the metadata of the invocation to be replayed, got %v", metadata)
+	}
+
+	// Once replayed, the invocation is complete and is not replayed again.
+	records, err := readInflightLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no invocations in flight after the replay, got %v", records)
+	}
+}
+
+func TestInflightLogIsTruncatedWhenNothingIsInFlight(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inflight.log")
+	release := make(chan struct{})
+	l, err := openInflightLog(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if string(input.Data) == "slow" {
+			<-release
+		}
+		return &fnrun.Result{Status: 200}, nil
+	}), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+
+	done := make(chan struct{})
+	go func() {
+		l.Invoke(context.Background(), &fnrun.Input{Data: []byte("slow")})
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		records, err := readInflightLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the start of the invocation to be recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := l.Invoke(context.Background(), &fnrun.Input{Data: []byte("fast")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records, err := readInflightLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || string(records[0].Data) != "slow" {
+		t.Errorf("expected only the slow invocation to be in flight, got %v", records)
+	}
+
+	close(release)
+	<-done
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("expected the log to be truncated when nothing is in flight, got %d bytes", info.Size())
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/tessellator/fnrun"
+)
+
+// influxPoint is the JSON form of a point accepted by the InfluxDB sink.
+type influxPoint struct {
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags"`
+	Fields      map[string]interface{} `json:"fields"`
+	Timestamp   interface{}            `json:"timestamp"`
+}
+
+// newInfluxDBSink returns a sink that writes the points in each result to a
+// bucket of InfluxDB 2. The data of a result is a JSON object, or an array of
+// them, with a measurement, a map of string tags, a map of fields and an
+// optional timestamp:
+//
+//	{"measurement": "cpu", "tags": {"host": "a"}, "fields": {"load": 0.5}, "timestamp": "2021-01-01T00:00:00Z"}
+//
+// Field values may be numbers, which are written as floats, strings or
+// booleans. The timestamp is either an RFC 3339 time or a number of
+// nanoseconds since the Unix epoch; the time of the delivery is used when it is
+// omitted. The points of a result are written in a single request, and the
+// delivery completes once InfluxDB has accepted them.
+func newInfluxDBSink(url string, token string, org string, bucket string) (eventSinkTransformer, error) {
+	if url == "" {
+		return nil, configErrorf("INFLUXDB_URL", "INFLUXDB_URL is required for the influxdb sink")
+	}
+	if org == "" {
+		return nil, configErrorf("INFLUXDB_ORG", "INFLUXDB_ORG is required for the influxdb sink")
+	}
+	if bucket == "" {
+		return nil, configErrorf("INFLUXDB_BUCKET", "INFLUXDB_BUCKET is required for the influxdb sink")
+	}
+
+	writeAPI := influxdb2.NewClient(url, token).WriteAPIBlocking(org, bucket)
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		points, err := decodeInfluxPoints(result.Data, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if err := writeAPI.WritePoint(ctx, points...); err != nil {
+			return nil, fmt.Errorf("could not write to InfluxDB: %v", err)
+		}
+		return result, nil
+	}, nil
+}
+
+func decodeInfluxPoints(data []byte, now time.Time) ([]*write.Point, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var decoded []influxPoint
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := decoder.Decode(&decoded); err != nil {
+			return nil, fmt.Errorf("the result is not an array of InfluxDB points: %v", err)
+		}
+	} else {
+		var single influxPoint
+		if err := decoder.Decode(&single); err != nil {
+			return nil, fmt.Errorf("the result is not an InfluxDB point: %v", err)
+		}
+		decoded = append(decoded, single)
+	}
+
+	points := make([]*write.Point, len(decoded))
+	for i, p := range decoded {
+		point, err := p.toPoint(now)
+		if err != nil {
+			return nil, fmt.Errorf("point %d of the result: %v", i, err)
+		}
+		points[i] = point
+	}
+	return points, nil
+}
+
+func (p *influxPoint) toPoint(now time.Time) (*write.Point, error) {
+	if p.Measurement == "" {
+		return nil, fmt.Errorf("the point has no measurement")
+	}
+	if len(p.Fields) == 0 {
+		return nil, fmt.Errorf("the point has no fields")
+	}
+
+	fields := make(map[string]interface{}, len(p.Fields))
+	for name, value := range p.Fields {
+		switch v := value.(type) {
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", name, err)
+			}
+			fields[name] = f
+		case string, bool:
+			fields[name] = v
+		default:
+			return nil, fmt.Errorf("field %s must be a number, string or boolean", name)
+		}
+	}
+
+	timestamp := now
+	switch v := p.Timestamp.(type) {
+	case nil:
+	case json.Number:
+		nanos, err := v.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %s: %v", v, err)
+		}
+		timestamp = time.Unix(0, nanos)
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q: %v", v, err)
+		}
+		timestamp = parsed
+	default:
+		return nil, fmt.Errorf("the timestamp must be an RFC 3339 time or a number of nanoseconds")
+	}
+
+	return influxdb2.NewPoint(p.Measurement, p.Tags, fields, timestamp), nil
+}
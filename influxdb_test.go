@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+// influxWrite is a write request received by a mock InfluxDB server.
+type influxWrite struct {
+	query         url.Values
+	authorization string
+	lines         []string
+}
+
+// newMockInfluxDB returns a server that records the write requests it
+// receives and responds to them with status.
+func newMockInfluxDB(t *testing.T, status int) (*httptest.Server, chan influxWrite) {
+	t.Helper()
+	writes := make(chan influxWrite, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v2/write" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		writes <- influxWrite{
+			query:         r.URL.Query(),
+			authorization: r.Header.Get("Authorization"),
+			lines:         strings.Split(strings.TrimSpace(string(body)), "\n"),
+		}
+		if status != http.StatusNoContent {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"code": "invalid", "message": "rejected by the test"}`))
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, writes
+}
+
+func TestInfluxDBSinkWritesLineProtocol(t *testing.T) {
+	server, writes := newMockInfluxDB(t, http.StatusNoContent)
+	sink, err := newInfluxDBSink(server.URL, "secret", "acme", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &fnrun.Result{Status: 200, Data: []byte(`[
+		{"measurement": "cpu", "tags": {"region": "eu", "host": "a"}, "fields": {"load": 0.5, "cores": 4, "ok": true, "state": "idle"}, "timestamp": "2021-01-01T00:00:00Z"},
+		{"measurement": "mem", "fields": {"used": 1024}, "timestamp": 1609459200000000001}
+	]`)}
+	if got, err := sink(context.Background(), result); err != nil || got != result {
+		t.Fatalf("expected the result to be returned, got %v: %v", got, err)
+	}
+
+	w := <-writes
+	if w.query.Get("org") != "acme" || w.query.Get("bucket") != "metrics" || w.query.Get("precision") != "ns" {
+		t.Errorf("expected a write to acme/metrics in nanoseconds, got %v", w.query)
+	}
+	if w.authorization != "Token secret" {
+		t.Errorf("expected the token to authenticate the request, got %q", w.authorization)
+	}
+	want := []string{
+		`cpu,host=a,region=eu cores=4,load=0.5,ok=true,state="idle" 1609459200000000000`,
+		`mem used=1024 1609459200000000001`,
+	}
+	if strings.Join(w.lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected the lines\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(w.lines, "\n"))
+	}
+}
+
+func TestInfluxDBSinkWritesSinglePointAtDeliveryTime(t *testing.T) {
+	server, writes := newMockInfluxDB(t, http.StatusNoContent)
+	sink, err := newInfluxDBSink(server.URL, "", "acme", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte(`{"measurement": "cpu", "fields": {"load": 1}}`)}); err != nil {
+		t.Fatal(err)
+	}
+	w := <-writes
+	if len(w.lines) != 1 || !strings.HasPrefix(w.lines[0], "cpu load=1 ") {
+		t.Errorf("expected a single point with a timestamp, got %q", w.lines)
+	}
+}
+
+func TestInfluxDBSinkFailsWhenTheWriteIsRejected(t *testing.T) {
+	server, _ := newMockInfluxDB(t, http.StatusBadRequest)
+	sink, err := newInfluxDBSink(server.URL, "", "acme", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sink(context.Background(), &fnrun.Result{Data: []byte(`{"measurement": "cpu", "fields": {"load": 1}}`)})
+	if err == nil || !strings.Contains(err.Error(), "could not write to InfluxDB") {
+		t.Errorf("expected the write to fail, got %v", err)
+	}
+}
+
+func TestInfluxDBSinkRejectsInvalidPoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"not JSON", `cpu load=1`, "not an InfluxDB point"},
+		{"invalid array", `[1]`, "not an array of InfluxDB points"},
+		{"no measurement", `{"fields": {"load": 1}}`, "the point has no measurement"},
+		{"no fields", `{"measurement": "cpu"}`, "the point has no fields"},
+		{"nested field", `{"measurement": "cpu", "fields": {"load": [1]}}`, "field load must be a number, string or boolean"},
+		{"invalid time", `{"measurement": "cpu", "fields": {"load": 1}, "timestamp": "yesterday"}`, `invalid timestamp "yesterday"`},
+		{"fractional time", `{"measurement": "cpu", "fields": {"load": 1}, "timestamp": 1.5}`, "invalid timestamp 1.5"},
+		{"second point", `[{"measurement": "cpu", "fields": {"load": 1}}, {"measurement": ""}]`, "point 1 of the result"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, writes := newMockInfluxDB(t, http.StatusNoContent)
+			sink, err := newInfluxDBSink(server.URL, "", "acme", "metrics")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = sink(context.Background(), &fnrun.Result{Data: []byte(tt.data)})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+			if len(writes) != 0 {
+				t.Error("expected nothing to be written")
+			}
+		})
+	}
+}
+
+func TestNewInfluxDBSinkConfigErrors(t *testing.T) {
+	tests := []struct {
+		url, org, bucket string
+		wantName         string
+	}{
+		{"", "acme", "metrics", "INFLUXDB_URL"},
+		{"http://localhost:8086", "", "metrics", "INFLUXDB_ORG"},
+		{"http://localhost:8086", "acme", "", "INFLUXDB_BUCKET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantName, func(t *testing.T) {
+			_, err := newInfluxDBSink(tt.url, "token", tt.org, tt.bucket)
+			checkConfigError(t, err, tt.wantName, tt.wantName+" is required")
+		})
+	}
+}
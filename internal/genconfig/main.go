@@ -0,0 +1,231 @@
+// Command genconfig generates the configuration reference of the runner from
+// the structured comments next to the code that reads each environment
+// variable. A variable is documented with a comment of the form
+//
+//	// env: NAME type default "description"
+//
+// where the default is quoted when it is empty or contains spaces. The
+// comments of every Go file in the package directory are collected into the
+// configVars slice of the output file, sorted by name.
+//
+// Generation fails if a variable is documented twice, or if a variable is read
+// with a literal name through os.Getenv or one of the get*Env helpers without
+// being documented. The B pool variant of a suffixable variable, such as
+// FUNCTION_COMMAND_B, is covered by the documentation of the variable.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const commentPrefix = "// env:"
+
+// readFuncs are the functions whose first argument is the name of an
+// environment variable that they read.
+var readFuncs = map[string]bool{
+	"os.Getenv":       true,
+	"os.LookupEnv":    true,
+	"getBoolEnv":      true,
+	"getBucketsEnv":   true,
+	"getFloatEnv":     true,
+	"getIntEnv":       true,
+	"getStringEnv":    true,
+	"getUint64Env":    true,
+	"suffixedEnvName": true,
+}
+
+type configVar struct {
+	Name        string
+	Type        string
+	Default     string
+	Description string
+	Position    token.Position
+}
+
+type read struct {
+	name     string
+	position token.Position
+}
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the package to scan")
+	output := flag.String("output", "config_generated.go", "file to generate, relative to -dir")
+	flag.Parse()
+
+	if err := generate(*dir, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "genconfig: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func generate(dir string, output string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+
+	var vars []configVar
+	var reads []read
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		if filepath.Base(path) == output || strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+
+		for _, group := range file.Comments {
+			for _, comment := range group.List {
+				if !strings.HasPrefix(comment.Text, commentPrefix) {
+					continue
+				}
+				v, err := parseComment(strings.TrimPrefix(comment.Text, commentPrefix))
+				if err != nil {
+					return fmt.Errorf("%s: %v", fset.Position(comment.Pos()), err)
+				}
+				v.Position = fset.Position(comment.Pos())
+				vars = append(vars, v)
+			}
+		}
+		reads = append(reads, findReads(fset, file)...)
+	}
+
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	documented := make(map[string]configVar, len(vars))
+	for _, v := range vars {
+		if previous, ok := documented[v.Name]; ok {
+			return fmt.Errorf("%s: %s is already documented at %s", v.Position, v.Name, previous.Position)
+		}
+		documented[v.Name] = v
+	}
+	for _, r := range reads {
+		if !isDocumented(documented, r.name) {
+			return fmt.Errorf("%s: %s is read but not documented with a %q comment", r.position, r.name, commentPrefix)
+		}
+	}
+
+	source, err := render(vars)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, output), source, 0644)
+}
+
+// parseComment parses the text of a comment after the prefix.
+func parseComment(text string) (configVar, error) {
+	var v configVar
+	fields := strings.Fields(text)
+	if len(fields) < 4 {
+		return v, fmt.Errorf("expected NAME type default \"description\"")
+	}
+	v.Name, v.Type = fields[0], fields[1]
+
+	rest := strings.TrimSpace(text)
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, v.Name))
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, v.Type))
+
+	var err error
+	if v.Default, rest, err = nextValue(rest); err != nil {
+		return v, fmt.Errorf("invalid default of %s: %v", v.Name, err)
+	}
+	if !strings.HasPrefix(rest, `"`) {
+		return v, fmt.Errorf("the description of %s must be quoted", v.Name)
+	}
+	if v.Description, rest, err = nextValue(rest); err != nil {
+		return v, fmt.Errorf("invalid description of %s: %v", v.Name, err)
+	}
+	if rest != "" {
+		return v, fmt.Errorf("unexpected text after the description of %s", v.Name)
+	}
+	return v, nil
+}
+
+// nextValue returns the bare or quoted value at the start of text and the text
+// that follows it.
+func nextValue(text string) (string, string, error) {
+	if !strings.HasPrefix(text, `"`) {
+		end := strings.IndexByte(text, ' ')
+		if end < 0 {
+			end = len(text)
+		}
+		return text[:end], strings.TrimSpace(text[end:]), nil
+	}
+
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(text[:i+1])
+			return value, strings.TrimSpace(text[i+1:]), err
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// findReads returns the variables read in file with a literal name.
+func findReads(fset *token.FileSet, file *ast.File) []read {
+	var reads []read
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 || !readFuncs[funcName(call.Fun)] {
+			return true
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			if name, err := strconv.Unquote(lit.Value); err == nil {
+				reads = append(reads, read{name: name, position: fset.Position(lit.Pos())})
+			}
+		}
+		return true
+	})
+	return reads
+}
+
+func funcName(expr ast.Expr) string {
+	switch fn := expr.(type) {
+	case *ast.Ident:
+		return fn.Name
+	case *ast.SelectorExpr:
+		if pkg, ok := fn.X.(*ast.Ident); ok {
+			return pkg.Name + "." + fn.Sel.Name
+		}
+	}
+	return ""
+}
+
+func isDocumented(documented map[string]configVar, name string) bool {
+	if _, ok := documented[name]; ok {
+		return true
+	}
+	if base := strings.TrimSuffix(name, "_B"); base != name {
+		v, ok := documented[base]
+		return ok && strings.Contains(v.Description, "Suffixable.")
+	}
+	return false
+}
+
+func render(vars []configVar) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by go run ./internal/genconfig; DO NOT EDIT.\n\n")
+	buf.WriteString("package main\n\n")
+	buf.WriteString("var configVars = []configVar{\n")
+	for _, v := range vars {
+		fmt.Fprintf(&buf, "\t{%q, %q, %q, %q},\n", v.Name, v.Type, v.Default, v.Description)
+	}
+	buf.WriteString("}\n")
+	return format.Source(buf.Bytes())
+}
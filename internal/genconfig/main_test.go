@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyGoFiles copies the Go files of src, other than tests and the generated
+// file, to a temporary directory and returns its path.
+func copyGoFiles(t *testing.T, src string) string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(src, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") || filepath.Base(path) == "config_generated.go" {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.Base(path)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGenerateMatchesGoldenFile(t *testing.T) {
+	dir := copyGoFiles(t, filepath.Join("testdata", "src"))
+	if err := generate(dir, "config_generated.go"); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	got := readFile(t, filepath.Join(dir, "config_generated.go"))
+	want := readFile(t, filepath.Join("testdata", "config_generated.golden"))
+	if got != want {
+		t.Errorf("generated file does not match the golden file:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGeneratedConfigIsUpToDate(t *testing.T) {
+	root := filepath.Join("..", "..")
+	dir := copyGoFiles(t, root)
+	if err := generate(dir, "config_generated.go"); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	if readFile(t, filepath.Join(dir, "config_generated.go")) != readFile(t, filepath.Join(root, "config_generated.go")) {
+		t.Error("config_generated.go is out of date; run go generate")
+	}
+}
+
+func TestGenerateRejectsInvalidDocumentation(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "undocumented read",
+			source: `func f() { os.Getenv("UNDOCUMENTED") }`,
+			want:   "UNDOCUMENTED is read but not documented",
+		},
+		{
+			name: "duplicate documentation",
+			source: `// env: TWICE string "" "Once."
+// env: TWICE string "" "Twice."
+func f() {}`,
+			want: "TWICE is already documented",
+		},
+		{
+			name:   "unquoted description",
+			source: `// env: BARE string "" bare description`,
+			want:   "must be quoted",
+		},
+		{
+			name:   "unsuffixable B variant",
+			source: "// env: POOL int 1 \"Not suffixable.\"\nfunc f() { getIntEnv(\"POOL_B\", 1) }",
+			want:   "POOL_B is read but not documented",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := "package main\n\nimport \"os\"\n\nvar _ = os.Getenv\n\n" + tt.source + "\n"
+			if err := ioutil.WriteFile(filepath.Join(dir, "config.go"), []byte(source), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := generate(dir, "config_generated.go")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+			if _, statErr := os.Stat(filepath.Join(dir, "config_generated.go")); statErr == nil {
+				t.Error("expected no file to be generated")
+			}
+		})
+	}
+}
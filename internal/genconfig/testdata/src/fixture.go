@@ -0,0 +1,13 @@
+package main
+
+import "os"
+
+func readConfig() {
+	// env: FIXTURE_ADDR string "" "Address of the fixture server."
+	os.Getenv("FIXTURE_ADDR")
+	// env: FIXTURE_COUNT int 3 "Number of fixtures. Suffixable."
+	getIntEnv("FIXTURE_COUNT", 3)
+	getIntEnv("FIXTURE_COUNT_B", 3)
+	// env: FIXTURE_GREETING string "hello world" "Greeting with \"quotes\"."
+	getStringEnv("FIXTURE_GREETING", "hello world")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"math"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Invocation Log
+//
+// When LOG_INVOCATIONS is true, the invocation logger logs a line for every
+// invocation with its correlation ID, status and duration. At high throughput,
+// LOG_SAMPLE_RATE limits the log to about that fraction of the successful
+// invocations; failed invocations are always logged. Whether an invocation is
+// in the sample is determined by a hash of its correlation ID, or of its data
+// if it has none, so the invocations of an event that is retried or
+// redelivered are either all logged or all dropped.
+
+type invocationLogger struct {
+	invoker   fnrun.Invoker
+	threshold uint64
+	all       bool
+}
+
+func newInvocationLogger(invoker fnrun.Invoker, rate float64) *invocationLogger {
+	if rate < 0 {
+		rate = 0
+	}
+	return &invocationLogger{
+		invoker:   invoker,
+		threshold: uint64(rate * math.MaxUint64),
+		all:       rate >= 1,
+	}
+}
+
+// sampled reports whether a successful invocation with the given correlation
+// ID and input is logged.
+func (il *invocationLogger) sampled(correlationID string, input *fnrun.Input) bool {
+	if il.all {
+		return true
+	}
+	hash := fnv.New64a()
+	if correlationID != "" {
+		hash.Write([]byte(correlationID))
+	} else {
+		hash.Write(input.Data)
+	}
+	return hash.Sum64() < il.threshold
+}
+
+func (il *invocationLogger) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	start := time.Now()
+	result, err := il.invoker.Invoke(ctx, input)
+	elapsed := time.Since(start).Round(time.Microsecond)
+
+	metadata, _ := runner.MetadataFromContext(ctx)
+	correlationID := metadata[correlationIDKey]
+	name := "invocation"
+	if correlationID != "" {
+		name += " " + correlationID
+	}
+	switch {
+	case err != nil:
+		log.Printf("%s failed after %v: %v", name, elapsed, err)
+	case il.sampled(correlationID, input):
+		status := 0
+		if result != nil {
+			status = result.Status
+		}
+		log.Printf("%s completed with status %d in %v", name, status, elapsed)
+	}
+
+	return result, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// invokeWithCorrelationIDs invokes invoker once for each of the correlation
+// IDs id-0 to id-<n-1>.
+func invokeWithCorrelationIDs(invoker fnrun.Invoker, n int) {
+	for i := 0; i < n; i++ {
+		ctx := runner.WithMetadata(context.Background(), map[string]string{correlationIDKey: fmt.Sprintf("id-%d", i)})
+		invoker.Invoke(ctx, &fnrun.Input{Data: []byte("x")})
+	}
+}
+
+var succeedingInvoker = invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	return &fnrun.Result{Status: 200}, nil
+})
+
+func TestInvocationLoggerSamplesSuccessfulInvocations(t *testing.T) {
+	logs := captureLog(t)
+	invokeWithCorrelationIDs(newInvocationLogger(succeedingInvoker, 0.1), 1000)
+
+	lines := strings.Count(logs.String(), "completed with status 200")
+	if lines < 70 || lines > 130 {
+		t.Errorf("expected about 100 of 1000 invocations to be logged, got %d", lines)
+	}
+}
+
+func TestInvocationLoggerSamplesByCorrelationID(t *testing.T) {
+	logger := newInvocationLogger(succeedingInvoker, 0.1)
+	logs := captureLog(t)
+	invokeWithCorrelationIDs(logger, 1000)
+	first := logs.String()
+	logs.Reset()
+	invokeWithCorrelationIDs(logger, 1000)
+
+	if first == "" {
+		t.Fatal("expected some invocations to be logged")
+	}
+	pattern := regexp.MustCompile(`invocation (id-\d+) completed`)
+	sampled := func(out string) []string {
+		var ids []string
+		for _, match := range pattern.FindAllStringSubmatch(out, -1) {
+			ids = append(ids, match[1])
+		}
+		return ids
+	}
+	a, b := sampled(first), sampled(logs.String())
+	if strings.Join(a, ",") != strings.Join(b, ",") {
+		t.Errorf("expected the same correlation IDs to be logged again, got %v and %v", a, b)
+	}
+}
+
+func TestInvocationLoggerAlwaysLogsFailures(t *testing.T) {
+	logs := captureLog(t)
+	failing := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return nil, errors.New("crashed")
+	})
+	invokeWithCorrelationIDs(newInvocationLogger(failing, 0), 100)
+
+	if lines := strings.Count(logs.String(), "failed after"); lines != 100 {
+		t.Errorf("expected every failed invocation to be logged, got %d", lines)
+	}
+}
+
+func TestInvocationLoggerLogsEverythingByDefault(t *testing.T) {
+	logs := captureLog(t)
+	invokeWithCorrelationIDs(newInvocationLogger(succeedingInvoker, 1.0), 100)
+
+	if lines := strings.Count(logs.String(), "completed with status 200"); lines != 100 {
+		t.Errorf("expected every invocation to be logged, got %d", lines)
+	}
+}
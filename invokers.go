@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Built-in invokers
+//
+// These invokers do not spawn a function process. They are useful for testing
+// and for measuring the overhead of the pipeline itself.
+
+// noopInvoker returns an empty result for every invocation.
+type noopInvoker struct{}
+
+func (noopInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	return &fnrun.Result{}, nil
+}
+
+// echoInvoker returns the input data as the result data.
+type echoInvoker struct{}
+
+func (echoInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	return &fnrun.Result{Data: input.Data}, nil
+}
+
+// staticInvokerFactory is an InvokerFactory that always returns the same
+// invoker.
+type staticInvokerFactory struct {
+	invoker fnrun.Invoker
+}
+
+func (factory *staticInvokerFactory) NewInvoker() (fnrun.Invoker, error) {
+	return factory.invoker, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestBuiltinInvokers(t *testing.T) {
+	tests := []struct {
+		invokerType string
+		want        string
+	}{
+		{"noop", ""},
+		{"echo", "hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.invokerType, func(t *testing.T) {
+			t.Setenv("INVOKER_TYPE", tt.invokerType)
+			factory, err := getInvokerFactory("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			invoker, err := factory.NewInvoker()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			result, err := invoker.Invoke(context.Background(), &fnrun.Input{Data: []byte("hello")})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+				t.Errorf("expected the invocation to return quickly, took %v", elapsed)
+			}
+			if string(result.Data) != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, result.Data)
+			}
+		})
+	}
+}
+
+func TestUnknownInvokerType(t *testing.T) {
+	t.Setenv("INVOKER_TYPE", "bogus")
+	if _, err := getInvokerFactory(""); err == nil {
+		t.Error("expected an error for an unknown INVOKER_TYPE")
+	}
+}
+
+// sinkData returns the data of the result for input that sink receives from
+// invoker.
+func sinkData(t *testing.T, invoker fnrun.Invoker, input *fnrun.Input) []byte {
+	t.Helper()
+	var data []byte
+	si := &sinkInvoker{invoker: invoker, sink: func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		data = result.Data
+		return result, nil
+	}}
+	if _, err := si.Invoke(context.Background(), input); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return data
+}
+
+func TestEchoResultsReachTheSinkWithoutCopying(t *testing.T) {
+	input := &fnrun.Input{Data: []byte("hello")}
+	data := sinkData(t, echoInvoker{}, input)
+	if len(data) != len(input.Data) || &data[0] != &input.Data[0] {
+		t.Error("expected the sink to receive the input bytes of the echo invoker")
+	}
+}
+
+func TestCommandResultsReachTheSinkDecoded(t *testing.T) {
+	pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo"), time.Second, nil)
+	})
+	defer pool.Close()
+
+	input := &fnrun.Input{Data: []byte("hello")}
+	data := sinkData(t, pool, input)
+	if string(data) != "hello" {
+		t.Fatalf("expected the sink to receive hello, got %q", data)
+	}
+	if &data[0] == &input.Data[0] {
+		t.Error("expected the result of a function process to be decoded from its output")
+	}
+}
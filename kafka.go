@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// kafkaRetryDelay is how long the Kafka source waits before retrying a
+// record whose invocation failed, unless a nack directive gives a delay.
+const kafkaRetryDelay = time.Second
+
+// -----------------------------------------------------------------------------
+// Apache Kafka Source
+//
+// The Kafka source invokes the function with the value of each record of a
+// topic. The headers of the record are passed as metadata, along with
+// topic:partition:offset as the correlation ID and the record timestamp as the
+// event timestamp.
+//
+// By default the source consumes the topic as a member of the consumer group
+// KAFKA_GROUP, and its offsets are committed to the group. When
+// KAFKA_PARTITION_ASSIGNMENT lists partitions, the source instead reads those
+// partitions directly, without joining a group, which avoids the pauses caused
+// by group rebalances. Offsets are then kept in the local file
+// KAFKA_OFFSET_FILE, and a partition without a stored offset is read from the
+// start. Each runner reading a partition directly should be assigned its own
+// partitions, and SOURCE_CONCURRENCY should not be used in this mode, since
+// every instance would read the same partitions.
+//
+// The records of each fetch are invoked in order, and their offsets are
+// committed once all of them have been processed, so a record may be invoked
+// again after a crash. A record whose invocation failed is retried in place,
+// keeping the order of its partition, after the delay of its nack directive
+// or one second; a nack directive that does not request a requeue skips it.
+
+type kafkaOffsets map[int32]int64
+
+func newKafkaSource(brokers string, topic string, group string, assignment string, offsetPath string) (eventSource, error) {
+	if brokers == "" {
+		return nil, configErrorf("KAFKA_BROKERS", "KAFKA_BROKERS is required for the kafka source")
+	}
+	if topic == "" {
+		return nil, configErrorf("KAFKA_TOPIC", "KAFKA_TOPIC is required for the kafka source")
+	}
+
+	seeds := kgo.SeedBrokers(strings.Split(brokers, ",")...)
+	var options func() []kgo.Opt
+	var commit func(ctx context.Context, client *kgo.Client, records []*kgo.Record) error
+
+	if assignment != "" {
+		partitions, err := parseKafkaPartitions(assignment)
+		if err != nil {
+			return nil, &runner.ConfigError{Name: "KAFKA_PARTITION_ASSIGNMENT", Err: err}
+		}
+		offsets, err := readKafkaOffsets(offsetPath)
+		if err != nil {
+			return nil, &runner.ConfigError{Name: "KAFKA_OFFSET_FILE", Err: err}
+		}
+
+		// The source resumes from the offsets it has committed when it is
+		// restarted.
+		options = func() []kgo.Opt {
+			start := make(map[int32]kgo.Offset, len(partitions))
+			for _, partition := range partitions {
+				if offset, ok := offsets[partition]; ok {
+					start[partition] = kgo.NewOffset().At(offset)
+				} else {
+					start[partition] = kgo.NewOffset().AtStart()
+				}
+			}
+			return []kgo.Opt{seeds, kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{topic: start})}
+		}
+		commit = func(ctx context.Context, client *kgo.Client, records []*kgo.Record) error {
+			for _, record := range records {
+				offsets[record.Partition] = record.Offset + 1
+			}
+			return writeKafkaOffsets(offsetPath, offsets)
+		}
+	} else {
+		if group == "" {
+			return nil, configErrorf("KAFKA_GROUP", "KAFKA_GROUP or KAFKA_PARTITION_ASSIGNMENT is required for the kafka source")
+		}
+		options = func() []kgo.Opt {
+			return []kgo.Opt{seeds, kgo.ConsumerGroup(group), kgo.ConsumeTopics(topic), kgo.DisableAutoCommit()}
+		}
+		commit = func(ctx context.Context, client *kgo.Client, records []*kgo.Record) error {
+			return client.CommitRecords(ctx, records...)
+		}
+	}
+
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		return consumeKafka(ctx, invoker, options(), commit)
+	}, nil
+}
+
+func consumeKafka(ctx context.Context, invoker fnrun.Invoker, opts []kgo.Opt, commit func(context.Context, *kgo.Client, []*kgo.Record) error) error {
+	var client *kgo.Client
+	err := connectWithBackoff(func() (err error) {
+		if ctx.Err() != nil {
+			// The source was cancelled while connecting.
+			return nil
+		}
+		if client, err = kgo.NewClient(opts...); err != nil {
+			return err
+		}
+		if err = client.Ping(ctx); err != nil && ctx.Err() == nil {
+			client.Close()
+			client = nil
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return nil
+	}
+	defer client.Close()
+
+	for {
+		fetches := client.PollFetches(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			log.Printf("could not fetch from Kafka partition %s:%d: %v", topic, partition, err)
+		})
+
+		records := fetches.Records()
+		for _, record := range records {
+			if !invokeKafkaRecord(ctx, invoker, record) {
+				// The source was cancelled while the record was being retried,
+				// so it and the records after it are not committed.
+				return nil
+			}
+		}
+		if len(records) > 0 {
+			// The offsets are committed even if the source has been cancelled,
+			// since the records have been processed.
+			commitCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := commit(commitCtx, client, records); err != nil {
+				log.Printf("could not commit Kafka offsets: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// invokeKafkaRecord invokes the function with a record until the record has
+// been processed or skipped. It returns false if the source was cancelled
+// first.
+func invokeKafkaRecord(ctx context.Context, invoker fnrun.Invoker, record *kgo.Record) bool {
+	id := fmt.Sprintf("%s:%d:%d", record.Topic, record.Partition, record.Offset)
+	metadata := make(map[string]string, len(record.Headers)+2)
+	for _, header := range record.Headers {
+		metadata[header.Key] = string(header.Value)
+	}
+	metadata[correlationIDKey] = id
+	if !record.Timestamp.IsZero() {
+		metadata[eventTimestampKey] = record.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	recordCtx := runner.WithMetadata(ctx, metadata)
+
+	for {
+		_, directive, err := invokeAckable(recordCtx, invoker, &fnrun.Input{Data: record.Value})
+		if err == nil && directive == nil {
+			return true
+		}
+		if err == nil {
+			err = errors.New("the record was nacked")
+		}
+		if directive != nil && !directive.Requeue {
+			log.Printf("could not process Kafka record %s; skipping it: %v", id, err)
+			return true
+		}
+
+		delay := kafkaRetryDelay
+		if directive != nil && directive.Delay > 0 {
+			delay = directive.Delay
+		}
+		log.Printf("could not process Kafka record %s; retrying in %v: %v", id, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// parseKafkaPartitions parses a comma-separated list of partition IDs.
+func parseKafkaPartitions(list string) ([]int32, error) {
+	var partitions []int32
+	for _, field := range strings.Split(list, ",") {
+		partition, err := strconv.ParseInt(strings.TrimSpace(field), 10, 32)
+		if err != nil || partition < 0 {
+			return nil, fmt.Errorf("invalid partition %q", field)
+		}
+		partitions = append(partitions, int32(partition))
+	}
+	return partitions, nil
+}
+
+// readKafkaOffsets reads the offsets stored at path, which map each partition
+// to the offset of the next record to read. A file that does not exist stores
+// no offsets.
+func readKafkaOffsets(path string) (kafkaOffsets, error) {
+	offsets := make(kafkaOffsets)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return offsets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &offsets); err != nil {
+		return nil, fmt.Errorf("invalid offset file %s: %v", path, err)
+	}
+	return offsets, nil
+}
+
+func writeKafkaOffsets(path string, offsets kafkaOffsets) error {
+	data, err := json.Marshal(offsets)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// newKafkaCluster runs a fake Kafka cluster with the topic events of three
+// partitions and returns its brokers, in the format of KAFKA_BROKERS.
+func newKafkaCluster(t *testing.T) (*kfake.Cluster, string) {
+	t.Helper()
+	cluster, err := kfake.NewCluster(kfake.SeedTopics(3, "events"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster, strings.Join(cluster.ListenAddrs(), ",")
+}
+
+// produceKafka produces a record with each value to the partition of events
+// that precedes it with a colon, as in 2:value.
+func produceKafka(t *testing.T, brokers string, values ...string) {
+	t.Helper()
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(strings.Split(brokers, ",")...),
+		kgo.RecordPartitioner(kgo.ManualPartitioner()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	records := make([]*kgo.Record, len(values))
+	for i, value := range values {
+		var partition int32
+		var data string
+		if _, err := fmt.Sscanf(value, "%d:%s", &partition, &data); err != nil {
+			t.Fatal(err)
+		}
+		records[i] = &kgo.Record{
+			Topic:     "events",
+			Partition: partition,
+			Value:     []byte(data),
+			Headers:   []kgo.RecordHeader{{Key: "x-source", Value: []byte("test")}},
+		}
+	}
+	if err := client.ProduceSync(context.Background(), records...).FirstErr(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// kafkaRecorder records the inputs and metadata with which the Kafka source
+// invokes the function.
+type kafkaRecorder struct {
+	mu       sync.Mutex
+	inputs   []string
+	metadata []map[string]string
+	received chan struct{}
+}
+
+func newKafkaRecorder() *kafkaRecorder {
+	return &kafkaRecorder{received: make(chan struct{}, 100)}
+}
+
+func (kr *kafkaRecorder) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	metadata, _ := runner.MetadataFromContext(ctx)
+	kr.mu.Lock()
+	kr.inputs = append(kr.inputs, string(input.Data))
+	kr.metadata = append(kr.metadata, metadata)
+	kr.mu.Unlock()
+	kr.received <- struct{}{}
+	return &fnrun.Result{Status: 200}, nil
+}
+
+// runKafkaSource runs source with invoker until the recorder has received n
+// inputs, waiting briefly for any extra ones before stopping it.
+func runKafkaSource(t *testing.T, source eventSource, invoker fnrun.Invoker, recorder *kafkaRecorder, n int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- source(ctx, invoker) }()
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-recorder.received:
+		case <-time.After(10 * time.Second):
+			cancel()
+			t.Fatalf("expected %d inputs, got %d", n, i)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected the source to return without an error, got %v", err)
+	}
+}
+
+func TestKafkaSourceReadsAssignedPartitionsWithoutGroup(t *testing.T) {
+	cluster, brokers := newKafkaCluster(t)
+	produceKafka(t, brokers, "0:a0", "1:b0", "2:c0", "0:a1", "1:b1", "2:c1")
+
+	var groupRequests int32
+	for _, key := range []kmsg.Key{kmsg.FindCoordinator, kmsg.JoinGroup, kmsg.OffsetCommit} {
+		cluster.ControlKey(int16(key), func(kmsg.Request) (kmsg.Response, error, bool) {
+			cluster.KeepControl()
+			atomic.AddInt32(&groupRequests, 1)
+			return nil, nil, false
+		})
+	}
+
+	offsetPath := filepath.Join(t.TempDir(), "offsets.json")
+	source, err := newKafkaSource(brokers, "events", "", "0, 2", offsetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := newKafkaRecorder()
+	runKafkaSource(t, source, recorder, recorder, 4)
+
+	byPartition := make(map[string][]string)
+	for i, input := range recorder.inputs {
+		id := recorder.metadata[i][correlationIDKey]
+		partition := strings.Split(id, ":")[1]
+		byPartition[partition] = append(byPartition[partition], input)
+		if recorder.metadata[i]["x-source"] != "test" {
+			t.Errorf("expected the record headers as metadata, got %v", recorder.metadata[i])
+		}
+		if _, err := time.Parse(time.RFC3339Nano, recorder.metadata[i][eventTimestampKey]); err != nil {
+			t.Errorf("expected the record timestamp as metadata, got %v", recorder.metadata[i])
+		}
+	}
+	if len(recorder.inputs) != 4 || strings.Join(byPartition["0"], ",") != "a0,a1" || strings.Join(byPartition["2"], ",") != "c0,c1" {
+		t.Errorf("expected the records of partitions 0 and 2 in order, got %v", byPartition)
+	}
+	if n := atomic.LoadInt32(&groupRequests); n != 0 {
+		t.Errorf("expected the source not to use a consumer group, got %d group requests", n)
+	}
+
+	data, err := ioutil.ReadFile(offsetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsets map[string]int64
+	if err := json.Unmarshal(data, &offsets); err != nil {
+		t.Fatal(err)
+	}
+	if len(offsets) != 2 || offsets["0"] != 2 || offsets["2"] != 2 {
+		t.Errorf("expected the next offsets of partitions 0 and 2 to be stored, got %s", data)
+	}
+}
+
+func TestKafkaSourceResumesFromStoredOffsets(t *testing.T) {
+	_, brokers := newKafkaCluster(t)
+	produceKafka(t, brokers, "1:old0", "1:old1")
+
+	offsetPath := filepath.Join(t.TempDir(), "offsets.json")
+	source, err := newKafkaSource(brokers, "events", "", "1", offsetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := newKafkaRecorder()
+	runKafkaSource(t, source, first, first, 2)
+
+	produceKafka(t, brokers, "1:new")
+	source, err = newKafkaSource(brokers, "events", "", "1", offsetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted := newKafkaRecorder()
+	runKafkaSource(t, source, restarted, restarted, 1)
+	if len(restarted.inputs) != 1 || restarted.inputs[0] != "new" {
+		t.Errorf("expected only the new record after the restart, got %v", restarted.inputs)
+	}
+	if id := restarted.metadata[0][correlationIDKey]; id != "events:1:2" {
+		t.Errorf("expected the correlation ID events:1:2, got %q", id)
+	}
+}
+
+func TestKafkaSourceRetriesFailedRecordsInPlace(t *testing.T) {
+	_, brokers := newKafkaCluster(t)
+	produceKafka(t, brokers, "0:retry", "0:drop", "0:last")
+
+	source, err := newKafkaSource(brokers, "events", "", "0", filepath.Join(t.TempDir(), "offsets.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := newKafkaRecorder()
+	var attempts int32
+	invoker := &nackMappingInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			recorder.Invoke(ctx, input)
+			status := 200
+			if string(input.Data) == "drop" || (string(input.Data) == "retry" && atomic.AddInt32(&attempts, 1) < 3) {
+				status = 500
+			}
+			return &fnrun.Result{Status: status, Data: input.Data}, nil
+		}),
+		mapper: func(result *fnrun.Result) runner.NackDirective {
+			return runner.NackDirective{Requeue: string(result.Data) == "retry", Delay: 10 * time.Millisecond}
+		},
+	}
+	runKafkaSource(t, source, invoker, recorder, 5)
+
+	if got := strings.Join(recorder.inputs, ","); got != "retry,retry,retry,drop,last" {
+		t.Errorf("expected the failed record to be retried before the next ones, got %s", got)
+	}
+}
+
+func TestNewKafkaSourceConfigErrors(t *testing.T) {
+	invalidOffsets := filepath.Join(t.TempDir(), "offsets.json")
+	if err := ioutil.WriteFile(invalidOffsets, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		brokers    string
+		topic      string
+		group      string
+		assignment string
+		offsetPath string
+		wantName   string
+		wantErr    string
+	}{
+		{"no brokers", "", "events", "runners", "", "", "KAFKA_BROKERS", "KAFKA_BROKERS is required"},
+		{"no topic", "localhost:9092", "", "runners", "", "", "KAFKA_TOPIC", "KAFKA_TOPIC is required"},
+		{"no group or assignment", "localhost:9092", "events", "", "", "", "KAFKA_GROUP", "KAFKA_GROUP or KAFKA_PARTITION_ASSIGNMENT is required"},
+		{"invalid partition", "localhost:9092", "events", "", "0,x", "", "KAFKA_PARTITION_ASSIGNMENT", `invalid partition "x"`},
+		{"negative partition", "localhost:9092", "events", "", "-1", "", "KAFKA_PARTITION_ASSIGNMENT", `invalid partition "-1"`},
+		{"invalid offset file", "localhost:9092", "events", "", "0", invalidOffsets, "KAFKA_OFFSET_FILE", "invalid offset file"},
+		{"group", "localhost:9092", "events", "runners", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newKafkaSource(tt.brokers, tt.topic, tt.group, tt.assignment, tt.offsetPath)
+			checkConfigError(t, err, tt.wantName, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	kubeMicroTimeFormat   = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// -----------------------------------------------------------------------------
+// Kubernetes lease backend
+//
+// The lease is a coordination.k8s.io/v1 Lease object in the namespace of the
+// pod. The backend talks to the API server directly using the in-cluster
+// service account credentials, so the service account must be allowed to get,
+// create and update leases. Updates carry the resourceVersion of the lease that
+// was read, so concurrent attempts to take the lease cannot both succeed.
+
+type kubeLease struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   kubeObjectMeta `json:"metadata"`
+	Spec       kubeLeaseSpec  `json:"spec"`
+}
+
+type kubeObjectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type kubeLeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+type kubernetesLeaseBackend struct {
+	client *http.Client
+	url    string
+	name   string
+	token  string
+	now    func() time.Time
+}
+
+func newKubernetesLeaseBackend(name string) (*kubernetesLeaseBackend, error) {
+	// env: KUBERNETES_SERVICE_HOST string "" "Host of the Kubernetes API server, used by the kubernetes leader election backend."
+	// env: KUBERNETES_SERVICE_PORT string "" "Port of the Kubernetes API server."
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, configErrorf("LEADER_ELECTION_BACKEND", "the kubernetes leader election backend must run inside a cluster")
+	}
+
+	token, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("could not parse the service account CA certificate")
+	}
+
+	// env: POD_NAMESPACE string "" "Namespace of the pod running the runner."
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		contents, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "namespace"))
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(contents))
+	}
+
+	return &kubernetesLeaseBackend{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		url:   fmt.Sprintf("https://%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", net.JoinHostPort(host, port), namespace),
+		name:  name,
+		token: strings.TrimSpace(string(token)),
+		now:   time.Now,
+	}, nil
+}
+
+func (k *kubernetesLeaseBackend) Acquire(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	now := k.now()
+	seconds := int(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	lease, err := k.get(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if lease == nil {
+		lease = &kubeLease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   kubeObjectMeta{Name: k.name},
+			Spec: kubeLeaseSpec{
+				HolderIdentity:       id,
+				LeaseDurationSeconds: seconds,
+				AcquireTime:          now.UTC().Format(kubeMicroTimeFormat),
+				RenewTime:            now.UTC().Format(kubeMicroTimeFormat),
+			},
+		}
+		return k.write(ctx, http.MethodPost, k.url, lease)
+	}
+
+	if lease.Spec.HolderIdentity != id {
+		if !k.expired(lease, now) {
+			return false, nil
+		}
+		lease.Spec.HolderIdentity = id
+		lease.Spec.AcquireTime = now.UTC().Format(kubeMicroTimeFormat)
+		lease.Spec.LeaseTransitions++
+	}
+	lease.Spec.LeaseDurationSeconds = seconds
+	lease.Spec.RenewTime = now.UTC().Format(kubeMicroTimeFormat)
+
+	return k.write(ctx, http.MethodPut, k.url+"/"+k.name, lease)
+}
+
+func (k *kubernetesLeaseBackend) Release(ctx context.Context, id string) error {
+	lease, err := k.get(ctx)
+	if err != nil || lease == nil || lease.Spec.HolderIdentity != id {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = ""
+	lease.Spec.RenewTime = ""
+	_, err = k.write(ctx, http.MethodPut, k.url+"/"+k.name, lease)
+	return err
+}
+
+// expired reports whether the holder of lease has failed to renew it in time.
+// A lease without a holder is always expired.
+func (k *kubernetesLeaseBackend) expired(lease *kubeLease, now time.Time) bool {
+	if lease.Spec.HolderIdentity == "" {
+		return true
+	}
+
+	renewed, err := time.Parse(kubeMicroTimeFormat, lease.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+
+	return now.After(renewed.Add(time.Duration(lease.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// get returns the lease, or nil if it does not exist.
+func (k *kubernetesLeaseBackend) get(ctx context.Context) (*kubeLease, error) {
+	resp, err := k.do(ctx, http.MethodGet, k.url+"/"+k.name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var lease kubeLease
+		if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+			return nil, err
+		}
+		return &lease, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("could not get lease %s: %s", k.name, resp.Status)
+	}
+}
+
+// write creates or updates the lease. It reports false without an error if
+// another instance modified the lease first.
+func (k *kubernetesLeaseBackend) write(ctx context.Context, method string, url string, lease *kubeLease) (bool, error) {
+	body, err := json.Marshal(lease)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := k.do(ctx, method, url, body)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	default:
+		return false, fmt.Errorf("could not write lease %s: %s", k.name, resp.Status)
+	}
+}
+
+func (k *kubernetesLeaseBackend) do(ctx context.Context, method string, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return k.client.Do(req)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	customMetricsGroupVersion = "custom.metrics.k8s.io/v1beta2"
+	queueDepthMetricName      = "fnrunner_queue_depth"
+)
+
+// queueDepthReporter is implemented by invokers that can report the number of
+// invocations waiting for an invoker.
+type queueDepthReporter interface {
+	queueDepth() int
+}
+
+// totalQueueDepth returns the queue depth reported by invoker, or zero if it
+// does not report one.
+func totalQueueDepth(invoker interface{}) int {
+	if reporter, ok := invoker.(queueDepthReporter); ok {
+		return reporter.queueDepth()
+	}
+	return 0
+}
+
+// -----------------------------------------------------------------------------
+// Kubernetes custom metrics API
+//
+// These types mirror the subset of the custom.metrics.k8s.io/v1beta2 API that
+// is needed to serve the queue depth metric for the runner's pod.
+
+type kubeAPIResource struct {
+	Name         string   `json:"name"`
+	SingularName string   `json:"singularName"`
+	Namespaced   bool     `json:"namespaced"`
+	Kind         string   `json:"kind"`
+	Verbs        []string `json:"verbs"`
+}
+
+type kubeAPIResourceList struct {
+	Kind         string            `json:"kind"`
+	APIVersion   string            `json:"apiVersion"`
+	GroupVersion string            `json:"groupVersion"`
+	Resources    []kubeAPIResource `json:"resources"`
+}
+
+type kubeObjectReference struct {
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	APIVersion string `json:"apiVersion"`
+}
+
+type kubeMetricIdentifier struct {
+	Name     string      `json:"name"`
+	Selector interface{} `json:"selector"`
+}
+
+type kubeMetricValue struct {
+	DescribedObject kubeObjectReference  `json:"describedObject"`
+	Metric          kubeMetricIdentifier `json:"metric"`
+	Timestamp       string               `json:"timestamp"`
+	Value           string               `json:"value"`
+}
+
+type kubeMetricValueList struct {
+	Kind       string            `json:"kind"`
+	APIVersion string            `json:"apiVersion"`
+	Metadata   struct{}          `json:"metadata"`
+	Items      []kubeMetricValue `json:"items"`
+}
+
+// newKubeMetricsHandler returns a handler that serves the queue depth of
+// invoker through the Kubernetes custom metrics API. The pod is identified by
+// the POD_NAME and POD_NAMESPACE environment variables, which are typically
+// provided by the downward API.
+func newKubeMetricsHandler(invoker interface{}) http.Handler {
+	// env: POD_NAME string "" "Name of the pod running the runner, provided by the Kubernetes downward API."
+	podName := os.Getenv("POD_NAME")
+	podNamespace := os.Getenv("POD_NAMESPACE")
+	prefix := "/apis/" + customMetricsGroupVersion
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, kubeAPIResourceList{
+			Kind:         "APIResourceList",
+			APIVersion:   "v1",
+			GroupVersion: customMetricsGroupVersion,
+			Resources: []kubeAPIResource{{
+				Name:       "pods/" + queueDepthMetricName,
+				Namespaced: true,
+				Kind:       "MetricValueList",
+				Verbs:      []string{"get"},
+			}},
+		})
+	})
+
+	// Paths have the form /namespaces/{namespace}/pods/{name}/{metric}, where
+	// name may be "*" to select all pods.
+	mux.HandleFunc(prefix+"/namespaces/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix+"/namespaces/"), "/")
+		if len(parts) != 4 || parts[1] != "pods" || parts[3] != queueDepthMetricName {
+			http.NotFound(w, r)
+			return
+		}
+		if parts[0] != podNamespace || (parts[2] != "*" && parts[2] != podName) {
+			http.NotFound(w, r)
+			return
+		}
+
+		list := kubeMetricValueList{
+			Kind:       "MetricValueList",
+			APIVersion: customMetricsGroupVersion,
+			Items: []kubeMetricValue{{
+				DescribedObject: kubeObjectReference{
+					Kind:       "Pod",
+					Namespace:  podNamespace,
+					Name:       podName,
+					APIVersion: "/v1",
+				},
+				Metric:    kubeMetricIdentifier{Name: queueDepthMetricName},
+				Timestamp: time.Now().UTC().Format(time.RFC3339),
+				Value:     strconv.Itoa(totalQueueDepth(invoker)),
+			}},
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fixedQueueDepth reports a constant queue depth.
+type fixedQueueDepth int
+
+func (d fixedQueueDepth) queueDepth() int { return int(d) }
+
+func getKubeMetrics(t *testing.T, handler http.Handler, path string) (int, map[string]interface{}) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if recorder.Code != http.StatusOK {
+		return recorder.Code, nil
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected application/json, got %q", contentType)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("could not decode the response: %v", err)
+	}
+	return recorder.Code, body
+}
+
+func TestKubeMetricsHandlerServesAPIResourceList(t *testing.T) {
+	handler := newKubeMetricsHandler(fixedQueueDepth(0))
+
+	_, body := getKubeMetrics(t, handler, "/apis/custom.metrics.k8s.io/v1beta2")
+	if body["kind"] != "APIResourceList" || body["apiVersion"] != "v1" || body["groupVersion"] != "custom.metrics.k8s.io/v1beta2" {
+		t.Errorf("unexpected resource list %v", body)
+	}
+	resources, _ := body["resources"].([]interface{})
+	if len(resources) != 1 {
+		t.Fatalf("expected one resource, got %v", body["resources"])
+	}
+	resource := resources[0].(map[string]interface{})
+	for key, want := range map[string]interface{}{"name": "pods/fnrunner_queue_depth", "namespaced": true, "kind": "MetricValueList"} {
+		if resource[key] != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, resource[key])
+		}
+	}
+	if _, ok := resource["singularName"]; !ok {
+		t.Error("expected the resource to have a singularName")
+	}
+	if verbs, _ := resource["verbs"].([]interface{}); len(verbs) != 1 || verbs[0] != "get" {
+		t.Errorf("expected the get verb, got %v", resource["verbs"])
+	}
+}
+
+func TestKubeMetricsHandlerServesQueueDepth(t *testing.T) {
+	t.Setenv("POD_NAME", "runner-0")
+	t.Setenv("POD_NAMESPACE", "jobs")
+	handler := newKubeMetricsHandler(fixedQueueDepth(7))
+
+	for _, pod := range []string{"runner-0", "*"} {
+		_, body := getKubeMetrics(t, handler, "/apis/custom.metrics.k8s.io/v1beta2/namespaces/jobs/pods/"+pod+"/fnrunner_queue_depth")
+		if body["kind"] != "MetricValueList" || body["apiVersion"] != "custom.metrics.k8s.io/v1beta2" {
+			t.Errorf("unexpected metric value list %v", body)
+		}
+		if _, ok := body["metadata"].(map[string]interface{}); !ok {
+			t.Errorf("expected list metadata, got %v", body["metadata"])
+		}
+		items, _ := body["items"].([]interface{})
+		if len(items) != 1 {
+			t.Fatalf("expected one item, got %v", body["items"])
+		}
+		item := items[0].(map[string]interface{})
+
+		object := item["describedObject"].(map[string]interface{})
+		for key, want := range map[string]string{"kind": "Pod", "namespace": "jobs", "name": "runner-0", "apiVersion": "/v1"} {
+			if object[key] != want {
+				t.Errorf("expected describedObject.%s to be %q, got %v", key, want, object[key])
+			}
+		}
+		if metric := item["metric"].(map[string]interface{}); metric["name"] != "fnrunner_queue_depth" {
+			t.Errorf("unexpected metric %v", metric)
+		}
+		if _, err := time.Parse(time.RFC3339, item["timestamp"].(string)); err != nil {
+			t.Errorf("expected an RFC 3339 timestamp, got %v", item["timestamp"])
+		}
+		if value, ok := item["value"].(string); !ok || value != strconv.Itoa(7) {
+			t.Errorf("expected the quantity 7, got %v", item["value"])
+		}
+	}
+}
+
+func TestKubeMetricsHandlerRejectsOtherObjects(t *testing.T) {
+	t.Setenv("POD_NAME", "runner-0")
+	t.Setenv("POD_NAMESPACE", "jobs")
+	handler := newKubeMetricsHandler(fixedQueueDepth(7))
+
+	for _, path := range []string{
+		"/apis/custom.metrics.k8s.io/v1beta2/namespaces/other/pods/runner-0/fnrunner_queue_depth",
+		"/apis/custom.metrics.k8s.io/v1beta2/namespaces/jobs/pods/runner-1/fnrunner_queue_depth",
+		"/apis/custom.metrics.k8s.io/v1beta2/namespaces/jobs/pods/runner-0/other_metric",
+		"/apis/custom.metrics.k8s.io/v1beta2/namespaces/jobs/services/runner-0/fnrunner_queue_depth",
+	} {
+		if code, _ := getKubeMetrics(t, handler, path); code != http.StatusNotFound {
+			t.Errorf("expected 404 for %s, got %d", path, code)
+		}
+	}
+}
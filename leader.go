@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+const defaultLeaderElectionKey = "fnrun:leader"
+
+// leaseBackend stores the lease that determines which runner instance is the
+// leader.
+type leaseBackend interface {
+	// Acquire takes the lease for id if it is free or expired, or renews it if
+	// id already holds it. It reports whether id holds the lease.
+	Acquire(ctx context.Context, id string, ttl time.Duration) (bool, error)
+
+	// Release gives up the lease if it is held by id.
+	Release(ctx context.Context, id string) error
+}
+
+func getLeaseBackend() (leaseBackend, error) {
+	// env: LEADER_ELECTION_BACKEND string "" "Store of the leader lease: redis or kubernetes."
+	switch backend := os.Getenv("LEADER_ELECTION_BACKEND"); backend {
+	case "redis":
+		// env: LEADER_ELECTION_REDIS_ADDR string "" "Address of the Redis server holding the leader lease."
+		addr := os.Getenv("LEADER_ELECTION_REDIS_ADDR")
+		if addr == "" {
+			return nil, configErrorf("LEADER_ELECTION_REDIS_ADDR", "LEADER_ELECTION_REDIS_ADDR is required when LEADER_ELECTION_BACKEND is redis")
+		}
+		// env: LEADER_ELECTION_KEY string fnrun:leader "Redis key of the leader lease."
+		key := getStringEnv("LEADER_ELECTION_KEY", defaultLeaderElectionKey)
+		return &redisLeaseBackend{client: newRedisClient(addr), key: key}, nil
+	case "kubernetes":
+		// env: LEADER_ELECTION_LEASE_NAME string fnrun-runner "Name of the Kubernetes Lease object of the leader lease."
+		return newKubernetesLeaseBackend(getStringEnv("LEADER_ELECTION_LEASE_NAME", "fnrun-runner"))
+	default:
+		return nil, configErrorf("LEADER_ELECTION_BACKEND", "Unknown LEADER_ELECTION_BACKEND %s", backend)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Leader-Elected Source
+//
+// A leader-elected source runs the underlying source only while this runner
+// instance holds the lease. Followers attempt to acquire the lease every renew
+// interval so that one of them takes over when the leader stops renewing it.
+//
+// The leader renews the lease every renew interval. If the lease is taken by
+// another instance, or cannot be renewed before it expires, the leader cancels
+// its source and becomes a follower again. The lease is released when the
+// runner shuts down so that a follower can take over without waiting for it to
+// expire.
+
+type leaderElectedSource struct {
+	source        eventSource
+	backend       leaseBackend
+	id            string
+	ttl           time.Duration
+	renewInterval time.Duration
+}
+
+func newLeaderElectedSource(source eventSource, backend leaseBackend, id string, ttl time.Duration, renewInterval time.Duration) eventSource {
+	les := &leaderElectedSource{
+		source:        source,
+		backend:       backend,
+		id:            id,
+		ttl:           ttl,
+		renewInterval: renewInterval,
+	}
+	return les.run
+}
+
+func (les *leaderElectedSource) run(ctx context.Context, invoker fnrun.Invoker) error {
+	for {
+		if err := les.waitForLease(ctx); err != nil {
+			return nil
+		}
+		log.Printf("leader election: %s acquired the lease", les.id)
+
+		done, err := les.lead(ctx, invoker)
+		if done {
+			releaseCtx, cancel := context.WithTimeout(context.Background(), les.renewInterval)
+			if releaseErr := les.backend.Release(releaseCtx, les.id); releaseErr != nil {
+				log.Printf("leader election: could not release the lease: %v", releaseErr)
+			}
+			cancel()
+			return err
+		}
+		if err != nil {
+			log.Printf("leader election: source stopped after losing the lease: %v", err)
+		}
+		log.Printf("leader election: %s lost the lease", les.id)
+	}
+}
+
+// waitForLease blocks until the lease is acquired or ctx is done.
+func (les *leaderElectedSource) waitForLease(ctx context.Context) error {
+	for {
+		held, err := les.backend.Acquire(ctx, les.id, les.ttl)
+		if err != nil {
+			log.Printf("leader election: could not acquire the lease: %v", err)
+		}
+		if held {
+			return nil
+		}
+
+		select {
+		case <-time.After(les.renewInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// lead runs the source while renewing the lease. It reports whether the source
+// returned on its own or because ctx is done, as opposed to being stopped
+// after the lease was lost, along with the error returned by the source.
+func (les *leaderElectedSource) lead(ctx context.Context, invoker fnrun.Invoker) (bool, error) {
+	sourceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- les.source(sourceCtx, invoker)
+	}()
+
+	ticker := time.NewTicker(les.renewInterval)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case err := <-result:
+			return true, err
+		case <-ticker.C:
+		}
+
+		held, err := les.backend.Acquire(ctx, les.id, les.ttl)
+		if err != nil {
+			log.Printf("leader election: could not renew the lease: %v", err)
+			if time.Since(renewed) < les.ttl {
+				continue
+			}
+		}
+		if held {
+			renewed = time.Now()
+			continue
+		}
+
+		cancel()
+		return ctx.Err() != nil, <-result
+	}
+}
+
+// getLeaderElectionID returns the identity used by this runner instance when
+// taking the lease.
+func getLeaderElectionID() string {
+	// env: LEADER_ELECTION_ID string "" "Identity of this instance in leader election; POD_NAME or the host name and PID is used when unset."
+	if id := os.Getenv("LEADER_ELECTION_ID"); id != "" {
+		return id
+	}
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid())
+}
+
+// -----------------------------------------------------------------------------
+// Redis lease backend
+//
+// The lease is a key whose value is the identity of the leader. It is taken
+// with SET NX PX and renewed or released with a script that checks the holder
+// so that an instance never extends or deletes a lease it does not hold.
+
+const (
+	redisRenewLeaseScript   = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+	redisReleaseLeaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+)
+
+type redisLeaseBackend struct {
+	client *redisClient
+	key    string
+}
+
+func (r *redisLeaseBackend) Acquire(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	millis := strconv.FormatInt(int64(ttl/time.Millisecond), 10)
+
+	reply, err := r.client.do(ctx, "SET", r.key, id, "NX", "PX", millis)
+	if err != nil {
+		return false, err
+	}
+	if reply != nil {
+		return true, nil
+	}
+
+	reply, err = r.client.do(ctx, "EVAL", redisRenewLeaseScript, "1", r.key, id, millis)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil && *reply == "1", nil
+}
+
+func (r *redisLeaseBackend) Release(ctx context.Context, id string) error {
+	_, err := r.client.do(ctx, "EVAL", redisReleaseLeaseScript, "1", r.key, id)
+	return err
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// memoryLeaseBackend is a leaseBackend that keeps the lease in memory.
+type memoryLeaseBackend struct {
+	mu      sync.Mutex
+	holder  string
+	expires time.Time
+}
+
+func (m *memoryLeaseBackend) Acquire(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.holder != "" && m.holder != id && time.Now().Before(m.expires) {
+		return false, nil
+	}
+	m.holder, m.expires = id, time.Now().Add(ttl)
+	return true, nil
+}
+
+func (m *memoryLeaseBackend) Release(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.holder == id {
+		m.holder = ""
+	}
+	return nil
+}
+
+func (m *memoryLeaseBackend) steal(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.holder, m.expires = id, time.Now().Add(time.Hour)
+}
+
+// activeSources counts the sources that are running and records the largest
+// number that ran at the same time.
+type activeSources struct {
+	mu      sync.Mutex
+	active  map[string]bool
+	maximum int
+}
+
+func (a *activeSources) source(id string) eventSource {
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		a.mu.Lock()
+		a.active[id] = true
+		if len(a.active) > a.maximum {
+			a.maximum = len(a.active)
+		}
+		a.mu.Unlock()
+
+		<-ctx.Done()
+
+		a.mu.Lock()
+		delete(a.active, id)
+		a.mu.Unlock()
+		return nil
+	}
+}
+
+func (a *activeSources) waitFor(t *testing.T, id string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		a.mu.Lock()
+		active := a.active[id]
+		a.mu.Unlock()
+		if active {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected the source of %s to become active", id)
+}
+
+func TestLeaderElectedSourcesRunOneAtATime(t *testing.T) {
+	backend := &memoryLeaseBackend{}
+	sources := &activeSources{active: make(map[string]bool)}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	var wg sync.WaitGroup
+	for _, instance := range []struct {
+		id  string
+		ctx context.Context
+	}{{"a", ctxA}, {"b", ctxB}} {
+		source := newLeaderElectedSource(sources.source(instance.id), backend, instance.id, 200*time.Millisecond, 10*time.Millisecond)
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+			source(ctx, nil)
+		}(instance.ctx)
+		if instance.id == "a" {
+			sources.waitFor(t, "a")
+		}
+	}
+
+	// b keeps trying to take the lease while a holds it.
+	time.Sleep(100 * time.Millisecond)
+
+	// When a shuts down, it releases the lease, and b takes over.
+	cancelA()
+	sources.waitFor(t, "b")
+	cancelB()
+	wg.Wait()
+
+	if sources.maximum != 1 {
+		t.Errorf("expected one source to be active at a time, got %d", sources.maximum)
+	}
+}
+
+func TestLeaderElectedSourceStopsWhenTheLeaseIsLost(t *testing.T) {
+	backend := &memoryLeaseBackend{}
+	var runs int64
+	stopped := make(chan struct{}, 1)
+	source := newLeaderElectedSource(func(ctx context.Context, invoker fnrun.Invoker) error {
+		atomic.AddInt64(&runs, 1)
+		<-ctx.Done()
+		stopped <- struct{}{}
+		return nil
+	}, backend, "a", time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go source(ctx, nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&runs) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	backend.steal("b")
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the source to be cancelled when another instance took the lease")
+	}
+	if n := atomic.LoadInt64(&runs); n != 1 {
+		t.Errorf("expected the source not to run again while the lease is held elsewhere, ran %d times", n)
+	}
+}
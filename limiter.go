@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"golang.org/x/time/rate"
+)
+
+// -----------------------------------------------------------------------------
+// Concurrency Limiter
+//
+// The concurrency limiter bounds the number of invocations in flight between
+// the source and the sink. An invocation acquires a token before it reaches the
+// function and releases it only after the result has been delivered to the
+// sink, so a source that dispatches faster than events can be processed blocks
+// instead of building up a backlog of invocations waiting for an invoker. The
+// limit is the number of invokers across all pools of the runner, such as the
+// tenant, version or A/B pools, times BATCH_SIZE.
+//
+// High-priority invocations may also take one of priorityLimit additional
+// tokens, so that they are not held up behind the backlog.
+//
+// The time an invocation waits for a token is counted by the pool as part of
+// its wait for a slot.
+
+type concurrencyLimiter struct {
+	invoker           fnrun.Invoker
+	semaphore         chan struct{}
+	priorityKey       string
+	prioritySemaphore chan struct{}
+}
+
+func newConcurrencyLimiter(invoker fnrun.Invoker, limit int, priorityKey string, priorityLimit int) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		invoker:           invoker,
+		semaphore:         make(chan struct{}, limit),
+		priorityKey:       priorityKey,
+		prioritySemaphore: make(chan struct{}, priorityLimit),
+	}
+}
+
+func (cl *concurrencyLimiter) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	var prioritySemaphore chan struct{}
+	if isHighPriority(ctx, cl.priorityKey) {
+		prioritySemaphore = cl.prioritySemaphore
+	}
+
+	start := time.Now()
+	select {
+	case cl.semaphore <- struct{}{}:
+		defer func() { <-cl.semaphore }()
+	case prioritySemaphore <- struct{}{}:
+		defer func() { <-prioritySemaphore }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return cl.invoker.Invoke(withQueuedTime(ctx, time.Since(start)), input)
+}
+
+// capacityReporter is implemented by invokers that can report how many
+// invocations they can run at once across all of their pools, and how many
+// additional high-priority invocations.
+type capacityReporter interface {
+	capacity() (slots int, prioritySlots int)
+}
+
+// totalCapacity returns the capacity reported by invoker, or zero if it does
+// not report one.
+func totalCapacity(invoker interface{}) (slots int, prioritySlots int) {
+	if reporter, ok := invoker.(capacityReporter); ok {
+		return reporter.capacity()
+	}
+	return 0, 0
+}
+
+// -----------------------------------------------------------------------------
+// Rate Limiter
+//
+// The rate limiter bounds the rate at which events are admitted by a token
+// bucket. A single limiter is shared by every goroutine that the source invokes
+// from, such as the copies run with SOURCE_CONCURRENCY, so that the limit
+// applies to the runner as a whole rather than to each of them.
+
+type rateLimitedInvoker struct {
+	invoker fnrun.Invoker
+	limiter *rate.Limiter
+}
+
+func newRateLimitedInvoker(invoker fnrun.Invoker, perSecond float64, burst int) *rateLimitedInvoker {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimitedInvoker{invoker: invoker, limiter: rate.NewLimiter(rate.Limit(perSecond), burst)}
+}
+
+func (ri *rateLimitedInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	if err := ri.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return ri.invoker.Invoke(ctx, input)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestConcurrencyLimiterBoundsInFlightInvocations(t *testing.T) {
+	var inFlight, maxInFlight int32
+	cl := newConcurrencyLimiter(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return &fnrun.Result{}, nil
+	}), 3, "", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cl.Invoke(context.Background(), &fnrun.Input{})
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 3 {
+		t.Errorf("expected at most 3 invocations in flight, got %d", maxInFlight)
+	}
+}
+
+func TestConcurrencyLimiterRespectsCancellation(t *testing.T) {
+	release := make(chan struct{})
+	cl := newConcurrencyLimiter(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		<-release
+		return &fnrun.Result{}, nil
+	}), 1, "", 0)
+	go cl.Invoke(context.Background(), &fnrun.Input{})
+	defer close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for len(cl.semaphore) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := cl.Invoke(ctx, &fnrun.Input{}); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestTotalCapacityOfRouters(t *testing.T) {
+	t.Setenv("INVOKER_TYPE", "echo")
+	t.Setenv("MAX_FUNCTION_COUNT", "3")
+
+	poolA, err := newSizedInvokerPool(&staticInvokerFactory{invoker: echoInvoker{}}, "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolB, err := newSizedInvokerPool(&staticInvokerFactory{invoker: echoInvoker{}}, "", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer poolA.Close()
+	defer poolB.Close()
+
+	if slots, _ := totalCapacity(newWeightedRouter(poolA, poolB, 50)); slots != 8 {
+		t.Errorf("expected the weighted router to have 8 slots, got %d", slots)
+	}
+	if slots, _ := totalCapacity(newCanaryRouter(poolA, poolB, nil)); slots != 3 {
+		t.Errorf("expected the canary router to have 3 slots, got %d", slots)
+	}
+	if slots, _ := totalCapacity(newTenantRouter("tenant", 4)); slots != 12 {
+		t.Errorf("expected the tenant router to have 12 slots, got %d", slots)
+	}
+	if slots, _ := totalCapacity(echoInvoker{}); slots != 0 {
+		t.Errorf("expected an invoker without pools to report no capacity, got %d", slots)
+	}
+}
+
+func TestRateLimiterBoundsTheThroughputOfConcurrentSources(t *testing.T) {
+	var invocations int64
+	limited := newRateLimitedInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		atomic.AddInt64(&invocations, 1)
+		return &fnrun.Result{}, nil
+	}), 50, 1)
+	busySource := func(ctx context.Context, invoker fnrun.Invoker) error {
+		for ctx.Err() == nil {
+			invoker.Invoke(ctx, &fnrun.Input{})
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := newConcurrentSource(busySource, 2)(ctx, limited); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 50 per second for half a second, plus the initial burst of one.
+	if got := atomic.LoadInt64(&invocations); got < 20 || got > 26 {
+		t.Errorf("expected two sources to share the limit of about 26 invocations, got %d", got)
+	}
+}
+
+func TestRateLimiterRespectsCancellation(t *testing.T) {
+	limited := newRateLimitedInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{}, nil
+	}), 0.1, 1)
+	if _, err := limited.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := limited.Invoke(ctx, &fnrun.Input{}); err == nil {
+		t.Error("expected an invocation that cannot be admitted before the deadline to fail")
+	}
+}
+
+func TestConcurrencyLimiterAdmitsHighPriorityInputs(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	cl := newConcurrencyLimiter(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if string(input.Data) == "block" {
+			<-release
+		}
+		return &fnrun.Result{}, nil
+	}), 1, "x-priority", 1)
+	go cl.Invoke(context.Background(), &fnrun.Input{Data: []byte("block")})
+
+	deadline := time.Now().Add(time.Second)
+	for len(cl.semaphore) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	high := runner.WithMetadata(context.Background(), map[string]string{"x-priority": "high"})
+	ctx, cancel := context.WithTimeout(high, time.Second)
+	defer cancel()
+	if _, err := cl.Invoke(ctx, &fnrun.Input{}); err != nil {
+		t.Errorf("expected a high-priority input to be admitted, got %v", err)
+	}
+
+	low := runner.WithMetadata(context.Background(), map[string]string{"x-priority": "low"})
+	ctx, cancel = context.WithTimeout(low, 20*time.Millisecond)
+	defer cancel()
+	if _, err := cl.Invoke(ctx, &fnrun.Input{}); err != context.DeadlineExceeded {
+		t.Errorf("expected a low-priority input to wait, got %v", err)
+	}
+}
@@ -2,15 +2,28 @@ package main
 
 import (
 	"context"
+	cryptorand "crypto/rand"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
 	"os"
+	"os/signal"
 	"plugin"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/tessellator/executil"
 	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+	"github.com/tessellator/fnrun-runner/runner/db"
 )
 
 // -----------------------------------------------------------------------------
@@ -20,134 +33,909 @@ type eventSource func(ctx context.Context, invoker fnrun.Invoker) error
 
 type eventSink func(ctx context.Context, result *fnrun.Result) error
 
+type eventSinkTransformer func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error)
+
+type closableInvoker interface {
+	fnrun.Invoker
+	io.Closer
+}
+
 // -----------------------------------------------------------------------------
 // Sink Invoker
 //
 // This is a special type of invoker that also performs a side-effect of sending
 // the result to a sink function.
 
+const eventTimestampKey = "x-event-timestamp"
+
+var sourceToSinkLatency = newHistogram(
+	"fnrunner_source_to_sink_latency_seconds",
+	"Time from the arrival of an event at the source to the delivery of its result to the sink.",
+	defaultDurationBuckets,
+)
+
 type sinkInvoker struct {
 	invoker fnrun.Invoker
-	sink    eventSink
+	sink    eventSinkTransformer
 }
 
 func (si *sinkInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
-	result, err := si.invoker.Invoke(ctx, input)
+	if si.invoker == nil {
+		return nil, runner.ErrNilInvoker
+	}
+
+	inputSize.observe(float64(len(input.Data)))
+	result, err := si.invoker.Invoke(withBaggageEnv(ctx), input)
 	if err != nil {
 		return result, err
 	}
 
-	if si.sink == nil {
+	// The results of a streaming function have already been delivered.
+	if stream, ok := resultStreamFromContext(ctx); ok {
+		if streamed, err := stream.streamed(); streamed {
+			return result, err
+		}
+	}
+
+	if result != nil {
+		resultSize.observe(float64(len(result.Data)))
+	}
+
+	// There is nothing to deliver when no sink is configured or the invoker
+	// did not produce a result.
+	if si.sink == nil || result == nil {
+		return result, nil
+	}
+
+	observeSourceToSinkLatency(ctx)
+	transformed, err := deliverToSink(ctx, si.sink, result)
+	if err != nil {
 		return result, err
 	}
 
-	newErr := si.sink(ctx, result)
-	if newErr != nil {
-		return result, newErr
+	// A sink transformer may replace the result for downstream use, such as
+	// the response of the source.
+	if transformed != nil {
+		return transformed, nil
+	}
+	return result, nil
+}
+
+// InvokeAsync starts an invocation in the background and returns immediately,
+// for sources that cannot block while an event is processed. The callback is
+// called exactly once: with the outcome of the invocation, or with the error
+// of ctx if ctx is done first. The invocation is made with ctx, so cancelling
+// ctx also cancels the invocation and the sink delivery; the outcome of an
+// invocation that returns after the callback has been called is discarded.
+func (si *sinkInvoker) InvokeAsync(ctx context.Context, input *fnrun.Input, callback func(*fnrun.Result, error)) {
+	go func() {
+		var result *fnrun.Result
+		var err error
+		done := make(chan struct{})
+		go func() {
+			result, err = si.Invoke(ctx, input)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			callback(result, err)
+		case <-ctx.Done():
+			callback(nil, ctx.Err())
+		}
+	}()
+}
+
+// deliverToSink passes result to sink within a sink span and returns the
+// result produced by the sink, reporting a failure as a runner.SinkError.
+func deliverToSink(ctx context.Context, sink eventSinkTransformer, result *fnrun.Result) (*fnrun.Result, error) {
+	ctx, endSpan := traceSinkDelivery(ctx)
+
+	start := time.Now()
+	transformed, err := sink(ctx, result)
+	endSpan(err)
+	if err != nil {
+		return transformed, &runner.SinkError{Duration: time.Since(start), Err: err}
+	}
+	return transformed, nil
+}
+
+// observeSourceToSinkLatency records the time since the event was received by
+// the source if the source set the x-event-timestamp metadata key to an RFC
+// 3339 timestamp.
+func observeSourceToSinkLatency(ctx context.Context) {
+	metadata, ok := runner.MetadataFromContext(ctx)
+	if !ok || metadata[eventTimestampKey] == "" {
+		return
+	}
+
+	received, err := time.Parse(time.RFC3339Nano, metadata[eventTimestampKey])
+	if err != nil {
+		return
 	}
 
-	return result, err
+	sourceToSinkLatency.observe(time.Since(received).Seconds())
 }
 
 // -----------------------------------------------------------------------------
 // Main application
 
-func getEventSource() (eventSource, error) {
-	path := os.Getenv("SOURCE_PLUGIN_PATH")
-	if path == "" {
-		return nil, errors.New("SOURCE_PLUGIN_PATH is a required environment variable")
+// getStringEnv returns the value of the named environment variable, or
+// defaultValue if the variable is unset.
+func getStringEnv(name string, defaultValue string) string {
+	if str := os.Getenv(name); str != "" {
+		return str
 	}
+	return defaultValue
+}
 
-	p, err := plugin.Open(path)
+// getIntEnv returns the integer value of the named environment variable, or
+// defaultValue if the variable is unset or cannot be parsed.
+func getIntEnv(name string, defaultValue int) int {
+	str := os.Getenv(name)
+	if str == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(str)
+	if err != nil {
+		return defaultValue
+	}
+
+	return i
+}
+
+// getBoolEnv returns the boolean value of the named environment variable, or
+// defaultValue if the variable is unset or cannot be parsed.
+func getBoolEnv(name string, defaultValue bool) bool {
+	str := os.Getenv(name)
+	if str == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(str)
+	if err != nil {
+		return defaultValue
+	}
+
+	return b
+}
+
+// getFloatEnv returns the floating-point value of the named environment
+// variable, or defaultValue if the variable is unset or cannot be parsed.
+func getFloatEnv(name string, defaultValue float64) float64 {
+	str := os.Getenv(name)
+	if str == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return defaultValue
+	}
+
+	return f
+}
+
+// configErrorf returns a runner.ConfigError for the named environment variable
+// with a message formatted according to format.
+func configErrorf(name string, format string, args ...interface{}) error {
+	return &runner.ConfigError{Name: name, Err: fmt.Errorf(format, args...)}
+}
+
+// pluginErrorf returns a runner.PluginLoadError for the symbol in the plugin
+// at path with a message formatted according to format.
+func pluginErrorf(path string, symbol string, format string, args ...interface{}) error {
+	return &runner.PluginLoadError{Path: path, Symbol: symbol, Err: fmt.Errorf(format, args...)}
+}
+
+// connectWithBackoff calls dial with runner.ConnectWithBackoff, using the retry
+// limit and base delay configured by CONNECT_MAX_RETRIES and
+// CONNECT_BACKOFF_MILLIS.
+func connectWithBackoff(dial func() error) error {
+	return runner.ConnectWithBackoff(
+		dial,
+		// env: CONNECT_MAX_RETRIES int 3 "Number of times a failed connection to an external service is retried."
+		getIntEnv("CONNECT_MAX_RETRIES", 3),
+		// env: CONNECT_BACKOFF_MILLIS int 100 "Base delay between attempts to connect to an external service; it doubles after each attempt."
+		time.Duration(getIntEnv("CONNECT_BACKOFF_MILLIS", 100))*time.Millisecond,
+	)
+}
+
+// loadedPlugin is the outcome of opening a plugin. The plugin is opened at most
+// once, however many callers ask for it concurrently.
+type loadedPlugin struct {
+	once   sync.Once
+	plugin *plugin.Plugin
+	err    error
+}
+
+var (
+	pluginsMu sync.RWMutex
+	plugins   = make(map[string]*loadedPlugin)
+)
+
+// openPlugin opens the plugin at path, or returns the result of a previous
+// attempt to open it. Unless PLUGIN_ABI_CHECK is false, the plugin is first
+// checked for compatibility with the runner so that a mismatched build is
+// reported with a descriptive error. Opening the plugin is subject to
+// PLUGIN_SYMBOL_TIMEOUT_MILLIS, as described for callWithPluginTimeout.
+func openPlugin(path string) (*plugin.Plugin, error) {
+	pluginsMu.RLock()
+	loaded, ok := plugins[path]
+	pluginsMu.RUnlock()
+
+	if !ok {
+		pluginsMu.Lock()
+		if loaded, ok = plugins[path]; !ok {
+			loaded = &loadedPlugin{}
+			plugins[path] = loaded
+		}
+		pluginsMu.Unlock()
+	}
+
+	loaded.once.Do(func() {
+		// env: PLUGIN_ABI_CHECK bool true "Check that plugins were built against the same runner ABI."
+		if getBoolEnv("PLUGIN_ABI_CHECK", true) {
+			if err := checkPluginCompatibility(path); err != nil {
+				loaded.err = &runner.PluginLoadError{Path: path, Err: err}
+				return
+			}
+		}
+		var p *plugin.Plugin
+		var openErr error
+		if err := callWithPluginTimeout(func() { p, openErr = plugin.Open(path) }); err != nil {
+			loaded.err = &runner.PluginLoadError{Path: path, Err: fmt.Errorf("could not open %s: %w", path, err)}
+			return
+		}
+		loaded.plugin, loaded.err = p, openErr
+		if loaded.err != nil {
+			loaded.err = &runner.PluginLoadError{Path: path, Err: loaded.err}
+			return
+		}
+		// env: REQUIRED_PLUGIN_VERSION string "" "Semantic version requirement that every plugin must satisfy."
+		if requirement := os.Getenv("REQUIRED_PLUGIN_VERSION"); requirement != "" {
+			if err := checkPluginVersion(path, loaded.plugin, requirement); err != nil {
+				loaded.plugin, loaded.err = nil, &runner.PluginLoadError{Path: path, Symbol: pluginVersionSymbol, Err: err}
+			}
+		}
+	})
+
+	return loaded.plugin, loaded.err
+}
+
+// lookupPluginSymbol opens the plugin at path and looks up the named symbol.
+func lookupPluginSymbol(path string, symbolName string) (plugin.Symbol, error) {
+	p, err := openPlugin(path)
 	if err != nil {
 		return nil, err
 	}
 
-	symbolName := os.Getenv("SOURCE_PLUGIN_SYMBOL")
-	if symbolName == "" {
-		return nil, errors.New("SOURCE_PLUGIN_SYMBOL is a required environment variable")
+	sym, err := lookupWithTimeout(p, symbolName)
+	if err != nil {
+		return nil, &runner.PluginLoadError{Path: path, Symbol: symbolName, Err: err}
+	}
+
+	return sym, nil
+}
+
+// lookupWithTimeout looks up the named symbol in p, subject to the plugin
+// timeout.
+func lookupWithTimeout(p *plugin.Plugin, symbolName string) (sym plugin.Symbol, err error) {
+	var lookupErr error
+	if err := callWithPluginTimeout(func() { sym, lookupErr = p.Lookup(symbolName) }); err != nil {
+		return nil, fmt.Errorf("could not look up symbol %s: %w", symbolName, err)
+	}
+	return sym, lookupErr
+}
+
+// callWithPluginTimeout calls fn, which opens a plugin or looks up a symbol in
+// one, and waits for it to return for at most PLUGIN_SYMBOL_TIMEOUT_MILLIS.
+// Opening a plugin runs its init functions, which may be slow. A call that
+// times out cannot be stopped, so it is abandoned to finish in the background
+// and runner.ErrPluginTimeout is returned; fn must not write to state that the
+// caller reads after a timeout.
+func callWithPluginTimeout(fn func()) error {
+	// env: PLUGIN_SYMBOL_TIMEOUT_MILLIS int 0 "Maximum time to open a plugin, which runs its init functions, or to look up a symbol in it; unlimited when 0."
+	timeout := time.Duration(getIntEnv("PLUGIN_SYMBOL_TIMEOUT_MILLIS", 0)) * time.Millisecond
+	if timeout <= 0 {
+		fn()
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return runner.ErrPluginTimeout
+	}
+}
+
+// lookupFirstPluginSymbol opens the plugin at path and looks up each of the
+// candidate symbol names in order, returning the first symbol that exists along
+// with its name.
+func lookupFirstPluginSymbol(path string, symbolNames []string) (plugin.Symbol, string, error) {
+	p, err := openPlugin(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, symbolName := range symbolNames {
+		sym, err := lookupWithTimeout(p, symbolName)
+		if errors.Is(err, runner.ErrPluginTimeout) {
+			return nil, "", &runner.PluginLoadError{Path: path, Symbol: symbolName, Err: err}
+		}
+		if err == nil {
+			return sym, symbolName, nil
+		}
+	}
+
+	return nil, "", pluginErrorf(path, strings.Join(symbolNames, ","), "None of the symbols %s could be found in %s", strings.Join(symbolNames, ", "), path)
+}
+
+// getEventSource creates the configured event source. The invoker is the one
+// created by getInvoker, which sources use to report the state of the pool.
+func getEventSource(invoker closableInvoker) (eventSource, error) {
+	// env: SOURCE_TYPE string plugin "Type of source: plugin, stdin, load-generator, pattern, replay, process, gcp-pubsub, postgres-notify, pulsar, kafka, azure-servicebus, http-poll, posix-mq or http."
+	switch sourceType := os.Getenv("SOURCE_TYPE"); sourceType {
+	case "", "plugin":
+		return getPluginEventSource()
+	case "stdin":
+		return stdinSource, nil
+	case "load-generator":
+		return newLoadGeneratorSource(
+			// env: LOAD_RATE_PER_SECOND float 0 "Rate at which the load-generator source produces inputs."
+			getFloatEnv("LOAD_RATE_PER_SECOND", 0),
+			// env: LOAD_DURATION_SECONDS int 0 "Duration for which the load-generator source runs; it runs until stopped when 0."
+			time.Duration(getIntEnv("LOAD_DURATION_SECONDS", 0))*time.Second,
+			// env: LOAD_PAYLOAD_BYTES int 64 "Size of the inputs produced by the load-generator source."
+			getIntEnv("LOAD_PAYLOAD_BYTES", 64),
+		)
+	case "pattern":
+		return newPatternSource(
+			// env: PATTERN_FILE string "" "File of input patterns read by the pattern source."
+			os.Getenv("PATTERN_FILE"),
+			// env: PATTERN_ORDER string sequence "Order in which the pattern source emits inputs: sequence or random."
+			getStringEnv("PATTERN_ORDER", patternOrderSequence),
+			getFloatEnv("LOAD_RATE_PER_SECOND", 0),
+			time.Duration(getIntEnv("LOAD_DURATION_SECONDS", 0))*time.Second,
+		)
+	case "replay":
+		return newReplaySource(
+			// env: REPLAY_STORE_PATH string replay-store.ndjson "File written by the replay-store sink and read by the replay source."
+			getStringEnv("REPLAY_STORE_PATH", defaultReplayStorePath),
+			// env: REPLAY_SPEED float 0 "Speed multiplier of the replay source; inputs are replayed as fast as possible when 0."
+			getFloatEnv("REPLAY_SPEED", 0),
+		), nil
+	case "process":
+		// env: SOURCE_PROCESS_COMMAND string "" "Command of the process whose output is read by the process source."
+		return newProcessSource(os.Getenv("SOURCE_PROCESS_COMMAND"))
+	case "gcp-pubsub":
+		tlsConfig, err := getHealthTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		return newPubSubSource(
+			// env: PUBSUB_MODE string pull "Delivery mode of the gcp-pubsub source: pull or push."
+			getStringEnv("PUBSUB_MODE", pubsubModePull),
+			// env: PUBSUB_PROJECT string "" "Google Cloud project of the gcp-pubsub source subscription."
+			os.Getenv("PUBSUB_PROJECT"),
+			// env: PUBSUB_SUBSCRIPTION string "" "Subscription from which the gcp-pubsub source receives messages."
+			os.Getenv("PUBSUB_SUBSCRIPTION"),
+			// env: PUBSUB_PUSH_ADDR string :8080 "Address on which the gcp-pubsub source serves its push endpoint."
+			getStringEnv("PUBSUB_PUSH_ADDR", ":8080"),
+			tlsConfig,
+		)
+	case "postgres-notify":
+		// env: POSTGRES_DSN string "" "Connection string of the PostgreSQL database of the postgres source and sink."
+		// env: POSTGRES_CHANNEL string "" "Channel on which the postgres-notify source listens."
+		return newPostgresNotifySource(os.Getenv("POSTGRES_DSN"), os.Getenv("POSTGRES_CHANNEL"))
+	case "kafka":
+		return newKafkaSource(
+			// env: KAFKA_BROKERS list "" "Comma-separated addresses of the Kafka brokers of the kafka source."
+			os.Getenv("KAFKA_BROKERS"),
+			// env: KAFKA_TOPIC string "" "Topic from which the kafka source reads records."
+			os.Getenv("KAFKA_TOPIC"),
+			// env: KAFKA_GROUP string "" "Consumer group of the kafka source when KAFKA_PARTITION_ASSIGNMENT is unset."
+			os.Getenv("KAFKA_GROUP"),
+			// env: KAFKA_PARTITION_ASSIGNMENT list "" "Comma-separated partitions of KAFKA_TOPIC that the kafka source reads directly, without joining a consumer group."
+			os.Getenv("KAFKA_PARTITION_ASSIGNMENT"),
+			// env: KAFKA_OFFSET_FILE string kafka-offsets.json "File in which the kafka source keeps the offsets of the partitions in KAFKA_PARTITION_ASSIGNMENT."
+			getStringEnv("KAFKA_OFFSET_FILE", "kafka-offsets.json"),
+		)
+	case "pulsar":
+		// env: PULSAR_URL string "" "Service URL of the Pulsar cluster of the pulsar source, such as pulsar://localhost:6650."
+		// env: PULSAR_TOPIC string "" "Topic from which the pulsar source receives messages."
+		// env: PULSAR_SUBSCRIPTION string "" "Shared subscription from which the pulsar source receives messages."
+		return newPulsarSource(os.Getenv("PULSAR_URL"), os.Getenv("PULSAR_TOPIC"), os.Getenv("PULSAR_SUBSCRIPTION"))
+	case "http-poll":
+		return newHTTPPollSource(
+			// env: POLL_URL string "" "URL requested by the http-poll source."
+			os.Getenv("POLL_URL"),
+			// env: POLL_INTERVAL_MILLIS int 60000 "Interval at which the http-poll source requests POLL_URL."
+			time.Duration(getIntEnv("POLL_INTERVAL_MILLIS", 60000))*time.Millisecond,
+			// env: POLL_RESULTS_JSONPATH string $ "JSON path of the array of events in the responses of the http-poll source."
+			getStringEnv("POLL_RESULTS_JSONPATH", "$"),
+		)
+	case "posix-mq":
+		return newPosixMQSource(
+			// env: MQ_NAME string "" "Name of the POSIX message queue read by the posix-mq source, such as /my-queue."
+			os.Getenv("MQ_NAME"),
+			// env: MQ_MSG_SIZE int 8192 "Maximum size of the messages of the queue created by the posix-mq source."
+			getIntEnv("MQ_MSG_SIZE", 8192),
+		)
+	case "azure-servicebus":
+		return newServiceBusSource(
+			// env: SERVICEBUS_CONNECTION_STRING string "" "Connection string of the Service Bus namespace of the azure-servicebus source."
+			os.Getenv("SERVICEBUS_CONNECTION_STRING"),
+			// env: SERVICEBUS_QUEUE string "" "Queue from which the azure-servicebus source receives messages; the EntityPath of the connection string is used when unset."
+			os.Getenv("SERVICEBUS_QUEUE"),
+			// env: SERVICEBUS_TOPIC string "" "Topic from which the azure-servicebus source receives messages, with SERVICEBUS_SUBSCRIPTION."
+			os.Getenv("SERVICEBUS_TOPIC"),
+			// env: SERVICEBUS_SUBSCRIPTION string "" "Subscription of SERVICEBUS_TOPIC from which the azure-servicebus source receives messages."
+			os.Getenv("SERVICEBUS_SUBSCRIPTION"),
+		)
+	case "http", "http-webhook":
+		tlsConfig, err := getHealthTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		auth, err := getWebhookAuthenticator()
+		if err != nil {
+			return nil, err
+		}
+		var responses *responseCache
+		// env: WEBHOOK_IDEMPOTENCY_HEADER string "" "Request header, such as Idempotency-Key, whose value identifies retries of an HTTP source request."
+		if header := os.Getenv("WEBHOOK_IDEMPOTENCY_HEADER"); header != "" {
+			// env: WEBHOOK_CACHE_TTL_SECONDS int 86400 "Time for which the HTTP source caches the response to a request with an idempotency key."
+			responses = newResponseCache(header,
+				time.Duration(getIntEnv("WEBHOOK_CACHE_TTL_SECONDS", 86400))*time.Second,
+				// env: WEBHOOK_CACHE_MAX_ENTRIES int 10000 "Maximum number of responses cached for idempotency keys; the oldest response is evicted beyond it. Unlimited when 0."
+				getIntEnv("WEBHOOK_CACHE_MAX_ENTRIES", 10000))
+		}
+		var callers *callerLimiter
+		// env: MAX_CONCURRENT_PER_CALLER int 0 "Maximum number of requests in flight per caller of the HTTP source; unlimited when 0."
+		if limit := getIntEnv("MAX_CONCURRENT_PER_CALLER", 0); limit > 0 {
+			// env: MAX_CALLERS int 10000 "Number of callers tracked by the per-caller limit of the HTTP source."
+			// env: CALLER_ID_HEADER string "" "Request header identifying the caller of the HTTP source for MAX_CONCURRENT_PER_CALLER; the remote IP is used when unset."
+			callers = newCallerLimiter(limit, getIntEnv("MAX_CALLERS", 10000), os.Getenv("CALLER_ID_HEADER"))
+		}
+		return newHTTPSource(
+			// env: HTTP_SOURCE_ADDR string :8080 "Address on which the HTTP source listens."
+			getStringEnv("HTTP_SOURCE_ADDR", ":8080"),
+			// env: DRAIN_NEW_CONNECTIONS bool true "Keep accepting connections on the HTTP source while draining at shutdown."
+			getBoolEnv("DRAIN_NEW_CONNECTIONS", true),
+			// env: SHUTDOWN_DRAIN_TIMEOUT_MILLIS int 30000 "Time the HTTP source and the pipeline wait for requests and invocations in flight at shutdown; invocations still running are then sent to the dead-letter sink with status 503 and cancelled."
+			time.Duration(getIntEnv("SHUTDOWN_DRAIN_TIMEOUT_MILLIS", 30000))*time.Millisecond,
+			// env: MAX_SOURCE_CONNECTIONS int 0 "Maximum number of concurrent connections to the HTTP source; unlimited when 0."
+			getIntEnv("MAX_SOURCE_CONNECTIONS", 0),
+			// env: WEBHOOK_MAX_BODY_BYTES int 1048576 "Maximum size of an HTTP source request body; larger requests receive a 413 response. Unlimited when 0."
+			int64(getIntEnv("WEBHOOK_MAX_BODY_BYTES", 1<<20)),
+			callers,
+			// env: WEBHOOK_CORS_ORIGINS list "" "Comma-separated origins, or *, from which browsers may call the HTTP source."
+			newCORSPolicy(os.Getenv("WEBHOOK_CORS_ORIGINS")),
+			auth,
+			responses,
+			invoker,
+			// env: READYZ_SATURATION_THRESHOLD float 1.0 "Fraction of invokers in use above which the readiness probe of the HTTP source fails."
+			getFloatEnv("READYZ_SATURATION_THRESHOLD", 1.0),
+			tlsConfig,
+		), nil
+	default:
+		return nil, configErrorf("SOURCE_TYPE", "Unknown SOURCE_TYPE %s", sourceType)
+	}
+}
+
+func getPluginEventSource() (source eventSource, err error) {
+	// env: SOURCE_PLUGIN_PATH string "" "Plugin containing the source when SOURCE_TYPE is plugin."
+	path := os.Getenv("SOURCE_PLUGIN_PATH")
+	if path == "" {
+		return nil, configErrorf("SOURCE_PLUGIN_PATH", "SOURCE_PLUGIN_PATH is a required environment variable")
+	}
+
+	symbolEnv := "SOURCE_PLUGIN_SYMBOL"
+	// env: SOURCE_PLUGIN_SYMBOLS list "" "Comma-separated candidate symbols of the source in SOURCE_PLUGIN_PATH; the first one found is used."
+	if os.Getenv("SOURCE_PLUGIN_SYMBOLS") != "" {
+		symbolEnv = "SOURCE_PLUGIN_SYMBOLS"
 	}
+	defer tracePluginLoad("load source plugin", "SOURCE_PLUGIN_PATH", symbolEnv)(&err)
 
-	symSource, err := p.Lookup(symbolName)
+	symbolList := os.Getenv("SOURCE_PLUGIN_SYMBOLS")
+	if symbolList == "" {
+		// env: SOURCE_PLUGIN_SYMBOL string "" "Symbol of the source in SOURCE_PLUGIN_PATH."
+		symbolList = os.Getenv("SOURCE_PLUGIN_SYMBOL")
+	}
+	if symbolList == "" {
+		return nil, configErrorf("SOURCE_PLUGIN_SYMBOL", "SOURCE_PLUGIN_SYMBOL or SOURCE_PLUGIN_SYMBOLS is a required environment variable")
+	}
+
+	symSource, symbolName, err := lookupFirstPluginSymbol(path, strings.Split(symbolList, ","))
 	if err != nil {
 		return nil, err
 	}
 
-	source, ok := symSource.(func(context.Context, fnrun.Invoker) error)
+	sourceFunc, ok := symSource.(func(context.Context, fnrun.Invoker) error)
 	if !ok {
-		return nil, fmt.Errorf("Symbol %s could not be found in %s", symbolName, path)
+		return nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
 	}
 
-	return source, nil
+	return sourceFunc, nil
 }
 
-func getEventSink() (eventSink, error) {
-	path := os.Getenv("SINK_PLUGIN_PATH")
-	if path == "" {
+// getEventSink loads the sinks listed in SINK_PLUGIN_PATH and
+// SINK_PLUGIN_SYMBOL and chains them together, or, when SINK_FANOUT_PARALLEL is
+// true, calls them all in parallel. SINK_DELIVERY_SEMANTICS (all, any or
+// quorum) sets how many of the parallel sinks must succeed. Both variables may
+// contain a comma-separated list; the Nth symbol is looked up in the Nth
+// plugin. When SINK_INDEPENDENT_ERRORS is true, the sinks are called in
+// parallel and each handles its own failures, and by default only one of them
+// must succeed. When SINK_RING is set, results are instead partitioned across
+// the sinks it names.
+func getEventSink() (sink eventSinkTransformer, err error) {
+	// env: SINK_TYPE string plugin "Type of sink: plugin, dry-run, replay-store, gcp-pubsub, postgres, arrow-ipc, nats or influxdb."
+	switch sinkType := os.Getenv("SINK_TYPE"); sinkType {
+	case "", "plugin":
+		// env: SINK_RING list "" "Comma-separated names of the sinks across which results are partitioned by a consistent hash ring, each optionally followed by :<weight>."
+		if ring := os.Getenv("SINK_RING"); ring != "" {
+			// env: SINK_PLUGIN_PATH list "" "Comma-separated plugins containing the sinks to which results are delivered."
+			if os.Getenv("SINK_PLUGIN_PATH") != "" {
+				return nil, configErrorf("SINK_RING", "SINK_RING and SINK_PLUGIN_PATH cannot both be provided")
+			}
+			return getSinkRing(ring)
+		}
+	case "dry-run", "replay-store", "gcp-pubsub", "postgres", "arrow-ipc", "nats", "influxdb":
+		return getBuiltinSink(sinkType)
+	default:
+		return nil, configErrorf("SINK_TYPE", "Unknown SINK_TYPE %s", sinkType)
+	}
+
+	pathList := os.Getenv("SINK_PLUGIN_PATH")
+	if pathList == "" {
 		return nil, nil
 	}
+	defer tracePluginLoad("load sink plugin", "SINK_PLUGIN_PATH", "SINK_PLUGIN_SYMBOL")(&err)
+
+	paths := strings.Split(pathList, ",")
+	// env: SINK_PLUGIN_SYMBOL list "" "Comma-separated symbols of the sinks in SINK_PLUGIN_PATH."
+	symbolList := os.Getenv("SINK_PLUGIN_SYMBOL")
+	if symbolList == "" && !allBuiltinSinks(paths) {
+		return nil, configErrorf("SINK_PLUGIN_SYMBOL", "SINK_PLUGIN_SYMBOL is required when a SINK_PLUGIN_PATH is provided")
+	}
+
+	// Built-in sinks have no symbol, so the symbol list may be omitted when
+	// every sink is built in.
+	symbolNames := strings.Split(symbolList, ",")
+	if symbolList == "" {
+		symbolNames = make([]string, len(paths))
+	}
+	if len(paths) != len(symbolNames) {
+		return nil, configErrorf("SINK_PLUGIN_SYMBOL", "SINK_PLUGIN_PATH and SINK_PLUGIN_SYMBOL must contain the same number of entries")
+	}
 
-	p, err := plugin.Open(path)
+	backoff, err := getSinkBackoff()
 	if err != nil {
 		return nil, err
 	}
 
-	symbolName := os.Getenv("SINK_PLUGIN_SYMBOL")
+	sinks := make([]eventSinkTransformer, len(paths))
+	for i := range paths {
+		sinks[i], err = loadEventSink(paths[i], symbolNames[i])
+		if err != nil {
+			return nil, err
+		}
+		sinks[i] = backoff.wrap(sinkName(paths[i], symbolNames[i]), sinks[i])
+	}
+
+	// env: SINK_INDEPENDENT_ERRORS bool false "Retry and dead-letter deliveries to each fanned-out sink separately."
+	if getBoolEnv("SINK_INDEPENDENT_ERRORS", false) {
+		for i := range sinks {
+			if sinks[i], err = getIndependentSink(i, sinks[i]); err != nil {
+				return nil, err
+			}
+		}
+		// env: SINK_DELIVERY_SEMANTICS string all "Number of fanned-out sinks that must succeed: all, any or quorum; the default is any with SINK_INDEPENDENT_ERRORS."
+		required, err := requiredSuccesses(getStringEnv("SINK_DELIVERY_SEMANTICS", deliverToAny), len(sinks))
+		if err != nil {
+			return nil, err
+		}
+		return fanoutSinks(sinks, required), nil
+	}
+
+	semantics := getStringEnv("SINK_DELIVERY_SEMANTICS", deliverToAll)
+	// env: SINK_FANOUT_PARALLEL bool false "Deliver each result to the fanned-out sinks in parallel."
+	if getBoolEnv("SINK_FANOUT_PARALLEL", false) {
+		required, err := requiredSuccesses(semantics, len(sinks))
+		if err != nil {
+			return nil, err
+		}
+		return fanoutSinks(sinks, required), nil
+	}
+	if semantics != deliverToAll {
+		return nil, configErrorf("SINK_DELIVERY_SEMANTICS", "SINK_DELIVERY_SEMANTICS %s requires SINK_FANOUT_PARALLEL", semantics)
+	}
+
+	return chainSinks(sinks), nil
+}
+
+// sinkName returns the name of the sink loaded from path and symbolName for
+// use in logs.
+func sinkName(path string, symbolName string) string {
+	if symbolName == "" {
+		return path
+	}
+	return path + ":" + symbolName
+}
+
+// getDeadLetterSink loads the sink named by DEAD_LETTER_PLUGIN_PATH and
+// DEAD_LETTER_PLUGIN_SYMBOL. The dead-letter sink receives results that could
+// not be handled by the normal pipeline.
+func getDeadLetterSink() (sink eventSinkTransformer, err error) {
+	// env: DEAD_LETTER_PLUGIN_PATH string "" "Plugin containing the sink that receives results whose delivery failed."
+	path := os.Getenv("DEAD_LETTER_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	defer tracePluginLoad("load dead-letter sink plugin", "DEAD_LETTER_PLUGIN_PATH", "DEAD_LETTER_PLUGIN_SYMBOL")(&err)
+
+	// env: DEAD_LETTER_PLUGIN_SYMBOL string "" "Symbol of the dead letter sink in DEAD_LETTER_PLUGIN_PATH."
+	symbolName := os.Getenv("DEAD_LETTER_PLUGIN_SYMBOL")
 	if symbolName == "" {
-		return nil, fmt.Errorf("SINK_PLUGIN_SYMBOL is required when a SINK_PLUGIN_PATH is provided")
+		return nil, configErrorf("DEAD_LETTER_PLUGIN_SYMBOL", "DEAD_LETTER_PLUGIN_SYMBOL is required when a DEAD_LETTER_PLUGIN_PATH is provided")
 	}
 
-	symSink, err := p.Lookup(symbolName)
+	return loadEventSink(path, symbolName)
+}
+
+// allBuiltinSinks reports whether every path names a built-in sink.
+func allBuiltinSinks(paths []string) bool {
+	for _, path := range paths {
+		if !strings.HasPrefix(path, builtinSinkPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadEventSink looks up a sink in a plugin, or returns the built-in sink if
+// path has the builtin: prefix. A symbol with the eventSinkTransformer
+// signature is preferred; a symbol with the eventSink signature is adapted to
+// pass its input result through unchanged.
+func loadEventSink(path string, symbolName string) (eventSinkTransformer, error) {
+	if strings.HasPrefix(path, builtinSinkPrefix) {
+		return getBuiltinSink(strings.TrimPrefix(path, builtinSinkPrefix))
+	}
+
+	symSink, err := lookupPluginSymbol(path, symbolName)
 	if err != nil {
 		return nil, err
 	}
 
-	sink, ok := symSink.(func(ctx context.Context, result *fnrun.Result) error)
-	if !ok {
-		return nil, fmt.Errorf("Symbol %s could not be found in %s", symbolName, path)
+	switch sink := symSink.(type) {
+	case func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error):
+		return sink, nil
+	case func(ctx context.Context, result *fnrun.Result) error:
+		return asTransformer(sink), nil
+	default:
+		return nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
 	}
+}
 
-	return sink, nil
+// asTransformer adapts an eventSink into an eventSinkTransformer that returns
+// its input result.
+func asTransformer(sink eventSink) eventSinkTransformer {
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		return result, sink(ctx, result)
+	}
 }
 
-func getInvoker() (fnrun.Invoker, error) {
-	cmd, err := executil.ParseCmd(os.Getenv("FUNCTION_COMMAND"))
+// chainSinks returns a sink that passes the result through each of the sinks in
+// order, providing the output of one sink as the input to the next. The chain
+// stops at the first sink that returns an error or a nil result.
+func chainSinks(sinks []eventSinkTransformer) eventSinkTransformer {
+	if len(sinks) == 1 {
+		return sinks[0]
+	}
+
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		for _, sink := range sinks {
+			var err error
+			result, err = sink(ctx, result)
+			if err != nil || result == nil {
+				return result, err
+			}
+		}
+		return result, nil
+	}
+}
+
+// suffixedEnvName returns name with the provided suffix appended if the
+// suffixed variable is set, or name otherwise. This allows settings to be
+// overridden for a single invoker pool (e.g., MAX_FUNCTION_COUNT_B).
+func suffixedEnvName(name string, suffix string) string {
+	if suffix != "" && os.Getenv(name+"_"+suffix) != "" {
+		return name + "_" + suffix
+	}
+	return name
+}
+
+// getFunctionCommand returns the function command from FUNCTION_COMMAND or, if
+// that is unset, from the file named by FUNCTION_COMMAND_FILE.
+func getFunctionCommand(suffix string) (string, error) {
+	// env: FUNCTION_COMMAND string "" "Command of the function process. Suffixable."
+	if cmdStr := os.Getenv(suffixedEnvName("FUNCTION_COMMAND", suffix)); cmdStr != "" {
+		return cmdStr, nil
+	}
+
+	// env: FUNCTION_COMMAND_FILE string "" "File containing the function command, used when FUNCTION_COMMAND is unset. Suffixable."
+	fileEnvName := suffixedEnvName("FUNCTION_COMMAND_FILE", suffix)
+	path := os.Getenv(fileEnvName)
+	if path == "" {
+		return "", nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return "", configErrorf(fileEnvName, "could not read %s: %v", fileEnvName, err)
 	}
-	cmd.Env = os.Environ()
 
-	maxFuncCount := 8
-	maxFuncCountStr := os.Getenv("MAX_FUNCTION_COUNT")
-	if maxFuncCountStr != "" {
-		i, err := strconv.Atoi(maxFuncCountStr)
-		if err == nil {
-			maxFuncCount = i
+	return strings.TrimSpace(string(contents)), nil
+}
+
+func getInvokerFactory(suffix string) (fnrun.InvokerFactory, error) {
+	// env: INVOKER_TYPE string cmd "Type of invoker: cmd, plugin, noop or echo. Suffixable."
+	switch invokerType := os.Getenv(suffixedEnvName("INVOKER_TYPE", suffix)); invokerType {
+	case "", "cmd":
+		cmdStr, err := getFunctionCommand(suffix)
+		if err != nil {
+			return nil, err
 		}
+		return newFunctionCmdFactory(cmdStr)
+	case "plugin":
+		return getPluginInvokerFactory(suffix)
+	case "noop":
+		return &staticInvokerFactory{invoker: noopInvoker{}}, nil
+	case "echo":
+		return &staticInvokerFactory{invoker: echoInvoker{}}, nil
+	default:
+		return nil, configErrorf(suffixedEnvName("INVOKER_TYPE", suffix), "Unknown INVOKER_TYPE %s", invokerType)
 	}
+}
 
-	maxWaitMillis := 500
-	maxWaitMillisStr := os.Getenv("MAX_WAIT_MILLIS")
-	if maxWaitMillisStr != "" {
-		i, err := strconv.Atoi(maxWaitMillisStr)
-		if err == nil {
-			maxWaitMillis = i
+// newFunctionCmdFactory creates a factory for invokers that run cmdStr with the
+// function environment and resource limits.
+func newFunctionCmdFactory(cmdStr string) (fnrun.InvokerFactory, error) {
+	cmd, err := executil.ParseCmd(cmdStr)
+	if err != nil {
+		return nil, err
+	}
+	env, err := getFunctionEnv()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = env
+	// env: SHARED_MEMORY_PATH string "" "Path of a shared memory region created for function processes."
+	if path := os.Getenv("SHARED_MEMORY_PATH"); path != "" {
+		cmd.Env = append(cmd.Env, sharedMemoryEnvName+"="+path)
+	}
+
+	affinity, err := getCPUAffinity()
+	if err != nil {
+		return nil, err
+	}
+
+	if limits := getRlimits(); !limits.isEmpty() || affinity != nil {
+		if !rlimitsSupported {
+			return nil, errRlimitsUnsupported
+		}
+		if err := wrapCmdWithRlimits(cmd, limits); err != nil {
+			return nil, err
 		}
 	}
 
-	maxExecMillis := 30000
-	maxExecMillisStr := os.Getenv("MAX_EXEC_MILLIS")
-	if maxExecMillisStr != "" {
-		i, err := strconv.Atoi(maxExecMillisStr)
-		if err == nil {
-			maxExecMillis = i
+	if err := applyUserNamespace(cmd); err != nil {
+		return nil, err
+	}
+
+	// env: SIGKILL_AFTER_MILLIS int 5000 "Time after which a function process that ignored SIGTERM is killed."
+	killAfter := time.Duration(getIntEnv("SIGKILL_AFTER_MILLIS", 5000)) * time.Millisecond
+	return newCmdInvokerFactory(cmd, killAfter, affinity), nil
+}
+
+// getPluginInvokerFactory loads the invoker factory named by
+// INVOKER_PLUGIN_PATH and INVOKER_PLUGIN_SYMBOL. The symbol may be a variable
+// of type fnrun.InvokerFactory or a function that returns one.
+func getPluginInvokerFactory(suffix string) (factory fnrun.InvokerFactory, err error) {
+	// env: INVOKER_PLUGIN_PATH string "" "Plugin containing the invoker factory when INVOKER_TYPE is plugin. Suffixable."
+	pathEnv := suffixedEnvName("INVOKER_PLUGIN_PATH", suffix)
+	// env: INVOKER_PLUGIN_SYMBOL string "" "Symbol of the invoker factory in INVOKER_PLUGIN_PATH. Suffixable."
+	symbolEnv := suffixedEnvName("INVOKER_PLUGIN_SYMBOL", suffix)
+
+	path := os.Getenv(pathEnv)
+	if path == "" {
+		return nil, configErrorf(pathEnv, "%s is required when INVOKER_TYPE is plugin", pathEnv)
+	}
+	defer tracePluginLoad("load invoker plugin", pathEnv, symbolEnv)(&err)
+
+	symbolName := os.Getenv(symbolEnv)
+	if symbolName == "" {
+		return nil, configErrorf(symbolEnv, "%s is required when INVOKER_TYPE is plugin", symbolEnv)
+	}
+
+	symFactory, err := lookupPluginSymbol(path, symbolName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch sym := symFactory.(type) {
+	case *fnrun.InvokerFactory:
+		factory = *sym
+	case func() (fnrun.InvokerFactory, error):
+		if factory, err = sym(); err != nil {
+			return nil, &runner.PluginLoadError{Path: path, Symbol: symbolName, Err: err}
 		}
 	}
+	if factory == nil {
+		return nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
+	}
+
+	return &streamingInvokerFactory{factory: factory}, nil
+}
+
+// getInvokerPool creates an invoker pool. Each setting may be overridden for
+// this pool by an environment variable with suffix appended.
+func getInvokerPool(suffix string) (*invokerPool, error) {
+	factory, err := getInvokerFactory(suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	return newInvokerPool(factory, suffix)
+}
+
+// newInvokerPool creates an invoker pool that uses factory. The pool settings
+// may be overridden by environment variables with suffix appended.
+func newInvokerPool(factory fnrun.InvokerFactory, suffix string) (*invokerPool, error) {
+	// env: MAX_FUNCTION_COUNT int 8 "Maximum number of function processes in the invoker pool. Suffixable."
+	return newSizedInvokerPool(factory, suffix, getIntEnv(suffixedEnvName("MAX_FUNCTION_COUNT", suffix), 8))
+}
+
+// newSizedInvokerPool creates an invoker pool of maxFuncCount invokers that
+// uses factory. The other settings are read as for newInvokerPool.
+func newSizedInvokerPool(factory fnrun.InvokerFactory, suffix string, maxFuncCount int) (*invokerPool, error) {
+	// env: MAX_WAIT_MILLIS int 500 "Maximum time an input waits for an available invoker. Suffixable."
+	maxWaitMillis := getIntEnv(suffixedEnvName("MAX_WAIT_MILLIS", suffix), 500)
+	// env: MAX_EXEC_MILLIS int 30000 "Maximum time an invocation may run. Suffixable."
+	maxExecMillis := getIntEnv(suffixedEnvName("MAX_EXEC_MILLIS", suffix), 30000)
+	// env: WAIT_JITTER_MILLIS int 50 "Maximum random jitter added to the wait for an invoker. Suffixable."
+	waitJitterMillis := getIntEnv(suffixedEnvName("WAIT_JITTER_MILLIS", suffix), 50)
+	// env: POOL_CLOSE_TIMEOUT_MILLIS int 5000 "Time to wait for invokers to finish when the pool is closed. Suffixable."
+	closeTimeoutMillis := getIntEnv(suffixedEnvName("POOL_CLOSE_TIMEOUT_MILLIS", suffix), 5000)
+	// env: QUEUE_EVENT_TTL_MILLIS int 0 "Time after which an input waiting for an invoker is dropped; kept until MAX_WAIT_MILLIS when 0. Suffixable."
+	eventTTLMillis := getIntEnv(suffixedEnvName("QUEUE_EVENT_TTL_MILLIS", suffix), 0)
+
+	maxWait := time.Duration(maxWaitMillis) * time.Millisecond
+	jitter := time.Duration(waitJitterMillis) * time.Millisecond
+
+	// env: PRIORITY_METADATA_KEY string "" "Metadata key marking high-priority inputs, which may use oversubscribed invokers."
+	priorityKey := os.Getenv("PRIORITY_METADATA_KEY")
+	oversubscription := 0
+	if priorityKey != "" {
+		// env: PRIORITY_OVERSUBSCRIPTION int 2 "Number of invokers beyond MAX_FUNCTION_COUNT reserved for high-priority inputs. Suffixable."
+		oversubscription = getIntEnv(suffixedEnvName("PRIORITY_OVERSUBSCRIPTION", suffix), 2)
+	}
 
 	config := fnrun.InvokerPoolConfig{
-		MaxInvokerCount: maxFuncCount,
-		InvokerFactory:  fnrun.NewCmdInvokerFactory(cmd),
-		MaxWaitDuration: time.Duration(maxWaitMillis) * time.Millisecond,
+		MaxInvokerCount: maxFuncCount + oversubscription,
+		InvokerFactory:  factory,
+		MaxWaitDuration: maxWait + jitter,
 		MaxRunnableTime: time.Duration(maxExecMillis) * time.Millisecond,
 	}
 	pool, err := fnrun.NewInvokerPool(config)
@@ -155,30 +943,451 @@ func getInvoker() (fnrun.Invoker, error) {
 		return nil, err
 	}
 
-	return pool, nil
+	return &invokerPool{
+		pool:          pool,
+		config:        config,
+		factory:       factory,
+		slots:         make(chan struct{}, maxFuncCount),
+		priorityKey:   priorityKey,
+		prioritySlots: make(chan struct{}, oversubscription),
+		maxWait:       maxWait,
+		jitter:        jitter,
+		eventTTL:      time.Duration(eventTTLMillis) * time.Millisecond,
+		closeTimeout:  time.Duration(closeTimeoutMillis) * time.Millisecond,
+		inFlight:      &sync.WaitGroup{},
+	}, nil
+}
+
+// getInvoker creates the invoker that handles function invocations. When
+// TENANT_KEY is set, a pool is created for each tenant. When
+// FUNCTION_VERSION_MANIFEST is set, a pool is created for each version in the
+// manifest. When STICKY_ROUTING is true, identical inputs are sent to the same
+// invoker. When FUNCTION_COMMAND_B or INVOKER_TYPE_B is set, two pools are
+// created and traffic is split between them according to TRAFFIC_WEIGHT_B, or
+// every input is sent to both if CANARY_ANALYSIS_PLUGIN_PATH is set.
+func getInvoker() (closableInvoker, error) {
+	// env: TENANT_KEY string "" "Metadata key identifying the tenant of an input; each tenant gets its own pool when set."
+	if tenantKey := os.Getenv("TENANT_KEY"); tenantKey != "" {
+		// env: MAX_POOLS int 10 "Maximum number of tenant pools when TENANT_KEY is set."
+		return newTenantRouter(tenantKey, getIntEnv("MAX_POOLS", 10)), nil
+	}
+
+	// env: FUNCTION_VERSION_MANIFEST string "" "File describing function versions and the traffic routed to each."
+	if path := os.Getenv("FUNCTION_VERSION_MANIFEST"); path != "" {
+		return newVersionRouter(path)
+	}
+
+	// env: STICKY_ROUTING bool false "Route identical inputs to the same invoker."
+	if getBoolEnv("STICKY_ROUTING", false) {
+		return newStickyRouter(getIntEnv("MAX_FUNCTION_COUNT", 8))
+	}
+
+	if os.Getenv("FUNCTION_COMMAND_B") == "" && os.Getenv("INVOKER_TYPE_B") == "" {
+		return getInvokerPool("")
+	}
+
+	analyzer, err := getCanaryAnalyzer()
+	if err != nil {
+		return nil, err
+	}
+
+	poolA, err := getInvokerPool("A")
+	if err != nil {
+		return nil, err
+	}
+
+	poolB, err := getInvokerPool("B")
+	if err != nil {
+		poolA.Close()
+		return nil, err
+	}
+
+	if analyzer != nil {
+		return newCanaryRouter(poolA, poolB, analyzer), nil
+	}
+	// env: TRAFFIC_WEIGHT_B int 0 "Percentage of inputs routed to the B pool when FUNCTION_COMMAND_B or INVOKER_TYPE_B is set."
+	return newWeightedRouter(poolA, poolB, getIntEnv("TRAFFIC_WEIGHT_B", 0)), nil
 }
 
 func main() {
-	if err := run(); err != nil {
+	if len(os.Args) > 2 && os.Args[1] == rlimitExecArg {
+		if err := runRlimitTrampoline(os.Args[2:]); err != nil {
+			panic(err)
+		}
+	}
+
+	replayPath := flag.String("replay", "", "replay the inputs in the given newline-delimited JSON log and exit")
+	replaySpeed := flag.Float64("replay-speed", 0, "speed multiplier for --replay; 0 replays as fast as possible")
+	kubeMetrics := flag.Bool("kube-metrics", false, "serve the Kubernetes custom metrics API on KUBE_METRICS_ADDR")
+	pipelinePath := flag.String("pipeline", "", "run the multi-stage pipeline defined in the given YAML file")
+	printConfigVars := flag.Bool("print-config", false, "print the supported environment variables and exit")
+	output := flag.String("output", configOutputText, "output format of --print-config: text or json")
+	flag.Parse()
+
+	if *printConfigVars {
+		if err := printConfig(os.Stdout, *output); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// Resolving secrets, discovering plugins and mutating the configuration
+	// reach out to files, metadata endpoints and plugins, so they are done only
+	// once the flags show that the runner will run.
+	if err := resolveSecretReferences(); err != nil {
+		panic(err)
+	}
+
+	if err := discoverPlugins(); err != nil {
+		panic(err)
+	}
+
+	if err := applyConfigMutator(); err != nil {
+		panic(err)
+	}
+
+	if *pipelinePath != "" {
+		if err := runPipelineFile(*pipelinePath); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if *replayPath != "" {
+		if err := runReplay(*replayPath, *replaySpeed); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if err := run(*kubeMetrics); err != nil {
 		panic(err)
 	}
 }
 
-func run() error {
+// startupJitter returns a random duration in [0, max], which is used to delay
+// the start of the source so that runner instances started at the same time do
+// not all connect to it at once.
+func startupJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	n, err := cryptorand.Int(cryptorand.Reader, big.NewInt(int64(max)+1))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(n.Int64())
+}
+
+func run(kubeMetrics bool) error {
+	shutdownTracing, err := setupTracing()
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	// Sinks may use shared database pools until the pipeline has drained.
+	defer db.CloseAll()
+
+	// Messages buffered by NATS sinks are flushed once the pipeline has
+	// drained.
+	defer closeNATSConns()
+
+	// The shared memory region must exist before function processes start.
+	if path := os.Getenv("SHARED_MEMORY_PATH"); path != "" {
+		// env: SHARED_MEMORY_SIZE_BYTES int 67108864 "Size of the shared memory region."
+		sharedMem, err := createSharedMemory(path, getIntEnv("SHARED_MEMORY_SIZE_BYTES", 64*1024*1024))
+		if err != nil {
+			return err
+		}
+		defer sharedMem.Close()
+	}
+
 	invoker, err := getInvoker()
 	if err != nil {
 		return err
 	}
+	defer invoker.Close()
 
-	eventSource, err := getEventSource()
+	if kubeMetrics {
+		server := &http.Server{
+			// env: KUBE_METRICS_ADDR string :8443 "Address on which the Kubernetes custom metrics API is served with --kube-metrics."
+			Addr:    getStringEnv("KUBE_METRICS_ADDR", ":8443"),
+			Handler: newKubeMetricsHandler(invoker),
+		}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("kube metrics server failed: %v", err)
+			}
+		}()
+		defer server.Close()
+	}
+
+	// env: METRICS_ADDR string "" "Address on which the metrics and health endpoints are served."
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		tlsConfig, err := getHealthTLSConfig()
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", serveMetrics)
+		server := &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			if err := listenAndServe(server, tlsConfig); err != nil && err != http.ErrServerClosed {
+				log.Printf("metrics server failed: %v", err)
+			}
+		}()
+		defer server.Close()
+	}
+
+	if err := runSelfTest(context.Background(), invoker); err != nil {
+		return err
+	}
+
+	eventSource, err := getEventSource(invoker)
 	if err != nil {
 		return err
 	}
 
+	// env: SOURCE_HEARTBEAT_TIMEOUT_MILLIS int 0 "Time without a source heartbeat after which a warning is logged; disabled when 0."
+	heartbeatTimeout := time.Duration(getIntEnv("SOURCE_HEARTBEAT_TIMEOUT_MILLIS", 0)) * time.Millisecond
+	// env: SOURCE_HEARTBEAT_KILL_TIMEOUT_MILLIS int 0 "Time without a source heartbeat after which the source is cancelled; disabled when 0."
+	heartbeatKillTimeout := time.Duration(getIntEnv("SOURCE_HEARTBEAT_KILL_TIMEOUT_MILLIS", 0)) * time.Millisecond
+	// env: SOURCE_RESTART_ON_ERROR bool false "Restart the source when it returns an error."
+	restartOnError := getBoolEnv("SOURCE_RESTART_ON_ERROR", false)
+	if heartbeatTimeout > 0 || heartbeatKillTimeout > 0 || restartOnError {
+		eventSource = newSourceSupervisor(
+			eventSource,
+			heartbeatTimeout,
+			heartbeatKillTimeout,
+			restartOnError,
+			// env: SOURCE_RESTART_DELAY_MILLIS int 1000 "Delay before a failed or stalled source is restarted."
+			time.Duration(getIntEnv("SOURCE_RESTART_DELAY_MILLIS", 1000))*time.Millisecond,
+		)
+	}
+
+	// env: SOURCE_CONCURRENCY int 1 "Number of instances of the source run concurrently."
+	if concurrency := getIntEnv("SOURCE_CONCURRENCY", 1); concurrency > 1 {
+		eventSource = newConcurrentSource(eventSource, concurrency)
+	}
+
+	// env: LEADER_ELECTION bool false "Run the source only on the runner instance that holds the leader lease."
+	if getBoolEnv("LEADER_ELECTION", false) {
+		backend, err := getLeaseBackend()
+		if err != nil {
+			return err
+		}
+		eventSource = newLeaderElectedSource(
+			eventSource,
+			backend,
+			getLeaderElectionID(),
+			// env: LEADER_ELECTION_LEASE_MILLIS int 15000 "Duration of the leader lease."
+			time.Duration(getIntEnv("LEADER_ELECTION_LEASE_MILLIS", 15000))*time.Millisecond,
+			// env: LEADER_ELECTION_RENEW_MILLIS int 5000 "Interval at which the leader renews its lease."
+			time.Duration(getIntEnv("LEADER_ELECTION_RENEW_MILLIS", 5000))*time.Millisecond,
+		)
+	}
+
 	eventSink, err := getEventSink()
 	if err != nil {
 		return err
 	}
+	// env: CHAINED_RUNNER_URL string "" "URL of a downstream runner's HTTP source to which each result is forwarded."
+	if url := os.Getenv("CHAINED_RUNNER_URL"); url != "" {
+		// env: CHAINED_RUNNER_TIMEOUT_MILLIS int 30000 "Timeout of a request to CHAINED_RUNNER_URL."
+		forward := newChainedRunnerSink(url, time.Duration(getIntEnv("CHAINED_RUNNER_TIMEOUT_MILLIS", 30000))*time.Millisecond)
+		if eventSink != nil {
+			forward = chainSinks([]eventSinkTransformer{eventSink, forward})
+		}
+		eventSink = forward
+	}
+
+	drainTimeoutMillis := getIntEnv("SHUTDOWN_DRAIN_TIMEOUT_MILLIS", 30000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// env: MEMORY_SAMPLE_INTERVAL_MILLIS int 0 "Interval at which the memory of function processes is sampled; disabled when 0."
+	if interval := getIntEnv("MEMORY_SAMPLE_INTERVAL_MILLIS", 0); interval > 0 {
+		// env: MEMORY_LIMIT_BYTES uint 0 "Resident memory above which a function process is recycled."
+		limit := int64(getUint64Env("MEMORY_LIMIT_BYTES"))
+		go sampleMemory(ctx, invoker, time.Duration(interval)*time.Millisecond, limit)
+	}
+
+	// env: IDLE_INVOKER_TIMEOUT_MILLIS int 0 "Time after which an idle invoker is stopped; idle invokers are kept when 0."
+	if timeout := getIntEnv("IDLE_INVOKER_TIMEOUT_MILLIS", 0); timeout > 0 {
+		// env: IDLE_CHECK_INTERVAL_MILLIS int 5000 "Interval at which idle invokers are looked for."
+		interval := time.Duration(getIntEnv("IDLE_CHECK_INTERVAL_MILLIS", 5000)) * time.Millisecond
+		// env: MIN_FUNCTION_COUNT int 1 "Number of function processes kept when idle invokers are stopped."
+		go reapIdleInvokers(ctx, invoker, interval, time.Duration(timeout)*time.Millisecond, getIntEnv("MIN_FUNCTION_COUNT", 1))
+	}
+
+	// env: WARMUP_SCHEDULE string "" "Cron expression of the times at which invokers are warmed up."
+	if expr := os.Getenv("WARMUP_SCHEDULE"); expr != "" {
+		schedule, err := parseCronSchedule(expr)
+		if err != nil {
+			return &runner.ConfigError{Name: "WARMUP_SCHEDULE", Err: err}
+		}
+		// env: WARMUP_INVOKER_COUNT int MAX_FUNCTION_COUNT "Number of invokers warmed up on each WARMUP_SCHEDULE run."
+		go runWarmups(ctx, invoker, schedule, getIntEnv("WARMUP_INVOKER_COUNT", getIntEnv("MAX_FUNCTION_COUNT", 8)))
+	}
+
+	// env: WATCH_FUNCTION_BINARY bool false "Reload the invoker pool when the executable of FUNCTION_COMMAND changes."
+	if getBoolEnv("WATCH_FUNCTION_BINARY", false) {
+		pool, ok := invoker.(*invokerPool)
+		if !ok {
+			return configErrorf("WATCH_FUNCTION_BINARY", "WATCH_FUNCTION_BINARY is not supported when more than one invoker pool is configured")
+		}
+		path, err := getFunctionBinaryPath()
+		if err != nil {
+			return err
+		}
+		// env: WATCH_FUNCTION_BINARY_INTERVAL_MILLIS int 1000 "Interval at which the function binary is checked for changes."
+		intervalMillis := getIntEnv("WATCH_FUNCTION_BINARY_INTERVAL_MILLIS", 1000)
+		if intervalMillis <= 0 {
+			return configErrorf("WATCH_FUNCTION_BINARY_INTERVAL_MILLIS", "WATCH_FUNCTION_BINARY_INTERVAL_MILLIS must be greater than zero")
+		}
+		go watchFunctionBinary(ctx, pool, path, time.Duration(intervalMillis)*time.Millisecond)
+	}
+
+	configServer, err := getConfigBackend()
+	if err != nil {
+		return err
+	}
+	if configServer != nil {
+		pool, ok := invoker.(*invokerPool)
+		if !ok {
+			return configErrorf("CONFIG_SERVER", "CONFIG_SERVER is not supported when more than one invoker pool is configured")
+		}
+		// env: CONFIG_SERVER_POLL_INTERVAL_MILLIS int 5000 "Interval at which the configuration server is polled."
+		interval := time.Duration(getIntEnv("CONFIG_SERVER_POLL_INTERVAL_MILLIS", 5000)) * time.Millisecond
+		go watchConfigServer(ctx, configServer, pool, interval)
+	}
+
+	checkpointStore, err := getCheckpointStore()
+	if err != nil {
+		return err
+	}
+
+	if checkpointStore != nil {
+		// env: CHECKPOINT_INTERVAL_MILLIS int 5000 "Interval at which source checkpoints are saved."
+		checkpointMillis := getIntEnv("CHECKPOINT_INTERVAL_MILLIS", 5000)
+		if checkpointMillis <= 0 {
+			return configErrorf("CHECKPOINT_INTERVAL_MILLIS", "CHECKPOINT_INTERVAL_MILLIS must be greater than zero")
+		}
+
+		data, err := checkpointStore.Load(ctx)
+		if err != nil {
+			return err
+		}
+
+		checkpoint := runner.NewCheckpoint(data)
+		ctx = runner.WithCheckpoint(ctx, checkpoint)
+
+		checkpointer := newCheckpointer(checkpointStore, checkpoint, time.Duration(checkpointMillis)*time.Millisecond)
+		go checkpointer.run()
+		defer checkpointer.stop()
+	}
+
+	pipeline, pipelineCloser, err := getPipeline(invoker, eventSink)
+	if err != nil {
+		return err
+	}
+	defer pipelineCloser.Close()
+	pipeline = &statsInvoker{invoker: pipeline, stats: stats}
+
+	deadLetterSink, err := getDeadLetterSink()
+	if err != nil {
+		return err
+	}
+
+	// env: DISK_QUEUE_DIR string "" "Directory of a disk-backed queue that buffers inputs before invocation."
+	if dir := os.Getenv("DISK_QUEUE_DIR"); dir != "" {
+		// env: DISK_QUEUE_MAX_BYTES int 1073741824 "Maximum size of the inputs in the disk-backed queue that have not been processed yet."
+		maxBytes := int64(getIntEnv("DISK_QUEUE_MAX_BYTES", 1<<30))
+		// env: DISK_QUEUE_MAX_ATTEMPTS int 10 "Number of times a queued input is invoked before it is sent to the dead-letter sink."
+		queue, err := openDiskQueue(pipeline, dir, maxBytes, getIntEnv("DISK_QUEUE_MAX_ATTEMPTS", 10), deadLetterSink)
+		if err != nil {
+			return err
+		}
+		defer queue.close()
+
+		queue.start()
+		if err := queue.waitReplayed(ctx); err != nil {
+			return err
+		}
+		pipeline = queue
+	}
+
+	// env: INFLIGHT_LOG_PATH string "" "Path of the write-ahead log of invocations in flight, which are replayed after a crash."
+	if path := os.Getenv("INFLIGHT_LOG_PATH"); path != "" {
+		inflight, err := openInflightLog(pipeline, path)
+		if err != nil {
+			return err
+		}
+		defer inflight.close()
+
+		inflight.replay(ctx)
+		pipeline = inflight
+	}
+
+	// env: STARTUP_JITTER_MILLIS int 0 "Maximum random delay before the source starts."
+	if jitter := startupJitter(time.Duration(getIntEnv("STARTUP_JITTER_MILLIS", 0)) * time.Millisecond); jitter > 0 {
+		log.Printf("delaying startup by %v", jitter)
+		select {
+		case <-time.After(jitter):
+		case <-ctx.Done():
+		}
+	}
+
+	// env: GLOBAL_RATE_LIMIT_PER_SECOND float 0 "Maximum rate of invocations; unlimited when 0."
+	if limit := getFloatEnv("GLOBAL_RATE_LIMIT_PER_SECOND", 0); limit > 0 {
+		// env: GLOBAL_RATE_LIMIT_BURST int 1 "Number of invocations allowed in a burst above GLOBAL_RATE_LIMIT_PER_SECOND."
+		pipeline = newRateLimitedInvoker(pipeline, limit, getIntEnv("GLOBAL_RATE_LIMIT_BURST", 1))
+	}
+
+	drainer := newDrainInvoker(pipeline, deadLetterSink)
+	var sourceInvoker fnrun.Invoker = drainer
+
+	// env: ADMIN_ADDR string "" "Address on which the admin endpoints for pausing and resuming event processing are served."
+	if addr := os.Getenv("ADMIN_ADDR"); addr != "" {
+		// env: ADMIN_TOKEN string "" "Bearer token required by the admin endpoints; required with ADMIN_ADDR."
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			return configErrorf("ADMIN_TOKEN", "ADMIN_TOKEN is required when ADMIN_ADDR is provided")
+		}
+		pause := &pauseInvoker{invoker: drainer}
+		server := &http.Server{Addr: addr, Handler: newAdminHandler(token, pause)}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("admin server failed: %v", err)
+			}
+		}()
+		defer server.Close()
+		sourceInvoker = pause
+	}
+
+	sourceErr := eventSource(ctx, sourceInvoker)
+
+	abandoned := drainer.drain(time.Duration(drainTimeoutMillis) * time.Millisecond)
+	if abandoned > 0 {
+		log.Printf("shutdown drain timed out; abandoned %d in-flight invocation(s)", abandoned)
+	}
+	if sourceErr == nil {
+		stats.logSummary()
+	}
 
-	return eventSource(context.Background(), &sinkInvoker{invoker: invoker, sink: eventSink})
+	return sourceErr
 }
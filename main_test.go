@@ -0,0 +1,771 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/executil"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// invokerFunc adapts a function to fnrun.Invoker for tests.
+type invokerFunc func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error)
+
+func (f invokerFunc) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	return f(ctx, input)
+}
+
+func TestChainedSinkTransformersModifyResultInOrder(t *testing.T) {
+	appending := func(suffix string) eventSinkTransformer {
+		return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			return &fnrun.Result{Status: result.Status, Data: append(append([]byte(nil), result.Data...), suffix...)}, nil
+		}
+	}
+	si := &sinkInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return &fnrun.Result{Status: 200, Data: input.Data}, nil
+		}),
+		sink: chainSinks([]eventSinkTransformer{appending("-a"), appending("-b")}),
+	}
+
+	result, err := si.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(result.Data) != "x-a-b" {
+		t.Errorf("expected x-a-b, got %q", result.Data)
+	}
+}
+
+func TestChainedSinksStopAtFirstError(t *testing.T) {
+	var called bool
+	sink := chainSinks([]eventSinkTransformer{
+		func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			return result, errors.New("failed")
+		},
+		func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			called = true
+			return result, nil
+		},
+	})
+
+	if _, err := sink(context.Background(), &fnrun.Result{}); err == nil {
+		t.Error("expected the error of the first sink")
+	}
+	if called {
+		t.Error("expected the second sink not to be called")
+	}
+}
+
+func TestGetEventSourceConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.so")
+	t.Setenv("SOURCE_TYPE", "plugin")
+	t.Setenv("SOURCE_PLUGIN_PATH", path)
+	t.Setenv("SOURCE_PLUGIN_SYMBOL", "Source")
+	t.Setenv("PLUGIN_ABI_CHECK", "false")
+	defer func() {
+		pluginsMu.Lock()
+		delete(plugins, path)
+		pluginsMu.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := getEventSource(nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		var loadErr *runner.PluginLoadError
+		if !errors.As(err, &loadErr) || loadErr.Path != path {
+			t.Errorf("expected a PluginLoadError for %s, got %v", path, err)
+		}
+	}
+
+	pluginsMu.RLock()
+	_, ok := plugins[path]
+	pluginsMu.RUnlock()
+	if !ok {
+		t.Error("expected the plugin to be recorded once")
+	}
+}
+
+func TestInvokeAsyncCallsBackOnceWithResult(t *testing.T) {
+	si := &sinkInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 200, Data: input.Data}, nil
+	})}
+
+	type outcome struct {
+		result *fnrun.Result
+		err    error
+	}
+	outcomes := make(chan outcome, 2)
+	si.InvokeAsync(context.Background(), &fnrun.Input{Data: []byte("hello")}, func(result *fnrun.Result, err error) {
+		outcomes <- outcome{result, err}
+	})
+
+	select {
+	case o := <-outcomes:
+		if o.err != nil || o.result == nil || string(o.result.Data) != "hello" {
+			t.Errorf("unexpected outcome: %v, %v", o.result, o.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback was not called")
+	}
+
+	select {
+	case o := <-outcomes:
+		t.Errorf("callback was called again with %v, %v", o.result, o.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestInvokeAsyncPropagatesCancellation(t *testing.T) {
+	invocationCancelled := make(chan struct{})
+	si := &sinkInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		<-ctx.Done()
+		close(invocationCancelled)
+		return nil, ctx.Err()
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	si.InvokeAsync(ctx, &fnrun.Input{}, func(result *fnrun.Result, err error) {
+		errs <- err
+	})
+	cancel()
+
+	select {
+	case err := <-errs:
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback was not called after cancellation")
+	}
+
+	select {
+	case <-invocationCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the invocation did not observe the cancellation")
+	}
+
+	select {
+	case err := <-errs:
+		t.Errorf("callback was called again with %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSinkInvokerPassesMetadataToSink(t *testing.T) {
+	var invokerMetadata, sinkMetadata map[string]string
+	si := &sinkInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			invokerMetadata, _ = runner.MetadataFromContext(ctx)
+			return &fnrun.Result{Status: 200}, nil
+		}),
+		sink: func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			sinkMetadata, _ = runner.MetadataFromContext(ctx)
+			return result, nil
+		},
+	}
+
+	metadata := map[string]string{"partition": "3", "offset": "42"}
+	ctx := runner.WithMetadata(context.Background(), metadata)
+	if _, err := si.Invoke(ctx, &fnrun.Input{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, got := range []map[string]string{invokerMetadata, sinkMetadata} {
+		if got["partition"] != "3" || got["offset"] != "42" {
+			t.Errorf("expected %v, got %v", metadata, got)
+		}
+	}
+}
+
+func TestMetadataFromContextWithoutMetadata(t *testing.T) {
+	if metadata, ok := runner.MetadataFromContext(context.Background()); ok || metadata != nil {
+		t.Errorf("expected no metadata, got %v", metadata)
+	}
+}
+
+func TestGetFunctionCommandFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "command")
+	if err := ioutil.WriteFile(path, []byte("\n  python3 -u handler.py --mode batch\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FUNCTION_COMMAND", "")
+	t.Setenv("FUNCTION_COMMAND_FILE", path)
+
+	cmdStr, err := getFunctionCommand("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cmdStr != "python3 -u handler.py --mode batch" {
+		t.Errorf("expected the command to be trimmed, got %q", cmdStr)
+	}
+
+	cmd, err := executil.ParseCmd(cmdStr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"python3", "-u", "handler.py", "--mode", "batch"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("expected args %q, got %q", want, cmd.Args)
+	}
+}
+
+func TestGetFunctionCommandPrefersEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "command")
+	if err := ioutil.WriteFile(path, []byte("from-file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FUNCTION_COMMAND_OTHER", "from-env")
+	t.Setenv("FUNCTION_COMMAND_FILE_OTHER", path)
+
+	if cmdStr, err := getFunctionCommand("OTHER"); err != nil || cmdStr != "from-env" {
+		t.Errorf("expected from-env, got %q, %v", cmdStr, err)
+	}
+}
+
+func TestGetFunctionCommandMissingFile(t *testing.T) {
+	t.Setenv("FUNCTION_COMMAND", "")
+	t.Setenv("FUNCTION_COMMAND_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	_, err := getFunctionCommand("")
+	var configErr *runner.ConfigError
+	if !errors.As(err, &configErr) || configErr.Name != "FUNCTION_COMMAND_FILE" {
+		t.Errorf("expected a FUNCTION_COMMAND_FILE config error, got %v", err)
+	}
+}
+
+func histogramTotals(h *histogram) (uint64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count, h.sum
+}
+
+func TestSinkInvokerObservesSourceToSinkLatency(t *testing.T) {
+	si := &sinkInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return &fnrun.Result{}, nil
+		}),
+		sink: func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			return result, nil
+		},
+	}
+
+	tests := []struct {
+		name      string
+		timestamp string
+		observed  bool
+	}{
+		{name: "timestamp", timestamp: time.Now().Add(-2 * time.Second).Format(time.RFC3339Nano), observed: true},
+		{name: "no timestamp", timestamp: ""},
+		{name: "invalid timestamp", timestamp: "yesterday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timestamp != "" {
+				ctx = runner.WithMetadata(ctx, map[string]string{eventTimestampKey: tt.timestamp})
+			}
+			count, sum := histogramTotals(sourceToSinkLatency)
+
+			if _, err := si.Invoke(ctx, &fnrun.Input{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			newCount, newSum := histogramTotals(sourceToSinkLatency)
+			if !tt.observed {
+				if newCount != count {
+					t.Errorf("expected no observation, got %d", newCount-count)
+				}
+				return
+			}
+			if newCount != count+1 {
+				t.Fatalf("expected one observation, got %d", newCount-count)
+			}
+			if latency := newSum - sum; latency < 2 || latency > 10 {
+				t.Errorf("expected a latency of about 2s, got %vs", latency)
+			}
+		})
+	}
+}
+
+func TestSinkInvokerWithoutAnInvoker(t *testing.T) {
+	si := &sinkInvoker{sink: func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		t.Error("expected the sink not to be called")
+		return result, nil
+	}}
+
+	result, err := si.Invoke(context.Background(), &fnrun.Input{})
+	if err != runner.ErrNilInvoker {
+		t.Errorf("expected ErrNilInvoker, got %v", err)
+	}
+	if result != nil {
+		t.Errorf("expected no result, got %+v", result)
+	}
+}
+
+func TestSinkInvokerWithoutASink(t *testing.T) {
+	want := &fnrun.Result{Status: 200, Data: []byte("x")}
+	si := &sinkInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return want, nil
+	})}
+
+	result, err := si.Invoke(context.Background(), &fnrun.Input{})
+	if err != nil || result != want {
+		t.Errorf("expected the result of the invoker, got %+v (%v)", result, err)
+	}
+}
+
+// sleepingPool returns an invoker pool whose invocations take 200ms unless
+// their context is done first. The invocations record the metadata of their
+// context in metadata.
+func sleepingPool(t *testing.T, metadata chan<- map[string]string) *invokerPool {
+	t.Helper()
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		values, _ := runner.MetadataFromContext(ctx)
+		metadata <- values
+		select {
+		case <-time.After(200 * time.Millisecond):
+			return &fnrun.Result{}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	return pool
+}
+
+func TestSinkInvokerPropagatesDeadlines(t *testing.T) {
+	metadata := make(chan map[string]string, 1)
+	si := &sinkInvoker{invoker: sleepingPool(t, metadata)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ctx = runner.WithMetadata(ctx, map[string]string{correlationIDKey: "abc"})
+	start := time.Now()
+	_, err := si.Invoke(ctx, &fnrun.Input{})
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed >= 200*time.Millisecond {
+		t.Errorf("expected the invocation to stop at the deadline, took %v", elapsed)
+	}
+	if values := <-metadata; values[correlationIDKey] != "abc" {
+		t.Errorf("expected the context values to reach the function, got %v", values)
+	}
+}
+
+func TestSinkInvokerReturnsPromptlyWhenCancelled(t *testing.T) {
+	metadata := make(chan map[string]string, 1)
+	si := &sinkInvoker{invoker: sleepingPool(t, metadata)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := si.Invoke(ctx, &fnrun.Input{})
+		done <- err
+	}()
+	<-metadata
+
+	start := time.Now()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+			t.Errorf("expected the invocation to return promptly, took %v", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the invocation to return when its context was cancelled")
+	}
+}
+
+func TestStartupJitterIsWithinBounds(t *testing.T) {
+	max := 10 * time.Millisecond
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		jitter := startupJitter(max)
+		if jitter < 0 || jitter > max {
+			t.Fatalf("expected the jitter to be in [0, %v], got %v", max, jitter)
+		}
+		seen[jitter] = true
+	}
+	if len(seen) < 100 {
+		t.Errorf("expected the jitter to be spread across its range, got %d distinct values", len(seen))
+	}
+
+	for _, max := range []time.Duration{0, -time.Second} {
+		if jitter := startupJitter(max); jitter != 0 {
+			t.Errorf("expected no jitter for a maximum of %v, got %v", max, jitter)
+		}
+	}
+}
+
+func TestEnvHelpers(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		wantString string
+		wantInt    int
+		wantFloat  float64
+		wantBool   bool
+	}{
+		{"empty", "", "default", 7, 1.5, true},
+		{"integer", "42", "42", 42, 42, true},
+		{"negative", "-3", "-3", -3, -3, true},
+		{"fraction", "0.25", "0.25", 7, 0.25, true},
+		{"bool", "false", "false", 7, 1.5, false},
+		{"bool digit", "0", "0", 0, 0, false},
+		{"invalid", "many", "many", 7, 1.5, true},
+		{"whitespace", " 42 ", " 42 ", 7, 1.5, true},
+		{"only whitespace", "  ", "  ", 7, 1.5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FNRUN_TEST_VALUE", tt.value)
+
+			if got := getStringEnv("FNRUN_TEST_VALUE", "default"); got != tt.wantString {
+				t.Errorf("getStringEnv: expected %q, got %q", tt.wantString, got)
+			}
+			if got := getIntEnv("FNRUN_TEST_VALUE", 7); got != tt.wantInt {
+				t.Errorf("getIntEnv: expected %d, got %d", tt.wantInt, got)
+			}
+			if got := getFloatEnv("FNRUN_TEST_VALUE", 1.5); got != tt.wantFloat {
+				t.Errorf("getFloatEnv: expected %v, got %v", tt.wantFloat, got)
+			}
+			if got := getBoolEnv("FNRUN_TEST_VALUE", true); got != tt.wantBool {
+				t.Errorf("getBoolEnv: expected %v, got %v", tt.wantBool, got)
+			}
+		})
+	}
+}
+
+// setEnv clears each of names and then sets the variables of env, so that a
+// table row only depends on the variables it lists.
+func setEnv(t *testing.T, names []string, env map[string]string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "")
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+}
+
+// checkConfigError reports whether err matches the expected error of a table
+// row: no error when both are empty, otherwise a ConfigError for wantName
+// whose message contains wantErr.
+func checkConfigError(t *testing.T, err error, wantName string, wantErr string) {
+	t.Helper()
+	if wantName == "" && wantErr == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("expected an error containing %q", wantErr)
+	}
+	if !strings.Contains(err.Error(), wantErr) {
+		t.Errorf("expected an error containing %q, got %v", wantErr, err)
+	}
+	if wantName != "" {
+		var configErr *runner.ConfigError
+		if !errors.As(err, &configErr) || configErr.Name != wantName {
+			t.Errorf("expected a %s config error, got %v", wantName, err)
+		}
+	}
+}
+
+func TestGetInvokerEnv(t *testing.T) {
+	commandFile := filepath.Join(t.TempDir(), "command")
+	if err := ioutil.WriteFile(commandFile, []byte("  cat  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{
+		"TENANT_KEY", "FUNCTION_VERSION_MANIFEST", "STICKY_ROUTING",
+		"INVOKER_TYPE", "INVOKER_TYPE_B", "INVOKER_PLUGIN_PATH", "INVOKER_PLUGIN_SYMBOL",
+		"FUNCTION_COMMAND", "FUNCTION_COMMAND_B", "FUNCTION_COMMAND_FILE",
+		"MAX_FUNCTION_COUNT", "MAX_WAIT_MILLIS", "MAX_EXEC_MILLIS",
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		want     poolSettings
+		wantName string
+		wantErr  string
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{"INVOKER_TYPE": "echo"},
+			want: poolSettings{8, 500 * time.Millisecond, 30 * time.Second},
+		},
+		{
+			name: "pool settings",
+			env:  map[string]string{"INVOKER_TYPE": "noop", "MAX_FUNCTION_COUNT": "3", "MAX_WAIT_MILLIS": "20", "MAX_EXEC_MILLIS": "1000"},
+			want: poolSettings{3, 20 * time.Millisecond, time.Second},
+		},
+		{
+			name: "invalid numbers",
+			env:  map[string]string{"INVOKER_TYPE": "echo", "MAX_FUNCTION_COUNT": "three", "MAX_WAIT_MILLIS": "1.5"},
+			want: poolSettings{8, 500 * time.Millisecond, 30 * time.Second},
+		},
+		{
+			name: "whitespace numbers",
+			env:  map[string]string{"INVOKER_TYPE": "echo", "MAX_FUNCTION_COUNT": " 3"},
+			want: poolSettings{8, 500 * time.Millisecond, 30 * time.Second},
+		},
+		{
+			name: "command",
+			env:  map[string]string{"FUNCTION_COMMAND": "cat", "MAX_FUNCTION_COUNT": "1"},
+			want: poolSettings{1, 500 * time.Millisecond, 30 * time.Second},
+		},
+		{
+			name: "command file",
+			env:  map[string]string{"INVOKER_TYPE": "cmd", "FUNCTION_COMMAND_FILE": commandFile, "MAX_FUNCTION_COUNT": "1"},
+			want: poolSettings{1, 500 * time.Millisecond, 30 * time.Second},
+		},
+		{
+			name:    "missing command",
+			env:     map[string]string{},
+			wantErr: "command string was empty",
+		},
+		{
+			name:     "missing command file",
+			env:      map[string]string{"FUNCTION_COMMAND_FILE": commandFile + ".missing"},
+			wantName: "FUNCTION_COMMAND_FILE",
+			wantErr:  "FUNCTION_COMMAND_FILE",
+		},
+		{
+			name:     "unknown type",
+			env:      map[string]string{"INVOKER_TYPE": "grpc"},
+			wantName: "INVOKER_TYPE",
+			wantErr:  "Unknown INVOKER_TYPE grpc",
+		},
+		{
+			name:     "plugin without path",
+			env:      map[string]string{"INVOKER_TYPE": "plugin", "INVOKER_PLUGIN_SYMBOL": "Invoker"},
+			wantName: "INVOKER_PLUGIN_PATH",
+			wantErr:  "INVOKER_PLUGIN_PATH",
+		},
+		{
+			name:     "plugin without symbol",
+			env:      map[string]string{"INVOKER_TYPE": "plugin", "INVOKER_PLUGIN_PATH": "invoker.so"},
+			wantName: "INVOKER_PLUGIN_SYMBOL",
+			wantErr:  "INVOKER_PLUGIN_SYMBOL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, names, tt.env)
+
+			invoker, err := getInvoker()
+			checkConfigError(t, err, tt.wantName, tt.wantErr)
+			if err != nil {
+				return
+			}
+			defer invoker.Close()
+
+			pool, ok := invoker.(*invokerPool)
+			if !ok {
+				t.Fatalf("expected an *invokerPool, got %T", invoker)
+			}
+			if got := pool.settings(); got != tt.want {
+				t.Errorf("expected settings %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGetEventSourceEnv(t *testing.T) {
+	names := []string{
+		"SOURCE_TYPE", "SOURCE_PLUGIN_PATH", "SOURCE_PLUGIN_SYMBOL",
+		"LOAD_RATE_PER_SECOND", "PATTERN_FILE", "SOURCE_PROCESS_COMMAND",
+		"PUBSUB_PROJECT", "PUBSUB_SUBSCRIPTION", "PUBSUB_MODE",
+		"KAFKA_BROKERS", "MQ_NAME",
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantName string
+		wantErr  string
+	}{
+		{
+			name: "http",
+			env:  map[string]string{"SOURCE_TYPE": "http"},
+		},
+		{
+			name: "load generator",
+			env:  map[string]string{"SOURCE_TYPE": "load-generator", "LOAD_RATE_PER_SECOND": "10"},
+		},
+		{
+			name:    "missing plugin path",
+			env:     map[string]string{},
+			wantErr: "SOURCE_PLUGIN_PATH is a required environment variable",
+		},
+		{
+			name:    "whitespace plugin path",
+			env:     map[string]string{"SOURCE_TYPE": "plugin", "SOURCE_PLUGIN_PATH": " "},
+			wantErr: "SOURCE_PLUGIN_SYMBOL",
+		},
+		{
+			name:    "missing load rate",
+			env:     map[string]string{"SOURCE_TYPE": "load-generator"},
+			wantErr: "LOAD_RATE_PER_SECOND must be greater than zero",
+		},
+		{
+			name:    "invalid load rate",
+			env:     map[string]string{"SOURCE_TYPE": "load-generator", "LOAD_RATE_PER_SECOND": "fast"},
+			wantErr: "LOAD_RATE_PER_SECOND must be greater than zero",
+		},
+		{
+			name:    "missing pattern file",
+			env:     map[string]string{"SOURCE_TYPE": "pattern"},
+			wantErr: "PATTERN_FILE is required when SOURCE_TYPE is pattern",
+		},
+		{
+			name:    "missing process command",
+			env:     map[string]string{"SOURCE_TYPE": "process"},
+			wantErr: "SOURCE_PROCESS_COMMAND is required when SOURCE_TYPE is process",
+		},
+		{
+			name:    "missing kafka brokers",
+			env:     map[string]string{"SOURCE_TYPE": "kafka"},
+			wantErr: "KAFKA_BROKERS is required for the kafka source",
+		},
+		{
+			name:     "missing pubsub project",
+			env:      map[string]string{"SOURCE_TYPE": "gcp-pubsub", "PUBSUB_SUBSCRIPTION": "events-sub"},
+			wantName: "PUBSUB_PROJECT",
+			wantErr:  "PUBSUB_PROJECT",
+		},
+		{
+			name:     "missing mq name",
+			env:      map[string]string{"SOURCE_TYPE": "posix-mq"},
+			wantName: "MQ_NAME",
+			wantErr:  "MQ_NAME is required for the posix-mq source",
+		},
+		{
+			name:     "unknown type",
+			env:      map[string]string{"SOURCE_TYPE": "amqp"},
+			wantName: "SOURCE_TYPE",
+			wantErr:  "Unknown SOURCE_TYPE amqp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, names, tt.env)
+
+			source, err := getEventSource(nil)
+			checkConfigError(t, err, tt.wantName, tt.wantErr)
+			if err == nil && source == nil {
+				t.Error("expected a source")
+			}
+		})
+	}
+}
+
+func TestGetEventSinkEnv(t *testing.T) {
+	names := []string{
+		"SINK_TYPE", "SINK_RING", "SINK_PLUGIN_PATH", "SINK_PLUGIN_SYMBOL",
+		"SINK_INDEPENDENT_ERRORS", "SINK_DELIVERY_SEMANTICS", "SINK_FANOUT_PARALLEL",
+		"DRYRUN_FORMAT",
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantSink bool
+		wantName string
+		wantErr  string
+	}{
+		{
+			name: "no sink",
+			env:  map[string]string{},
+		},
+		{
+			name:     "dry run",
+			env:      map[string]string{"SINK_TYPE": "dry-run"},
+			wantSink: true,
+		},
+		{
+			name:     "unknown type",
+			env:      map[string]string{"SINK_TYPE": "kinesis"},
+			wantName: "SINK_TYPE",
+			wantErr:  "Unknown SINK_TYPE kinesis",
+		},
+		{
+			name:     "whitespace type",
+			env:      map[string]string{"SINK_TYPE": " plugin"},
+			wantName: "SINK_TYPE",
+			wantErr:  "Unknown SINK_TYPE",
+		},
+		{
+			name:     "ring and plugin path",
+			env:      map[string]string{"SINK_RING": "a,b", "SINK_PLUGIN_PATH": "sink.so"},
+			wantName: "SINK_RING",
+			wantErr:  "SINK_RING and SINK_PLUGIN_PATH cannot both be provided",
+		},
+		{
+			name:     "missing symbol",
+			env:      map[string]string{"SINK_PLUGIN_PATH": "sink.so"},
+			wantName: "SINK_PLUGIN_SYMBOL",
+			wantErr:  "SINK_PLUGIN_SYMBOL is required",
+		},
+		{
+			name:     "mismatched symbols",
+			env:      map[string]string{"SINK_PLUGIN_PATH": "a.so,b.so", "SINK_PLUGIN_SYMBOL": "Sink"},
+			wantName: "SINK_PLUGIN_SYMBOL",
+			wantErr:  "same number of entries",
+		},
+		{
+			name:     "invalid dry run format",
+			env:      map[string]string{"SINK_TYPE": "dry-run", "DRYRUN_FORMAT": "xml"},
+			wantName: "DRYRUN_FORMAT",
+			wantErr:  "DRYRUN_FORMAT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, names, tt.env)
+
+			sink, err := getEventSink()
+			checkConfigError(t, err, tt.wantName, tt.wantErr)
+			if (sink != nil) != tt.wantSink {
+				t.Errorf("expected a sink: %v, got %v", tt.wantSink, sink != nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var invokerRSS = newGaugeVec("fnrunner_invoker_rss_bytes", "Resident set size of each function process.", "pid")
+
+// processReporter is implemented by invokers that run function processes.
+type processReporter interface {
+	functionProcesses() []*trackedProcess
+}
+
+// allFunctionProcesses returns the function processes run by invoker, or nil
+// if it does not run any.
+func allFunctionProcesses(invoker interface{}) []*trackedProcess {
+	if reporter, ok := invoker.(processReporter); ok {
+		return reporter.functionProcesses()
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// Memory Sampler
+//
+// The memory sampler periodically reads the resident set size of every
+// function process from /proc and serves it as a gauge labeled by pid. When a
+// limit is configured, processes that exceed it are recycled once they are
+// idle. The sampler relies on /proc and
+// reports nothing on platforms that do not provide it.
+
+func sampleMemory(ctx context.Context, invoker interface{}, interval time.Duration, limit int64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		values := make(map[string]float64)
+		for _, process := range allFunctionProcesses(invoker) {
+			pid := process.cmd.Process.Pid
+			rss, err := readRSS(pid)
+			if err != nil {
+				continue
+			}
+			values[strconv.Itoa(pid)] = float64(rss)
+
+			if limit > 0 && rss > limit && process.owner.recycle(process) {
+				log.Printf("function process %d is using %d bytes, exceeding MEMORY_LIMIT_BYTES; recycling it", pid, rss)
+			}
+		}
+		invokerRSS.replace(values)
+	}
+}
+
+// readRSS returns the resident set size in bytes of the process with pid.
+func readRSS(pid int) (int64, error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "VmRSS:") {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, "VmRSS:"))
+		if len(fields) == 0 {
+			break
+		}
+		kilobytes, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kilobytes * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.New("VmRSS not found")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestReadRSS(t *testing.T) {
+	rss, err := readRSS(os.Getpid())
+	if err != nil {
+		t.Skipf("could not read the RSS of the test process: %v", err)
+	}
+	if rss <= 0 {
+		t.Errorf("expected a positive RSS, got %d", rss)
+	}
+}
+
+// invokePID invokes pool and returns the PID of the function process that
+// handled the invocation.
+func invokePID(t *testing.T, pool fnrun.Invoker) string {
+	t.Helper()
+	result, err := pool.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pid := result.Env[invokerPIDKey]
+	if pid == "" {
+		t.Fatal("expected the result to carry the PID of the function process")
+	}
+	return pid
+}
+
+// functionProcessRunning reports whether pid is one of the function processes
+// of pool.
+func functionProcessRunning(pool *invokerPool, pid string) bool {
+	for _, process := range allFunctionProcesses(pool) {
+		if strconv.Itoa(process.cmd.Process.Pid) == pid {
+			return true
+		}
+	}
+	return false
+}
+
+func sampledRSS() map[string]float64 {
+	invokerRSS.mu.Lock()
+	defer invokerRSS.mu.Unlock()
+	return invokerRSS.values
+}
+
+func TestSampleMemoryReportsTheRSSOfEachFunctionProcess(t *testing.T) {
+	if _, err := readRSS(os.Getpid()); err != nil {
+		t.Skipf("/proc is not available: %v", err)
+	}
+	pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo"), time.Second, nil)
+	})
+	defer pool.Close()
+	pid := invokePID(t, pool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sampleMemory(ctx, pool, 10*time.Millisecond, 0)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		values := sampledRSS()
+		if rss, ok := values[pid]; ok {
+			if rss <= 0 {
+				t.Errorf("expected a positive RSS for process %s, got %v", pid, rss)
+			}
+			if len(values) != 1 {
+				t.Errorf("expected only the function process to be sampled, got %v", values)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the RSS of process %s to be sampled, got %v", pid, values)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSampleMemoryRecyclesProcessesOverTheLimit(t *testing.T) {
+	if _, err := readRSS(os.Getpid()); err != nil {
+		t.Skipf("/proc is not available: %v", err)
+	}
+	pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo"), time.Second, nil)
+	})
+	defer pool.Close()
+	pid := invokePID(t, pool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go sampleMemory(ctx, pool, 10*time.Millisecond, 1)
+
+	// Every process exceeds a limit of one byte, so each sample recycles the
+	// process that replaced the previous one. A process is only sampled once
+	// before it is replaced, so the test waits for the replacement instead.
+	deadline := time.Now().Add(5 * time.Second)
+	for functionProcessRunning(pool, pid) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the process to be recycled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	replacement := invokePID(t, pool)
+	if replacement == pid {
+		t.Errorf("expected process %s to be replaced after exceeding the limit", pid)
+	}
+	if _, err := strconv.Atoi(replacement); err != nil {
+		t.Errorf("expected the PID of the replacement process, got %q", replacement)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// -----------------------------------------------------------------------------
+// Metrics
+//
+// This is a minimal implementation of the Prometheus text exposition format
+// that supports only the metric types used by the runner. Metrics register
+// themselves with the default registry when they are created and are served
+// by serveMetrics.
+
+var defaultSizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216}
+
+var defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	inputSize = newHistogram(
+		"fnrunner_input_size_bytes",
+		"Size of the data of each input passed to the function.",
+		// env: METRICS_INPUT_BUCKETS list 64,256,...,16777216 "Comma-separated bucket bounds of the input size histogram."
+		getBucketsEnv("METRICS_INPUT_BUCKETS", defaultSizeBuckets),
+	)
+	resultSize = newHistogram(
+		"fnrunner_result_size_bytes",
+		"Size of the data of each result returned by the function.",
+		// env: METRICS_RESULT_BUCKETS list 64,256,...,16777216 "Comma-separated bucket bounds of the result size histogram."
+		getBucketsEnv("METRICS_RESULT_BUCKETS", defaultSizeBuckets),
+	)
+)
+
+// getBucketsEnv returns the histogram bucket bounds in the comma-separated
+// named environment variable, sorted in increasing order, or defaultBounds if
+// the variable is unset or contains a value that cannot be parsed.
+func getBucketsEnv(name string, defaultBounds []float64) []float64 {
+	str := os.Getenv(name)
+	if str == "" {
+		return defaultBounds
+	}
+
+	var bounds []float64
+	for _, field := range strings.Split(str, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return defaultBounds
+		}
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+
+	return bounds
+}
+
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+type metricRegistry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+var defaultRegistry = &metricRegistry{}
+
+func (mr *metricRegistry) register(m metric) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.metrics = append(mr.metrics, m)
+}
+
+// serveMetrics writes every registered metric in the Prometheus text format.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	defaultRegistry.mu.Lock()
+	metrics := append([]metric(nil), defaultRegistry.metrics...)
+	defaultRegistry.mu.Unlock()
+
+	for _, m := range metrics {
+		m.writeTo(w)
+	}
+}
+
+// gaugeFunc is a gauge whose value is read when the metrics are served.
+type gaugeFunc struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+func newGaugeFunc(name string, help string, value func() float64) *gaugeFunc {
+	g := &gaugeFunc{name: name, help: help, value: value}
+	defaultRegistry.register(g)
+	return g
+}
+
+func (g *gaugeFunc) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", g.name, g.help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatMetricValue(g.value()))
+}
+
+// counter is a monotonically increasing count.
+type counter struct {
+	name  string
+	help  string
+	value uint64
+}
+
+func newCounter(name string, help string) *counter {
+	c := &counter{name: name, help: help}
+	defaultRegistry.register(c)
+	return c
+}
+
+func (c *counter) inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+func (c *counter) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+	fmt.Fprintf(w, "%s %d\n", c.name, atomic.LoadUint64(&c.value))
+}
+
+// counterVec is a counter with one count for each value of a single label.
+type counterVec struct {
+	name   string
+	help   string
+	label  string
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func newCounterVec(name string, help string, label string) *counterVec {
+	c := &counterVec{name: name, help: help, label: label, values: make(map[string]uint64)}
+	defaultRegistry.register(c)
+	return c
+}
+
+func (c *counterVec) inc(label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[label]++
+}
+
+func (c *counterVec) writeTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	labels := make([]string, 0, len(c.values))
+	for label := range c.values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+	for _, label := range labels {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", c.name, c.label, label, c.values[label])
+	}
+}
+
+// gaugeVec is a gauge with one value for each value of a single label. The
+// values are replaced as a set so that label values that are no longer present
+// are not served.
+type gaugeVec struct {
+	name   string
+	help   string
+	label  string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newGaugeVec(name string, help string, label string) *gaugeVec {
+	g := &gaugeVec{name: name, help: help, label: label}
+	defaultRegistry.register(g)
+	return g
+}
+
+func (g *gaugeVec) replace(values map[string]float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values = values
+}
+
+func (g *gaugeVec) writeTo(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	labels := make([]string, 0, len(g.values))
+	for label := range g.values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", g.name, g.help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+	for _, label := range labels {
+		fmt.Fprintf(w, "%s{%s=%q} %s\n", g.name, g.label, label, formatMetricValue(g.values[label]))
+	}
+}
+
+// histogram counts observations in cumulative buckets with the provided upper
+// bounds, which must be sorted in increasing order.
+type histogram struct {
+	name    string
+	help    string
+	bounds  []float64
+	mu      sync.Mutex
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(name string, help string, bounds []float64) *histogram {
+	h := &histogram{name: name, help: help, bounds: bounds, buckets: make([]uint64, len(bounds))}
+	defaultRegistry.register(h)
+	return h
+}
+
+func (h *histogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (h *histogram) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", h.name, h.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatMetricValue(bound), h.buckets[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatMetricValue(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// atomicGaugeValue adapts an int64 updated with the atomic package for use as
+// the value of a gaugeFunc.
+func atomicGaugeValue(addr *int64) func() float64 {
+	return func() float64 {
+		return float64(atomic.LoadInt64(addr))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+// bucketCounts returns a copy of the cumulative bucket counts of h.
+func bucketCounts(h *histogram) []uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64(nil), h.buckets...)
+}
+
+func TestSinkInvokerObservesInputAndResultSizes(t *testing.T) {
+	si := &sinkInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Data: make([]byte, 2*len(input.Data))}, nil
+	})}
+
+	inputsBefore := bucketCounts(inputSize)
+	resultsBefore := bucketCounts(resultSize)
+	if _, err := si.Invoke(context.Background(), &fnrun.Input{Data: make([]byte, 100)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The buckets are cumulative, so an observation increments every bucket
+	// whose bound is at least the observed size.
+	tests := []struct {
+		name   string
+		h      *histogram
+		before []uint64
+		size   float64
+	}{
+		{name: "input", h: inputSize, before: inputsBefore, size: 100},
+		{name: "result", h: resultSize, before: resultsBefore, size: 200},
+	}
+	for _, tt := range tests {
+		after := bucketCounts(tt.h)
+		for i, bound := range tt.h.bounds {
+			want := tt.before[i]
+			if tt.size <= bound {
+				want++
+			}
+			if after[i] != want {
+				t.Errorf("%s: expected bucket le=%v to count %d, got %d", tt.name, bound, want, after[i])
+			}
+		}
+	}
+}
+
+func TestGetBucketsEnv(t *testing.T) {
+	defaults := []float64{1, 2}
+	tests := []struct {
+		value string
+		want  []float64
+	}{
+		{value: "", want: defaults},
+		{value: "4096, 64,1024", want: []float64{64, 1024, 4096}},
+		{value: "64,large", want: defaults},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("METRICS_TEST_BUCKETS", tt.value)
+		if got := getBucketsEnv("METRICS_TEST_BUCKETS", defaults); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.value, tt.want, got)
+		}
+	}
+}
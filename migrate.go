@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const schemaVersionKey = "x-schema-version"
+
+type inputMigrator func(ctx context.Context, version string, input *fnrun.Input) (*fnrun.Input, error)
+
+func getInputMigrator() (inputMigrator, error) {
+	// env: INPUT_MIGRATOR_PLUGIN_PATH string "" "Plugin containing the migrator applied to inputs before invocation."
+	path := os.Getenv("INPUT_MIGRATOR_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil
+	}
+
+	// env: INPUT_MIGRATOR_PLUGIN_SYMBOL string "" "Symbol of the input migrator in INPUT_MIGRATOR_PLUGIN_PATH."
+	symbolName := os.Getenv("INPUT_MIGRATOR_PLUGIN_SYMBOL")
+	if symbolName == "" {
+		return nil, configErrorf("INPUT_MIGRATOR_PLUGIN_SYMBOL", "INPUT_MIGRATOR_PLUGIN_SYMBOL is required when an INPUT_MIGRATOR_PLUGIN_PATH is provided")
+	}
+
+	symMigrator, err := lookupPluginSymbol(path, symbolName)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, ok := symMigrator.(func(context.Context, string, *fnrun.Input) (*fnrun.Input, error))
+	if !ok {
+		return nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
+	}
+
+	return migrator, nil
+}
+
+// -----------------------------------------------------------------------------
+// Migrating Invoker
+//
+// The migrating invoker passes each input through a migrator plugin before it
+// reaches the function so that inputs written against an older schema can be
+// upgraded. The schema version of the input is read from the x-schema-version
+// metadata key and is empty if the key is absent.
+
+type migratingInvoker struct {
+	invoker  fnrun.Invoker
+	migrator inputMigrator
+}
+
+func (mi *migratingInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	version := ""
+	if metadata, ok := runner.MetadataFromContext(ctx); ok {
+		version = metadata[schemaVersionKey]
+	}
+
+	migrated, err := mi.migrator(ctx, version, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return mi.invoker.Invoke(ctx, migrated)
+}
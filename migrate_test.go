@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// renameFieldMigrator renames the field "name" to "fullName" in inputs of
+// schema version 1.
+func renameFieldMigrator(ctx context.Context, version string, input *fnrun.Input) (*fnrun.Input, error) {
+	if version != "1" {
+		return input, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(input.Data, &fields); err != nil {
+		return nil, err
+	}
+	fields["fullName"] = fields["name"]
+	delete(fields, "name")
+	data, err := json.Marshal(fields)
+	return &fnrun.Input{Data: data}, err
+}
+
+func TestMigratingInvokerMigratesInputs(t *testing.T) {
+	var received []string
+	mi := &migratingInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			received = append(received, string(input.Data))
+			return &fnrun.Result{}, nil
+		}),
+		migrator: renameFieldMigrator,
+	}
+
+	ctx := runner.WithMetadata(context.Background(), map[string]string{schemaVersionKey: "1"})
+	if _, err := mi.Invoke(ctx, &fnrun.Input{Data: []byte(`{"name":"Ada"}`)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := mi.Invoke(context.Background(), &fnrun.Input{Data: []byte(`{"fullName":"Grace"}`)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{`{"fullName":"Ada"}`, `{"fullName":"Grace"}`}
+	if len(received) != 2 || received[0] != want[0] || received[1] != want[1] {
+		t.Errorf("expected the function to receive %v, got %v", want, received)
+	}
+}
+
+func TestMigratingInvokerStopsOnMigrationFailure(t *testing.T) {
+	mi := &migratingInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			t.Error("expected the function not to be invoked")
+			return &fnrun.Result{}, nil
+		}),
+		migrator: func(ctx context.Context, version string, input *fnrun.Input) (*fnrun.Input, error) {
+			return nil, errors.New("unsupported version")
+		},
+	}
+
+	if _, err := mi.Invoke(context.Background(), &fnrun.Input{}); err == nil {
+		t.Error("expected the migration error")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func getResultErrorMapper() (runner.ResultErrorMapper, error) {
+	// env: RESULT_ERROR_MAPPER_PLUGIN_PATH string "" "Plugin containing the mapper from results to nack directives."
+	path := os.Getenv("RESULT_ERROR_MAPPER_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil
+	}
+
+	// env: RESULT_ERROR_MAPPER_PLUGIN_SYMBOL string "" "Symbol of the result error mapper in RESULT_ERROR_MAPPER_PLUGIN_PATH."
+	symbolName := os.Getenv("RESULT_ERROR_MAPPER_PLUGIN_SYMBOL")
+	if symbolName == "" {
+		return nil, configErrorf("RESULT_ERROR_MAPPER_PLUGIN_SYMBOL", "RESULT_ERROR_MAPPER_PLUGIN_SYMBOL is required when a RESULT_ERROR_MAPPER_PLUGIN_PATH is provided")
+	}
+
+	symMapper, err := lookupPluginSymbol(path, symbolName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mapper := symMapper.(type) {
+	case func(*fnrun.Result) runner.NackDirective:
+		return mapper, nil
+	case *runner.ResultErrorMapper:
+		return *mapper, nil
+	default:
+		return nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Nack Mapping Invoker
+//
+// The nack mapping invoker implements runner.AckableInvoker by passing results
+// with an error status through a result error mapper plugin. Sources that
+// only use Invoke are unaffected.
+
+type nackMappingInvoker struct {
+	invoker fnrun.Invoker
+	mapper  runner.ResultErrorMapper
+}
+
+func (ni *nackMappingInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	return ni.invoker.Invoke(ctx, input)
+}
+
+func (ni *nackMappingInvoker) InvokeAckable(ctx context.Context, input *fnrun.Input) (*fnrun.Result, *runner.NackDirective, error) {
+	result, err := ni.invoker.Invoke(ctx, input)
+	if err != nil || result == nil || !isErrorStatus(result.Status) {
+		return result, nil, err
+	}
+
+	directive := ni.mapper(result)
+	return result, &directive, nil
+}
+
+// invokeAckable calls InvokeAckable if the invoker implements
+// runner.AckableInvoker and Invoke otherwise.
+func invokeAckable(ctx context.Context, invoker fnrun.Invoker, input *fnrun.Input) (*fnrun.Result, *runner.NackDirective, error) {
+	if ackable, ok := invoker.(runner.AckableInvoker); ok {
+		return ackable.InvokeAckable(ctx, input)
+	}
+
+	result, err := invoker.Invoke(ctx, input)
+	return result, nil, err
+}
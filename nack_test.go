@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestNackMappingInvokerReportsTheMappedDirective(t *testing.T) {
+	mapper := func(result *fnrun.Result) runner.NackDirective {
+		if result.Status == 429 {
+			return runner.NackDirective{Requeue: true, Delay: 30 * time.Second}
+		}
+		return runner.NackDirective{}
+	}
+	status := 200
+	function := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: status}, nil
+	})
+
+	// The source sees the invoker through the drain invoker, which must pass
+	// the directive along.
+	var invoker fnrun.Invoker = newDrainInvoker(&nackMappingInvoker{invoker: function, mapper: mapper}, nil)
+	ackable, ok := invoker.(runner.AckableInvoker)
+	if !ok {
+		t.Fatal("expected the invoker of the source to implement AckableInvoker")
+	}
+
+	tests := []struct {
+		status int
+		want   *runner.NackDirective
+	}{
+		{status: 200, want: nil},
+		{status: 429, want: &runner.NackDirective{Requeue: true, Delay: 30 * time.Second}},
+		{status: 500, want: &runner.NackDirective{}},
+	}
+	for _, tt := range tests {
+		status = tt.status
+		result, directive, err := ackable.InvokeAckable(context.Background(), &fnrun.Input{})
+		if err != nil || result == nil || result.Status != tt.status {
+			t.Errorf("status %d: expected the result to be returned, got %+v (%v)", tt.status, result, err)
+		}
+		switch {
+		case tt.want == nil && directive != nil:
+			t.Errorf("status %d: expected no directive, got %+v", tt.status, *directive)
+		case tt.want != nil && (directive == nil || *directive != *tt.want):
+			t.Errorf("status %d: expected directive %+v, got %v", tt.status, *tt.want, directive)
+		}
+	}
+}
+
+func TestInvokeAckableFallsBackToInvoke(t *testing.T) {
+	result, directive, err := invokeAckable(context.Background(), invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 503}, nil
+	}), &fnrun.Input{})
+	if err != nil || result.Status != 503 || directive != nil {
+		t.Errorf("expected the result without a directive, got %+v, %v (%v)", result, directive, err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tessellator/fnrun"
+)
+
+// natsConns holds the connections opened by NATS sinks so that they can be
+// closed when the runner exits, which flushes the messages they have buffered.
+var natsConns struct {
+	sync.Mutex
+	list []*nats.Conn
+}
+
+// closeNATSConns closes the connections opened by NATS sinks.
+func closeNATSConns() {
+	natsConns.Lock()
+	defer natsConns.Unlock()
+
+	for _, conn := range natsConns.list {
+		conn.Close()
+	}
+	natsConns.list = nil
+}
+
+// newNATSSink returns a sink that publishes each result to a subject of a NATS
+// server with core NATS, without JetStream. The message data is the result
+// encoded as JSON in the format written by the stdin source. Publishing is fire
+// and forget: a delivery completes once the message has been buffered by the
+// client, and is not acknowledged by the server or by any subscriber, so
+// results published while no one is subscribed are lost. The client reconnects
+// on its own if the connection to the server is lost, buffering messages in the
+// meantime, and buffered messages are flushed when the runner exits.
+func newNATSSink(url string, subject string) (eventSinkTransformer, error) {
+	if subject == "" {
+		return nil, configErrorf("NATS_SINK_SUBJECT", "NATS_SINK_SUBJECT is required for the nats sink")
+	}
+
+	var conn *nats.Conn
+	err := connectWithBackoff(func() (err error) {
+		conn, err = nats.Connect(url, nats.Name("fnrun-runner"))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	natsConns.Lock()
+	natsConns.list = append(natsConns.list, conn)
+	natsConns.Unlock()
+
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		data, err := json.Marshal(replayOutput{Status: result.Status, Data: result.Data, Env: result.Env})
+		if err != nil {
+			return result, err
+		}
+
+		return result, conn.Publish(subject, data)
+	}, nil
+}
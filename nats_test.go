@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/tessellator/fnrun"
+)
+
+// runNATSServer runs a NATS server on a random port for the duration of the
+// test and returns its URL.
+func runNATSServer(t *testing.T) string {
+	t.Helper()
+	opts := natsserver.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	srv := natsserver.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+	return srv.ClientURL()
+}
+
+func TestNATSSinkPublishesResults(t *testing.T) {
+	url := runNATSServer(t)
+	sub, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	messages := make(chan *nats.Msg, 10)
+	if _, err := sub.ChanSubscribe("results", messages); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := newNATSSink(url, "results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeNATSConns()
+
+	for i := 0; i < 3; i++ {
+		result := &fnrun.Result{Status: 200 + i, Data: []byte(fmt.Sprintf("result %d", i)), Env: map[string]string{"n": fmt.Sprint(i)}}
+		if got, err := sink(context.Background(), result); err != nil || got != result {
+			t.Fatalf("expected the result to be returned, got %v: %v", got, err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-messages:
+			var output replayOutput
+			if err := json.Unmarshal(msg.Data, &output); err != nil {
+				t.Fatalf("expected the message data to be the result as JSON, got %q: %v", msg.Data, err)
+			}
+			if output.Status != 200+i || string(output.Data) != fmt.Sprintf("result %d", i) || output.Env["n"] != fmt.Sprint(i) {
+				t.Errorf("expected result %d in order, got %+v", i, output)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected message %d to be delivered", i)
+		}
+	}
+}
+
+func TestCloseNATSConnsFlushesBufferedMessages(t *testing.T) {
+	url := runNATSServer(t)
+	sub, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	messages, err := sub.SubscribeSync("results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := newNATSSink(url, "results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := sink(context.Background(), &fnrun.Result{Status: 200, Data: []byte("x")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	closeNATSConns()
+
+	for i := 0; i < 100; i++ {
+		if _, err := messages.NextMsg(5 * time.Second); err != nil {
+			t.Fatalf("expected message %d to be flushed on close: %v", i, err)
+		}
+	}
+	natsConns.Lock()
+	defer natsConns.Unlock()
+	if len(natsConns.list) != 0 {
+		t.Errorf("expected the connections to be forgotten, got %d", len(natsConns.list))
+	}
+}
+
+func TestNewNATSSinkConfigErrors(t *testing.T) {
+	_, err := newNATSSink("nats://127.0.0.1:4222", "")
+	checkConfigError(t, err, "NATS_SINK_SUBJECT", "NATS_SINK_SUBJECT is required")
+
+	t.Setenv("CONNECT_MAX_RETRIES", "0")
+	if _, err := newNATSSink("nats://"+freeAddr(t), "results"); err == nil {
+		t.Error("expected an error when the server cannot be reached")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/tessellator/fnrun"
+)
+
+type outputRouter func(ctx context.Context, element json.RawMessage, index int) string
+
+// getOutputRouter loads the router named by OUTPUT_ROUTER_PLUGIN_PATH and
+// OUTPUT_ROUTER_PLUGIN_SYMBOL along with the sinks it routes to. The sinks are
+// listed by name in OUTPUT_ROUTER_SINKS, and the sink for each name is loaded
+// from SINK_PLUGIN_PATH_<NAME> and SINK_PLUGIN_SYMBOL_<NAME>, where <NAME> is
+// the upper-cased name.
+func getOutputRouter() (router outputRouter, sinks map[string]eventSinkTransformer, err error) {
+	// env: OUTPUT_ROUTER_PLUGIN_PATH string "" "Plugin containing the router that chooses the sink of each result."
+	path := os.Getenv("OUTPUT_ROUTER_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil, nil
+	}
+	defer tracePluginLoad("load output router plugin", "OUTPUT_ROUTER_PLUGIN_PATH", "OUTPUT_ROUTER_PLUGIN_SYMBOL")(&err)
+
+	// env: OUTPUT_ROUTER_PLUGIN_SYMBOL string "" "Symbol of the output router in OUTPUT_ROUTER_PLUGIN_PATH."
+	symbolName := os.Getenv("OUTPUT_ROUTER_PLUGIN_SYMBOL")
+	if symbolName == "" {
+		return nil, nil, configErrorf("OUTPUT_ROUTER_PLUGIN_SYMBOL", "OUTPUT_ROUTER_PLUGIN_SYMBOL is required when an OUTPUT_ROUTER_PLUGIN_PATH is provided")
+	}
+
+	symRouter, err := lookupPluginSymbol(path, symbolName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	router, ok := symRouter.(func(context.Context, json.RawMessage, int) string)
+	if !ok {
+		return nil, nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
+	}
+
+	sinks = make(map[string]eventSinkTransformer)
+	// env: OUTPUT_ROUTER_SINKS list "" "Comma-separated names of the sinks to which the output router routes, each loaded from SINK_PLUGIN_PATH_<NAME> and SINK_PLUGIN_SYMBOL_<NAME>."
+	for _, name := range strings.Split(os.Getenv("OUTPUT_ROUTER_SINKS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		sinks[name], err = loadNamedSink(name, "OUTPUT_ROUTER_SINKS")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return router, sinks, nil
+}
+
+// loadNamedSink loads the sink with the given name from SINK_PLUGIN_PATH_<NAME>
+// and SINK_PLUGIN_SYMBOL_<NAME>, where <NAME> is the upper-cased name. listEnv
+// is the variable that named the sink.
+func loadNamedSink(name string, listEnv string) (eventSinkTransformer, error) {
+	suffix := strings.ToUpper(name)
+	// env: SINK_PLUGIN_PATH_<NAME> string "" "Plugin containing the sink with the given name, used by OUTPUT_ROUTER_SINKS and SINK_RING."
+	// env: SINK_PLUGIN_SYMBOL_<NAME> string "" "Symbol of the sink with the given name."
+	pathEnv, symbolEnv := "SINK_PLUGIN_PATH_"+suffix, "SINK_PLUGIN_SYMBOL_"+suffix
+	if os.Getenv(pathEnv) == "" || os.Getenv(symbolEnv) == "" {
+		return nil, configErrorf(listEnv, "%s and %s are required for the %s sink", pathEnv, symbolEnv, name)
+	}
+
+	return loadEventSink(os.Getenv(pathEnv), os.Getenv(symbolEnv))
+}
+
+// -----------------------------------------------------------------------------
+// Output Router
+//
+// The output router delivers each element of a result whose data is a JSON
+// array to a separate sink. The router plugin is called with each element and
+// its index and returns the name of the sink for the element; elements for
+// which it returns an unknown name are delivered to the default sink. Each
+// element is delivered as a result with the status and env of the original
+// result. Results whose data is not a JSON array are delivered to the default
+// sink unchanged.
+//
+// All elements are delivered even if an earlier delivery fails, and the first
+// error is returned.
+
+func newRoutingSink(defaultSink eventSinkTransformer, sinks map[string]eventSinkTransformer, router outputRouter) eventSinkTransformer {
+	deliver := func(ctx context.Context, sink eventSinkTransformer, result *fnrun.Result) error {
+		if sink == nil {
+			return nil
+		}
+		_, err := sink(ctx, result)
+		return err
+	}
+
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		var elements []json.RawMessage
+		if err := json.Unmarshal(result.Data, &elements); err != nil {
+			return result, deliver(ctx, defaultSink, result)
+		}
+
+		var firstErr error
+		for i, element := range elements {
+			sink, ok := sinks[router(ctx, element, i)]
+			if !ok {
+				sink = defaultSink
+			}
+
+			err := deliver(ctx, sink, &fnrun.Result{Status: result.Status, Data: element, Env: result.Env})
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		return result, firstErr
+	}
+}
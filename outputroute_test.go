@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+// routedElements records the data of the results delivered to each sink.
+type routedElements struct {
+	mu   sync.Mutex
+	data map[string][]string
+}
+
+func (re *routedElements) sink(name string, err error) eventSinkTransformer {
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		re.mu.Lock()
+		defer re.mu.Unlock()
+		if re.data == nil {
+			re.data = make(map[string][]string)
+		}
+		re.data[name] = append(re.data[name], string(result.Data))
+		return result, err
+	}
+}
+
+func routeByParity(ctx context.Context, element json.RawMessage, index int) string {
+	if index%2 == 0 {
+		return "a"
+	}
+	return "b"
+}
+
+func TestRoutingSinkRoutesEachElement(t *testing.T) {
+	var routed routedElements
+	sinks := map[string]eventSinkTransformer{"a": routed.sink("a", nil), "b": routed.sink("b", nil)}
+	sink := newRoutingSink(routed.sink("default", nil), sinks, routeByParity)
+
+	result := &fnrun.Result{Status: 200, Data: []byte(`[0, {"one": 1}, "two", 3, [4]]`)}
+	returned, err := sink(context.Background(), result)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if returned != result {
+		t.Error("expected the original result to be returned")
+	}
+
+	want := map[string][]string{
+		"a": {`0`, `"two"`, `[4]`},
+		"b": {`{"one": 1}`, `3`},
+	}
+	if !reflect.DeepEqual(routed.data, want) {
+		t.Errorf("expected %v, got %v", want, routed.data)
+	}
+}
+
+func TestRoutingSinkFallsBackToTheDefaultSink(t *testing.T) {
+	var routed routedElements
+	sinks := map[string]eventSinkTransformer{"a": routed.sink("a", nil)}
+	sink := newRoutingSink(routed.sink("default", nil), sinks, routeByParity)
+
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte(`[1, 2]`)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte(`{"not": "an array"}`)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string][]string{
+		"a":       {`1`},
+		"default": {`2`, `{"not": "an array"}`},
+	}
+	if !reflect.DeepEqual(routed.data, want) {
+		t.Errorf("expected %v, got %v", want, routed.data)
+	}
+}
+
+func TestRoutingSinkDeliversEveryElementWhenADeliveryFails(t *testing.T) {
+	errA := errors.New("sink a failed")
+	var routed routedElements
+	sinks := map[string]eventSinkTransformer{
+		"a": routed.sink("a", errA),
+		"b": routed.sink("b", errors.New("sink b failed")),
+	}
+	sink := newRoutingSink(nil, sinks, routeByParity)
+
+	_, err := sink(context.Background(), &fnrun.Result{Data: []byte(`[1, 2, 3]`)})
+	if err != errA {
+		t.Errorf("expected the first error, got %v", err)
+	}
+	if len(routed.data["a"])+len(routed.data["b"]) != 3 {
+		t.Errorf("expected every element to be delivered, got %v", routed.data)
+	}
+}
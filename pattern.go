@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Pattern source
+//
+// The pattern source is a load generator that replays input templates read
+// from a file instead of producing random payloads, so that the same load can
+// be reproduced across benchmark runs. The templates are used in sequence,
+// wrapping around at the end of the file, or chosen at random.
+//
+// A file with a .json extension contains an array of templates. Templates that
+// are strings are used as they are; any other value is used as its JSON
+// encoding. Any other file is read as CSV, and the first field of each record
+// is a template.
+//
+// The following placeholders are substituted in each template when it is used:
+//
+//   {{index}}      the zero-based index of the input
+//   {{timestamp}}  the current time in RFC 3339 format
+//   {{uuid}}       a random version 4 UUID
+
+const (
+	patternOrderSequence = "sequence"
+	patternOrderRandom   = "random"
+)
+
+func newPatternSource(path string, order string, rate float64, duration time.Duration) (eventSource, error) {
+	if path == "" {
+		return nil, configErrorf("PATTERN_FILE", "PATTERN_FILE is required when SOURCE_TYPE is pattern")
+	}
+	if rate <= 0 {
+		return nil, configErrorf("LOAD_RATE_PER_SECOND", "LOAD_RATE_PER_SECOND must be greater than zero")
+	}
+	if order != patternOrderSequence && order != patternOrderRandom {
+		return nil, configErrorf("PATTERN_ORDER", "Unknown PATTERN_ORDER %s", order)
+	}
+
+	templates, err := readPatternTemplates(path)
+	if err != nil {
+		return nil, &runner.ConfigError{Name: "PATTERN_FILE", Err: err}
+	}
+	if len(templates) == 0 {
+		return nil, configErrorf("PATTERN_FILE", "Pattern file %s contains no templates", path)
+	}
+
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		return generateLoad(ctx, invoker, "pattern source", rate, duration, func(index int64) []byte {
+			template := templates[index%int64(len(templates))]
+			if order == patternOrderRandom {
+				template = templates[r.Intn(len(templates))]
+			}
+			return expandPatternTemplate(template, index)
+		})
+	}, nil
+}
+
+func readPatternTemplates(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var values []json.RawMessage
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, configErrorf("PATTERN_FILE", "Pattern file %s must contain a JSON array: %v", path, err)
+		}
+
+		templates := make([]string, len(values))
+		for i, value := range values {
+			var str string
+			if err := json.Unmarshal(value, &str); err == nil {
+				templates[i] = str
+			} else {
+				templates[i] = string(value)
+			}
+		}
+		return templates, nil
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, configErrorf("PATTERN_FILE", "Pattern file %s could not be read as CSV: %v", path, err)
+	}
+
+	templates := make([]string, 0, len(records))
+	for _, record := range records {
+		templates = append(templates, record[0])
+	}
+	return templates, nil
+}
+
+func expandPatternTemplate(template string, index int64) []byte {
+	replacer := strings.NewReplacer(
+		"{{index}}", strconv.FormatInt(index, 10),
+		"{{timestamp}}", time.Now().UTC().Format(time.RFC3339Nano),
+		"{{uuid}}", newUUID(),
+	)
+	return []byte(replacer.Replace(template))
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	cryptorand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
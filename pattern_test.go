@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func writePatternFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// collectPatternInputs runs source until it has produced n inputs and returns
+// the data of each.
+func collectPatternInputs(t *testing.T, source eventSource, n int) []string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var inputs []string
+	done := make(chan error, 1)
+	go func() {
+		done <- source(ctx, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if len(inputs) < n {
+				inputs = append(inputs, string(input.Data))
+				if len(inputs) == n {
+					cancel()
+				}
+			}
+			return &fnrun.Result{}, nil
+		}))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the pattern source to produce the inputs")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return inputs
+}
+
+func TestPatternSourceAppliesTemplatesInSequence(t *testing.T) {
+	path := writePatternFile(t, "patterns.json", `[
+		"plain-{{index}}",
+		{"index": "{{index}}", "id": "{{uuid}}"},
+		"at-{{index}}-{{timestamp}}"
+	]`)
+	source, err := newPatternSource(path, patternOrderSequence, 500, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[int]bool)
+	for _, input := range collectPatternInputs(t, source, 6) {
+		var index int
+		switch {
+		case strings.HasPrefix(input, "plain-"):
+			index, _ = strconv.Atoi(strings.TrimPrefix(input, "plain-"))
+			if index%3 != 0 {
+				t.Errorf("expected the first template for input %d, got %q", index, input)
+			}
+		case strings.HasPrefix(input, "{"):
+			var object struct{ Index, ID string }
+			if err := json.Unmarshal([]byte(input), &object); err != nil {
+				t.Fatalf("expected the object template to stay valid JSON, got %q: %v", input, err)
+			}
+			index, _ = strconv.Atoi(object.Index)
+			if index%3 != 1 {
+				t.Errorf("expected the second template for input %d, got %q", index, input)
+			}
+			if !uuid.MatchString(object.ID) {
+				t.Errorf("expected {{uuid}} to be a version 4 UUID, got %q", object.ID)
+			}
+		case strings.HasPrefix(input, "at-"):
+			parts := strings.SplitN(strings.TrimPrefix(input, "at-"), "-", 2)
+			index, _ = strconv.Atoi(parts[0])
+			if index%3 != 2 {
+				t.Errorf("expected the third template for input %d, got %q", index, input)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, parts[1]); err != nil {
+				t.Errorf("expected {{timestamp}} to be an RFC 3339 time, got %q", parts[1])
+			}
+		default:
+			t.Errorf("unexpected input %q", input)
+		}
+		seen[index] = true
+	}
+
+	for i := 0; i < 6; i++ {
+		if !seen[i] {
+			t.Errorf("expected an input with index %d", i)
+		}
+	}
+}
+
+func TestPatternSourceChoosesTemplatesAtRandom(t *testing.T) {
+	path := writePatternFile(t, "patterns.csv", "a,ignored\nb\nc\n")
+	source, err := newPatternSource(path, patternOrderRandom, 500, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range collectPatternInputs(t, source, 20) {
+		if input != "a" && input != "b" && input != "c" {
+			t.Errorf("expected one of the templates, got %q", input)
+		}
+	}
+}
+
+func TestReadPatternTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "patterns.json", content: `["a", 1, {"b": 2}]`, want: []string{"a", "1", `{"b": 2}`}},
+		{name: "patterns.csv", content: "a,1\n\"b,c\"\n", want: []string{"a", "b,c"}},
+	}
+
+	for _, tt := range tests {
+		got, err := readPatternTemplates(writePatternFile(t, tt.name, tt.content))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestNewPatternSourceValidatesItsConfiguration(t *testing.T) {
+	path := writePatternFile(t, "patterns.json", `["a"]`)
+	empty := writePatternFile(t, "empty.json", `[]`)
+	tests := []struct {
+		name  string
+		path  string
+		order string
+		rate  float64
+	}{
+		{name: "no file", path: "", order: patternOrderSequence, rate: 1},
+		{name: "no rate", path: path, order: patternOrderSequence, rate: 0},
+		{name: "unknown order", path: path, order: "shuffle", rate: 1},
+		{name: "no templates", path: empty, order: patternOrderSequence, rate: 1},
+	}
+
+	for _, tt := range tests {
+		if _, err := newPatternSource(tt.path, tt.order, tt.rate, 0); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
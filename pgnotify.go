@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const postgresChannelKey = "x-postgres-channel"
+
+// -----------------------------------------------------------------------------
+// PostgreSQL LISTEN/NOTIFY Source
+//
+// The postgres-notify source listens on a PostgreSQL notification channel and
+// invokes the function with the payload of each notification, passing the
+// name of the channel in the x-postgres-channel metadata. Notifications are
+// invoked concurrently as they arrive; a failed invocation is logged, since
+// PostgreSQL does not redeliver notifications.
+//
+// When the connection is lost, the source reconnects with the usual connection
+// backoff and listens again. Notifications sent while it was disconnected are
+// lost.
+
+func newPostgresNotifySource(dsn string, channel string) (eventSource, error) {
+	if dsn == "" {
+		return nil, configErrorf("POSTGRES_DSN", "POSTGRES_DSN is required for the postgres-notify source")
+	}
+	if channel == "" {
+		return nil, configErrorf("POSTGRES_CHANNEL", "POSTGRES_CHANNEL is required for the postgres-notify source")
+	}
+
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		var wg sync.WaitGroup
+		defer wg.Wait()
+
+		for {
+			conn, err := listenPostgres(ctx, dsn, channel)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+
+			err = receiveNotifications(ctx, conn, invoker, &wg)
+			conn.Close(context.Background())
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("lost connection to PostgreSQL, reconnecting: %v", err)
+		}
+	}, nil
+}
+
+// listenPostgres connects to the database and starts listening on channel.
+func listenPostgres(ctx context.Context, dsn string, channel string) (*pgx.Conn, error) {
+	var conn *pgx.Conn
+	err := connectWithBackoff(func() error {
+		c, err := pgx.Connect(ctx, dsn)
+		if err != nil {
+			return err
+		}
+		if _, err := c.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			c.Close(context.Background())
+			return err
+		}
+		conn = c
+		return nil
+	})
+	return conn, err
+}
+
+// receiveNotifications invokes the function with each notification received
+// on conn until the connection fails or ctx is cancelled.
+func receiveNotifications(ctx context.Context, conn *pgx.Conn, invoker fnrun.Invoker, wg *sync.WaitGroup) error {
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			invokeCtx := runner.WithMetadata(ctx, map[string]string{postgresChannelKey: notification.Channel})
+			if _, err := invoker.Invoke(invokeCtx, &fnrun.Input{Data: []byte(notification.Payload)}); err != nil {
+				log.Printf("could not process PostgreSQL notification on %s: %v", notification.Channel, err)
+			}
+		}()
+	}
+}
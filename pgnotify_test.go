@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// fakePostgresConn is a client connection to a fakePostgres server that has
+// issued a LISTEN.
+type fakePostgresConn struct {
+	conn   net.Conn
+	listen string
+}
+
+// notify sends a notification on channel to the client.
+func (c *fakePostgresConn) notify(t *testing.T, channel string, payload string) {
+	t.Helper()
+	msg, err := (&pgproto3.NotificationResponse{PID: 1, Channel: channel, Payload: payload}).Encode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakePostgres speaks enough of the PostgreSQL protocol to accept a
+// connection and a LISTEN, after which the test can send notifications
+// through the connection published on listening.
+type fakePostgres struct {
+	listener  net.Listener
+	listening chan *fakePostgresConn
+	wg        sync.WaitGroup
+}
+
+func newFakePostgres(t *testing.T) *fakePostgres {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakePostgres{listener: listener, listening: make(chan *fakePostgresConn, 4)}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.wg.Add(1)
+			go func() {
+				defer f.wg.Done()
+				defer conn.Close()
+				f.serve(conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		f.wg.Wait()
+	})
+	return f
+}
+
+func (f *fakePostgres) dsn() string {
+	return "postgres://test@" + f.listener.Addr().String() + "/test?sslmode=disable"
+}
+
+func (f *fakePostgres) serve(conn net.Conn) {
+	backend := pgproto3.NewBackend(conn, conn)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if backend.Flush() != nil {
+		return
+	}
+
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		query, ok := msg.(*pgproto3.Query)
+		if !ok {
+			return
+		}
+		backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("LISTEN")})
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		if backend.Flush() != nil {
+			return
+		}
+		f.listening <- &fakePostgresConn{conn: conn, listen: query.String}
+	}
+}
+
+func (f *fakePostgres) waitForListen(t *testing.T) *fakePostgresConn {
+	t.Helper()
+	select {
+	case conn := <-f.listening:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the source to LISTEN")
+		return nil
+	}
+}
+
+func TestPostgresNotifySourceInvokesTheFunctionWithNotifications(t *testing.T) {
+	t.Setenv("CONNECT_BACKOFF_MILLIS", "10")
+	server := newFakePostgres(t)
+	source, err := newPostgresNotifySource(server.dsn(), "Order Events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan string, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- source(ctx, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			metadata, _ := runner.MetadataFromContext(ctx)
+			received <- metadata[postgresChannelKey] + ":" + string(input.Data)
+			return &fnrun.Result{Status: 200}, nil
+		}))
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("expected the source to stop cleanly, got %v", err)
+		}
+	}()
+
+	conn := server.waitForListen(t)
+	if conn.listen != `LISTEN "Order Events"` {
+		t.Errorf("expected the channel to be quoted, got %q", conn.listen)
+	}
+	conn.notify(t, "Order Events", `{"id": 1}`)
+	if got := waitForNotification(t, received); got != `Order Events:{"id": 1}` {
+		t.Errorf("expected the notification to be invoked, got %q", got)
+	}
+
+	// The source listens again after the connection is lost.
+	conn.conn.Close()
+	conn = server.waitForListen(t)
+	conn.notify(t, "Order Events", "after reconnecting")
+	if got := waitForNotification(t, received); got != "Order Events:after reconnecting" {
+		t.Errorf("expected the notification to be invoked after reconnecting, got %q", got)
+	}
+}
+
+func waitForNotification(t *testing.T, received <-chan string) string {
+	t.Helper()
+	select {
+	case got := <-received:
+		return got
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a notification to be invoked")
+		return ""
+	}
+}
+
+func TestPostgresNotifySourceFailsWhenItCannotConnect(t *testing.T) {
+	t.Setenv("CONNECT_MAX_RETRIES", "1")
+	t.Setenv("CONNECT_BACKOFF_MILLIS", "1")
+	source, err := newPostgresNotifySource("postgres://test@"+freeAddr(t)+"/test?sslmode=disable&connect_timeout=1", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := source(context.Background(), nil); err == nil {
+		t.Error("expected an error when the database cannot be reached")
+	}
+}
+
+func TestNewPostgresNotifySourceRequiresADSNAndChannel(t *testing.T) {
+	for _, tt := range []struct{ dsn, channel, wantName string }{
+		{"", "events", "POSTGRES_DSN"},
+		{"postgres://localhost/test", "", "POSTGRES_CHANNEL"},
+	} {
+		_, err := newPostgresNotifySource(tt.dsn, tt.channel)
+		var configErr *runner.ConfigError
+		if !errors.As(err, &configErr) || configErr.Name != tt.wantName {
+			t.Errorf("expected a %s config error, got %v", tt.wantName, err)
+		}
+	}
+}
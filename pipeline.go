@@ -0,0 +1,428 @@
+package main
+
+import (
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// closerList closes each of its elements in reverse order.
+type closerList []io.Closer
+
+func (cl closerList) Close() error {
+	var firstErr error
+	for i := len(cl) - 1; i >= 0; i-- {
+		if err := cl[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// getPipeline wraps the invoker and sink in the middleware configured by the
+// environment. The returned invoker is the one handed to the event source, and
+// the returned closer releases any resources (such as additional invoker
+// pools) created for the middleware.
+//
+// Middleware is applied from the inside out, so the last layer added here is
+// the first to see an invocation from the source.
+func getPipeline(invoker fnrun.Invoker, sink eventSinkTransformer) (pipeline fnrun.Invoker, closer io.Closer, err error) {
+	var closers closerList
+	defer func() {
+		if err != nil {
+			closers.Close()
+		}
+	}()
+
+	flags, err := getFeatureFlags()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The concurrency limiter is sized from the pools of the invoker before it
+	// is wrapped by the middleware.
+	slots, prioritySlots := totalCapacity(invoker)
+	if slots == 0 {
+		slots = getIntEnv("MAX_FUNCTION_COUNT", 8)
+		if os.Getenv("PRIORITY_METADATA_KEY") != "" {
+			prioritySlots = getIntEnv("PRIORITY_OVERSUBSCRIPTION", 2)
+		}
+	}
+
+	// env: BATCH_SIZE int 1 "Number of inputs passed to the function in a single invocation."
+	if batchSize := getIntEnv("BATCH_SIZE", 1); batchSize > 1 {
+		// env: BATCH_MAX_WAIT_MILLIS int 100 "Maximum time to wait for a batch of inputs to fill before invoking the function."
+		maxWait := time.Duration(getIntEnv("BATCH_MAX_WAIT_MILLIS", 100)) * time.Millisecond
+		invoker = newBatchInvoker(invoker, batchSize, maxWait)
+	}
+
+	// env: CHAOS_ENABLED bool false "Inject failures and delays into invocations to test resilience."
+	if getBoolEnv("CHAOS_ENABLED", false) {
+		seed := time.Now().UnixNano()
+		// env: CHAOS_SEED int "" "Seed of the chaos random number generator; a time-based seed is used when unset."
+		if os.Getenv("CHAOS_SEED") != "" {
+			seed = int64(getIntEnv("CHAOS_SEED", 0))
+		}
+		// env: CHAOS_DELAY_MAX_MILLIS int 0 "Maximum random delay injected before each invocation when CHAOS_ENABLED is set."
+		maxDelay := time.Duration(getIntEnv("CHAOS_DELAY_MAX_MILLIS", 0)) * time.Millisecond
+		// env: CHAOS_ERROR_RATE float 0 "Fraction of invocations that fail with an injected error when CHAOS_ENABLED is set."
+		invoker = newChaosInvoker(invoker, getFloatEnv("CHAOS_ERROR_RATE", 0), maxDelay, seed)
+	}
+
+	// env: ADAPTIVE_TIMEOUT bool false "Bound invocations by a multiple of their recent p99 latency instead of MAX_EXEC_MILLIS alone."
+	if getBoolEnv("ADAPTIVE_TIMEOUT", false) {
+		adaptive, err := newAdaptiveTimeoutInvoker(invoker,
+			// env: ADAPTIVE_WINDOW int 1000 "Number of recent invocations whose p99 latency sets the adaptive timeout."
+			getIntEnv("ADAPTIVE_WINDOW", 1000),
+			// env: ADAPTIVE_TIMEOUT_MULTIPLIER float 3.0 "Multiple of the p99 latency used as the adaptive timeout."
+			getFloatEnv("ADAPTIVE_TIMEOUT_MULTIPLIER", 3.0),
+			// env: MIN_EXEC_MILLIS int 100 "Lower bound of the adaptive timeout."
+			time.Duration(getIntEnv("MIN_EXEC_MILLIS", 100))*time.Millisecond,
+			time.Duration(getIntEnv("MAX_EXEC_MILLIS", 30000))*time.Millisecond,
+			// env: ADAPTIVE_UPDATE_INTERVAL int 100 "Number of invocations between updates of the adaptive timeout."
+			getIntEnv("ADAPTIVE_UPDATE_INTERVAL", 100),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		invoker = adaptive
+	}
+
+	invoker = &deadlineInvoker{
+		invoker: invoker,
+		maxExec: time.Duration(getIntEnv("MAX_EXEC_MILLIS", 30000)) * time.Millisecond,
+		now:     time.Now,
+	}
+
+	// env: INJECT_TIMESTAMP bool false "Pass the time at which each event was processed to the function."
+	if getBoolEnv("INJECT_TIMESTAMP", false) {
+		invoker = &timestampInvoker{invoker: invoker, now: time.Now}
+	}
+
+	invoker = &idempotencyKeyInvoker{invoker: invoker}
+
+	// env: STRICT_CONTENT_TYPE bool false "Reject inputs whose content-type metadata is neither application/json nor application/octet-stream."
+	if getBoolEnv("STRICT_CONTENT_TYPE", false) {
+		invoker = &contentTypeInvoker{invoker: invoker}
+	}
+
+	migrator, err := getInputMigrator()
+	if err != nil {
+		return nil, nil, err
+	}
+	if migrator != nil {
+		invoker = &migratingInvoker{invoker: invoker, migrator: migrator}
+	}
+
+	// env: INPUT_BODY_JSONPATH string "" "JSON path of the value of each input passed to the function in place of the input."
+	bodyPath := os.Getenv("INPUT_BODY_JSONPATH")
+	// env: INPUT_METADATA_JSONPATH_MAP string "" "JSON object mapping metadata keys to JSON paths of the input whose values are added to its metadata."
+	metadataPaths := os.Getenv("INPUT_METADATA_JSONPATH_MAP")
+	if bodyPath != "" || metadataPaths != "" {
+		extractor, err := newInputExtractionInvoker(invoker, bodyPath, metadataPaths)
+		if err != nil {
+			return nil, nil, err
+		}
+		invoker = extractor
+	}
+
+	// env: INPUT_ENCODING string "" "Encoding of the inputs converted to JSON before invocation: xml or csv."
+	if encoding := os.Getenv("INPUT_ENCODING"); encoding != "" {
+		// env: CSV_HEADERS list "" "Comma-separated keys of the CSV columns, each optionally suffixed with :string, :number or :bool; the first record is the header when unset."
+		reencoder, err := newReencodingInvoker(invoker, encoding, os.Getenv("CSV_HEADERS"))
+		if err != nil {
+			return nil, nil, err
+		}
+		invoker = reencoder
+	}
+
+	// env: INPUT_COMPRESSION string "" "Compression of the inputs: gzip, zstd, lz4 or auto."
+	if format := os.Getenv("INPUT_COMPRESSION"); format != "" {
+		decompressor, err := newDecompressionInvoker(invoker, format)
+		if err != nil {
+			return nil, nil, err
+		}
+		invoker = decompressor
+	}
+
+	// env: FUNCTION_RETRY_ON_CODES list "" "Comma-separated result status codes on which invocations are retried."
+	if codeList := os.Getenv("FUNCTION_RETRY_ON_CODES"); codeList != "" {
+		codes, err := parseStatusCodes(codeList)
+		if err != nil {
+			return nil, nil, &runner.ConfigError{Name: "FUNCTION_RETRY_ON_CODES", Err: err}
+		}
+		invoker = &retryInvoker{
+			invoker: invoker,
+			codes:   codes,
+			// env: FUNCTION_RETRY_COUNT int 3 "Number of times an invocation that fails with a code in FUNCTION_RETRY_ON_CODES is retried."
+			retries: getIntEnv("FUNCTION_RETRY_COUNT", 3),
+			// env: FUNCTION_RETRY_BACKOFF_MILLIS int 100 "Delay between retries of a function invocation."
+			backoff: time.Duration(getIntEnv("FUNCTION_RETRY_BACKOFF_MILLIS", 100)) * time.Millisecond,
+			flags:   flags,
+		}
+	}
+
+	router, routedSinks, err := getOutputRouter()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// env: MAX_SINK_MILLIS int 0 "Time after which the context of a delivery to the sink is cancelled; disabled when 0."
+	maxSink := time.Duration(getIntEnv("MAX_SINK_MILLIS", 0)) * time.Millisecond
+	// env: SINK_HARD_TIMEOUT_MILLIS int "" "Time after which a delivery to the sink that has not returned is abandoned; twice MAX_SINK_MILLIS when unset."
+	hardTimeout := time.Duration(getIntEnv("SINK_HARD_TIMEOUT_MILLIS", int(2*maxSink/time.Millisecond))) * time.Millisecond
+	if maxSink > 0 || hardTimeout > 0 {
+		if hardTimeout < maxSink || hardTimeout <= 0 {
+			return nil, nil, configErrorf("SINK_HARD_TIMEOUT_MILLIS", "SINK_HARD_TIMEOUT_MILLIS must be greater than zero and at least MAX_SINK_MILLIS")
+		}
+		if sink != nil {
+			sink = newTimeoutSink(sink, maxSink, hardTimeout)
+		}
+		for name, routedSink := range routedSinks {
+			routedSinks[name] = newTimeoutSink(routedSink, maxSink, hardTimeout)
+		}
+	}
+
+	// When the output is routed, each element is compressed separately by the
+	// sink it is routed to.
+	// env: OUTPUT_COMPRESSION string "" "Compression of the results delivered to the sink; only gzip is supported."
+	if format := os.Getenv("OUTPUT_COMPRESSION"); format != "" && (sink != nil || router != nil) {
+		if format != "gzip" {
+			return nil, nil, configErrorf("OUTPUT_COMPRESSION", "Unknown OUTPUT_COMPRESSION %s", format)
+		}
+
+		// env: OUTPUT_COMPRESSION_LEVEL int 6 "Compression level of OUTPUT_COMPRESSION."
+		level := getIntEnv("OUTPUT_COMPRESSION_LEVEL", 6)
+		if sink != nil {
+			if sink, err = compressingSink(sink, level); err != nil {
+				return nil, nil, err
+			}
+		}
+		for name, routedSink := range routedSinks {
+			if routedSinks[name], err = compressingSink(routedSink, level); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if router != nil {
+		sink = newRoutingSink(sink, routedSinks, router)
+	}
+
+	// env: DELIVERY_ENVELOPE bool false "Wrap results in an envelope with the number and times of their delivery attempts, retrying failed deliveries."
+	if getBoolEnv("DELIVERY_ENVELOPE", false) && sink != nil {
+		sink = newDeliveryEnvelopeSink(sink,
+			// env: DELIVERY_RETRY_COUNT int 0 "Number of times a failed delivery is retried when DELIVERY_ENVELOPE is set."
+			getIntEnv("DELIVERY_RETRY_COUNT", 0),
+			// env: DELIVERY_RETRY_BACKOFF_MILLIS int 100 "Delay between retries of a delivery when DELIVERY_ENVELOPE is set."
+			time.Duration(getIntEnv("DELIVERY_RETRY_BACKOFF_MILLIS", 100))*time.Millisecond,
+			time.Now,
+		)
+	}
+
+	// env: RESULT_AGGREGATE_SIZE int 0 "Number of results aggregated into a single delivery to the sink."
+	if size := getIntEnv("RESULT_AGGREGATE_SIZE", 0); size > 1 && sink != nil {
+		// env: RESULT_AGGREGATE_TIMEOUT_MILLIS int 1000 "Maximum time a partial aggregate waits before it is delivered."
+		timeout := time.Duration(getIntEnv("RESULT_AGGREGATE_TIMEOUT_MILLIS", 1000)) * time.Millisecond
+		sink = newAggregatingSink(sink, size, timeout)
+	}
+
+	// A sink window is an aggregate bounded by time first, and by size only if
+	// SINK_WINDOW_SIZE is set.
+	// env: SINK_WINDOW_MILLIS int 0 "Duration of the time windows into which results are grouped before delivery; disabled when 0."
+	if window := getIntEnv("SINK_WINDOW_MILLIS", 0); window > 0 && sink != nil {
+		if getIntEnv("RESULT_AGGREGATE_SIZE", 0) > 1 {
+			return nil, nil, configErrorf("SINK_WINDOW_MILLIS", "SINK_WINDOW_MILLIS and RESULT_AGGREGATE_SIZE cannot both be provided")
+		}
+		// env: SINK_WINDOW_SIZE int 0 "Maximum number of results in a time window; unbounded when 0."
+		size := getIntEnv("SINK_WINDOW_SIZE", 0)
+		if size <= 0 {
+			size = math.MaxInt32
+		}
+		sink = newAggregatingSink(sink, size, time.Duration(window)*time.Millisecond)
+	}
+
+	// env: SINK_ERROR_BUDGET_PERCENT float 0 "Percentage of deliveries to the sink that may fail before an alert is raised; disabled when 0."
+	if budget := getFloatEnv("SINK_ERROR_BUDGET_PERCENT", 0); budget > 0 && sink != nil {
+		alertSink, err := getAlertSink()
+		if err != nil {
+			return nil, nil, err
+		}
+		// env: SINK_ERROR_BUDGET_WINDOW_MINUTES int 60 "Window over which the sink error budget is measured."
+		tracker := newErrorBudgetTracker(budget, getIntEnv("SINK_ERROR_BUDGET_WINDOW_MINUTES", 60), alertSink)
+		sink = trackErrorBudget(sink, tracker)
+	}
+
+	filter, err := getResultFilter()
+	if err != nil {
+		return nil, nil, err
+	}
+	if filter != nil && sink != nil {
+		discardSink, err := getDiscardSink()
+		if err != nil {
+			return nil, nil, err
+		}
+		sink = filterResults(sink, filter, discardSink)
+	}
+
+	// env: ERROR_HANDLER_COMMAND string "" "Command run with each failed input to handle the error."
+	if cmdStr := os.Getenv("ERROR_HANDLER_COMMAND"); cmdStr != "" {
+		factory, err := newFunctionCmdFactory(cmdStr)
+		if err != nil {
+			return nil, nil, err
+		}
+		handlerPool, err := newInvokerPool(factory, "ERROR_HANDLER")
+		if err != nil {
+			return nil, nil, err
+		}
+		closers = append(closers, handlerPool)
+
+		deadLetterSink, err := getDeadLetterSink()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		invoker = &errorHandlerInvoker{invoker: invoker, handler: handlerPool, deadLetterSink: deadLetterSink}
+	}
+
+	// env: INPUT_SPLIT bool false "Invoke the function with each element of inputs that are JSON arrays."
+	if getBoolEnv("INPUT_SPLIT", false) {
+		invoker = &splitInvoker{invoker: invoker}
+	}
+
+	invoker = newEnrichInvoker(invoker)
+
+	// env: ENVELOPE_FORMAT bool false "Deliver results to the sink in the standard envelope format."
+	if getBoolEnv("ENVELOPE_FORMAT", false) {
+		defaultVersion := ""
+		if os.Getenv("FUNCTION_VERSION_MANIFEST") != "" {
+			defaultVersion = defaultFunctionVersion
+		}
+		pipeline = &envelopeInvoker{invoker: invoker, sink: sink, defaultVersion: defaultVersion, now: time.Now}
+	} else {
+		pipeline = &sinkInvoker{invoker: invoker, sink: sink}
+		if sink != nil {
+			pipeline = &streamingSinkInvoker{invoker: pipeline, sink: sink}
+		}
+	}
+
+	// env: MAX_FULL_RETRIES int 0 "Number of times an invocation and its delivery to the sink are retried together."
+	if retries := getIntEnv("MAX_FULL_RETRIES", 0); retries > 0 {
+		pipeline = &fullRetryInvoker{
+			invoker: pipeline,
+			retries: retries,
+			// env: FULL_RETRY_BACKOFF_MILLIS int 100 "Delay between retries of an invocation and its delivery to the sink."
+			backoff: time.Duration(getIntEnv("FULL_RETRY_BACKOFF_MILLIS", 100)) * time.Millisecond,
+			flags:   flags,
+		}
+	}
+
+	// env: STARTUP_RETRY_COUNT int 10 "Retries of an invocation rejected by an exhausted or starting pool until the first invocation succeeds; disabled when 0."
+	if retries := getIntEnv("STARTUP_RETRY_COUNT", 10); retries > 0 {
+		pipeline = &startupRetryInvoker{
+			invoker: pipeline,
+			retries: retries,
+			backoff: 10 * time.Millisecond,
+			flags:   flags,
+		}
+	}
+
+	transformer, err := getResultTransformer()
+	if err != nil {
+		return nil, nil, err
+	}
+	if transformer != nil {
+		pipeline = &resultTransformingInvoker{invoker: pipeline, transformer: transformer}
+	}
+
+	// env: MAX_INVOCATION_HEAP_BYTES uint 0 "Heap growth of the runner during an invocation above which a warning is logged."
+	if limit := getUint64Env("MAX_INVOCATION_HEAP_BYTES"); limit > 0 {
+		pipeline = &heapLimitInvoker{
+			invoker: pipeline,
+			limit:   limit,
+			// env: INVOCATION_HEAP_GC_AFTER int 3 "Number of consecutive invocations exceeding MAX_INVOCATION_HEAP_BYTES after which a garbage collection is forced."
+			gcAfter: int64(getIntEnv("INVOCATION_HEAP_GC_AFTER", 3)),
+		}
+	}
+
+	// Each function invocation may carry a batch of inputs, so enough inputs
+	// must be admitted to fill a batch for every invoker of every pool.
+	// High-priority inputs have their own allowance, matching the priority
+	// slots of the pools.
+	batchSize := getIntEnv("BATCH_SIZE", 1)
+	if limit := slots * batchSize; limit > 0 {
+		pipeline = newConcurrencyLimiter(pipeline, limit, os.Getenv("PRIORITY_METADATA_KEY"), prioritySlots*batchSize)
+	}
+
+	// env: SAMPLE_RATE float 1.0 "Fraction of inputs that are invoked; the rest are dropped."
+	if rate := getFloatEnv("SAMPLE_RATE", 1.0); rate < 1.0 {
+		pipeline = newSamplingInvoker(pipeline, rate)
+	}
+
+	// env: DEDUP_BACKEND string "" "Store used to drop duplicate inputs: redis. Deduplication is disabled when unset."
+	switch backend := os.Getenv("DEDUP_BACKEND"); backend {
+	case "":
+	case "redis":
+		// env: DEDUP_REDIS_ADDR string "" "Address of the Redis server used to deduplicate inputs."
+		addr := os.Getenv("DEDUP_REDIS_ADDR")
+		if addr == "" {
+			return nil, nil, configErrorf("DEDUP_REDIS_ADDR", "DEDUP_REDIS_ADDR is required when DEDUP_BACKEND is redis")
+		}
+		// env: DEDUP_TTL_SECONDS int 3600 "Time for which an input is remembered for deduplication."
+		ttl := time.Duration(getIntEnv("DEDUP_TTL_SECONDS", 3600)) * time.Second
+		pipeline = &dedupInvoker{invoker: pipeline, seen: newRedisSeenSet(addr), ttl: ttl, flags: flags}
+	default:
+		return nil, nil, configErrorf("DEDUP_BACKEND", "Unknown DEDUP_BACKEND %s", backend)
+	}
+
+	// env: ERROR_RATE_THRESHOLD float 0 "Error rate above which the error rate breaker opens and invocations are rejected; the breaker is disabled when 0."
+	if threshold := getFloatEnv("ERROR_RATE_THRESHOLD", 0); threshold > 0 {
+		pipeline = newErrorRateMonitor(
+			pipeline,
+			// env: ERROR_RATE_WINDOW_SECONDS int 60 "Window over which the error rate is measured."
+			time.Duration(getIntEnv("ERROR_RATE_WINDOW_SECONDS", 60))*time.Second,
+			threshold,
+			// env: ERROR_RATE_RESUME_THRESHOLD float 0.1 "Error rate below which the open error rate breaker closes."
+			getFloatEnv("ERROR_RATE_RESUME_THRESHOLD", 0.1),
+			// env: ERROR_RATE_MIN_INVOCATIONS int 10 "Minimum number of invocations in the window before the error rate breaker may open."
+			getIntEnv("ERROR_RATE_MIN_INVOCATIONS", 10),
+		)
+	}
+
+	// env: MAX_INVOCATIONS_PER_HOUR int 0 "Maximum number of invocations per hour; unlimited when 0."
+	if limit := getIntEnv("MAX_INVOCATIONS_PER_HOUR", 0); limit > 0 {
+		// env: QUOTA_STATE_PATH string "" "File in which the hourly invocation count is persisted across restarts."
+		quota, err := newQuotaInvoker(pipeline, limit, os.Getenv("QUOTA_STATE_PATH"))
+		if err != nil {
+			return nil, nil, err
+		}
+		pipeline = quota
+	}
+
+	mapper, err := getResultErrorMapper()
+	if err != nil {
+		return nil, nil, err
+	}
+	if mapper != nil {
+		pipeline = &nackMappingInvoker{invoker: pipeline, mapper: mapper}
+	}
+
+	// env: LOG_INVOCATIONS bool false "Log the status and duration of every invocation."
+	if getBoolEnv("LOG_INVOCATIONS", false) {
+		// env: LOG_SAMPLE_RATE float 1.0 "Fraction of successful invocations logged by LOG_INVOCATIONS; failed invocations are always logged."
+		pipeline = newInvocationLogger(pipeline, getFloatEnv("LOG_SAMPLE_RATE", 1.0))
+	}
+
+	// The replay-store sink stores the input from the source, so the input is
+	// captured before any of the middleware sees it.
+	if replayStoresOpen() {
+		closers = append(closers, replayStoreCloser{})
+		pipeline = &replayInputInvoker{invoker: pipeline}
+	}
+
+	return pipeline, closers, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tessellator/fnrun"
+	"gopkg.in/yaml.v3"
+)
+
+// -----------------------------------------------------------------------------
+// Pipeline Definition Files
+//
+// A pipeline definition file describes a pipeline of several functions that
+// run in a single runner, as an alternative to chaining runners together. Each
+// stage runs its command in a pool of max_workers function processes (or
+// MAX_FUNCTION_COUNT if it is not set), and the result of each stage is the
+// input of the next:
+//
+//	stages:
+//	  - name: parse
+//	    command: ./parse
+//	    max_workers: 4
+//	    source:
+//	      plugin_path: ./sources.so
+//	      plugin_symbol: Source
+//	  - name: enrich
+//	    command: ./enrich
+//	    sink:
+//	      plugin_path: builtin:dry-run
+//
+// Only the first stage has a source; it is a plugin source, or stdin if type is
+// stdin. Any stage may have a sink, which receives the results of that stage
+// before they are passed on; a sink that transforms results passes the
+// transformed results on. Sink paths may name built-in sinks with the builtin:
+// prefix.
+//
+// The other settings of the pools are read from the environment as usual, but
+// the middleware configured by the environment is not applied.
+
+type pipelineDefinition struct {
+	Stages []pipelineStage `yaml:"stages"`
+}
+
+type pipelineStage struct {
+	Name       string                `yaml:"name"`
+	Command    string                `yaml:"command"`
+	MaxWorkers int                   `yaml:"max_workers"`
+	Source     *pipelinePluginConfig `yaml:"source"`
+	Sink       *pipelinePluginConfig `yaml:"sink"`
+}
+
+type pipelinePluginConfig struct {
+	Type         string `yaml:"type"`
+	PluginPath   string `yaml:"plugin_path"`
+	PluginSymbol string `yaml:"plugin_symbol"`
+}
+
+func readPipelineDefinition(path string) (*pipelineDefinition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var definition pipelineDefinition
+	if err := yaml.Unmarshal(data, &definition); err != nil {
+		return nil, fmt.Errorf("could not parse pipeline definition %s: %w", path, err)
+	}
+
+	if len(definition.Stages) == 0 {
+		return nil, fmt.Errorf("pipeline definition %s has no stages", path)
+	}
+	for i, stage := range definition.Stages {
+		if stage.Name == "" {
+			definition.Stages[i].Name = fmt.Sprintf("stage %d", i+1)
+		}
+		if stage.Command == "" {
+			return nil, fmt.Errorf("%s of pipeline definition %s has no command", definition.Stages[i].Name, path)
+		}
+		if i > 0 && stage.Source != nil {
+			return nil, fmt.Errorf("%s of pipeline definition %s has a source, but only the first stage may have one", definition.Stages[i].Name, path)
+		}
+	}
+	if definition.Stages[0].Source == nil {
+		return nil, fmt.Errorf("the first stage of pipeline definition %s has no source", path)
+	}
+
+	return &definition, nil
+}
+
+// runPipelineFile runs the pipeline defined in the file at path until its
+// source returns or the runner receives SIGINT or SIGTERM.
+func runPipelineFile(path string) error {
+	definition, err := readPipelineDefinition(path)
+	if err != nil {
+		return err
+	}
+
+	var closers closerList
+	defer closers.Close()
+
+	// The stages are built from the last to the first, so that each stage
+	// can deliver its results to the one after it.
+	var next fnrun.Invoker
+	for i := len(definition.Stages) - 1; i >= 0; i-- {
+		stage := definition.Stages[i]
+
+		factory, err := newFunctionCmdFactory(stage.Command)
+		if err != nil {
+			return err
+		}
+		workers := stage.MaxWorkers
+		if workers <= 0 {
+			workers = getIntEnv("MAX_FUNCTION_COUNT", 8)
+		}
+		pool, err := newSizedInvokerPool(factory, "", workers)
+		if err != nil {
+			return err
+		}
+		closers = append(closers, pool)
+
+		var sinks []eventSinkTransformer
+		if stage.Sink != nil {
+			sink, err := loadEventSink(stage.Sink.PluginPath, stage.Sink.PluginSymbol)
+			if err != nil {
+				return err
+			}
+			sinks = append(sinks, sink)
+		}
+		if next != nil {
+			sinks = append(sinks, forwardToStage(next))
+		}
+
+		var sink eventSinkTransformer
+		if len(sinks) > 0 {
+			sink = chainSinks(sinks)
+		}
+		next = &sinkInvoker{invoker: pool, sink: sink}
+	}
+
+	source, err := getPipelineSource(definition.Stages[0].Source)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := source(ctx, next); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// forwardToStage returns a sink that invokes the next stage of a pipeline
+// with the data of each result.
+func forwardToStage(stage fnrun.Invoker) eventSinkTransformer {
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		_, err := stage.Invoke(ctx, &fnrun.Input{Data: result.Data})
+		return result, err
+	}
+}
+
+func getPipelineSource(config *pipelinePluginConfig) (eventSource, error) {
+	switch config.Type {
+	case "stdin":
+		return stdinSource, nil
+	case "", "plugin":
+		if config.PluginPath == "" || config.PluginSymbol == "" {
+			return nil, errors.New("the source of a pipeline definition requires plugin_path and plugin_symbol")
+		}
+
+		symSource, err := lookupPluginSymbol(config.PluginPath, config.PluginSymbol)
+		if err != nil {
+			return nil, err
+		}
+
+		sourceFunc, ok := symSource.(func(context.Context, fnrun.Invoker) error)
+		if !ok {
+			return nil, pluginErrorf(config.PluginPath, config.PluginSymbol, "Symbol %s could not be found in %s", config.PluginSymbol, config.PluginPath)
+		}
+		return sourceFunc, nil
+	default:
+		return nil, fmt.Errorf("Unknown pipeline source type %s", config.Type)
+	}
+}
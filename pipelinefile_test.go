@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writePipelineDefinition(t *testing.T, definition string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pipeline.yaml")
+	if err := ioutil.WriteFile(path, []byte(definition), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadPipelineDefinition(t *testing.T) {
+	path := writePipelineDefinition(t, `
+stages:
+  - name: parse
+    command: ./parse --strict
+    max_workers: 4
+    source:
+      type: stdin
+  - command: ./enrich
+    sink:
+      plugin_path: builtin:dry-run
+`)
+
+	definition, err := readPipelineDefinition(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &pipelineDefinition{Stages: []pipelineStage{
+		{Name: "parse", Command: "./parse --strict", MaxWorkers: 4, Source: &pipelinePluginConfig{Type: "stdin"}},
+		{Name: "stage 2", Command: "./enrich", Sink: &pipelinePluginConfig{PluginPath: "builtin:dry-run"}},
+	}}
+	if !reflect.DeepEqual(definition, want) {
+		t.Errorf("expected %+v, got %+v", want, definition)
+	}
+}
+
+func TestReadPipelineDefinitionErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		wantErr    string
+	}{
+		{"invalid YAML", "stages: [", "could not parse"},
+		{"no stages", "stages: []", "has no stages"},
+		{"no command", "stages:\n  - source: {type: stdin}", "stage 1 of pipeline definition"},
+		{"no source", "stages:\n  - command: ./a", "has no source"},
+		{
+			"source on a later stage",
+			"stages:\n  - command: ./a\n    source: {type: stdin}\n  - name: b\n    command: ./b\n    source: {type: stdin}",
+			"b of pipeline definition",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readPipelineDefinition(writePipelineDefinition(t, tt.definition))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if _, err := readPipelineDefinition(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestGetPipelineSourceErrors(t *testing.T) {
+	for _, config := range []*pipelinePluginConfig{
+		{PluginPath: "source.so"},
+		{Type: "plugin", PluginSymbol: "Source"},
+		{Type: "kafka"},
+	} {
+		if _, err := getPipelineSource(config); err == nil {
+			t.Errorf("expected an error for source %+v", config)
+		}
+	}
+}
+
+func TestRunPipelineFilePassesResultsBetweenStages(t *testing.T) {
+	// Both stages run the test binary, which prefixes each input with its
+	// arguments.
+	t.Setenv(testFunctionEnv, "prefix")
+	t.Setenv("DRYRUN_FORMAT", "text")
+	path := writePipelineDefinition(t, fmt.Sprintf(`
+stages:
+  - command: %q
+    max_workers: 1
+    source:
+      type: stdin
+  - command: %q
+    max_workers: 1
+    sink:
+      plugin_path: builtin:dry-run
+`, os.Args[0]+" one:", os.Args[0]+" two:"))
+
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdinR.Close()
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdoutR.Close()
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdinR, stdoutW
+	defer func() { os.Stdin, os.Stdout = oldStdin, oldStdout }()
+
+	output := make(chan string, 1)
+	go func() {
+		data, _ := ioutil.ReadAll(stdoutR)
+		output <- string(data)
+	}()
+
+	encoder := json.NewEncoder(stdinW)
+	for _, data := range []string{"a", "b"} {
+		if err := encoder.Encode(replayRecord{Data: []byte(data)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stdinW.Close()
+
+	err = runPipelineFile(path)
+	os.Stdout = oldStdout
+	stdoutW.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The source writes the results of the first stage, and the sink of the
+	// second stage prints its results.
+	var stage1 []string
+	var stage2 []string
+	for _, line := range strings.Split(strings.TrimSpace(<-output), "\n") {
+		var out replayOutput
+		if json.Unmarshal([]byte(line), &out) == nil {
+			stage1 = append(stage1, string(out.Data))
+			continue
+		}
+		if i := strings.Index(line, " data="); i >= 0 {
+			stage2 = append(stage2, line[i+len(" data="):])
+		}
+	}
+	if want := []string{"one:a", "one:b"}; !reflect.DeepEqual(stage1, want) {
+		t.Errorf("expected the first stage to return %q, got %q", want, stage1)
+	}
+	if want := []string{"two:one:a", "two:one:b"}; !reflect.DeepEqual(stage2, want) {
+		t.Errorf("expected the second stage to deliver %q, got %q", want, stage2)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// testPlugins holds the plugins built by buildTestPlugin. The runtime cannot
+// open a plugin more than once, so each plugin is built and opened once per
+// test binary and shared by the tests that use it.
+var testPlugins struct {
+	sync.Mutex
+	dir    string
+	paths  map[string]string
+	errors map[string]string
+}
+
+// buildTestPlugin builds the plugin in testdata/plugins/name and returns the
+// path of the shared object, skipping the test if it cannot be built. Plugins
+// must be built with the same flags as the test binary to be loadable, so the
+// plugin is built with the race detector when the tests are.
+func buildTestPlugin(t *testing.T, name string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building plugins is slow")
+	}
+
+	testPlugins.Lock()
+	defer testPlugins.Unlock()
+	if path, ok := testPlugins.paths[name]; ok {
+		return path
+	}
+	if reason, ok := testPlugins.errors[name]; ok {
+		t.Skip(reason)
+	}
+
+	if testPlugins.dir == "" {
+		dir, err := ioutil.TempDir("", "fnrun-test-plugins")
+		if err != nil {
+			t.Fatal(err)
+		}
+		testPlugins.dir = dir
+		testPlugins.paths = make(map[string]string)
+		testPlugins.errors = make(map[string]string)
+	}
+
+	path := filepath.Join(testPlugins.dir, name+".so")
+	args := []string{"build", "-buildmode=plugin", "-o", path}
+	if raceEnabled {
+		args = append(args, "-race")
+	}
+	cmd := exec.Command("go", append(args, "./testdata/plugins/"+name)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		testPlugins.errors[name] = fmt.Sprintf("could not build plugin %s: %v\n%s", name, err, out)
+		t.Skip(testPlugins.errors[name])
+	}
+	testPlugins.paths[name] = path
+	return path
+}
+
+// removeTestPlugins removes the plugins built by buildTestPlugin.
+func removeTestPlugins() {
+	if testPlugins.dir != "" {
+		os.RemoveAll(testPlugins.dir)
+	}
+}
+
+func TestGetPluginEventSourceTriesCandidateSymbolsInOrder(t *testing.T) {
+	path := buildTestPlugin(t, "source")
+	t.Setenv("SOURCE_PLUGIN_PATH", path)
+	t.Setenv("SOURCE_PLUGIN_SYMBOLS", "EventSource,Run,Source")
+	t.Setenv("FNRUN_TEST_PLUGIN_DATA", "from the plugin")
+
+	source, err := getPluginEventSource()
+	if err != nil {
+		t.Fatalf("expected the second candidate to be found, got %v", err)
+	}
+
+	var received string
+	err = source(context.Background(), invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		received = string(input.Data)
+		return &fnrun.Result{}, nil
+	}))
+	if err != nil || received != "from the plugin" {
+		t.Errorf("expected the Run source to invoke the function, got %q (%v)", received, err)
+	}
+}
+
+func TestGetPluginEventSourceUsesTheSingularSymbol(t *testing.T) {
+	path := buildTestPlugin(t, "source")
+	t.Setenv("SOURCE_PLUGIN_PATH", path)
+	t.Setenv("SOURCE_PLUGIN_SYMBOL", "Run")
+
+	if _, err := getPluginEventSource(); err != nil {
+		t.Errorf("expected SOURCE_PLUGIN_SYMBOL to still work, got %v", err)
+	}
+}
+
+func TestGetPluginEventSourceReportsMissingCandidates(t *testing.T) {
+	path := buildTestPlugin(t, "source")
+	t.Setenv("SOURCE_PLUGIN_PATH", path)
+	t.Setenv("SOURCE_PLUGIN_SYMBOLS", "EventSource,Source")
+
+	_, err := getPluginEventSource()
+	var loadErr *runner.PluginLoadError
+	if !errors.As(err, &loadErr) || loadErr.Path != path || loadErr.Symbol != "EventSource,Source" {
+		t.Errorf("expected a PluginLoadError naming the candidates, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// Plugin ABI check
+//
+// A plugin can only be loaded by a runner built with the same Go version and
+// the same versions of every package they share. When that is not the case,
+// plugin.Open fails with an error that names a single package and does not say
+// how to fix it. Before a plugin is opened, its embedded build information is
+// compared with that of the runner so that the operator is told exactly what
+// to rebuild.
+//
+// The build information is read from the .go.buildinfo section of the plugin.
+// Plugins for which it cannot be read (e.g., plugins on platforms that do not
+// use ELF) are not checked.
+
+var buildInfoMagic = []byte("\xff Go buildinf:")
+
+// errNoBuildInfo indicates that the build information of a plugin could not be
+// found.
+var errNoBuildInfo = errors.New("no Go build information found")
+
+type pluginBuildInfo struct {
+	goVersion string
+	deps      map[string]string
+}
+
+// checkPluginCompatibility returns an error describing every difference
+// between the Go version and dependency versions of the plugin at path and
+// those of the runner.
+func checkPluginCompatibility(path string) error {
+	info, err := readPluginBuildInfo(path)
+	if err != nil {
+		return nil
+	}
+
+	var problems []string
+	if info.goVersion != runtime.Version() {
+		problems = append(problems, fmt.Sprintf("plugin was built with %s but the runner was built with %s", info.goVersion, runtime.Version()))
+	}
+
+	if runnerInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range runnerInfo.Deps {
+			runnerVersion := dep.Version
+			if dep.Replace != nil {
+				runnerVersion = dep.Replace.Version
+			}
+			version, ok := info.deps[dep.Path]
+			if !ok || !isReleasedVersion(version) || !isReleasedVersion(runnerVersion) {
+				continue
+			}
+			if version != runnerVersion {
+				problems = append(problems, fmt.Sprintf("plugin uses %s %s but the runner uses %s", dep.Path, version, runnerVersion))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("Plugin %s is incompatible with the runner and must be rebuilt: %s", path, strings.Join(problems, "; "))
+}
+
+// isReleasedVersion reports whether version identifies a module version, as
+// opposed to a local replacement whose contents cannot be compared.
+func isReleasedVersion(version string) bool {
+	return version != "" && version != "(devel)"
+}
+
+func readPluginBuildInfo(path string) (*pluginBuildInfo, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	section := f.Section(".go.buildinfo")
+	if section == nil {
+		return nil, errNoBuildInfo
+	}
+	data, err := section.Data()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 32 || !bytes.HasPrefix(data, buildInfoMagic) {
+		return nil, errNoBuildInfo
+	}
+
+	ptrSize := int(data[14])
+	flags := data[15]
+	var goVersion, modInfo string
+
+	if flags&2 != 0 {
+		// Since Go 1.18, the strings are stored inline after the header.
+		var rest []byte
+		goVersion, rest = decodeBuildInfoString(data[32:])
+		modInfo, _ = decodeBuildInfoString(rest)
+	} else {
+		// Before Go 1.18, the header holds pointers to Go string headers.
+		var order binary.ByteOrder = binary.LittleEndian
+		if flags&1 != 0 {
+			order = binary.BigEndian
+		}
+		goVersion = readELFGoString(f, ptrSize, order, readELFPtr(data[16:], ptrSize, order))
+		modInfo = readELFGoString(f, ptrSize, order, readELFPtr(data[16+ptrSize:], ptrSize, order))
+	}
+
+	if goVersion == "" {
+		return nil, errNoBuildInfo
+	}
+
+	// The module information is wrapped in 16-byte sentinels.
+	if len(modInfo) >= 33 && modInfo[len(modInfo)-17] == '\n' {
+		modInfo = modInfo[16 : len(modInfo)-16]
+	}
+
+	return &pluginBuildInfo{goVersion: goVersion, deps: parseModInfoDeps(modInfo)}, nil
+}
+
+func decodeBuildInfoString(data []byte) (string, []byte) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return "", nil
+	}
+	return string(data[n : n+int(length)]), data[n+int(length):]
+}
+
+func readELFPtr(data []byte, ptrSize int, order binary.ByteOrder) uint64 {
+	switch {
+	case ptrSize == 4 && len(data) >= 4:
+		return uint64(order.Uint32(data))
+	case ptrSize == 8 && len(data) >= 8:
+		return order.Uint64(data)
+	default:
+		return 0
+	}
+}
+
+// readELFGoString reads the Go string whose header is at the virtual address
+// addr. It returns an empty string if the string cannot be read, which happens
+// when the address is only filled in by dynamic relocations.
+func readELFGoString(f *elf.File, ptrSize int, order binary.ByteOrder, addr uint64) string {
+	header := readELFMemory(f, addr, uint64(2*ptrSize))
+	if header == nil {
+		return ""
+	}
+
+	dataAddr := readELFPtr(header, ptrSize, order)
+	length := readELFPtr(header[ptrSize:], ptrSize, order)
+	return string(readELFMemory(f, dataAddr, length))
+}
+
+func readELFMemory(f *elf.File, addr uint64, size uint64) []byte {
+	if addr == 0 {
+		return nil
+	}
+
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || addr < prog.Vaddr || addr+size > prog.Vaddr+prog.Filesz {
+			continue
+		}
+		data := make([]byte, size)
+		if _, err := prog.ReadAt(data, int64(addr-prog.Vaddr)); err != nil {
+			return nil
+		}
+		return data
+	}
+
+	return nil
+}
+
+// parseModInfoDeps returns the version of each dependency listed in the module
+// information embedded by the Go linker. Replaced dependencies are reported
+// with the version of their replacement.
+func parseModInfoDeps(modInfo string) map[string]string {
+	deps := make(map[string]string)
+	var last string
+	for _, line := range strings.Split(modInfo, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		switch fields[0] {
+		case "dep":
+			last = fields[1]
+			deps[last] = fields[2]
+		case "=>":
+			if last != "" {
+				deps[last] = fields[2]
+			}
+		}
+	}
+	return deps
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestReadPluginBuildInfoOfTheTestBinary(t *testing.T) {
+	info, err := readPluginBuildInfo(os.Args[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.goVersion != runtime.Version() {
+		t.Errorf("expected Go version %s, got %s", runtime.Version(), info.goVersion)
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("expected the test binary to have build information")
+	}
+	for _, dep := range buildInfo.Deps {
+		want := dep.Version
+		if dep.Replace != nil {
+			want = dep.Replace.Version
+		}
+		if got := info.deps[dep.Path]; got != want {
+			t.Errorf("expected %s %s, got %q", dep.Path, want, got)
+		}
+	}
+
+	if err := checkPluginCompatibility(os.Args[0]); err != nil {
+		t.Errorf("expected the test binary to be compatible with itself, got %v", err)
+	}
+}
+
+func TestCheckPluginCompatibilityReportsGoVersionMismatches(t *testing.T) {
+	data, err := ioutil.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Build a copy of the test binary that claims to have been built by
+	// another Go version of the same length.
+	start := bytes.Index(data, buildInfoMagic)
+	if start < 0 {
+		t.Skip("the test binary has no build information")
+	}
+	offset := bytes.Index(data[start:], []byte(runtime.Version()))
+	if offset < 0 {
+		t.Fatal("expected the build information to contain the Go version")
+	}
+	other := []byte(runtime.Version())
+	if last := len(other) - 1; other[last] == '0' {
+		other[last] = '1'
+	} else {
+		other[last] = '0'
+	}
+	copy(data[start+offset:], other)
+	path := filepath.Join(t.TempDir(), "plugin.so")
+	if err := ioutil.WriteFile(path, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkPluginCompatibility(path)
+	if err == nil {
+		t.Fatal("expected the Go versions to be reported as incompatible")
+	}
+	for _, version := range []string{string(other), runtime.Version()} {
+		if !strings.Contains(err.Error(), version) {
+			t.Errorf("expected the error to name %s, got %v", version, err)
+		}
+	}
+}
+
+func TestCheckPluginCompatibilitySkipsFilesWithoutBuildInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin.so")
+	if err := ioutil.WriteFile(path, []byte("not an ELF file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkPluginCompatibility(path); err != nil {
+		t.Errorf("expected a plugin without build information not to be checked, got %v", err)
+	}
+}
+
+func TestParseModInfoDeps(t *testing.T) {
+	modInfo := strings.Join([]string{
+		"path\tgithub.com/example/plugin",
+		"mod\tgithub.com/example/plugin\t(devel)\t",
+		"dep\tgithub.com/tessellator/fnrun\tv0.2.0\th1:abc=",
+		"dep\tgithub.com/example/forked\tv1.0.0\t",
+		"=>\tgithub.com/example/fork\tv1.0.1\th1:def=",
+	}, "\n")
+
+	deps := parseModInfoDeps(modInfo)
+	if len(deps) != 2 || deps["github.com/tessellator/fnrun"] != "v0.2.0" || deps["github.com/example/forked"] != "v1.0.1" {
+		t.Errorf("expected the dependency versions with replacements applied, got %v", deps)
+	}
+}
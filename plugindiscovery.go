@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	pluginDiscoveryOCILabels = "oci-labels"
+
+	// pluginLabelPrefix is the prefix of the image labels that provide plugin
+	// settings.
+	pluginLabelPrefix = "io.fnrun.plugin."
+
+	defaultPluginDiscoveryURL = "http://169.254.169.254/v1/image/labels"
+)
+
+// -----------------------------------------------------------------------------
+// Plugin Discovery
+//
+// With PLUGIN_DISCOVERY=oci-labels, the plugin settings are read from the
+// labels of the container image before any other configuration is read, so
+// that an image that bakes in its plugins can describe them itself rather than
+// every manifest that runs it. The labels are requested from the metadata
+// endpoint at PLUGIN_DISCOVERY_URL, which must respond with either a JSON
+// object of labels or an OCI image configuration, whose config.Labels are
+// used.
+//
+// A label named io.fnrun.plugin.<name> sets the environment variable <name>,
+// upper-cased and with dots and dashes replaced by underscores, so that
+// io.fnrun.plugin.source-plugin-path sets SOURCE_PLUGIN_PATH. Only variables
+// whose names contain PLUGIN may be set, and a variable that is already set
+// takes precedence over the label. Failing to read the labels is fatal.
+
+type ociImageConfig struct {
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// discoverPlugins sets the plugin settings provided by the discovery method
+// named by PLUGIN_DISCOVERY.
+func discoverPlugins() error {
+	// env: PLUGIN_DISCOVERY string "" "Source of plugin settings that are not set in the environment: oci-labels reads io.fnrun.plugin.* image labels."
+	switch method := os.Getenv("PLUGIN_DISCOVERY"); method {
+	case "":
+		return nil
+	case pluginDiscoveryOCILabels:
+		// env: PLUGIN_DISCOVERY_URL string http://169.254.169.254/v1/image/labels "Metadata endpoint from which PLUGIN_DISCOVERY=oci-labels reads the labels of the container image."
+		url := getStringEnv("PLUGIN_DISCOVERY_URL", defaultPluginDiscoveryURL)
+		var labels map[string]string
+		err := connectWithBackoff(func() (err error) {
+			labels, err = readImageLabels(url)
+			return err
+		})
+		if err != nil {
+			return configErrorf("PLUGIN_DISCOVERY_URL", "could not read image labels from %s: %v", url, err)
+		}
+		return applyPluginLabels(labels)
+	default:
+		return configErrorf("PLUGIN_DISCOVERY", "Unknown PLUGIN_DISCOVERY %s", method)
+	}
+}
+
+// readImageLabels requests the labels of the container image from url.
+func readImageLabels(url string) (map[string]string, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var config ociImageConfig
+	if err := json.Unmarshal(body, &config); err == nil && config.Config.Labels != nil {
+		return config.Config.Labels, nil
+	}
+
+	var labels map[string]string
+	if err := json.Unmarshal(body, &labels); err != nil {
+		return nil, fmt.Errorf("the response is neither a JSON object of labels nor an image configuration: %v", err)
+	}
+	return labels, nil
+}
+
+// applyPluginLabels sets the environment variables named by the plugin labels
+// that are not already set.
+func applyPluginLabels(labels map[string]string) error {
+	for label, value := range labels {
+		if !strings.HasPrefix(label, pluginLabelPrefix) {
+			continue
+		}
+		name := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(label[len(pluginLabelPrefix):]))
+		if !strings.Contains(name, "PLUGIN") {
+			log.Printf("ignoring image label %s, which does not name a plugin setting", label)
+			continue
+		}
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+		log.Printf("set %s from image label %s", name, label)
+	}
+	return nil
+}
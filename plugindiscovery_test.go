@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// unsetEnv unsets the environment variables names for the duration of the
+// test, restoring them afterwards.
+func unsetEnv(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+// newMetadataServer starts a metadata endpoint that responds with body and
+// points plugin discovery at it.
+func newMetadataServer(t *testing.T, status int, body string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("PLUGIN_DISCOVERY", pluginDiscoveryOCILabels)
+	t.Setenv("PLUGIN_DISCOVERY_URL", server.URL)
+}
+
+func TestPluginDiscoverySetsPluginSettingsFromLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"labels", `{
+			"io.fnrun.plugin.source-plugin-path": "/plugins/source.so",
+			"io.fnrun.plugin.source.plugin.symbol": "Run",
+			"org.opencontainers.image.version": "1.2.3"
+		}`},
+		{"image configuration", `{"config": {"Labels": {
+			"io.fnrun.plugin.source-plugin-path": "/plugins/source.so",
+			"io.fnrun.plugin.source.plugin.symbol": "Run",
+			"org.opencontainers.image.version": "1.2.3"
+		}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t, "SOURCE_PLUGIN_PATH", "SOURCE_PLUGIN_SYMBOL")
+			newMetadataServer(t, http.StatusOK, tt.body)
+
+			if err := discoverPlugins(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if path := os.Getenv("SOURCE_PLUGIN_PATH"); path != "/plugins/source.so" {
+				t.Errorf("expected SOURCE_PLUGIN_PATH to be set from its label, got %q", path)
+			}
+			if symbol := os.Getenv("SOURCE_PLUGIN_SYMBOL"); symbol != "Run" {
+				t.Errorf("expected SOURCE_PLUGIN_SYMBOL to be set from its label, got %q", symbol)
+			}
+		})
+	}
+}
+
+func TestPluginDiscoveryPrefersTheEnvironment(t *testing.T) {
+	unsetEnv(t, "SOURCE_PLUGIN_PATH")
+	t.Setenv("SOURCE_PLUGIN_SYMBOL", "Explicit")
+	newMetadataServer(t, http.StatusOK, `{
+		"io.fnrun.plugin.source-plugin-path": "/plugins/source.so",
+		"io.fnrun.plugin.source-plugin-symbol": "Run"
+	}`)
+
+	if err := discoverPlugins(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if symbol := os.Getenv("SOURCE_PLUGIN_SYMBOL"); symbol != "Explicit" {
+		t.Errorf("expected the explicit SOURCE_PLUGIN_SYMBOL to be kept, got %q", symbol)
+	}
+	if path := os.Getenv("SOURCE_PLUGIN_PATH"); path != "/plugins/source.so" {
+		t.Errorf("expected SOURCE_PLUGIN_PATH to be set from its label, got %q", path)
+	}
+}
+
+func TestPluginDiscoveryIgnoresNonPluginSettings(t *testing.T) {
+	unsetEnv(t, "SOURCE_TYPE")
+	newMetadataServer(t, http.StatusOK, `{"io.fnrun.plugin.source-type": "http"}`)
+
+	if err := discoverPlugins(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := os.LookupEnv("SOURCE_TYPE"); ok {
+		t.Error("expected a label that does not name a plugin setting to be ignored")
+	}
+}
+
+func TestPluginDiscoveryFailsWhenTheLabelsCannotBeRead(t *testing.T) {
+	t.Setenv("CONNECT_MAX_RETRIES", "1")
+	t.Setenv("CONNECT_BACKOFF_MILLIS", "1")
+	newMetadataServer(t, http.StatusNotFound, "not found")
+
+	err := discoverPlugins()
+	var configErr *runner.ConfigError
+	if !errors.As(err, &configErr) || configErr.Name != "PLUGIN_DISCOVERY_URL" {
+		t.Errorf("expected a PLUGIN_DISCOVERY_URL config error, got %v", err)
+	}
+}
+
+func TestPluginDiscoveryMethods(t *testing.T) {
+	t.Setenv("PLUGIN_DISCOVERY", "")
+	if err := discoverPlugins(); err != nil {
+		t.Errorf("expected no discovery by default, got %v", err)
+	}
+
+	t.Setenv("PLUGIN_DISCOVERY", "consul")
+	err := discoverPlugins()
+	var configErr *runner.ConfigError
+	if !errors.As(err, &configErr) || configErr.Name != "PLUGIN_DISCOVERY" {
+		t.Errorf("expected a PLUGIN_DISCOVERY config error, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestPluginTimeoutAbandonsABlockedCall(t *testing.T) {
+	t.Setenv("PLUGIN_SYMBOL_TIMEOUT_MILLIS", "50")
+	release := make(chan struct{})
+	defer close(release)
+
+	start := time.Now()
+	err := callWithPluginTimeout(func() { <-release })
+	if !errors.Is(err, runner.ErrPluginTimeout) {
+		t.Errorf("expected ErrPluginTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the call to be abandoned after 50ms, took %v", elapsed)
+	}
+}
+
+func TestPluginTimeoutAllowsACallThatReturnsInTime(t *testing.T) {
+	t.Setenv("PLUGIN_SYMBOL_TIMEOUT_MILLIS", "1000")
+	called := false
+	if err := callWithPluginTimeout(func() { called = true }); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !called {
+		t.Error("expected the call to run")
+	}
+}
+
+func TestPluginTimeoutIsUnlimitedByDefault(t *testing.T) {
+	t.Setenv("PLUGIN_SYMBOL_TIMEOUT_MILLIS", "")
+	if err := callWithPluginTimeout(func() { time.Sleep(20 * time.Millisecond) }); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPluginTimeoutFiresForASlowInitFunction(t *testing.T) {
+	path := buildTestPlugin(t, "slowinit")
+	t.Setenv("PLUGIN_SYMBOL_TIMEOUT_MILLIS", "200")
+
+	start := time.Now()
+	_, err := lookupPluginSymbol(path, "Discard")
+	var loadErr *runner.PluginLoadError
+	if !errors.As(err, &loadErr) || !errors.Is(err, runner.ErrPluginTimeout) {
+		t.Errorf("expected a plugin load error for the timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the open to be abandoned after 200ms, took %v", elapsed)
+	}
+}
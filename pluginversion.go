@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"plugin"
+	"strconv"
+	"strings"
+)
+
+// pluginVersionSymbol is the symbol through which a plugin may report the
+// version of the plugin API that it was written for.
+const pluginVersionSymbol = "PluginVersion"
+
+// -----------------------------------------------------------------------------
+// Plugin Version Check
+//
+// A plugin may export a PluginVersion function that returns the version of the
+// plugin API it was written for as a semantic version, such as "1.2.0". When
+// REQUIRED_PLUGIN_VERSION is set, the version of each plugin that reports one
+// must satisfy it, so that a plugin written for an older or newer runner is
+// rejected when it is loaded rather than misbehaving later. Plugins that do not
+// report a version are not checked.
+//
+// The requirement is a comma-separated list of constraints that must all hold,
+// each an operator (=, >, >=, < or <=) followed by a version, for example
+// ">=1.0.0,<2.0.0". A version without an operator must match exactly.
+// Pre-release and build suffixes are ignored.
+
+// checkPluginVersion returns an error if the plugin p at path reports a
+// version that does not satisfy the requirement.
+func checkPluginVersion(path string, p *plugin.Plugin, requirement string) error {
+	sym, err := p.Lookup(pluginVersionSymbol)
+	if err != nil {
+		return nil
+	}
+
+	versionFunc, ok := sym.(func() string)
+	if !ok {
+		return fmt.Errorf("Symbol %s in %s must be a func() string", pluginVersionSymbol, path)
+	}
+
+	version := versionFunc()
+	satisfied, err := satisfiesVersion(version, requirement)
+	if err != nil {
+		return err
+	}
+	if !satisfied {
+		return fmt.Errorf("Plugin %s has version %s, which does not satisfy REQUIRED_PLUGIN_VERSION %s", path, version, requirement)
+	}
+	return nil
+}
+
+// satisfiesVersion reports whether version satisfies every constraint of the
+// requirement.
+func satisfiesVersion(version string, requirement string) (bool, error) {
+	v, err := parseSemver(version)
+	if err != nil {
+		return false, err
+	}
+
+	for _, constraint := range strings.Split(requirement, ",") {
+		constraint = strings.TrimSpace(constraint)
+		if constraint == "" {
+			continue
+		}
+
+		op := ""
+		for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(constraint, candidate) {
+				op = candidate
+				break
+			}
+		}
+		bound, err := parseSemver(strings.TrimSpace(constraint[len(op):]))
+		if err != nil {
+			return false, configErrorf("REQUIRED_PLUGIN_VERSION", "Invalid constraint %s in REQUIRED_PLUGIN_VERSION: %v", constraint, err)
+		}
+
+		cmp := compareSemver(v, bound)
+		var ok bool
+		switch op {
+		case "", "=":
+			ok = cmp == 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// parseSemver returns the major, minor and patch numbers of version. Missing
+// minor and patch numbers are zero.
+func parseSemver(version string) ([3]int, error) {
+	var parts [3]int
+
+	s := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return parts, fmt.Errorf("invalid version %q", version)
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, fmt.Errorf("invalid version %q", version)
+		}
+		parts[i] = n
+	}
+	return parts, nil
+}
+
+func compareSemver(a [3]int, b [3]int) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
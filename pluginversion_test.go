@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"plugin"
+	"strings"
+	"testing"
+
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestSatisfiesVersion(t *testing.T) {
+	tests := []struct {
+		version     string
+		requirement string
+		want        bool
+	}{
+		{"1.4.2", ">=1.0.0,<2.0.0", true},
+		{"2.0.0", ">=1.0.0,<2.0.0", false},
+		{"0.9.9", ">=1.0.0,<2.0.0", false},
+		{"1.0.0", ">=1.0.0", true},
+		{"1.0.0", ">1.0.0", false},
+		{"1.0.1", ">1.0", true},
+		{"1.2.0", "<=1.2", true},
+		{"1.2.0", "1.2.0", true},
+		{"1.2.1", "=1.2.0", false},
+		{"v1.2.0-beta+build", "1.2", true},
+		{"1.2.0", " >= 1.0.0 , ", true},
+	}
+
+	for _, tt := range tests {
+		got, err := satisfiesVersion(tt.version, tt.requirement)
+		if err != nil {
+			t.Errorf("unexpected error for %s against %s: %v", tt.version, tt.requirement, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("expected %s against %s to be %v, got %v", tt.version, tt.requirement, tt.want, got)
+		}
+	}
+}
+
+func TestSatisfiesVersionErrors(t *testing.T) {
+	if _, err := satisfiesVersion("one", ">=1.0.0"); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+	for _, requirement := range []string{">=one", "~1.0.0", "1.2.3.4"} {
+		_, err := satisfiesVersion("1.0.0", requirement)
+		var configErr *runner.ConfigError
+		if !errors.As(err, &configErr) || configErr.Name != "REQUIRED_PLUGIN_VERSION" {
+			t.Errorf("expected a REQUIRED_PLUGIN_VERSION config error for %q, got %v", requirement, err)
+		}
+	}
+}
+
+func TestCheckPluginVersion(t *testing.T) {
+	path := buildTestPlugin(t, "source")
+	p, err := plugin.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkPluginVersion(path, p, ">=1.0.0,<2.0.0"); err == nil || !strings.Contains(err.Error(), "version 2.0.0") {
+		t.Errorf("expected the plugin to be rejected, got %v", err)
+	}
+	if err := checkPluginVersion(path, p, ">=2.0.0,<3.0.0"); err != nil {
+		t.Errorf("expected the plugin to be accepted, got %v", err)
+	}
+}
+
+func TestOpenPluginRejectsIncompatibleVersions(t *testing.T) {
+	path := buildTestPlugin(t, "source")
+	t.Setenv("REQUIRED_PLUGIN_VERSION", ">=1.0.0,<2.0.0")
+
+	// The plugin is opened again with the requirement, and again without it
+	// after the test.
+	forgetPlugin := func() {
+		pluginsMu.Lock()
+		delete(plugins, path)
+		pluginsMu.Unlock()
+	}
+	forgetPlugin()
+	t.Cleanup(forgetPlugin)
+
+	_, err := openPlugin(path)
+	var loadErr *runner.PluginLoadError
+	if !errors.As(err, &loadErr) || loadErr.Symbol != pluginVersionSymbol {
+		t.Errorf("expected a PluginLoadError for %s, got %v", pluginVersionSymbol, err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Concurrent pollers
+//
+// A source that receives events by polling (e.g., an SQS source) is limited by
+// the latency of each poll. When SOURCE_CONCURRENCY is greater than one, that
+// many copies of the source are run at the same time, sharing the invoker and
+// therefore the invoker pool. Every copy receives a context derived from the
+// source context, so all of them stop on shutdown. If any copy returns an
+// error, the others are cancelled and the first error is returned.
+//
+// Sources that bind a resource (e.g., the HTTP source, which listens on a
+// fixed address) cannot be run concurrently.
+
+func newConcurrentSource(source eventSource, concurrency int) eventSource {
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		var once sync.Once
+		var firstErr error
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := source(ctx, invoker); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}()
+		}
+		wg.Wait()
+
+		return firstErr
+	}
+}
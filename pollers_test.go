@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// pollingSource returns a source that takes pollLatency to receive each event
+// and invokes the invoker with it, until its context is cancelled.
+func pollingSource(pollLatency time.Duration) eventSource {
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		for {
+			select {
+			case <-time.After(pollLatency):
+			case <-ctx.Done():
+				return nil
+			}
+			invoker.Invoke(ctx, &fnrun.Input{})
+		}
+	}
+}
+
+// pollerThroughput runs a polling source with the given concurrency for the
+// duration and returns the number of invocations.
+func pollerThroughput(t *testing.T, concurrency int, duration time.Duration) int64 {
+	t.Helper()
+	var invocations int64
+	counting := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		atomic.AddInt64(&invocations, 1)
+		return &fnrun.Result{}, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	if err := newConcurrentSource(pollingSource(20*time.Millisecond), concurrency)(ctx, counting); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return atomic.LoadInt64(&invocations)
+}
+
+func TestConcurrentPollersMultiplyThroughput(t *testing.T) {
+	one := pollerThroughput(t, 1, 500*time.Millisecond)
+	two := pollerThroughput(t, 2, 500*time.Millisecond)
+
+	if one == 0 {
+		t.Fatal("expected the single poller to invoke the function")
+	}
+	if ratio := float64(two) / float64(one); ratio < 1.6 || ratio > 2.4 {
+		t.Errorf("expected two pollers to make about twice the invocations of one, got %d and %d", two, one)
+	}
+}
+
+func TestConcurrentPollersStopOnTheFirstError(t *testing.T) {
+	errPoll := errors.New("poll failed")
+	var started int32
+	source := func(ctx context.Context, invoker fnrun.Invoker) error {
+		if atomic.AddInt32(&started, 1) == 1 {
+			return errPoll
+		}
+		<-ctx.Done()
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- newConcurrentSource(source, 3)(context.Background(), nil) }()
+
+	select {
+	case err := <-done:
+		if err != errPoll {
+			t.Errorf("expected the error of the failed poller, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the other pollers to be cancelled after an error")
+	}
+	if got := atomic.LoadInt32(&started); got != 3 {
+		t.Errorf("expected 3 pollers to be started, got %d", got)
+	}
+}
@@ -0,0 +1,664 @@
+package main
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/tessellator/executil"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// errPoolClosed is returned when an invocation is attempted on a closed pool.
+var errPoolClosed = errors.New("invoker pool is closed")
+
+var (
+	poolWaitDuration = newHistogram(
+		"fnrunner_pool_wait_duration_seconds",
+		"Time from the admission of an invocation to the acquisition of a pool slot, including any wait in the concurrency limiter.",
+		defaultDurationBuckets,
+	)
+	execDuration = newHistogram(
+		"fnrunner_exec_duration_seconds",
+		"Time from the acquisition of a pool slot to the return of the result.",
+		defaultDurationBuckets,
+	)
+)
+
+type queuedTimeKey struct{}
+
+// withQueuedTime returns a context that records that an invocation spent d
+// waiting for admission before it reached the pool, such as in the concurrency
+// limiter, so that the pool includes it in the wait time of the invocation.
+func withQueuedTime(ctx context.Context, d time.Duration) context.Context {
+	queued := int64(d)
+	return context.WithValue(ctx, queuedTimeKey{}, &queued)
+}
+
+// takeQueuedTime returns the time recorded by withQueuedTime and resets it, so
+// that it is counted only once if the input is invoked again, such as by a
+// retry.
+func takeQueuedTime(ctx context.Context) time.Duration {
+	queued, ok := ctx.Value(queuedTimeKey{}).(*int64)
+	if !ok {
+		return 0
+	}
+	return time.Duration(atomic.SwapInt64(queued, 0))
+}
+
+// priorityHigh is the value of the priority metadata of high-priority
+// invocations.
+const priorityHigh = "high"
+
+// -----------------------------------------------------------------------------
+// Command invoker factory
+//
+// This factory behaves like fnrun.NewCmdInvokerFactory, but it keeps track of
+// the processes it starts so that they can be terminated when the pool is
+// closed. Each process has a watcher goroutine that reaps it when it exits,
+// including when fnrun kills it after a failed invocation.
+
+type trackedProcess struct {
+	cmd    *exec.Cmd
+	exited chan struct{}
+	owner  *managedInvoker
+}
+
+type cmdInvokerFactory struct {
+	cmd       *exec.Cmd
+	killAfter time.Duration
+	affinity  *cpuAffinity
+	mu        sync.Mutex
+	processes map[*trackedProcess]struct{}
+	closed    bool
+}
+
+func newCmdInvokerFactory(cmd *exec.Cmd, killAfter time.Duration, affinity *cpuAffinity) *cmdInvokerFactory {
+	return &cmdInvokerFactory{
+		cmd:       cmd,
+		killAfter: killAfter,
+		affinity:  affinity,
+		processes: make(map[*trackedProcess]struct{}),
+	}
+}
+
+// clone returns a new factory that starts the same command.
+func (factory *cmdInvokerFactory) clone() *cmdInvokerFactory {
+	return newCmdInvokerFactory(factory.cmd, factory.killAfter, factory.affinity)
+}
+
+func (factory *cmdInvokerFactory) NewInvoker() (fnrun.Invoker, error) {
+	mi := &managedInvoker{factory: factory, lastUsed: time.Now()}
+	invoker, process, err := factory.start(mi)
+	if err != nil {
+		return nil, err
+	}
+
+	mi.invoker, mi.process = invoker, process
+	return mi, nil
+}
+
+// start starts a new function process for owner and returns an invoker for it.
+func (factory *cmdInvokerFactory) start(owner *managedInvoker) (fnrun.Invoker, *trackedProcess, error) {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+
+	if factory.closed {
+		return nil, nil, errPoolClosed
+	}
+
+	cmd := executil.CloneCmd(factory.cmd)
+	if factory.affinity != nil {
+		cpu := cpuAffinityEnvName + "=" + strconv.Itoa(factory.affinity.nextCPU())
+		cmd.Env = append(append([]string(nil), cmd.Env...), cpu)
+	}
+	invoker, err := fnrun.NewCmdInvoker(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	process := &trackedProcess{cmd: cmd, exited: make(chan struct{}), owner: owner}
+	factory.processes[process] = struct{}{}
+	go factory.watch(process)
+
+	return invoker, process, nil
+}
+
+// runningProcesses returns the processes that have not yet exited.
+func (factory *cmdInvokerFactory) runningProcesses() []*trackedProcess {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+
+	processes := make([]*trackedProcess, 0, len(factory.processes))
+	for process := range factory.processes {
+		processes = append(processes, process)
+	}
+	return processes
+}
+
+// watch waits for the process to exit and stops tracking it. Process.Wait is
+// used rather than Cmd.Wait so that the invoker's pipes are not closed while
+// it may still be reading from them.
+func (factory *cmdInvokerFactory) watch(process *trackedProcess) {
+	process.cmd.Process.Wait()
+	close(process.exited)
+
+	factory.mu.Lock()
+	delete(factory.processes, process)
+	factory.mu.Unlock()
+}
+
+// close prevents new processes from being started and terminates all running
+// processes. It waits up to timeout for the processes to exit.
+func (factory *cmdInvokerFactory) close(timeout time.Duration) {
+	factory.mu.Lock()
+	factory.closed = true
+	factory.mu.Unlock()
+	processes := factory.runningProcesses()
+
+	var wg sync.WaitGroup
+	for _, process := range processes {
+		wg.Add(1)
+		go func(process *trackedProcess) {
+			defer wg.Done()
+			factory.terminate(process)
+		}(process)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// terminate sends SIGTERM to the process. If the process has not exited after
+// killAfter, it is sent SIGKILL.
+func (factory *cmdInvokerFactory) terminate(process *trackedProcess) {
+	if err := process.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		process.cmd.Process.Kill()
+	}
+
+	select {
+	case <-process.exited:
+	case <-time.After(factory.killAfter):
+		process.cmd.Process.Kill()
+		<-process.exited
+	}
+}
+
+// managedInvoker is the invoker returned by cmdInvokerFactory. Its process can
+// be recycled, which replaces it with a newly started process so that the pool
+// never sees the invoker fail. A process is never recycled mid-invocation: an
+// idle process is replaced as soon as it is marked for recycling, and a busy
+// one as soon as its current invocation completes. While a replacement is
+// pending, no invocation is dispatched to the old process.
+//
+// An idle process can also be stopped without a replacement, in which case a
+// new process is started when the invoker is next used.
+//
+// Each result carries the PID of the process that produced it in its env.
+type managedInvoker struct {
+	factory   *cmdInvokerFactory
+	mu        sync.Mutex
+	invoker   fnrun.Invoker
+	process   *trackedProcess
+	busy      bool
+	recycling bool
+	lastUsed  time.Time
+}
+
+// recycle marks process for recycling if it is still the invoker's process. It
+// reports whether the process was newly marked.
+func (mi *managedInvoker) recycle(process *trackedProcess) bool {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	if mi.process != process || mi.recycling {
+		return false
+	}
+
+	mi.recycling = true
+	if !mi.busy {
+		if err := mi.replaceProcess(); err != nil {
+			log.Printf("could not replace function process %d: %v", process.cmd.Process.Pid, err)
+		}
+	}
+	return true
+}
+
+// idleSince returns the time at which the invoker's process finished its last
+// invocation, and false if the process is busy, being recycled or stopped.
+func (mi *managedInvoker) idleSince(process *trackedProcess) (time.Time, bool) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	if mi.process != process || mi.busy || mi.recycling {
+		return time.Time{}, false
+	}
+	return mi.lastUsed, true
+}
+
+// stopIfIdle terminates process if it is still the invoker's process and it
+// has been idle since before cutoff. It reports whether the process was
+// stopped.
+func (mi *managedInvoker) stopIfIdle(process *trackedProcess, cutoff time.Time) bool {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	if mi.process != process || mi.busy || mi.recycling || !mi.lastUsed.Before(cutoff) {
+		return false
+	}
+
+	go mi.factory.terminate(process)
+	mi.invoker, mi.process = nil, nil
+	return true
+}
+
+// replaceProcess starts a new process and terminates the old one, if any. It
+// must be called with mu held. If the new process cannot be started, the
+// invoker stays marked for recycling.
+func (mi *managedInvoker) replaceProcess() error {
+	invoker, process, err := mi.factory.start(mi)
+	if err != nil {
+		return err
+	}
+
+	if mi.process != nil {
+		go mi.factory.terminate(mi.process)
+	}
+	mi.invoker, mi.process = invoker, process
+	mi.recycling = false
+	return nil
+}
+
+func (mi *managedInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	mi.mu.Lock()
+	if mi.recycling || mi.process == nil {
+		if err := mi.replaceProcess(); err != nil {
+			mi.mu.Unlock()
+			return nil, fmt.Errorf("%w: %v", runner.ErrInvokerStarting, err)
+		}
+	}
+	mi.busy = true
+	invoker := mi.invoker
+	pid := mi.process.cmd.Process.Pid
+	mi.mu.Unlock()
+
+	result, err := invoker.Invoke(ctx, input)
+	if result != nil {
+		result = withResultEnv(result, map[string]string{invokerPIDKey: strconv.Itoa(pid)})
+	}
+
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	mi.busy = false
+	mi.lastUsed = time.Now()
+
+	// A failed invoker is discarded by the pool, so there is no need to replace
+	// its process.
+	if mi.recycling && err == nil {
+		if err := mi.replaceProcess(); err != nil {
+			log.Printf("could not replace function process %d: %v", mi.process.cmd.Process.Pid, err)
+		}
+	}
+
+	return result, err
+}
+
+// -----------------------------------------------------------------------------
+// Invoker pool
+//
+// invokerPool wraps an fnrun.InvokerPool so that it can be closed. Closing the
+// pool waits up to POOL_CLOSE_TIMEOUT_MILLIS for the invocations in flight to
+// complete before the function processes are terminated.
+//
+// The wrapper also limits the number of concurrent invocations to the size of
+// the pool. A caller that cannot get a slot within the configured wait duration
+// receives fnrun.ErrAvailabilityTimeout. Each wait is randomly lengthened or
+// shortened by up to the configured jitter so that callers that start waiting
+// at the same time do not all time out (and retry) at the same time. If an
+// event TTL is configured, a caller that waits longer than the TTL receives
+// runner.ErrEventExpired instead.
+//
+// If a priority key is configured, an invocation whose metadata has the value
+// high for that key may also take one of the priority slots, which are served
+// by invokers in addition to the size of the pool. High-priority invocations
+// therefore start immediately while there is a priority slot free, rather than
+// waiting behind the invocations already queued for the pool.
+
+type invokerPool struct {
+	pool          *fnrun.InvokerPool
+	config        fnrun.InvokerPoolConfig
+	factory       fnrun.InvokerFactory
+	slots         chan struct{}
+	priorityKey   string
+	prioritySlots chan struct{}
+	maxWait       time.Duration
+	jitter        time.Duration
+	eventTTL      time.Duration
+	closeTimeout  time.Duration
+	waiting       int64
+	inFlight      *sync.WaitGroup
+	mu            sync.RWMutex
+	rebuildMu     sync.Mutex
+	closed        bool
+}
+
+// jitterRands holds random number generators for computing wait jitter. Each
+// generator is seeded from crypto/rand so that concurrent callers do not
+// produce correlated values.
+var jitterRands = sync.Pool{
+	New: func() interface{} {
+		var seed [8]byte
+		cryptorand.Read(seed[:])
+		return rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:]))))
+	},
+}
+
+func (p *invokerPool) waitDuration() time.Duration {
+	if p.jitter <= 0 {
+		return p.maxWait
+	}
+
+	r := jitterRands.Get().(*rand.Rand)
+	offset := time.Duration(r.Int63n(int64(2*p.jitter)+1)) - p.jitter
+	jitterRands.Put(r)
+
+	if wait := p.maxWait + offset; wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (p *invokerPool) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	pool, release, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	invokeStart := time.Now()
+	result, err := pool.Invoke(ctx, input)
+	execDuration.observe(time.Since(invokeStart).Seconds())
+	switch {
+	case err == nil:
+	case err == fnrun.ErrAvailabilityTimeout:
+		err = &runner.PoolExhaustedError{Waited: time.Since(invokeStart), Err: err}
+	default:
+		err = &runner.InvocationError{Duration: time.Since(invokeStart), Err: err}
+	}
+
+	return result, err
+}
+
+// acquire waits for a slot of the pool and returns the underlying pool on
+// which to invoke the function, along with a function that the caller must call
+// when the invocation completes to release the slot. The read lock of the pool
+// is held only while waiting for the slot, so that Close and rebuild are not
+// held up by invocations in progress; they wait for them through inFlight
+// instead.
+func (p *invokerPool) acquire(ctx context.Context) (*fnrun.InvokerPool, func(), error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return nil, nil, errPoolClosed
+	}
+
+	timer := time.NewTimer(p.waitDuration())
+	defer timer.Stop()
+
+	var expired <-chan time.Time
+	if p.eventTTL > 0 {
+		ttlTimer := time.NewTimer(p.eventTTL)
+		defer ttlTimer.Stop()
+		expired = ttlTimer.C
+	}
+
+	// A nil channel is never ready, so only high-priority invocations can
+	// take a priority slot.
+	var prioritySlots chan struct{}
+	if isHighPriority(ctx, p.priorityKey) {
+		prioritySlots = p.prioritySlots
+	}
+
+	// The slot is released to the channel it was taken from, which rebuild
+	// may replace while the invocation is in progress.
+	start := time.Now()
+	var slot chan struct{}
+	atomic.AddInt64(&p.waiting, 1)
+	select {
+	case p.slots <- struct{}{}:
+		slot = p.slots
+	case prioritySlots <- struct{}{}:
+		slot = prioritySlots
+	case <-expired:
+		atomic.AddInt64(&p.waiting, -1)
+		return nil, nil, &runner.PoolExhaustedError{Waited: time.Since(start), Err: runner.ErrEventExpired}
+	case <-timer.C:
+		atomic.AddInt64(&p.waiting, -1)
+		return nil, nil, &runner.PoolExhaustedError{Waited: time.Since(start), Err: fnrun.ErrAvailabilityTimeout}
+	case <-ctx.Done():
+		atomic.AddInt64(&p.waiting, -1)
+		return nil, nil, ctx.Err()
+	}
+	atomic.AddInt64(&p.waiting, -1)
+	poolWaitDuration.observe((takeQueuedTime(ctx) + time.Since(start)).Seconds())
+
+	inFlight := p.inFlight
+	inFlight.Add(1)
+	release := func() {
+		<-slot
+		inFlight.Done()
+	}
+	return p.pool, release, nil
+}
+
+// isHighPriority reports whether the metadata of ctx marks the invocation as
+// high priority under priorityKey.
+func isHighPriority(ctx context.Context, priorityKey string) bool {
+	if priorityKey == "" {
+		return false
+	}
+	metadata, _ := runner.MetadataFromContext(ctx)
+	return metadata[priorityKey] == priorityHigh
+}
+
+// queueDepth returns the number of invocations waiting for an invoker.
+func (p *invokerPool) queueDepth() int {
+	return int(atomic.LoadInt64(&p.waiting))
+}
+
+// utilization returns the number of invocations in progress and the number
+// that the pool can run at once.
+func (p *invokerPool) utilization() (active int, capacity int) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.slots), cap(p.slots)
+}
+
+// capacity returns the number of invokers of the pool and the number of
+// additional invokers reserved for high-priority inputs.
+func (p *invokerPool) capacity() (slots int, prioritySlots int) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return cap(p.slots), cap(p.prioritySlots)
+}
+
+// utilizationReporter is implemented by invokers that can report how many of
+// their invokers are in use.
+type utilizationReporter interface {
+	utilization() (active int, capacity int)
+}
+
+// totalUtilization returns the utilization reported by invoker, or zero if it
+// does not report one.
+func totalUtilization(invoker interface{}) (active int, capacity int) {
+	if reporter, ok := invoker.(utilizationReporter); ok {
+		return reporter.utilization()
+	}
+	return 0, 0
+}
+
+// poolSettings are the settings of an invoker pool that can be changed while
+// the pool is running.
+type poolSettings struct {
+	maxCount int
+	maxWait  time.Duration
+	maxExec  time.Duration
+}
+
+// settings returns the current settings of the pool.
+func (p *invokerPool) settings() poolSettings {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return poolSettings{
+		maxCount: cap(p.slots),
+		maxWait:  p.maxWait,
+		maxExec:  p.config.MaxRunnableTime,
+	}
+}
+
+// reload replaces the function processes of the pool with newly started ones,
+// which is used to pick up a new function binary. The new processes are started
+// before the old ones are retired, and in-flight invocations are allowed up to
+// the close timeout to complete on the old processes. Pools that do not run a
+// command are left unchanged.
+func (p *invokerPool) reload() error {
+	p.rebuildMu.Lock()
+	defer p.rebuildMu.Unlock()
+
+	if _, ok := p.factory.(*cmdInvokerFactory); !ok {
+		return nil
+	}
+	return p.rebuild(p.settings())
+}
+
+// reconfigure applies new settings to the pool. All of the settings take
+// effect together: invocations that start after reconfigure returns use the
+// new settings, and invocations already in flight complete with the old ones.
+// Function processes are replaced as they are by reload.
+func (p *invokerPool) reconfigure(settings poolSettings) error {
+	p.rebuildMu.Lock()
+	defer p.rebuildMu.Unlock()
+
+	return p.rebuild(settings)
+}
+
+// rebuild replaces the underlying fnrun.InvokerPool with one that uses the
+// given settings. It must be called with rebuildMu held.
+func (p *invokerPool) rebuild(settings poolSettings) error {
+	factory := p.factory
+	oldFactory, isCmd := factory.(*cmdInvokerFactory)
+	var newFactory *cmdInvokerFactory
+	if isCmd {
+		newFactory = oldFactory.clone()
+		factory = newFactory
+	}
+
+	config := p.config
+	config.InvokerFactory = factory
+	config.MaxInvokerCount = settings.maxCount + cap(p.prioritySlots)
+	config.MaxWaitDuration = settings.maxWait + p.jitter
+	config.MaxRunnableTime = settings.maxExec
+	pool, err := fnrun.NewInvokerPool(config)
+	if err != nil {
+		if isCmd {
+			newFactory.close(p.closeTimeout)
+		}
+		return err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		if isCmd {
+			newFactory.close(p.closeTimeout)
+		}
+		return errPoolClosed
+	}
+	inFlight := p.inFlight
+	p.pool, p.config, p.factory = pool, config, factory
+	if cap(p.slots) != settings.maxCount {
+		p.slots = make(chan struct{}, settings.maxCount)
+	}
+	p.maxWait = settings.maxWait
+	p.inFlight = &sync.WaitGroup{}
+	p.mu.Unlock()
+
+	// Invocations already in flight complete on the old processes before they
+	// are retired.
+	waitWithTimeout(inFlight, p.closeTimeout)
+	if isCmd {
+		oldFactory.close(p.closeTimeout)
+	}
+	return nil
+}
+
+// functionProcesses returns the running function processes of the pool.
+func (p *invokerPool) functionProcesses() []*trackedProcess {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if factory, ok := p.factory.(*cmdInvokerFactory); ok {
+		return factory.runningProcesses()
+	}
+	return nil
+}
+
+// Close stops the pool from accepting new invocations, waits up to the close
+// timeout for the invocations in flight to complete and terminates any
+// function processes. It is safe to call Close more than once.
+func (p *invokerPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	inFlight, factory := p.inFlight, p.factory
+	p.mu.Unlock()
+
+	if !waitWithTimeout(inFlight, p.closeTimeout) {
+		log.Printf("invocations did not complete within %v of closing the pool; terminating their processes", p.closeTimeout)
+	}
+	if factory, ok := factory.(*cmdInvokerFactory); ok {
+		factory.close(p.closeTimeout)
+	}
+
+	return nil
+}
+
+// waitWithTimeout waits up to timeout for wg and reports whether it completed.
+func waitWithTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
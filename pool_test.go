@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func newTestCmdPool(t *testing.T, count int, closeTimeout time.Duration, cmd func() *cmdInvokerFactory) (*invokerPool, *cmdInvokerFactory) {
+	t.Helper()
+	t.Setenv("POOL_CLOSE_TIMEOUT_MILLIS", strconv.Itoa(int(closeTimeout/time.Millisecond)))
+	factory := cmd()
+	pool, err := newSizedInvokerPool(factory, "", count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool, factory
+}
+
+func TestPoolCloseTerminatesFunctionProcesses(t *testing.T) {
+	pool, factory := newTestCmdPool(t, 2, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo"), time.Second, nil)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	processes := factory.runningProcesses()
+	if len(processes) == 0 {
+		t.Fatal("expected function processes to be running")
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, process := range processes {
+		select {
+		case <-process.exited:
+		case <-time.After(time.Second):
+			t.Errorf("process %d did not exit", process.cmd.Process.Pid)
+		}
+	}
+	if running := factory.runningProcesses(); len(running) != 0 {
+		t.Errorf("expected no running processes, got %d", len(running))
+	}
+
+	if _, err := pool.Invoke(context.Background(), &fnrun.Input{}); err != errPoolClosed {
+		t.Errorf("expected errPoolClosed, got %v", err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Errorf("expected a second Close to succeed, got %v", err)
+	}
+}
+
+func TestPoolCloseWaitsForInFlightInvocations(t *testing.T) {
+	pool, _ := newTestCmdPool(t, 1, 5*time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo", "FNRUN_TEST_SLEEP_MS=200"), time.Second, nil)
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := pool.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")})
+		errs <- err
+	}()
+	waitForBusyPool(t, pool)
+
+	pool.Close()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("expected the in-flight invocation to complete, got %v", err)
+		}
+	default:
+		t.Error("expected Close to wait for the in-flight invocation")
+	}
+}
+
+func TestPoolCloseIsBoundedByCloseTimeout(t *testing.T) {
+	pool, _ := newTestCmdPool(t, 1, 50*time.Millisecond, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo", "FNRUN_TEST_SLEEP_MS=5000"), 100*time.Millisecond, nil)
+	})
+
+	go pool.Invoke(context.Background(), &fnrun.Input{})
+	waitForBusyPool(t, pool)
+
+	start := time.Now()
+	pool.Close()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Close took %v", elapsed)
+	}
+}
+
+func TestPoolInvokeDoesNotBlockRebuild(t *testing.T) {
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		time.Sleep(100 * time.Millisecond)
+		return &fnrun.Result{}, nil
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	go pool.Invoke(context.Background(), &fnrun.Input{})
+	waitForBusyPool(t, pool)
+
+	settings := pool.settings()
+	settings.maxCount = 2
+	start := time.Now()
+	if err := pool.reconfigure(settings); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, capacity := pool.utilization(); capacity != 2 {
+		t.Errorf("expected a capacity of 2, got %d", capacity)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected reconfigure to wait for the in-flight invocation, took %v", elapsed)
+	}
+}
+
+func TestPoolWaitTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	t.Setenv("MAX_WAIT_MILLIS", "20")
+	t.Setenv("WAIT_JITTER_MILLIS", "0")
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		<-release
+		return &fnrun.Result{}, nil
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go pool.Invoke(context.Background(), &fnrun.Input{})
+	waitForBusyPool(t, pool)
+
+	_, err = pool.Invoke(context.Background(), &fnrun.Input{})
+	if !isRetryableInvocationError(err) {
+		t.Errorf("expected a PoolExhaustedError, got %v", err)
+	}
+}
+
+func waitForBusyPool(t *testing.T, pool *invokerPool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if active, _ := pool.utilization(); active > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("expected an invocation to be in progress")
+}
+
+func TestTerminateKillsProcessesThatIgnoreSIGTERM(t *testing.T) {
+	killAfter := 100 * time.Millisecond
+	factory := newCmdInvokerFactory(testFunctionCmd("echo", "FNRUN_TEST_IGNORE_SIGTERM=1"), killAfter, nil)
+	invoker, err := factory.NewInvoker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first invocation ensures that the process is ignoring SIGTERM.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := invoker.Invoke(ctx, &fnrun.Input{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	processes := factory.runningProcesses()
+	if len(processes) != 1 {
+		t.Fatalf("expected one running process, got %d", len(processes))
+	}
+
+	start := time.Now()
+	factory.terminate(processes[0])
+	elapsed := time.Since(start)
+	select {
+	case <-processes[0].exited:
+	default:
+		t.Fatal("expected the process to have exited")
+	}
+	if elapsed < killAfter || elapsed > 2*time.Second {
+		t.Errorf("expected the process to be killed after %v, exited after %v", killAfter, elapsed)
+	}
+}
+
+func TestPoolWaitDurationIsJittered(t *testing.T) {
+	p := &invokerPool{maxWait: 100 * time.Millisecond, jitter: 20 * time.Millisecond}
+
+	min, max := time.Hour, time.Duration(0)
+	for i := 0; i < 1000; i++ {
+		wait := p.waitDuration()
+		if wait < 80*time.Millisecond || wait > 120*time.Millisecond {
+			t.Fatalf("expected the wait to be within the jitter, got %v", wait)
+		}
+		if wait < min {
+			min = wait
+		}
+		if wait > max {
+			max = wait
+		}
+	}
+	if max-min < 20*time.Millisecond {
+		t.Errorf("expected the waits to be spread across the jitter, got %v to %v", min, max)
+	}
+
+	p.jitter = 0
+	if wait := p.waitDuration(); wait != p.maxWait {
+		t.Errorf("expected no jitter, got %v", wait)
+	}
+}
+
+func TestPoolWaitTimeoutsAreSpreadAcrossTime(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	t.Setenv("MAX_WAIT_MILLIS", "100")
+	t.Setenv("WAIT_JITTER_MILLIS", "50")
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		<-release
+		return &fnrun.Result{}, nil
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go pool.Invoke(context.Background(), &fnrun.Input{})
+	waitForBusyPool(t, pool)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var waits []time.Duration
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := pool.Invoke(context.Background(), &fnrun.Input{})
+			var exhausted *runner.PoolExhaustedError
+			if !errors.As(err, &exhausted) {
+				t.Errorf("expected a PoolExhaustedError, got %v", err)
+				return
+			}
+			mu.Lock()
+			waits = append(waits, exhausted.Waited)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(waits) == 0 {
+		t.Fatal("expected the invocations to time out")
+	}
+	min, max := waits[0], waits[0]
+	for _, wait := range waits {
+		if wait < min {
+			min = wait
+		}
+		if wait > max {
+			max = wait
+		}
+	}
+	if max-min < 30*time.Millisecond {
+		t.Errorf("expected the timeouts to be spread across time, got %v to %v", min, max)
+	}
+}
+
+func TestPoolEventTTLExpiresWaitingInputs(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	t.Setenv("MAX_WAIT_MILLIS", "5000")
+	t.Setenv("WAIT_JITTER_MILLIS", "0")
+	t.Setenv("QUEUE_EVENT_TTL_MILLIS", "30")
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		<-release
+		return &fnrun.Result{}, nil
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go pool.Invoke(context.Background(), &fnrun.Input{})
+	waitForBusyPool(t, pool)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	start := time.Now()
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = pool.Invoke(context.Background(), &fnrun.Input{})
+		}(i)
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected the inputs to expire after the TTL rather than MAX_WAIT_MILLIS, took %v", elapsed)
+	}
+	for i, err := range errs {
+		var exhausted *runner.PoolExhaustedError
+		if !errors.As(err, &exhausted) || !errors.Is(err, runner.ErrEventExpired) {
+			t.Errorf("input %d: expected ErrEventExpired, got %v", i, err)
+			continue
+		}
+		if exhausted.Waited < 30*time.Millisecond {
+			t.Errorf("input %d: expected to wait for the TTL, waited %v", i, exhausted.Waited)
+		}
+	}
+}
+
+func TestPoolEventTTLDoesNotExpireInputsThatGetAnInvoker(t *testing.T) {
+	t.Setenv("QUEUE_EVENT_TTL_MILLIS", "30")
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		time.Sleep(60 * time.Millisecond)
+		return &fnrun.Result{}, nil
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pool.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+		t.Errorf("expected an invocation that outlives the TTL to succeed, got %v", err)
+	}
+}
+
+func TestRecyclingABusyProcessWaitsForItsInvocation(t *testing.T) {
+	pool, factory := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo", "FNRUN_TEST_SLEEP_MS=300"), time.Second, nil)
+	})
+	defer pool.Close()
+	pid := invokePID(t, pool)
+
+	type invocation struct {
+		result *fnrun.Result
+		err    error
+	}
+	done := make(chan invocation, 1)
+	go func() {
+		result, err := pool.Invoke(context.Background(), &fnrun.Input{Data: []byte("in flight")})
+		done <- invocation{result, err}
+	}()
+	waitForBusyPool(t, pool)
+
+	factory.mu.Lock()
+	var process *trackedProcess
+	for p := range factory.processes {
+		process = p
+	}
+	factory.mu.Unlock()
+	if !process.owner.recycle(process) {
+		t.Fatal("expected the busy process to be marked for recycling")
+	}
+
+	select {
+	case <-process.exited:
+		t.Fatal("expected the busy process to keep running until its invocation completes")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	inFlight := <-done
+	if inFlight.err != nil {
+		t.Fatalf("expected the in-flight invocation to complete, got %v", inFlight.err)
+	}
+	if string(inFlight.result.Data) != "in flight" || inFlight.result.Env[invokerPIDKey] != pid {
+		t.Errorf("expected process %s to complete the invocation, got %q from process %s", pid, inFlight.result.Data, inFlight.result.Env[invokerPIDKey])
+	}
+
+	select {
+	case <-process.exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the recycled process to be terminated after its invocation")
+	}
+	if replacement := invokePID(t, pool); replacement == pid {
+		t.Errorf("expected process %s to be replaced", pid)
+	}
+}
+
+func withPriority(priority string) context.Context {
+	return runner.WithMetadata(context.Background(), map[string]string{"x-priority": priority})
+}
+
+func TestPoolDispatchesHighPriorityInputsAheadOfTheQueue(t *testing.T) {
+	t.Setenv("PRIORITY_METADATA_KEY", "x-priority")
+	t.Setenv("PRIORITY_OVERSUBSCRIPTION", "1")
+	t.Setenv("MAX_WAIT_MILLIS", "5000")
+	t.Setenv("WAIT_JITTER_MILLIS", "0")
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var completed []string
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if string(input.Data) == "low-0" {
+			<-release
+		}
+		mu.Lock()
+		completed = append(completed, string(input.Data))
+		mu.Unlock()
+		return &fnrun.Result{}, nil
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// The first low-priority input holds the only slot of the pool, and the
+	// others queue behind it.
+	var wg sync.WaitGroup
+	invoke := func(data string) {
+		defer wg.Done()
+		if _, err := pool.Invoke(withPriority("low"), &fnrun.Input{Data: []byte(data)}); err != nil {
+			t.Errorf("unexpected error for %s: %v", data, err)
+		}
+	}
+	wg.Add(1)
+	go invoke("low-0")
+	waitForBusyPool(t, pool)
+	wg.Add(2)
+	go invoke("low-1")
+	go invoke("low-2")
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.queueDepth() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 queued inputs, got %d", pool.queueDepth())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := pool.Invoke(withPriority("high"), &fnrun.Input{Data: []byte("high")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(release)
+	wg.Wait()
+
+	if completed[0] != "high" {
+		t.Errorf("expected the high-priority input to complete first, got %v", completed)
+	}
+}
+
+func TestPoolKeepsPrioritySlotsForHighPriorityInputs(t *testing.T) {
+	t.Setenv("PRIORITY_METADATA_KEY", "x-priority")
+	t.Setenv("PRIORITY_OVERSUBSCRIPTION", "1")
+	t.Setenv("MAX_WAIT_MILLIS", "5000")
+	t.Setenv("WAIT_JITTER_MILLIS", "0")
+
+	release := make(chan struct{})
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		<-release
+		return &fnrun.Result{}, nil
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	defer close(release)
+
+	go pool.Invoke(withPriority("low"), &fnrun.Input{})
+	waitForBusyPool(t, pool)
+
+	// Only high-priority inputs may take the free priority slot.
+	for _, ctx := range []context.Context{withPriority("low"), context.Background()} {
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		_, err := pool.Invoke(ctx, &fnrun.Input{})
+		cancel()
+		if err == nil {
+			t.Error("expected an input without high priority to wait for the busy slot")
+		}
+	}
+}
+
+// observedSince returns the count and sum of the observations made by h
+// since it had the given totals.
+func observedSince(h *histogram, count uint64, sum float64) (uint64, time.Duration) {
+	newCount, newSum := histogramTotals(h)
+	return newCount - count, time.Duration((newSum - sum) * float64(time.Second))
+}
+
+// invokeSlowPoolConcurrently invokes invoker three times at once, where the
+// invocations share a single slot of a pool whose function takes 100ms.
+func invokeSlowPoolConcurrently(t *testing.T, invoker func(*invokerPool) fnrun.Invoker) {
+	t.Helper()
+	t.Setenv("MAX_WAIT_MILLIS", "5000")
+	t.Setenv("WAIT_JITTER_MILLIS", "0")
+	pool, err := newSizedInvokerPool(&staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		time.Sleep(100 * time.Millisecond)
+		return &fnrun.Result{}, nil
+	})}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	target := invoker(pool)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := target.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// checkWaitAndExecDurations checks that three invocations that took 100ms
+// each, one after another, were observed as waiting 0, 100 and 200ms.
+func checkWaitAndExecDurations(t *testing.T, run func()) {
+	t.Helper()
+	waitCount, waitSum := histogramTotals(poolWaitDuration)
+	execCount, execSum := histogramTotals(execDuration)
+	run()
+
+	n, wait := observedSince(poolWaitDuration, waitCount, waitSum)
+	if n != 3 || wait < 250*time.Millisecond || wait > 450*time.Millisecond {
+		t.Errorf("expected 3 waits totalling about 300ms, got %d totalling %v", n, wait)
+	}
+	n, exec := observedSince(execDuration, execCount, execSum)
+	if n != 3 || exec < 300*time.Millisecond || exec > 450*time.Millisecond {
+		t.Errorf("expected 3 executions totalling about 300ms, got %d totalling %v", n, exec)
+	}
+}
+
+func TestPoolObservesWaitAndExecutionTime(t *testing.T) {
+	checkWaitAndExecDurations(t, func() {
+		invokeSlowPoolConcurrently(t, func(pool *invokerPool) fnrun.Invoker { return pool })
+	})
+}
+
+func TestPoolCountsTheWaitInTheConcurrencyLimiter(t *testing.T) {
+	checkWaitAndExecDurations(t, func() {
+		invokeSlowPoolConcurrently(t, func(pool *invokerPool) fnrun.Invoker {
+			return newConcurrencyLimiter(pool, 1, "", 0)
+		})
+	})
+}
+
+func TestQueuedTimeIsCountedOnce(t *testing.T) {
+	ctx := withQueuedTime(context.Background(), time.Second)
+	if d := takeQueuedTime(ctx); d != time.Second {
+		t.Errorf("expected the queued time, got %v", d)
+	}
+	if d := takeQueuedTime(ctx); d != 0 {
+		t.Errorf("expected the queued time to be taken once, got %v", d)
+	}
+	if d := takeQueuedTime(context.Background()); d != 0 {
+		t.Errorf("expected no queued time, got %v", d)
+	}
+}
@@ -0,0 +1,156 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const posixMQPriorityKey = "x-mq-priority"
+
+// posixMQPollInterval is how long the POSIX message queue source waits for a
+// message before checking whether it has been cancelled.
+const posixMQPollInterval = 500 * time.Millisecond
+
+// -----------------------------------------------------------------------------
+// POSIX Message Queue Source
+//
+// The posix-mq source receives messages from a POSIX message queue, which lets
+// the runner be fed by another process on the same Linux machine without any
+// network stack. The function is invoked with the content of each message, in
+// the order of the queue, and the priority of the message is passed in the
+// x-mq-priority metadata. A message is removed from the queue when it is
+// received, so a failed invocation is logged and the message is lost.
+//
+// The queue MQ_NAME is created if it does not exist, holding messages of up to
+// MQ_MSG_SIZE bytes and the default number of messages of the system. The
+// attributes of an existing queue are left as they are.
+
+// posixMQAttr is struct mq_attr of the kernel.
+type posixMQAttr struct {
+	flags    int
+	maxMsg   int
+	msgSize  int
+	curMsgs  int
+	reserved [4]int
+}
+
+func newPosixMQSource(name string, msgSize int) (eventSource, error) {
+	if name == "" {
+		return nil, configErrorf("MQ_NAME", "MQ_NAME is required for the posix-mq source")
+	}
+	if !strings.HasPrefix(name, "/") || len(name) == 1 || strings.Contains(name[1:], "/") {
+		return nil, configErrorf("MQ_NAME", "MQ_NAME must be a slash followed by a name without slashes, such as /my-queue")
+	}
+	if msgSize <= 0 {
+		return nil, configErrorf("MQ_MSG_SIZE", "MQ_MSG_SIZE must be greater than zero")
+	}
+
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		fd, err := openPosixMQ(name, msgSize)
+		if err != nil {
+			return fmt.Errorf("could not open message queue %s: %v", name, err)
+		}
+		defer syscall.Close(fd)
+
+		// Receiving requires a buffer as large as the messages of the queue,
+		// which may have been created with another size.
+		var attr posixMQAttr
+		if err := posixMQGetAttr(fd, &attr); err != nil {
+			return fmt.Errorf("could not read the attributes of message queue %s: %v", name, err)
+		}
+		buf := make([]byte, attr.msgSize)
+
+		for {
+			n, priority, err := receivePosixMQ(fd, buf, time.Now().Add(posixMQPollInterval))
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err == syscall.ETIMEDOUT || err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("could not receive from message queue %s: %v", name, err)
+			}
+
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			msgCtx := runner.WithMetadata(ctx, map[string]string{posixMQPriorityKey: strconv.FormatUint(uint64(priority), 10)})
+			if _, err := invoker.Invoke(msgCtx, &fnrun.Input{Data: data}); err != nil {
+				log.Printf("invocation of message from %s failed: %v", name, err)
+			}
+		}
+	}, nil
+}
+
+// openPosixMQ opens the queue name for reading, creating it with messages of
+// up to msgSize bytes if it does not exist.
+func openPosixMQ(name string, msgSize int) (int, error) {
+	// The kernel expects the name without the leading slash required by
+	// mq_open(3).
+	path, err := syscall.BytePtrFromString(strings.TrimPrefix(name, "/"))
+	if err != nil {
+		return -1, err
+	}
+	attr := posixMQAttr{maxMsg: posixMQDefaultMaxMsg(), msgSize: msgSize}
+	fd, _, errno := syscall.Syscall6(syscall.SYS_MQ_OPEN,
+		uintptr(unsafe.Pointer(path)),
+		uintptr(syscall.O_RDONLY|syscall.O_CREAT|syscall.O_CLOEXEC),
+		0600,
+		uintptr(unsafe.Pointer(&attr)),
+		0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// posixMQDefaultMaxMsg returns the number of messages that a new queue holds
+// by default on this system.
+func posixMQDefaultMaxMsg() int {
+	data, err := ioutil.ReadFile("/proc/sys/fs/mqueue/msg_default")
+	if err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 10
+}
+
+func posixMQGetAttr(fd int, attr *posixMQAttr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MQ_GETSETATTR, uintptr(fd), 0, uintptr(unsafe.Pointer(attr)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// receivePosixMQ receives the next message of the queue into buf, waiting
+// until deadline for one to arrive.
+func receivePosixMQ(fd int, buf []byte, deadline time.Time) (int, uint32, error) {
+	var priority uint32
+	timeout := syscall.NsecToTimespec(deadline.UnixNano())
+	n, _, errno := syscall.Syscall6(syscall.SYS_MQ_TIMEDRECEIVE,
+		uintptr(fd),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+		uintptr(unsafe.Pointer(&priority)),
+		uintptr(unsafe.Pointer(&timeout)),
+		0)
+	if errno != 0 {
+		return 0, 0, errno
+	}
+	return int(n), priority, nil
+}
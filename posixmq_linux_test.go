@@ -0,0 +1,181 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// posixMQName returns a queue name that is unique to the test and removes
+// the queue when the test completes.
+func posixMQName(t *testing.T) string {
+	t.Helper()
+	name := fmt.Sprintf("/fnrun-test-%d-%d", syscall.Getpid(), time.Now().UnixNano())
+	t.Cleanup(func() {
+		path, err := syscall.BytePtrFromString(strings.TrimPrefix(name, "/"))
+		if err == nil {
+			syscall.Syscall(syscall.SYS_MQ_UNLINK, uintptr(unsafe.Pointer(path)), 0, 0)
+		}
+	})
+	return name
+}
+
+// sendPosixMQ sends data with priority to the queue name, creating it with
+// messages of up to msgSize bytes if it does not exist.
+func sendPosixMQ(t *testing.T, name string, msgSize int, data string, priority uint) {
+	t.Helper()
+	path, err := syscall.BytePtrFromString(strings.TrimPrefix(name, "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr := posixMQAttr{maxMsg: posixMQDefaultMaxMsg(), msgSize: msgSize}
+	fd, _, errno := syscall.Syscall6(syscall.SYS_MQ_OPEN,
+		uintptr(unsafe.Pointer(path)),
+		uintptr(syscall.O_WRONLY|syscall.O_CREAT|syscall.O_CLOEXEC),
+		0600,
+		uintptr(unsafe.Pointer(&attr)),
+		0, 0)
+	if errno == syscall.ENOSYS || errno == syscall.EACCES {
+		t.Skipf("POSIX message queues are not available: %v", errno)
+	}
+	if errno != 0 {
+		t.Fatalf("could not open message queue %s: %v", name, errno)
+	}
+	defer syscall.Close(int(fd))
+
+	buf := []byte(data)
+	_, _, errno = syscall.Syscall6(syscall.SYS_MQ_TIMEDSEND,
+		fd,
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(data)),
+		uintptr(priority),
+		0, 0)
+	if errno != 0 {
+		t.Fatalf("could not send to message queue %s: %v", name, errno)
+	}
+}
+
+func TestPosixMQSourceDispatchesMessages(t *testing.T) {
+	name := posixMQName(t)
+	sendPosixMQ(t, name, 64, "low", 1)
+	sendPosixMQ(t, name, 64, "high", 5)
+
+	source, err := newPosixMQSource(name, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var inputs, priorities []string
+	received := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- source(ctx, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			metadata, _ := runner.MetadataFromContext(ctx)
+			mu.Lock()
+			inputs = append(inputs, string(input.Data))
+			priorities = append(priorities, metadata[posixMQPriorityKey])
+			mu.Unlock()
+			received <- struct{}{}
+			return &fnrun.Result{Status: 200}, nil
+		}))
+	}()
+
+	wait := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			select {
+			case <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the message to be dispatched")
+			}
+		}
+	}
+	wait(2)
+	sendPosixMQ(t, name, 64, "later", 0)
+	wait(1)
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected the source to return without an error, got %v", err)
+		}
+	case <-time.After(2 * posixMQPollInterval):
+		t.Fatal("expected the source to return once cancelled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(inputs, ",") != "high,low,later" || strings.Join(priorities, ",") != "5,1,0" {
+		t.Errorf("expected the messages in priority order with their priorities, got %v %v", inputs, priorities)
+	}
+}
+
+func TestPosixMQSourceUsesTheMessageSizeOfAnExistingQueue(t *testing.T) {
+	name := posixMQName(t)
+	message := strings.Repeat("x", 100)
+	sendPosixMQ(t, name, 128, message, 0)
+
+	source, err := newPosixMQSource(name, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- source(ctx, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			received <- string(input.Data)
+			return &fnrun.Result{Status: 200}, nil
+		}))
+	}()
+
+	select {
+	case data := <-received:
+		if data != message {
+			t.Errorf("expected the whole message, got %d bytes", len(data))
+		}
+	case err := <-done:
+		t.Fatalf("expected the message to be dispatched, got %v", err)
+	case <-time.After(5 * time.Second):
+		cancel()
+		t.Fatal("expected the message to be dispatched")
+	}
+	cancel()
+	<-done
+}
+
+func TestNewPosixMQSourceConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		queue    string
+		msgSize  int
+		wantName string
+	}{
+		{"no name", "", 64, "MQ_NAME"},
+		{"no slash", "queue", 64, "MQ_NAME"},
+		{"only a slash", "/", 64, "MQ_NAME"},
+		{"nested", "/a/b", 64, "MQ_NAME"},
+		{"no size", "/queue", 0, "MQ_MSG_SIZE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newPosixMQSource(tt.queue, tt.msgSize)
+			checkConfigError(t, err, tt.wantName, tt.wantName)
+		})
+	}
+}
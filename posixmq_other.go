@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+func newPosixMQSource(name string, msgSize int) (eventSource, error) {
+	return nil, configErrorf("SOURCE_TYPE", "the posix-mq source is only supported on Linux")
+}
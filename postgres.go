@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the pgx database/sql driver
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+	"github.com/tessellator/fnrun-runner/runner/db"
+)
+
+// -----------------------------------------------------------------------------
+// PostgreSQL Sink
+//
+// The PostgreSQL sink inserts each result as a row of a table. Every row has
+// the correlation ID of the event in correlation_id (NULL if it has none), the
+// event timestamp (or the time of delivery if the event has none) in
+// created_at, and the data of the result in body.
+//
+// Further columns may be filled from the data of the result, which must then be
+// JSON, with POSTGRES_COLUMNS: a JSON object that maps each column name to a
+// path into the data such as "$.order.items[0].sku". A path that does not
+// exist in the data inserts NULL. String values are inserted as text and other
+// values as their JSON encoding, and PostgreSQL converts them to the type of
+// the column.
+//
+// Rows are inserted through the shared database pool for POSTGRES_DSN, which
+// opens at most POSTGRES_MAX_CONNS connections.
+
+// postgresDriver is the database/sql driver with which the postgres sink
+// connects.
+var postgresDriver = "pgx"
+
+type postgresColumn struct {
+	name string
+	path []jsonPathStep
+}
+
+func newPostgresSink(dsn string, table string, columnSpec string, maxConns int) (eventSinkTransformer, error) {
+	if dsn == "" {
+		return nil, configErrorf("POSTGRES_DSN", "POSTGRES_DSN is required for the postgres sink")
+	}
+	if table == "" {
+		return nil, configErrorf("POSTGRES_TABLE", "POSTGRES_TABLE is required for the postgres sink")
+	}
+
+	var columns []postgresColumn
+	if columnSpec != "" {
+		var paths map[string]string
+		if err := json.Unmarshal([]byte(columnSpec), &paths); err != nil {
+			return nil, configErrorf("POSTGRES_COLUMNS", "POSTGRES_COLUMNS must be a JSON object of column names to JSON paths: %v", err)
+		}
+		for name, pathSpec := range paths {
+			path, err := parseJSONPath(pathSpec)
+			if err != nil {
+				return nil, configErrorf("POSTGRES_COLUMNS", "Invalid JSON path for column %s: %v", name, err)
+			}
+			columns = append(columns, postgresColumn{name: name, path: path})
+		}
+		sort.Slice(columns, func(i, j int) bool { return columns[i].name < columns[j].name })
+	}
+
+	names := []string{"correlation_id", "created_at", "body"}
+	for _, column := range columns {
+		names = append(names, column.name)
+	}
+	placeholders := make([]string, len(names))
+	for i := range names {
+		names[i] = pgx.Identifier{names[i]}.Sanitize()
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		pgx.Identifier(strings.Split(table, ".")).Sanitize(),
+		strings.Join(names, ", "),
+		strings.Join(placeholders, ", "))
+
+	pool := db.SharedPoolForDriver(postgresDriver, dsn, maxConns)
+
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		metadata, _ := runner.MetadataFromContext(ctx)
+
+		var correlationID interface{}
+		if id := metadata[correlationIDKey]; id != "" {
+			correlationID = id
+		}
+		createdAt := time.Now().UTC()
+		if ts, err := time.Parse(time.RFC3339Nano, metadata[eventTimestampKey]); err == nil {
+			createdAt = ts
+		}
+
+		args := []interface{}{correlationID, createdAt, string(result.Data)}
+		if len(columns) > 0 {
+			var data interface{}
+			if err := json.Unmarshal(result.Data, &data); err != nil {
+				return result, fmt.Errorf("result data is not JSON, so POSTGRES_COLUMNS cannot be extracted: %w", err)
+			}
+			for _, column := range columns {
+				args = append(args, postgresValue(lookupJSONPath(data, column.path)))
+			}
+		}
+
+		_, err := pool.ExecContext(ctx, query, args...)
+		return result, err
+	}, nil
+}
+
+// postgresValue converts a value decoded from JSON into a query argument.
+func postgresValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return v
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		return string(encoded)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// JSON Paths
+//
+// A JSON path selects a value in a JSON document. It starts with $, which is
+// the whole document, followed by any number of .key to select a member of an
+// object or [index] to select an element of an array.
+
+type jsonPathStep struct {
+	key   string
+	index int
+	isKey bool
+}
+
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSON path %q must start with $", path)
+	}
+
+	var steps []jsonPathStep
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("JSON path %q has an empty key", path)
+			}
+			steps = append(steps, jsonPathStep{key: key, isKey: true})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSON path %q has an unterminated index", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("JSON path %q has an invalid index", path)
+			}
+			steps = append(steps, jsonPathStep{index: index})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("JSON path %q is invalid at %q", path, rest)
+		}
+	}
+	return steps, nil
+}
+
+// lookupJSONPath returns the value at path in data, which was decoded from
+// JSON into interface{}, or nil if there is no such value.
+func lookupJSONPath(data interface{}, path []jsonPathStep) interface{} {
+	for _, step := range path {
+		if step.isKey {
+			object, ok := data.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			data = object[step.key]
+		} else {
+			array, ok := data.([]interface{})
+			if !ok || step.index >= len(array) {
+				return nil
+			}
+			data = array[step.index]
+		}
+	}
+	return data
+}
+
+func getPostgresSink() (eventSinkTransformer, error) {
+	return newPostgresSink(
+		os.Getenv("POSTGRES_DSN"),
+		// env: POSTGRES_TABLE string "" "Table into which the postgres sink inserts results."
+		os.Getenv("POSTGRES_TABLE"),
+		// env: POSTGRES_COLUMNS string "" "JSON object mapping the extra columns of the postgres sink to JSON paths in the result."
+		os.Getenv("POSTGRES_COLUMNS"),
+		// env: POSTGRES_MAX_CONNS int 4 "Maximum number of connections opened by the postgres sink."
+		getIntEnv("POSTGRES_MAX_CONNS", 4),
+	)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+	"github.com/tessellator/fnrun-runner/runner/db"
+)
+
+// recordedExec is a statement executed through the recording driver.
+type recordedExec struct {
+	query string
+	args  []interface{}
+}
+
+// recordingDriver is a database/sql driver whose connections record the
+// statements executed on them instead of running them.
+type recordingDriver struct {
+	mu    sync.Mutex
+	execs []recordedExec
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{driver: d}, nil
+}
+
+func (d *recordingDriver) take() []recordedExec {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	execs := d.execs
+	d.execs = nil
+	return execs
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	c.driver.execs = append(c.driver.execs, recordedExec{query, values})
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("recordingConn does not support prepared statements")
+}
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("recordingConn does not support transactions")
+}
+
+var postgresTestDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("fnrun-test-postgres", postgresTestDriver)
+}
+
+// usePostgresTestDriver makes the postgres sink record its statements for
+// the duration of the test.
+func usePostgresTestDriver(t *testing.T) {
+	postgresDriver = "fnrun-test-postgres"
+	postgresTestDriver.take()
+	t.Cleanup(func() {
+		postgresDriver = "pgx"
+		db.CloseAll()
+	})
+}
+
+func TestPostgresSinkInsertsResults(t *testing.T) {
+	usePostgresTestDriver(t)
+	sink, err := newPostgresSink("app", "events.results", `{"sku": "$.order.items[0].sku", "total": "$.order.total", "missing": "$.nope"}`, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := runner.WithMetadata(context.Background(), map[string]string{
+		correlationIDKey:  "abc-123",
+		eventTimestampKey: "2024-01-02T03:04:05Z",
+	})
+	data := `{"order": {"items": [{"sku": "A-1"}], "total": 12.5}}`
+	result := &fnrun.Result{Status: 200, Data: []byte(data)}
+	returned, err := sink(ctx, result)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if returned != result {
+		t.Error("expected the result to be returned unchanged")
+	}
+
+	want := []recordedExec{{
+		query: `INSERT INTO "events"."results" ("correlation_id", "created_at", "body", "missing", "sku", "total") VALUES ($1, $2, $3, $4, $5, $6)`,
+		args:  []interface{}{"abc-123", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), data, nil, "A-1", "12.5"},
+	}}
+	if got := postgresTestDriver.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestPostgresSinkDefaultsWithoutMetadata(t *testing.T) {
+	usePostgresTestDriver(t)
+	sink, err := newPostgresSink("app", "results", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().UTC()
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("not json")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	execs := postgresTestDriver.take()
+	if len(execs) != 1 {
+		t.Fatalf("expected one insert, got %+v", execs)
+	}
+	args := execs[0].args
+	if args[0] != nil {
+		t.Errorf("expected a NULL correlation ID, got %v", args[0])
+	}
+	if createdAt, ok := args[1].(time.Time); !ok || createdAt.Before(before.Add(-time.Second)) {
+		t.Errorf("expected the delivery time as created_at, got %v", args[1])
+	}
+	if args[2] != "not json" {
+		t.Errorf("expected the data as body, got %v", args[2])
+	}
+}
+
+func TestPostgresSinkRequiresJSONForColumns(t *testing.T) {
+	usePostgresTestDriver(t)
+	sink, err := newPostgresSink("app", "results", `{"sku": "$.sku"}`, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("not json")}); err == nil {
+		t.Error("expected an error for data that is not JSON")
+	}
+	if execs := postgresTestDriver.take(); len(execs) != 0 {
+		t.Errorf("expected nothing to be inserted, got %+v", execs)
+	}
+}
+
+func TestNewPostgresSinkErrors(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		table    string
+		columns  string
+		wantName string
+	}{
+		{"", "results", "", "POSTGRES_DSN"},
+		{"app", "", "", "POSTGRES_TABLE"},
+		{"app", "results", "[]", "POSTGRES_COLUMNS"},
+		{"app", "results", `{"sku": "sku"}`, "POSTGRES_COLUMNS"},
+	}
+
+	for _, tt := range tests {
+		_, err := newPostgresSink(tt.dsn, tt.table, tt.columns, 1)
+		var configErr *runner.ConfigError
+		if !errors.As(err, &configErr) || configErr.Name != tt.wantName {
+			t.Errorf("expected a %s config error, got %v", tt.wantName, err)
+		}
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	data := map[string]interface{}{
+		"order": map[string]interface{}{
+			"items": []interface{}{map[string]interface{}{"sku": "A-1"}},
+		},
+	}
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"$", data},
+		{"$.order.items[0].sku", "A-1"},
+		{"$.order.items[1]", nil},
+		{"$.order.items.sku", nil},
+		{"$.missing", nil},
+	}
+	for _, tt := range tests {
+		path, err := parseJSONPath(tt.path)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", tt.path, err)
+			continue
+		}
+		if got := lookupJSONPath(data, path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expected %s to select %v, got %v", tt.path, tt.want, got)
+		}
+	}
+
+	for _, path := range []string{"order", "$.", "$..a", "$[0", "$[-1]", "$[a]", "$a"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("expected an error for %q", path)
+		}
+	}
+}
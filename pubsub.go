@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// Delivery modes of the Google Cloud Pub/Sub source.
+const (
+	pubsubModePull = "pull"
+	pubsubModePush = "push"
+)
+
+// -----------------------------------------------------------------------------
+// Google Cloud Pub/Sub Source
+//
+// The Pub/Sub source invokes the function with the data of each message
+// delivered on a subscription. The attributes of the message are passed as
+// metadata, along with its ID as the correlation ID and its publish time as
+// the event timestamp.
+//
+// In pull mode, the source receives messages with the Pub/Sub client, which
+// authenticates with application default credentials (or talks to the emulator
+// named by PUBSUB_EMULATOR_HOST). A message is acked once its invocation,
+// including delivery to the sink, has succeeded, and nacked so that Pub/Sub
+// redelivers it otherwise.
+//
+// In push mode, the source serves the push endpoint of the subscription at
+// addr instead, and acks a message by responding with a 2xx status. The
+// endpoint is served over HTTPS if a TLS configuration is provided.
+//
+// A nack directive that does not request a requeue acks the message, dropping
+// it. Pub/Sub redelivers nacked messages according to the retry policy of the
+// subscription, so the delay of a directive is ignored.
+
+type pubsubPushRequest struct {
+	Message struct {
+		Data        []byte            `json:"data"`
+		Attributes  map[string]string `json:"attributes"`
+		MessageID   string            `json:"messageId"`
+		PublishTime time.Time         `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+func newPubSubSource(mode string, project string, subscription string, addr string, tlsConfig *tls.Config) (eventSource, error) {
+	switch mode {
+	case pubsubModePull:
+		if project == "" {
+			return nil, configErrorf("PUBSUB_PROJECT", "PUBSUB_PROJECT is required for the gcp-pubsub source")
+		}
+		if subscription == "" {
+			return nil, configErrorf("PUBSUB_SUBSCRIPTION", "PUBSUB_SUBSCRIPTION is required for the gcp-pubsub source")
+		}
+		return func(ctx context.Context, invoker fnrun.Invoker) error {
+			return pullPubSub(ctx, invoker, project, subscription)
+		}, nil
+	case pubsubModePush:
+		return func(ctx context.Context, invoker fnrun.Invoker) error {
+			return servePubSubPush(ctx, invoker, addr, tlsConfig)
+		}, nil
+	default:
+		return nil, configErrorf("PUBSUB_MODE", "Unknown PUBSUB_MODE %s", mode)
+	}
+}
+
+// invokePubSubMessage invokes the function with a message and reports whether
+// the message should be acked.
+func invokePubSubMessage(ctx context.Context, invoker fnrun.Invoker, id string, data []byte, attributes map[string]string, published time.Time) bool {
+	metadata := make(map[string]string, len(attributes)+2)
+	for k, v := range attributes {
+		metadata[k] = v
+	}
+	metadata[correlationIDKey] = id
+	if !published.IsZero() {
+		metadata[eventTimestampKey] = published.UTC().Format(time.RFC3339Nano)
+	}
+
+	_, directive, err := invokeAckable(runner.WithMetadata(ctx, metadata), invoker, &fnrun.Input{Data: data})
+	if err != nil {
+		log.Printf("could not process Pub/Sub message %s: %v", id, err)
+		return false
+	}
+	return directive == nil || !directive.Requeue
+}
+
+func pullPubSub(ctx context.Context, invoker fnrun.Invoker, project string, subscription string) error {
+	var client *pubsub.Client
+	err := connectWithBackoff(func() (err error) {
+		client, err = pubsub.NewClient(ctx, project)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	sub := client.Subscription(subscription)
+	return sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		if invokePubSubMessage(ctx, invoker, msg.ID, msg.Data, msg.Attributes, msg.PublishTime) {
+			msg.Ack()
+		} else {
+			msg.Nack()
+		}
+	})
+}
+
+func servePubSubPush(ctx context.Context, invoker fnrun.Invoker, addr string, tlsConfig *tls.Config) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", serveMetrics)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var req pubsubPushRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		msg := req.Message
+		if !invokePubSubMessage(r.Context(), invoker, msg.MessageID, msg.Data, msg.Attributes, msg.PublishTime) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- listenAndServe(server, tlsConfig)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
+
+// newPubSubSink returns a sink that publishes each result to a Pub/Sub topic.
+// The message data is the result encoded as JSON in the format written by the
+// stdin source, and the env of the result becomes the attributes of the
+// message. Results published at about the same time are sent in a single
+// batch according to the count and delay thresholds; each delivery completes
+// once its message has been published.
+func newPubSubSink(project string, topicID string, batchCount int, batchDelay time.Duration) (eventSinkTransformer, error) {
+	if project == "" {
+		return nil, configErrorf("PUBSUB_SINK_PROJECT", "PUBSUB_SINK_PROJECT is required for the gcp-pubsub sink")
+	}
+	if topicID == "" {
+		return nil, configErrorf("PUBSUB_SINK_TOPIC", "PUBSUB_SINK_TOPIC is required for the gcp-pubsub sink")
+	}
+
+	var client *pubsub.Client
+	err := connectWithBackoff(func() (err error) {
+		client, err = pubsub.NewClient(context.Background(), project)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	topic := client.Topic(topicID)
+	if batchCount > 0 {
+		topic.PublishSettings.CountThreshold = batchCount
+	}
+	if batchDelay > 0 {
+		topic.PublishSettings.DelayThreshold = batchDelay
+	}
+
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		data, err := json.Marshal(replayOutput{Status: result.Status, Data: result.Data, Env: result.Env})
+		if err != nil {
+			return result, err
+		}
+
+		_, err = topic.Publish(ctx, &pubsub.Message{Data: data, Attributes: result.Env}).Get(ctx)
+		return result, err
+	}, nil
+}
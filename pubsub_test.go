@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// newFakePubSub starts a fake Pub/Sub server with the topic events and the
+// subscription events-sub in project test, and points the Pub/Sub client at
+// it for the duration of the test.
+func newFakePubSub(t *testing.T) *pstest.Server {
+	t.Helper()
+	server := pstest.NewServer()
+	t.Cleanup(func() { server.Close() })
+	t.Setenv("PUBSUB_EMULATOR_HOST", server.Addr)
+
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	topic, err := client.CreateTopic(ctx, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateSubscription(ctx, "events-sub", pubsub.SubscriptionConfig{Topic: topic, AckDeadline: 10 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func TestPubSubSourceAcksAfterSuccessfulInvocations(t *testing.T) {
+	server := newFakePubSub(t)
+	okID := server.Publish("projects/test/topics/events", []byte("ok"), map[string]string{"kind": "greeting"})
+	retryID := server.Publish("projects/test/topics/events", []byte("retry"), nil)
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	acksDuringInvocation := make(map[string]int)
+	metadata := make(map[string]map[string]string)
+	done := make(chan struct{}, 2)
+	invoker := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		md, _ := runner.MetadataFromContext(ctx)
+		id := md[correlationIDKey]
+
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[id]++
+		acksDuringInvocation[id] += server.Message(id).Acks
+		metadata[id] = md
+		if string(input.Data) == "retry" && attempts[id] == 1 {
+			return nil, errors.New("failed")
+		}
+		done <- struct{}{}
+		return &fnrun.Result{Status: 200}, nil
+	})
+
+	source, err := newPubSubSource(pubsubModePull, "test", "events-sub", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- source(ctx, invoker) }()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("expected both messages to be processed")
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Message(okID).Acks == 0 || server.Message(retryID).Acks == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected both messages to be acked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts[okID] != 1 || attempts[retryID] != 2 {
+		t.Errorf("expected the failed message to be nacked and redelivered once, got %v", attempts)
+	}
+	if acksDuringInvocation[okID] != 0 || acksDuringInvocation[retryID] != 0 {
+		t.Errorf("expected messages to be acked only after their invocation, got %v", acksDuringInvocation)
+	}
+	if metadata[okID]["kind"] != "greeting" || metadata[okID][eventTimestampKey] == "" {
+		t.Errorf("expected the attributes and publish time as metadata, got %v", metadata[okID])
+	}
+}
+
+func TestPubSubPushSourceRespondsWithTheOutcome(t *testing.T) {
+	addr := freeAddr(t)
+	source, err := newPubSubSource(pubsubModePush, "", "", addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received map[string]string
+	stop := runHTTPSource(t, addr, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		received, _ = runner.MetadataFromContext(ctx)
+		if string(input.Data) == "fail" {
+			return nil, errors.New("failed")
+		}
+		return &fnrun.Result{Status: 200}, nil
+	}))
+	defer stop()
+
+	push := func(id string, data string) int {
+		var req pubsubPushRequest
+		req.Message.Data = []byte(data)
+		req.Message.MessageID = id
+		req.Message.Attributes = map[string]string{"kind": "greeting"}
+		req.Subscription = "projects/test/subscriptions/events-sub"
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post("http://"+addr+"/", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := push("1", "ok"); status != http.StatusNoContent {
+		t.Errorf("expected a processed message to be acked with 204, got %d", status)
+	}
+	if received[correlationIDKey] != "1" || received["kind"] != "greeting" {
+		t.Errorf("expected the message ID and attributes as metadata, got %v", received)
+	}
+	if status := push("2", "fail"); status != http.StatusInternalServerError {
+		t.Errorf("expected a failed message to be nacked with 500, got %d", status)
+	}
+}
+
+func TestPubSubSinkPublishesResults(t *testing.T) {
+	server := newFakePubSub(t)
+	sink, err := newPubSubSink("test", "events", 2, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []*fnrun.Result{
+		{Status: 200, Data: []byte("first"), Env: map[string]string{"kind": "greeting"}},
+		{Status: 201, Data: []byte("second")},
+	}
+	var wg sync.WaitGroup
+	for _, result := range results {
+		wg.Add(1)
+		go func(result *fnrun.Result) {
+			defer wg.Done()
+			if _, err := sink(context.Background(), result); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(result)
+	}
+	wg.Wait()
+
+	published := make(map[string]*pstest.Message)
+	for _, msg := range server.Messages() {
+		var output replayOutput
+		if err := json.Unmarshal(msg.Data, &output); err != nil {
+			t.Fatalf("expected the message data to be the result as JSON, got %q: %v", msg.Data, err)
+		}
+		published[string(output.Data)] = msg
+		if want := map[string]int{"first": 200, "second": 201}[string(output.Data)]; output.Status != want {
+			t.Errorf("expected status %d for %q, got %d", want, output.Data, output.Status)
+		}
+	}
+	if len(published) != 2 {
+		t.Fatalf("expected both results to be published, got %d messages", len(server.Messages()))
+	}
+	if kind := published["first"].Attributes["kind"]; kind != "greeting" {
+		t.Errorf("expected the env of the result as attributes, got %v", published["first"].Attributes)
+	}
+	if attrs := published["second"].Attributes; len(attrs) != 0 {
+		t.Errorf("expected no attributes for a result without env, got %v", attrs)
+	}
+}
+
+func TestPubSubSinkRequiresAProjectAndTopic(t *testing.T) {
+	if _, err := newPubSubSink("", "events", 0, 0); err == nil {
+		t.Error("expected an error without a project")
+	}
+	if _, err := newPubSubSink("test", "", 0, 0); err == nil {
+		t.Error("expected an error without a topic")
+	}
+}
+
+func TestPubSubSourceRequiresAProjectAndSubscription(t *testing.T) {
+	if _, err := newPubSubSource(pubsubModePull, "", "events-sub", "", nil); err == nil {
+		t.Error("expected an error without a project")
+	}
+	if _, err := newPubSubSource(pubsubModePull, "test", "", "", nil); err == nil {
+		t.Error("expected an error without a subscription")
+	}
+	if _, err := newPubSubSource("poll", "test", "events-sub", "", nil); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Apache Pulsar Source
+//
+// The Pulsar source invokes the function with the payload of each message
+// received on a subscription of a topic. The subscription is shared, so that
+// several runners, or several instances of the source run with
+// SOURCE_CONCURRENCY, divide the messages between them. The properties of the
+// message are passed as metadata, along with its ID as the correlation ID and
+// its event time (or, if it has none, its publish time) as the event
+// timestamp.
+//
+// Messages are handled concurrently as they are received. A message is acked
+// once its invocation, including delivery to the sink, has succeeded, and
+// nacked so that Pulsar redelivers it otherwise. A nack directive that does not
+// request a requeue acks the message, dropping it; Pulsar redelivers nacked
+// messages after the redelivery delay of the consumer, so the delay of a
+// directive is ignored.
+
+// newPulsarClient creates the client with which the pulsar source connects.
+var newPulsarClient = pulsar.NewClient
+
+func newPulsarSource(url string, topic string, subscription string) (eventSource, error) {
+	if url == "" {
+		return nil, configErrorf("PULSAR_URL", "PULSAR_URL is required for the pulsar source")
+	}
+	if topic == "" {
+		return nil, configErrorf("PULSAR_TOPIC", "PULSAR_TOPIC is required for the pulsar source")
+	}
+	if subscription == "" {
+		return nil, configErrorf("PULSAR_SUBSCRIPTION", "PULSAR_SUBSCRIPTION is required for the pulsar source")
+	}
+
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		return consumePulsar(ctx, invoker, url, topic, subscription)
+	}, nil
+}
+
+func consumePulsar(ctx context.Context, invoker fnrun.Invoker, url string, topic string, subscription string) error {
+	var client pulsar.Client
+	var consumer pulsar.Consumer
+	err := connectWithBackoff(func() (err error) {
+		if ctx.Err() != nil {
+			// The source was cancelled while connecting.
+			return nil
+		}
+		if client == nil {
+			if client, err = newPulsarClient(pulsar.ClientOptions{URL: url}); err != nil {
+				return err
+			}
+		}
+		consumer, err = client.Subscribe(pulsar.ConsumerOptions{
+			Topic:            topic,
+			SubscriptionName: subscription,
+			Type:             pulsar.Shared,
+		})
+		return err
+	})
+	if client != nil {
+		defer client.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if consumer == nil {
+		return nil
+	}
+	defer consumer.Close()
+
+	// The consumer must stay open until every message received has been
+	// acked or nacked.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		msg, err := consumer.Receive(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !invokePulsarMessage(ctx, invoker, msg) {
+				consumer.Nack(msg)
+				return
+			}
+			if err := consumer.Ack(msg); err != nil {
+				log.Printf("could not ack Pulsar message %s: %v", pulsarMessageID(msg.ID()), err)
+			}
+		}()
+	}
+}
+
+// pulsarMessageID formats id as ledger:entry:partition:batch.
+func pulsarMessageID(id pulsar.MessageID) string {
+	return fmt.Sprintf("%d:%d:%d:%d", id.LedgerID(), id.EntryID(), id.PartitionIdx(), id.BatchIdx())
+}
+
+// invokePulsarMessage invokes the function with a message and reports whether
+// the message should be acked.
+func invokePulsarMessage(ctx context.Context, invoker fnrun.Invoker, msg pulsar.Message) bool {
+	properties := msg.Properties()
+	metadata := make(map[string]string, len(properties)+2)
+	for k, v := range properties {
+		metadata[k] = v
+	}
+	metadata[correlationIDKey] = pulsarMessageID(msg.ID())
+	timestamp := msg.EventTime()
+	if timestamp.IsZero() {
+		timestamp = msg.PublishTime()
+	}
+	if !timestamp.IsZero() {
+		metadata[eventTimestampKey] = timestamp.UTC().Format(time.RFC3339Nano)
+	}
+
+	_, directive, err := invokeAckable(runner.WithMetadata(ctx, metadata), invoker, &fnrun.Input{Data: msg.Payload()})
+	if err != nil {
+		log.Printf("could not process Pulsar message %s: %v", pulsarMessageID(msg.ID()), err)
+		return false
+	}
+	return directive == nil || !directive.Requeue
+}
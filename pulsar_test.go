@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// fakePulsarMessage is a message received from fakePulsarConsumer. The
+// methods of pulsar.Message that the source does not use are left
+// unimplemented.
+type fakePulsarMessage struct {
+	pulsar.Message
+	id          fakePulsarMessageID
+	payload     string
+	properties  map[string]string
+	eventTime   time.Time
+	publishTime time.Time
+}
+
+func (m *fakePulsarMessage) ID() pulsar.MessageID          { return m.id }
+func (m *fakePulsarMessage) Payload() []byte               { return []byte(m.payload) }
+func (m *fakePulsarMessage) Properties() map[string]string { return m.properties }
+func (m *fakePulsarMessage) EventTime() time.Time          { return m.eventTime }
+func (m *fakePulsarMessage) PublishTime() time.Time        { return m.publishTime }
+
+type fakePulsarMessageID struct {
+	pulsar.MessageID
+	ledger int64
+	entry  int64
+}
+
+func (id fakePulsarMessageID) LedgerID() int64     { return id.ledger }
+func (id fakePulsarMessageID) EntryID() int64      { return id.entry }
+func (id fakePulsarMessageID) PartitionIdx() int32 { return 0 }
+func (id fakePulsarMessageID) BatchIdx() int32     { return -1 }
+
+// fakePulsarConsumer delivers the messages sent on its channel and records
+// which of them are acked and nacked.
+type fakePulsarConsumer struct {
+	pulsar.Consumer
+	messages chan pulsar.Message
+
+	mu     sync.Mutex
+	acked  []string
+	nacked []string
+	closed bool
+}
+
+func (c *fakePulsarConsumer) Receive(ctx context.Context) (pulsar.Message, error) {
+	select {
+	case msg := <-c.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *fakePulsarConsumer) Ack(msg pulsar.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.acked = append(c.acked, string(msg.Payload()))
+	return nil
+}
+
+func (c *fakePulsarConsumer) Nack(msg pulsar.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nacked = append(c.nacked, string(msg.Payload()))
+}
+
+func (c *fakePulsarConsumer) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+// settled returns the number of messages that have been acked or nacked.
+func (c *fakePulsarConsumer) settled() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.acked) + len(c.nacked)
+}
+
+// fakePulsarClient subscribes with consumer and records the options with
+// which it was created and subscribed. It closes subscribed once the source
+// has subscribed.
+type fakePulsarClient struct {
+	pulsar.Client
+	consumer   *fakePulsarConsumer
+	subscribed chan struct{}
+
+	clientOptions   pulsar.ClientOptions
+	consumerOptions pulsar.ConsumerOptions
+	closed          bool
+}
+
+func (c *fakePulsarClient) Subscribe(options pulsar.ConsumerOptions) (pulsar.Consumer, error) {
+	c.consumerOptions = options
+	close(c.subscribed)
+	return c.consumer, nil
+}
+
+func (c *fakePulsarClient) Close() {
+	c.closed = true
+}
+
+// useFakePulsar points the pulsar source at a fake client for the duration of
+// the test.
+func useFakePulsar(t *testing.T) *fakePulsarClient {
+	t.Helper()
+	client := &fakePulsarClient{
+		consumer:   &fakePulsarConsumer{messages: make(chan pulsar.Message)},
+		subscribed: make(chan struct{}),
+	}
+	newPulsarClient = func(options pulsar.ClientOptions) (pulsar.Client, error) {
+		client.clientOptions = options
+		return client, nil
+	}
+	t.Cleanup(func() { newPulsarClient = pulsar.NewClient })
+	return client
+}
+
+// runPulsarSource runs source with invoker, sends it messages and waits for
+// each of them to be acked or nacked.
+func runPulsarSource(t *testing.T, client *fakePulsarClient, source eventSource, invoker fnrun.Invoker, messages ...*fakePulsarMessage) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- source(ctx, invoker) }()
+
+	select {
+	case <-client.subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the source to subscribe")
+	}
+	for _, msg := range messages {
+		select {
+		case client.consumer.messages <- msg:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the source to receive messages")
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for client.consumer.settled() < len(messages) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected every message to be acked or nacked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPulsarSourceSubscribesToTheTopic(t *testing.T) {
+	client := useFakePulsar(t)
+	source, err := newPulsarSource("pulsar://broker:6650", "persistent://public/default/events", "runners")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runPulsarSource(t, client, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 200}, nil
+	}))
+
+	if client.clientOptions.URL != "pulsar://broker:6650" {
+		t.Errorf("expected the client to connect to PULSAR_URL, got %q", client.clientOptions.URL)
+	}
+	options := client.consumerOptions
+	if options.Topic != "persistent://public/default/events" || options.SubscriptionName != "runners" || options.Type != pulsar.Shared {
+		t.Errorf("expected a shared subscription runners of the topic, got %+v", options)
+	}
+	if !client.closed || !client.consumer.closed {
+		t.Error("expected the consumer and the client to be closed when the source returns")
+	}
+}
+
+func TestPulsarSourceAcksAfterSuccessfulInvocations(t *testing.T) {
+	client := useFakePulsar(t)
+	source, err := newPulsarSource("pulsar://broker:6650", "events", "runners")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	metadata := make(map[string]map[string]string)
+	runPulsarSource(t, client, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		md, _ := runner.MetadataFromContext(ctx)
+		mu.Lock()
+		metadata[string(input.Data)] = md
+		mu.Unlock()
+		if string(input.Data) == "fail" {
+			return nil, errors.New("sink unavailable")
+		}
+		return &fnrun.Result{Status: 200}, nil
+	}),
+		&fakePulsarMessage{id: fakePulsarMessageID{ledger: 7, entry: 1}, payload: "ok", properties: map[string]string{"kind": "greeting"}, publishTime: published},
+		&fakePulsarMessage{id: fakePulsarMessageID{ledger: 7, entry: 2}, payload: "fail", publishTime: published},
+	)
+
+	consumer := client.consumer
+	if len(consumer.acked) != 1 || consumer.acked[0] != "ok" {
+		t.Errorf("expected the successful message to be acked, got %v", consumer.acked)
+	}
+	if len(consumer.nacked) != 1 || consumer.nacked[0] != "fail" {
+		t.Errorf("expected the failed message to be nacked, got %v", consumer.nacked)
+	}
+
+	md := metadata["ok"]
+	if md["kind"] != "greeting" || md[correlationIDKey] != "7:1:0:-1" {
+		t.Errorf("expected the properties and message ID as metadata, got %v", md)
+	}
+	if md[eventTimestampKey] != "2026-10-05T10:00:00Z" {
+		t.Errorf("expected the publish time as the event timestamp, got %q", md[eventTimestampKey])
+	}
+}
+
+func TestPulsarSourcePrefersTheEventTime(t *testing.T) {
+	client := useFakePulsar(t)
+	source, err := newPulsarSource("pulsar://broker:6650", "events", "runners")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var timestamp string
+	runPulsarSource(t, client, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		md, _ := runner.MetadataFromContext(ctx)
+		timestamp = md[eventTimestampKey]
+		return &fnrun.Result{Status: 200}, nil
+	}), &fakePulsarMessage{
+		payload:     "x",
+		eventTime:   time.Date(2026, 10, 5, 9, 0, 0, 0, time.UTC),
+		publishTime: time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC),
+	})
+
+	if timestamp != "2026-10-05T09:00:00Z" {
+		t.Errorf("expected the event time as the event timestamp, got %q", timestamp)
+	}
+}
+
+func TestPulsarSourceAcksNackedMessagesWithoutRequeue(t *testing.T) {
+	client := useFakePulsar(t)
+	source, err := newPulsarSource("pulsar://broker:6650", "events", "runners")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runPulsarSource(t, client, source, &nackMappingInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return &fnrun.Result{Status: 500, Data: input.Data}, nil
+		}),
+		mapper: func(result *fnrun.Result) runner.NackDirective {
+			return runner.NackDirective{Requeue: string(result.Data) == "requeue"}
+		},
+	}, &fakePulsarMessage{payload: "drop"}, &fakePulsarMessage{payload: "requeue"})
+
+	consumer := client.consumer
+	if len(consumer.acked) != 1 || consumer.acked[0] != "drop" {
+		t.Errorf("expected the message nacked without requeue to be acked, got %v", consumer.acked)
+	}
+	if len(consumer.nacked) != 1 || consumer.nacked[0] != "requeue" {
+		t.Errorf("expected the requeued message to be nacked, got %v", consumer.nacked)
+	}
+}
+
+func TestPulsarSourceConfiguration(t *testing.T) {
+	tests := []struct {
+		url          string
+		topic        string
+		subscription string
+		wantErr      string
+	}{
+		{"", "events", "runners", "PULSAR_URL"},
+		{"pulsar://broker:6650", "", "runners", "PULSAR_TOPIC"},
+		{"pulsar://broker:6650", "events", "", "PULSAR_SUBSCRIPTION"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantErr, func(t *testing.T) {
+			_, err := newPulsarSource(tt.url, tt.topic, tt.subscription)
+			var configErr *runner.ConfigError
+			if !errors.As(err, &configErr) || configErr.Name != tt.wantErr {
+				t.Errorf("expected a %s config error, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const quotaBucketCount = 60
+
+// -----------------------------------------------------------------------------
+// Quota Invoker
+//
+// The quota invoker limits the number of invocations in a sliding one-hour
+// window. The window is divided into one-minute buckets; once the total across
+// the buckets for the last hour reaches the limit, further invocations are
+// rejected with runner.ErrQuotaExceeded until older buckets expire.
+//
+// If a state path is configured, the buckets are saved to a JSON file after
+// every accepted invocation and loaded on startup so that the quota survives
+// restarts.
+
+type quotaBucket struct {
+	Minute int64 `json:"minute"`
+	Count  int   `json:"count"`
+}
+
+type quotaState struct {
+	Buckets []quotaBucket `json:"buckets"`
+}
+
+type quotaInvoker struct {
+	invoker   fnrun.Invoker
+	limit     int
+	statePath string
+	mu        sync.Mutex
+	buckets   [quotaBucketCount]quotaBucket
+}
+
+func newQuotaInvoker(invoker fnrun.Invoker, limit int, statePath string) (*quotaInvoker, error) {
+	qi := &quotaInvoker{invoker: invoker, limit: limit, statePath: statePath}
+	if err := qi.load(); err != nil {
+		return nil, err
+	}
+	return qi, nil
+}
+
+func (qi *quotaInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	if err := qi.acquire(time.Now()); err != nil {
+		return nil, err
+	}
+	return qi.invoker.Invoke(ctx, input)
+}
+
+func (qi *quotaInvoker) acquire(now time.Time) error {
+	qi.mu.Lock()
+	defer qi.mu.Unlock()
+
+	minute := now.Unix() / 60
+	total := 0
+	for _, bucket := range qi.buckets {
+		if bucket.Minute > minute-quotaBucketCount {
+			total += bucket.Count
+		}
+	}
+
+	if total >= qi.limit {
+		return runner.ErrQuotaExceeded
+	}
+
+	bucket := &qi.buckets[minute%quotaBucketCount]
+	if bucket.Minute != minute {
+		*bucket = quotaBucket{Minute: minute}
+	}
+	bucket.Count++
+
+	return qi.save()
+}
+
+func (qi *quotaInvoker) load() error {
+	if qi.statePath == "" {
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(qi.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state quotaState
+	if err := json.Unmarshal(contents, &state); err != nil {
+		return err
+	}
+
+	for _, bucket := range state.Buckets {
+		qi.buckets[bucket.Minute%quotaBucketCount] = bucket
+	}
+
+	return nil
+}
+
+// save writes the quota state to disk. The caller must hold qi.mu.
+func (qi *quotaInvoker) save() error {
+	if qi.statePath == "" {
+		return nil
+	}
+
+	state := quotaState{}
+	for _, bucket := range qi.buckets {
+		if bucket.Count > 0 {
+			state.Buckets = append(state.Buckets, bucket)
+		}
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(qi.statePath, data)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestQuotaInvokerRejectsInvocationsOverTheLimit(t *testing.T) {
+	var invocations int
+	qi, err := newQuotaInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		invocations++
+		return &fnrun.Result{}, nil
+	}), 3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := qi.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+			t.Fatalf("unexpected error on invocation %d: %v", i, err)
+		}
+	}
+	if _, err := qi.Invoke(context.Background(), &fnrun.Input{}); err != runner.ErrQuotaExceeded {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if invocations != 3 {
+		t.Errorf("expected 3 invocations, got %d", invocations)
+	}
+}
+
+func TestQuotaInvokerAcceptsInvocationsOnceTheWindowSlides(t *testing.T) {
+	qi, err := newQuotaInvoker(echoInvoker{}, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1700000000, 0)
+	if err := qi.acquire(start); err != nil {
+		t.Fatal(err)
+	}
+	if err := qi.acquire(start.Add(30 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := qi.acquire(start.Add(59 * time.Minute)); err != runner.ErrQuotaExceeded {
+		t.Errorf("expected ErrQuotaExceeded within the hour, got %v", err)
+	}
+
+	// The first invocation leaves the window after an hour, and the second
+	// half an hour later.
+	if err := qi.acquire(start.Add(61 * time.Minute)); err != nil {
+		t.Errorf("expected the window to have slid, got %v", err)
+	}
+	if err := qi.acquire(start.Add(62 * time.Minute)); err != runner.ErrQuotaExceeded {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+}
+
+func TestQuotaInvokerPersistsStateAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	now := time.Now()
+
+	qi, err := newQuotaInvoker(echoInvoker{}, 2, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := qi.acquire(now); err != nil {
+		t.Fatal(err)
+	}
+	if err := qi.acquire(now); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := newQuotaInvoker(echoInvoker{}, 2, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.acquire(now); err != runner.ErrQuotaExceeded {
+		t.Errorf("expected the quota to survive a restart, got %v", err)
+	}
+}
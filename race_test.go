@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package main
+
+// raceEnabled reports whether the tests were built with the race detector,
+// which reserves more address space than some tests allow function processes.
+const raceEnabled = true
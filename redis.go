@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// Redis client
+//
+// This is a minimal Redis client that supports only the commands needed by the
+// runner. Commands are sent over a single connection, which is re-established
+// after any error. Failed attempts to connect are retried with backoff.
+
+type redisClient struct {
+	addr   string
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRedisClient(addr string) *redisClient {
+	return &redisClient{addr: addr}
+}
+
+// do sends a command and returns the reply. A nil reply indicates a null bulk
+// string.
+func (r *redisClient) do(ctx context.Context, args ...string) (*string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		var conn net.Conn
+		err := connectWithBackoff(func() (err error) {
+			var dialer net.Dialer
+			conn, err = dialer.DialContext(ctx, "tcp", r.addr)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		r.conn = conn
+		r.reader = bufio.NewReader(conn)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		r.conn.SetDeadline(deadline)
+	} else {
+		r.conn.SetDeadline(time.Time{})
+	}
+
+	reply, err := r.roundTrip(args)
+	if err != nil {
+		r.conn.Close()
+		r.conn = nil
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+func (r *redisClient) roundTrip(args []string) (*string, error) {
+	cmd := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		cmd += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+	if _, err := r.conn.Write([]byte(cmd)); err != nil {
+		return nil, err
+	}
+
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, errors.New("malformed redis reply")
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+', ':':
+		value := line[1:]
+		return &value, nil
+	case '-':
+		return nil, fmt.Errorf("redis error: %s", line[1:])
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(r.reader, buf); err != nil {
+			return nil, err
+		}
+		value := string(buf[:length])
+		return &value, nil
+	default:
+		return nil, fmt.Errorf("unsupported redis reply type %q", line[0])
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Re-encoding Invoker
+//
+// The re-encoding invoker converts inputs from legacy sources that emit XML or
+// CSV to JSON before passing them to the function. The content-type metadata
+// of a converted input is set to application/json.
+//
+// An XML document becomes an object with the root element as its only key. An
+// element with neither attributes nor child elements becomes its trimmed text;
+// any other element becomes an object holding its attributes under keys
+// prefixed with @, its child elements under their names, and its text, if any,
+// under #text. Child elements that occur more than once become an array.
+// Namespaces are ignored.
+//
+// A CSV document becomes an array with an object for each record. The keys are
+// taken from CSV_HEADERS or, when it is not set, from the first record. A
+// header may carry a type hint as a suffix, such as id:number or active:bool,
+// in which case the column is converted to a JSON number or boolean; columns
+// are strings otherwise, and an empty value of a typed column becomes null.
+
+type inputDecoder func(data []byte) (interface{}, error)
+
+type reencodingInvoker struct {
+	invoker fnrun.Invoker
+	decode  inputDecoder
+}
+
+func newReencodingInvoker(invoker fnrun.Invoker, encoding string, csvHeaders string) (*reencodingInvoker, error) {
+	switch encoding {
+	case "xml":
+		return &reencodingInvoker{invoker: invoker, decode: decodeXML}, nil
+	case "csv":
+		var columns []csvColumn
+		if csvHeaders != "" {
+			var err error
+			if columns, err = parseCSVColumns(strings.Split(csvHeaders, ",")); err != nil {
+				return nil, &runner.ConfigError{Name: "CSV_HEADERS", Err: err}
+			}
+		}
+		return &reencodingInvoker{invoker: invoker, decode: func(data []byte) (interface{}, error) {
+			return decodeCSV(data, columns)
+		}}, nil
+	default:
+		return nil, configErrorf("INPUT_ENCODING", "Unknown INPUT_ENCODING %s", encoding)
+	}
+}
+
+func (ri *reencodingInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	value, err := ri.decode(input.Data)
+	if err != nil {
+		return nil, fmt.Errorf("could not re-encode input: %v", err)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("could not re-encode input: %v", err)
+	}
+
+	existing, _ := runner.MetadataFromContext(ctx)
+	metadata := make(map[string]string, len(existing)+1)
+	for k, v := range existing {
+		metadata[k] = v
+	}
+	metadata[contentTypeKey] = contentTypeJSON
+
+	return ri.invoker.Invoke(runner.WithMetadata(ctx, metadata), &fnrun.Input{Data: data})
+}
+
+// xmlNode holds an arbitrary XML element.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []xmlNode  `xml:",any"`
+}
+
+func decodeXML(data []byte) (interface{}, error) {
+	var root xmlNode
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{root.XMLName.Local: root.value()}, nil
+}
+
+func (n *xmlNode) value() interface{} {
+	text := strings.TrimSpace(n.Text)
+	if len(n.Attrs) == 0 && len(n.Children) == 0 {
+		return text
+	}
+
+	object := make(map[string]interface{}, len(n.Attrs)+len(n.Children)+1)
+	for _, attr := range n.Attrs {
+		object["@"+attr.Name.Local] = attr.Value
+	}
+	for i := range n.Children {
+		name := n.Children[i].XMLName.Local
+		child := n.Children[i].value()
+		switch existing := object[name].(type) {
+		case nil:
+			object[name] = child
+		case []interface{}:
+			object[name] = append(existing, child)
+		default:
+			object[name] = []interface{}{existing, child}
+		}
+	}
+	if text != "" {
+		object["#text"] = text
+	}
+	return object
+}
+
+type csvColumn struct {
+	name     string
+	typeHint string
+}
+
+// parseCSVColumns parses headers of the form name or name:type, where type is
+// string, number or bool.
+func parseCSVColumns(headers []string) ([]csvColumn, error) {
+	columns := make([]csvColumn, len(headers))
+	for i, header := range headers {
+		parts := strings.SplitN(strings.TrimSpace(header), ":", 2)
+		columns[i].name = parts[0]
+		if len(parts) == 2 {
+			columns[i].typeHint = parts[1]
+		}
+		if columns[i].name == "" {
+			return nil, fmt.Errorf("column %d has no name", i+1)
+		}
+		switch columns[i].typeHint {
+		case "", "string", "number", "bool":
+		default:
+			return nil, fmt.Errorf("unknown type %s of column %s", columns[i].typeHint, columns[i].name)
+		}
+	}
+	return columns, nil
+}
+
+func decodeCSV(data []byte, columns []csvColumn) (interface{}, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	records := []map[string]interface{}{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if columns == nil {
+			if columns, err = parseCSVColumns(record); err != nil {
+				return nil, fmt.Errorf("invalid header record: %v", err)
+			}
+			continue
+		}
+		if len(record) != len(columns) {
+			return nil, fmt.Errorf("record %d has %d fields, expected %d", len(records)+1, len(record), len(columns))
+		}
+
+		object := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			value, err := column.convert(record[i])
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %v", len(records)+1, err)
+			}
+			object[column.name] = value
+		}
+		records = append(records, object)
+	}
+}
+
+func (c csvColumn) convert(field string) (interface{}, error) {
+	if c.typeHint == "" || c.typeHint == "string" {
+		return field, nil
+	}
+	if field == "" {
+		return nil, nil
+	}
+
+	switch c.typeHint {
+	case "number":
+		var number float64
+		field = strings.TrimSpace(field)
+		if err := json.Unmarshal([]byte(field), &number); err != nil {
+			return nil, fmt.Errorf("column %s is not a number: %q", c.name, field)
+		}
+		return json.Number(field), nil
+	default:
+		value, err := strconv.ParseBool(field)
+		if err != nil {
+			return nil, fmt.Errorf("column %s is not a boolean: %q", c.name, field)
+		}
+		return value, nil
+	}
+}
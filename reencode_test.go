@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// reencode invokes a re-encoding invoker for encoding and csvHeaders with
+// data and returns the input and content type that the function received.
+func reencode(t *testing.T, encoding string, csvHeaders string, data string) (string, string, error) {
+	t.Helper()
+	var received, contentType string
+	invoker, err := newReencodingInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		received = string(input.Data)
+		metadata, _ := runner.MetadataFromContext(ctx)
+		contentType = metadata[contentTypeKey]
+		return &fnrun.Result{Status: 200}, nil
+	}), encoding, csvHeaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = invoker.Invoke(context.Background(), &fnrun.Input{Data: []byte(data)})
+	return received, contentType, err
+}
+
+// assertJSONEqual fails the test unless got and want hold equivalent JSON.
+func assertJSONEqual(t *testing.T, got string, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestReencodingInvokerConvertsXMLToJSON(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<order id="42" xmlns="urn:orders">
+  <customer>Ada</customer>
+  <item sku="a1">2</item>
+  <item sku="b2">1</item>
+  <note>  rush  </note>
+  <empty/>
+</order>`
+
+	received, contentType, err := reencode(t, "xml", "", xml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, received, `{"order": {
+		"@id": "42",
+		"@xmlns": "urn:orders",
+		"customer": "Ada",
+		"item": [{"@sku": "a1", "#text": "2"}, {"@sku": "b2", "#text": "1"}],
+		"note": "rush",
+		"empty": ""
+	}}`)
+	if contentType != contentTypeJSON {
+		t.Errorf("expected the content type %s, got %q", contentTypeJSON, contentType)
+	}
+}
+
+func TestReencodingInvokerConvertsCSVToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		data    string
+		want    string
+	}{
+		{
+			name: "header record",
+			data: "name,city\nAda,London\nGrace,\"New York, NY\"\n",
+			want: `[{"name": "Ada", "city": "London"}, {"name": "Grace", "city": "New York, NY"}]`,
+		},
+		{
+			name:    "CSV_HEADERS",
+			headers: "name,id:number,active:bool",
+			data:    "Ada,1,true\nGrace,2.5,false\nAlan,,\n",
+			want: `[
+				{"name": "Ada", "id": 1, "active": true},
+				{"name": "Grace", "id": 2.5, "active": false},
+				{"name": "Alan", "id": null, "active": null}
+			]`,
+		},
+		{
+			name: "typed header record",
+			data: "id:number\n7\n",
+			want: `[{"id": 7}]`,
+		},
+		{
+			name: "no records",
+			data: "name\n",
+			want: `[]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, _, err := reencode(t, "csv", tt.headers, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSONEqual(t, received, tt.want)
+		})
+	}
+}
+
+func TestReencodingInvokerRejectsInvalidInputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		headers  string
+		data     string
+	}{
+		{"malformed XML", "xml", "", "<order><item></order>"},
+		{"record length", "csv", "a,b", "1,2\n3\n"},
+		{"not a number", "csv", "id:number", "one\n"},
+		{"not a boolean", "csv", "active:bool", "maybe\n"},
+		{"invalid header record", "csv", "", "id:date\n1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, _, err := reencode(t, tt.encoding, tt.headers, tt.data)
+			if err == nil {
+				t.Error("expected an error")
+			}
+			if received != "" {
+				t.Errorf("expected the function not to be invoked, got %q", received)
+			}
+		})
+	}
+}
+
+func TestNewReencodingInvokerConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		headers  string
+		wantName string
+		wantErr  string
+	}{
+		{"unknown encoding", "yaml", "", "INPUT_ENCODING", "Unknown INPUT_ENCODING yaml"},
+		{"unknown type", "csv", "id:date", "CSV_HEADERS", "unknown type date of column id"},
+		{"empty name", "csv", "id,,name", "CSV_HEADERS", "column 2 has no name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newReencodingInvoker(nil, tt.encoding, tt.headers)
+			checkConfigError(t, err, tt.wantName, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// replayRecord is a single line of a replay log. A record produced by
+// marshaling an fnrun.Input is also accepted; it has no time, so it is replayed
+// immediately. If the record has a correlation ID, it is replayed with the ID
+// in the x-correlation-id metadata key.
+type replayRecord struct {
+	Time          time.Time `json:"time"`
+	Data          []byte    `json:"data"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+}
+
+// replayOutput is written to stdout for every replayed invocation.
+type replayOutput struct {
+	Status int               `json:"status"`
+	Data   []byte            `json:"data,omitempty"`
+	Env    map[string]string `json:"env,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// runReplay invokes the function with every input in the newline-delimited
+// JSON log at path, in order, and writes the results to stdout. Inputs pass
+// through the configured middleware, but no sinks are called.
+//
+// If speed is greater than zero, the delay between invocations matches the
+// delay between the recorded times divided by speed; otherwise inputs are
+// replayed as fast as possible.
+func runReplay(path string, speed float64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	invoker, err := getInvoker()
+	if err != nil {
+		return err
+	}
+	defer invoker.Close()
+
+	pipeline, pipelineCloser, err := getPipeline(invoker, nil)
+	if err != nil {
+		return err
+	}
+	defer pipelineCloser.Close()
+
+	return invokeNDJSON(context.Background(), pipeline, file, os.Stdout, speed)
+}
+
+// invokeNDJSON reads newline-delimited replay records from r, invokes invoker
+// with each in order, and writes a newline-delimited replayOutput for each to
+// w. Records are paced according to speed as described for runReplay.
+func invokeNDJSON(ctx context.Context, invoker fnrun.Invoker, r io.Reader, w io.Writer, speed float64) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	encoder := json.NewEncoder(w)
+
+	var previous time.Time
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record replayRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return err
+		}
+
+		if speed > 0 && !previous.IsZero() && record.Time.After(previous) {
+			time.Sleep(time.Duration(float64(record.Time.Sub(previous)) / speed))
+		}
+		if !record.Time.IsZero() {
+			previous = record.Time
+		}
+
+		invokeCtx := ctx
+		if record.CorrelationID != "" {
+			invokeCtx = runner.WithMetadata(ctx, map[string]string{correlationIDKey: record.CorrelationID})
+		}
+
+		output := replayOutput{}
+		result, err := invoker.Invoke(invokeCtx, &fnrun.Input{Data: record.Data})
+		if err != nil {
+			output.Error = err.Error()
+		} else {
+			output.Status = result.Status
+			output.Data = result.Data
+			output.Env = result.Env
+		}
+
+		if err := encoder.Encode(output); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestInvokeNDJSONReplaysInputsInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inputs.ndjson")
+	var log bytes.Buffer
+	encoder := json.NewEncoder(&log)
+	for i := 0; i < 10; i++ {
+		encoder.Encode(replayRecord{Data: []byte(fmt.Sprint("input-", i)), CorrelationID: fmt.Sprint("id-", i)})
+		if i == 4 {
+			log.WriteString("\n")
+		}
+	}
+	if err := ioutil.WriteFile(path, log.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayed []string
+	invoker := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		metadata, _ := runner.MetadataFromContext(ctx)
+		replayed = append(replayed, string(input.Data)+"/"+metadata[correlationIDKey])
+		if len(replayed) == 10 {
+			return nil, errors.New("failed")
+		}
+		return &fnrun.Result{Status: 200, Data: input.Data}, nil
+	})
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var out bytes.Buffer
+	if err := invokeNDJSON(context.Background(), invoker, file, &out, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(replayed) != 10 {
+		t.Fatalf("expected 10 inputs to be replayed, got %d", len(replayed))
+	}
+	for i, input := range replayed {
+		if want := fmt.Sprintf("input-%d/id-%d", i, i); input != want {
+			t.Errorf("expected input %d to be %s, got %s", i, want, input)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("expected 10 outputs, got %d", len(lines))
+	}
+	var first, last replayOutput
+	json.Unmarshal([]byte(lines[0]), &first)
+	json.Unmarshal([]byte(lines[9]), &last)
+	if first.Status != 200 || string(first.Data) != "input-0" {
+		t.Errorf("unexpected first output %+v", first)
+	}
+	if last.Error != "failed" {
+		t.Errorf("expected the last output to carry the error, got %+v", last)
+	}
+}
+
+func TestInvokeNDJSONPacesRecordsBySpeed(t *testing.T) {
+	start := time.Now()
+	var log bytes.Buffer
+	encoder := json.NewEncoder(&log)
+	encoder.Encode(replayRecord{Time: start, Data: []byte("a")})
+	encoder.Encode(replayRecord{Time: start.Add(200 * time.Millisecond), Data: []byte("b")})
+
+	began := time.Now()
+	if err := invokeNDJSON(context.Background(), echoInvoker{}, &log, &bytes.Buffer{}, 4); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(began); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected the records to be 50ms apart at 4x speed, took %v", elapsed)
+	}
+}
+
+func TestInvokeNDJSONRejectsInvalidRecords(t *testing.T) {
+	if err := invokeNDJSON(context.Background(), echoInvoker{}, strings.NewReader("not json\n"), &bytes.Buffer{}, 0); err == nil {
+		t.Error("expected an error for an invalid record")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// Response Cache
+//
+// The response cache lets the HTTP source answer a retried request without
+// invoking the function again. A request that carries an idempotency key in
+// the configured header claims the key; once its invocation succeeds, its
+// status and data are stored under the key for the TTL, and later requests
+// with the same key receive them without being invoked. A request that arrives
+// while the key is claimed waits for the first to finish. If the invocation
+// fails, the key is released so that the next request with it is invoked.
+//
+// Keys are scoped to the authenticated caller, if any, so that callers cannot
+// read each other's responses. Expired responses are removed as new keys are
+// claimed. Since keys are chosen by the client, at most maxEntries responses
+// are kept; storing a response beyond that evicts the oldest stored response.
+
+type cachedResponse struct {
+	status  int
+	data    []byte
+	expires time.Time
+	done    chan struct{}
+	// element is the position of a stored response in the order of the cache.
+	element *list.Element
+}
+
+type responseCache struct {
+	header     string
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+	mu         sync.Mutex
+	entries    map[string]*cachedResponse
+	// order holds the keys of the stored responses, oldest first.
+	order     *list.List
+	nextSweep time.Time
+}
+
+func newResponseCache(header string, ttl time.Duration, maxEntries int) *responseCache {
+	return &responseCache{
+		header:     header,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*cachedResponse),
+		order:      list.New(),
+	}
+}
+
+// claim returns the response cached for key, or nil if the caller has claimed
+// key and must invoke the function and then store or release the key.
+func (rc *responseCache) claim(ctx context.Context, key string) (*cachedResponse, error) {
+	for {
+		rc.mu.Lock()
+		now := rc.now()
+		rc.sweep(now)
+
+		entry, ok := rc.entries[key]
+		if !ok || (entry.done == nil && !now.Before(entry.expires)) {
+			if ok {
+				rc.order.Remove(entry.element)
+			}
+			rc.entries[key] = &cachedResponse{done: make(chan struct{})}
+			rc.mu.Unlock()
+			return nil, nil
+		}
+		done := entry.done
+		rc.mu.Unlock()
+
+		if done == nil {
+			return entry, nil
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// store caches the response of the invocation that claimed key, evicting the
+// oldest stored responses beyond maxEntries.
+func (rc *responseCache) store(key string, status int, data []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if entry, ok := rc.entries[key]; ok {
+		if entry.done != nil {
+			close(entry.done)
+		} else {
+			rc.order.Remove(entry.element)
+		}
+	}
+	rc.entries[key] = &cachedResponse{
+		status:  status,
+		data:    data,
+		expires: rc.now().Add(rc.ttl),
+		element: rc.order.PushBack(key),
+	}
+
+	for rc.maxEntries > 0 && rc.order.Len() > rc.maxEntries {
+		delete(rc.entries, rc.order.Remove(rc.order.Front()).(string))
+	}
+}
+
+// release gives up the claim on key without caching a response.
+func (rc *responseCache) release(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if entry, ok := rc.entries[key]; ok && entry.done != nil {
+		close(entry.done)
+		delete(rc.entries, key)
+	}
+}
+
+// sweep removes expired responses at most once per TTL. The caller must hold
+// rc.mu.
+func (rc *responseCache) sweep(now time.Time) {
+	if now.Before(rc.nextSweep) {
+		return
+	}
+	for key, entry := range rc.entries {
+		if entry.done == nil && !now.Before(entry.expires) {
+			rc.order.Remove(entry.element)
+			delete(rc.entries, key)
+		}
+	}
+	rc.nextSweep = now.Add(rc.ttl)
+}
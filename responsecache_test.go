@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// postWithIdempotencyKey posts body to the HTTP source at addr with key in the
+// Idempotency-Key header and returns the status and body of the response.
+func postWithIdempotencyKey(t *testing.T, addr string, key string, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Idempotency-Key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+func TestHTTPSourceAnswersRepeatedIdempotencyKeysFromTheCache(t *testing.T) {
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 0, 0, nil, nil, nil, newResponseCache("Idempotency-Key", time.Hour, 0), nil, 1, nil)
+	var invocations int64
+	runHTTPSource(t, addr, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		n := atomic.AddInt64(&invocations, 1)
+		return &fnrun.Result{Status: 201, Data: []byte(fmt.Sprintf("invocation %d", n))}, nil
+	}))
+
+	status, first := postWithIdempotencyKey(t, addr, "order-1", "x")
+	if status != 201 {
+		t.Fatalf("expected status 201, got %d", status)
+	}
+	status, second := postWithIdempotencyKey(t, addr, "order-1", "x")
+	if status != 201 || second != first {
+		t.Errorf("expected the cached response %q, got %d %q", first, status, second)
+	}
+	if n := atomic.LoadInt64(&invocations); n != 1 {
+		t.Errorf("expected 1 invocation for the repeated key, got %d", n)
+	}
+
+	if _, body := postWithIdempotencyKey(t, addr, "order-2", "x"); body == first {
+		t.Error("expected another key to be invoked")
+	}
+	if n := atomic.LoadInt64(&invocations); n != 2 {
+		t.Errorf("expected 2 invocations, got %d", n)
+	}
+}
+
+func TestHTTPSourceInvokesAgainAfterAFailure(t *testing.T) {
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 0, 0, nil, nil, nil, newResponseCache("Idempotency-Key", time.Hour, 0), nil, 1, nil)
+	var invocations int64
+	runHTTPSource(t, addr, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if atomic.AddInt64(&invocations, 1) == 1 {
+			return nil, errors.New("failed")
+		}
+		return &fnrun.Result{Status: 200, Data: []byte("ok")}, nil
+	}))
+
+	if status, _ := postWithIdempotencyKey(t, addr, "order-1", "x"); status != http.StatusInternalServerError {
+		t.Errorf("expected the failure to be returned, got status %d", status)
+	}
+	if status, body := postWithIdempotencyKey(t, addr, "order-1", "x"); status != 200 || body != "ok" {
+		t.Errorf("expected the retried request to be invoked, got %d %q", status, body)
+	}
+	if n := atomic.LoadInt64(&invocations); n != 2 {
+		t.Errorf("expected 2 invocations, got %d", n)
+	}
+}
+
+func TestResponseCacheExpiresResponses(t *testing.T) {
+	rc := newResponseCache("Idempotency-Key", time.Minute, 0)
+	now := time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC)
+	rc.now = func() time.Time { return now }
+
+	if cached, err := rc.claim(context.Background(), "k"); cached != nil || err != nil {
+		t.Fatalf("expected to claim the key, got %v, %v", cached, err)
+	}
+	rc.store("k", 200, []byte("ok"))
+
+	now = now.Add(59 * time.Second)
+	if cached, _ := rc.claim(context.Background(), "k"); cached == nil || string(cached.data) != "ok" {
+		t.Errorf("expected the cached response within the TTL, got %v", cached)
+	}
+	now = now.Add(time.Second)
+	if cached, _ := rc.claim(context.Background(), "k"); cached != nil {
+		t.Errorf("expected the key to be claimed again after the TTL, got %v", cached)
+	}
+}
+
+func TestResponseCacheEvictsTheOldestResponses(t *testing.T) {
+	rc := newResponseCache("Idempotency-Key", time.Hour, 2)
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprint("k", i)
+		if cached, err := rc.claim(context.Background(), key); cached != nil || err != nil {
+			t.Fatalf("expected to claim %s, got %v, %v", key, cached, err)
+		}
+		rc.store(key, 200, []byte(key))
+	}
+
+	if len(rc.entries) != 2 || rc.order.Len() != 2 {
+		t.Errorf("expected 2 cached responses, got %d entries and %d in order", len(rc.entries), rc.order.Len())
+	}
+	for _, key := range []string{"k1", "k2"} {
+		if cached, _ := rc.claim(context.Background(), key); cached == nil || string(cached.data) != key {
+			t.Errorf("expected the response for %s to be kept, got %v", key, cached)
+		}
+	}
+	if cached, _ := rc.claim(context.Background(), "k0"); cached != nil {
+		t.Errorf("expected the oldest response to be evicted, got %v", cached)
+	}
+
+	// Storing the response for the reclaimed key evicts the next oldest.
+	rc.store("k0", 200, []byte("again"))
+	if cached, _ := rc.claim(context.Background(), "k1"); cached != nil {
+		t.Errorf("expected k1 to be evicted, got %v", cached)
+	}
+}
+
+func TestResponseCacheWaitsForTheClaimingRequest(t *testing.T) {
+	rc := newResponseCache("Idempotency-Key", time.Minute, 0)
+	if cached, _ := rc.claim(context.Background(), "k"); cached != nil {
+		t.Fatal("expected to claim the key")
+	}
+
+	claimed := make(chan *cachedResponse, 1)
+	go func() {
+		cached, _ := rc.claim(context.Background(), "k")
+		claimed <- cached
+	}()
+	select {
+	case <-claimed:
+		t.Fatal("expected the second request to wait for the first")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	rc.store("k", 200, []byte("ok"))
+	select {
+	case cached := <-claimed:
+		if cached == nil || string(cached.data) != "ok" {
+			t.Errorf("expected the response of the first request, got %v", cached)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the second request to receive the stored response")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rc.claim(context.Background(), "other")
+	cancel()
+	if _, err := rc.claim(ctx, "other"); err != context.Canceled {
+		t.Errorf("expected a cancelled wait to fail, got %v", err)
+	}
+}
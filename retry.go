@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const retryMaxBackoff = 30 * time.Second
+
+// -----------------------------------------------------------------------------
+// Retry Invoker
+//
+// The retry invoker re-invokes the function when it returns a result whose
+// status is one of a configured set of codes, such as 429 Too Many Requests.
+// The delay between attempts doubles after each retry. The result of the last
+// attempt is returned whether or not it succeeded; errors returned by the
+// underlying invoker, and invocations that produce no result, are not retried.
+// Retries are skipped for invocations for
+// which the retry feature flag is off.
+
+type retryInvoker struct {
+	invoker fnrun.Invoker
+	codes   map[int]bool
+	retries int
+	backoff time.Duration
+	flags   featureFlags
+}
+
+// parseStatusCodes parses a comma-separated list of integer status codes.
+func parseStatusCodes(list string) (map[int]bool, error) {
+	codes := make(map[int]bool)
+	for _, str := range strings.Split(list, ",") {
+		str = strings.TrimSpace(str)
+		if str == "" {
+			continue
+		}
+		code, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid status code %s", str)
+		}
+		codes[code] = true
+	}
+	return codes, nil
+}
+
+func (ri *retryInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	if !ri.flags.enabled(ctx, featureRetry) {
+		return ri.invoker.Invoke(ctx, input)
+	}
+
+	backoff := ri.backoff
+	for attempt := 0; ; attempt++ {
+		result, err := ri.invoker.Invoke(ctx, input)
+		if err != nil || result == nil || !ri.codes[result.Status] || attempt >= ri.retries {
+			return result, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return result, nil
+		}
+		stats.recordRetry()
+		backoff *= 2
+		if backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Full Retry Invoker
+//
+// The full retry invoker repeats the whole invocation, including the function
+// and the sink, when it fails because no function process could take it: the
+// pool was exhausted (runner.PoolExhaustedError) or the process was being
+// started (runner.ErrInvokerStarting). Such invocations never reached the
+// function, so repeating them is safe. The delay between attempts doubles after
+// each retry, and the error of the last attempt is returned. Like the retry
+// invoker, it is governed by the retry feature flag.
+
+type fullRetryInvoker struct {
+	invoker fnrun.Invoker
+	retries int
+	backoff time.Duration
+	flags   featureFlags
+}
+
+// isRetryableInvocationError reports whether err indicates that the
+// invocation failed before it reached the function.
+func isRetryableInvocationError(err error) bool {
+	var exhausted *runner.PoolExhaustedError
+	return errors.As(err, &exhausted) || errors.Is(err, runner.ErrInvokerStarting)
+}
+
+func (fi *fullRetryInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	if !fi.flags.enabled(ctx, featureRetry) {
+		return fi.invoker.Invoke(ctx, input)
+	}
+
+	backoff := fi.backoff
+	for attempt := 0; ; attempt++ {
+		result, err := fi.invoker.Invoke(ctx, input)
+		if err == nil || !isRetryableInvocationError(err) || attempt >= fi.retries {
+			return result, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return result, err
+		}
+		stats.recordRetry()
+		backoff *= 2
+		if backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Startup Retry Invoker
+//
+// The startup retry invoker covers the window after the runner starts in which
+// the pool may be exhausted, or its processes still starting, before it has
+// warmed up. Until the first invocation succeeds, an invocation that fails
+// because no function process could take it is repeated up to retries times,
+// starting with a short delay that doubles after each retry. Once an
+// invocation has succeeded, new invocations are passed through and only the
+// normal retry policy applies; invocations already being retried keep going.
+// Like the other retry invokers, it is governed by the retry feature flag.
+
+type startupRetryInvoker struct {
+	invoker fnrun.Invoker
+	retries int
+	backoff time.Duration
+	flags   featureFlags
+	started int32
+}
+
+func (si *startupRetryInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	if atomic.LoadInt32(&si.started) == 1 || !si.flags.enabled(ctx, featureRetry) {
+		return si.invoker.Invoke(ctx, input)
+	}
+
+	backoff := si.backoff
+	for attempt := 0; ; attempt++ {
+		result, err := si.invoker.Invoke(ctx, input)
+		if err == nil {
+			atomic.StoreInt32(&si.started, 1)
+			return result, nil
+		}
+		if !isRetryableInvocationError(err) || attempt >= si.retries {
+			return result, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return result, err
+		}
+		stats.recordRetry()
+		backoff *= 2
+		if backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
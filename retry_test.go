@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+	runnertesting "github.com/tessellator/fnrun-runner/runner/testing"
+)
+
+func TestRetryInvokerRetriesConfiguredStatusCodes(t *testing.T) {
+	statuses := []int{429, 429, 200}
+	var calls int
+	ri := &retryInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			status := statuses[calls]
+			calls++
+			return &fnrun.Result{Status: status}, nil
+		}),
+		codes:   map[int]bool{429: true},
+		retries: 3,
+		backoff: time.Millisecond,
+	}
+
+	result, err := ri.Invoke(context.Background(), &fnrun.Input{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != 200 {
+		t.Errorf("expected status 200, got %d", result.Status)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 invocations, got %d", calls)
+	}
+}
+
+func TestRetryInvokerReturnsLastResultWhenRetriesAreExhausted(t *testing.T) {
+	var calls int
+	ri := &retryInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			calls++
+			return &fnrun.Result{Status: 503}, nil
+		}),
+		codes:   map[int]bool{503: true},
+		retries: 2,
+		backoff: time.Millisecond,
+	}
+
+	result, _ := ri.Invoke(context.Background(), &fnrun.Input{})
+	if result.Status != 503 {
+		t.Errorf("expected status 503, got %d", result.Status)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 invocations, got %d", calls)
+	}
+}
+
+func TestRetryInvokerDoesNotRetryNilResults(t *testing.T) {
+	var calls int
+	ri := &retryInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			calls++
+			return nil, nil
+		}),
+		codes:   map[int]bool{0: true},
+		retries: 3,
+		backoff: time.Millisecond,
+	}
+
+	result, err := ri.Invoke(context.Background(), &fnrun.Input{})
+	if result != nil || err != nil {
+		t.Errorf("expected a nil result and error, got %v, %v", result, err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 invocation, got %d", calls)
+	}
+}
+
+func TestParseStatusCodes(t *testing.T) {
+	codes, err := parseStatusCodes("429, 503,,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(codes) != 2 || !codes[429] || !codes[503] {
+		t.Errorf("unexpected codes: %v", codes)
+	}
+
+	if _, err := parseStatusCodes("429,abc"); err == nil {
+		t.Error("expected an error for an invalid status code")
+	}
+}
+
+func TestFullRetryInvokerRetriesExhaustedPools(t *testing.T) {
+	exhausted := &runner.PoolExhaustedError{Err: errors.New("pool exhausted")}
+	pool := runnertesting.NewFakePool().
+		WithResult(&fnrun.Result{Status: 200}).
+		WillFailOnCall(1, exhausted).
+		WillFailOnCall(2, exhausted)
+	fi := &fullRetryInvoker{invoker: pool, retries: 3, backoff: time.Millisecond}
+
+	result, err := fi.Invoke(context.Background(), &fnrun.Input{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != 200 {
+		t.Errorf("expected the result of the successful attempt, got %+v", result)
+	}
+	if calls := len(pool.Calls()); calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestFullRetryInvokerStopsAfterMaxRetries(t *testing.T) {
+	pool := runnertesting.NewFakePool().WithError(runner.ErrInvokerStarting)
+	fi := &fullRetryInvoker{invoker: pool, retries: 2, backoff: time.Millisecond}
+
+	if _, err := fi.Invoke(context.Background(), &fnrun.Input{}); !errors.Is(err, runner.ErrInvokerStarting) {
+		t.Errorf("expected the error of the last attempt, got %v", err)
+	}
+	if calls := len(pool.Calls()); calls != 3 {
+		t.Errorf("expected the first attempt and 2 retries, got %d", calls)
+	}
+}
+
+func TestFullRetryInvokerDoesNotRetryFunctionErrors(t *testing.T) {
+	pool := runnertesting.NewFakePool().WithError(errors.New("function failed"))
+	fi := &fullRetryInvoker{invoker: pool, retries: 3, backoff: time.Millisecond}
+
+	if _, err := fi.Invoke(context.Background(), &fnrun.Input{}); err == nil {
+		t.Error("expected the error of the function")
+	}
+	if calls := len(pool.Calls()); calls != 1 {
+		t.Errorf("expected an error of the function not to be retried, got %d attempts", calls)
+	}
+}
+
+func TestStartupRetryInvokerRetriesExhaustionUntilWarm(t *testing.T) {
+	var failures int32 = 3
+	si := &startupRetryInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			if atomic.AddInt32(&failures, -1) >= 0 {
+				return nil, &runner.PoolExhaustedError{Err: errors.New("pool exhausted")}
+			}
+			return &fnrun.Result{Status: 200}, nil
+		}),
+		retries: 5,
+		backoff: time.Millisecond,
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := si.Invoke(context.Background(), &fnrun.Input{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("expected the invocation to succeed, got %v", err)
+		}
+	}
+	if atomic.LoadInt32(&si.started) != 1 {
+		t.Error("expected the invoker to be marked as started")
+	}
+}
+
+func TestStartupRetryInvokerPassesThroughOnceStarted(t *testing.T) {
+	var calls int
+	si := &startupRetryInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			calls++
+			return nil, runner.ErrInvokerStarting
+		}),
+		retries: 5,
+		backoff: time.Millisecond,
+		started: 1,
+	}
+
+	if _, err := si.Invoke(context.Background(), &fnrun.Input{}); err != runner.ErrInvokerStarting {
+		t.Errorf("expected ErrInvokerStarting, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 invocation, got %d", calls)
+	}
+}
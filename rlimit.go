@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// -----------------------------------------------------------------------------
+// Resource limits
+//
+// Go does not provide a way to set resource limits on a child process before it
+// executes, so the runner re-executes itself with rlimitExecArg as the first
+// argument. In that mode the runner applies the limits to its own process and
+// then replaces itself with the function command via exec(2).
+
+const rlimitExecArg = "__fnrun_rlimit_exec"
+
+var errRlimitsUnsupported = errors.New("function resource limits are not supported on this platform")
+
+// rlimits contains the resource limits to apply to function processes. A zero
+// value indicates that the corresponding limit should not be changed.
+type rlimits struct {
+	addressSpaceBytes uint64
+	openFiles         uint64
+	cpuSeconds        uint64
+}
+
+func (r rlimits) isEmpty() bool {
+	return r.addressSpaceBytes == 0 && r.openFiles == 0 && r.cpuSeconds == 0
+}
+
+func getUint64Env(name string) uint64 {
+	i, err := strconv.ParseUint(os.Getenv(name), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+func getRlimits() rlimits {
+	return rlimits{
+		// env: FUNCTION_RLIMIT_AS_BYTES uint 0 "Address space limit of function processes."
+		addressSpaceBytes: getUint64Env("FUNCTION_RLIMIT_AS_BYTES"),
+		// env: FUNCTION_RLIMIT_NOFILE uint 0 "Open file limit of function processes."
+		openFiles: getUint64Env("FUNCTION_RLIMIT_NOFILE"),
+		// env: FUNCTION_RLIMIT_CPU_SECONDS uint 0 "CPU time limit of function processes."
+		cpuSeconds: getUint64Env("FUNCTION_RLIMIT_CPU_SECONDS"),
+	}
+}
+
+// wrapCmdWithRlimits rewrites cmd so that it is started through the runner's
+// rlimit trampoline. The limits are passed to the trampoline in the
+// FUNCTION_RLIMIT_* environment variables.
+func wrapCmdWithRlimits(cmd *exec.Cmd, limits rlimits) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd.Env = append(cmd.Env,
+		"FUNCTION_RLIMIT_AS_BYTES="+strconv.FormatUint(limits.addressSpaceBytes, 10),
+		"FUNCTION_RLIMIT_NOFILE="+strconv.FormatUint(limits.openFiles, 10),
+		"FUNCTION_RLIMIT_CPU_SECONDS="+strconv.FormatUint(limits.cpuSeconds, 10),
+	)
+
+	args := append([]string{self, rlimitExecArg, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = self
+	cmd.Args = args
+	return nil
+}
+
+// runRlimitTrampoline applies the configured resource limits and CPU affinity
+// and executes the command in args. It only returns if the command could not
+// be executed.
+func runRlimitTrampoline(args []string) error {
+	if err := applyRlimits(getRlimits()); err != nil {
+		return err
+	}
+
+	if cpu := os.Getenv(cpuAffinityEnvName); cpu != "" {
+		id, err := strconv.Atoi(cpu)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", cpuAffinityEnvName, cpu)
+		}
+		// The affinity is set on the calling thread, which must be the one
+		// that executes the command for the command to inherit it.
+		runtime.LockOSThread()
+		if err := setCPUAffinity(id); err != nil {
+			return err
+		}
+	}
+
+	return execCommand(args[0], args, os.Environ())
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+const rlimitsSupported = false
+
+func applyRlimits(limits rlimits) error {
+	if limits.isEmpty() {
+		return nil
+	}
+	return errRlimitsUnsupported
+}
+
+func execCommand(path string, args []string, env []string) error {
+	return errRlimitsUnsupported
+}
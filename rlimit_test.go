@@ -0,0 +1,61 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestGetRlimits(t *testing.T) {
+	t.Setenv("FUNCTION_RLIMIT_AS_BYTES", "1073741824")
+	t.Setenv("FUNCTION_RLIMIT_NOFILE", "64")
+	t.Setenv("FUNCTION_RLIMIT_CPU_SECONDS", "invalid")
+
+	limits := getRlimits()
+	if limits.addressSpaceBytes != 1<<30 || limits.openFiles != 64 || limits.cpuSeconds != 0 {
+		t.Errorf("unexpected limits %+v", limits)
+	}
+	if limits.isEmpty() {
+		t.Error("expected the limits not to be empty")
+	}
+	if !(rlimits{}).isEmpty() {
+		t.Error("expected the zero limits to be empty")
+	}
+}
+
+func TestFunctionExceedingAddressSpaceLimitIsKilled(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector reserves more address space than the limit")
+	}
+	// The Go runtime occasionally fails to start within 1GiB of address
+	// space, so the limit leaves it room.
+	cmd := testFunctionCmd("alloc")
+	if err := wrapCmdWithRlimits(cmd, rlimits{addressSpaceBytes: 2 << 30}); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := newSizedInvokerPool(newCmdInvokerFactory(cmd, time.Second, nil), "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	invoke := func(bytes int) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err := pool.Invoke(ctx, &fnrun.Input{Data: []byte(strconv.Itoa(bytes))})
+		return err
+	}
+
+	if err := invoke(1 << 20); err != nil {
+		t.Fatalf("expected an allocation within the limit to succeed, got %v", err)
+	}
+	if err := invoke(4 << 30); err == nil {
+		t.Error("expected the process allocating beyond the limit to be killed")
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import "syscall"
+
+const rlimitsSupported = true
+
+func applyRlimits(limits rlimits) error {
+	if limits.addressSpaceBytes != 0 {
+		if err := setRlimit(syscall.RLIMIT_AS, limits.addressSpaceBytes); err != nil {
+			return err
+		}
+	}
+
+	if limits.openFiles != 0 {
+		if err := setRlimit(syscall.RLIMIT_NOFILE, limits.openFiles); err != nil {
+			return err
+		}
+	}
+
+	if limits.cpuSeconds != 0 {
+		if err := setRlimit(syscall.RLIMIT_CPU, limits.cpuSeconds); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setRlimit(resource int, value uint64) error {
+	limit := syscall.Rlimit{Cur: value, Max: value}
+	return syscall.Setrlimit(resource, &limit)
+}
+
+func execCommand(path string, args []string, env []string) error {
+	return syscall.Exec(path, args, env)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Weighted Router
+//
+// The weighted router splits invocations between two invokers at random. It is
+// intended for canary deployments, where a percentage of traffic is sent to a
+// new version of a function.
+
+type weightedRouter struct {
+	a       closableInvoker
+	b       closableInvoker
+	weightB int
+	mu      sync.Mutex
+	rand    *rand.Rand
+}
+
+// newWeightedRouter creates a router that sends weightB percent of invocations
+// to b and the remainder to a.
+func newWeightedRouter(a closableInvoker, b closableInvoker, weightB int) *weightedRouter {
+	return &weightedRouter{
+		a:       a,
+		b:       b,
+		weightB: weightB,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (wr *weightedRouter) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	wr.mu.Lock()
+	n := wr.rand.Intn(100)
+	wr.mu.Unlock()
+
+	if n < wr.weightB {
+		return wr.b.Invoke(ctx, input)
+	}
+	return wr.a.Invoke(ctx, input)
+}
+
+func (wr *weightedRouter) queueDepth() int {
+	return totalQueueDepth(wr.a) + totalQueueDepth(wr.b)
+}
+
+func (wr *weightedRouter) utilization() (active int, capacity int) {
+	activeA, capacityA := totalUtilization(wr.a)
+	activeB, capacityB := totalUtilization(wr.b)
+	return activeA + activeB, capacityA + capacityB
+}
+
+func (wr *weightedRouter) capacity() (slots int, prioritySlots int) {
+	slotsA, prioritySlotsA := totalCapacity(wr.a)
+	slotsB, prioritySlotsB := totalCapacity(wr.b)
+	return slotsA + slotsB, prioritySlotsA + prioritySlotsB
+}
+
+func (wr *weightedRouter) functionProcesses() []*trackedProcess {
+	return append(allFunctionProcesses(wr.a), allFunctionProcesses(wr.b)...)
+}
+
+// Close closes both invokers.
+func (wr *weightedRouter) Close() error {
+	errA := wr.a.Close()
+	errB := wr.b.Close()
+	if errA != nil {
+		return errA
+	}
+	return errB
+}
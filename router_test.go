@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+// countingInvoker is a closableInvoker that counts its invocations.
+type countingInvoker struct {
+	invocations int64
+	closed      int64
+}
+
+func (ci *countingInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	atomic.AddInt64(&ci.invocations, 1)
+	return &fnrun.Result{}, nil
+}
+
+func (ci *countingInvoker) Close() error {
+	atomic.AddInt64(&ci.closed, 1)
+	return nil
+}
+
+func (ci *countingInvoker) count() int {
+	return int(atomic.LoadInt64(&ci.invocations))
+}
+
+func TestWeightedRouterSplitsInvocationsByWeight(t *testing.T) {
+	a, b := &countingInvoker{}, &countingInvoker{}
+	router := newWeightedRouter(a, b, 10)
+
+	for i := 0; i < 1000; i++ {
+		if _, err := router.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if a.count()+b.count() != 1000 {
+		t.Fatalf("expected 1000 invocations, got %d", a.count()+b.count())
+	}
+	if n := b.count(); n < 60 || n > 140 {
+		t.Errorf("expected about 100 invocations of b, got %d", n)
+	}
+}
+
+func TestWeightedRouterWithExtremeWeights(t *testing.T) {
+	for _, weight := range []int{0, 100} {
+		a, b := &countingInvoker{}, &countingInvoker{}
+		router := newWeightedRouter(a, b, weight)
+		for i := 0; i < 100; i++ {
+			router.Invoke(context.Background(), &fnrun.Input{})
+		}
+		if got := b.count(); got != weight {
+			t.Errorf("expected %d invocations of b at weight %d, got %d", weight, weight, got)
+		}
+	}
+}
+
+func TestWeightedRouterClosesBothInvokers(t *testing.T) {
+	a, b := &countingInvoker{}, &countingInvoker{}
+	if err := newWeightedRouter(a, b, 50).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if a.closed != 1 || b.closed != 1 {
+		t.Errorf("expected both invokers to be closed, got %d and %d", a.closed, b.closed)
+	}
+}
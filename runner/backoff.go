@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// maxConnectBackoff bounds the delay between connection attempts.
+const maxConnectBackoff = 30 * time.Second
+
+// ConnectWithBackoff calls dial until it succeeds, retrying up to maxRetries
+// times after the first failure. The delay before the first retry is base and
+// doubles after each retry, up to 30 seconds. Each retry is logged. If every
+// attempt fails, the returned error reports the number of attempts and wraps
+// the error of the last one.
+//
+// Sources and sinks that connect to a network service should use
+// ConnectWithBackoff so that transient connection errors are handled
+// consistently.
+func ConnectWithBackoff(dial func() error, maxRetries int, base time.Duration) error {
+	backoff := base
+	for attempt := 0; ; attempt++ {
+		err := dial()
+		if err == nil {
+			return nil
+		}
+		if attempt >= maxRetries {
+			return fmt.Errorf("could not connect after %d attempt(s): %w", attempt+1, err)
+		}
+
+		log.Printf("connection attempt %d failed, retrying in %v: %v", attempt+1, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
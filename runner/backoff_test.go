@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingDial returns a dial function that fails the first failures times it
+// is called, and records the time of each call.
+func failingDial(failures int) (func() error, *[]time.Time) {
+	var calls []time.Time
+	return func() error {
+		calls = append(calls, time.Now())
+		if len(calls) <= failures {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, &calls
+}
+
+func TestConnectWithBackoffRetriesUntilTheDialSucceeds(t *testing.T) {
+	dial, calls := failingDial(3)
+	if err := ConnectWithBackoff(dial, 5, 10*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*calls) != 4 {
+		t.Fatalf("expected 3 retries after the first attempt, got %d calls", len(*calls))
+	}
+
+	// The delay doubles after each retry: 10ms, 20ms and 40ms.
+	for i, want := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond} {
+		delay := (*calls)[i+1].Sub((*calls)[i])
+		if delay < want || delay > want+200*time.Millisecond {
+			t.Errorf("expected retry %d to wait about %v, waited %v", i+1, want, delay)
+		}
+	}
+}
+
+func TestConnectWithBackoffGivesUpAfterMaxRetries(t *testing.T) {
+	dial, calls := failingDial(10)
+	err := ConnectWithBackoff(dial, 2, time.Millisecond)
+	if err == nil {
+		t.Fatal("expected an error after exhausting the retries")
+	}
+	if len(*calls) != 3 {
+		t.Errorf("expected the first attempt and 2 retries, got %d calls", len(*calls))
+	}
+	if err.Error() != "could not connect after 3 attempt(s): connection refused" {
+		t.Errorf("expected the error to summarize the attempts and wrap the last error, got %q", err)
+	}
+}
+
+func TestConnectWithBackoffWithoutRetries(t *testing.T) {
+	dial, calls := failingDial(1)
+	if err := ConnectWithBackoff(dial, 0, time.Millisecond); err == nil {
+		t.Error("expected the error of the only attempt")
+	}
+	if len(*calls) != 1 {
+		t.Errorf("expected a single attempt, got %d calls", len(*calls))
+	}
+}
@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"context"
+	"sync"
+)
+
+// CheckpointStore persists the progress of a source so that it can resume
+// after the runner restarts.
+type CheckpointStore interface {
+	Save(ctx context.Context, checkpoint []byte) error
+	Load(ctx context.Context) ([]byte, error)
+}
+
+// Checkpoint holds the most recent progress reported by a source.
+//
+// The runner places a Checkpoint in the source context under CheckpointKey. Its
+// initial value is the checkpoint loaded from the CheckpointStore on startup;
+// the source calls Set as it makes progress, and the runner periodically saves
+// the latest value.
+type Checkpoint struct {
+	mu      sync.Mutex
+	data    []byte
+	version uint64
+}
+
+// NewCheckpoint creates a Checkpoint with the provided initial data.
+func NewCheckpoint(data []byte) *Checkpoint {
+	return &Checkpoint{data: data}
+}
+
+// Data returns the current checkpoint data.
+func (c *Checkpoint) Data() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.data
+}
+
+// Set records new checkpoint data.
+func (c *Checkpoint) Set(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data = data
+	c.version++
+}
+
+// Version returns a counter that is incremented on every call to Set.
+func (c *Checkpoint) Version() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// WithCheckpoint returns a copy of ctx that carries the provided checkpoint.
+func WithCheckpoint(ctx context.Context, checkpoint *Checkpoint) context.Context {
+	return context.WithValue(ctx, CheckpointKey, checkpoint)
+}
+
+// CheckpointFromContext returns the checkpoint stored in ctx, if any.
+func CheckpointFromContext(ctx context.Context) (*Checkpoint, bool) {
+	checkpoint, hasCheckpoint := ctx.Value(CheckpointKey).(*Checkpoint)
+	return checkpoint, hasCheckpoint
+}
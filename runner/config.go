@@ -0,0 +1,35 @@
+package runner
+
+// RunConfig is the configuration of the runner passed to a config mutator
+// plugin before the runner starts.
+//
+// The runner is configured by environment variables, and Env holds all of them.
+// The other fields hold the values of the most commonly adjusted variables,
+// named in their comments, and take precedence over Env when a mutator changes
+// them. A mutator may add, change or delete entries of Env to change any other
+// setting.
+type RunConfig struct {
+	// MaxFunctionCount is the number of function processes in the invoker
+	// pool (MAX_FUNCTION_COUNT).
+	MaxFunctionCount int
+
+	// MaxWaitMillis is how long an input waits for an available invoker
+	// (MAX_WAIT_MILLIS).
+	MaxWaitMillis int
+
+	// MaxExecMillis is how long an invocation may run (MAX_EXEC_MILLIS).
+	MaxExecMillis int
+
+	// FunctionCommand is the command that starts a function process
+	// (FUNCTION_COMMAND).
+	FunctionCommand string
+
+	// SourceType is the type of the event source (SOURCE_TYPE).
+	SourceType string
+
+	// SinkType is the type of the event sink (SINK_TYPE).
+	SinkType string
+
+	// Env holds the environment variables of the runner.
+	Env map[string]string
+}
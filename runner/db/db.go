@@ -0,0 +1,90 @@
+// Package db provides database connection pools that are shared by every
+// plugin loaded into the runner, so that sinks running in many goroutines (or
+// several sinks writing to the same database) do not each open their own
+// connections and exhaust the connection limit of the database.
+//
+// The runner closes all shared pools when it shuts down.
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+)
+
+type sharedPool struct {
+	once sync.Once
+	db   *sql.DB
+}
+
+var (
+	poolsMu sync.Mutex
+	pools   = make(map[string]*sharedPool)
+)
+
+// SharedPool returns the shared pool for dsn, creating it on first use with at
+// most maxConns open connections. The name of the driver is taken from the
+// scheme of dsn (e.g., postgres://...), and the whole DSN is passed to the
+// driver. Use SharedPoolForDriver for drivers whose DSNs are not URLs.
+//
+// SharedPool panics if the driver has not been registered.
+func SharedPool(dsn string, maxConns int) *sql.DB {
+	driver := dsn
+	if i := strings.Index(dsn, "://"); i >= 0 {
+		driver = dsn[:i]
+	}
+	return SharedPoolForDriver(driver, dsn, maxConns)
+}
+
+// SharedPoolForDriver returns the shared pool for dsn opened with driver,
+// creating it on first use with at most maxConns open connections. Later calls
+// for the same driver and DSN return the same pool, regardless of maxConns.
+//
+// SharedPoolForDriver panics if the driver has not been registered.
+func SharedPoolForDriver(driver string, dsn string, maxConns int) *sql.DB {
+	key := driver + "\x00" + dsn
+
+	poolsMu.Lock()
+	pool, ok := pools[key]
+	if !ok {
+		pool = &sharedPool{}
+		pools[key] = pool
+	}
+	poolsMu.Unlock()
+
+	pool.once.Do(func() {
+		db, err := sql.Open(driver, dsn)
+		if err != nil {
+			panic(err)
+		}
+		if maxConns > 0 {
+			db.SetMaxOpenConns(maxConns)
+			db.SetMaxIdleConns(maxConns)
+		}
+		pool.db = db
+	})
+
+	return pool.db
+}
+
+// CloseAll closes every shared pool and returns the first error encountered.
+// Pools requested after CloseAll are created anew.
+func CloseAll() error {
+	poolsMu.Lock()
+	closing := pools
+	pools = make(map[string]*sharedPool)
+	poolsMu.Unlock()
+
+	var firstErr error
+	for _, pool := range closing {
+		// Wait for a pool that is being opened.
+		pool.once.Do(func() {})
+		if pool.db == nil {
+			continue
+		}
+		if err := pool.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingDriver is a driver that counts the pools opened with it. It cannot
+// open connections.
+type countingDriver struct {
+	opened int32
+}
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("countingDriver cannot open connections")
+}
+
+func (d *countingDriver) OpenConnector(name string) (driver.Connector, error) {
+	atomic.AddInt32(&d.opened, 1)
+	return &countingConnector{d}, nil
+}
+
+type countingConnector struct {
+	driver *countingDriver
+}
+
+func (c *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c *countingConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+var testDriver = &countingDriver{}
+
+func init() {
+	sql.Register("fnrun-test", testDriver)
+}
+
+func TestSharedPoolIsCreatedOnce(t *testing.T) {
+	defer CloseAll()
+	before := atomic.LoadInt32(&testDriver.opened)
+
+	var wg sync.WaitGroup
+	dbs := make([]*sql.DB, 10)
+	for i := range dbs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dbs[i] = SharedPool("fnrun-test://db/app", 4)
+		}(i)
+	}
+	wg.Wait()
+
+	if opened := atomic.LoadInt32(&testDriver.opened) - before; opened != 1 {
+		t.Errorf("expected one sql.DB to be created, got %d", opened)
+	}
+	for i, db := range dbs {
+		if db != dbs[0] {
+			t.Errorf("expected call %d to return the shared pool", i)
+		}
+	}
+	if got := dbs[0].Stats().MaxOpenConnections; got != 4 {
+		t.Errorf("expected at most 4 open connections, got %d", got)
+	}
+
+	if other := SharedPool("fnrun-test://db/other", 4); other == dbs[0] {
+		t.Error("expected another DSN to have its own pool")
+	}
+}
+
+func TestCloseAllClosesTheSharedPools(t *testing.T) {
+	db := SharedPoolForDriver("fnrun-test", "app", 1)
+	if err := CloseAll(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := db.PingContext(context.Background()); err == nil || err.Error() != "sql: database is closed" {
+		t.Errorf("expected the pool to be closed, got %v", err)
+	}
+
+	reopened := SharedPoolForDriver("fnrun-test", "app", 1)
+	defer CloseAll()
+	if reopened == db {
+		t.Error("expected a pool requested after CloseAll to be created anew")
+	}
+}
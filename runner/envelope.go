@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// InvocationMeta describes a single invocation of the function.
+type InvocationMeta struct {
+	// CorrelationID identifies the event that was processed, if the source
+	// provided one.
+	CorrelationID string
+
+	// ProcessedAt is the time at which the function returned the result.
+	ProcessedAt time.Time
+
+	// Duration is how long the invocation took.
+	Duration time.Duration
+
+	// FunctionVersion is the version of the function that produced the
+	// result, if the runner serves more than one version.
+	FunctionVersion string
+}
+
+// ResultEnvelope is the standard format in which results are delivered to
+// sinks when the runner is configured to wrap them.
+type ResultEnvelope struct {
+	CorrelationID   string          `json:"correlation_id,omitempty"`
+	ProcessedAt     time.Time       `json:"processed_at"`
+	DurationMs      int64           `json:"duration_ms"`
+	FunctionVersion string          `json:"function_version,omitempty"`
+	Body            json.RawMessage `json:"body"`
+	Error           *string         `json:"error"`
+}
+
+// WrapResult returns the JSON encoding of the envelope for result. Result data
+// that is valid JSON is embedded in the body as is; any other data is embedded
+// as a JSON string. Results with a status of 400 or above have the error field
+// set.
+func WrapResult(result *fnrun.Result, meta InvocationMeta) ([]byte, error) {
+	body, err := EnvelopeBody(result.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := ResultEnvelope{
+		CorrelationID:   meta.CorrelationID,
+		ProcessedAt:     meta.ProcessedAt,
+		DurationMs:      int64(meta.Duration / time.Millisecond),
+		FunctionVersion: meta.FunctionVersion,
+		Body:            body,
+	}
+	if result.Status >= 400 {
+		msg := fmt.Sprintf("function returned status %d", result.Status)
+		envelope.Error = &msg
+	}
+
+	return json.Marshal(envelope)
+}
+
+// EnvelopeBody returns data as the body of an envelope: data that is valid JSON
+// is returned as is, any other data as a JSON string, and empty data as null.
+func EnvelopeBody(data []byte) (json.RawMessage, error) {
+	if len(data) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	if json.Valid(data) {
+		return json.RawMessage(data), nil
+	}
+	return json.Marshal(string(data))
+}
@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrQuotaExceeded is returned to the source when an invocation is rejected
+// because the configured invocation quota has been reached.
+var ErrQuotaExceeded = errors.New("invocation quota exceeded")
+
+// ErrEventExpired is returned to the source when an event waited longer than
+// the configured event TTL for an invoker to become available.
+var ErrEventExpired = errors.New("event expired before an invoker became available")
+
+// ErrNilInvoker is returned to the source when the runner was constructed
+// without an invoker for the function.
+var ErrNilInvoker = errors.New("no invoker is configured for the function")
+
+// ErrInvokerStarting is returned when an invocation could not be dispatched
+// because the function process that should handle it could not be started,
+// such as when a recycled process is being replaced. A retry is likely to be
+// handled by another process.
+var ErrInvokerStarting = errors.New("function process is starting")
+
+// ErrChaosInjected is returned when an invocation was failed on purpose by the
+// chaos mode of the runner rather than by the function.
+var ErrChaosInjected = errors.New("error injected by chaos mode")
+
+// ErrPluginTimeout is returned when opening a plugin or looking up a symbol in
+// it did not complete within the configured plugin timeout.
+var ErrPluginTimeout = errors.New("plugin load timed out")
+
+// ErrUnsupportedContentType is returned when strict content types are enforced
+// and an input declares a content type other than JSON or binary, or none.
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// The following error types carry structured context about a failure so that
+// callers can extract it with errors.As for logging or metrics. Each reports
+// the message of the error it wraps, which is available through Unwrap.
+
+// ConfigError indicates that the runner is misconfigured. Name is the
+// environment variable whose value is missing or invalid.
+type ConfigError struct {
+	Name string
+	Err  error
+}
+
+func (e *ConfigError) Error() string { return e.Err.Error() }
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// PluginLoadError indicates that a plugin could not be opened or that a symbol
+// could not be found in it or has the wrong type. Symbol is empty when the
+// plugin itself could not be opened.
+type PluginLoadError struct {
+	Path   string
+	Symbol string
+	Err    error
+}
+
+func (e *PluginLoadError) Error() string { return e.Err.Error() }
+func (e *PluginLoadError) Unwrap() error { return e.Err }
+
+// PoolExhaustedError indicates that an invocation was rejected because no
+// invoker became available. Waited is how long the invocation waited, and Err
+// is fnrun.ErrAvailabilityTimeout or ErrEventExpired.
+type PoolExhaustedError struct {
+	Waited time.Duration
+	Err    error
+}
+
+func (e *PoolExhaustedError) Error() string { return e.Err.Error() }
+func (e *PoolExhaustedError) Unwrap() error { return e.Err }
+
+// InvocationError indicates that the function could not be invoked or failed
+// while handling an input. Duration is how long the invocation ran.
+type InvocationError struct {
+	Duration time.Duration
+	Err      error
+}
+
+func (e *InvocationError) Error() string { return e.Err.Error() }
+func (e *InvocationError) Unwrap() error { return e.Err }
+
+// SinkError indicates that a sink failed to handle a result. Duration is how
+// long the sink ran.
+type SinkError struct {
+	Duration time.Duration
+	Err      error
+}
+
+func (e *SinkError) Error() string { return e.Err.Error() }
+func (e *SinkError) Unwrap() error { return e.Err }
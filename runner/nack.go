@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"context"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// NackDirective tells a source how to negatively acknowledge an event whose
+// invocation failed. Sources translate the directive into their own nack
+// semantics (e.g., seeking back to the current offset in Kafka, changing the
+// visibility timeout of an SQS message, or sending a delayed NAK in NATS).
+type NackDirective struct {
+	// Requeue reports whether the event should be delivered again.
+	Requeue bool
+
+	// Delay is how long the source should wait before the event is delivered
+	// again.
+	Delay time.Duration
+}
+
+// ResultErrorMapper maps a failed result to a nack directive. Plugins that
+// provide a mapper export a function with this signature.
+type ResultErrorMapper func(result *fnrun.Result) NackDirective
+
+// AckableInvoker is implemented by the invoker handed to a source when the
+// runner is able to report nack directives. Sources that support more than one
+// kind of nack can type-assert the invoker to AckableInvoker and use the
+// returned directive to choose the appropriate variant.
+type AckableInvoker interface {
+	fnrun.Invoker
+
+	// InvokeAckable invokes the function and returns the directive for the
+	// result. The directive is nil when the invocation succeeded or when no
+	// mapping applies, in which case the source should use its default
+	// behavior.
+	InvokeAckable(ctx context.Context, input *fnrun.Input) (*fnrun.Result, *NackDirective, error)
+}
@@ -0,0 +1,31 @@
+// Package runner contains types and helpers shared between the fnrun runner
+// and the source and sink plugins that it loads.
+package runner
+
+import "context"
+
+type ctxKey int
+
+const (
+	// MetadataKey is the context key under which per-event metadata is stored.
+	MetadataKey ctxKey = iota
+
+	// CheckpointKey is the context key under which the source checkpoint is
+	// stored.
+	CheckpointKey
+)
+
+// WithMetadata returns a copy of ctx that carries the provided metadata.
+//
+// Sources may use metadata to carry information about an event (e.g., a Kafka
+// partition and offset) to the sink without including it in the function
+// input.
+func WithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	return context.WithValue(ctx, MetadataKey, metadata)
+}
+
+// MetadataFromContext returns the metadata stored in ctx, if any.
+func MetadataFromContext(ctx context.Context) (map[string]string, bool) {
+	metadata, hasMetadata := ctx.Value(MetadataKey).(map[string]string)
+	return metadata, hasMetadata
+}
@@ -0,0 +1,21 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/tessellator/fnrun"
+)
+
+// StreamingInvoker is implemented by invokers of functions that produce more
+// than one result per input (e.g., chunked responses or log lines). When the
+// invoker factory loaded by the runner produces StreamingInvokers, each result
+// is forwarded to the sink as soon as it is received.
+type StreamingInvoker interface {
+	fnrun.Invoker
+
+	// InvokeStream invokes the function and returns a channel that receives
+	// each result as it is produced. The invoker closes the channel when the
+	// function has produced its last result. An error is returned only when
+	// the invocation could not be started.
+	InvokeStream(ctx context.Context, input *fnrun.Input) (<-chan *fnrun.Result, error)
+}
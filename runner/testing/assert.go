@@ -0,0 +1,150 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	gotesting "testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+// defaultIgnoredMetadataKeys are the env keys that the runner fills with values
+// that differ between runs, such as timestamps and request IDs.
+var defaultIgnoredMetadataKeys = []string{
+	"x-processed-at",
+	"x-event-timestamp",
+	"x-correlation-id",
+}
+
+type cmpOptions struct {
+	ignoredKeys map[string]bool
+	bodyAsJSON  bool
+}
+
+// CmpOption configures how AssertResultEqual compares results.
+type CmpOption func(*cmpOptions)
+
+// IgnoreMetadataKey excludes the env key from the comparison.
+func IgnoreMetadataKey(key string) CmpOption {
+	return func(o *cmpOptions) {
+		o.ignoredKeys[key] = true
+	}
+}
+
+// BodyAsJSON compares the result data structurally as JSON, so that
+// differences in formatting and the order of object keys are ignored.
+var BodyAsJSON CmpOption = func(o *cmpOptions) {
+	o.bodyAsJSON = true
+}
+
+// AssertResultEqual reports a test failure if actual differs from expected in
+// status, data or env. The env keys that the runner fills with dynamic values
+// (x-processed-at, x-event-timestamp and x-correlation-id) are ignored.
+func AssertResultEqual(t gotesting.TB, expected *fnrun.Result, actual *fnrun.Result, opts ...CmpOption) {
+	t.Helper()
+
+	if diffs := diffResults(expected, actual, opts); len(diffs) > 0 {
+		t.Errorf("results differ:\n%s", strings.Join(diffs, "\n"))
+	}
+}
+
+func diffResults(expected *fnrun.Result, actual *fnrun.Result, opts []CmpOption) []string {
+	if expected == nil || actual == nil {
+		if expected != actual {
+			return []string{fmt.Sprintf("  result: expected %s, got %s", describeResult(expected), describeResult(actual))}
+		}
+		return nil
+	}
+
+	o := &cmpOptions{ignoredKeys: make(map[string]bool)}
+	for _, key := range defaultIgnoredMetadataKeys {
+		o.ignoredKeys[key] = true
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var diffs []string
+	if expected.Status != actual.Status {
+		diffs = append(diffs, fmt.Sprintf("  status: expected %d, got %d", expected.Status, actual.Status))
+	}
+	if diff := diffBody(expected.Data, actual.Data, o.bodyAsJSON); diff != "" {
+		diffs = append(diffs, diff)
+	}
+	diffs = append(diffs, diffEnv(expected.Env, actual.Env, o.ignoredKeys)...)
+
+	return diffs
+}
+
+func describeResult(result *fnrun.Result) string {
+	if result == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("status %d with data %q", result.Status, result.Data)
+}
+
+func diffBody(expected []byte, actual []byte, asJSON bool) string {
+	if asJSON {
+		var expectedValue, actualValue interface{}
+		if err := json.Unmarshal(expected, &expectedValue); err != nil {
+			return fmt.Sprintf("  data: expected data is not valid JSON: %v", err)
+		}
+		if err := json.Unmarshal(actual, &actualValue); err != nil {
+			return fmt.Sprintf("  data: actual data is not valid JSON: %v\n    got:      %q", err, actual)
+		}
+		if reflect.DeepEqual(expectedValue, actualValue) {
+			return ""
+		}
+
+		// Compare the canonical encodings so that the reported offset ignores
+		// formatting differences.
+		expected, _ = json.Marshal(expectedValue)
+		actual, _ = json.Marshal(actualValue)
+	} else if bytes.Equal(expected, actual) {
+		return ""
+	}
+
+	offset := 0
+	for offset < len(expected) && offset < len(actual) && expected[offset] == actual[offset] {
+		offset++
+	}
+
+	return fmt.Sprintf("  data: differs at byte %d\n    expected: %q\n    got:      %q", offset, expected, actual)
+}
+
+func diffEnv(expected map[string]string, actual map[string]string, ignored map[string]bool) []string {
+	keys := make(map[string]bool)
+	for key := range expected {
+		keys[key] = true
+	}
+	for key := range actual {
+		keys[key] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		if !ignored[key] {
+			sorted = append(sorted, key)
+		}
+	}
+	sort.Strings(sorted)
+
+	var diffs []string
+	for _, key := range sorted {
+		expectedValue, inExpected := expected[key]
+		actualValue, inActual := actual[key]
+		switch {
+		case !inActual:
+			diffs = append(diffs, fmt.Sprintf("  env[%q]: expected %q, got no value", key, expectedValue))
+		case !inExpected:
+			diffs = append(diffs, fmt.Sprintf("  env[%q]: expected no value, got %q", key, actualValue))
+		case expectedValue != actualValue:
+			diffs = append(diffs, fmt.Sprintf("  env[%q]: expected %q, got %q", key, expectedValue, actualValue))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,133 @@
+package testing
+
+import (
+	"fmt"
+	"strings"
+	gotesting "testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+// recordingTB records the failures reported by AssertResultEqual instead of
+// failing the test.
+type recordingTB struct {
+	gotesting.TB
+	failures []string
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...interface{}) {
+	tb.failures = append(tb.failures, fmt.Sprintf(format, args...))
+}
+
+func assertResultFailures(t *gotesting.T, expected *fnrun.Result, actual *fnrun.Result, opts ...CmpOption) []string {
+	t.Helper()
+	tb := &recordingTB{TB: t}
+	AssertResultEqual(tb, expected, actual, opts...)
+	return tb.failures
+}
+
+func TestAssertResultEqualReportsBodyDifferences(t *gotesting.T) {
+	failures := assertResultFailures(t,
+		&fnrun.Result{Status: 200, Data: []byte("hello world")},
+		&fnrun.Result{Status: 200, Data: []byte("hello there")},
+	)
+	if len(failures) != 1 {
+		t.Fatalf("expected one failure, got %v", failures)
+	}
+	for _, want := range []string{"differs at byte 6", `expected: "hello world"`, `got:      "hello there"`} {
+		if !strings.Contains(failures[0], want) {
+			t.Errorf("expected the failure to contain %q, got:\n%s", want, failures[0])
+		}
+	}
+}
+
+func TestAssertResultEqual(t *gotesting.T) {
+	tests := []struct {
+		name     string
+		expected *fnrun.Result
+		actual   *fnrun.Result
+		opts     []CmpOption
+		diffs    []string
+	}{
+		{
+			name:     "equal",
+			expected: &fnrun.Result{Status: 200, Data: []byte("x"), Env: map[string]string{"k": "v"}},
+			actual:   &fnrun.Result{Status: 200, Data: []byte("x"), Env: map[string]string{"k": "v"}},
+		},
+		{
+			name:     "status",
+			expected: &fnrun.Result{Status: 200},
+			actual:   &fnrun.Result{Status: 500},
+			diffs:    []string{"status: expected 200, got 500"},
+		},
+		{
+			name:     "env",
+			expected: &fnrun.Result{Env: map[string]string{"a": "1", "b": "2"}},
+			actual:   &fnrun.Result{Env: map[string]string{"b": "3", "c": "4"}},
+			diffs: []string{
+				`env["a"]: expected "1", got no value`,
+				`env["b"]: expected "2", got "3"`,
+				`env["c"]: expected no value, got "4"`,
+			},
+		},
+		{
+			name:     "dynamic env is ignored by default",
+			expected: &fnrun.Result{Env: map[string]string{"x-correlation-id": "a", "x-processed-at": "1"}},
+			actual:   &fnrun.Result{Env: map[string]string{"x-correlation-id": "b", "x-event-timestamp": "2"}},
+		},
+		{
+			name:     "ignored metadata key",
+			expected: &fnrun.Result{Env: map[string]string{"x-request-id": "a"}},
+			actual:   &fnrun.Result{Env: map[string]string{"x-request-id": "b"}},
+			opts:     []CmpOption{IgnoreMetadataKey("x-request-id")},
+		},
+		{
+			name:     "body as JSON ignores formatting and key order",
+			expected: &fnrun.Result{Data: []byte(`{"a": 1, "b": [1, 2]}`)},
+			actual:   &fnrun.Result{Data: []byte(`{"b":[1,2],"a":1}`)},
+			opts:     []CmpOption{BodyAsJSON},
+		},
+		{
+			name:     "body as JSON reports structural differences",
+			expected: &fnrun.Result{Data: []byte(`{"a": 1}`)},
+			actual:   &fnrun.Result{Data: []byte(`{"a": 2}`)},
+			opts:     []CmpOption{BodyAsJSON},
+			diffs:    []string{`differs at byte 5`},
+		},
+		{
+			name:     "body as JSON with invalid actual data",
+			expected: &fnrun.Result{Data: []byte(`{}`)},
+			actual:   &fnrun.Result{Data: []byte(`not json`)},
+			opts:     []CmpOption{BodyAsJSON},
+			diffs:    []string{"actual data is not valid JSON"},
+		},
+		{
+			name:     "nil result",
+			expected: &fnrun.Result{Status: 200},
+			actual:   nil,
+			diffs:    []string{"result: expected status 200 with data \"\", got nil"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *gotesting.T) {
+			failures := assertResultFailures(t, test.expected, test.actual, test.opts...)
+			if len(test.diffs) == 0 {
+				if len(failures) != 0 {
+					t.Errorf("expected no failure, got %v", failures)
+				}
+				return
+			}
+			if len(failures) != 1 {
+				t.Fatalf("expected one failure, got %v", failures)
+			}
+			for _, diff := range test.diffs {
+				if !strings.Contains(failures[0], diff) {
+					t.Errorf("expected the failure to contain %q, got:\n%s", diff, failures[0])
+				}
+			}
+		})
+	}
+}
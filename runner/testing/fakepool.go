@@ -0,0 +1,93 @@
+// Package testing provides test doubles and helpers for testing code that
+// uses the fnrun runner, such as plugins and middleware, without starting
+// function processes.
+package testing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tessellator/fnrun"
+)
+
+// Call records a single invocation of a FakePool.
+type Call struct {
+	Ctx   context.Context
+	Input *fnrun.Input
+}
+
+// FakePool is an fnrun.Invoker that records every invocation and returns a
+// configured result. It is safe for concurrent use.
+//
+// By default, every invocation returns an empty result and no error.
+type FakePool struct {
+	mu       sync.Mutex
+	result   *fnrun.Result
+	err      error
+	failures map[int]error
+	calls    []Call
+}
+
+// NewFakePool returns a FakePool that returns an empty result.
+func NewFakePool() *FakePool {
+	return &FakePool{result: &fnrun.Result{}, failures: make(map[int]error)}
+}
+
+// WithResult configures the pool to return result from every invocation that
+// does not fail. It returns the pool so that calls can be chained.
+func (p *FakePool) WithResult(result *fnrun.Result) *FakePool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.result = result
+	return p
+}
+
+// WithError configures the pool to return err from every invocation. It
+// returns the pool so that calls can be chained.
+func (p *FakePool) WithError(err error) *FakePool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+	return p
+}
+
+// WillFailOnCall configures the pool to return err from the nth invocation,
+// counting from 1. It returns the pool so that calls can be chained.
+func (p *FakePool) WillFailOnCall(n int, err error) *FakePool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures[n] = err
+	return p
+}
+
+// Invoke records the invocation and returns the configured result or error.
+func (p *FakePool) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls = append(p.calls, Call{Ctx: ctx, Input: input})
+
+	if err, ok := p.failures[len(p.calls)]; ok {
+		return nil, err
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return p.result, nil
+}
+
+// Calls returns the invocations recorded so far, in the order in which they
+// were made.
+func (p *FakePool) Calls() []Call {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Call(nil), p.calls...)
+}
+
+// CallCount returns the number of invocations recorded so far.
+func (p *FakePool) CallCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.calls)
+}
@@ -0,0 +1,72 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	gotesting "testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestFakePoolRecordsCalls(t *gotesting.T) {
+	result := &fnrun.Result{Status: 201}
+	pool := NewFakePool().WithResult(result)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := pool.Invoke(context.Background(), &fnrun.Input{}); got != result || err != nil {
+				t.Errorf("expected the configured result, got %+v (%v)", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := pool.CallCount(); n != 10 {
+		t.Errorf("expected 10 calls, got %d", n)
+	}
+	if n := len(pool.Calls()); n != 10 {
+		t.Errorf("expected 10 recorded calls, got %d", n)
+	}
+}
+
+func TestFakePoolRecordsTheContextAndInputInOrder(t *gotesting.T) {
+	type key struct{}
+	pool := NewFakePool()
+
+	for _, data := range []string{"a", "b"} {
+		ctx := context.WithValue(context.Background(), key{}, data)
+		pool.Invoke(ctx, &fnrun.Input{Data: []byte(data)})
+	}
+
+	calls := pool.Calls()
+	for i, want := range []string{"a", "b"} {
+		if string(calls[i].Input.Data) != want || calls[i].Ctx.Value(key{}) != want {
+			t.Errorf("expected call %d to record input and context %s", i, want)
+		}
+	}
+}
+
+func TestFakePoolFailures(t *gotesting.T) {
+	third := errors.New("third call failed")
+	pool := NewFakePool().WillFailOnCall(3, third)
+
+	for i := 1; i <= 4; i++ {
+		var want error
+		if i == 3 {
+			want = third
+		}
+		if _, err := pool.Invoke(context.Background(), &fnrun.Input{}); err != want {
+			t.Errorf("call %d: expected %v, got %v", i, want, err)
+		}
+	}
+
+	always := errors.New("always fails")
+	pool.WithError(always)
+	if _, err := pool.Invoke(context.Background(), &fnrun.Input{}); err != always {
+		t.Errorf("expected %v, got %v", always, err)
+	}
+}
@@ -0,0 +1,78 @@
+package testing
+
+import (
+	"context"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// InputBuilder constructs inputs for tests with a fluent API.
+//
+// fnrun.Input carries only data, so the other values an event may have are
+// attached to the context instead: metadata is stored with runner.WithMetadata,
+// where middleware and sinks read it, and headers are stored as the execution
+// context env with fnrun.WithEnv, which is sent to the function alongside the
+// input. Use Context to obtain a context carrying them.
+type InputBuilder struct {
+	body     []byte
+	metadata map[string]string
+	headers  map[string]string
+}
+
+// NewInputBuilder returns a builder for an input with no data.
+func NewInputBuilder() *InputBuilder {
+	return &InputBuilder{}
+}
+
+// WithBody sets the data of the input.
+func (b *InputBuilder) WithBody(body []byte) *InputBuilder {
+	b.body = body
+	return b
+}
+
+// WithMetadata adds a metadata value for the input.
+func (b *InputBuilder) WithMetadata(key string, value string) *InputBuilder {
+	if b.metadata == nil {
+		b.metadata = make(map[string]string)
+	}
+	b.metadata[key] = value
+	return b
+}
+
+// WithHeader adds a header for the input.
+func (b *InputBuilder) WithHeader(key string, value string) *InputBuilder {
+	if b.headers == nil {
+		b.headers = make(map[string]string)
+	}
+	b.headers[key] = value
+	return b
+}
+
+// Build returns the input.
+func (b *InputBuilder) Build() *fnrun.Input {
+	data := make([]byte, len(b.body))
+	copy(data, b.body)
+	return &fnrun.Input{Data: data}
+}
+
+// Context returns a copy of parent that carries the metadata and headers of
+// the input.
+func (b *InputBuilder) Context(parent context.Context) context.Context {
+	ctx := parent
+	if b.metadata != nil {
+		ctx = runner.WithMetadata(ctx, copyMap(b.metadata))
+	}
+	if b.headers != nil {
+		ctx = fnrun.WithEnv(ctx, copyMap(b.headers))
+	}
+	return ctx
+}
+
+func copyMap(m map[string]string) map[string]string {
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,61 @@
+package testing
+
+import (
+	"context"
+	"reflect"
+	gotesting "testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestInputBuilderWithBody(t *gotesting.T) {
+	body := []byte("hello")
+	builder := NewInputBuilder().WithBody(body)
+	input := builder.Build()
+
+	if string(input.Data) != "hello" {
+		t.Errorf("expected the body to be the input data, got %q", input.Data)
+	}
+	body[0] = 'j'
+	if string(builder.Build().Data) != "jello" || string(input.Data) != "hello" {
+		t.Error("expected each built input to have its own copy of the body")
+	}
+}
+
+func TestInputBuilderWithMetadata(t *gotesting.T) {
+	ctx := NewInputBuilder().
+		WithMetadata("x-correlation-id", "abc").
+		WithMetadata("x-priority", "high").
+		Context(context.Background())
+
+	metadata, ok := runner.MetadataFromContext(ctx)
+	want := map[string]string{"x-correlation-id": "abc", "x-priority": "high"}
+	if !ok || !reflect.DeepEqual(metadata, want) {
+		t.Errorf("expected metadata %v, got %v", want, metadata)
+	}
+}
+
+func TestInputBuilderWithHeader(t *gotesting.T) {
+	ctx := NewInputBuilder().WithHeader("Content-Type", "application/json").Context(context.Background())
+
+	env, ok := fnrun.Env(ctx)
+	if !ok || env["Content-Type"] != "application/json" {
+		t.Errorf("expected the header in the execution context env, got %v", env)
+	}
+	if _, ok := runner.MetadataFromContext(ctx); ok {
+		t.Error("expected no metadata when none was added")
+	}
+}
+
+func TestInputBuilderDefaults(t *gotesting.T) {
+	parent := context.Background()
+	builder := NewInputBuilder()
+
+	if input := builder.Build(); len(input.Data) != 0 {
+		t.Errorf("expected an input with no data, got %q", input.Data)
+	}
+	if ctx := builder.Context(parent); ctx != parent {
+		t.Error("expected the parent context when there is no metadata or header")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// runStatsSampleSize is the number of invocation latencies kept to estimate
+// the latency percentiles of the run summary.
+const runStatsSampleSize = 10000
+
+// stats accumulates the statistics of the run reported when the runner shuts
+// down cleanly.
+var stats = newRunStats()
+
+// -----------------------------------------------------------------------------
+// Run Statistics
+//
+// The run statistics count the invocations handled over the lifetime of the
+// runner, including their delivery to the sink, along with the retries and
+// dead-letter deliveries made on their behalf. An invocation fails if it
+// returns an error, as for the error rate monitor. The latency percentiles are
+// estimated from a uniform sample of the invocation latencies, so that a long
+// run does not keep every latency in memory.
+//
+// When the source returns without an error, a summary of the statistics is
+// logged, so that operators of batch runs can confirm that every event was
+// processed.
+
+type runStats struct {
+	started      time.Time
+	invocations  int64
+	failures     int64
+	retries      int64
+	deadLettered int64
+	latencyNanos int64
+	mu           sync.Mutex
+	rand         *rand.Rand
+	latencies    []time.Duration
+}
+
+func newRunStats() *runStats {
+	return &runStats{
+		started: time.Now(),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// statsInvoker records each invocation in stats.
+type statsInvoker struct {
+	invoker fnrun.Invoker
+	stats   *runStats
+}
+
+func (si *statsInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	start := time.Now()
+	result, err := si.invoker.Invoke(ctx, input)
+	si.stats.recordInvocation(time.Since(start), err != nil)
+	return result, err
+}
+
+func (s *runStats) recordInvocation(latency time.Duration, failed bool) {
+	n := atomic.AddInt64(&s.invocations, 1)
+	if failed {
+		atomic.AddInt64(&s.failures, 1)
+	}
+	atomic.AddInt64(&s.latencyNanos, int64(latency))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.latencies) < runStatsSampleSize {
+		s.latencies = append(s.latencies, latency)
+	} else if i := s.rand.Int63n(n); i < runStatsSampleSize {
+		s.latencies[i] = latency
+	}
+}
+
+// recordRetry records that an invocation or sink delivery was retried.
+func (s *runStats) recordRetry() {
+	atomic.AddInt64(&s.retries, 1)
+}
+
+// recordDeadLetter records that a result was delivered to a dead-letter sink.
+func (s *runStats) recordDeadLetter() {
+	atomic.AddInt64(&s.deadLettered, 1)
+}
+
+// deliverToDeadLetterSink delivers result to a dead-letter sink and records
+// the delivery in stats if it succeeds.
+func deliverToDeadLetterSink(ctx context.Context, sink eventSinkTransformer, result *fnrun.Result) (*fnrun.Result, error) {
+	transformed, err := sink(ctx, result)
+	if err == nil {
+		stats.recordDeadLetter()
+	}
+	return transformed, err
+}
+
+// latencyPercentile returns the latency below which the fraction p of the
+// sorted latencies fall.
+func latencyPercentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// logSummary logs the statistics of the run.
+func (s *runStats) logSummary() {
+	invocations := atomic.LoadInt64(&s.invocations)
+	failures := atomic.LoadInt64(&s.failures)
+
+	var average time.Duration
+	if invocations > 0 {
+		average = time.Duration(atomic.LoadInt64(&s.latencyNanos) / invocations)
+	}
+
+	s.mu.Lock()
+	sorted := append([]time.Duration(nil), s.latencies...)
+	s.mu.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	log.Printf("run summary: %d invocation(s), %d succeeded, %d failed, %d retried, %d dead-lettered; latency avg %v, p95 %v, p99 %v; uptime %v",
+		invocations, invocations-failures, failures,
+		atomic.LoadInt64(&s.retries), atomic.LoadInt64(&s.deadLettered),
+		average, latencyPercentile(sorted, 0.95), latencyPercentile(sorted, 0.99), time.Since(s.started).Round(time.Millisecond))
+}
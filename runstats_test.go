@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// useRunStats replaces stats with fresh run statistics for the duration of
+// the test.
+func useRunStats(t *testing.T) *runStats {
+	t.Helper()
+	saved := stats
+	stats = newRunStats()
+	t.Cleanup(func() { stats = saved })
+	return stats
+}
+
+// logSummaryOutput returns the summary logged by s.
+func logSummaryOutput(s *runStats) string {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+	s.logSummary()
+	return out.String()
+}
+
+func TestRunStatsSummarizesInvocations(t *testing.T) {
+	s := useRunStats(t)
+
+	// Every tenth input fails and is dead-lettered, and every fifth input
+	// after the first is throttled once before it succeeds.
+	attempts := make(map[int]int)
+	invoker := &statsInvoker{
+		invoker: &retryInvoker{
+			invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+				i, _ := strconv.Atoi(string(input.Data))
+				attempts[i]++
+				switch {
+				case i%10 == 0:
+					return nil, errors.New("failed")
+				case i%5 == 1 && attempts[i] == 1:
+					return &fnrun.Result{Status: 429}, nil
+				}
+				return &fnrun.Result{Status: 200}, nil
+			}),
+			codes:   map[int]bool{429: true},
+			retries: 1,
+			backoff: time.Millisecond,
+		},
+		stats: s,
+	}
+	deadLetterSink := func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		return result, nil
+	}
+
+	for i := 0; i < 100; i++ {
+		input := &fnrun.Input{Data: []byte(strconv.Itoa(i))}
+		if _, err := invoker.Invoke(context.Background(), input); err != nil {
+			if _, err := deliverToDeadLetterSink(context.Background(), deadLetterSink, &fnrun.Result{Data: input.Data}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+
+	summary := logSummaryOutput(s)
+	want := "100 invocation(s), 90 succeeded, 10 failed, 20 retried, 10 dead-lettered"
+	if !strings.Contains(summary, want) {
+		t.Errorf("expected the summary to contain %q, got %q", want, summary)
+	}
+}
+
+func TestRunStatsDoesNotCountFailedDeadLetterDeliveries(t *testing.T) {
+	s := useRunStats(t)
+	failing := func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		return result, errors.New("unavailable")
+	}
+
+	if _, err := deliverToDeadLetterSink(context.Background(), failing, &fnrun.Result{}); err == nil {
+		t.Fatal("expected the error of the dead-letter sink")
+	}
+	if summary := logSummaryOutput(s); !strings.Contains(summary, "0 dead-lettered") {
+		t.Errorf("expected no dead-letter deliveries, got %q", summary)
+	}
+}
+
+func TestRunStatsReportsLatencyPercentiles(t *testing.T) {
+	s := newRunStats()
+	for i := 1; i <= 100; i++ {
+		s.recordInvocation(time.Duration(i)*time.Millisecond, false)
+	}
+
+	summary := logSummaryOutput(s)
+	for _, want := range []string{"avg 50.5ms", "p95 95ms", "p99 99ms"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("expected the summary to contain %q, got %q", want, summary)
+		}
+	}
+}
+
+func TestLatencyPercentileOfNoLatencies(t *testing.T) {
+	if p := latencyPercentile(nil, 0.99); p != 0 {
+		t.Errorf("expected 0, got %v", p)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Sampling Invoker
+//
+// The sampling invoker forwards only a fraction of inputs to the underlying
+// invoker. Whether an input is in the sample is determined by a hash of its
+// data, so the same input is always either processed or skipped. Skipped inputs
+// receive an empty result as though they had been processed successfully.
+//
+// The high bits of an FNV hash barely change between inputs that differ only
+// in their last bytes, such as sequence numbers, so the hash is mixed before it
+// is compared with the threshold.
+
+type samplingInvoker struct {
+	invoker   fnrun.Invoker
+	threshold uint64
+}
+
+func newSamplingInvoker(invoker fnrun.Invoker, rate float64) *samplingInvoker {
+	if rate < 0 {
+		rate = 0
+	}
+	return &samplingInvoker{invoker: invoker, threshold: uint64(rate * math.MaxUint64)}
+}
+
+func (si *samplingInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	hash := fnv.New64a()
+	hash.Write(input.Data)
+	if mixHash(hash.Sum64()) >= si.threshold {
+		return &fnrun.Result{}, nil
+	}
+
+	return si.invoker.Invoke(ctx, input)
+}
+
+// mixHash spreads every bit of h across the result with the finalizer of
+// MurmurHash3.
+func mixHash(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb3fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestSamplingInvokerForwardsApproximatelyTheRate(t *testing.T) {
+	sampled := make(map[string]bool)
+	si := newSamplingInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		sampled[string(input.Data)] = true
+		return &fnrun.Result{Status: 200}, nil
+	}), 0.1)
+
+	for i := 0; i < 1000; i++ {
+		result, err := si.Invoke(context.Background(), &fnrun.Input{Data: []byte(fmt.Sprint("event-", i))})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result == nil {
+			t.Fatal("expected skipped inputs to receive a result")
+		}
+	}
+	if n := len(sampled); n < 60 || n > 140 {
+		t.Errorf("expected about 100 invocations, got %d", n)
+	}
+
+	// The same inputs are in or out of the sample every time.
+	for i := 0; i < 1000; i++ {
+		data := fmt.Sprint("event-", i)
+		was := sampled[data]
+		delete(sampled, data)
+		si.Invoke(context.Background(), &fnrun.Input{Data: []byte(data)})
+		if sampled[data] != was {
+			t.Fatalf("expected the sampling of %s to be deterministic", data)
+		}
+	}
+}
+
+func TestSamplingInvokerWithZeroRateSkipsEverything(t *testing.T) {
+	var invocations int
+	si := newSamplingInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		invocations++
+		return &fnrun.Result{}, nil
+	}), -1)
+
+	for i := 0; i < 100; i++ {
+		si.Invoke(context.Background(), &fnrun.Input{Data: []byte(fmt.Sprint(i))})
+	}
+	if invocations != 0 {
+		t.Errorf("expected no invocations, got %d", invocations)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// Secret references
+//
+// Environment variables may reference secrets instead of containing them, so
+// that credentials do not have to be written into the runner's configuration.
+// Before any other configuration is read, every reference of the form
+// ${secret:<backend>:<path>} in the value of an environment variable is
+// replaced with the secret. The supported backends are:
+//
+//   env     the value of the environment variable named by path
+//   file    the contents of the file at path, without a trailing newline
+//   vault   a field of a HashiCorp Vault secret, where path has the form
+//           <secret path>#<field> (e.g., secret/data/app#password)
+//
+// The vault backend reads from the server at VAULT_ADDR using the token in
+// VAULT_TOKEN, and supports both versions of the key/value secrets engine. A
+// reference that cannot be resolved is fatal.
+
+var secretReferencePattern = regexp.MustCompile(`\$\{secret:([a-z]+):([^}]+)\}`)
+
+// resolveSecretReferences replaces the secret references in the values of all
+// environment variables with the secrets they reference.
+func resolveSecretReferences() error {
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !strings.Contains(parts[1], "${secret:") {
+			continue
+		}
+		name, value := parts[0], parts[1]
+
+		var resolveErr error
+		resolved := secretReferencePattern.ReplaceAllStringFunc(value, func(ref string) string {
+			match := secretReferencePattern.FindStringSubmatch(ref)
+			secret, err := resolveSecret(match[1], match[2])
+			if err != nil && resolveErr == nil {
+				resolveErr = configErrorf(name, "could not resolve secret reference %s in %s: %v", ref, name, err)
+			}
+			return secret
+		})
+		if resolveErr != nil {
+			return resolveErr
+		}
+
+		if err := os.Setenv(name, resolved); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resolveSecret(backend string, path string) (string, error) {
+	switch backend {
+	case "env":
+		value, ok := os.LookupEnv(path)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", path)
+		}
+		return value, nil
+	case "file":
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	case "vault":
+		return readVaultSecret(path)
+	default:
+		return "", fmt.Errorf("unknown secret backend %s", backend)
+	}
+}
+
+// readVaultSecret reads a field of a Vault secret. ref has the form
+// <secret path>#<field>.
+func readVaultSecret(ref string) (string, error) {
+	// env: VAULT_ADDR string "" "Address of the Vault server from which ${secret:vault:<path>#<field>} references are resolved."
+	// env: VAULT_TOKEN string "" "Token with which Vault secrets are read."
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("VAULT_ADDR and VAULT_TOKEN are required to read secrets from vault")
+	}
+
+	hash := strings.LastIndex(ref, "#")
+	if hash <= 0 || hash == len(ref)-1 {
+		return "", fmt.Errorf("vault secret reference %s must have the form <path>#<field>", ref)
+	}
+	path, field := strings.Trim(ref[:hash], "/"), ref[hash+1:]
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	// env: VAULT_NAMESPACE string "" "Vault namespace of the secret references."
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not read vault secret %s: %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	// Version 2 of the key/value engine nests the fields of the secret in its
+	// data along with the secret's metadata.
+	data := body.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no field %s", path, field)
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
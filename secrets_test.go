@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestResolveSecretReferencesFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	user, password := filepath.Join(dir, "user"), filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(user, []byte("admin\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(password, []byte("s3cret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("FNRUN_TEST_PASSWORD", "${secret:file:"+password+"}")
+	t.Setenv("FNRUN_TEST_DSN", "postgres://${secret:file:"+user+"}:${secret:file:"+password+"}@db/app")
+	t.Setenv("FNRUN_TEST_PLAIN", "no secrets here")
+	if err := resolveSecretReferences(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]string{
+		"FNRUN_TEST_PASSWORD": "s3cret",
+		"FNRUN_TEST_DSN":      "postgres://admin:s3cret@db/app",
+		"FNRUN_TEST_PLAIN":    "no secrets here",
+	}
+	for name, want := range tests {
+		if got := os.Getenv(name); got != want {
+			t.Errorf("expected %s to be %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestResolveSecretReferencesFromEnv(t *testing.T) {
+	t.Setenv("FNRUN_TEST_SOURCE", "from env")
+	t.Setenv("FNRUN_TEST_REFERENCE", "${secret:env:FNRUN_TEST_SOURCE}")
+	if err := resolveSecretReferences(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := os.Getenv("FNRUN_TEST_REFERENCE"); got != "from env" {
+		t.Errorf("expected the referenced value, got %q", got)
+	}
+}
+
+func TestResolveSecretReferencesFailsForUnresolvableSecrets(t *testing.T) {
+	tests := map[string]string{
+		"missing file":    "${secret:file:" + filepath.Join(t.TempDir(), "missing") + "}",
+		"missing env":     "${secret:env:FNRUN_TEST_UNSET}",
+		"unknown backend": "${secret:ssm:app/password}",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("FNRUN_TEST_SECRET", value)
+			err := resolveSecretReferences()
+			var configErr *runner.ConfigError
+			if !errors.As(err, &configErr) || configErr.Name != "FNRUN_TEST_SECRET" {
+				t.Errorf("expected a ConfigError for FNRUN_TEST_SECRET, got %v", err)
+			}
+		})
+	}
+}
+
+func TestResolveSecretReferencesFromVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			w.Write([]byte(`{"data": {"data": {"password": "v2"}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/app":
+			w.Write([]byte(`{"data": {"password": "v1", "port": 5432}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"secret/data/app#password", "v2"},
+		{"kv/app#password", "v1"},
+		{"kv/app#port", "5432"},
+	}
+	for _, test := range tests {
+		got, err := resolveSecret("vault", test.ref)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", test.ref, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("expected %s to be %q, got %q", test.ref, test.want, got)
+		}
+	}
+
+	for _, ref := range []string{"kv/app#missing", "kv/other#password", "kv/app"} {
+		if _, err := resolveSecret("vault", ref); err == nil {
+			t.Errorf("expected an error for %s", ref)
+		}
+	}
+}
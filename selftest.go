@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tessellator/fnrun"
+)
+
+// isErrorStatus reports whether a result status indicates that the function
+// failed to handle its input. Statuses follow HTTP conventions.
+func isErrorStatus(status int) bool {
+	return status >= 400
+}
+
+// runSelfTest invokes the function with SELFTEST_INPUT, if it is set, and
+// returns an error if the invocation fails, the result has an error status, or
+// the result data does not contain SELFTEST_EXPECTED_OUTPUT.
+func runSelfTest(ctx context.Context, invoker fnrun.Invoker) error {
+	// env: SELFTEST_INPUT string "" "Input with which the function is invoked at startup before the source starts."
+	input := os.Getenv("SELFTEST_INPUT")
+	if input == "" {
+		return nil
+	}
+
+	result, err := invoker.Invoke(ctx, &fnrun.Input{Data: []byte(input)})
+	if err != nil {
+		return fmt.Errorf("self-test invocation failed: %v", err)
+	}
+
+	if isErrorStatus(result.Status) {
+		return fmt.Errorf("self-test invocation returned status %d", result.Status)
+	}
+
+	// env: SELFTEST_EXPECTED_OUTPUT string "" "Text the result of the startup self-test must contain."
+	expected := os.Getenv("SELFTEST_EXPECTED_OUTPUT")
+	if expected != "" && !strings.Contains(string(result.Data), expected) {
+		return fmt.Errorf("self-test result %q does not contain %q", result.Data, expected)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestRunSelfTest(t *testing.T) {
+	failing := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return nil, errors.New("function crashed")
+	})
+	erroring := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 500, Data: input.Data}, nil
+	})
+
+	tests := []struct {
+		name     string
+		invoker  fnrun.Invoker
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{name: "disabled", invoker: failing},
+		{name: "echo", invoker: echoInvoker{}, input: `{"ping":true}`},
+		{name: "echo with expected output", invoker: echoInvoker{}, input: `{"ping":true}`, expected: `"ping"`},
+		{name: "unexpected output", invoker: echoInvoker{}, input: `{"ping":true}`, expected: "pong", wantErr: true},
+		{name: "failed invocation", invoker: failing, input: `{}`, wantErr: true},
+		{name: "error status", invoker: erroring, input: `{}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SELFTEST_INPUT", tt.input)
+			t.Setenv("SELFTEST_EXPECTED_OUTPUT", tt.expected)
+
+			err := runSelfTest(context.Background(), tt.invoker)
+			if tt.wantErr && err == nil {
+				t.Error("expected the self-test to fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("expected the self-test to succeed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunSelfTestWithFunctionProcess(t *testing.T) {
+	t.Setenv("SELFTEST_INPUT", `{"ping":true}`)
+	t.Setenv("SELFTEST_EXPECTED_OUTPUT", "ping")
+
+	pool, err := newSizedInvokerPool(newCmdInvokerFactory(testFunctionCmd("echo"), time.Second, nil), "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := runSelfTest(ctx, pool); err != nil {
+		t.Errorf("expected the self-test to succeed, got %v", err)
+	}
+}
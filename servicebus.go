@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const (
+	// serviceBusReceiveTimeout is how long a receive request waits for a
+	// message before the server responds that there is none.
+	serviceBusReceiveTimeout = 60 * time.Second
+
+	// serviceBusTokenTTL is the lifetime of the SAS tokens signed for each
+	// request.
+	serviceBusTokenTTL = time.Hour
+
+	// serviceBusSettleTimeout bounds a request that completes or abandons a
+	// message.
+	serviceBusSettleTimeout = 30 * time.Second
+)
+
+// -----------------------------------------------------------------------------
+// Azure Service Bus Source
+//
+// The Service Bus source invokes the function with the body of each message
+// received from a queue, or from a subscription of a topic. It talks to the
+// Service Bus REST API, authenticating with a SAS token signed with the key in
+// the connection string. An endpoint with an http or https scheme is used as
+// is, which allows the source to be pointed at an emulator.
+//
+// Messages are received in peek-lock mode, one at a time; SOURCE_CONCURRENCY
+// runs several receivers. The message ID is passed as the correlation ID,
+// unless the message has a correlation ID of its own, and the enqueued time as
+// the event timestamp.
+//
+// A message is completed once its invocation, including delivery to the sink,
+// has succeeded, and abandoned otherwise so that its lock is released and it
+// is redelivered. The REST API cannot dead-letter a message directly: Service
+// Bus moves a message to the dead-letter queue of the entity once it has been
+// delivered the maximum number of times configured for the entity. A nack
+// directive that does not request a requeue completes the message, dropping
+// it.
+
+type serviceBusConnection struct {
+	endpoint string
+	keyName  string
+	key      string
+	entity   string
+}
+
+type serviceBusBrokerProperties struct {
+	MessageID       string `json:"MessageId"`
+	CorrelationID   string `json:"CorrelationId"`
+	EnqueuedTimeUTC string `json:"EnqueuedTimeUtc"`
+	DeliveryCount   int    `json:"DeliveryCount"`
+}
+
+type serviceBusMessage struct {
+	body       []byte
+	properties serviceBusBrokerProperties
+	location   string
+}
+
+// parseServiceBusConnectionString parses a connection string of the form
+// Endpoint=sb://<namespace>/;SharedAccessKeyName=<name>;SharedAccessKey=<key>,
+// optionally followed by ;EntityPath=<entity>.
+func parseServiceBusConnectionString(connStr string) (serviceBusConnection, error) {
+	var conn serviceBusConnection
+	for _, part := range strings.Split(connStr, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.ToLower(kv[0]) {
+		case "endpoint":
+			conn.endpoint = kv[1]
+		case "sharedaccesskeyname":
+			conn.keyName = kv[1]
+		case "sharedaccesskey":
+			conn.key = kv[1]
+		case "entitypath":
+			conn.entity = kv[1]
+		}
+	}
+
+	if conn.endpoint == "" || conn.keyName == "" || conn.key == "" {
+		return conn, fmt.Errorf("the connection string must contain Endpoint, SharedAccessKeyName and SharedAccessKey")
+	}
+
+	endpoint, err := url.Parse(conn.endpoint)
+	if err != nil {
+		return conn, fmt.Errorf("invalid Endpoint %s: %v", conn.endpoint, err)
+	}
+	if endpoint.Scheme == "sb" {
+		endpoint.Scheme = "https"
+	}
+	conn.endpoint = endpoint.Scheme + "://" + endpoint.Host
+	return conn, nil
+}
+
+func newServiceBusSource(connStr string, queue string, topic string, subscription string) (eventSource, error) {
+	if connStr == "" {
+		return nil, configErrorf("SERVICEBUS_CONNECTION_STRING", "SERVICEBUS_CONNECTION_STRING is required for the azure-servicebus source")
+	}
+	conn, err := parseServiceBusConnectionString(connStr)
+	if err != nil {
+		return nil, configErrorf("SERVICEBUS_CONNECTION_STRING", "Invalid SERVICEBUS_CONNECTION_STRING: %v", err)
+	}
+
+	switch {
+	case queue != "" && topic != "":
+		return nil, configErrorf("SERVICEBUS_QUEUE", "SERVICEBUS_QUEUE and SERVICEBUS_TOPIC cannot both be provided")
+	case queue != "":
+		conn.entity = queue
+	case topic != "":
+		if subscription == "" {
+			return nil, configErrorf("SERVICEBUS_SUBSCRIPTION", "SERVICEBUS_SUBSCRIPTION is required with SERVICEBUS_TOPIC")
+		}
+		conn.entity = topic + "/subscriptions/" + subscription
+	case conn.entity == "":
+		return nil, configErrorf("SERVICEBUS_QUEUE", "SERVICEBUS_QUEUE or SERVICEBUS_TOPIC is required for the azure-servicebus source")
+	}
+
+	receiver := &serviceBusReceiver{
+		client: &http.Client{Timeout: serviceBusReceiveTimeout + serviceBusSettleTimeout},
+		conn:   conn,
+		now:    time.Now,
+	}
+	return receiver.run, nil
+}
+
+type serviceBusReceiver struct {
+	client *http.Client
+	conn   serviceBusConnection
+	now    func() time.Time
+}
+
+func (r *serviceBusReceiver) run(ctx context.Context, invoker fnrun.Invoker) error {
+	for {
+		var msg *serviceBusMessage
+		err := connectWithBackoff(func() (err error) {
+			msg, err = r.receive(ctx)
+			if ctx.Err() != nil {
+				// The source was cancelled, which is not worth retrying.
+				return nil
+			}
+			return err
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			continue
+		}
+
+		// The invocation outlives the source during a graceful shutdown, so
+		// the message is settled even if the source has been cancelled.
+		settleCtx, cancel := context.WithTimeout(context.Background(), serviceBusSettleTimeout)
+		if invokeServiceBusMessage(ctx, invoker, msg) {
+			err = r.settle(settleCtx, msg, http.MethodDelete)
+		} else {
+			err = r.settle(settleCtx, msg, http.MethodPut)
+		}
+		cancel()
+		if err != nil {
+			log.Printf("could not settle Service Bus message %s: %v", msg.properties.MessageID, err)
+		}
+	}
+}
+
+// invokeServiceBusMessage invokes the function with a message and reports
+// whether the message should be completed.
+func invokeServiceBusMessage(ctx context.Context, invoker fnrun.Invoker, msg *serviceBusMessage) bool {
+	metadata := map[string]string{correlationIDKey: msg.properties.MessageID}
+	if msg.properties.CorrelationID != "" {
+		metadata[correlationIDKey] = msg.properties.CorrelationID
+	}
+	if enqueued, err := time.Parse(time.RFC1123, msg.properties.EnqueuedTimeUTC); err == nil {
+		metadata[eventTimestampKey] = enqueued.UTC().Format(time.RFC3339Nano)
+	}
+
+	_, directive, err := invokeAckable(runner.WithMetadata(ctx, metadata), invoker, &fnrun.Input{Data: msg.body})
+	if err != nil {
+		log.Printf("could not process Service Bus message %s (delivery %d): %v", msg.properties.MessageID, msg.properties.DeliveryCount, err)
+		return false
+	}
+	return directive == nil || !directive.Requeue
+}
+
+// sasToken returns a SAS token that grants access to the entity.
+func (r *serviceBusReceiver) sasToken() string {
+	resource := url.QueryEscape(strings.ToLower(r.conn.endpoint + "/" + r.conn.entity))
+	expiry := strconv.FormatInt(r.now().Add(serviceBusTokenTTL).Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(r.conn.key))
+	mac.Write([]byte(resource + "\n" + expiry))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s",
+		resource, url.QueryEscape(signature), expiry, url.QueryEscape(r.conn.keyName))
+}
+
+// receive locks the next message of the entity. It returns nil if no message
+// arrived within the receive timeout.
+func (r *serviceBusReceiver) receive(ctx context.Context) (*serviceBusMessage, error) {
+	endpoint := fmt.Sprintf("%s/%s/messages/head?timeout=%d", r.conn.endpoint, r.conn.entity, int(serviceBusReceiveTimeout/time.Second))
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", r.sasToken())
+
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNoContent:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("could not receive from Service Bus entity %s: %s", r.conn.entity, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &serviceBusMessage{body: body, location: resp.Header.Get("Location")}
+	if err := json.Unmarshal([]byte(resp.Header.Get("BrokerProperties")), &msg.properties); err != nil {
+		return nil, fmt.Errorf("invalid BrokerProperties of Service Bus message: %v", err)
+	}
+	if msg.location == "" {
+		return nil, fmt.Errorf("no lock location for Service Bus message %s", msg.properties.MessageID)
+	}
+	return msg, nil
+}
+
+// settle completes the locked message with DELETE or abandons it with PUT.
+func (r *serviceBusReceiver) settle(ctx context.Context, msg *serviceBusMessage, method string) error {
+	req, err := http.NewRequest(method, msg.location, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", r.sasToken())
+
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", method, msg.location, resp.Status)
+	}
+	return nil
+}
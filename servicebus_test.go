@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// fakeServiceBusMessage is a message held by fakeServiceBus.
+type fakeServiceBusMessage struct {
+	id            string
+	correlationID string
+	body          string
+	deliveryCount int
+}
+
+// fakeServiceBus serves the peek-lock receive, complete and abandon requests
+// of the Service Bus REST API for a single entity. A message that has been
+// abandoned maxDeliveryCount times is moved to the dead-letter queue, as
+// Service Bus does.
+type fakeServiceBus struct {
+	*httptest.Server
+	t                *testing.T
+	entity           string
+	maxDeliveryCount int
+
+	mu           sync.Mutex
+	queue        []*fakeServiceBusMessage
+	locked       map[string]*fakeServiceBusMessage
+	completed    []string
+	deadLettered []string
+}
+
+const fakeServiceBusKey = "c2VjcmV0"
+
+func newFakeServiceBus(t *testing.T, entity string, bodies ...string) *fakeServiceBus {
+	t.Helper()
+	sb := &fakeServiceBus{t: t, entity: entity, maxDeliveryCount: 3, locked: make(map[string]*fakeServiceBusMessage)}
+	for i, body := range bodies {
+		sb.queue = append(sb.queue, &fakeServiceBusMessage{id: fmt.Sprintf("msg-%d", i), body: body})
+	}
+	sb.Server = httptest.NewServer(http.HandlerFunc(sb.serveHTTP))
+	t.Cleanup(sb.Close)
+	return sb
+}
+
+// connectionString returns a connection string for the fake namespace.
+func (sb *fakeServiceBus) connectionString() string {
+	return "Endpoint=" + sb.URL + "/;SharedAccessKeyName=RootManageSharedAccessKey;SharedAccessKey=" + fakeServiceBusKey
+}
+
+// authorized reports whether the request carries a SAS token for the entity
+// signed with the key of the namespace.
+func (sb *fakeServiceBus) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "SharedAccessSignature ")
+	values, err := url.ParseQuery(token)
+	if err != nil || values.Get("skn") != "RootManageSharedAccessKey" {
+		return false
+	}
+	resource := values.Get("sr")
+	if resource != strings.ToLower(sb.URL+"/"+sb.entity) {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(fakeServiceBusKey))
+	mac.Write([]byte(url.QueryEscape(resource) + "\n" + values.Get("se")))
+	return values.Get("sig") == base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (sb *fakeServiceBus) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !sb.authorized(r) {
+		sb.t.Errorf("expected a valid SAS token, got %q", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	prefix := "/" + sb.entity + "/messages/"
+	if r.Method == http.MethodPost && r.URL.Path == prefix+"head" {
+		sb.receive(w)
+		return
+	}
+
+	lock := strings.TrimPrefix(r.URL.Path, prefix)
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	msg, ok := sb.locked[lock]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	delete(sb.locked, lock)
+	switch r.Method {
+	case http.MethodDelete:
+		sb.completed = append(sb.completed, msg.id)
+	case http.MethodPut:
+		if msg.deliveryCount >= sb.maxDeliveryCount {
+			sb.deadLettered = append(sb.deadLettered, msg.id)
+		} else {
+			sb.queue = append(sb.queue, msg)
+		}
+	}
+}
+
+func (sb *fakeServiceBus) receive(w http.ResponseWriter) {
+	sb.mu.Lock()
+	if len(sb.queue) == 0 {
+		sb.mu.Unlock()
+		// Service Bus holds the request until a message arrives; waiting a
+		// little keeps the receiver from spinning.
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	msg := sb.queue[0]
+	sb.queue = sb.queue[1:]
+	msg.deliveryCount++
+	lock := fmt.Sprintf("%s/lock-%d", msg.id, msg.deliveryCount)
+	sb.locked[lock] = msg
+	sb.mu.Unlock()
+
+	properties, _ := json.Marshal(serviceBusBrokerProperties{
+		MessageID:       msg.id,
+		CorrelationID:   msg.correlationID,
+		EnqueuedTimeUTC: "Mon, 05 Oct 2026 10:00:00 GMT",
+		DeliveryCount:   msg.deliveryCount,
+	})
+	w.Header().Set("BrokerProperties", string(properties))
+	w.Header().Set("Location", sb.URL+"/"+sb.entity+"/messages/"+lock)
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(msg.body))
+}
+
+// settled reports whether every message has been completed or dead-lettered.
+func (sb *fakeServiceBus) settled() bool {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return len(sb.queue) == 0 && len(sb.locked) == 0
+}
+
+// runServiceBusSource runs source with invoker until every message of sb has
+// been settled.
+func runServiceBusSource(t *testing.T, sb *fakeServiceBus, source eventSource, invoker fnrun.Invoker) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- source(ctx, invoker) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !sb.settled() {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("expected every message to be settled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceBusSourceCompletesMessagesAfterSuccessfulInvocations(t *testing.T) {
+	sb := newFakeServiceBus(t, "orders", "a", "b", "c")
+	sb.queue[1].correlationID = "order-1"
+	source, err := newServiceBusSource(sb.connectionString(), "orders", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	metadata := make(map[string]map[string]string)
+	runServiceBusSource(t, sb, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		md, _ := runner.MetadataFromContext(ctx)
+		mu.Lock()
+		metadata[string(input.Data)] = md
+		mu.Unlock()
+		return &fnrun.Result{Status: 200}, nil
+	}))
+
+	if len(sb.completed) != 3 || len(sb.deadLettered) != 0 {
+		t.Errorf("expected all 3 messages to be completed, got completed %v and dead-lettered %v", sb.completed, sb.deadLettered)
+	}
+	if id := metadata["a"][correlationIDKey]; id != "msg-0" {
+		t.Errorf("expected the message ID as the correlation ID, got %q", id)
+	}
+	if id := metadata["b"][correlationIDKey]; id != "order-1" {
+		t.Errorf("expected the correlation ID of the message, got %q", id)
+	}
+	if ts := metadata["a"][eventTimestampKey]; ts != "2026-10-05T10:00:00Z" {
+		t.Errorf("expected the enqueued time as the event timestamp, got %q", ts)
+	}
+}
+
+func TestServiceBusSourceAbandonsFailedMessagesUntilTheyAreDeadLettered(t *testing.T) {
+	sb := newFakeServiceBus(t, "events/subscriptions/audit", "a", "b")
+	source, err := newServiceBusSource(sb.connectionString(), "", "events", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	runServiceBusSource(t, sb, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		mu.Lock()
+		attempts[string(input.Data)]++
+		mu.Unlock()
+		return nil, errors.New("sink unavailable")
+	}))
+
+	if len(sb.completed) != 0 || len(sb.deadLettered) != 2 {
+		t.Errorf("expected both messages to be dead-lettered, got completed %v and dead-lettered %v", sb.completed, sb.deadLettered)
+	}
+	if attempts["a"] != 3 || attempts["b"] != 3 {
+		t.Errorf("expected each message to be delivered 3 times, got %v", attempts)
+	}
+}
+
+func TestServiceBusSourceCompletesNackedMessagesWithoutRequeue(t *testing.T) {
+	sb := newFakeServiceBus(t, "orders", "drop", "requeue")
+	sb.maxDeliveryCount = 2
+	source, err := newServiceBusSource(sb.connectionString(), "orders", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runServiceBusSource(t, sb, source, &nackMappingInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return &fnrun.Result{Status: 500, Data: input.Data}, nil
+		}),
+		mapper: func(result *fnrun.Result) runner.NackDirective {
+			return runner.NackDirective{Requeue: string(result.Data) == "requeue"}
+		},
+	})
+
+	if len(sb.completed) != 1 || sb.completed[0] != "msg-0" {
+		t.Errorf("expected the message nacked without requeue to be completed, got %v", sb.completed)
+	}
+	if len(sb.deadLettered) != 1 || sb.deadLettered[0] != "msg-1" {
+		t.Errorf("expected the requeued message to be abandoned, got dead-lettered %v", sb.deadLettered)
+	}
+}
+
+func TestServiceBusSourceConfiguration(t *testing.T) {
+	const connStr = "Endpoint=sb://example.servicebus.windows.net/;SharedAccessKeyName=name;SharedAccessKey=key"
+	tests := []struct {
+		name         string
+		connStr      string
+		queue        string
+		topic        string
+		subscription string
+		wantErr      string
+	}{
+		{"missing connection string", "", "orders", "", "", "SERVICEBUS_CONNECTION_STRING"},
+		{"connection string without a key", "Endpoint=sb://example/", "orders", "", "", "SERVICEBUS_CONNECTION_STRING"},
+		{"queue and topic", connStr, "orders", "events", "audit", "SERVICEBUS_QUEUE"},
+		{"topic without a subscription", connStr, "", "events", "", "SERVICEBUS_SUBSCRIPTION"},
+		{"no entity", connStr, "", "", "", "SERVICEBUS_QUEUE"},
+		{"entity path", connStr + ";EntityPath=orders", "", "", "", ""},
+		{"queue", connStr, "orders", "", "", ""},
+		{"topic subscription", connStr, "", "events", "audit", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newServiceBusSource(tt.connStr, tt.queue, tt.topic, tt.subscription)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var configErr *runner.ConfigError
+			if !errors.As(err, &configErr) || configErr.Name != tt.wantErr {
+				t.Errorf("expected a %s config error, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseServiceBusConnectionStringUsesHTTPSForSB(t *testing.T) {
+	conn, err := parseServiceBusConnectionString("Endpoint=sb://example.servicebus.windows.net/;SharedAccessKeyName=name;SharedAccessKey=key;EntityPath=orders")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := serviceBusConnection{endpoint: "https://example.servicebus.windows.net", keyName: "name", key: "key", entity: "orders"}
+	if conn != want {
+		t.Errorf("expected %+v, got %+v", want, conn)
+	}
+}
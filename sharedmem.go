@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// -----------------------------------------------------------------------------
+// Shared memory
+//
+// Each invoker runs in its own function process, so a function that builds an
+// expensive in-memory structure (e.g., an index) would have to build it once
+// per process. When SHARED_MEMORY_PATH is set, the runner creates a file of
+// SHARED_MEMORY_SIZE_BYTES bytes at that path and maps it into its own address
+// space, and each function process is given the path in FNRUN_SHARED_MEM_PATH
+// so that it can map the same region with MAP_SHARED. The layout of the region
+// is up to the function.
+//
+// The file is created empty when the runner starts and is removed when it shuts
+// down. Placing it on a tmpfs mount (e.g., /dev/shm) keeps it out of the page
+// cache writeback path.
+
+const sharedMemoryEnvName = "FNRUN_SHARED_MEM_PATH"
+
+var errSharedMemoryUnsupported = errors.New("shared memory is not supported on this platform")
+
+// sharedMemory is a file-backed memory region shared with function processes.
+type sharedMemory struct {
+	path string
+	file *os.File
+	data []byte
+}
+
+// Close unmaps the region and removes its file.
+func (sm *sharedMemory) Close() error {
+	err := unmapSharedMemory(sm.data)
+	if closeErr := sm.file.Close(); err == nil {
+		err = closeErr
+	}
+	if removeErr := os.Remove(sm.path); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// createSharedMemory creates the file at path with the given size, replacing
+// any file left behind by a previous run, and maps it into memory.
+func createSharedMemory(path string, size int) (*sharedMemory, error) {
+	if size <= 0 {
+		return nil, configErrorf("SHARED_MEMORY_SIZE_BYTES", "SHARED_MEMORY_SIZE_BYTES must be greater than zero")
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(int64(size)); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	data, err := mapSharedMemory(file, size)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	return &sharedMemory{path: path, file: file, data: data}, nil
+}
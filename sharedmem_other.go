@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "os"
+
+func mapSharedMemory(file *os.File, size int) ([]byte, error) {
+	return nil, errSharedMemoryUnsupported
+}
+
+func unmapSharedMemory(data []byte) error {
+	return nil
+}
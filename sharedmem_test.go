@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestSharedMemoryIsAccessibleFromFunctionProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared")
+	sm, err := createSharedMemory(path, 4096)
+	if err == errSharedMemoryUnsupported {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(sm.data, "runner")
+
+	t.Setenv("SHARED_MEMORY_PATH", path)
+	t.Setenv(testFunctionEnv, "shared-mem")
+	factory, err := newFunctionCmdFactory(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := newSizedInvokerPool(factory, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	result, err := pool.Invoke(context.Background(), &fnrun.Input{Data: []byte("child!")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(result.Data) != "runner" {
+		t.Errorf("expected the function to read what the runner wrote, got %q", result.Data)
+	}
+	if got := string(sm.data[6:12]); got != "child!" {
+		t.Errorf("expected the runner to see what the function wrote, got %q", got)
+	}
+
+	if err := sm.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the shared memory file to be removed on close, got %v", err)
+	}
+}
+
+func TestCreateSharedMemoryRequiresASize(t *testing.T) {
+	if _, err := createSharedMemory(filepath.Join(t.TempDir(), "shared"), 0); err == nil {
+		t.Error("expected an error for a zero size")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// errShuttingDown is returned to the event source when it attempts to invoke
+// the function after the runner has begun shutting down.
+var errShuttingDown = errors.New("runner is shutting down")
+
+// -----------------------------------------------------------------------------
+// Drain Invoker
+//
+// The drain invoker tracks in-flight invocations so that the runner can wait
+// for them to complete during a graceful shutdown. Invocations do not inherit
+// cancellation from the context passed in by the source; they are only
+// cancelled when the drain timeout expires.
+//
+// The input of each invocation still running when the drain timeout expires
+// is delivered to the dead-letter sink, if one is configured, as a result with
+// status 503 so that it is not lost. The cancelled invocations are then given
+// drainCancelGrace to return before the runner exits without them.
+
+// drainCancelGrace is how long the drain waits for cancelled invocations to
+// return.
+var drainCancelGrace = 5 * time.Second
+
+// inFlightInvocation is an invocation tracked by the drain invoker.
+type inFlightInvocation struct {
+	ctx   context.Context
+	input *fnrun.Input
+}
+
+type drainInvoker struct {
+	invoker        fnrun.Invoker
+	deadLetterSink eventSinkTransformer
+	ctx            context.Context
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+	mu             sync.RWMutex
+	draining       bool
+	inFlight       int64
+
+	invocationsMu sync.Mutex
+	invocations   map[*inFlightInvocation]struct{}
+}
+
+func newDrainInvoker(invoker fnrun.Invoker, deadLetterSink eventSinkTransformer) *drainInvoker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &drainInvoker{
+		invoker:        invoker,
+		deadLetterSink: deadLetterSink,
+		ctx:            ctx,
+		cancel:         cancel,
+		invocations:    make(map[*inFlightInvocation]struct{}),
+	}
+}
+
+func (di *drainInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	result, _, err := di.InvokeAckable(ctx, input)
+	return result, err
+}
+
+// InvokeAckable is like Invoke but also returns the nack directive reported by
+// the underlying invoker, if any.
+func (di *drainInvoker) InvokeAckable(ctx context.Context, input *fnrun.Input) (*fnrun.Result, *runner.NackDirective, error) {
+	di.mu.RLock()
+	if di.draining {
+		di.mu.RUnlock()
+		return nil, nil, errShuttingDown
+	}
+	di.wg.Add(1)
+	di.mu.RUnlock()
+
+	invocation := &inFlightInvocation{ctx: ctx, input: input}
+	di.invocationsMu.Lock()
+	di.invocations[invocation] = struct{}{}
+	di.invocationsMu.Unlock()
+
+	atomic.AddInt64(&di.inFlight, 1)
+	defer func() {
+		di.invocationsMu.Lock()
+		delete(di.invocations, invocation)
+		di.invocationsMu.Unlock()
+		atomic.AddInt64(&di.inFlight, -1)
+		di.wg.Done()
+	}()
+
+	return invokeAckable(&detachedContext{Context: di.ctx, values: ctx}, di.invoker, input)
+}
+
+// drain stops accepting new invocations and waits up to timeout for in-flight
+// invocations to complete. Any invocations still running after the timeout are
+// dead-lettered and cancelled, and the number of abandoned invocations is
+// returned.
+func (di *drainInvoker) drain(timeout time.Duration) int {
+	di.mu.Lock()
+	di.draining = true
+	di.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		di.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		di.cancel()
+		return 0
+	case <-time.After(timeout):
+		abandoned := int(atomic.LoadInt64(&di.inFlight))
+		di.deadLetterInFlight()
+		di.cancel()
+		select {
+		case <-done:
+		case <-time.After(drainCancelGrace):
+			log.Printf("cancelled invocations did not return within %v; exiting without them", drainCancelGrace)
+		}
+		return abandoned
+	}
+}
+
+// deadLetterInFlight delivers the input of each invocation still in flight to
+// the dead-letter sink.
+func (di *drainInvoker) deadLetterInFlight() {
+	if di.deadLetterSink == nil {
+		return
+	}
+
+	di.invocationsMu.Lock()
+	invocations := make([]*inFlightInvocation, 0, len(di.invocations))
+	for invocation := range di.invocations {
+		invocations = append(invocations, invocation)
+	}
+	di.invocationsMu.Unlock()
+
+	for _, invocation := range invocations {
+		ctx, cancel := context.WithTimeout(context.Background(), drainCancelGrace)
+		result := &fnrun.Result{Status: http.StatusServiceUnavailable, Data: invocation.input.Data}
+		if _, err := deliverToDeadLetterSink(&detachedContext{Context: ctx, values: invocation.ctx}, di.deadLetterSink, result); err != nil {
+			log.Printf("could not dead-letter an abandoned invocation: %v", err)
+		}
+		cancel()
+	}
+}
+
+// detachedContext carries the values of one context while taking its deadline
+// and cancellation from another.
+type detachedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (dc *detachedContext) Value(key interface{}) interface{} {
+	return dc.values.Value(key)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestDrainWaitsForInFlightInvocations(t *testing.T) {
+	drainer := newDrainInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		time.Sleep(20 * time.Millisecond)
+		return &fnrun.Result{Status: 200}, nil
+	}), nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			drainer.Invoke(context.Background(), &fnrun.Input{})
+		}()
+	}
+	waitForInFlight(t, drainer, 3)
+
+	if abandoned := drainer.drain(time.Second); abandoned != 0 {
+		t.Errorf("expected no abandoned invocations, got %d", abandoned)
+	}
+	wg.Wait()
+}
+
+func TestDrainTimeoutCancelsAndCountsInFlightInvocations(t *testing.T) {
+	drainer := newDrainInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), nil)
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := drainer.Invoke(context.Background(), &fnrun.Input{})
+			errs <- err
+		}()
+	}
+	waitForInFlight(t, drainer, 2)
+
+	start := time.Now()
+	if abandoned := drainer.drain(10 * time.Millisecond); abandoned != 2 {
+		t.Errorf("expected 2 abandoned invocations, got %d", abandoned)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("drain took %v", elapsed)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != context.Canceled {
+			t.Errorf("expected the invocation to be cancelled, got %v", err)
+		}
+	}
+}
+
+func TestDrainRejectsNewInvocations(t *testing.T) {
+	drainer := newDrainInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{}, nil
+	}), nil)
+	drainer.drain(time.Second)
+
+	if _, err := drainer.Invoke(context.Background(), &fnrun.Input{}); err != errShuttingDown {
+		t.Errorf("expected errShuttingDown, got %v", err)
+	}
+}
+
+func TestDrainDeadLettersAbandonedInvocations(t *testing.T) {
+	deadLettered := make(chan *fnrun.Result, 1)
+	drainer := newDrainInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		deadLettered <- result
+		return result, nil
+	})
+
+	go drainer.Invoke(context.Background(), &fnrun.Input{Data: []byte("pending")})
+	waitForInFlight(t, drainer, 1)
+
+	drainer.drain(10 * time.Millisecond)
+
+	select {
+	case result := <-deadLettered:
+		if result.Status != http.StatusServiceUnavailable || string(result.Data) != "pending" {
+			t.Errorf("unexpected dead-lettered result: %d %q", result.Status, result.Data)
+		}
+	default:
+		t.Fatal("expected the abandoned input to be dead-lettered")
+	}
+}
+
+func TestDrainDoesNotWaitForeverForCancelledInvocations(t *testing.T) {
+	defer func(grace time.Duration) { drainCancelGrace = grace }(drainCancelGrace)
+	drainCancelGrace = 50 * time.Millisecond
+
+	release := make(chan struct{})
+	defer close(release)
+	drainer := newDrainInvoker(invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		<-release
+		return &fnrun.Result{}, nil
+	}), nil)
+
+	go drainer.Invoke(context.Background(), &fnrun.Input{})
+	waitForInFlight(t, drainer, 1)
+
+	done := make(chan int, 1)
+	go func() { done <- drainer.drain(10 * time.Millisecond) }()
+
+	select {
+	case abandoned := <-done:
+		if abandoned != 1 {
+			t.Errorf("expected 1 abandoned invocation, got %d", abandoned)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("drain did not return after the cancel grace period")
+	}
+}
+
+func waitForInFlight(t *testing.T, drainer *drainInvoker, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		drainer.invocationsMu.Lock()
+		count := int64(len(drainer.invocations))
+		drainer.invocationsMu.Unlock()
+		if count == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d invocations in flight", n)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Sink Backoff
+//
+// A backoff sink stops calling a sink that keeps failing, such as one whose
+// downstream API is down. After threshold consecutive failures, delivery to
+// the sink is paused for the base duration, and results that arrive during the
+// pause are delivered to the dead-letter sink instead, or fail if none is
+// configured. The first delivery after the pause is a trial: if it succeeds,
+// the sink is healthy again; if it fails, delivery is paused again for twice
+// as long as before, up to the maximum duration.
+
+type sinkBackoffConfig struct {
+	threshold      int
+	base           time.Duration
+	max            time.Duration
+	deadLetterSink eventSinkTransformer
+}
+
+// getSinkBackoff returns the sink backoff configured by the environment, or
+// nil if SINK_BACKOFF_THRESHOLD is not set.
+func getSinkBackoff() (*sinkBackoffConfig, error) {
+	// env: SINK_BACKOFF_THRESHOLD int 0 "Number of consecutive failures after which deliveries to a sink are paused; disabled when 0."
+	threshold := getIntEnv("SINK_BACKOFF_THRESHOLD", 0)
+	if threshold <= 0 {
+		return nil, nil
+	}
+
+	deadLetterSink, err := getDeadLetterSink()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sinkBackoffConfig{
+		threshold: threshold,
+		// env: SINK_BACKOFF_BASE_MILLIS int 1000 "Initial pause of deliveries to a sink after SINK_BACKOFF_THRESHOLD consecutive failures."
+		base: time.Duration(getIntEnv("SINK_BACKOFF_BASE_MILLIS", 1000)) * time.Millisecond,
+		// env: SINK_BACKOFF_MAX_MILLIS int 60000 "Maximum pause of deliveries to a failing sink."
+		max:            time.Duration(getIntEnv("SINK_BACKOFF_MAX_MILLIS", 60000)) * time.Millisecond,
+		deadLetterSink: deadLetterSink,
+	}, nil
+}
+
+// wrap returns sink wrapped in a backoff sink. name identifies the sink in
+// logs. A nil config returns sink unchanged.
+func (c *sinkBackoffConfig) wrap(name string, sink eventSinkTransformer) eventSinkTransformer {
+	if c == nil {
+		return sink
+	}
+
+	bs := &backoffSink{config: c, name: name, sink: sink, now: time.Now}
+	return bs.deliver
+}
+
+type backoffSink struct {
+	config      *sinkBackoffConfig
+	name        string
+	sink        eventSinkTransformer
+	now         func() time.Time
+	mu          sync.Mutex
+	failures    int
+	pause       time.Duration
+	pausedUntil time.Time
+}
+
+func (bs *backoffSink) deliver(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+	bs.mu.Lock()
+	paused := bs.now().Before(bs.pausedUntil)
+	bs.mu.Unlock()
+
+	if paused {
+		if bs.config.deadLetterSink == nil {
+			return result, fmt.Errorf("delivery to sink %s is paused after repeated failures", bs.name)
+		}
+		return deliverToDeadLetterSink(ctx, bs.config.deadLetterSink, result)
+	}
+
+	transformed, err := bs.sink(ctx, result)
+	bs.record(err)
+	return transformed, err
+}
+
+func (bs *backoffSink) record(err error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if err == nil {
+		if bs.pause > 0 {
+			log.Printf("resuming delivery to sink %s", bs.name)
+		}
+		bs.failures = 0
+		bs.pause = 0
+		return
+	}
+
+	bs.failures++
+	if bs.failures < bs.config.threshold {
+		return
+	}
+
+	if bs.pause == 0 {
+		bs.pause = bs.config.base
+	} else if bs.pause *= 2; bs.pause > bs.config.max {
+		bs.pause = bs.config.max
+	}
+	bs.pausedUntil = bs.now().Add(bs.pause)
+	log.Printf("pausing delivery to sink %s for %v after %d consecutive failures: %v", bs.name, bs.pause, bs.failures, err)
+}
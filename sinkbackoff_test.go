@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// backoffHarness drives a backoff sink with a controlled clock and records
+// where each result was delivered.
+type backoffHarness struct {
+	clock       time.Time
+	failing     bool
+	delivered   int
+	deadLetters int
+	sink        eventSinkTransformer
+}
+
+func newBackoffHarness(withDeadLetterSink bool) *backoffHarness {
+	h := &backoffHarness{clock: time.Unix(1700000000, 0)}
+	config := &sinkBackoffConfig{threshold: 3, base: time.Second, max: 3 * time.Second}
+	if withDeadLetterSink {
+		config.deadLetterSink = func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			h.deadLetters++
+			return result, nil
+		}
+	}
+	bs := &backoffSink{config: config, name: "test", now: func() time.Time { return h.clock }}
+	bs.sink = func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		h.delivered++
+		if h.failing {
+			return result, errors.New("downstream is down")
+		}
+		return result, nil
+	}
+	h.sink = bs.deliver
+	return h
+}
+
+// deliver delivers a result and reports whether it reached the sink.
+func (h *backoffHarness) deliver(t *testing.T) bool {
+	t.Helper()
+	before := h.delivered
+	h.sink(context.Background(), &fnrun.Result{Data: []byte("x")})
+	return h.delivered > before
+}
+
+func TestBackoffSinkPausesAfterTheThresholdAndRecovers(t *testing.T) {
+	h := newBackoffHarness(true)
+	h.failing = true
+
+	for i := 0; i < 3; i++ {
+		if !h.deliver(t) {
+			t.Fatalf("expected failure %d to reach the sink", i+1)
+		}
+	}
+	if h.deliver(t) || h.deadLetters != 1 {
+		t.Fatalf("expected delivery to be paused after 3 failures, got %d dead letters", h.deadLetters)
+	}
+
+	// The pause doubles after each failed trial, up to the maximum.
+	for _, pause := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		h.clock = h.clock.Add(pause - time.Millisecond)
+		if h.deliver(t) {
+			t.Fatalf("expected delivery to stay paused for %v", pause)
+		}
+		h.clock = h.clock.Add(time.Millisecond)
+		if !h.deliver(t) {
+			t.Fatalf("expected a trial delivery after %v", pause)
+		}
+	}
+
+	h.failing = false
+	h.clock = h.clock.Add(3 * time.Second)
+	if !h.deliver(t) {
+		t.Fatal("expected a trial delivery after the pause")
+	}
+
+	// After a successful trial, failures are counted from zero again.
+	h.failing = true
+	for i := 0; i < 3; i++ {
+		if !h.deliver(t) {
+			t.Fatalf("expected failure %d after recovery to reach the sink", i+1)
+		}
+	}
+	if h.deliver(t) {
+		t.Error("expected delivery to be paused again after 3 failures")
+	}
+}
+
+func TestBackoffSinkFailsPausedDeliveriesWithoutADeadLetterSink(t *testing.T) {
+	h := newBackoffHarness(false)
+	h.failing = true
+	for i := 0; i < 3; i++ {
+		h.deliver(t)
+	}
+
+	h.failing = false
+	if _, err := h.sink(context.Background(), &fnrun.Result{}); err == nil {
+		t.Error("expected a paused delivery to fail")
+	}
+	if h.delivered != 3 {
+		t.Errorf("expected the paused delivery not to reach the sink, got %d deliveries", h.delivered)
+	}
+}
+
+func TestSinkBackoffIsDisabledByDefault(t *testing.T) {
+	t.Setenv("SINK_BACKOFF_THRESHOLD", "")
+	config, err := getSinkBackoff()
+	if err != nil || config != nil {
+		t.Fatalf("expected no backoff, got %v, %v", config, err)
+	}
+	if config.wrap("test", nil) != nil {
+		t.Error("expected a nil config to return the sink unchanged")
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Built-in sinks
+//
+// Built-in sinks are selected with SINK_TYPE or by naming them in
+// SINK_PLUGIN_PATH with the builtin: prefix, which allows them to be combined
+// with plugin sinks in a chain or fan-out.
+
+const builtinSinkPrefix = "builtin:"
+
+const defaultReplayStorePath = "replay-store.ndjson"
+
+// getBuiltinSink returns the built-in sink with the given name.
+func getBuiltinSink(name string) (eventSinkTransformer, error) {
+	switch name {
+	case "dry-run":
+		// env: DRYRUN_FORMAT string json "Output format of the dry-run sink: json or text."
+		return newDryRunSink(os.Stdout, getStringEnv("DRYRUN_FORMAT", "json"))
+	case "replay-store":
+		return newReplayStoreSink(getStringEnv("REPLAY_STORE_PATH", defaultReplayStorePath))
+	case "gcp-pubsub":
+		return newPubSubSink(
+			// env: PUBSUB_SINK_PROJECT string "" "Google Cloud project of the gcp-pubsub sink topic."
+			os.Getenv("PUBSUB_SINK_PROJECT"),
+			// env: PUBSUB_SINK_TOPIC string "" "Topic to which the gcp-pubsub sink publishes."
+			os.Getenv("PUBSUB_SINK_TOPIC"),
+			// env: PUBSUB_SINK_BATCH_COUNT int 0 "Number of messages the gcp-pubsub sink publishes in a batch; the client default is used when 0."
+			getIntEnv("PUBSUB_SINK_BATCH_COUNT", 0),
+			// env: PUBSUB_SINK_BATCH_DELAY_MILLIS int 0 "Maximum delay before the gcp-pubsub sink publishes a batch; the client default is used when 0."
+			time.Duration(getIntEnv("PUBSUB_SINK_BATCH_DELAY_MILLIS", 0))*time.Millisecond,
+		)
+	case "postgres":
+		return getPostgresSink()
+	case "nats":
+		return newNATSSink(
+			// env: NATS_SINK_URL string nats://127.0.0.1:4222 "URL of the NATS server to which the nats sink publishes."
+			getStringEnv("NATS_SINK_URL", nats.DefaultURL),
+			// env: NATS_SINK_SUBJECT string "" "Subject to which the nats sink publishes results."
+			os.Getenv("NATS_SINK_SUBJECT"),
+		)
+	case "influxdb":
+		return newInfluxDBSink(
+			// env: INFLUXDB_URL string "" "URL of the InfluxDB 2 server to which the influxdb sink writes points."
+			os.Getenv("INFLUXDB_URL"),
+			// env: INFLUXDB_TOKEN string "" "API token with which the influxdb sink authenticates."
+			os.Getenv("INFLUXDB_TOKEN"),
+			// env: INFLUXDB_ORG string "" "Organization of INFLUXDB_BUCKET."
+			os.Getenv("INFLUXDB_ORG"),
+			// env: INFLUXDB_BUCKET string "" "Bucket to which the influxdb sink writes points."
+			os.Getenv("INFLUXDB_BUCKET"),
+		)
+	case "arrow-ipc":
+		return newArrowIPCSink(
+			// env: ARROW_IPC_PATH string "" "File to which the arrow-ipc sink writes results as an Arrow IPC stream."
+			os.Getenv("ARROW_IPC_PATH"),
+			// env: ARROW_ROTATE_BYTES int 0 "Size at which the arrow-ipc sink closes its file and starts a new one; the file is not rotated when 0."
+			int64(getIntEnv("ARROW_ROTATE_BYTES", 0)),
+		)
+	default:
+		return nil, configErrorf("SINK_TYPE", "Unknown built-in sink %s", name)
+	}
+}
+
+// newDryRunSink returns a sink that writes each result to w instead of
+// delivering it, so that the output of a function can be inspected without
+// affecting downstream systems. In the json format, each result is written as
+// a line of JSON in the format written by the stdin source; in the text format,
+// it is written as a line of the form
+// "status=<status> env=<k=v,...> data=<data>".
+func newDryRunSink(w io.Writer, format string) (eventSinkTransformer, error) {
+	var write func(result *fnrun.Result) error
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		write = func(result *fnrun.Result) error {
+			return encoder.Encode(replayOutput{Status: result.Status, Data: result.Data, Env: result.Env})
+		}
+	case "text":
+		write = func(result *fnrun.Result) error {
+			_, err := fmt.Fprintf(w, "status=%d env=%s data=%s\n", result.Status, formatEnv(result.Env), result.Data)
+			return err
+		}
+	default:
+		return nil, configErrorf("DRYRUN_FORMAT", "Unknown DRYRUN_FORMAT %s", format)
+	}
+
+	var mu sync.Mutex
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// A failure to write the output is not a failure to deliver the result.
+		write(result)
+		return result, nil
+	}, nil
+}
+
+// formatEnv formats env as a comma-separated list of key=value pairs sorted by
+// key.
+func formatEnv(env map[string]string) string {
+	pairs := make([]string, 0, len(env))
+	for k, v := range env {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+type replayInputKey struct{}
+
+// replayStores holds the files opened by replay-store sinks so that they can be
+// closed with the pipeline.
+var replayStores struct {
+	sync.Mutex
+	files []*os.File
+}
+
+// replayStoresOpen reports whether any replay-store sink has been created.
+func replayStoresOpen() bool {
+	replayStores.Lock()
+	defer replayStores.Unlock()
+	return len(replayStores.files) > 0
+}
+
+// closeReplayStores closes the files opened by replay-store sinks.
+func closeReplayStores() error {
+	replayStores.Lock()
+	defer replayStores.Unlock()
+
+	var firstErr error
+	for _, file := range replayStores.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	replayStores.files = nil
+	return firstErr
+}
+
+// replayStoreCloser closes the replay-store sinks when the pipeline is closed.
+type replayStoreCloser struct{}
+
+func (replayStoreCloser) Close() error {
+	return closeReplayStores()
+}
+
+// replayInputInvoker places the input that it is invoked with in the context so
+// that the replay-store sink can store the input from the source rather than
+// the result of the function.
+type replayInputInvoker struct {
+	invoker fnrun.Invoker
+}
+
+func (ri *replayInputInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	original := *input
+	return ri.invoker.Invoke(context.WithValue(ctx, replayInputKey{}, &original), input)
+}
+
+func replayInputFromContext(ctx context.Context) (*fnrun.Input, bool) {
+	input, ok := ctx.Value(replayInputKey{}).(*fnrun.Input)
+	return input, ok
+}
+
+// newReplayStoreSink returns a sink that appends the input of each invocation
+// to the replay log at path so that it can be replayed later with
+// SOURCE_TYPE=replay. The input is the one that the source passed to the
+// pipeline, and it is stored along with the time it was stored and the
+// correlation ID from the x-correlation-id metadata key. When the sink is
+// called outside of the pipeline, the data of the result is stored instead.
+//
+// Inputs are deduplicated by correlation ID, including against the records
+// already in the log when the sink is created. Inputs without a correlation ID
+// are always stored.
+func newReplayStoreSink(path string) (eventSinkTransformer, error) {
+	seen, err := readReplayCorrelationIDs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(file)
+
+	replayStores.Lock()
+	replayStores.files = append(replayStores.files, file)
+	replayStores.Unlock()
+
+	var mu sync.Mutex
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		record := replayRecord{Time: time.Now().UTC(), Data: result.Data}
+		if input, ok := replayInputFromContext(ctx); ok {
+			record.Data = input.Data
+		}
+		if metadata, ok := runner.MetadataFromContext(ctx); ok {
+			record.CorrelationID = metadata[correlationIDKey]
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if record.CorrelationID != "" {
+			if seen[record.CorrelationID] {
+				return result, nil
+			}
+			seen[record.CorrelationID] = true
+		}
+
+		return result, encoder.Encode(record)
+	}, nil
+}
+
+// readReplayCorrelationIDs returns the correlation IDs of the records in the
+// replay log at path. A log that does not exist has no records.
+func readReplayCorrelationIDs(path string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return seen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var record replayRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err == nil && record.CorrelationID != "" {
+			seen[record.CorrelationID] = true
+		}
+	}
+
+	return seen, scanner.Err()
+}
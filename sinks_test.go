@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestReplayStoreSinkStoresInputsThatTheReplaySourceReinvokes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.ndjson")
+	sink, err := newReplayStoreSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upper := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 200, Data: bytes.ToUpper(input.Data)}, nil
+	})
+	pipeline, closer, err := getPipeline(upper, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		ctx := runner.WithMetadata(context.Background(), map[string]string{correlationIDKey: fmt.Sprint("id-", i)})
+		if _, err := pipeline.Invoke(ctx, &fnrun.Input{Data: []byte(fmt.Sprint("input-", i))}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// A duplicate correlation ID is not stored again.
+	ctx := runner.WithMetadata(context.Background(), map[string]string{correlationIDKey: "id-0"})
+	if _, err := pipeline.Invoke(ctx, &fnrun.Input{Data: []byte("duplicate")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatalf("expected the pipeline closer to close the store, got %v", err)
+	}
+	if replayStoresOpen() {
+		t.Error("expected the replay store to be closed with the pipeline")
+	}
+
+	var mu sync.Mutex
+	var replayed []string
+	correlationIDs := map[string]bool{}
+	recorder := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		replayed = append(replayed, string(input.Data))
+		if metadata, ok := runner.MetadataFromContext(ctx); ok {
+			correlationIDs[metadata[correlationIDKey]] = true
+		}
+		return &fnrun.Result{}, nil
+	})
+
+	if err := newReplaySource(path, 0)(context.Background(), recorder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(replayed) != 5 {
+		t.Fatalf("expected 5 inputs to be replayed, got %v", replayed)
+	}
+	for i, data := range replayed {
+		if want := fmt.Sprint("input-", i); data != want {
+			t.Errorf("expected replayed input %d to be %q, got %q", i, want, data)
+		}
+		if !correlationIDs[fmt.Sprint("id-", i)] {
+			t.Errorf("expected the correlation ID of input %d to be replayed", i)
+		}
+	}
+}
+
+func TestReplayStoreSinkDeduplicatesAgainstExistingLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.ndjson")
+	ctx := runner.WithMetadata(context.Background(), map[string]string{correlationIDKey: "id"})
+
+	for i := 0; i < 2; i++ {
+		sink, err := newReplayStoreSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sink(ctx, &fnrun.Result{Data: []byte("data")}); err != nil {
+			t.Fatal(err)
+		}
+		closeReplayStores()
+	}
+
+	var replayed int
+	recorder := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		replayed++
+		return &fnrun.Result{}, nil
+	})
+	if err := newReplaySource(path, 0)(context.Background(), recorder); err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 1 {
+		t.Errorf("expected 1 input to be replayed, got %d", replayed)
+	}
+}
+
+func TestDryRunSinkFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"json", `{"status":200,"data":"aGk=","env":{"a":"1"}}` + "\n"},
+		{"text", "status=200 env=a=1 data=hi\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			sink, err := newDryRunSink(&buf, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sink(context.Background(), &fnrun.Result{Status: 200, Data: []byte("hi"), Env: map[string]string{"a": "1"}}); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := newDryRunSink(&bytes.Buffer{}, "xml"); err == nil || !strings.Contains(err.Error(), "DRYRUN_FORMAT") {
+		t.Errorf("expected an error for an unknown format, got %v", err)
+	}
+}
+
+func TestDryRunSinkPrintsToStdout(t *testing.T) {
+	t.Setenv("DRYRUN_FORMAT", "text")
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdoutR.Close()
+	oldStdout := os.Stdout
+	os.Stdout = stdoutW
+	defer func() { os.Stdout = oldStdout }()
+
+	sink, err := getBuiltinSink("dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &fnrun.Result{Status: 201, Data: []byte("created")}
+	returned, err := sink(context.Background(), result)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if returned != result {
+		t.Error("expected the result to be returned unchanged")
+	}
+
+	os.Stdout = oldStdout
+	stdoutW.Close()
+	output, err := ioutil.ReadAll(stdoutR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "status=201 env= data=created\n"; string(output) != want {
+		t.Errorf("expected %q on stdout, got %q", want, output)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+var sinkHardTimeouts = newCounter(
+	"fnrunner_sink_hard_timeouts_total",
+	"Number of sink deliveries abandoned because they did not return within SINK_HARD_TIMEOUT_MILLIS.",
+)
+
+// -----------------------------------------------------------------------------
+// Sink Timeouts
+//
+// A sink that hangs would otherwise hold the invocation that delivers to it,
+// and with it a slot of the source, forever. When MAX_SINK_MILLIS is set, the
+// context of each delivery is cancelled once the delivery has run for that
+// long. The built-in network sinks abort their request when the context is
+// cancelled, which closes the connection that it was using.
+//
+// A sink that ignores the cancellation is abandoned after
+// SINK_HARD_TIMEOUT_MILLIS, twice MAX_SINK_MILLIS by default: the delivery
+// fails and the invocation returns, while the sink call is left to finish in
+// the background and its outcome is discarded. Abandoned deliveries are logged
+// and counted in fnrunner_sink_hard_timeouts_total. SINK_HARD_TIMEOUT_MILLIS
+// may also be set on its own, in which case the context is cancelled when the
+// delivery is abandoned.
+
+func newTimeoutSink(sink eventSinkTransformer, timeout time.Duration, hardTimeout time.Duration) eventSinkTransformer {
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		if timeout > 0 {
+			var cancelTimeout context.CancelFunc
+			ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+			defer cancelTimeout()
+		}
+
+		type delivery struct {
+			result *fnrun.Result
+			err    error
+		}
+		done := make(chan delivery, 1)
+		go func() {
+			transformed, err := sink(ctx, result)
+			done <- delivery{transformed, err}
+		}()
+
+		timer := time.NewTimer(hardTimeout)
+		defer timer.Stop()
+
+		select {
+		case d := <-done:
+			return d.result, d.err
+		case <-timer.C:
+			sinkHardTimeouts.inc()
+			log.Printf("sink did not return within %v; abandoning the delivery", hardTimeout)
+			return result, fmt.Errorf("sink did not return within SINK_HARD_TIMEOUT_MILLIS (%v)", hardTimeout)
+		}
+	}
+}
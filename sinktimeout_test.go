@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// hangingSink returns a sink that ignores its context and does not return
+// until the test completes. It reports the context of each delivery on
+// delivered.
+func hangingSink(t *testing.T) (eventSinkTransformer, chan context.Context) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	delivered := make(chan context.Context, 10)
+	return func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		delivered <- ctx
+		<-release
+		return result, nil
+	}, delivered
+}
+
+func TestTimeoutSinkAbandonsSinkThatNeverReturns(t *testing.T) {
+	out := captureLog(t)
+	sink, delivered := hangingSink(t)
+	before := atomic.LoadUint64(&sinkHardTimeouts.value)
+
+	start := time.Now()
+	result := &fnrun.Result{Status: 200, Data: []byte("x")}
+	got, err := newTimeoutSink(sink, 20*time.Millisecond, 50*time.Millisecond)(context.Background(), result)
+	elapsed := time.Since(start)
+
+	if err == nil || !strings.Contains(err.Error(), "sink did not return within SINK_HARD_TIMEOUT_MILLIS (50ms)") {
+		t.Errorf("expected the delivery to be abandoned, got %v", err)
+	}
+	if got != result {
+		t.Errorf("expected the result to be returned with the error, got %+v", got)
+	}
+	if elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected the delivery to be abandoned after 50ms, took %v", elapsed)
+	}
+	if n := atomic.LoadUint64(&sinkHardTimeouts.value) - before; n != 1 {
+		t.Errorf("expected one hard timeout to be counted, got %d", n)
+	}
+	if !strings.Contains(out.String(), "abandoning the delivery") {
+		t.Errorf("expected the abandoned delivery to be logged, got %q", out.String())
+	}
+	if ctx := <-delivered; ctx.Err() == nil {
+		t.Error("expected the context of the abandoned delivery to be cancelled")
+	}
+}
+
+func TestTimeoutSinkCancelsTheDeliveryAfterMaxSinkMillis(t *testing.T) {
+	before := atomic.LoadUint64(&sinkHardTimeouts.value)
+	sink := newTimeoutSink(func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, 20*time.Millisecond, time.Minute)
+
+	start := time.Now()
+	_, err := sink(context.Background(), &fnrun.Result{Status: 200})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the delivery to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the delivery to be cancelled after 20ms, took %v", elapsed)
+	}
+	if n := atomic.LoadUint64(&sinkHardTimeouts.value) - before; n != 0 {
+		t.Errorf("expected no hard timeout when the sink returns, got %d", n)
+	}
+}
+
+func TestTimeoutSinkWithOnlyHardTimeoutCancelsWhenAbandoning(t *testing.T) {
+	sink, delivered := hangingSink(t)
+	if _, err := newTimeoutSink(sink, 0, 30*time.Millisecond)(context.Background(), &fnrun.Result{}); err == nil {
+		t.Error("expected the delivery to be abandoned")
+	}
+	ctx := <-delivered
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected the delivery to have no deadline without MAX_SINK_MILLIS")
+	}
+	if ctx.Err() != context.Canceled {
+		t.Errorf("expected the context to be cancelled when the delivery was abandoned, got %v", ctx.Err())
+	}
+}
+
+func TestTimeoutSinkPassesThroughFastDeliveries(t *testing.T) {
+	transformed := &fnrun.Result{Status: 201, Data: []byte("transformed")}
+	sink := newTimeoutSink(func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected the delivery to have a deadline")
+		}
+		return transformed, nil
+	}, time.Second, 2*time.Second)
+
+	if got, err := sink(context.Background(), &fnrun.Result{Status: 200}); err != nil || got != transformed {
+		t.Errorf("expected the result of the sink, got %+v: %v", got, err)
+	}
+}
+
+func TestTimeoutSinkClosesTheConnectionOfNetworkSinks(t *testing.T) {
+	closed := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices that the connection was closed once the
+		// body has been read.
+		ioutil.ReadAll(r.Body)
+		<-r.Context().Done()
+		close(closed)
+	}))
+	defer server.Close()
+
+	sink := newTimeoutSink(func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, strings.NewReader(string(result.Data)))
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		return result, nil
+	}, 20*time.Millisecond, time.Minute)
+
+	if _, err := sink(context.Background(), &fnrun.Result{Data: []byte("x")}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the request to be aborted, got %v", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to see the connection closed")
+	}
+}
+
+func TestSinkHardTimeoutConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSink string
+		hard    string
+		wantErr bool
+	}{
+		{"default", "100", "", false},
+		{"only hard timeout", "", "100", false},
+		{"hard below max", "100", "50", true},
+		{"hard equal to max", "100", "100", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_SINK_MILLIS", tt.maxSink)
+			t.Setenv("SINK_HARD_TIMEOUT_MILLIS", tt.hard)
+
+			_, _, err := getPipeline(echoInvoker{}, func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+				return result, nil
+			})
+			var configErr *runner.ConfigError
+			if isConfigErr := errors.As(err, &configErr) && configErr.Name == "SINK_HARD_TIMEOUT_MILLIS"; isConfigErr != tt.wantErr {
+				t.Errorf("expected a SINK_HARD_TIMEOUT_MILLIS config error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/tessellator/executil"
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Built-in sources
+
+// stdinSource reads newline-delimited JSON inputs from stdin, invokes the
+// function with each, and writes the results to stdout as newline-delimited
+// JSON. It returns when stdin is closed.
+func stdinSource(ctx context.Context, invoker fnrun.Invoker) error {
+	return invokeNDJSON(ctx, invoker, os.Stdin, os.Stdout, 0)
+}
+
+// newLoadGeneratorSource returns a source that invokes the function with
+// synthetic inputs of payloadBytes random bytes at the given rate per second.
+// The source runs for the provided duration, or until it is cancelled if the
+// duration is zero, and then logs the number of inputs generated, invoked and
+// failed.
+func newLoadGeneratorSource(rate float64, duration time.Duration, payloadBytes int) (eventSource, error) {
+	if rate <= 0 {
+		return nil, configErrorf("LOAD_RATE_PER_SECOND", "LOAD_RATE_PER_SECOND must be greater than zero")
+	}
+
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		return generateLoad(ctx, invoker, "load generator", rate, duration, func(int64) []byte {
+			data := make([]byte, payloadBytes)
+			r.Read(data)
+			return data
+		})
+	}, nil
+}
+
+// generateLoad invokes the function at the given rate per second with the
+// data returned by next, which is passed the zero-based index of the input. It
+// runs for the provided duration, or until ctx is cancelled if the duration is
+// zero, and then logs the number of inputs generated, invoked and failed.
+func generateLoad(ctx context.Context, invoker fnrun.Invoker, name string, rate float64, duration time.Duration, next func(index int64) []byte) error {
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+
+	var generated, invoked, failed int64
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		log.Printf("%s: generated=%d invoked=%d errors=%d", name, generated, atomic.LoadInt64(&invoked), atomic.LoadInt64(&failed))
+	}()
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		data := next(generated)
+		generated++
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := invoker.Invoke(ctx, &fnrun.Input{Data: data}); err != nil {
+				atomic.AddInt64(&failed, 1)
+				return
+			}
+			atomic.AddInt64(&invoked, 1)
+		}()
+	}
+}
+
+// newReplaySource returns a source that invokes the function with each input in
+// the replay log at path, such as one written by the replay-store sink, and
+// returns when every input has been invoked. If speed is greater than zero,
+// the delay between invocations matches the delay between the recorded times
+// divided by speed; otherwise inputs are replayed as fast as possible.
+func newReplaySource(path string, speed float64) eventSource {
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return invokeNDJSON(ctx, invoker, file, ioutil.Discard, speed)
+	}
+}
+
+// newProcessSource returns a source that runs cmdStr and treats the process as
+// the source of events. The process writes newline-delimited JSON inputs, in
+// the format accepted by stdinSource, to its stdout and receives the result of
+// each as a line of newline-delimited JSON on its stdin. The source returns
+// when the process exits; when the source is cancelled, the process is sent
+// SIGTERM.
+func newProcessSource(cmdStr string) (eventSource, error) {
+	if cmdStr == "" {
+		return nil, configErrorf("SOURCE_PROCESS_COMMAND", "SOURCE_PROCESS_COMMAND is required when SOURCE_TYPE is process")
+	}
+
+	baseCmd, err := executil.ParseCmd(cmdStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, invoker fnrun.Invoker) error {
+		cmd := executil.CloneCmd(baseCmd)
+		cmd.Stderr = os.Stderr
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+					cmd.Process.Kill()
+				}
+			case <-done:
+			}
+		}()
+
+		invokeErr := invokeNDJSON(ctx, invoker, stdout, stdin, 0)
+		stdin.Close()
+		waitErr := cmd.Wait()
+
+		if invokeErr != nil {
+			return invokeErr
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		return waitErr
+	}, nil
+}
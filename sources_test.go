@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+var prefixingInvoker = invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	return &fnrun.Result{Status: 200, Data: []byte("got " + string(input.Data))}, nil
+})
+
+func TestInvokeNDJSONStreamsResultsForPipedInputs(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- invokeNDJSON(context.Background(), prefixingInvoker, inR, outW, 0)
+		outW.Close()
+	}()
+
+	// Each result is expected before the next input is written, as it would
+	// be for an interactive pipe.
+	encoder := json.NewEncoder(inW)
+	outputs := bufio.NewScanner(outR)
+	for i := 0; i < 3; i++ {
+		if err := encoder.Encode(replayRecord{Data: []byte(fmt.Sprint("input-", i))}); err != nil {
+			t.Fatal(err)
+		}
+		if !outputs.Scan() {
+			t.Fatalf("expected a result for input %d: %v", i, outputs.Err())
+		}
+		var output replayOutput
+		if err := json.Unmarshal(outputs.Bytes(), &output); err != nil {
+			t.Fatalf("expected a JSON result, got %q: %v", outputs.Text(), err)
+		}
+		if want := fmt.Sprint("got input-", i); output.Status != 200 || string(output.Data) != want {
+			t.Errorf("expected a 200 result with data %q, got %+v", want, output)
+		}
+	}
+
+	inW.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected the source to finish cleanly at EOF, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the source to return at EOF")
+	}
+	if outputs.Scan() {
+		t.Errorf("expected no further output, got %q", outputs.Text())
+	}
+}
+
+func TestInvokeNDJSONRejectsMalformedInputs(t *testing.T) {
+	inR, inW := io.Pipe()
+	go func() {
+		io.WriteString(inW, "not json\n")
+		inW.Close()
+	}()
+
+	if err := invokeNDJSON(context.Background(), prefixingInvoker, inR, ioutil.Discard, 0); err == nil {
+		t.Error("expected an error for a malformed input")
+	}
+}
+
+func TestStdinSourceReadsStdinAndWritesStdout(t *testing.T) {
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdoutR.Close()
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdinR, stdoutW
+	defer func() { os.Stdin, os.Stdout = oldStdin, oldStdout }()
+
+	go func() {
+		encoder := json.NewEncoder(stdinW)
+		encoder.Encode(replayRecord{Data: []byte("a")})
+		encoder.Encode(replayRecord{Data: []byte("b")})
+		stdinW.Close()
+	}()
+
+	if err := stdinSource(context.Background(), prefixingInvoker); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stdoutW.Close()
+	stdinR.Close()
+
+	var got []string
+	outputs := bufio.NewScanner(stdoutR)
+	for outputs.Scan() {
+		var output replayOutput
+		if err := json.Unmarshal(outputs.Bytes(), &output); err != nil {
+			t.Fatalf("expected a JSON result, got %q: %v", outputs.Text(), err)
+		}
+		got = append(got, string(output.Data))
+	}
+	if len(got) != 2 || got[0] != "got a" || got[1] != "got b" {
+		t.Errorf("expected a result for each input in order, got %q", got)
+	}
+}
+
+func TestLoadGeneratorInvokesAtTheConfiguredRate(t *testing.T) {
+	source, err := newLoadGeneratorSource(100, time.Second, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var invocations int64
+	invoker := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if len(input.Data) != 16 {
+			t.Errorf("expected a 16-byte payload, got %d bytes", len(input.Data))
+		}
+		atomic.AddInt64(&invocations, 1)
+		return &fnrun.Result{}, nil
+	})
+
+	start := time.Now()
+	if err := source(context.Background(), invoker); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 2*time.Second {
+		t.Errorf("expected the generator to run for LOAD_DURATION_SECONDS, ran for %v", elapsed)
+	}
+	if n := atomic.LoadInt64(&invocations); n < 80 || n > 100 {
+		t.Errorf("expected about 100 invocations in a second, got %d", n)
+	}
+}
+
+func TestLoadGeneratorStopsWhenCancelled(t *testing.T) {
+	source, err := newLoadGeneratorSource(1000, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- source(ctx, prefixingInvoker) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a generator without a duration to stop when cancelled")
+	}
+}
+
+func TestLoadGeneratorRequiresARate(t *testing.T) {
+	if _, err := newLoadGeneratorSource(0, time.Second, 1); err == nil {
+		t.Error("expected an error for a zero rate")
+	}
+}
+
+// writeScript writes an executable shell script with the given body to a
+// temporary directory and returns its path.
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script.sh")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProcessSourceDispatchesInputsAndReturnsResults(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "results.ndjson")
+	// The process writes each input and waits for its result before writing
+	// the next one.
+	script := writeScript(t, `for data in YQ== Yg== Yw==; do
+	echo "{\"data\":\"$data\"}"
+	read result
+	echo "$result" >> `+out+`
+done
+`)
+	source, err := newProcessSource(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inputs []string
+	err = source(context.Background(), invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		inputs = append(inputs, string(input.Data))
+		return &fnrun.Result{Status: 200, Data: []byte("got " + string(input.Data))}, nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Join(inputs, ",") != "a,b,c" {
+		t.Errorf("expected the inputs of the process to be dispatched in order, got %q", inputs)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var output replayOutput
+		if err := json.Unmarshal([]byte(line), &output); err != nil {
+			t.Fatalf("expected the process to receive JSON results, got %q: %v", line, err)
+		}
+		results = append(results, string(output.Data))
+	}
+	if strings.Join(results, ",") != "got a,got b,got c" {
+		t.Errorf("expected the process to receive each result, got %q", results)
+	}
+}
+
+func TestProcessSourceStopsTheProcessWhenCancelled(t *testing.T) {
+	source, err := newProcessSource(writeScript(t, "exec sleep 30\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- source(ctx, prefixingInvoker) }()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected no error after cancellation, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the source to stop the process when cancelled")
+	}
+}
+
+func TestProcessSourceReportsProcessFailures(t *testing.T) {
+	source, err := newProcessSource(writeScript(t, "exit 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := source(context.Background(), prefixingInvoker); err == nil {
+		t.Error("expected the exit status of the process to be reported")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/tessellator/fnrun"
+)
+
+// errInvalidSplitInput is returned when an input cannot be split because its
+// data is not a JSON array.
+var errInvalidSplitInput = errors.New("split input data must be a JSON array")
+
+// -----------------------------------------------------------------------------
+// Split Invoker
+//
+// The split invoker is the inverse of the batch invoker. It splits an input
+// whose data is a JSON array into one input per element and invokes the
+// underlying invoker with each element concurrently. The results are combined
+// into a single result whose data is a JSON array with one element per input
+// element. The status of the combined result is the highest status of the
+// element results, so that a failure of any element is visible to the sink.
+
+type splitInvoker struct {
+	invoker fnrun.Invoker
+}
+
+func (si *splitInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(input.Data, &elements); err != nil {
+		return nil, errInvalidSplitInput
+	}
+
+	results := make([]*fnrun.Result, len(elements))
+	errs := make([]error, len(elements))
+	var wg sync.WaitGroup
+	for i := range elements {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = si.invoker.Invoke(ctx, &fnrun.Input{Data: elements[i]})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return combineResults(results)
+}
+
+// combineResults returns a result whose data is a JSON array of the data of
+// each result. Data that is not valid JSON is encoded as a string. The status
+// of the combined result is the highest status of the results, and its env is
+// that of the first result.
+func combineResults(results []*fnrun.Result) (*fnrun.Result, error) {
+	combined := &fnrun.Result{}
+	elements := make([]json.RawMessage, len(results))
+	for i, result := range results {
+		if result.Status > combined.Status {
+			combined.Status = result.Status
+		}
+		if i == 0 {
+			combined.Env = result.Env
+		}
+
+		if json.Valid(result.Data) {
+			elements[i] = result.Data
+		} else {
+			encoded, err := json.Marshal(string(result.Data))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = encoded
+		}
+	}
+
+	data, err := json.Marshal(elements)
+	if err != nil {
+		return nil, err
+	}
+	combined.Data = data
+
+	return combined, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestSplitInvokerInvokesEachElement(t *testing.T) {
+	var invocations int64
+	si := &splitInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		atomic.AddInt64(&invocations, 1)
+		var n int
+		if err := json.Unmarshal(input.Data, &n); err != nil {
+			t.Errorf("expected each input to be one element, got %s", input.Data)
+		}
+		status := 200
+		if n == 4 {
+			status = 422
+		}
+		return &fnrun.Result{Status: status, Data: []byte(`{"n":` + string(input.Data) + `}`)}, nil
+	})}
+
+	result, err := si.Invoke(context.Background(), &fnrun.Input{Data: []byte("[1, 2, 3, 4, 5]")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if invocations != 5 {
+		t.Errorf("expected 5 invocations, got %d", invocations)
+	}
+
+	var elements []struct{ N int }
+	if err := json.Unmarshal(result.Data, &elements); err != nil {
+		t.Fatalf("expected a JSON array result, got %s: %v", result.Data, err)
+	}
+	if len(elements) != 5 {
+		t.Fatalf("expected a 5-element result array, got %s", result.Data)
+	}
+	for i, element := range elements {
+		if element.N != i+1 {
+			t.Errorf("expected element %d to be the result of input %d, got %d", i, i+1, element.N)
+		}
+	}
+	if result.Status != 422 {
+		t.Errorf("expected the highest status of the elements, got %d", result.Status)
+	}
+}
+
+func TestSplitInvokerEncodesNonJSONResultsAsStrings(t *testing.T) {
+	si := &splitInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Data: []byte("plain text")}, nil
+	})}
+
+	result, err := si.Invoke(context.Background(), &fnrun.Input{Data: []byte(`["a"]`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(result.Data) != `["plain text"]` {
+		t.Errorf("expected the text result to be a JSON string, got %s", result.Data)
+	}
+}
+
+func TestSplitInvokerRejectsInputsThatAreNotArrays(t *testing.T) {
+	si := &splitInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		t.Error("expected the function not to be invoked")
+		return &fnrun.Result{}, nil
+	})}
+
+	if _, err := si.Invoke(context.Background(), &fnrun.Input{Data: []byte(`{"a":1}`)}); err != errInvalidSplitInput {
+		t.Errorf("expected errInvalidSplitInput, got %v", err)
+	}
+}
+
+func TestSplitInvokerFailsIfAnElementFails(t *testing.T) {
+	failed := errors.New("failed")
+	si := &splitInvoker{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		if string(input.Data) == "2" {
+			return nil, failed
+		}
+		return &fnrun.Result{}, nil
+	})}
+
+	if _, err := si.Invoke(context.Background(), &fnrun.Input{Data: []byte("[1,2,3]")}); err != failed {
+		t.Errorf("expected the error of the failed element, got %v", err)
+	}
+}
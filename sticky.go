@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/tessellator/fnrun"
+)
+
+// -----------------------------------------------------------------------------
+// Sticky Router
+//
+// The sticky router sends identical inputs to the same invoker, so that a
+// function that caches state per input does not miss its cache when the input
+// is handled by another process. Each invoker is a pool of its own with a
+// single invoker, and an input is sent to the invoker selected by the FNV-1a
+// hash of its data modulo the number of invokers. Inputs for a busy invoker
+// wait for it rather than going to another one.
+
+type stickyRouter struct {
+	pools []*invokerPool
+}
+
+// newStickyRouter creates a router over count single-invoker pools.
+func newStickyRouter(count int) (*stickyRouter, error) {
+	if count < 1 {
+		return nil, configErrorf("MAX_FUNCTION_COUNT", "MAX_FUNCTION_COUNT must be at least 1 when STICKY_ROUTING is enabled")
+	}
+
+	sr := &stickyRouter{}
+	for i := 0; i < count; i++ {
+		factory, err := getInvokerFactory("")
+		if err != nil {
+			sr.Close()
+			return nil, err
+		}
+		pool, err := newSizedInvokerPool(factory, "", 1)
+		if err != nil {
+			sr.Close()
+			return nil, err
+		}
+		sr.pools = append(sr.pools, pool)
+	}
+	return sr, nil
+}
+
+func (sr *stickyRouter) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	hash := fnv.New32a()
+	hash.Write(input.Data)
+	return sr.InvokeOn(ctx, int(hash.Sum32()%uint32(len(sr.pools))), input)
+}
+
+// InvokeOn invokes the invoker with index idx.
+func (sr *stickyRouter) InvokeOn(ctx context.Context, idx int, input *fnrun.Input) (*fnrun.Result, error) {
+	if idx < 0 || idx >= len(sr.pools) {
+		return nil, fmt.Errorf("invoker index %d is out of range [0, %d)", idx, len(sr.pools))
+	}
+	return sr.pools[idx].Invoke(ctx, input)
+}
+
+func (sr *stickyRouter) queueDepth() int {
+	depth := 0
+	for _, pool := range sr.pools {
+		depth += pool.queueDepth()
+	}
+	return depth
+}
+
+func (sr *stickyRouter) utilization() (active int, capacity int) {
+	for _, pool := range sr.pools {
+		poolActive, poolCapacity := pool.utilization()
+		active += poolActive
+		capacity += poolCapacity
+	}
+	return active, capacity
+}
+
+func (sr *stickyRouter) capacity() (slots int, prioritySlots int) {
+	for _, pool := range sr.pools {
+		poolSlots, poolPrioritySlots := pool.capacity()
+		slots += poolSlots
+		prioritySlots += poolPrioritySlots
+	}
+	return slots, prioritySlots
+}
+
+func (sr *stickyRouter) functionProcesses() []*trackedProcess {
+	var processes []*trackedProcess
+	for _, pool := range sr.pools {
+		processes = append(processes, pool.functionProcesses()...)
+	}
+	return processes
+}
+
+// Close closes every pool and returns the first error encountered.
+func (sr *stickyRouter) Close() error {
+	var firstErr error
+	for _, pool := range sr.pools {
+		if err := pool.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// newTestStickyRouter returns a sticky router over count pools of echo
+// function processes.
+func newTestStickyRouter(t *testing.T, count int) *stickyRouter {
+	t.Helper()
+	sr := &stickyRouter{}
+	t.Cleanup(func() { sr.Close() })
+	for i := 0; i < count; i++ {
+		pool, _ := newTestCmdPool(t, 1, time.Second, func() *cmdInvokerFactory {
+			return newCmdInvokerFactory(testFunctionCmd("echo"), time.Second, nil)
+		})
+		sr.pools = append(sr.pools, pool)
+	}
+	return sr
+}
+
+// stickyPID returns the PID of the function process that handled result.
+func stickyPID(t *testing.T) func(*fnrun.Result, error) string {
+	return func(result *fnrun.Result, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result.Env[invokerPIDKey]
+	}
+}
+
+func TestStickyRouterSendsIdenticalInputsToTheSameInvoker(t *testing.T) {
+	sr := newTestStickyRouter(t, 4)
+	input := []byte("customer-42")
+
+	hash := fnv.New32a()
+	hash.Write(input)
+	idx := int(hash.Sum32() % 4)
+	want := stickyPID(t)(sr.InvokeOn(context.Background(), idx, &fnrun.Input{Data: input}))
+
+	for i := 0; i < 10; i++ {
+		other := []byte(fmt.Sprintf("customer-%d", i))
+		if _, err := sr.Invoke(context.Background(), &fnrun.Input{Data: other}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pid := stickyPID(t)(sr.Invoke(context.Background(), &fnrun.Input{Data: input}))
+		if pid != want {
+			t.Fatalf("invocation %d: expected invoker %d (PID %s), got PID %s", i, idx, want, pid)
+		}
+	}
+}
+
+func TestStickyRouterSpreadsDistinctInputs(t *testing.T) {
+	sr := newTestStickyRouter(t, 4)
+
+	pids := make(map[string]bool)
+	for i := 0; i < 40; i++ {
+		input := &fnrun.Input{Data: []byte(fmt.Sprintf("customer-%d", i))}
+		pids[stickyPID(t)(sr.Invoke(context.Background(), input))] = true
+	}
+	if len(pids) < 2 {
+		t.Errorf("expected distinct inputs to be spread across invokers, got %d", len(pids))
+	}
+}
+
+func TestStickyRouterInvokeOnRejectsIndexOutOfRange(t *testing.T) {
+	sr := newTestStickyRouter(t, 2)
+	for _, idx := range []int{-1, 2} {
+		if _, err := sr.InvokeOn(context.Background(), idx, &fnrun.Input{}); err == nil {
+			t.Errorf("expected an error for invoker index %d", idx)
+		}
+	}
+}
+
+func TestStickyRouterRequiresAnInvoker(t *testing.T) {
+	_, err := newStickyRouter(0)
+	var configErr *runner.ConfigError
+	if !errors.As(err, &configErr) || configErr.Name != "MAX_FUNCTION_COUNT" {
+		t.Errorf("expected a MAX_FUNCTION_COUNT config error, got %v", err)
+	}
+}
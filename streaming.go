@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Result streaming
+//
+// A function whose invoker implements runner.StreamingInvoker may produce many
+// results for a single input. The invoker pool only passes a single result back
+// to its caller, so the streaming sink invoker places a result stream in the
+// context of each invocation, and the invoker of a streaming function forwards
+// each result to the sink through that stream as it arrives. The sink invoker
+// then skips the delivery of the final result, which has already been streamed.
+//
+// Streamed results go straight to the sink and so bypass the middleware between
+// the sink invoker and the function (e.g., batching and splitting), which only
+// see the last result of the stream.
+
+type resultStreamKey struct{}
+
+// resultStream delivers the results of a single invocation to the sink.
+type resultStream struct {
+	sink      eventSinkTransformer
+	mu        sync.Mutex
+	delivered int
+	err       error
+}
+
+func withResultStream(ctx context.Context, stream *resultStream) context.Context {
+	return context.WithValue(ctx, resultStreamKey{}, stream)
+}
+
+func resultStreamFromContext(ctx context.Context) (*resultStream, bool) {
+	stream, ok := ctx.Value(resultStreamKey{}).(*resultStream)
+	return stream, ok
+}
+
+// deliver passes result to the sink. Once a delivery fails, the remaining
+// results of the stream are discarded.
+func (rs *resultStream) deliver(ctx context.Context, result *fnrun.Result) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.err != nil {
+		return rs.err
+	}
+
+	resultSize.observe(float64(len(result.Data)))
+	if rs.delivered == 0 {
+		observeSourceToSinkLatency(ctx)
+	}
+	rs.delivered++
+	_, rs.err = deliverToSink(ctx, rs.sink, result)
+	return rs.err
+}
+
+// streamed reports whether any results were delivered through the stream and,
+// if so, the error of the first delivery that failed.
+func (rs *resultStream) streamed() (bool, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.delivered > 0, rs.err
+}
+
+// streamingSinkInvoker places a result stream for sink in the context of each
+// invocation so that the results of streaming functions are delivered as they
+// arrive.
+type streamingSinkInvoker struct {
+	invoker fnrun.Invoker
+	sink    eventSinkTransformer
+}
+
+func (ssi *streamingSinkInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	return ssi.invoker.Invoke(withResultStream(ctx, &resultStream{sink: ssi.sink}), input)
+}
+
+// streamingInvokerFactory wraps a factory so that the streaming invokers it
+// produces forward their results to the result stream of each invocation.
+type streamingInvokerFactory struct {
+	factory fnrun.InvokerFactory
+}
+
+func (factory *streamingInvokerFactory) NewInvoker() (fnrun.Invoker, error) {
+	invoker, err := factory.factory.NewInvoker()
+	if err != nil {
+		return nil, err
+	}
+
+	if streaming, ok := invoker.(runner.StreamingInvoker); ok {
+		return &streamAdapter{invoker: streaming}, nil
+	}
+	return invoker, nil
+}
+
+// streamAdapter invokes a streaming function and returns its last result. When
+// the context carries a result stream, every result is forwarded to it.
+type streamAdapter struct {
+	invoker runner.StreamingInvoker
+}
+
+func (sa *streamAdapter) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	stream, ok := resultStreamFromContext(ctx)
+	if !ok {
+		return sa.invoker.Invoke(ctx, input)
+	}
+
+	results, err := sa.invoker.InvokeStream(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var last *fnrun.Result
+	for result := range results {
+		if result == nil {
+			continue
+		}
+		last = result
+		stream.deliver(ctx, result)
+	}
+
+	return last, nil
+}
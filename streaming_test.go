@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+// fakeStreamingInvoker emits count results for every input.
+type fakeStreamingInvoker struct {
+	count int
+}
+
+func (fsi *fakeStreamingInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	return &fnrun.Result{Data: []byte("single")}, nil
+}
+
+func (fsi *fakeStreamingInvoker) InvokeStream(ctx context.Context, input *fnrun.Input) (<-chan *fnrun.Result, error) {
+	results := make(chan *fnrun.Result)
+	go func() {
+		defer close(results)
+		for i := 0; i < fsi.count; i++ {
+			results <- &fnrun.Result{Status: 200, Data: []byte(strconv.Itoa(i))}
+		}
+	}()
+	return results, nil
+}
+
+func newStreamingTestPipeline(t *testing.T, factory fnrun.InvokerFactory, delivered *[]string) fnrun.Invoker {
+	t.Helper()
+	pool, err := newSizedInvokerPool(&streamingInvokerFactory{factory: factory}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+
+	sink := func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		*delivered = append(*delivered, string(result.Data))
+		return result, nil
+	}
+	return &streamingSinkInvoker{invoker: &sinkInvoker{invoker: pool, sink: sink}, sink: sink}
+}
+
+func TestStreamingResultsAreForwardedToTheSink(t *testing.T) {
+	var delivered []string
+	pipeline := newStreamingTestPipeline(t, &staticInvokerFactory{invoker: &fakeStreamingInvoker{count: 5}}, &delivered)
+
+	result, err := pipeline.Invoke(context.Background(), &fnrun.Input{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(delivered) != 5 {
+		t.Fatalf("expected each of the 5 results to be delivered once, got %q", delivered)
+	}
+	for i, data := range delivered {
+		if data != strconv.Itoa(i) {
+			t.Errorf("expected result %d to be delivered in order, got %q", i, data)
+		}
+	}
+	if string(result.Data) != "4" {
+		t.Errorf("expected the source to receive the last result, got %q", result.Data)
+	}
+}
+
+func TestNonStreamingResultsAreDeliveredOnce(t *testing.T) {
+	var delivered []string
+	pipeline := newStreamingTestPipeline(t, &staticInvokerFactory{invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Data: []byte("only")}, nil
+	})}, &delivered)
+
+	if _, err := pipeline.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(delivered) != 1 || delivered[0] != "only" {
+		t.Errorf("expected the result to be delivered once, got %q", delivered)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// errSourceStalled is returned when the source is cancelled because it has not
+// dispatched an invocation within the heartbeat kill timeout.
+var errSourceStalled = errors.New("source stalled")
+
+// -----------------------------------------------------------------------------
+// Source Supervisor
+//
+// The source supervisor detects sources that hang without returning an error.
+// Each invocation dispatched by the source counts as a heartbeat. If no
+// invocation has been dispatched for warnAfter, a warning is logged; after
+// killAfter, the source is cancelled. A cancelled source that does not return
+// within another killAfter is abandoned.
+//
+// If restart is set, the source is started again after restartDelay whenever
+// it stalls or returns an error. Otherwise, the supervisor returns the error,
+// or errSourceStalled if the source stalled.
+
+type sourceSupervisor struct {
+	source       eventSource
+	warnAfter    time.Duration
+	killAfter    time.Duration
+	restart      bool
+	restartDelay time.Duration
+}
+
+func newSourceSupervisor(source eventSource, warnAfter time.Duration, killAfter time.Duration, restart bool, restartDelay time.Duration) eventSource {
+	ss := &sourceSupervisor{
+		source:       source,
+		warnAfter:    warnAfter,
+		killAfter:    killAfter,
+		restart:      restart,
+		restartDelay: restartDelay,
+	}
+	return ss.run
+}
+
+func (ss *sourceSupervisor) run(ctx context.Context, invoker fnrun.Invoker) error {
+	for {
+		err := ss.runOnce(ctx, invoker)
+		if ctx.Err() != nil {
+			if err == errSourceStalled {
+				return nil
+			}
+			return err
+		}
+		if !ss.restart || err == nil {
+			return err
+		}
+
+		log.Printf("source failed; restarting in %v: %v", ss.restartDelay, err)
+		select {
+		case <-time.After(ss.restartDelay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// runOnce runs the source until it returns or stalls.
+func (ss *sourceSupervisor) runOnce(ctx context.Context, invoker fnrun.Invoker) error {
+	sourceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	hi := &heartbeatInvoker{invoker: invoker}
+	hi.beat()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- ss.source(sourceCtx, hi)
+	}()
+
+	interval := ss.checkInterval()
+	if interval <= 0 {
+		return <-result
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	warned := false
+	for {
+		select {
+		case err := <-result:
+			return err
+		case <-ticker.C:
+		}
+
+		idle := hi.idle()
+		if ss.warnAfter > 0 && idle >= ss.warnAfter && !warned {
+			log.Printf("WARNING: source has not dispatched an invocation for %v", idle.Round(time.Millisecond))
+			warned = true
+		} else if idle < ss.warnAfter {
+			warned = false
+		}
+
+		if ss.killAfter > 0 && idle >= ss.killAfter {
+			log.Printf("source has not dispatched an invocation for %v; cancelling it", idle.Round(time.Millisecond))
+			cancel()
+			select {
+			case <-result:
+			case <-time.After(ss.killAfter):
+				log.Printf("source did not stop after being cancelled; abandoning it")
+			}
+			return errSourceStalled
+		}
+	}
+}
+
+// checkInterval returns how often the heartbeat is checked, which is a
+// fraction of the shortest configured timeout.
+func (ss *sourceSupervisor) checkInterval() time.Duration {
+	shortest := ss.warnAfter
+	if shortest <= 0 || (ss.killAfter > 0 && ss.killAfter < shortest) {
+		shortest = ss.killAfter
+	}
+	return shortest / 4
+}
+
+// heartbeatInvoker records when the source last dispatched an invocation.
+type heartbeatInvoker struct {
+	invoker fnrun.Invoker
+	last    int64
+}
+
+func (hi *heartbeatInvoker) beat() {
+	atomic.StoreInt64(&hi.last, time.Now().UnixNano())
+}
+
+func (hi *heartbeatInvoker) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&hi.last)))
+}
+
+func (hi *heartbeatInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	hi.beat()
+	return hi.invoker.Invoke(ctx, input)
+}
+
+func (hi *heartbeatInvoker) InvokeAckable(ctx context.Context, input *fnrun.Input) (*fnrun.Result, *runner.NackDirective, error) {
+	hi.beat()
+	return invokeAckable(ctx, hi.invoker, input)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestSourceSupervisorRestartsStalledSources(t *testing.T) {
+	var starts int64
+	source := newSourceSupervisor(func(ctx context.Context, invoker fnrun.Invoker) error {
+		if atomic.AddInt64(&starts, 1) == 1 {
+			// The first run hangs without dispatching anything.
+			<-ctx.Done()
+			return nil
+		}
+		_, err := invoker.Invoke(ctx, &fnrun.Input{})
+		return err
+	}, 20*time.Millisecond, 50*time.Millisecond, true, 10*time.Millisecond)
+
+	invoked := false
+	start := time.Now()
+	err := source(context.Background(), invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		invoked = true
+		return &fnrun.Result{}, nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt64(&starts); n != 2 {
+		t.Errorf("expected the stalled source to be restarted once, started %d times", n)
+	}
+	if !invoked {
+		t.Error("expected the restarted source to dispatch its invocation")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the source to be cancelled after the kill timeout, took %v", elapsed)
+	}
+}
+
+func TestSourceSupervisorReportsStalledSourcesWithoutRestart(t *testing.T) {
+	source := newSourceSupervisor(func(ctx context.Context, invoker fnrun.Invoker) error {
+		<-ctx.Done()
+		return nil
+	}, 0, 30*time.Millisecond, false, 0)
+
+	if err := source(context.Background(), prefixingInvoker); err != errSourceStalled {
+		t.Errorf("expected errSourceStalled, got %v", err)
+	}
+}
+
+func TestSourceSupervisorKeepsActiveSources(t *testing.T) {
+	source := newSourceSupervisor(func(ctx context.Context, invoker fnrun.Invoker) error {
+		for i := 0; i < 10; i++ {
+			time.Sleep(10 * time.Millisecond)
+			if _, err := invoker.Invoke(ctx, &fnrun.Input{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, 0, 40*time.Millisecond, false, 0)
+
+	if err := source(context.Background(), prefixingInvoker); err != nil {
+		t.Errorf("expected a source that dispatches invocations not to be cancelled, got %v", err)
+	}
+}
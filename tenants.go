@@ -0,0 +1,184 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"sync"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// -----------------------------------------------------------------------------
+// Tenant Router
+//
+// The tenant router isolates tenants from one another by giving each tenant
+// its own invoker pool. The tenant of an invocation is read from the metadata
+// key named by the router's tenantKey. Pools are created on first use; when the
+// number of pools would exceed maxPools, the least recently used pool is
+// evicted and closed. An invocation pins its pool while it is routed to it, so
+// an evicted pool is only closed once the last invocation using it releases it.
+
+type tenantPool struct {
+	tenant  string
+	pool    *invokerPool
+	users   int
+	evicted bool
+}
+
+type tenantRouter struct {
+	tenantKey string
+	maxPools  int
+	mu        sync.Mutex
+	pools     map[string]*list.Element
+	lru       *list.List
+	closed    bool
+}
+
+func newTenantRouter(tenantKey string, maxPools int) *tenantRouter {
+	if maxPools < 1 {
+		maxPools = 1
+	}
+
+	return &tenantRouter{
+		tenantKey: tenantKey,
+		maxPools:  maxPools,
+		pools:     make(map[string]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+func (tr *tenantRouter) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	tenant := ""
+	if metadata, ok := runner.MetadataFromContext(ctx); ok {
+		tenant = metadata[tr.tenantKey]
+	}
+
+	pinned, err := tr.acquirePool(tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tr.releasePool(pinned)
+
+	return pinned.pool.Invoke(ctx, input)
+}
+
+// acquirePool returns the pool of tenant, creating it if necessary, and pins
+// it until it is released with releasePool.
+func (tr *tenantRouter) acquirePool(tenant string) (*tenantPool, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if tr.closed {
+		return nil, errPoolClosed
+	}
+
+	if element, ok := tr.pools[tenant]; ok {
+		tr.lru.MoveToFront(element)
+		pinned := element.Value.(*tenantPool)
+		pinned.users++
+		return pinned, nil
+	}
+
+	factory, err := getInvokerFactory("")
+	if err != nil {
+		return nil, err
+	}
+	pool, err := newInvokerPool(factory, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for tr.lru.Len() >= tr.maxPools {
+		oldest := tr.lru.Back()
+		evicted := tr.lru.Remove(oldest).(*tenantPool)
+		delete(tr.pools, evicted.tenant)
+
+		evicted.evicted = true
+		if evicted.users == 0 {
+			// Closing waits for in-flight invocations on the evicted pool, so it
+			// is done in the background.
+			go evicted.pool.Close()
+		}
+	}
+
+	pinned := &tenantPool{tenant: tenant, pool: pool, users: 1}
+	tr.pools[tenant] = tr.lru.PushFront(pinned)
+	return pinned, nil
+}
+
+// releasePool unpins a pool returned by acquirePool, closing it if it has been
+// evicted and this was its last user.
+func (tr *tenantRouter) releasePool(pinned *tenantPool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	pinned.users--
+	if pinned.evicted && pinned.users == 0 {
+		go pinned.pool.Close()
+	}
+}
+
+func (tr *tenantRouter) queueDepth() int {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	depth := 0
+	for element := tr.lru.Front(); element != nil; element = element.Next() {
+		depth += element.Value.(*tenantPool).pool.queueDepth()
+	}
+	return depth
+}
+
+func (tr *tenantRouter) utilization() (active int, capacity int) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	for element := tr.lru.Front(); element != nil; element = element.Next() {
+		poolActive, poolCapacity := element.Value.(*tenantPool).pool.utilization()
+		active += poolActive
+		capacity += poolCapacity
+	}
+	return active, capacity
+}
+
+// capacity returns the capacity of maxPools pools, since the pools are created
+// on demand.
+func (tr *tenantRouter) capacity() (slots int, prioritySlots int) {
+	slots = getIntEnv("MAX_FUNCTION_COUNT", 8)
+	if os.Getenv("PRIORITY_METADATA_KEY") != "" {
+		prioritySlots = getIntEnv("PRIORITY_OVERSUBSCRIPTION", 2)
+	}
+	return tr.maxPools * slots, tr.maxPools * prioritySlots
+}
+
+func (tr *tenantRouter) functionProcesses() []*trackedProcess {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	var processes []*trackedProcess
+	for element := tr.lru.Front(); element != nil; element = element.Next() {
+		processes = append(processes, element.Value.(*tenantPool).pool.functionProcesses()...)
+	}
+	return processes
+}
+
+// Close closes the pools for every tenant.
+func (tr *tenantRouter) Close() error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.closed = true
+
+	var firstErr error
+	for element := tr.lru.Front(); element != nil; element = element.Next() {
+		if err := element.Value.(*tenantPool).pool.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	tr.pools = make(map[string]*list.Element)
+	tr.lru.Init()
+
+	return firstErr
+}
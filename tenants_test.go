@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// poolOf returns the pool of tenant without keeping it pinned.
+func poolOf(router *tenantRouter, tenant string) (*invokerPool, error) {
+	pinned, err := router.acquirePool(tenant)
+	if err != nil {
+		return nil, err
+	}
+	router.releasePool(pinned)
+	return pinned.pool, nil
+}
+
+func TestTenantRouterUsesSeparatePoolsPerTenant(t *testing.T) {
+	t.Setenv("INVOKER_TYPE", "echo")
+	router := newTenantRouter("tenant", 10)
+	defer router.Close()
+
+	invoke := func(tenant string) {
+		ctx := runner.WithMetadata(context.Background(), map[string]string{"tenant": tenant})
+		result, err := router.Invoke(ctx, &fnrun.Input{Data: []byte(tenant)})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(result.Data) != tenant {
+			t.Errorf("expected %q, got %q", tenant, result.Data)
+		}
+	}
+	invoke("acme")
+	invoke("globex")
+	invoke("acme")
+
+	acme, err := poolOf(router, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	globex, err := poolOf(router, "globex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acme == globex {
+		t.Error("expected the tenants to use separate pools")
+	}
+	if again, _ := poolOf(router, "acme"); again != acme {
+		t.Error("expected a tenant to keep its pool")
+	}
+	if len(router.pools) != 2 {
+		t.Errorf("expected 2 pools, got %d", len(router.pools))
+	}
+}
+
+func TestTenantRouterEvictsLeastRecentlyUsedPool(t *testing.T) {
+	t.Setenv("INVOKER_TYPE", "echo")
+	router := newTenantRouter("tenant", 2)
+	defer router.Close()
+
+	a, _ := poolOf(router, "a")
+	poolOf(router, "b")
+	poolOf(router, "a")
+	poolOf(router, "c")
+
+	if _, ok := router.pools["b"]; ok {
+		t.Error("expected the least recently used tenant to be evicted")
+	}
+	if again, _ := poolOf(router, "a"); again != a {
+		t.Error("expected the recently used tenant to keep its pool")
+	}
+	if len(router.pools) != 2 {
+		t.Errorf("expected 2 pools, got %d", len(router.pools))
+	}
+}
+
+func TestTenantRouterRejectsInvocationsAfterClose(t *testing.T) {
+	t.Setenv("INVOKER_TYPE", "echo")
+	router := newTenantRouter("tenant", 2)
+	poolOf(router, "a")
+	if err := router.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := router.Invoke(context.Background(), &fnrun.Input{}); err != errPoolClosed {
+		t.Errorf("expected errPoolClosed, got %v", err)
+	}
+}
+
+func TestTenantRouterKeepsEvictedPoolOpenForItsInvocations(t *testing.T) {
+	t.Setenv("INVOKER_TYPE", "echo")
+	router := newTenantRouter("tenant", 1)
+	defer router.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		tenant := []string{"acme", "globex"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := runner.WithMetadata(context.Background(), map[string]string{"tenant": tenant})
+			for j := 0; j < 200; j++ {
+				result, err := router.Invoke(ctx, &fnrun.Input{Data: []byte(tenant)})
+				if err != nil {
+					t.Errorf("unexpected error for %s: %v", tenant, err)
+					return
+				}
+				if string(result.Data) != tenant {
+					t.Errorf("expected %q, got %q", tenant, result.Data)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTenantRouterClosesEvictedPoolWhenReleased(t *testing.T) {
+	t.Setenv("INVOKER_TYPE", "echo")
+	router := newTenantRouter("tenant", 1)
+	defer router.Close()
+
+	pinned, err := router.acquirePool("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := poolOf(router, "globex"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pinned.pool.Invoke(context.Background(), &fnrun.Input{}); err != nil {
+		t.Errorf("expected the evicted pool to stay open while pinned, got %v", err)
+	}
+
+	router.releasePool(pinned)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := pinned.pool.Invoke(context.Background(), &fnrun.Input{})
+		if err == errPoolClosed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the evicted pool to be closed once released, got %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
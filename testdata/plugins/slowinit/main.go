@@ -0,0 +1,19 @@
+// Command slowinit is a plugin used by the tests of the runner whose init
+// function takes two seconds, so that opening it exceeds a short plugin
+// timeout. It exports a sink under the name Discard.
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func init() {
+	time.Sleep(2 * time.Second)
+}
+
+func Discard(ctx context.Context, result *fnrun.Result) error {
+	return nil
+}
@@ -0,0 +1,69 @@
+// Command source is a plugin used by the tests of the runner. It exports a
+// source under the name Run, which invokes the function once with the
+// content of FNRUN_TEST_PLUGIN_DATA, a sink under the name Discard, a result
+// transformer under the name Normalize, a result filter under the name
+// DropEmpty, a canary analysis under the name Compare and a feature flag
+// provider under the name Alternate. It reports version 2.0.0 through
+// PluginVersion.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/tessellator/fnrun"
+)
+
+func Run(ctx context.Context, invoker fnrun.Invoker) error {
+	_, err := invoker.Invoke(ctx, &fnrun.Input{Data: []byte(os.Getenv("FNRUN_TEST_PLUGIN_DATA"))})
+	return err
+}
+
+func Discard(ctx context.Context, result *fnrun.Result) error {
+	return nil
+}
+
+// Normalize replaces the status of the result with 200 and marks it with the
+// x-normalized env key.
+func Normalize(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+	return &fnrun.Result{Status: 200, Data: result.Data, Env: map[string]string{"x-normalized": "true"}}, nil
+}
+
+// DropEmpty accepts the results that have data.
+func DropEmpty(ctx context.Context, result *fnrun.Result) bool {
+	return len(result.Data) > 0
+}
+
+// Compare reports an error if the primary and canary results differ in status
+// or data.
+func Compare(ctx context.Context, primary *fnrun.Result, canary *fnrun.Result) error {
+	if primary.Status != canary.Status || !bytes.Equal(primary.Data, canary.Data) {
+		return errors.New("results differ")
+	}
+	return nil
+}
+
+var alternating struct {
+	mu      sync.Mutex
+	enabled map[string]bool
+}
+
+// Alternate enables each feature on every other call, starting with the first.
+func Alternate(ctx context.Context, feature string) bool {
+	alternating.mu.Lock()
+	defer alternating.mu.Unlock()
+	if alternating.enabled == nil {
+		alternating.enabled = make(map[string]bool)
+	}
+	alternating.enabled[feature] = !alternating.enabled[feature]
+	return alternating.enabled[feature]
+}
+
+func PluginVersion() string {
+	return "2.0.0"
+}
+
+func main() {}
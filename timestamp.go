@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+const processedAtKey = "x-processed-at"
+
+// -----------------------------------------------------------------------------
+// Timestamp Invoker
+//
+// fnrun.Input does not carry metadata, so the timestamp invoker adds the time
+// at which an event was processed to the execution context env that is sent to
+// the function alongside the input. Any env already on the context is
+// preserved.
+
+type timestampInvoker struct {
+	invoker fnrun.Invoker
+	now     func() time.Time
+}
+
+func (ti *timestampInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	return ti.invoker.Invoke(withExtraEnv(ctx, processedAtKey, ti.now().UTC().Format(time.RFC3339)), input)
+}
+
+// withExtraEnv returns a copy of ctx whose execution context env is that of
+// ctx with key set to value. The env of ctx is not modified.
+func withExtraEnv(ctx context.Context, key string, value string) context.Context {
+	existing, _ := fnrun.Env(ctx)
+	env := make(map[string]string, len(existing)+1)
+	for k, v := range existing {
+		env[k] = v
+	}
+	env[key] = value
+
+	return fnrun.WithEnv(ctx, env)
+}
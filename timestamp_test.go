@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestTimestampInvokerAddsProcessedAt(t *testing.T) {
+	var env map[string]string
+	var metadata map[string]string
+	ti := &timestampInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			env, _ = fnrun.Env(ctx)
+			metadata, _ = runner.MetadataFromContext(ctx)
+			return &fnrun.Result{}, nil
+		}),
+		now: time.Now,
+	}
+
+	ctx := fnrun.WithEnv(context.Background(), map[string]string{"existing": "value"})
+	ctx = runner.WithMetadata(ctx, map[string]string{"x-source": "test"})
+	before := time.Now().Add(-time.Second)
+	if _, err := ti.Invoke(ctx, &fnrun.Input{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	processedAt, err := time.Parse(time.RFC3339, env[processedAtKey])
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", processedAtKey, err)
+	}
+	if processedAt.Before(before) || processedAt.After(time.Now().Add(time.Second)) {
+		t.Errorf("unexpected %s: %v", processedAtKey, processedAt)
+	}
+	if env["existing"] != "value" {
+		t.Errorf("expected the existing env to be preserved, got %v", env)
+	}
+	if metadata["x-source"] != "test" {
+		t.Errorf("expected the metadata to be preserved, got %v", metadata)
+	}
+}
+
+func TestWithExtraEnvDoesNotModifyExistingEnv(t *testing.T) {
+	existing := map[string]string{"a": "1"}
+	ctx := withExtraEnv(fnrun.WithEnv(context.Background(), existing), "b", "2")
+
+	env, _ := fnrun.Env(ctx)
+	if env["a"] != "1" || env["b"] != "2" {
+		t.Errorf("unexpected env: %v", env)
+	}
+	if _, ok := existing["b"]; ok {
+		t.Error("expected the existing env not to be modified")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/tessellator/fnrun-runner"
+
+// setupTracing configures the global OpenTelemetry tracer provider according to
+// OTEL_TRACES_EXPORTER. The only supported exporter is "stdout", which writes
+// spans to stderr; when the variable is unset, spans are discarded. The
+// returned function flushes and shuts down the provider.
+func setupTracing() (func(context.Context) error, error) {
+	// env: OTEL_TRACES_EXPORTER string none "Exporter of trace spans: none or stdout."
+	switch exporterName := os.Getenv("OTEL_TRACES_EXPORTER"); exporterName {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+		if err != nil {
+			return nil, err
+		}
+		provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+		otel.SetTracerProvider(provider)
+		return provider.Shutdown, nil
+	default:
+		return nil, configErrorf("OTEL_TRACES_EXPORTER", "Unknown OTEL_TRACES_EXPORTER %s", exporterName)
+	}
+}
+
+// tracePluginLoad starts a span for loading the plugin named by the pathEnv and
+// symbolEnv environment variables. It returns a function that ends the span;
+// the function should be deferred with a pointer to the error returned by the
+// load so that failures are recorded on the span.
+func tracePluginLoad(spanName string, pathEnv string, symbolEnv string) func(*error) {
+	start := time.Now()
+	_, span := otel.Tracer(tracerName).Start(context.Background(), spanName, trace.WithAttributes(
+		attribute.String("plugin.path", os.Getenv(pathEnv)),
+		attribute.String("plugin.symbol", os.Getenv(symbolEnv)),
+	))
+
+	return func(errp *error) {
+		err := *errp
+		span.SetAttributes(
+			attribute.Bool("plugin.verified", err == nil),
+			attribute.Int64("plugin.load_duration_ms", time.Since(start).Milliseconds()),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// traceSinkDelivery starts a span for delivering a result to the sink. The
+// members of the baggage of ctx are recorded as attributes of the span. It
+// returns the context for the delivery and a function that ends the span with
+// the error returned by the sink.
+func traceSinkDelivery(ctx context.Context) (context.Context, func(error)) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "deliver to sink", trace.WithAttributes(baggageAttributes(ctx)...))
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
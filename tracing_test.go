@@ -0,0 +1,134 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider that records the ended spans for the
+// duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// endedSpan returns the only span that the recorder has seen end, failing the
+// test if there is not exactly one.
+func endedSpan(t *testing.T, recorder *tracetest.SpanRecorder) sdktrace.ReadOnlySpan {
+	t.Helper()
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+	return spans[0]
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestPluginLoadSpans(t *testing.T) {
+	path := buildTestPlugin(t, "source")
+	tests := []struct {
+		name   string
+		env    map[string]string
+		load   func() error
+		span   string
+		symbol string
+	}{
+		{
+			name: "source",
+			env:  map[string]string{"SOURCE_PLUGIN_PATH": path, "SOURCE_PLUGIN_SYMBOL": "Run"},
+			load: func() error { _, err := getEventSource(nil); return err },
+			span: "load source plugin", symbol: "Run",
+		},
+		{
+			name: "sink",
+			env:  map[string]string{"SINK_PLUGIN_PATH": path, "SINK_PLUGIN_SYMBOL": "Discard"},
+			load: func() error { _, err := getEventSink(); return err },
+			span: "load sink plugin", symbol: "Discard",
+		},
+		{
+			name: "dead-letter sink",
+			env:  map[string]string{"DEAD_LETTER_PLUGIN_PATH": path, "DEAD_LETTER_PLUGIN_SYMBOL": "Discard"},
+			load: func() error { _, err := getDeadLetterSink(); return err },
+			span: "load dead-letter sink plugin", symbol: "Discard",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			recorder := recordSpans(t)
+
+			if err := tt.load(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			span := endedSpan(t, recorder)
+			if span.Name() != tt.span {
+				t.Errorf("expected a %q span, got %q", tt.span, span.Name())
+			}
+			attrs := spanAttributes(span)
+			if got := attrs["plugin.path"].AsString(); got != path {
+				t.Errorf("expected plugin.path %s, got %s", path, got)
+			}
+			if got := attrs["plugin.symbol"].AsString(); got != tt.symbol {
+				t.Errorf("expected plugin.symbol %s, got %s", tt.symbol, got)
+			}
+			if !attrs["plugin.verified"].AsBool() {
+				t.Error("expected plugin.verified to be true")
+			}
+			if _, ok := attrs["plugin.load_duration_ms"]; !ok {
+				t.Error("expected a plugin.load_duration_ms attribute")
+			}
+			if span.Status().Code == codes.Error {
+				t.Errorf("expected the span not to have an error status, got %v", span.Status())
+			}
+		})
+	}
+}
+
+func TestPluginLoadSpanRecordsFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.so")
+	t.Setenv("SOURCE_PLUGIN_PATH", path)
+	t.Setenv("SOURCE_PLUGIN_SYMBOL", "Source")
+	t.Setenv("PLUGIN_ABI_CHECK", "false")
+	defer func() {
+		pluginsMu.Lock()
+		delete(plugins, path)
+		pluginsMu.Unlock()
+	}()
+	recorder := recordSpans(t)
+
+	if _, err := getEventSource(nil); err == nil {
+		t.Fatal("expected an error for a missing plugin")
+	}
+
+	span := endedSpan(t, recorder)
+	if span.Status().Code != codes.Error {
+		t.Errorf("expected an error status, got %v", span.Status())
+	}
+	if spanAttributes(span)["plugin.verified"].AsBool() {
+		t.Error("expected plugin.verified to be false")
+	}
+	if len(span.Events()) == 0 || span.Events()[0].Name != "exception" {
+		t.Error("expected the error to be recorded on the span")
+	}
+}
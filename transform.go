@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/tessellator/fnrun"
+)
+
+type resultTransformer func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error)
+
+func getResultTransformer() (transformer resultTransformer, err error) {
+	// env: RESULT_TRANSFORMER_PLUGIN_PATH string "" "Plugin containing the transformer applied to the result returned to the source, after the sink."
+	path := os.Getenv("RESULT_TRANSFORMER_PLUGIN_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	defer tracePluginLoad("load result transformer plugin", "RESULT_TRANSFORMER_PLUGIN_PATH", "RESULT_TRANSFORMER_PLUGIN_SYMBOL")(&err)
+
+	// env: RESULT_TRANSFORMER_PLUGIN_SYMBOL string "" "Symbol of the result transformer in RESULT_TRANSFORMER_PLUGIN_PATH."
+	symbolName := os.Getenv("RESULT_TRANSFORMER_PLUGIN_SYMBOL")
+	if symbolName == "" {
+		return nil, configErrorf("RESULT_TRANSFORMER_PLUGIN_SYMBOL", "RESULT_TRANSFORMER_PLUGIN_SYMBOL is required when a RESULT_TRANSFORMER_PLUGIN_PATH is provided")
+	}
+
+	symTransformer, err := lookupPluginSymbol(path, symbolName)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := symTransformer.(func(context.Context, *fnrun.Result) (*fnrun.Result, error))
+	if !ok {
+		return nil, pluginErrorf(path, symbolName, "Symbol %s could not be found in %s", symbolName, path)
+	}
+
+	return fn, nil
+}
+
+// -----------------------------------------------------------------------------
+// Result Transforming Invoker
+//
+// The result transforming invoker passes the result returned to the source
+// through a transformer plugin after the result has been delivered to the
+// sink. Sources may base acknowledgment decisions on the result, so this
+// allows the status to be normalized (or other changes to be made) without
+// affecting what the sink receives. Results of failed invocations are not
+// transformed.
+
+type resultTransformingInvoker struct {
+	invoker     fnrun.Invoker
+	transformer resultTransformer
+}
+
+func (ti *resultTransformingInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	result, err := ti.invoker.Invoke(ctx, input)
+	if err != nil || result == nil {
+		return result, err
+	}
+
+	return ti.transformer(ctx, result)
+}
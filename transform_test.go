@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestResultTransformerChangesTheResultReturnedToTheSource(t *testing.T) {
+	t.Setenv("RESULT_TRANSFORMER_PLUGIN_PATH", buildTestPlugin(t, "source"))
+	t.Setenv("RESULT_TRANSFORMER_PLUGIN_SYMBOL", "Normalize")
+
+	var delivered *fnrun.Result
+	sink := func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+		delivered = result
+		return result, nil
+	}
+	created := invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Status: 201, Data: input.Data}, nil
+	})
+	pipeline, closer, err := getPipeline(created, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+
+	result, err := pipeline.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != 200 || result.Env["x-normalized"] != "true" || string(result.Data) != "x" {
+		t.Errorf("expected the source to receive the transformed result, got %+v", result)
+	}
+	if delivered == nil || delivered.Status != 201 || delivered.Env["x-normalized"] != "" {
+		t.Errorf("expected the sink to receive the untransformed result, got %+v", delivered)
+	}
+}
+
+func TestResultTransformerRequiresASymbol(t *testing.T) {
+	t.Setenv("RESULT_TRANSFORMER_PLUGIN_PATH", "transformer.so")
+	_, err := getResultTransformer()
+	var configErr *runner.ConfigError
+	if !errors.As(err, &configErr) || configErr.Name != "RESULT_TRANSFORMER_PLUGIN_SYMBOL" {
+		t.Errorf("expected a ConfigError for RESULT_TRANSFORMER_PLUGIN_SYMBOL, got %v", err)
+	}
+}
+
+func TestResultTransformingInvokerSkipsFailedInvocations(t *testing.T) {
+	errFailed := errors.New("failed")
+	var called bool
+	ti := &resultTransformingInvoker{
+		invoker: invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+			return &fnrun.Result{Status: 500}, errFailed
+		}),
+		transformer: func(ctx context.Context, result *fnrun.Result) (*fnrun.Result, error) {
+			called = true
+			return result, nil
+		},
+	}
+
+	result, err := ti.Invoke(context.Background(), &fnrun.Input{})
+	if err != errFailed || result.Status != 500 {
+		t.Errorf("expected the failed invocation to be returned, got %+v and %v", result, err)
+	}
+	if called {
+		t.Error("expected the transformer not to be called for a failed invocation")
+	}
+}
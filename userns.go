@@ -0,0 +1,48 @@
+package main
+
+import "os/exec"
+
+// nobodyID is the UID and GID of the nobody user on most Linux systems.
+const nobodyID = 65534
+
+// -----------------------------------------------------------------------------
+// User Namespaces
+//
+// When INVOKER_USER_NS is true, each function process is started in a new user
+// namespace in which it runs as root, while its UID 0 and GID 0 are mapped to
+// the unprivileged INVOKER_USER_NS_UID and INVOKER_USER_NS_GID on the host.
+// The function can therefore change what it owns inside the namespace, but has
+// only the rights of that unprivileged user over the rest of the system.
+//
+// User namespaces are only available on Linux. The runner checks at startup
+// that the kernel allows them and, when the mapped IDs are not its own, that it
+// has the CAP_SETUID and CAP_SETGID capabilities needed to map them.
+
+// applyUserNamespace configures cmd to run in a new user namespace if
+// INVOKER_USER_NS is true.
+func applyUserNamespace(cmd *exec.Cmd) error {
+	// env: INVOKER_USER_NS bool false "Start function processes in a new user namespace in which they run as root, mapped to an unprivileged user on the host; Linux only."
+	if !getBoolEnv("INVOKER_USER_NS", false) {
+		return nil
+	}
+	if !userNamespacesSupported {
+		return configErrorf("INVOKER_USER_NS", "INVOKER_USER_NS is not supported on this platform")
+	}
+
+	// env: INVOKER_USER_NS_UID int 65534 "Host UID to which root in the user namespace of function processes is mapped."
+	uid := getIntEnv("INVOKER_USER_NS_UID", nobodyID)
+	// env: INVOKER_USER_NS_GID int 65534 "Host GID to which root in the user namespace of function processes is mapped."
+	gid := getIntEnv("INVOKER_USER_NS_GID", nobodyID)
+	if uid < 0 {
+		return configErrorf("INVOKER_USER_NS_UID", "INVOKER_USER_NS_UID must not be negative")
+	}
+	if gid < 0 {
+		return configErrorf("INVOKER_USER_NS_GID", "INVOKER_USER_NS_GID must not be negative")
+	}
+	if err := checkUserNamespaces(uid, gid); err != nil {
+		return configErrorf("INVOKER_USER_NS", "Cannot start function processes in a user namespace: %v", err)
+	}
+
+	setUserNamespace(cmd, uid, gid)
+	return nil
+}
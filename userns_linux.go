@@ -0,0 +1,83 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const userNamespacesSupported = true
+
+// The bits of the capabilities needed to map other IDs in a user namespace.
+const (
+	capSetGID = 6
+	capSetUID = 7
+)
+
+// checkUserNamespaces reports whether function processes can be started in a
+// user namespace with uid and gid mapped to root.
+func checkUserNamespaces(uid int, gid int) error {
+	if data, err := ioutil.ReadFile("/proc/sys/user/max_user_namespaces"); err == nil {
+		if strings.TrimSpace(string(data)) == "0" {
+			return errors.New("user namespaces are disabled by /proc/sys/user/max_user_namespaces")
+		}
+	}
+
+	if uid == os.Geteuid() && gid == os.Getegid() {
+		// An unprivileged process may map its own IDs.
+		return nil
+	}
+	caps, err := effectiveCapabilities()
+	if err != nil {
+		return err
+	}
+	if uid != os.Geteuid() && caps&(1<<capSetUID) == 0 {
+		return fmt.Errorf("mapping UID %d requires CAP_SETUID", uid)
+	}
+	if gid != os.Getegid() && caps&(1<<capSetGID) == 0 {
+		return fmt.Errorf("mapping GID %d requires CAP_SETGID", gid)
+	}
+	return nil
+}
+
+// effectiveCapabilities returns the effective capability set of the runner.
+func effectiveCapabilities() (uint64, error) {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value := strings.TrimPrefix(scanner.Text(), "CapEff:"); value != scanner.Text() {
+			return strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("could not find the effective capabilities in /proc/self/status")
+}
+
+func setUserNamespace(cmd *exec.Cmd, uid int, gid int) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}}
+	// The process keeps the credentials of the runner until it changes them,
+	// so it switches to the mapped root to take on the IDs of the host user.
+	// Supplementary groups cannot be set in the namespace and are dropped.
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: true}
+}
@@ -0,0 +1,149 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+var statusUIDPattern = regexp.MustCompile(`(?m)^Uid:\s*(\d+)\s+(\d+)`)
+var statusGIDPattern = regexp.MustCompile(`(?m)^Gid:\s*(\d+)\s+(\d+)`)
+
+// statusIDs returns the real and effective IDs that pattern matches in a
+// /proc/<pid>/status file.
+func statusIDs(t *testing.T, pattern *regexp.Regexp, status []byte) (int, int) {
+	t.Helper()
+	match := pattern.FindSubmatch(status)
+	if match == nil {
+		t.Fatalf("expected %v in %s", pattern, status)
+	}
+	id, _ := strconv.Atoi(string(match[1]))
+	effective, _ := strconv.Atoi(string(match[2]))
+	return id, effective
+}
+
+// publicTestFunctionCmd is like testFunctionCmd, but runs a copy of the test
+// binary that any user may execute, since the test binary is normally in a
+// directory that only its owner can enter.
+func publicTestFunctionCmd(t *testing.T, behavior string) *exec.Cmd {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "fnrun-userns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := os.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	path := filepath.Join(dir, "function")
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		t.Fatal(err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := testFunctionCmd(behavior)
+	cmd.Path = path
+	cmd.Args[0] = path
+	return cmd
+}
+
+func TestFunctionProcessesRunInUserNamespace(t *testing.T) {
+	if err := checkUserNamespaces(nobodyID, nobodyID); err != nil {
+		t.Skipf("cannot map the nobody user in a user namespace: %v", err)
+	}
+	setEnv(t, []string{"INVOKER_USER_NS_UID", "INVOKER_USER_NS_GID"}, map[string]string{"INVOKER_USER_NS": "true"})
+
+	cmd := publicTestFunctionCmd(t, "proc-status")
+	if err := applyUserNamespace(cmd); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := newSizedInvokerPool(newCmdInvokerFactory(cmd, time.Second, nil), "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	result, err := pool.Invoke(context.Background(), &fnrun.Input{Data: []byte("x")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uid, euid := statusIDs(t, statusUIDPattern, result.Data); uid != 0 || euid != 0 {
+		t.Errorf("expected the function to run as root in its namespace, got UID %d and EUID %d", uid, euid)
+	}
+
+	pid := invokePID(t, pool)
+	status, err := ioutil.ReadFile("/proc/" + pid + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid, euid := statusIDs(t, statusUIDPattern, status); uid != nobodyID || euid != nobodyID {
+		t.Errorf("expected the function to run as UID %d on the host, got UID %d and EUID %d", nobodyID, uid, euid)
+	}
+	if gid, egid := statusIDs(t, statusGIDPattern, status); gid != nobodyID || egid != nobodyID {
+		t.Errorf("expected the function to run as GID %d on the host, got GID %d and EGID %d", nobodyID, gid, egid)
+	}
+
+	own, err := os.Readlink("/proc/self/ns/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns, err := os.Readlink("/proc/" + pid + "/ns/user"); err != nil || ns == own {
+		t.Errorf("expected the function to run in another user namespace than %s, got %s: %v", own, ns, err)
+	}
+}
+
+func TestSetUserNamespaceMapsRoot(t *testing.T) {
+	cmd := testFunctionCmd("echo")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	setUserNamespace(cmd, 1000, 2000)
+
+	attr := cmd.SysProcAttr
+	if !attr.Setpgid || attr.Cloneflags&syscall.CLONE_NEWUSER == 0 {
+		t.Errorf("expected CLONE_NEWUSER to be added to the attributes, got %+v", attr)
+	}
+	if len(attr.UidMappings) != 1 || attr.UidMappings[0] != (syscall.SysProcIDMap{ContainerID: 0, HostID: 1000, Size: 1}) {
+		t.Errorf("expected root to be mapped to UID 1000, got %+v", attr.UidMappings)
+	}
+	if len(attr.GidMappings) != 1 || attr.GidMappings[0] != (syscall.SysProcIDMap{ContainerID: 0, HostID: 2000, Size: 1}) {
+		t.Errorf("expected root to be mapped to GID 2000, got %+v", attr.GidMappings)
+	}
+	if attr.Credential == nil || attr.Credential.Uid != 0 || attr.Credential.Gid != 0 || !attr.Credential.NoSetGroups {
+		t.Errorf("expected the process to switch to the mapped root, got %+v", attr.Credential)
+	}
+}
+
+func TestCheckUserNamespacesAllowsOwnIDs(t *testing.T) {
+	data, err := ioutil.ReadFile("/proc/sys/user/max_user_namespaces")
+	if err == nil && string(data) == "0\n" {
+		t.Skip("user namespaces are disabled")
+	}
+	if err := checkUserNamespaces(os.Geteuid(), os.Getegid()); err != nil {
+		t.Errorf("expected the IDs of the runner to be allowed, got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+const userNamespacesSupported = false
+
+func checkUserNamespaces(uid int, gid int) error {
+	return errors.New("user namespaces are not supported on this platform")
+}
+
+func setUserNamespace(cmd *exec.Cmd, uid int, gid int) {}
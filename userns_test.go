@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestApplyUserNamespaceIsDisabledByDefault(t *testing.T) {
+	t.Setenv("INVOKER_USER_NS", "")
+	cmd := testFunctionCmd("echo")
+	if err := applyUserNamespace(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.SysProcAttr != nil {
+		t.Errorf("expected the command to be left unchanged, got %+v", cmd.SysProcAttr)
+	}
+}
+
+func TestApplyUserNamespaceConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantName string
+	}{
+		{"negative UID", map[string]string{"INVOKER_USER_NS_UID": "-1"}, "INVOKER_USER_NS_UID"},
+		{"negative GID", map[string]string{"INVOKER_USER_NS_GID": "-1"}, "INVOKER_USER_NS_GID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, []string{"INVOKER_USER_NS_UID", "INVOKER_USER_NS_GID"}, tt.env)
+			t.Setenv("INVOKER_USER_NS", "true")
+
+			wantName := tt.wantName
+			if !userNamespacesSupported {
+				wantName = "INVOKER_USER_NS"
+			}
+			checkConfigError(t, applyUserNamespace(testFunctionCmd("echo")), wantName, wantName)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const (
+	functionVersionKey     = "x-function-version"
+	defaultFunctionVersion = "default"
+)
+
+// -----------------------------------------------------------------------------
+// Version Router
+//
+// The version router serves several versions of a function from a single
+// runner. Each version has its own invoker pool, and the version used for an
+// invocation is selected by the x-function-version metadata key, falling back
+// to the default version when the key is absent.
+
+type versionRouter struct {
+	pools map[string]*invokerPool
+}
+
+// newVersionRouter creates a router from the JSON manifest at path, which maps
+// version names to function commands. The settings of each pool may be
+// overridden with environment variables suffixed by the upper-cased version
+// name (e.g., MAX_FUNCTION_COUNT_V2).
+func newVersionRouter(path string) (*versionRouter, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, configErrorf("FUNCTION_VERSION_MANIFEST", "could not read FUNCTION_VERSION_MANIFEST: %v", err)
+	}
+
+	var manifest map[string]string
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return nil, configErrorf("FUNCTION_VERSION_MANIFEST", "could not parse FUNCTION_VERSION_MANIFEST: %v", err)
+	}
+
+	if _, ok := manifest[defaultFunctionVersion]; !ok {
+		return nil, configErrorf("FUNCTION_VERSION_MANIFEST", "FUNCTION_VERSION_MANIFEST must contain a %q version", defaultFunctionVersion)
+	}
+
+	router := &versionRouter{pools: make(map[string]*invokerPool, len(manifest))}
+	for version, cmdStr := range manifest {
+		factory, err := newFunctionCmdFactory(cmdStr)
+		if err != nil {
+			router.Close()
+			return nil, err
+		}
+
+		pool, err := newInvokerPool(factory, versionEnvSuffix(version))
+		if err != nil {
+			router.Close()
+			return nil, err
+		}
+		router.pools[version] = pool
+	}
+
+	return router, nil
+}
+
+// versionEnvSuffix converts a version name into a form suitable for use in an
+// environment variable name.
+func versionEnvSuffix(version string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, version)
+}
+
+func (vr *versionRouter) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	version := defaultFunctionVersion
+	if metadata, ok := runner.MetadataFromContext(ctx); ok && metadata[functionVersionKey] != "" {
+		version = metadata[functionVersionKey]
+	}
+
+	pool, ok := vr.pools[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown function version %s", version)
+	}
+
+	return pool.Invoke(ctx, input)
+}
+
+func (vr *versionRouter) queueDepth() int {
+	depth := 0
+	for _, pool := range vr.pools {
+		depth += pool.queueDepth()
+	}
+	return depth
+}
+
+func (vr *versionRouter) utilization() (active int, capacity int) {
+	for _, pool := range vr.pools {
+		poolActive, poolCapacity := pool.utilization()
+		active += poolActive
+		capacity += poolCapacity
+	}
+	return active, capacity
+}
+
+func (vr *versionRouter) capacity() (slots int, prioritySlots int) {
+	for _, pool := range vr.pools {
+		poolSlots, poolPrioritySlots := pool.capacity()
+		slots += poolSlots
+		prioritySlots += poolPrioritySlots
+	}
+	return slots, prioritySlots
+}
+
+func (vr *versionRouter) functionProcesses() []*trackedProcess {
+	var processes []*trackedProcess
+	for _, pool := range vr.pools {
+		processes = append(processes, pool.functionProcesses()...)
+	}
+	return processes
+}
+
+// Close closes the pools for every version.
+func (vr *versionRouter) Close() error {
+	var firstErr error
+	for _, pool := range vr.pools {
+		if err := pool.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func writeVersionManifest(t *testing.T, manifest map[string]string) string {
+	t.Helper()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "versions.json")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVersionRouterRoutesInputsToTheirVersion(t *testing.T) {
+	t.Setenv(testFunctionEnv, "args")
+	t.Setenv("MAX_FUNCTION_COUNT", "1")
+	path := writeVersionManifest(t, map[string]string{
+		defaultFunctionVersion: os.Args[0] + " v1",
+		"v2-beta":              os.Args[0] + " v2",
+	})
+
+	router, err := newVersionRouter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"", "v1"},
+		{defaultFunctionVersion, "v1"},
+		{"v2-beta", "v2"},
+		{"", "v1"},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if tt.version != "" {
+			ctx = runner.WithMetadata(ctx, map[string]string{functionVersionKey: tt.version})
+		}
+		result, err := router.Invoke(ctx, &fnrun.Input{})
+		cancel()
+		if err != nil {
+			t.Fatalf("unexpected error for version %q: %v", tt.version, err)
+		}
+		if string(result.Data) != tt.want {
+			t.Errorf("expected version %q to be served by %s, got %s", tt.version, tt.want, result.Data)
+		}
+	}
+
+	ctx := runner.WithMetadata(context.Background(), map[string]string{functionVersionKey: "v3"})
+	if _, err := router.Invoke(ctx, &fnrun.Input{}); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+}
+
+func TestNewVersionRouterRejectsInvalidManifests(t *testing.T) {
+	tests := map[string]string{
+		"missing default": `{"v2": "cat"}`,
+		"invalid json":    `{"default": `,
+		"not a map":       `["cat"]`,
+	}
+
+	for name, manifest := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "versions.json")
+			if err := ioutil.WriteFile(path, []byte(manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := newVersionRouter(path); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	if _, err := newVersionRouter(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing manifest")
+	}
+}
+
+func TestVersionEnvSuffix(t *testing.T) {
+	tests := map[string]string{
+		"v2":        "V2",
+		"v2-beta.1": "V2_BETA_1",
+		"Canary":    "CANARY",
+	}
+	for version, want := range tests {
+		if got := versionEnvSuffix(version); got != want {
+			t.Errorf("expected %q for %q, got %q", want, version, got)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+const warmupKey = "x-warmup"
+
+// -----------------------------------------------------------------------------
+// Warm-up Scheduler
+//
+// The warm-up scheduler starts function processes ahead of expected traffic,
+// such as before the morning surge after processes were stopped overnight for
+// being idle. At each time matched by a cron schedule, it sends count
+// synthetic invocations at once, so that count invokers have a running process
+// when traffic arrives. A warm-up invocation has empty data and the x-warmup
+// key set to true in both its metadata and the execution context env, so that
+// the function can recognize it. Warm-up invocations go to the invoker pools
+// directly and their results are not delivered to the sink.
+
+func runWarmups(ctx context.Context, invoker fnrun.Invoker, schedule *cronSchedule, count int) {
+	for {
+		next := schedule.next(time.Now())
+		if next.IsZero() {
+			log.Printf("warm-up schedule never matches; no warm-ups will run")
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		warmup(ctx, invoker, count)
+	}
+}
+
+// warmup sends count warm-up invocations concurrently and logs how many
+// failed.
+func warmup(ctx context.Context, invoker fnrun.Invoker, count int) {
+	ctx = runner.WithMetadata(ctx, map[string]string{warmupKey: "true"})
+	ctx = fnrun.WithEnv(ctx, map[string]string{warmupKey: "true"})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := invoker.Invoke(ctx, &fnrun.Input{}); err != nil {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	log.Printf("warmed up %d invoker(s); %d warm-up invocation(s) failed", count-failed, failed)
+}
+
+// -----------------------------------------------------------------------------
+// Cron Schedules
+//
+// A cron schedule is a standard five-field cron expression: minute, hour, day
+// of month, month and day of week, evaluated in local time. Each field is *,
+// a number, a range such as 1-5, or a comma-separated list of them, and any of
+// these may be followed by a step such as */15. Sunday is 0 or 7 in the day of
+// week field. As in cron, when both the day of month and the day of week are
+// restricted, a day matches if either of them does.
+
+type cronSchedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	anyDay   bool
+	anyWeek  bool
+}
+
+func parseCronSchedule(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if s.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if s.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if s.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if s.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+	}
+	s.anyDay = fields[2] == "*"
+	s.anyWeek = fields[4] == "*"
+
+	return &s, nil
+}
+
+// parseCronField returns the set of values in [min, max] matched by field as
+// a bit set.
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in cron field %q", field)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			var err error
+			bounds := strings.SplitN(part, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value in cron field %q", field)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid range in cron field %q", field)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("cron field %q is out of range %d-%d", field, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	inMonth := s.days&(1<<uint(t.Day())) != 0
+	inWeek := s.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeek:
+		return true
+	case s.anyDay:
+		return inWeek
+	case s.anyWeek:
+		return inMonth
+	default:
+		return inMonth || inWeek
+	}
+}
+
+// next returns the first time after t matched by the schedule, or the zero
+// time if there is none within five years.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
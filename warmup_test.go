@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2024-01-10 is a Wednesday.
+	now := time.Date(2024, 1, 10, 6, 30, 15, 0, time.Local)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 10, 6, 31, 0, 0, time.Local)},
+		{"0 7 * * *", time.Date(2024, 1, 10, 7, 0, 0, 0, time.Local)},
+		{"0 6 * * *", time.Date(2024, 1, 11, 6, 0, 0, 0, time.Local)},
+		{"*/15 * * * *", time.Date(2024, 1, 10, 6, 45, 0, 0, time.Local)},
+		{"5,40 6 * * *", time.Date(2024, 1, 10, 6, 40, 0, 0, time.Local)},
+		{"0 9 * * 1-5", time.Date(2024, 1, 10, 9, 0, 0, 0, time.Local)},
+		{"0 9 * * 0", time.Date(2024, 1, 14, 9, 0, 0, 0, time.Local)},
+		{"0 9 * * 7", time.Date(2024, 1, 14, 9, 0, 0, 0, time.Local)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.Local)},
+		// Either the day of month or the day of week may match.
+		{"0 0 20 * 5", time.Date(2024, 1, 12, 0, 0, 0, 0, time.Local)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		schedule, err := parseCronSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.next(now); !got.Equal(tt.want) {
+			t.Errorf("expected %q to next match at %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+}
+
+func TestParseCronScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+	} {
+		if _, err := parseCronSchedule(expr); err == nil {
+			t.Errorf("expected an error for %q", expr)
+		}
+	}
+}
+
+func TestWarmupStartsInvokers(t *testing.T) {
+	pool, _ := newTestCmdPool(t, 3, time.Second, func() *cmdInvokerFactory {
+		return newCmdInvokerFactory(testFunctionCmd("echo", "FNRUN_TEST_SLEEP_MS=100"), time.Second, nil)
+	})
+	defer pool.Close()
+
+	// The processes are stopped as they would be overnight.
+	ctx, cancel := context.WithCancel(context.Background())
+	reaped := make(chan struct{})
+	go func() {
+		reapIdleInvokers(ctx, pool, 10*time.Millisecond, time.Millisecond, 0)
+		close(reaped)
+	}()
+	waitForProcessCount(t, pool, 0)
+	cancel()
+	<-reaped
+
+	warmup(context.Background(), pool, 3)
+	if count := len(allFunctionProcesses(pool)); count != 3 {
+		t.Errorf("expected the warm-up to start 3 function processes, got %d", count)
+	}
+}
+
+func TestWarmupMarksInvocations(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	warmup(context.Background(), invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		metadata, _ := runner.MetadataFromContext(ctx)
+		env, _ := fnrun.Env(ctx)
+		if metadata[warmupKey] != "true" || env[warmupKey] != "true" {
+			t.Errorf("expected %s in the metadata and env, got %v and %v", warmupKey, metadata, env)
+		}
+		if len(input.Data) != 0 {
+			t.Errorf("expected a warm-up input to be empty, got %q", input.Data)
+		}
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return &fnrun.Result{}, nil
+	}), 4)
+
+	if calls != 4 {
+		t.Errorf("expected 4 warm-up invocations, got %d", calls)
+	}
+}
+
+func TestRunWarmupsReturns(t *testing.T) {
+	never, err := parseCronSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	everyMinute, err := parseCronSchedule("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tt := range []struct {
+		ctx      context.Context
+		schedule *cronSchedule
+	}{
+		{context.Background(), never},
+		{cancelled, everyMinute},
+	} {
+		done := make(chan struct{})
+		go func() {
+			runWarmups(tt.ctx, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+				t.Error("expected no warm-up invocation")
+				return nil, nil
+			}), tt.schedule, 1)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected runWarmups to return")
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	callerIDKey = "x-caller-id"
+
+	webhookAuthAPIKey = "apikey"
+	webhookAuthJWT    = "jwt"
+
+	// jwksRefreshInterval is the minimum time between two requests for the
+	// key set, which is requested again when a token names an unknown key.
+	jwksRefreshInterval = time.Minute
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+// -----------------------------------------------------------------------------
+// Webhook Authentication
+//
+// The HTTP source can require each request to authenticate with a bearer token
+// in its Authorization header. Requests that do not authenticate receive a 401
+// response without being invoked, and the identity of the caller of the others
+// is passed to the invocation as its x-caller-id metadata.
+//
+// With WEBHOOK_AUTH=apikey, the token must be one of the comma-separated keys
+// in WEBHOOK_API_KEYS. A key may be written as <caller>:<key> to name the
+// caller it identifies; a key without a caller identifies apikey-<n>, where n
+// is its position in the list.
+//
+// With WEBHOOK_AUTH=jwt, the token must be a JWT with a valid signature that
+// has not expired and whose nbf, if any, has passed. The caller is its sub
+// claim. Tokens signed with HS256, HS384 or HS512 are verified with
+// WEBHOOK_JWT_SECRET, and tokens signed with RS256, RS384, RS512, ES256,
+// ES384 or ES512 with the keys of the JWKS at WEBHOOK_JWKS_URL. The key set is
+// requested when the source starts and again, at most once a minute, when a
+// token names a key that is not in it.
+
+// requestAuthenticator returns the identity of the caller of a request, or
+// errUnauthorized if the request is not authenticated.
+type requestAuthenticator func(r *http.Request) (string, error)
+
+func getWebhookAuthenticator() (requestAuthenticator, error) {
+	// env: WEBHOOK_AUTH string "" "Authentication required of HTTP source requests: apikey or jwt."
+	switch method := os.Getenv("WEBHOOK_AUTH"); method {
+	case "":
+		return nil, nil
+	case webhookAuthAPIKey:
+		// env: WEBHOOK_API_KEYS list "" "Comma-separated API keys, optionally written as <caller>:<key>, accepted when WEBHOOK_AUTH is apikey."
+		return newAPIKeyAuthenticator(os.Getenv("WEBHOOK_API_KEYS"))
+	case webhookAuthJWT:
+		// env: WEBHOOK_JWT_SECRET string "" "Secret that verifies HS* tokens when WEBHOOK_AUTH is jwt."
+		// env: WEBHOOK_JWKS_URL string "" "JWKS with the keys that verify RS* and ES* tokens when WEBHOOK_AUTH is jwt."
+		return newJWTAuthenticator(os.Getenv("WEBHOOK_JWT_SECRET"), os.Getenv("WEBHOOK_JWKS_URL"), time.Now)
+	default:
+		return nil, configErrorf("WEBHOOK_AUTH", "Unknown WEBHOOK_AUTH %s", method)
+	}
+}
+
+// bearerToken returns the bearer token in the Authorization header of r.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+func newAPIKeyAuthenticator(list string) (requestAuthenticator, error) {
+	type apiKey struct {
+		caller string
+		key    []byte
+	}
+
+	var keys []apiKey
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key := apiKey{caller: "apikey-" + strconv.Itoa(len(keys)+1), key: []byte(entry)}
+		if i := strings.IndexByte(entry, ':'); i > 0 {
+			key.caller, key.key = entry[:i], []byte(entry[i+1:])
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, configErrorf("WEBHOOK_API_KEYS", "WEBHOOK_API_KEYS is required when WEBHOOK_AUTH is apikey")
+	}
+
+	return func(r *http.Request) (string, error) {
+		token, ok := bearerToken(r)
+		if !ok {
+			return "", errUnauthorized
+		}
+		// Every key is compared so that the time taken does not reveal which
+		// key was closest to the token.
+		caller := ""
+		for _, key := range keys {
+			if subtle.ConstantTimeCompare([]byte(token), key.key) == 1 && caller == "" {
+				caller = key.caller
+			}
+		}
+		if caller == "" {
+			return "", errUnauthorized
+		}
+		return caller, nil
+	}, nil
+}
+
+// -----------------------------------------------------------------------------
+// JWT verification
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Sub string          `json:"sub"`
+	Exp json.RawMessage `json:"exp"`
+	Nbf json.RawMessage `json:"nbf"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwtAuthenticator struct {
+	secret  []byte
+	jwksURL string
+	client  *http.Client
+	now     func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newJWTAuthenticator(secret string, jwksURL string, now func() time.Time) (requestAuthenticator, error) {
+	if secret == "" && jwksURL == "" {
+		return nil, configErrorf("WEBHOOK_JWT_SECRET", "WEBHOOK_JWT_SECRET or WEBHOOK_JWKS_URL is required when WEBHOOK_AUTH is jwt")
+	}
+
+	ja := &jwtAuthenticator{
+		secret:  []byte(secret),
+		jwksURL: jwksURL,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     now,
+	}
+	if jwksURL != "" {
+		err := connectWithBackoff(func() error {
+			return ja.refreshKeys()
+		})
+		if err != nil {
+			return nil, configErrorf("WEBHOOK_JWKS_URL", "could not read the key set at %s: %v", jwksURL, err)
+		}
+	}
+
+	return func(r *http.Request) (string, error) {
+		token, ok := bearerToken(r)
+		if !ok {
+			return "", errUnauthorized
+		}
+		caller, err := ja.verify(token)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errUnauthorized, err)
+		}
+		return caller, nil
+	}, nil
+}
+
+// verify checks the signature and validity period of token and returns its
+// subject.
+func (ja *jwtAuthenticator) verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return "", err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed signature")
+	}
+	if err := ja.verifySignature(header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return "", err
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return "", err
+	}
+	now := ja.now()
+	exp, err := jwtTime(claims.Exp)
+	if err != nil || exp.IsZero() {
+		return "", errors.New("token has no valid exp claim")
+	}
+	if !now.Before(exp) {
+		return "", errors.New("token has expired")
+	}
+	if nbf, err := jwtTime(claims.Nbf); err != nil || now.Before(nbf) {
+		return "", errors.New("token is not valid yet")
+	}
+	if claims.Sub == "" {
+		return "", errors.New("token has no sub claim")
+	}
+	return claims.Sub, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("malformed token: %v", err)
+	}
+	return nil
+}
+
+// jwtTime parses a NumericDate claim. It returns the zero time if the claim is
+// absent.
+func jwtTime(raw json.RawMessage) (time.Time, error) {
+	if len(raw) == 0 {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
+
+func jwtHash(alg string) (crypto.Hash, func() hash.Hash, bool) {
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, sha256.New, true
+	case "384":
+		return crypto.SHA384, sha512.New384, true
+	case "512":
+		return crypto.SHA512, sha512.New, true
+	}
+	return 0, nil, false
+}
+
+func (ja *jwtAuthenticator) verifySignature(header jwtHeader, signed []byte, signature []byte) error {
+	if len(header.Alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+	hashID, newHash, ok := jwtHash(header.Alg)
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	switch header.Alg[:2] {
+	case "HS":
+		if len(ja.secret) == 0 {
+			return fmt.Errorf("no secret to verify %s tokens", header.Alg)
+		}
+		mac := hmac.New(newHash, ja.secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case "RS", "ES":
+		digest := newHash()
+		digest.Write(signed)
+		sum := digest.Sum(nil)
+		for _, key := range ja.publicKeys(header.Kid) {
+			if verifyJWTKey(header.Alg, hashID, key, sum, signature) {
+				return nil
+			}
+		}
+		return errors.New("invalid signature")
+	default:
+		return fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+}
+
+func verifyJWTKey(alg string, hashID crypto.Hash, key crypto.PublicKey, sum []byte, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return alg[:2] == "RS" && rsa.VerifyPKCS1v15(key, hashID, sum, signature) == nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, sum, r, s)
+	}
+	return false
+}
+
+// publicKeys returns the keys that may have signed a token with the given key
+// ID, requesting the key set again if it does not contain the key.
+func (ja *jwtAuthenticator) publicKeys(kid string) []crypto.PublicKey {
+	if ja.jwksURL == "" {
+		return nil
+	}
+
+	ja.mu.Lock()
+	_, known := ja.keys[kid]
+	stale := ja.now().Sub(ja.fetchedAt) >= jwksRefreshInterval
+	ja.mu.Unlock()
+	if kid != "" && !known && stale {
+		if err := ja.refreshKeys(); err != nil {
+			log.Printf("could not refresh the key set at %s: %v", ja.jwksURL, err)
+		}
+	}
+
+	ja.mu.Lock()
+	defer ja.mu.Unlock()
+	if kid != "" {
+		if key, ok := ja.keys[kid]; ok {
+			return []crypto.PublicKey{key}
+		}
+		return nil
+	}
+	keys := make([]crypto.PublicKey, 0, len(ja.keys))
+	for _, key := range ja.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// refreshKeys requests the key set and replaces the cached keys with its RSA
+// and EC keys.
+func (ja *jwtAuthenticator) refreshKeys() error {
+	ja.mu.Lock()
+	ja.fetchedAt = ja.now()
+	ja.mu.Unlock()
+
+	resp, err := ja.client.Get(ja.jwksURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("ignoring key %q of the key set at %s: %v", k.Kid, ja.jwksURL, err)
+			continue
+		}
+		kid := k.Kid
+		if kid == "" {
+			kid = "#" + strconv.Itoa(i)
+		}
+		keys[kid] = key
+	}
+
+	ja.mu.Lock()
+	ja.keys = keys
+	ja.mu.Unlock()
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
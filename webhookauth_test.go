@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun-runner/runner"
+)
+
+// jwtNow is the time at which the tokens of the tests are verified.
+var jwtNow = time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC)
+
+func fixedJWTNow() time.Time { return jwtNow }
+
+// signJWT returns a token with the given claims signed with key, which is a
+// secret for HS256, an *rsa.PrivateKey for RS256 or an *ecdsa.PrivateKey for
+// ES256. The token has no signature if key is nil.
+func signJWT(t *testing.T, alg string, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	signed := encode(header) + "." + encode(claims)
+	sum := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// validClaims returns claims for subject that are valid at jwtNow.
+func validClaims(subject string) map[string]interface{} {
+	return map[string]interface{}{"sub": subject, "exp": jwtNow.Add(time.Hour).Unix()}
+}
+
+// authenticate authenticates a request with the given Authorization header.
+func authenticate(auth requestAuthenticator, authorization string) (string, error) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	return auth(r)
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	auth, err := newAPIKeyAuthenticator("billing:s3cret, k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		authorization string
+		want          string
+	}{
+		{"Bearer s3cret", "billing"},
+		{"bearer k2", "apikey-2"},
+		{"Bearer wrong", ""},
+		{"Bearer billing:s3cret", ""},
+		{"Basic s3cret", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		caller, err := authenticate(auth, tt.authorization)
+		if tt.want == "" {
+			if !errors.Is(err, errUnauthorized) {
+				t.Errorf("%q: expected errUnauthorized, got %q, %v", tt.authorization, caller, err)
+			}
+		} else if err != nil || caller != tt.want {
+			t.Errorf("%q: expected caller %s, got %q, %v", tt.authorization, tt.want, caller, err)
+		}
+	}
+}
+
+func TestJWTAuthenticatorWithASecret(t *testing.T) {
+	secret := []byte("jwt-secret")
+	auth, err := newJWTAuthenticator(string(secret), "", fixedJWTNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := validClaims("alice")
+	expired["exp"] = jwtNow.Add(-time.Minute).Unix()
+	notYetValid := validClaims("alice")
+	notYetValid["nbf"] = jwtNow.Add(time.Minute).Unix()
+	noExpiry := map[string]interface{}{"sub": "alice"}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"valid", signJWT(t, "HS256", "", secret, validClaims("alice")), "alice"},
+		{"expired", signJWT(t, "HS256", "", secret, expired), ""},
+		{"not yet valid", signJWT(t, "HS256", "", secret, notYetValid), ""},
+		{"without exp", signJWT(t, "HS256", "", secret, noExpiry), ""},
+		{"without sub", signJWT(t, "HS256", "", secret, validClaims("")), ""},
+		{"wrong secret", signJWT(t, "HS256", "", []byte("other"), validClaims("alice")), ""},
+		{"unsigned", signJWT(t, "none", "", nil, validClaims("alice")), ""},
+		{"malformed", "not.a-token", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller, err := authenticate(auth, "Bearer "+tt.token)
+			if tt.want == "" {
+				if !errors.Is(err, errUnauthorized) {
+					t.Errorf("expected errUnauthorized, got %q, %v", caller, err)
+				}
+			} else if err != nil || caller != tt.want {
+				t.Errorf("expected caller %s, got %q, %v", tt.want, caller, err)
+			}
+		})
+	}
+}
+
+// newJWKSServer serves a key set with the public keys of rsaKey and ecKey,
+// under the key IDs rsa-1 and ec-1, and counts the requests for it.
+func newJWKSServer(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey, requests *int64) *httptest.Server {
+	t.Helper()
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	set := map[string][]jwk{"keys": {
+		{Kty: "RSA", Kid: "rsa-1", N: encode(rsaKey.N), E: encode(big.NewInt(int64(rsaKey.E)))},
+		{Kty: "EC", Kid: "ec-1", Crv: "P-256", X: encode(ecKey.X), Y: encode(ecKey.Y)},
+	}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(requests, 1)
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestJWTAuthenticatorWithAKeySet(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int64
+	server := newJWKSServer(t, rsaKey, ecKey, &requests)
+	auth, err := newJWTAuthenticator("", server.URL, fixedJWTNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"RS256", signJWT(t, "RS256", "rsa-1", rsaKey, validClaims("alice")), "alice"},
+		{"ES256", signJWT(t, "ES256", "ec-1", ecKey, validClaims("bob")), "bob"},
+		{"without a key ID", signJWT(t, "ES256", "", ecKey, validClaims("bob")), "bob"},
+		{"another key", signJWT(t, "ES256", "ec-1", otherKey, validClaims("mallory")), ""},
+		{"HS256 without a secret", signJWT(t, "HS256", "", []byte("secret"), validClaims("mallory")), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller, err := authenticate(auth, "Bearer "+tt.token)
+			if tt.want == "" {
+				if !errors.Is(err, errUnauthorized) {
+					t.Errorf("expected errUnauthorized, got %q, %v", caller, err)
+				}
+			} else if err != nil || caller != tt.want {
+				t.Errorf("expected caller %s, got %q, %v", tt.want, caller, err)
+			}
+		})
+	}
+
+	// Tokens signed with known keys are verified with the cached key set.
+	if n := atomic.LoadInt64(&requests); n != 1 {
+		t.Errorf("expected the key set to be requested once, got %d", n)
+	}
+}
+
+func TestJWTAuthenticatorRefreshesTheKeySetForUnknownKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int64
+	server := newJWKSServer(t, rsaKey, ecKey, &requests)
+	now := jwtNow
+	auth, err := newJWTAuthenticator("", server.URL, func() time.Time { return now })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := "Bearer " + signJWT(t, "RS256", "rsa-2", rsaKey, validClaims("alice"))
+	authenticate(auth, token)
+	if n := atomic.LoadInt64(&requests); n != 1 {
+		t.Errorf("expected no refresh within a minute of the last request, got %d requests", n)
+	}
+	now = now.Add(jwksRefreshInterval)
+	if _, err := authenticate(auth, token); !errors.Is(err, errUnauthorized) {
+		t.Errorf("expected errUnauthorized for an unknown key, got %v", err)
+	}
+	if n := atomic.LoadInt64(&requests); n != 2 {
+		t.Errorf("expected the key set to be requested again, got %d requests", n)
+	}
+}
+
+func TestHTTPSourceAuthenticatesRequests(t *testing.T) {
+	auth, err := newAPIKeyAuthenticator("billing:s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddr(t)
+	source := newHTTPSource(addr, false, time.Second, 0, 0, nil, nil, auth, nil, nil, 1, nil)
+	var invocations int64
+	runHTTPSource(t, addr, source, invokerFunc(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		atomic.AddInt64(&invocations, 1)
+		md, _ := runner.MetadataFromContext(ctx)
+		return &fnrun.Result{Status: 200, Data: []byte(md[callerIDKey])}, nil
+	}))
+
+	post := func(authorization string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/", strings.NewReader("x"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", authorization)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := post("Bearer s3cret"); status != http.StatusOK || body != "billing" {
+		t.Errorf("expected the caller to be passed as x-caller-id, got %d %q", status, body)
+	}
+	if status, _ := post("Bearer wrong"); status != http.StatusUnauthorized {
+		t.Errorf("expected status 401 for a wrong key, got %d", status)
+	}
+	if n := atomic.LoadInt64(&invocations); n != 1 {
+		t.Errorf("expected only the authenticated request to be invoked, got %d invocations", n)
+	}
+}
+
+func TestWebhookAuthConfiguration(t *testing.T) {
+	tests := []struct {
+		env     map[string]string
+		wantErr string
+	}{
+		{map[string]string{"WEBHOOK_AUTH": "oauth"}, "WEBHOOK_AUTH"},
+		{map[string]string{"WEBHOOK_AUTH": "apikey"}, "WEBHOOK_API_KEYS"},
+		{map[string]string{"WEBHOOK_AUTH": "jwt"}, "WEBHOOK_JWT_SECRET"},
+	}
+
+	for _, tt := range tests {
+		setEnv(t, []string{"WEBHOOK_AUTH", "WEBHOOK_API_KEYS", "WEBHOOK_JWT_SECRET", "WEBHOOK_JWKS_URL"}, tt.env)
+		_, err := getWebhookAuthenticator()
+		var configErr *runner.ConfigError
+		if !errors.As(err, &configErr) || configErr.Name != tt.wantErr {
+			t.Errorf("%v: expected a %s config error, got %v", tt.env, tt.wantErr, err)
+		}
+	}
+}